@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ehrlich-b/wingthing/internal/auth"
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/egg"
+	"github.com/spf13/cobra"
+)
+
+func auditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect session audit recordings",
+	}
+	cmd.AddCommand(auditVerifyCmd())
+	return cmd
+}
+
+func auditVerifyCmd() *cobra.Command {
+	var keyFlag string
+	var notaryFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "verify <session-id>",
+		Short: "Check a session's audit files against its signed hash chain",
+		Long: `Recomputes the hash chain in audit.chain over audit.pty.gz and audit.log
+and checks its signatures. Detects modified bytes, truncated files, removed
+chain entries, and data appended after the session was sealed.
+
+By default the chain must be signed by this wing's key; use --key to trust a
+different signer (base64 Ed25519 public key). With --notary, the head the
+relay witnessed (wing.yaml notarize: true) must also be part of the chain,
+which catches a chain rewritten from scratch on this machine.
+
+Exits non-zero if any problem is found.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			sessionID := args[0]
+			dir := filepath.Join(cfg.Dir, "eggs", sessionID)
+			if _, err := os.Stat(dir); err != nil {
+				return fmt.Errorf("session %s not found", sessionID)
+			}
+
+			var trusted ed25519.PublicKey
+			if keyFlag != "" {
+				b, err := base64.StdEncoding.DecodeString(keyFlag)
+				if err != nil || len(b) != ed25519.PublicKeySize {
+					return fmt.Errorf("--key: not a base64 Ed25519 public key")
+				}
+				trusted = b
+			} else if priv, err := auth.LoadPrivateKey(cfg.Dir); err == nil {
+				if sk, err := auth.DeriveSigningKey(priv); err == nil {
+					trusted = sk.Public().(ed25519.PublicKey)
+				}
+			}
+
+			var notarized *egg.ChainHead
+			if notaryFlag {
+				notarized, err = fetchNotarizedHead(cfg, sessionID)
+				if err != nil {
+					return err
+				}
+				if !notarized.Verify() {
+					return fmt.Errorf("notarized head has an invalid signature")
+				}
+			}
+
+			rep, err := egg.VerifyAuditChain(dir, trusted, notarized)
+			if err != nil {
+				return fmt.Errorf("verify %s: %w", sessionID, err)
+			}
+			printChainReport(rep, trusted != nil, notarized)
+			if !rep.OK() {
+				return fmt.Errorf("audit verification failed")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&keyFlag, "key", "", "trusted signer public key (default: this wing's key)")
+	cmd.Flags().BoolVar(&notaryFlag, "notary", false, "also check against the head notarized by the relay")
+	return cmd
+}
+
+func printChainReport(rep *egg.ChainReport, trusted bool, notarized *egg.ChainHead) {
+	fmt.Printf("session:    %s\n", rep.SessionID)
+	switch {
+	case rep.Key == "":
+		fmt.Println("signer:     none (unsigned chain)")
+	case trusted:
+		fmt.Printf("signer:     %s (trusted)\n", rep.Key)
+	default:
+		fmt.Printf("signer:     %s (not checked)\n", rep.Key)
+	}
+	fmt.Printf("entries:    %d (signed through %d, %d signatures)\n", rep.Entries, rep.SignedSeq, rep.Signatures)
+	if rep.Unsigned > 0 {
+		fmt.Printf("unsigned:   %d entries after the last signature (not verified)\n", rep.Unsigned)
+	}
+	streams := make([]string, 0, len(rep.Covered))
+	for s := range rep.Covered {
+		streams = append(streams, s)
+	}
+	sort.Strings(streams)
+	for _, s := range streams {
+		line := fmt.Sprintf("  %-4s %d bytes covered", s, rep.Covered[s])
+		if n := rep.Unsealed[s]; n > 0 {
+			line += fmt.Sprintf(", %d not yet covered", n)
+		}
+		fmt.Println(line)
+	}
+	if rep.Sealed {
+		fmt.Println("sealed:     yes")
+	} else {
+		fmt.Println("sealed:     no (session running, or ended without a seal)")
+	}
+	if notarized != nil {
+		fmt.Printf("notary:     entry %d\n", notarized.Seq)
+	}
+	if rep.OK() {
+		fmt.Println("result:     OK")
+		return
+	}
+	fmt.Println("result:     FAILED")
+	for _, p := range rep.Problems {
+		fmt.Printf("  - %s\n", p)
+	}
+}
+
+// fetchNotarizedHead asks the relay for the audit chain head it witnessed for
+// one of this wing's sessions.
+func fetchNotarizedHead(cfg *config.Config, sessionID string) (*egg.ChainHead, error) {
+	if cfg.WingID == "" {
+		return nil, fmt.Errorf("no wing ID — run: wt wing start")
+	}
+	ts := auth.NewTokenStore(cfg.Dir)
+	tok, err := ts.Load()
+	if err != nil || !ts.IsValid(tok) {
+		return nil, fmt.Errorf("not logged in — run: wt login")
+	}
+	url := resolveRelayHTTPURL(cfg) + "/api/app/wings/" + cfg.WingID + "/sessions/" + sessionID + "/audit-head"
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+tok.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch notarized head: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("relay has no notarized head for %s", sessionID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch notarized head: %s", resp.Status)
+	}
+	var head egg.ChainHead
+	if err := json.NewDecoder(resp.Body).Decode(&head); err != nil {
+		return nil, fmt.Errorf("decode notarized head: %w", err)
+	}
+	return &head, nil
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -16,6 +18,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ehrlich-b/wingthing/internal/auth"
 	"github.com/ehrlich-b/wingthing/internal/config"
 	"github.com/ehrlich-b/wingthing/internal/egg"
 	pb "github.com/ehrlich-b/wingthing/internal/egg/pb"
@@ -151,6 +154,13 @@ func eggRunCmd() *cobra.Command {
 				ToolNames:       toolNamesFlag,
 				ToolSocketPath:  toolSocketFlag,
 			}
+			// Audit chain heads are signed with a key derived from the wing
+			// identity; without one the chain is still written, unsigned
+			if auditFlag {
+				if priv, err := auth.LoadPrivateKey(cfg.Dir); err == nil {
+					rc.AuditKey, _ = auth.DeriveSigningKey(priv)
+				}
+			}
 
 			ctx, cancel := context.WithCancel(cmd.Context())
 			defer cancel()
@@ -670,6 +680,14 @@ func spawnEgg(cfg *config.Config, sessionID, agentName string, eggCfg *egg.EggCo
 	// effectiveHome/.anthropic_key (not per-session) so the settings.json
 	// path doesn't go stale when sessions end or race with each other.
 	setupAPIKeyHelper(agentName, envMap, effectiveHome)
+	var o spawnEggOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	// Register the tool MCP server in the agent's settings. The entry only
+	// names the wt binary; the socket comes from WT_TOOL_SOCKET at runtime,
+	// so one entry serves every tool session sharing this home.
+	setupMCPServer(agentName, effectiveHome, exe, dir, o.ToolSocketPath != "" && len(o.ToolNames) > 0)
 	for k, v := range envMap {
 		// Skip WT_ prefix — reserved for session identity injection
 		if strings.HasPrefix(k, "WT_") {
@@ -718,10 +736,6 @@ func spawnEgg(cfg *config.Config, sessionID, agentName string, eggCfg *egg.EggCo
 	if idleTimeout > 0 {
 		args = append(args, "--idle-timeout", idleTimeout.String())
 	}
-	var o spawnEggOpts
-	if len(opts) > 0 {
-		o = opts[0]
-	}
 	if o.ResumeSessionID != "" {
 		args = append(args, "--resume-session", o.ResumeSessionID)
 	}
@@ -845,3 +859,198 @@ func setupAPIKeyHelper(agentName string, envMap map[string]string, effectiveHome
 		os.WriteFile(settingsDst, append(data, '\n'), 0644)
 	}
 }
+
+// mcpRefGrace is how long a tool session's claim on the MCP entry survives
+// without its egg socket, covering the window between spawn and the egg
+// coming up.
+const mcpRefGrace = 30 * time.Second
+
+// setupMCPServer registers the wingthing MCP server entry in the agent's MCP
+// settings file under effectiveHome while any tool session sharing that home
+// is alive, and removes it once none are. Sessions claim the entry by egg dir
+// in a sidecar refs file (<file>.wt-mcp) whose flock also serializes the
+// read-modify-write of the settings file across concurrent spawns. Claims of
+// sessions whose egg socket is gone are dropped on the next spawn. Files are
+// only rewritten when the entry changes.
+func setupMCPServer(agentName, effectiveHome, exe, eggDir string, enable bool) {
+	profile := egg.Profile(agentName)
+	rel := profile.MCPFile
+	if rel == "" {
+		rel = profile.SettingsFile
+	}
+	if rel == "" || effectiveHome == "" {
+		return
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	path := filepath.Join(effectiveHome, rel)
+	refsPath := path + ".wt-mcp"
+	if !enable {
+		_, errPath := os.Stat(path)
+		_, errRefs := os.Stat(refsPath)
+		if errPath != nil && errRefs != nil {
+			return
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Printf("mcp: %v", err)
+		return
+	}
+	f, err := os.OpenFile(refsPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		log.Printf("mcp: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		log.Printf("mcp: lock %s: %v", refsPath, err)
+		return
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	refs := make(map[string]int64) // egg dir -> unix time claimed
+	if data, _ := io.ReadAll(f); len(data) > 0 {
+		json.Unmarshal(data, &refs)
+	}
+	for dir, claimed := range refs {
+		if _, err := os.Stat(filepath.Join(dir, "egg.sock")); err == nil {
+			continue
+		}
+		if time.Since(time.Unix(claimed, 0)) > mcpRefGrace {
+			delete(refs, dir)
+		}
+	}
+	if enable {
+		refs[eggDir] = time.Now().Unix()
+	} else {
+		delete(refs, eggDir)
+	}
+	if data, err := json.Marshal(refs); err == nil {
+		f.Truncate(0)
+		f.WriteAt(data, 0)
+	}
+
+	if strings.HasSuffix(path, ".toml") {
+		setupMCPServerTOML(path, exe, len(refs) > 0)
+		return
+	}
+	setupMCPServerJSON(path, exe, len(refs) > 0)
+}
+
+// setupMCPServerJSON edits the mcpServers map of a JSON settings file,
+// leaving the other keys untouched. Callers hold the refs lock.
+func setupMCPServerJSON(path, exe string, enable bool) {
+	settings := make(map[string]any)
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &settings) != nil {
+			return // not ours to clobber
+		}
+	} else if !enable {
+		return
+	}
+	servers, _ := settings["mcpServers"].(map[string]any)
+	if servers == nil {
+		servers = make(map[string]any)
+	}
+	want := map[string]any{"command": exe, "args": []any{"mcp-serve"}}
+	have, exists := servers[egg.MCPServerName].(map[string]any)
+	switch {
+	case enable && exists && fmt.Sprint(have) == fmt.Sprint(want):
+		return
+	case enable:
+		servers[egg.MCPServerName] = want
+	case !exists:
+		return
+	default:
+		delete(servers, egg.MCPServerName)
+	}
+	settings["mcpServers"] = servers
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		log.Printf("mcp: encode %s: %v", path, err)
+		return
+	}
+	if err := replaceAgentFile(path, append(data, '\n')); err != nil {
+		log.Printf("mcp: %v", err)
+	}
+}
+
+// replaceAgentFile swaps in new contents for an agent settings file via a
+// temp file and rename, so an agent reading it concurrently (or a crash
+// mid-write) never sees it half-written. An existing file keeps its mode.
+func replaceAgentFile(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".wt-*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// setupMCPServerTOML edits the [mcp_servers.wingthing] table of a Codex
+// config.toml, leaving the rest of the file untouched. Callers hold the refs
+// lock.
+func setupMCPServerTOML(path, exe string, enable bool) {
+	data, err := os.ReadFile(path)
+	if err != nil && (!enable || !os.IsNotExist(err)) {
+		return
+	}
+	header := "[mcp_servers." + egg.MCPServerName + "]"
+	var kept []string
+	var block []string
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			inBlock = trimmed == header
+		}
+		if inBlock {
+			block = append(block, line)
+		} else if line != "" || len(kept) > 0 {
+			kept = append(kept, line)
+		}
+	}
+	for len(block) > 0 && strings.TrimSpace(block[len(block)-1]) == "" {
+		block = block[:len(block)-1]
+	}
+	want := []string{header, "command = " + strconv.Quote(exe), `args = ["mcp-serve"]`}
+	if enable && strings.Join(block, "\n") == strings.Join(want, "\n") {
+		return
+	}
+	if !enable && len(block) == 0 {
+		return
+	}
+	for len(kept) > 0 && kept[len(kept)-1] == "" {
+		kept = kept[:len(kept)-1]
+	}
+	if enable {
+		if len(kept) > 0 {
+			kept = append(kept, "")
+		}
+		kept = append(kept, want...)
+	}
+	if err := replaceAgentFile(path, []byte(strings.Join(kept, "\n")+"\n")); err != nil {
+		log.Printf("mcp: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetupMCPServerJSON(t *testing.T) {
+	home := t.TempDir()
+	egg1 := filepath.Join(t.TempDir(), "s1")
+	path := filepath.Join(home, ".claude.json")
+	os.WriteFile(path, []byte(`{"theme":"dark","mcpServers":{"other":{"command":"x"}}}`), 0600)
+
+	setupMCPServer("claude", home, "/usr/local/bin/wt", egg1, true)
+	var settings map[string]any
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatal(err)
+	}
+	servers := settings["mcpServers"].(map[string]any)
+	entry, ok := servers["wingthing"].(map[string]any)
+	if !ok || entry["command"] != "/usr/local/bin/wt" || settings["theme"] != "dark" || servers["other"] == nil {
+		t.Fatalf("settings = %s", data)
+	}
+	// Replaced in place: same mode, no temp file left behind
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(home); len(entries) != 2 {
+		t.Errorf("leftover files: %v", entries) // settings + refs sidecar
+	}
+
+	// Unchanged entry: file is not rewritten
+	info, _ := os.Stat(path)
+	os.Chtimes(path, info.ModTime().Add(-time.Hour), info.ModTime().Add(-time.Hour))
+	before, _ := os.Stat(path)
+	setupMCPServer("claude", home, "/usr/local/bin/wt", egg1, true)
+	after, _ := os.Stat(path)
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("unchanged entry rewrote the file")
+	}
+
+	// No tools: entry removed, the rest kept
+	setupMCPServer("claude", home, "/usr/local/bin/wt", egg1, false)
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), "wingthing") || !strings.Contains(string(data), "other") {
+		t.Errorf("after disable: %s", data)
+	}
+}
+
+func TestSetupMCPServerTOML(t *testing.T) {
+	home := t.TempDir()
+	egg1 := filepath.Join(t.TempDir(), "s1")
+	path := filepath.Join(home, ".codex", "config.toml")
+	os.MkdirAll(filepath.Dir(path), 0700)
+	os.WriteFile(path, []byte("model = \"o3\"\n\n[mcp_servers.wingthing]\ncommand = \"/old/wt\"\nargs = [\"mcp-serve\"]\n\n[mcp_servers.other]\ncommand = \"x\"\n"), 0600)
+
+	setupMCPServer("codex", home, "/usr/local/bin/wt", egg1, true)
+	data, _ := os.ReadFile(path)
+	got := string(data)
+	if strings.Count(got, "[mcp_servers.wingthing]") != 1 || !strings.Contains(got, `command = "/usr/local/bin/wt"`) ||
+		strings.Contains(got, "/old/wt") || !strings.Contains(got, "[mcp_servers.other]") || !strings.HasPrefix(got, `model = "o3"`) {
+		t.Fatalf("config.toml =\n%s", got)
+	}
+
+	setupMCPServer("codex", home, "/usr/local/bin/wt", egg1, false)
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), "wingthing") || !strings.Contains(string(data), "[mcp_servers.other]") {
+		t.Errorf("after disable:\n%s", data)
+	}
+}
+
+func TestSetupMCPServerNoFileNoTools(t *testing.T) {
+	home := t.TempDir()
+	egg1 := filepath.Join(t.TempDir(), "s1")
+	setupMCPServer("claude", home, "/usr/local/bin/wt", egg1, false)
+	setupMCPServer("codex", home, "/usr/local/bin/wt", egg1, false)
+	entries, _ := os.ReadDir(home)
+	if len(entries) != 0 {
+		t.Errorf("created files without tools: %v", entries)
+	}
+}
+
+func TestSetupMCPServerSharedHome(t *testing.T) {
+	home := t.TempDir()
+	eggs := t.TempDir()
+	live := filepath.Join(eggs, "live")
+	os.MkdirAll(live, 0700)
+	os.WriteFile(filepath.Join(live, "egg.sock"), nil, 0600)
+	path := filepath.Join(home, ".claude.json")
+	has := func() bool {
+		data, _ := os.ReadFile(path)
+		return strings.Contains(string(data), "wingthing")
+	}
+
+	setupMCPServer("claude", home, "/usr/local/bin/wt", live, true)
+	// A session without tools in the same home must not pull the entry out
+	// from under a live tool session.
+	setupMCPServer("claude", home, "/usr/local/bin/wt", filepath.Join(eggs, "plain"), false)
+	if !has() {
+		t.Fatal("no-tools session removed a live session's entry")
+	}
+
+	// Concurrent tool spawns all end up registered; the file stays valid.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			setupMCPServer("claude", home, "/usr/local/bin/wt", filepath.Join(eggs, fmt.Sprint("c", i)), true)
+		}(i)
+	}
+	wg.Wait()
+	var refs map[string]int64
+	data, _ := os.ReadFile(path + ".wt-mcp")
+	if err := json.Unmarshal(data, &refs); err != nil || len(refs) != 9 {
+		t.Fatalf("refs = %s (%v)", data, err)
+	}
+
+	// Once the live egg is gone and the others are past the grace window,
+	// the next no-tools spawn drops the entry.
+	os.Remove(filepath.Join(live, "egg.sock"))
+	for dir := range refs {
+		refs[dir] = time.Now().Add(-2 * mcpRefGrace).Unix()
+	}
+	data, _ = json.Marshal(refs)
+	os.WriteFile(path+".wt-mcp", data, 0600)
+	setupMCPServer("claude", home, "/usr/local/bin/wt", filepath.Join(eggs, "plain"), false)
+	if has() {
+		t.Error("entry kept after every tool session ended")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ehrlich-b/wingthing/internal/auth"
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/ws"
+	"github.com/spf13/cobra"
+)
+
+func fileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "file",
+		Short: "Copy files to and from a remote wing",
+	}
+	cmd.AddCommand(fileGetCmd())
+	cmd.AddCommand(filePutCmd())
+	return cmd
+}
+
+// dialWing opens an encrypted tunnel connection to a wing through the relay.
+func dialWing(ctx context.Context, wingID string) (*ws.TunnelConn, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	ts := auth.NewTokenStore(cfg.Dir)
+	tok, err := ts.Load()
+	if err != nil || !ts.IsValid(tok) {
+		return nil, fmt.Errorf("not logged in — run: wt login")
+	}
+	privKey, err := auth.LoadPrivateKey(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("load key: %w", err)
+	}
+	tc := &ws.TunnelClient{
+		RelayURL:    resolveRelayHTTPURL(cfg),
+		DeviceToken: tok.Token,
+		PrivKey:     privKey,
+	}
+	wing, err := tc.DiscoverWing(ctx, wingID)
+	if err != nil {
+		return nil, fmt.Errorf("discover wing: %w", err)
+	}
+	return tc.Dial(ctx, wingID, wing.PublicKey)
+}
+
+func fileGetCmd() *cobra.Command {
+	var wingFlag string
+
+	cmd := &cobra.Command{
+		Use:   "get <remote-path> [local-path]",
+		Short: "Download a file from a wing",
+		Long: `Downloads a file from a wing over the encrypted tunnel. The remote path
+must be absolute (or start with ~) and inside the paths the wing shares with
+you. The local path defaults to the file's name in the current directory;
+use - for stdout.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if wingFlag == "" {
+				return fmt.Errorf("--wing is required")
+			}
+			local := filepath.Base(args[0])
+			if len(args) == 2 {
+				local = args[1]
+			}
+			if fi, err := os.Stat(local); err == nil && fi.IsDir() {
+				local = filepath.Join(local, filepath.Base(args[0]))
+			}
+
+			conn, err := dialWing(cmd.Context(), wingFlag)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			var out io.Writer = os.Stdout
+			var tmp *os.File
+			if local != "-" {
+				tmp, err = os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".wt-*")
+				if err != nil {
+					return err
+				}
+				defer os.Remove(tmp.Name())
+				defer tmp.Close()
+				out = tmp
+			}
+
+			var got int64
+			var info *ws.FileInfo
+			err = conn.Stream(cmd.Context(), map[string]string{"type": "file.download", "path": args[0]}, func(chunk []byte) error {
+				var c struct {
+					Data  string       `json:"data"`
+					Done  bool         `json:"done"`
+					Error string       `json:"error"`
+					File  *ws.FileInfo `json:"file"`
+				}
+				if err := json.Unmarshal(chunk, &c); err != nil {
+					return fmt.Errorf("bad chunk: %w", err)
+				}
+				if c.Error != "" {
+					return fmt.Errorf("wing error: %s", c.Error)
+				}
+				if c.Done {
+					info = c.File
+					return nil
+				}
+				data, err := base64.StdEncoding.DecodeString(c.Data)
+				if err != nil {
+					return fmt.Errorf("decode chunk: %w", err)
+				}
+				got += int64(len(data))
+				_, err = out.Write(data)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if info == nil || info.Size != got {
+				return fmt.Errorf("download incomplete (%s received)", humanBytes(got))
+			}
+			if tmp == nil {
+				return nil
+			}
+			if err := tmp.Close(); err != nil {
+				return err
+			}
+			os.Chmod(tmp.Name(), os.FileMode(info.Mode))
+			if err := os.Rename(tmp.Name(), local); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%s -> %s (%s)\n", args[0], local, humanBytes(got))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&wingFlag, "wing", "", "wing ID to download from")
+	return cmd
+}
+
+func filePutCmd() *cobra.Command {
+	var wingFlag string
+
+	cmd := &cobra.Command{
+		Use:   "put <local-path> <remote-path>",
+		Short: "Upload a file to a wing",
+		Long: `Uploads a file to a wing over the encrypted tunnel. The remote path must
+be absolute (or start with ~) and inside the paths the wing shares with you;
+an existing file is replaced atomically and keeps its permissions. On an org
+wing, uploads need the owner or admin role.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if wingFlag == "" {
+				return fmt.Errorf("--wing is required")
+			}
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return fmt.Errorf("%s is not a regular file", args[0])
+			}
+			if fi.Size() > ws.FileTransferLimit {
+				return fmt.Errorf("%s exceeds %s", args[0], humanBytes(ws.FileTransferLimit))
+			}
+
+			conn, err := dialWing(cmd.Context(), wingFlag)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			id := make([]byte, 16)
+			rand.Read(id)
+			uploadID := hex.EncodeToString(id)
+			buf := make([]byte, ws.FileUploadChunk)
+			var sent int64
+			for {
+				n, err := io.ReadFull(f, buf)
+				if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+					return err
+				}
+				done := n < len(buf) || sent+int64(n) >= fi.Size()
+				var resp struct {
+					Received int64 `json:"received"`
+				}
+				req := map[string]any{
+					"type":      "file.upload",
+					"path":      args[1],
+					"upload_id": uploadID,
+					"offset":    sent,
+					"data":      base64.StdEncoding.EncodeToString(buf[:n]),
+					"done":      done,
+				}
+				if err := conn.Request(cmd.Context(), req, &resp); err != nil {
+					return err
+				}
+				sent = resp.Received
+				if done {
+					break
+				}
+			}
+			fmt.Fprintf(os.Stderr, "%s -> %s (%s)\n", args[0], args[1], humanBytes(sent))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&wingFlag, "wing", "", "wing ID to upload to")
+	return cmd
+}
@@ -76,6 +76,11 @@ func main() {
 		updateCmd(),
 		toolCallCmd(),
 		toolListCmd(),
+		mcpServeCmd(),
+		auditCmd(),
+		toolCmd(),
+		fileCmd(),
+		tokenCmd(),
 	)
 
 	if err := root.Execute(); err != nil {
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/ws"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// projectDebounce batches the burst of events from a clone or mkdir -p
+	projectDebounce = time.Second
+	// projectRescanInterval rescans everything as a backstop for missed
+	// events, and is the only update path when fsnotify is unavailable
+	projectRescanInterval = 5 * time.Minute
+	// maxProjectWatches keeps a huge tree from exhausting inotify watches
+	maxProjectWatches = 4096
+)
+
+// projectRoot is a directory scanned for projects and how deep.
+type projectRoot struct {
+	Dir   string
+	Depth int
+}
+
+// projectIndexer keeps the wing's project list current. It watches the
+// directories discoverProjects looks at and rescans only the root under
+// which something was created, removed or renamed.
+type projectIndexer struct {
+	onChange func([]ws.WingProject) // called with the merged list when it changes
+
+	mu      sync.Mutex
+	roots   []projectRoot
+	found   map[string][]ws.WingProject // root dir → its projects
+	watched map[string]string           // watched dir → root that added it
+	watcher *fsnotify.Watcher
+	full    bool // hit maxProjectWatches; logged once
+}
+
+func newProjectIndexer(roots []projectRoot, onChange func([]ws.WingProject)) *projectIndexer {
+	ix := &projectIndexer{
+		onChange: onChange,
+		roots:    roots,
+		found:    make(map[string][]ws.WingProject),
+		watched:  make(map[string]string),
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("projects: fsnotify unavailable, rescanning every %s: %v", projectRescanInterval, err)
+	} else {
+		ix.watcher = w
+	}
+	for _, r := range roots {
+		ix.found[r.Dir] = discoverProjects(r.Dir, r.Depth)
+		ix.watchRoot(r)
+	}
+	return ix
+}
+
+// Projects returns the merged list: roots in order, first occurrence wins.
+func (ix *projectIndexer) Projects() []ws.WingProject {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.merged()
+}
+
+func (ix *projectIndexer) merged() []ws.WingProject {
+	seen := make(map[string]bool)
+	var out []ws.WingProject
+	for _, r := range ix.roots {
+		for _, p := range ix.found[r.Dir] {
+			if !seen[p.Path] {
+				seen[p.Path] = true
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// SetRoots replaces the scanned roots (paths changed in wing.yaml) and
+// rescans them all.
+func (ix *projectIndexer) SetRoots(roots []projectRoot) {
+	ix.mu.Lock()
+	before := ix.merged()
+	ix.roots = roots
+	for dir := range ix.watched {
+		ix.watcher.Remove(dir)
+	}
+	ix.watched = make(map[string]string)
+	ix.found = make(map[string][]ws.WingProject)
+	ix.full = false
+	for _, r := range roots {
+		ix.found[r.Dir] = discoverProjects(r.Dir, r.Depth)
+		ix.watchRoot(r)
+	}
+	after := ix.merged()
+	ix.mu.Unlock()
+	if !sameProjects(before, after) {
+		ix.onChange(after)
+	}
+}
+
+// Run processes filesystem events until ctx is done.
+func (ix *projectIndexer) Run(ctx context.Context) {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if ix.watcher != nil {
+		defer ix.watcher.Close()
+		events = ix.watcher.Events
+		errs = ix.watcher.Errors
+	}
+	rescan := time.NewTicker(projectRescanInterval)
+	defer rescan.Stop()
+	debounce := time.NewTimer(projectDebounce)
+	debounce.Stop()
+	dirty := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			ix.mu.Lock()
+			if !ix.relevant(ev) {
+				ix.mu.Unlock()
+				continue
+			}
+			// Every root above the change (roots can nest, e.g. the
+			// wing's cwd inside a configured path)
+			for _, r := range ix.roots {
+				if isUnderPaths(ev.Name, []string{r.Dir}) {
+					dirty[r.Dir] = true
+				}
+			}
+			ix.mu.Unlock()
+			if len(dirty) > 0 {
+				debounce.Reset(projectDebounce)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Printf("projects: watch error: %v", err)
+		case <-debounce.C:
+			ix.rescan(dirty)
+			dirty = make(map[string]bool)
+		case <-rescan.C:
+			all := make(map[string]bool)
+			ix.mu.Lock()
+			for _, r := range ix.roots {
+				all[r.Dir] = true
+			}
+			ix.mu.Unlock()
+			ix.rescan(all)
+		}
+	}
+}
+
+// relevant reports whether an event can change what's discovered: a
+// directory, .git or egg.yaml appearing or going away. Agents writing files
+// inside projects don't trigger rescans. Caller holds mu.
+func (ix *projectIndexer) relevant(ev fsnotify.Event) bool {
+	if ev.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return false
+	}
+	if base := filepath.Base(ev.Name); base == ".git" || base == "egg.yaml" {
+		return true
+	}
+	if ev.Op&fsnotify.Create != 0 {
+		info, err := os.Stat(ev.Name)
+		return err == nil && info.IsDir()
+	}
+	_, watched := ix.watched[ev.Name]
+	return watched
+}
+
+// rescan re-discovers projects under the given roots, refreshes their
+// watches, and reports the merged list if a project appeared or went away.
+func (ix *projectIndexer) rescan(dirs map[string]bool) {
+	if len(dirs) == 0 {
+		return
+	}
+	ix.mu.Lock()
+	before := ix.merged()
+	for _, r := range ix.roots {
+		if !dirs[r.Dir] {
+			continue
+		}
+		ix.found[r.Dir] = discoverProjects(r.Dir, r.Depth)
+		ix.watchRoot(r)
+	}
+	after := ix.merged()
+	ix.mu.Unlock()
+	if !sameProjects(before, after) {
+		log.Printf("projects: %d found (was %d)", len(after), len(before))
+		ix.onChange(after)
+	}
+}
+
+// watchRoot syncs the watch set for one root with projectWatchDirs. Caller
+// holds mu.
+func (ix *projectIndexer) watchRoot(r projectRoot) {
+	if ix.watcher == nil {
+		return
+	}
+	want := make(map[string]bool)
+	for _, dir := range projectWatchDirs(r.Dir, r.Depth) {
+		want[dir] = true
+	}
+	for dir, root := range ix.watched {
+		if root == r.Dir && !want[dir] {
+			ix.watcher.Remove(dir)
+			delete(ix.watched, dir)
+		}
+	}
+	for dir := range want {
+		if _, ok := ix.watched[dir]; ok {
+			continue
+		}
+		if len(ix.watched) >= maxProjectWatches {
+			if !ix.full {
+				ix.full = true
+				log.Printf("projects: watching %d directories, the rest is rescanned every %s", maxProjectWatches, projectRescanInterval)
+			}
+			return
+		}
+		if err := ix.watcher.Add(dir); err == nil {
+			ix.watched[dir] = r.Dir
+		}
+	}
+}
+
+// projectWatchDirs lists the directories whose entries decide what
+// discoverProjects(dir, maxDepth) finds: every directory it reads, every
+// child it checks for .git or egg.yaml, and the subdirectories of git repos
+// (where role dirs with egg.yaml live).
+func projectWatchDirs(dir string, maxDepth int) []string {
+	out := []string{dir}
+	if isGitRepo(dir) {
+		return append(out, childDirs(dir)...)
+	}
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+		for _, child := range childDirs(dir) {
+			out = append(out, child)
+			if isGitRepo(child) {
+				out = append(out, childDirs(child)...)
+			} else if depth+1 <= maxDepth {
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(dir, 0)
+	return out
+}
+
+func isGitRepo(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil && info.IsDir()
+}
+
+// childDirs returns dir's non-hidden subdirectories.
+func childDirs(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			out = append(out, filepath.Join(dir, e.Name()))
+		}
+	}
+	return out
+}
+
+// sameProjects reports whether two lists have the same projects, ignoring
+// order and mtimes (which change with every edit and aren't worth a push).
+func sameProjects(a, b []ws.WingProject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	key := func(p ws.WingProject) string { return p.Path + "\x00" + p.Name }
+	ka := make([]string, len(a))
+	kb := make([]string, len(b))
+	for i := range a {
+		ka[i], kb[i] = key(a[i]), key(b[i])
+	}
+	slices.Sort(ka)
+	slices.Sort(kb)
+	return slices.Equal(ka, kb)
+}
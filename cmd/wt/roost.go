@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -30,6 +31,8 @@ func roostCmd() *cobra.Command {
 	cmd.AddCommand(roostStartCmd())
 	cmd.AddCommand(roostStopCmd())
 	cmd.AddCommand(roostStatusCmd())
+	cmd.AddCommand(roostMigrateCmd())
+	cmd.AddCommand(roostAdminCmd())
 
 	return cmd
 }
@@ -156,7 +159,7 @@ func runRoostForeground(addrFlag string, devFlag bool, labelsFlag, pathsFlag, eg
 
 	// --- Relay setup (local mode forced) ---
 
-	store, err := relay.OpenRelay(cfg.RelayDBPath())
+	store, err := relay.OpenRelay(cfg.RelayDSN())
 	if err != nil {
 		return fmt.Errorf("open relay db: %w", err)
 	}
@@ -176,10 +179,16 @@ func runRoostForeground(addrFlag string, devFlag bool, labelsFlag, pathsFlag, eg
 		}
 	}
 
+	ssoCfg, err := relay.LoadSSOConfig(os.Getenv("WT_SSO_CONFIG"))
+	if err != nil {
+		return err
+	}
+
 	srvCfg := relay.ServerConfig{
 		BaseURL:            envOr("WT_BASE_URL", "http://localhost:8080"),
 		AppHost:            os.Getenv("WT_APP_HOST"),
 		WSHost:             os.Getenv("WT_WS_HOST"),
+		PreviewHost:        os.Getenv("WT_PREVIEW_HOST"),
 		JWTKey:             jwtKey,
 		GitHubClientID:     os.Getenv("GITHUB_CLIENT_ID"),
 		GitHubClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
@@ -191,12 +200,21 @@ func runRoostForeground(addrFlag string, devFlag bool, labelsFlag, pathsFlag, eg
 		SMTPPass:           os.Getenv("SMTP_PASS"),
 		SMTPFrom:           os.Getenv("SMTP_FROM"),
 		HeroVideo:          os.Getenv("WT_HERO_VIDEO"),
+		SSO:                ssoCfg,
+		AdminEmails:        envList("WT_ADMIN_EMAILS"),
+		MetricsToken:       os.Getenv("WT_METRICS_TOKEN"),
 	}
 
 	srv := relay.NewServer(store, srvCfg)
 	if err := srv.InitJWTKey(); err != nil {
 		return fmt.Errorf("init jwt key: %w", err)
 	}
+	if err := store.PromoteAdminsByEmail(srvCfg.AdminEmails); err != nil {
+		return fmt.Errorf("promote admins: %w", err)
+	}
+	if err := srv.RevokeSSOBypasses(); err != nil {
+		return fmt.Errorf("revoke sessions bypassing sso: %w", err)
+	}
 	srv.RateLimit = relay.NewRateLimiter(5, 20)
 
 	// Local mode: direct DB access for bandwidth
@@ -218,7 +236,7 @@ func runRoostForeground(addrFlag string, devFlag bool, labelsFlag, pathsFlag, eg
 	}
 
 	// Auth mode detection: same pattern as serve.go
-	hasAuth := srvCfg.GoogleClientID != "" || srvCfg.GitHubClientID != "" || srvCfg.SMTPHost != ""
+	hasAuth := srvCfg.GoogleClientID != "" || srvCfg.GitHubClientID != "" || srvCfg.SMTPHost != "" || srvCfg.SSO != nil
 
 	var wingToken string
 	if !hasAuth {
@@ -229,6 +247,7 @@ func runRoostForeground(addrFlag string, devFlag bool, labelsFlag, pathsFlag, eg
 		}
 		srv.LocalMode = true
 		srv.SetLocalUser(user)
+		store.SetUserAdmin(user.ID, true)
 		wingToken = token
 
 		// Grant pro tier — self-hosted has no bandwidth cap
@@ -247,6 +266,8 @@ func runRoostForeground(addrFlag string, devFlag bool, labelsFlag, pathsFlag, eg
 			return fmt.Errorf("setup service user: %w", err)
 		}
 		wingToken = token
+		// The box's own token administers the relay: `wt roost admin` uses it
+		store.SetUserAdmin(user.ID, true)
 
 		// Grant pro to service user
 		if !store.IsUserPro(user.ID) {
@@ -281,6 +302,7 @@ func runRoostForeground(addrFlag string, devFlag bool, labelsFlag, pathsFlag, eg
 	// Start bandwidth sync
 	srv.Bandwidth.SeedFromDB()
 	srv.Bandwidth.StartSync(ctx, 10*time.Minute)
+	srv.StartWebhooks(ctx, 15*time.Second)
 
 	// --- Start relay ---
 
@@ -362,3 +384,77 @@ func roostStatusCmd() *cobra.Command {
 		},
 	}
 }
+
+func roostMigrateCmd() *cobra.Command {
+	var fromFlag, toFlag string
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Copy the roost database to another backend",
+		Long: "Copies every relay table from one database to another, e.g. from the local SQLite file to PostgreSQL.\n" +
+			"'sqlite' means the roost's own SQLite file and 'postgres' means $WT_DATABASE_URL; anything else is a path or postgres:// URL.\n" +
+			"The destination is migrated first and must be empty. Stop the roost before copying.",
+		Example: "  wt roost migrate --from sqlite --to postgres\n  wt roost migrate --from ~/.wingthing/roost.db --to postgres://wt@db/wingthing",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			resolve := func(v string) (string, error) {
+				switch v {
+				case "sqlite":
+					return cfg.RelayDBPath(), nil
+				case "postgres":
+					if dsn := os.Getenv("WT_DATABASE_URL"); dsn != "" {
+						return dsn, nil
+					}
+					return "", fmt.Errorf("--to postgres needs WT_DATABASE_URL")
+				}
+				return v, nil
+			}
+			from, err := resolve(fromFlag)
+			if err != nil {
+				return err
+			}
+			to, err := resolve(toFlag)
+			if err != nil {
+				return err
+			}
+			if from == to {
+				return fmt.Errorf("source and destination are the same database")
+			}
+
+			src, err := relay.OpenRelay(from)
+			if err != nil {
+				return fmt.Errorf("open source: %w", err)
+			}
+			defer src.Close()
+			dst, err := relay.OpenRelay(to)
+			if err != nil {
+				return fmt.Errorf("open destination: %w", err)
+			}
+			defer dst.Close()
+
+			counts, err := relay.CopyRelayData(src, dst)
+			if err != nil {
+				return err
+			}
+			tables := make([]string, 0, len(counts))
+			total := 0
+			for t, n := range counts {
+				tables = append(tables, t)
+				total += n
+			}
+			sort.Strings(tables)
+			for _, t := range tables {
+				if counts[t] > 0 {
+					fmt.Printf("  %-22s %d\n", t, counts[t])
+				}
+			}
+			fmt.Printf("copied %d rows from %s to %s\n", total, src.Dialect(), dst.Dialect())
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&fromFlag, "from", "sqlite", "source database: sqlite, postgres, a SQLite path or a postgres:// URL")
+	cmd.Flags().StringVar(&toFlag, "to", "postgres", "destination database, same forms as --from")
+	return cmd
+}
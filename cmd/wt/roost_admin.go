@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// adminUser mirrors the relay's /api/v1/admin/users entries.
+type adminUser struct {
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	Email       *string   `json:"email"`
+	Provider    string    `json:"provider"`
+	Tier        string    `json:"tier"`
+	IsAdmin     bool      `json:"is_admin"`
+	Suspended   bool      `json:"suspended"`
+	CreatedAt   time.Time `json:"created_at"`
+	WingsOnline int       `json:"wings_online"`
+}
+
+func roostAdminCmd() *cobra.Command {
+	var urlFlag string
+	cmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Administer the relay: users, orgs, wings, usage and audit log",
+		Long: `Admin commands for self-hosted relays. They need a login that is a relay
+admin: the roost's own token on the roost box, a user listed in
+WT_ADMIN_EMAILS, or anyone promoted with 'wt roost admin users grant-admin'.
+
+Commands talk to the local roost if one is running, otherwise to the relay
+you're logged in to. --url overrides both.`,
+	}
+	cmd.PersistentFlags().StringVar(&urlFlag, "url", "", "relay URL (default: running roost, else your relay)")
+
+	api := func(method, path string, body, out any) error {
+		return relayAPI(adminRelayURL(urlFlag), method, "/api/v1/admin"+path, body, out)
+	}
+	cmd.AddCommand(roostAdminUsersCmd(api))
+	cmd.AddCommand(roostAdminOrgsCmd(api))
+	cmd.AddCommand(roostAdminWingsCmd(api))
+	cmd.AddCommand(roostAdminUsageCmd(api))
+	cmd.AddCommand(roostAdminAuditCmd(api))
+	cmd.AddCommand(roostAdminKickCmd(api))
+	return cmd
+}
+
+type adminAPIFunc func(method, path string, body, out any) error
+
+// adminRelayURL picks the relay to administer: --url, then a running roost
+// daemon on this machine, then the configured relay ("" = configured).
+func adminRelayURL(flag string) string {
+	if flag != "" {
+		return strings.TrimRight(flag, "/")
+	}
+	if _, err := readPidFrom(roostPidPath()); err != nil {
+		return ""
+	}
+	addr := ":8080"
+	if data, err := os.ReadFile(roostArgsPath()); err == nil {
+		args := strings.Split(string(data), "\n")
+		for i, a := range args {
+			if a == "--addr" && i+1 < len(args) {
+				addr = args[i+1]
+			}
+		}
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
+
+// resolveAdminUser accepts a user ID or an email address.
+func resolveAdminUser(api adminAPIFunc, arg string) (string, error) {
+	if !strings.Contains(arg, "@") {
+		return arg, nil
+	}
+	var users []adminUser
+	if err := api("GET", "/users?q="+url.QueryEscape(arg), nil, &users); err != nil {
+		return "", err
+	}
+	for _, u := range users {
+		if u.Email != nil && strings.EqualFold(*u.Email, arg) {
+			return u.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no user with email %s", arg)
+}
+
+func printAdminUsers(users []adminUser) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tEMAIL\tTIER\tWINGS\tSTATUS\tCREATED")
+	for _, u := range users {
+		email := "-"
+		if u.Email != nil {
+			email = *u.Email
+		}
+		var status []string
+		if u.IsAdmin {
+			status = append(status, "admin")
+		}
+		if u.Suspended {
+			status = append(status, "suspended")
+		}
+		if len(status) == 0 {
+			status = append(status, "-")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", u.ID, u.DisplayName, email, u.Tier, u.WingsOnline,
+			strings.Join(status, ","), u.CreatedAt.Local().Format("2006-01-02"))
+	}
+	w.Flush()
+}
+
+func roostAdminUsersCmd(api adminAPIFunc) *cobra.Command {
+	var queryFlag string
+	var limitFlag, offsetFlag int
+	cmd := &cobra.Command{
+		Use:   "users",
+		Short: "List users, or suspend them, change their tier or admin role",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if queryFlag != "" {
+				q.Set("q", queryFlag)
+			}
+			q.Set("limit", strconv.Itoa(limitFlag))
+			q.Set("offset", strconv.Itoa(offsetFlag))
+			var users []adminUser
+			if err := api("GET", "/users?"+q.Encode(), nil, &users); err != nil {
+				return err
+			}
+			if len(users) == 0 {
+				fmt.Println("no users")
+				return nil
+			}
+			printAdminUsers(users)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&queryFlag, "query", "q", "", "filter by name, email or ID")
+	cmd.Flags().IntVar(&limitFlag, "limit", 100, "max users to list")
+	cmd.Flags().IntVar(&offsetFlag, "offset", 0, "skip this many users")
+
+	update := func(use, short string, nargs int, body func(args []string) (map[string]any, error)) *cobra.Command {
+		return &cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  cobra.ExactArgs(nargs),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				userID, err := resolveAdminUser(api, args[0])
+				if err != nil {
+					return err
+				}
+				b, err := body(args)
+				if err != nil {
+					return err
+				}
+				var u adminUser
+				if err := api("PATCH", "/users/"+userID, b, &u); err != nil {
+					return err
+				}
+				printAdminUsers([]adminUser{u})
+				return nil
+			},
+		}
+	}
+	cmd.AddCommand(update("suspend <user>", "Suspend a user: ends their sessions and disconnects their wings", 1,
+		func([]string) (map[string]any, error) { return map[string]any{"suspended": true}, nil }))
+	cmd.AddCommand(update("unsuspend <user>", "Reinstate a suspended user", 1,
+		func([]string) (map[string]any, error) { return map[string]any{"suspended": false}, nil }))
+	cmd.AddCommand(update("tier <user> <free|pro>", "Grant or remove a user's personal pro tier", 2,
+		func(args []string) (map[string]any, error) {
+			if args[1] != "free" && args[1] != "pro" {
+				return nil, fmt.Errorf("tier must be free or pro")
+			}
+			return map[string]any{"tier": args[1]}, nil
+		}))
+	cmd.AddCommand(update("grant-admin <user>", "Make a user a relay admin", 1,
+		func([]string) (map[string]any, error) { return map[string]any{"admin": true}, nil }))
+	cmd.AddCommand(update("revoke-admin <user>", "Remove a user's relay admin role", 1,
+		func([]string) (map[string]any, error) { return map[string]any{"admin": false}, nil }))
+	return cmd
+}
+
+func roostAdminOrgsCmd(api adminAPIFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "orgs",
+		Short: "List every org on the relay",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var orgs []struct {
+				ID          string  `json:"id"`
+				Name        string  `json:"name"`
+				Slug        string  `json:"slug"`
+				MaxSeats    int     `json:"max_seats"`
+				MemberCount int     `json:"member_count"`
+				OwnerEmail  *string `json:"owner_email"`
+				OwnerUserID string  `json:"owner_user_id"`
+			}
+			if err := api("GET", "/orgs", nil, &orgs); err != nil {
+				return err
+			}
+			if len(orgs) == 0 {
+				fmt.Println("no orgs")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSLUG\tNAME\tMEMBERS\tSEATS\tOWNER")
+			for _, o := range orgs {
+				owner := o.OwnerUserID
+				if o.OwnerEmail != nil {
+					owner = *o.OwnerEmail
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", o.ID, o.Slug, o.Name, o.MemberCount, o.MaxSeats, owner)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+}
+
+func roostAdminWingsCmd(api adminAPIFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "wings",
+		Short: "List every connected wing",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var wings []struct {
+				WingID    string    `json:"wing_id"`
+				UserID    string    `json:"user_id"`
+				OrgID     string    `json:"org_id"`
+				MachineID string    `json:"machine_id"`
+				Locked    bool      `json:"locked"`
+				LastSeen  time.Time `json:"last_seen"`
+			}
+			if err := api("GET", "/wings", nil, &wings); err != nil {
+				return err
+			}
+			if len(wings) == 0 {
+				fmt.Println("no wings connected")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "WING\tUSER\tORG\tNODE\tLOCKED\tLAST SEEN")
+			for _, wg := range wings {
+				org, node := "-", "-"
+				if wg.OrgID != "" {
+					org = wg.OrgID
+				}
+				if wg.MachineID != "" {
+					node = wg.MachineID
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%s ago\n", wg.WingID, wg.UserID, org, node, wg.Locked,
+					humanDuration(time.Since(wg.LastSeen)))
+			}
+			w.Flush()
+			return nil
+		},
+	}
+}
+
+func roostAdminUsageCmd(api adminAPIFunc) *cobra.Command {
+	var monthFlag string
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show bandwidth by user for a month, heaviest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/usage"
+			if monthFlag != "" {
+				path += "?month=" + url.QueryEscape(monthFlag)
+			}
+			var usage []struct {
+				UserID     string  `json:"user_id"`
+				Email      *string `json:"email"`
+				Month      string  `json:"month"`
+				Tier       string  `json:"tier"`
+				UsageBytes int64   `json:"usage_bytes"`
+				CapBytes   *int64  `json:"cap_bytes"`
+			}
+			if err := api("GET", path, nil, &usage); err != nil {
+				return err
+			}
+			if len(usage) == 0 {
+				fmt.Println("no usage")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USER\tEMAIL\tMONTH\tTIER\tUSED\tCAP")
+			for _, u := range usage {
+				email, limit := "-", "none"
+				if u.Email != nil {
+					email = *u.Email
+				}
+				if u.CapBytes != nil {
+					limit = humanBytes(*u.CapBytes)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", u.UserID, email, u.Month, u.Tier, humanBytes(u.UsageBytes), limit)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&monthFlag, "month", "", "month as YYYY-MM (default: this month)")
+	return cmd
+}
+
+func roostAdminAuditCmd(api adminAPIFunc) *cobra.Command {
+	var userFlag, eventFlag string
+	var beforeFlag int64
+	var limitFlag int
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show the relay audit log, newest first",
+		Long:  "Shows audit log entries, newest first. Page back with --before <id of the last entry shown>.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if userFlag != "" {
+				userID, err := resolveAdminUser(api, userFlag)
+				if err != nil {
+					return err
+				}
+				q.Set("user_id", userID)
+			}
+			if eventFlag != "" {
+				q.Set("event", eventFlag)
+			}
+			if beforeFlag > 0 {
+				q.Set("before", strconv.FormatInt(beforeFlag, 10))
+			}
+			q.Set("limit", strconv.Itoa(limitFlag))
+			var entries []struct {
+				ID        int64     `json:"id"`
+				Timestamp time.Time `json:"timestamp"`
+				UserID    *string   `json:"user_id"`
+				Event     string    `json:"event"`
+				Detail    *string   `json:"detail"`
+			}
+			if err := api("GET", "/audit?"+q.Encode(), nil, &entries); err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				fmt.Println("no audit entries")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTIME\tUSER\tEVENT\tDETAIL")
+			for _, e := range entries {
+				user, detail := "-", ""
+				if e.UserID != nil {
+					user = *e.UserID
+				}
+				if e.Detail != nil {
+					detail = *e.Detail
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", e.ID, e.Timestamp.Local().Format("2006-01-02 15:04:05"), user, e.Event, detail)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&userFlag, "user", "", "only this user (ID or email)")
+	cmd.Flags().StringVar(&eventFlag, "event", "", "only these events, comma-separated, e.g. login,admin_suspend")
+	cmd.Flags().Int64Var(&beforeFlag, "before", 0, "only entries older than this ID")
+	cmd.Flags().IntVar(&limitFlag, "limit", 50, "max entries to show")
+	return cmd
+}
+
+func roostAdminKickCmd(api adminAPIFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "kick <wing-id>",
+		Short: "Force-disconnect a wing",
+		Long:  "Closes a wing's connection to the relay. The wing reconnects on its own unless its owner is suspended.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := api("DELETE", "/wings/"+url.PathEscape(args[0]), nil, nil); err != nil {
+				return err
+			}
+			fmt.Printf("wing %s disconnected\n", args[0])
+			return nil
+		},
+	}
+}
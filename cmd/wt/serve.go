@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -23,6 +25,17 @@ func envOr(key, fallback string) string {
 	return fallback
 }
 
+// envList splits a comma-separated env var, dropping empty entries.
+func envList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func serveCmd() *cobra.Command {
 	var addrFlag string
 	var devFlag bool
@@ -54,9 +67,21 @@ func serveCmd() *cobra.Command {
 				fmt.Printf("auto-detected node role: %s\n", nodeRole)
 			}
 
-			// Auto-derive login node address from Fly internal DNS.
-			if nodeRole == "edge" && loginAddr == "" && flyApp != "" {
-				loginAddr = "http://login.process." + flyApp + ".internal:8080"
+			// Cluster nodes authenticate to each other by machine ID
+			internalAddr := envOr("WT_INTERNAL_ADDR", ":8443")
+			if nodeRole != "" && flyMachineID == "" {
+				flyMachineID, _ = os.Hostname()
+				if flyMachineID == "" {
+					return fmt.Errorf("FLY_MACHINE_ID is required for cluster nodes")
+				}
+			}
+
+			// Auto-derive login node address from Fly internal DNS. It
+			// resolves to every login replica; login replicas use it to
+			// find their peers. Node-to-node calls use the mTLS listener.
+			if nodeRole != "" && loginAddr == "" && flyApp != "" {
+				_, port, _ := net.SplitHostPort(internalAddr)
+				loginAddr = "https://login.process." + flyApp + ".internal:" + port
 				fmt.Printf("auto-derived login addr: %s\n", loginAddr)
 			}
 
@@ -65,7 +90,7 @@ func serveCmd() *cobra.Command {
 			// Edge nodes skip SQLite and DB-dependent init
 			var store *relay.RelayStore
 			if !isEdge {
-				store, err = relay.OpenRelay(cfg.RelayDBPath())
+				store, err = relay.OpenRelay(cfg.RelayDSN())
 				if err != nil {
 					return fmt.Errorf("open relay db: %w", err)
 				}
@@ -81,7 +106,11 @@ func serveCmd() *cobra.Command {
 			githubID := os.Getenv("GITHUB_CLIENT_ID")
 			googleID := os.Getenv("GOOGLE_CLIENT_ID")
 			smtpHost := os.Getenv("SMTP_HOST")
-			if !localFlag && !isEdge && githubID == "" && googleID == "" && smtpHost == "" {
+			ssoCfg, err := relay.LoadSSOConfig(os.Getenv("WT_SSO_CONFIG"))
+			if err != nil {
+				return err
+			}
+			if !localFlag && !isEdge && githubID == "" && googleID == "" && smtpHost == "" && ssoCfg == nil {
 				localFlag = true
 				fmt.Println("no auth providers configured — enabling local mode")
 			}
@@ -90,6 +119,7 @@ func serveCmd() *cobra.Command {
 				BaseURL:            envOr("WT_BASE_URL", "http://localhost:8080"),
 				AppHost:            os.Getenv("WT_APP_HOST"),
 				WSHost:             os.Getenv("WT_WS_HOST"),
+				PreviewHost:        os.Getenv("WT_PREVIEW_HOST"),
 				JWTKey:             os.Getenv("WT_JWT_KEY"),
 				GitHubClientID:     githubID,
 				GitHubClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
@@ -105,7 +135,11 @@ func serveCmd() *cobra.Command {
 				FlyMachineID:       flyMachineID,
 				FlyRegion:          flyRegion,
 				FlyAppName:         flyApp,
+				InternalAddr:       internalAddr,
+				MetricsToken:       os.Getenv("WT_METRICS_TOKEN"),
+				AdminEmails:        envList("WT_ADMIN_EMAILS"),
 				HeroVideo:          os.Getenv("WT_HERO_VIDEO"),
+				SSO:                ssoCfg,
 			}
 
 			// JWT key: server mode requires WT_JWT_KEY env var.
@@ -126,6 +160,14 @@ func serveCmd() *cobra.Command {
 			if err := srv.InitJWTKey(); err != nil {
 				return fmt.Errorf("init jwt key: %w", err)
 			}
+			if !isEdge {
+				if err := store.PromoteAdminsByEmail(srvCfg.AdminEmails); err != nil {
+					return fmt.Errorf("promote admins: %w", err)
+				}
+				if err := srv.RevokeSSOBypasses(); err != nil {
+					return fmt.Errorf("revoke sessions bypassing sso: %w", err)
+				}
+			}
 
 			// Rate limit: 5 req/s sustained, 20 burst per IP
 			srv.RateLimit = relay.NewRateLimiter(5, 20)
@@ -135,11 +177,11 @@ func serveCmd() *cobra.Command {
 				if loginAddr == "" {
 					return fmt.Errorf("WT_LOGIN_ADDR required for edge nodes")
 				}
-				srv.SetLoginProxy(relay.NewLoginProxy(loginAddr))
+				srv.SetLoginProxy(relay.NewLoginProxy(srv.LoginPool()))
 				srv.SetSessionCache(relay.NewSessionCache())
 				// Bandwidth metering still works on edge, just with cached tiers
 				srv.Bandwidth = relay.NewBandwidthMeter(relay.SustainedRate, 1*1024*1024, nil)
-				entCache := relay.NewEntitlementCache(loginAddr)
+				entCache := relay.NewEntitlementCache(srv.LoginPool().Primary)
 				srv.Bandwidth.SetTierLookup(func(userID string) string {
 					return entCache.GetTier(userID)
 				})
@@ -179,6 +221,7 @@ func serveCmd() *cobra.Command {
 				}
 				srv.LocalMode = true
 				srv.SetLocalUser(user)
+				store.SetUserAdmin(user.ID, true)
 
 				// Grant pro tier — self-hosted has no bandwidth cap
 				if !store.IsUserPro(user.ID) {
@@ -205,17 +248,61 @@ func serveCmd() *cobra.Command {
 			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 			defer stop()
 
+			// Node identity: login nodes issue certificates from the cluster
+			// CA; edges enroll with them. Internal calls need it, so get it
+			// before any sync starts.
+			var internalSrv *http.Server
+			if nodeRole != "" {
+				id := relay.NodeIdentity{MachineID: flyMachineID, Role: nodeRole}
+				var nodeAuth *relay.NodeAuth
+				if isEdge {
+					nodeAuth = relay.NewEnrollingNodeAuth(srv.JWTKey(), id, srv.LoginPool())
+				} else {
+					ca, err := relay.LoadOrCreateNodeCA(store)
+					if err != nil {
+						return fmt.Errorf("node ca: %w", err)
+					}
+					srv.SetNodeCA(ca)
+					nodeAuth = relay.NewLocalNodeAuth(ca, id)
+				}
+				if err := nodeAuth.Start(ctx); err != nil {
+					return fmt.Errorf("node auth: %w", err)
+				}
+				srv.SetNodeAuth(nodeAuth)
+				internalSrv = &http.Server{
+					Addr:      internalAddr,
+					Handler:   srv,
+					TLSConfig: nodeAuth.ServerTLSConfig(),
+				}
+			}
+
 			// Sync bandwidth usage to DB every 10 minutes (only if DB available)
 			if !isEdge {
-				srv.Bandwidth.SeedFromDB()
+				if nodeRole == "login" && store.Dialect() == "postgres" {
+					// Login replicas compete for the leader lease; the
+					// leader seeds bandwidth totals and runs the workers.
+					if err := srv.StartLeaderElection(ctx, 5*time.Second); err != nil {
+						return err
+					}
+					srv.Bandwidth.SetSyncGate(srv.IsLeader)
+				} else {
+					if nodeRole == "login" {
+						fmt.Println("login node on SQLite: leader election off, run a single login replica")
+					}
+					srv.Bandwidth.SeedFromDB()
+				}
 				srv.Bandwidth.StartSync(ctx, 10*time.Minute)
+				srv.StartWebhooks(ctx, 15*time.Second)
 			}
 
-			// Start edge reconcile loop
-			if isEdge && loginAddr != "" {
-				srv.StartEdgeSync(ctx, loginAddr, 5*time.Second)
-				fmt.Println("edge sync started (5s interval)")
-				srv.GetSessionCache().StartOrgSync(ctx, loginAddr, 5*time.Minute)
+			// Start the reconcile loop with the login replicas
+			if pool := srv.LoginPool(); pool != nil {
+				pool.Start(ctx, 5*time.Second)
+				srv.StartEdgeSync(ctx, 5*time.Second)
+				fmt.Println("login sync started (5s interval)")
+			}
+			if isEdge {
+				srv.GetSessionCache().StartOrgSync(ctx, srv.LoginPool().Primary, 5*time.Minute)
 			}
 			if srv.EntitlementCache != nil {
 				srv.EntitlementCache.StartSync(ctx, 60*time.Second)
@@ -231,6 +318,13 @@ func serveCmd() *cobra.Command {
 				}
 				errCh <- httpSrv.ListenAndServe()
 			}()
+			if internalSrv != nil {
+				go func() {
+					fmt.Printf("internal mTLS listener on %s\n", internalAddr)
+					errCh <- internalSrv.ListenAndServeTLS("", "")
+				}()
+				defer internalSrv.Close()
+			}
 
 			select {
 			case <-ctx.Done():
@@ -7,12 +7,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ehrlich-b/wingthing/internal/auth"
 	"github.com/ehrlich-b/wingthing/internal/config"
 	"github.com/ehrlich-b/wingthing/internal/egg"
+	"github.com/ehrlich-b/wingthing/internal/store"
 	"github.com/ehrlich-b/wingthing/internal/ws"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func sessionCmd() *cobra.Command {
@@ -22,6 +26,8 @@ func sessionCmd() *cobra.Command {
 	}
 	cmd.AddCommand(sessionSyncCmd())
 	cmd.AddCommand(sessionListCmd())
+	cmd.AddCommand(sessionExportCmd())
+	cmd.AddCommand(sessionSearchCmd())
 	return cmd
 }
 
@@ -212,6 +218,356 @@ func sessionListCmd() *cobra.Command {
 	}
 }
 
+func sessionExportCmd() *cobra.Command {
+	var formatFlag, outFlag string
+	var atFlag time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "export <session-id>",
+		Short: "Export a session recording (asciicast, txt, html)",
+		Long: `Convert a session's audit recording (audit.pty.gz) into a shareable format:
+
+  asciicast  asciinema v2 cast file (play with asciinema or upload)
+  txt        plain transcript of what was on screen, escape sequences removed
+  html       self-contained page with a player, no external assets
+
+The session must have been started with audit enabled.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sessionID := args[0]
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			dir := filepath.Join(cfg.Dir, "eggs", sessionID)
+			rec, err := egg.ReadAuditRecording(dir)
+			if os.IsNotExist(err) {
+				return fmt.Errorf("no recording for session %s (start it with --audit)", sessionID)
+			}
+			if err != nil {
+				return fmt.Errorf("read recording: %w", err)
+			}
+
+			agent, cwd := readEggMeta(dir)
+			title := sessionID
+			if agent != "" {
+				title = agent + " · " + sessionID
+			}
+			if cwd != "" {
+				title += " · " + shortenPath(cwd)
+			}
+
+			out := cmd.OutOrStdout()
+			if outFlag != "" && outFlag != "-" {
+				f, err := os.Create(outFlag)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+
+			switch formatFlag {
+			case "asciicast", "cast":
+				err = rec.WriteAsciicast(out, title)
+			case "txt", "text":
+				err = rec.WriteTranscript(out)
+			case "html":
+				err = rec.WriteHTML(out, title, atFlag)
+			default:
+				return fmt.Errorf("unknown format %q (asciicast, txt, html)", formatFlag)
+			}
+			if err != nil {
+				return fmt.Errorf("export: %w", err)
+			}
+			if outFlag != "" && outFlag != "-" {
+				fmt.Fprintf(os.Stderr, "exported %s (%s, %s) to %s\n", sessionID, formatFlag, rec.Duration().Round(time.Second), outFlag)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&formatFlag, "format", "asciicast", "output format: asciicast, txt, html")
+	cmd.Flags().StringVarP(&outFlag, "output", "o", "", "output file (default stdout)")
+	cmd.Flags().DurationVar(&atFlag, "at", 0, "html: open the player at this offset (e.g. 12m30s)")
+	return cmd
+}
+
+func sessionSearchCmd() *cobra.Command {
+	var wingFlag string
+	var limitFlag int
+
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search session recordings, typed input, and chat history",
+		Long: `Full-text search across egg sessions. Words must all match; end a word
+with * to match prefixes. Recordings are indexed into wt.db on first search
+and re-indexed when they change.
+
+Searches this machine by default, or a remote wing with --wing.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := strings.Join(args, " ")
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			var hits []sessionSearchHit
+			if wingFlag == "" {
+				s, err := store.Open(cfg.DBPath())
+				if err != nil {
+					return err
+				}
+				defer s.Close()
+				if err := indexSessions(cfg, s); err != nil {
+					return err
+				}
+				hits, err = searchSessions(cfg, s, query, limitFlag, nil)
+				if err != nil {
+					return err
+				}
+			} else {
+				ts := auth.NewTokenStore(cfg.Dir)
+				tok, err := ts.Load()
+				if err != nil || !ts.IsValid(tok) {
+					return fmt.Errorf("not logged in — run: wt login")
+				}
+				privKey, err := auth.LoadPrivateKey(cfg.Dir)
+				if err != nil {
+					return fmt.Errorf("load key: %w", err)
+				}
+				tc := &ws.TunnelClient{
+					RelayURL:    resolveRelayHTTPURL(cfg),
+					DeviceToken: tok.Token,
+					PrivKey:     privKey,
+				}
+				wing, err := tc.DiscoverWing(cmd.Context(), wingFlag)
+				if err != nil {
+					return fmt.Errorf("discover wing: %w", err)
+				}
+				err = tc.Stream(cmd.Context(), wingFlag, wing.PublicKey,
+					map[string]any{"type": "sessions.search", "query": query, "limit": limitFlag},
+					func(chunk []byte) error {
+						var res struct {
+							Hits []sessionSearchHit `json:"hits"`
+						}
+						if err := json.Unmarshal(chunk, &res); err != nil {
+							return fmt.Errorf("decode results: %w", err)
+						}
+						hits = res.Hits
+						return nil
+					},
+				)
+				if err != nil {
+					return fmt.Errorf("search: %w", err)
+				}
+			}
+
+			if len(hits) == 0 {
+				fmt.Println("no matches")
+				return nil
+			}
+			hlOpen, hlClose := "", ""
+			if term.IsTerminal(int(os.Stdout.Fd())) {
+				hlOpen, hlClose = "\x1b[1;33m", "\x1b[0m"
+			}
+			for _, h := range hits {
+				at := "-"
+				if h.AtMS >= 0 {
+					at = formatOffset(time.Duration(h.AtMS) * time.Millisecond)
+				}
+				fmt.Printf("%s  %s  %-6s  %s", h.SessionID, at, h.Source, h.Agent)
+				if h.CWD != "" {
+					fmt.Printf("  %s", shortenPath(h.CWD))
+				}
+				fmt.Println()
+				snippet := strings.Join(strings.Fields(h.Snippet), " ")
+				snippet = strings.NewReplacer(store.SnippetOpen, hlOpen, store.SnippetClose, hlClose).Replace(snippet)
+				fmt.Printf("    %s\n", snippet)
+			}
+			if wingFlag == "" {
+				fmt.Println()
+				fmt.Println("replay from a match: wt session export <session-id> --format html --at <time> -o replay.html")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&wingFlag, "wing", "", "search a remote wing instead of this machine")
+	cmd.Flags().IntVar(&limitFlag, "limit", 20, "maximum matches to show")
+	return cmd
+}
+
+// maxSearchHits caps matches fetched from the index per search.
+const maxSearchHits = 200
+
+// sessionSearchHit is a search match with the session's metadata attached.
+type sessionSearchHit struct {
+	store.SearchHit
+	Agent  string `json:"agent,omitempty"`
+	CWD    string `json:"cwd,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+	Audit  bool   `json:"audit,omitempty"` // has a PTY recording to replay
+}
+
+// searchSessions runs query against the session index in s. limit <= 0
+// returns up to maxSearchHits matches. When visible is non-nil, only hits it
+// accepts are returned, and the index is paged until limit of them are found
+// or the matches run out.
+func searchSessions(cfg *config.Config, s *store.Store, query string, limit int, visible func(sessionSearchHit) bool) ([]sessionSearchHit, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("empty query")
+	}
+	if limit <= 0 || limit > maxSearchHits {
+		limit = maxSearchHits
+	}
+	hits := []sessionSearchHit{}
+	for offset := 0; len(hits) < limit; offset += maxSearchHits {
+		found, err := s.SearchSessions(query, maxSearchHits, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range found {
+			dir := filepath.Join(cfg.Dir, "eggs", h.SessionID)
+			agent, cwd := readEggMeta(dir)
+			_, auditErr := os.Stat(filepath.Join(dir, "audit.pty.gz"))
+			hit := sessionSearchHit{SearchHit: *h, Agent: agent, CWD: cwd, UserID: readEggOwner(dir), Audit: auditErr == nil}
+			if visible != nil && !visible(hit) {
+				continue
+			}
+			hits = append(hits, hit)
+			if len(hits) == limit {
+				break
+			}
+		}
+		if len(found) < maxSearchHits {
+			break
+		}
+	}
+	return hits, nil
+}
+
+// indexSessions (re)indexes every egg session whose recordings changed since
+// it was last indexed, and drops sessions whose directory is gone.
+func indexSessions(cfg *config.Config, s *store.Store) error {
+	eggsDir := filepath.Join(cfg.Dir, "eggs")
+	entries, err := os.ReadDir(eggsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read eggs: %w", err)
+	}
+	present := make(map[string]bool)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		present[e.Name()] = true
+		if err := indexSession(cfg, s, e.Name()); err != nil {
+			return err
+		}
+	}
+	indexed, err := s.IndexedSessions()
+	if err != nil {
+		return err
+	}
+	for _, id := range indexed {
+		if !present[id] {
+			s.ForgetSession(id)
+		}
+	}
+	return nil
+}
+
+// indexSession re-indexes one session if its recordings changed since it was
+// last indexed, or drops it if it has none left.
+func indexSession(cfg *config.Config, s *store.Store, sessionID string) error {
+	dir := filepath.Join(cfg.Dir, "eggs", sessionID)
+	fp := sessionFingerprint(dir)
+	old, err := s.SessionFingerprint(sessionID)
+	if err != nil || old == fp {
+		return nil
+	}
+	if fp == "" {
+		return s.ForgetSession(sessionID)
+	}
+	return s.IndexSession(sessionID, fp, egg.SessionText(dir))
+}
+
+// wingIndex is the wing's session search index. The wing keeps wt.db open
+// and re-indexes sessions as they are written, instead of rescanning every
+// session on each search.
+var wingIndex sessionIndex
+
+// sessionIndex is a long-lived handle on the session search index. The first
+// search sweeps every session; after that only sessions reported by Touch are
+// re-indexed, and they stay due until their egg has exited.
+type sessionIndex struct {
+	mu    sync.Mutex
+	s     *store.Store
+	dirty map[string]bool // sessionID -> written since last indexed
+}
+
+// Touch marks a session as written. It is re-indexed on the next search.
+func (x *sessionIndex) Touch(sessionID string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.dirty == nil {
+		x.dirty = make(map[string]bool)
+	}
+	x.dirty[sessionID] = true
+}
+
+// Search brings touched sessions up to date and runs query (see
+// searchSessions).
+func (x *sessionIndex) Search(cfg *config.Config, query string, limit int, visible func(sessionSearchHit) bool) ([]sessionSearchHit, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.s == nil {
+		s, err := store.Open(cfg.DBPath())
+		if err != nil {
+			return nil, err
+		}
+		if err := indexSessions(cfg, s); err != nil {
+			s.Close()
+			return nil, err
+		}
+		x.s = s
+	} else {
+		for id := range x.dirty {
+			if err := indexSession(cfg, x.s, id); err != nil {
+				return nil, err
+			}
+			// A running egg keeps writing; keep it due until it exits.
+			if _, err := os.Stat(filepath.Join(cfg.Dir, "eggs", id, "egg.sock")); err != nil {
+				delete(x.dirty, id)
+			}
+		}
+	}
+	return searchSessions(cfg, x.s, query, limit, visible)
+}
+
+// sessionFingerprint identifies the current state of a session's searchable
+// files by size and mtime. Empty if the session has none.
+func sessionFingerprint(dir string) string {
+	var parts []string
+	for _, name := range []string{"audit.pty.gz", "audit.log", "chat.jsonl.gz"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			parts = append(parts, fmt.Sprintf("%s:%d:%d", name, info.Size(), info.ModTime().UnixNano()))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatOffset formats a session offset as h:mm:ss or m:ss.
+func formatOffset(d time.Duration) string {
+	s := int(d.Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
 // shortenPath shortens a path for display by replacing home dir with ~.
 func shortenPath(p string) string {
 	home, _ := os.UserHomeDir()
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/store"
+)
+
+// localSearch runs a search the way `wt session search` does on this machine.
+func localSearch(t *testing.T, cfg *config.Config, query string, limit int, visible func(sessionSearchHit) bool) ([]sessionSearchHit, error) {
+	t.Helper()
+	s, err := store.Open(cfg.DBPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := indexSessions(cfg, s); err != nil {
+		return nil, err
+	}
+	return searchSessions(cfg, s, query, limit, visible)
+}
+
+func TestSearchSessionsIndexesAndRefreshes(t *testing.T) {
+	cfg := &config.Config{Dir: t.TempDir()}
+	dir := filepath.Join(cfg.Dir, "eggs", "sess-1")
+	os.MkdirAll(dir, 0700)
+	os.WriteFile(filepath.Join(dir, "egg.meta"), []byte("agent=claude\ncwd=/work/app\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "audit.log"), []byte("2026-03-01T12:00:30Z\tmake migrate\n"), 0644)
+
+	hits, err := localSearch(t, cfg, "migrate", 0, nil)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].SessionID != "sess-1" || hits[0].Agent != "claude" || hits[0].CWD != "/work/app" {
+		t.Fatalf("hits = %+v", hits)
+	}
+	if hits[0].AtMS != -1 || hits[0].Audit {
+		t.Errorf("hit without start time or recording = %+v", hits[0])
+	}
+
+	// Changed files are re-indexed on the next search
+	later := time.Now().Add(time.Minute)
+	os.WriteFile(filepath.Join(dir, "audit.log"), []byte("2026-03-01T12:00:30Z\tgo test ./...\n"), 0644)
+	os.Chtimes(filepath.Join(dir, "audit.log"), later, later)
+	if hits, _ := localSearch(t, cfg, "migrate", 0, nil); len(hits) != 0 {
+		t.Errorf("stale hits = %+v", hits)
+	}
+
+	// Removed sessions drop out of the index
+	os.RemoveAll(dir)
+	if hits, _ := localSearch(t, cfg, "test", 0, nil); len(hits) != 0 {
+		t.Errorf("hits for removed session = %+v", hits)
+	}
+}
+
+func TestSearchSessionsPagesPastHiddenHits(t *testing.T) {
+	cfg := &config.Config{Dir: t.TempDir()}
+	var log strings.Builder
+	for i := 0; i < maxSearchHits+50; i++ {
+		fmt.Fprintf(&log, "2026-03-01T12:00:30Z\tdeploy\n")
+	}
+	other := filepath.Join(cfg.Dir, "eggs", "sess-other")
+	os.MkdirAll(other, 0700)
+	os.WriteFile(filepath.Join(other, "egg.owner"), []byte("u-other\n"), 0644)
+	os.WriteFile(filepath.Join(other, "audit.log"), []byte(log.String()), 0644)
+	mine := filepath.Join(cfg.Dir, "eggs", "sess-mine")
+	os.MkdirAll(mine, 0700)
+	os.WriteFile(filepath.Join(mine, "egg.owner"), []byte("u-me\n"), 0644)
+	os.WriteFile(filepath.Join(mine, "audit.log"), []byte("2026-03-01T12:00:30Z\tdeploy the staging build after the nightly tests pass\n"), 0644)
+
+	// The visible session ranks below a full page of hidden matches
+	hits, err := localSearch(t, cfg, "deploy", 20, func(h sessionSearchHit) bool { return h.UserID == "u-me" })
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].SessionID != "sess-mine" {
+		t.Fatalf("hits = %+v", hits)
+	}
+}
+
+func TestSessionIndexReindexesTouchedSessions(t *testing.T) {
+	cfg := &config.Config{Dir: t.TempDir()}
+	dir := filepath.Join(cfg.Dir, "eggs", "sess-1")
+	os.MkdirAll(dir, 0700)
+	auditLog := filepath.Join(dir, "audit.log")
+	os.WriteFile(auditLog, []byte("2026-03-01T12:00:30Z\tmake migrate\n"), 0644)
+	var x sessionIndex
+	t.Cleanup(func() {
+		if x.s != nil {
+			x.s.Close()
+		}
+	})
+
+	// First search sweeps every session
+	if hits, err := x.Search(cfg, "migrate", 0, nil); err != nil || len(hits) != 1 {
+		t.Fatalf("hits = %+v, err = %v", hits, err)
+	}
+
+	// Later writes are picked up only once the session is touched
+	later := time.Now().Add(time.Minute)
+	os.WriteFile(auditLog, []byte("2026-03-01T12:00:30Z\tgo test ./...\n"), 0644)
+	os.Chtimes(auditLog, later, later)
+	if hits, _ := x.Search(cfg, "test", 0, nil); len(hits) != 0 {
+		t.Errorf("untouched session re-read: %+v", hits)
+	}
+	x.Touch("sess-1")
+	if hits, _ := x.Search(cfg, "test", 0, nil); len(hits) != 1 {
+		t.Errorf("touched session not re-indexed: %+v", hits)
+	}
+	if len(x.dirty) != 0 {
+		t.Errorf("exited session still due: %v", x.dirty)
+	}
+
+	// A running egg stays due until it exits
+	os.WriteFile(filepath.Join(dir, "egg.sock"), nil, 0600)
+	x.Touch("sess-1")
+	x.Search(cfg, "test", 0, nil)
+	if !x.dirty["sess-1"] {
+		t.Error("running session dropped from due set")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/auth"
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func tokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage personal access tokens for the REST API",
+	}
+	cmd.AddCommand(tokenCreateCmd())
+	cmd.AddCommand(tokenListCmd())
+	cmd.AddCommand(tokenRevokeCmd())
+	return cmd
+}
+
+// apiToken mirrors the relay's /api/v1/tokens entries.
+type apiToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	WingIDs    []string   `json:"wing_ids"`
+	OrgID      *string    `json:"org_id"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expired    bool       `json:"expired"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// tokenAPI calls the relay's token endpoints with this device's login.
+func tokenAPI(method, path string, body any, out any) error {
+	return relayAPI("", method, "/api/v1/tokens"+path, body, out)
+}
+
+// relayAPI calls a relay REST endpoint with this device's login. An empty
+// relayURL means the configured relay.
+func relayAPI(relayURL, method, path string, body any, out any) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if relayURL == "" {
+		relayURL = resolveRelayHTTPURL(cfg)
+	}
+	ts := auth.NewTokenStore(cfg.Dir)
+	tok, err := ts.Load()
+	if err != nil || !ts.IsValid(tok) {
+		return fmt.Errorf("not logged in — run: wt login")
+	}
+	var rd io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, relayURL+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("relay: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("%s", e.Error)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// parseExpiry turns "30d", "never" or a bare day count into days (0 = never).
+func parseExpiry(s string) (int, error) {
+	if s == "never" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid --expires %q (use e.g. 30d or never)", s)
+	}
+	return n, nil
+}
+
+func tokenCreateCmd() *cobra.Command {
+	var scopes, wings []string
+	var orgFlag, expiresFlag string
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a scoped token (shown once)",
+		Long: `Creates a personal access token for scripts and integrations. Tokens only
+get the scopes you grant:
+
+  wings:read      list wings and their status
+  sessions:read   list terminal sessions
+  sessions:write  open, attach to and kill terminal sessions
+  orgs:read       list orgs and their members
+  usage:read      read tier and bandwidth usage
+  audit:read      read your audit log, and your orgs' as an owner or admin
+  admin           administer the relay (relay admins only)
+
+--wing limits the token to specific wings; --org limits it to one org's
+wings (you must be an owner or admin).`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			days, err := parseExpiry(expiresFlag)
+			if err != nil {
+				return err
+			}
+			body := map[string]any{
+				"name":            args[0],
+				"scopes":          scopes,
+				"wing_ids":        wings,
+				"org":             orgFlag,
+				"expires_in_days": days,
+			}
+			var t apiToken
+			if err := tokenAPI("POST", "", body, &t); err != nil {
+				return err
+			}
+			fmt.Println(t.Token)
+			fmt.Fprintf(os.Stderr, "token %s created — copy it now, it won't be shown again\n", t.ID)
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&scopes, "scope", nil, "scope to grant (repeatable)")
+	cmd.Flags().StringSliceVar(&wings, "wing", nil, "limit to this wing ID (repeatable)")
+	cmd.Flags().StringVar(&orgFlag, "org", "", "limit to one org (ID or slug)")
+	cmd.Flags().StringVar(&expiresFlag, "expires", "90d", "lifetime in days, or never")
+	cmd.MarkFlagRequired("scope")
+	return cmd
+}
+
+func tokenListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List your tokens",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var tokens []apiToken
+			if err := tokenAPI("GET", "", nil, &tokens); err != nil {
+				return err
+			}
+			if len(tokens) == 0 {
+				fmt.Println("no tokens")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tSCOPES\tLIMITED TO\tEXPIRES\tLAST USED")
+			for _, t := range tokens {
+				limit := "-"
+				if t.OrgID != nil {
+					limit = "org " + *t.OrgID
+				}
+				if len(t.WingIDs) > 0 {
+					limit = "wings " + strings.Join(t.WingIDs, ",")
+				}
+				expires := "never"
+				if t.Expired {
+					expires = "expired"
+				} else if t.ExpiresAt != nil {
+					expires = t.ExpiresAt.Local().Format("2006-01-02")
+				}
+				used := "never"
+				if t.LastUsedAt != nil {
+					used = t.LastUsedAt.Local().Format("2006-01-02 15:04")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(t.Scopes, ","), limit, expires, used)
+			}
+			w.Flush()
+			return nil
+		},
+	}
+}
+
+func tokenRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke a token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := tokenAPI("DELETE", "/"+args[0], nil, nil); err != nil {
+				return err
+			}
+			fmt.Println("revoked")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/auth"
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/egg"
+	"github.com/ehrlich-b/wingthing/internal/store"
+	"github.com/ehrlich-b/wingthing/internal/ws"
+)
+
+// toolApprovalGate is a session's ToolApprover: it shows gated tool calls to
+// the attached browser (E2E encrypted, like attention replies), pings ntfy,
+// and waits for pty.attention_reply. Only one prompt is on screen at a time;
+// the next pending one is offered when it is answered.
+type toolApprovalGate struct {
+	sessionID string
+	agent     string
+	cwd       string
+	mu        *sync.Mutex  // guards *gcm
+	gcm       *cipher.AEAD // nil until the browser has derived a key
+	write     ws.PTYWriteFunc
+
+	pmu     sync.Mutex
+	pending []*pendingToolApproval // oldest first
+}
+
+type pendingToolApproval struct {
+	req  egg.ToolApproval
+	done chan egg.ToolDecision
+}
+
+func newToolApprovalGate(sessionID, agent, cwd string, mu *sync.Mutex, gcm *cipher.AEAD, write ws.PTYWriteFunc) *toolApprovalGate {
+	return &toolApprovalGate{sessionID: sessionID, agent: agent, cwd: cwd, mu: mu, gcm: gcm, write: write}
+}
+
+// approve implements egg.ToolApprover.
+func (g *toolApprovalGate) approve(ctx context.Context, req egg.ToolApproval) egg.ToolDecision {
+	p := &pendingToolApproval{req: req, done: make(chan egg.ToolDecision, 1)}
+	g.pmu.Lock()
+	g.pending = append(g.pending, p)
+	first := len(g.pending) == 1
+	g.pmu.Unlock()
+	defer g.remove(p)
+
+	log.Printf("pty session %s: tool %s waiting for approval", g.sessionID, req.Tool)
+	if first {
+		g.offer(req)
+	}
+	// Every gated call notifies; no cooldown, the nonce is the request ID
+	wingAttention.Store(g.sessionID, egg.AttentionTool)
+	g.write(ws.SessionAttention{Type: ws.TypeSessionAttention, SessionID: g.sessionID, Agent: g.agent, CWD: g.cwd, Kind: egg.AttentionTool, Nonce: req.ID})
+
+	select {
+	case dec := <-p.done:
+		return dec
+	case <-ctx.Done():
+		// Unanswered: let the next waiting call take the screen
+		g.remove(p)
+		g.offerPending()
+		if ctx.Err() == context.DeadlineExceeded {
+			return egg.ToolDecision{Reason: "no answer in time"}
+		}
+		return egg.ToolDecision{Reason: "session ended"}
+	}
+}
+
+func (g *toolApprovalGate) remove(p *pendingToolApproval) {
+	g.pmu.Lock()
+	defer g.pmu.Unlock()
+	for i, q := range g.pending {
+		if q == p {
+			g.pending = append(g.pending[:i], g.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// answer resolves the pending call with the given nonce. Returns false if no
+// call is waiting on it (the reply is for an on-screen prompt instead).
+func (g *toolApprovalGate) answer(nonce, choice, by string) bool {
+	g.pmu.Lock()
+	var p *pendingToolApproval
+	for i, q := range g.pending {
+		if q.req.ID == nonce {
+			p = q
+			g.pending = append(g.pending[:i], g.pending[i+1:]...)
+			break
+		}
+	}
+	var next *pendingToolApproval
+	if len(g.pending) > 0 {
+		next = g.pending[0]
+	}
+	g.pmu.Unlock()
+	if p == nil {
+		return false
+	}
+	approved := choice == "approve"
+	verdict := "denied"
+	if approved {
+		verdict = "approved"
+	}
+	log.Printf("pty session %s: tool %s %s by %s", g.sessionID, p.req.Tool, verdict, by)
+	p.done <- egg.ToolDecision{Approved: approved, By: by}
+	if next != nil {
+		g.offer(next.req)
+	}
+	return true
+}
+
+// offerPending re-sends the oldest waiting call, e.g. after the browser
+// reattaches under a new key.
+func (g *toolApprovalGate) offerPending() {
+	g.pmu.Lock()
+	var req *egg.ToolApproval
+	if len(g.pending) > 0 {
+		req = &g.pending[0].req
+	}
+	g.pmu.Unlock()
+	if req != nil {
+		g.offer(*req)
+	}
+}
+
+func (g *toolApprovalGate) offer(req egg.ToolApproval) {
+	g.mu.Lock()
+	currentGCM := *g.gcm
+	g.mu.Unlock()
+	if currentGCM == nil {
+		return
+	}
+	payload, err := json.Marshal(map[string]any{
+		"kind":        egg.AttentionTool,
+		"detail":      toolCommandLine(req.Tool, req.Args),
+		"tool":        req.Tool,
+		"args":        req.Args,
+		"description": req.Description,
+		"nonce":       req.ID,
+		"choices":     []string{"approve", "deny"},
+	})
+	if err != nil {
+		return
+	}
+	encrypted, err := auth.Encrypt(currentGCM, payload)
+	if err != nil {
+		log.Printf("pty session %s: tool approval encrypt error: %v", g.sessionID, err)
+		return
+	}
+	g.write(ws.PTYAttention{Type: ws.TypePTYAttention, SessionID: g.sessionID, Data: encrypted})
+}
+
+// toolCommandLine renders a call as a shell-quoted command line so the owner
+// sees every argument exactly, including spaces and quotes.
+func toolCommandLine(tool string, args []string) string {
+	parts := []string{tool}
+	for _, a := range args {
+		if a != "" && strings.Trim(a, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@+%") == "" {
+			parts = append(parts, a)
+			continue
+		}
+		parts = append(parts, "'"+strings.ReplaceAll(a, "'", `'\''`)+"'")
+	}
+	return strings.Join(parts, " ")
+}
+
+// sessionUser names the session owner in the tool ledger.
+func sessionUser(start ws.PTYStart) string {
+	if start.Email != "" {
+		return start.Email
+	}
+	return start.UserID
+}
+
+// attachUser names the browser user of a relay-stamped pty.attach.
+func attachUser(attach ws.PTYAttach) string {
+	if attach.Email != "" {
+		return attach.Email
+	}
+	return attach.UserID
+}
+
+// replySender names who sent a pty.attention_reply: the user the relay
+// stamped on it, or fallback (the attached controller) for a reply that
+// didn't come through the relay.
+func replySender(data []byte, fallback string) string {
+	var reply ws.PTYAttentionReply
+	if json.Unmarshal(data, &reply) == nil {
+		if reply.SenderEmail != "" {
+			return reply.SenderEmail
+		}
+		if reply.SenderUserID != "" {
+			return reply.SenderUserID
+		}
+	}
+	return fallback
+}
+
+// unstampReply clears the relay-injected sender of a pty.attention_reply
+// that arrived over a P2P DataChannel, where the browser could set it.
+func unstampReply(data []byte) []byte {
+	var reply ws.PTYAttentionReply
+	if json.Unmarshal(data, &reply) != nil || reply.Type != ws.TypePTYAttentionReply {
+		return data
+	}
+	if reply.SenderUserID == "" && reply.SenderEmail == "" {
+		return data
+	}
+	reply.SenderUserID, reply.SenderEmail = "", ""
+	out, err := json.Marshal(reply)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// listenSessionTools serves tools on the session's tool socket. Gated calls
+// ask gate; each decision is passed to audit (nil when the session isn't
+// audited) and every call goes into the wing's tool ledger under user. The
+// returned func stops the listener.
+func listenSessionTools(cfg *config.Config, sessionID string, tools []*config.ToolConfig, gate *toolApprovalGate, audit func(string), user string) (*egg.ToolListener, string, func(), error) {
+	toolsDir := filepath.Join(cfg.Dir, "eggs", sessionID, ".tools")
+	os.MkdirAll(toolsDir, 0700)
+	sockPath := filepath.Join(toolsDir, "tool.sock")
+	tl, err := egg.NewToolListener(sockPath, tools)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	tl.SetApprover(gate.approve, audit)
+	ledger, err := store.Open(cfg.DBPath())
+	if err != nil {
+		log.Printf("pty session %s: tool ledger unavailable: %v", sessionID, err)
+		return tl, sockPath, func() { tl.Close() }, nil
+	}
+	tl.SetRecorder(toolLedgerRecorder(ledger, sessionID, user))
+	return tl, sockPath, func() {
+		tl.Close()
+		ledger.Close()
+	}, nil
+}
+
+// toolDecisionAuditor records tool decisions in the session's chained audit
+// log through its egg. ec returns nil until the egg is up.
+func toolDecisionAuditor(sessionID string, ec func() *egg.Client) func(string) {
+	return func(record string) {
+		c := ec()
+		if c == nil {
+			log.Printf("pty session %s: tool decision not audited (egg not up): %s", sessionID, record)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := c.Audit(ctx, sessionID, record); err != nil {
+			log.Printf("pty session %s: audit tool decision: %v", sessionID, err)
+		}
+	}
+}
+
+// toolLedgerRecorder appends a session's tool calls to the wing's ledger.
+func toolLedgerRecorder(ledger *store.Store, sessionID, user string) func(egg.ToolCallRecord) {
+	return func(r egg.ToolCallRecord) {
+		err := ledger.AppendToolCall(&store.ToolCall{
+			SessionID:   sessionID,
+			User:        user,
+			Tool:        r.Tool,
+			Args:        r.Args,
+			ExitCode:    r.ExitCode,
+			Error:       r.Error,
+			DurationMS:  r.Duration.Milliseconds(),
+			OutputBytes: r.OutputBytes,
+			OutputHash:  r.OutputHash,
+			StartedAt:   r.Started,
+		})
+		if err != nil {
+			log.Printf("pty session %s: tool ledger: %v", sessionID, err)
+		}
+	}
+}
+
+// checkToolPolicies logs tools whose sandbox policy doesn't resolve. Calls to
+// them fail closed; this just says so before an agent finds out.
+func checkToolPolicies(tools []*config.ToolConfig) {
+	for _, tc := range tools {
+		if _, err := egg.ToolPolicy(tc); err != nil {
+			log.Printf("wing: tool %s: sandbox: %v (calls will be refused)", tc.Name, err)
+		}
+	}
+}
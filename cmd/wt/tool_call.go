@@ -6,14 +6,19 @@ import (
 	"io"
 	"net"
 	"os"
+	"sort"
+	"strings"
 
+	"github.com/ehrlich-b/wingthing/internal/config"
 	"github.com/ehrlich-b/wingthing/internal/egg"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func toolCallCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:    "tool-call [tool] [args...]",
+	var streamFlag bool
+	cmd := &cobra.Command{
+		Use:    "tool-call [--stream] [tool] [args...]",
 		Short:  "Call a privileged tool via the wing daemon",
 		Hidden: true, // called by generated shims, not directly by users
 		Args:   cobra.MinimumNArgs(1),
@@ -23,6 +28,23 @@ func toolCallCmd() *cobra.Command {
 				fmt.Fprintln(os.Stderr, "WT_TOOL_SOCKET not set — tool-call must be run inside an egg session with tools configured")
 				os.Exit(126)
 			}
+			if streamFlag {
+				// Pass piped stdin through; a terminal stays with the agent
+				var stdin io.Reader
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					stdin = os.Stdin
+				}
+				final, err := egg.StreamTool(sockPath, args[0], args[1:], stdin, os.Stdout, os.Stderr)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(127)
+				}
+				if final.Error != "" {
+					fmt.Fprintln(os.Stderr, final.Error)
+					os.Exit(1)
+				}
+				os.Exit(final.ExitCode)
+			}
 			conn, err := net.Dial("unix", sockPath)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "connect to tool socket: %v\n", err)
@@ -57,12 +79,35 @@ func toolCallCmd() *cobra.Command {
 			return nil
 		},
 	}
+	// Everything after the tool name belongs to the tool, flags included
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().BoolVar(&streamFlag, "stream", false, "stream output as it arrives and pass stdin through")
+	return cmd
 }
 
-func toolListCmd() *cobra.Command {
+func mcpServeCmd() *cobra.Command {
 	return &cobra.Command{
+		Use:    "mcp-serve",
+		Short:  "Serve privileged tools over MCP (stdio)",
+		Hidden: true, // launched by agents from their MCP settings, not directly by users
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Without WT_TOOL_SOCKET (agent started outside an egg, or no tools
+			// configured) the server runs with an empty tool list.
+			return egg.ServeMCP(os.Stdin, os.Stdout, os.Getenv("WT_TOOL_SOCKET"), version)
+		},
+	}
+}
+
+func toolListCmd() *cobra.Command {
+	var schemaFlag bool
+	cmd := &cobra.Command{
 		Use:   "tool-list",
 		Short: "List available privileged tools",
+		Long: `Lists the privileged tools available in this session with their arguments.
+
+With --json-schema, prints each tool's arguments as a JSON Schema object
+(named properties, in $1..$n order) for agents that call tools by schema.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			sockPath := os.Getenv("WT_TOOL_SOCKET")
 			if sockPath == "" {
@@ -89,14 +134,74 @@ func toolListCmd() *cobra.Command {
 				fmt.Fprintf(os.Stderr, "parse tool response: %v\n", err)
 				os.Exit(127)
 			}
+			sort.Slice(listResp.Tools, func(i, j int) bool { return listResp.Tools[i].Name < listResp.Tools[j].Name })
+			if schemaFlag {
+				return printToolSchemas(listResp.Tools)
+			}
 			for _, t := range listResp.Tools {
-				if t.Description != "" {
-					fmt.Printf("%-20s %s\n", t.Name, t.Description)
+				usage := config.ToolUsage(t.Name, t.Params)
+				desc := t.Description
+				if t.Approval != "" {
+					desc = strings.TrimSpace(desc + " (needs owner approval)")
+				}
+				if desc != "" {
+					fmt.Printf("%-20s %s\n", usage, desc)
 				} else {
-					fmt.Println(t.Name)
+					fmt.Println(usage)
+				}
+				for _, p := range t.Params {
+					fmt.Printf("    %-16s %s\n", p.Name, describeToolParam(p))
 				}
 			}
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&schemaFlag, "json-schema", false, "print tool arguments as JSON Schema")
+	return cmd
+}
+
+// describeToolParam summarizes a param's type and constraints on one line.
+func describeToolParam(p config.ToolParam) string {
+	typ := p.Type
+	if typ == "" {
+		typ = config.ParamString
+	}
+	parts := []string{typ}
+	if len(p.Enum) > 0 {
+		parts = append(parts, "one of "+strings.Join(p.Enum, "|"))
+	}
+	if p.Pattern != "" {
+		parts = append(parts, "matching "+p.Pattern)
+	}
+	if p.MaxLength > 0 {
+		parts = append(parts, fmt.Sprintf("max %d bytes", p.MaxLength))
+	}
+	if p.Min != nil {
+		parts = append(parts, fmt.Sprintf(">= %v", *p.Min))
+	}
+	if p.Max != nil {
+		parts = append(parts, fmt.Sprintf("<= %v", *p.Max))
+	}
+	s := strings.Join(parts, ", ")
+	if p.Description != "" {
+		s += " — " + p.Description
+	}
+	return s
+}
+
+func printToolSchemas(tools []egg.ToolListEntry) error {
+	type toolSchema struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		InputSchema map[string]any `json:"input_schema"`
+	}
+	out := make([]toolSchema, 0, len(tools))
+	for _, t := range tools {
+		schema := config.ToolJSONSchema(t.Params)
+		schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+		out = append(out, toolSchema{Name: t.Name, Description: t.Description, InputSchema: schema})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/store"
+	"github.com/spf13/cobra"
+)
+
+func toolCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tool",
+		Short: "Inspect privileged tools run for agents",
+	}
+	cmd.AddCommand(toolLogCmd())
+	return cmd
+}
+
+func toolLogCmd() *cobra.Command {
+	var sessionFlag, toolFlag string
+	var sinceFlag time.Duration
+	var limitFlag int
+	var jsonFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show the privileged tool calls this wing has run",
+		Long: `Lists tool calls from the wing's ledger in wt.db, newest first: who ran
+what, with which arguments, how it ended and how long it took. Refused calls
+(bad arguments, denied, rate limited) are listed with the reason. Output is
+not stored; the hash identifies it if you have a copy.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			s, err := store.Open(cfg.DBPath())
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			f := store.ToolCallFilter{SessionID: sessionFlag, Tool: toolFlag, Limit: limitFlag}
+			if sinceFlag > 0 {
+				f.Since = time.Now().Add(-sinceFlag)
+			}
+			calls, err := s.ListToolCalls(f)
+			if err != nil {
+				return err
+			}
+			if jsonFlag {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if calls == nil {
+					calls = []*store.ToolCall{}
+				}
+				return enc.Encode(calls)
+			}
+			if len(calls) == 0 {
+				fmt.Println("no tool calls")
+				return nil
+			}
+			for _, c := range calls {
+				session := c.SessionID
+				if len(session) > 8 {
+					session = session[:8]
+				}
+				user := c.User
+				if user == "" {
+					user = "-"
+				}
+				fmt.Printf("%s  %s  %-20s  %s\n", c.StartedAt.Local().Format("2006-01-02 15:04:05"), session, user, toolCommandLine(c.Tool, c.Args))
+				fmt.Printf("    %s\n", describeToolCall(c))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&sessionFlag, "session", "", "only calls from this session")
+	cmd.Flags().StringVar(&toolFlag, "tool", "", "only calls to this tool")
+	cmd.Flags().DurationVar(&sinceFlag, "since", 0, "only calls in the last duration (e.g. 24h)")
+	cmd.Flags().IntVarP(&limitFlag, "limit", "n", 50, "maximum calls to show")
+	cmd.Flags().BoolVar(&jsonFlag, "json", false, "print calls as JSON")
+	return cmd
+}
+
+// describeToolCall summarizes how a ledger entry ended.
+func describeToolCall(c *store.ToolCall) string {
+	if c.Error != "" {
+		return "refused: " + c.Error
+	}
+	d := (time.Duration(c.DurationMS) * time.Millisecond).String()
+	return fmt.Sprintf("exit %d  %s  %s output  sha256:%s", c.ExitCode, d, humanBytes(c.OutputBytes), c.OutputHash)
+}
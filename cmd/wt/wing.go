@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/cipher"
 	"crypto/ecdh"
+	"crypto/ed25519"
 	crand "crypto/rand"
 	"encoding/base64"
 	"encoding/json"
@@ -40,8 +41,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// wingAttention tracks sessions that have triggered a terminal bell (need user attention).
-var wingAttention sync.Map // sessionID → bool
+// wingAttention tracks sessions that need user attention.
+var wingAttention sync.Map // sessionID → attention kind (egg.Attention*)
 
 // wingAttentionCooldown tracks last attention send time per session (30s throttle).
 var wingAttentionCooldown sync.Map // sessionID → time.Time
@@ -64,20 +65,20 @@ var sessionStates sync.Map // sessionID -> *sessionIdleState
 
 const attentionCooldown = 30 * time.Second
 
-// checkAndSendAttention fires session.attention if the cooldown has elapsed.
-// Returns true if the attention was sent.
-func checkAndSendAttention(sessionID, agent, cwd string, write ws.PTYWriteFunc) bool {
+// checkAndSendAttention fires session.attention of the given kind if the
+// cooldown has elapsed. Returns true if the attention was sent.
+func checkAndSendAttention(sessionID, agent, cwd, kind string, write ws.PTYWriteFunc) bool {
 	now := time.Now()
 	if v, ok := wingAttentionCooldown.Load(sessionID); ok {
 		if now.Sub(v.(time.Time)) < attentionCooldown {
 			return false
 		}
 	}
-	wingAttention.Store(sessionID, true)
+	wingAttention.Store(sessionID, kind)
 	wingAttentionCooldown.Store(sessionID, now)
 	// Reuse nonce for the same attention episode; relay deduplicates by nonce.
 	nonce, _ := wingAttentionNonce.LoadOrStore(sessionID, generateAttentionNonce())
-	write(ws.SessionAttention{Type: ws.TypeSessionAttention, SessionID: sessionID, Agent: agent, CWD: cwd, Nonce: nonce.(string)})
+	write(ws.SessionAttention{Type: ws.TypeSessionAttention, SessionID: sessionID, Agent: agent, CWD: cwd, Kind: kind, Nonce: nonce.(string)})
 	return true
 }
 
@@ -103,6 +104,74 @@ func generateAttentionNonce() string {
 	return fmt.Sprintf("%x", b)
 }
 
+// offerAttentionReply encrypts a replyable prompt for the attached browser so
+// it can show a quick reply. No-op until the browser has derived a key.
+func offerAttentionReply(sessionID string, ev egg.AttentionEvent, mu *sync.Mutex, gcm *cipher.AEAD, write ws.PTYWriteFunc) {
+	mu.Lock()
+	currentGCM := *gcm
+	mu.Unlock()
+	if currentGCM == nil {
+		return
+	}
+	payload, err := json.Marshal(map[string]any{
+		"kind":    ev.Kind,
+		"detail":  ev.Detail,
+		"nonce":   ev.Nonce,
+		"choices": []string{"approve", "deny"},
+	})
+	if err != nil {
+		return
+	}
+	encrypted, err := auth.Encrypt(currentGCM, payload)
+	if err != nil {
+		log.Printf("pty session %s: attention encrypt error: %v", sessionID, err)
+		return
+	}
+	write(ws.PTYAttention{Type: ws.TypePTYAttention, SessionID: sessionID, Data: encrypted})
+}
+
+// decodeAttentionReply checks a pty.attention_reply's auth token and returns
+// the decrypted prompt nonce and choice.
+func decodeAttentionReply(data []byte, gcm cipher.AEAD, requirePasskey bool, passkeyCache *auth.AuthCache, authTTL time.Duration) (nonce, choice string, err error) {
+	var reply ws.PTYAttentionReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return "", "", err
+	}
+	if gcm == nil {
+		return "", "", fmt.Errorf("E2E not established")
+	}
+	if requirePasskey {
+		if _, ok := passkeyCache.Check(reply.AuthToken, authTTL); !ok {
+			return "", "", fmt.Errorf("invalid or expired auth token")
+		}
+	}
+	plain, err := auth.Decrypt(gcm, reply.Data)
+	if err != nil {
+		return "", "", fmt.Errorf("decrypt: %w", err)
+	}
+	var answer struct {
+		Nonce  string `json:"nonce"`
+		Choice string `json:"choice"`
+	}
+	if err := json.Unmarshal(plain, &answer); err != nil {
+		return "", "", err
+	}
+	return answer.Nonce, answer.Choice, nil
+}
+
+// attentionReplyKeys maps a reply to the keystrokes for the prompt on screen.
+func attentionReplyKeys(detector *egg.AttentionDetector, nonce, choice string) ([]byte, error) {
+	ev, ok := detector.Pending()
+	if !ok || ev.Nonce != nonce {
+		return nil, fmt.Errorf("prompt no longer on screen")
+	}
+	keys := ev.Keys(choice)
+	if keys == "" {
+		return nil, fmt.Errorf("unknown choice %q", choice)
+	}
+	return []byte(keys), nil
+}
+
 // parsePreviewFile parses a .wt-preview file into a mode/url/content map.
 func parsePreviewFile(data []byte) map[string]string {
 	s := strings.TrimSpace(string(data))
@@ -307,13 +376,6 @@ func readEggMeta(dir string) (agent, cwd string) {
 	return agent, cwd
 }
 
-// hasBell returns true if data contains any BEL character (0x07).
-// Does NOT try to distinguish OSC terminators from "real" bells — callers
-// use a time-window heuristic instead (repeated BELs = real notification).
-func hasBell(data []byte) bool {
-	return bytes.IndexByte(data, 0x07) >= 0
-}
-
 func gzipData(data []byte) ([]byte, error) {
 	var buf bytes.Buffer
 	w := gzip.NewWriter(&buf)
@@ -559,6 +621,8 @@ func scanDir(dir string, depth, maxDepth int, projects *[]ws.WingProject) {
 				ModTime: projectModTime(dir),
 			})
 			if hasGit {
+				// Role subdirs of the repo (dev/egg.yaml, qa/egg.yaml)
+				*projects = append(*projects, eggSubprojects(dir)...)
 				return
 			}
 			// egg.yaml only: also scan children for git repos
@@ -595,21 +659,7 @@ func scanDir(dir string, depth, maxDepth int, projects *[]ws.WingProject) {
 		if hasGit {
 			// Git repo found. Also check immediate children for egg.yaml
 			// sub-projects (e.g. ai-playground/.git + ai-playground/dev/egg.yaml).
-			if subs, err := os.ReadDir(full); err == nil {
-				for _, sub := range subs {
-					if !sub.IsDir() || strings.HasPrefix(sub.Name(), ".") {
-						continue
-					}
-					subFull := filepath.Join(full, sub.Name())
-					if info, err := os.Stat(filepath.Join(subFull, "egg.yaml")); err == nil && !info.IsDir() {
-						*projects = append(*projects, ws.WingProject{
-							Name:    sub.Name(),
-							Path:    subFull,
-							ModTime: projectModTime(subFull),
-						})
-					}
-				}
-			}
+			*projects = append(*projects, eggSubprojects(full)...)
 			continue
 		}
 		// No .git — keep scanning (egg.yaml dirs can contain git repos).
@@ -617,6 +667,30 @@ func scanDir(dir string, depth, maxDepth int, projects *[]ws.WingProject) {
 	}
 }
 
+// eggSubprojects returns the immediate children of a git repo that have
+// their own egg.yaml (role dirs in a multi-role repo).
+func eggSubprojects(repo string) []ws.WingProject {
+	subs, err := os.ReadDir(repo)
+	if err != nil {
+		return nil
+	}
+	var out []ws.WingProject
+	for _, sub := range subs {
+		if !sub.IsDir() || strings.HasPrefix(sub.Name(), ".") {
+			continue
+		}
+		subFull := filepath.Join(repo, sub.Name())
+		if info, err := os.Stat(filepath.Join(subFull, "egg.yaml")); err == nil && !info.IsDir() {
+			out = append(out, ws.WingProject{
+				Name:    sub.Name(),
+				Path:    subFull,
+				ModTime: projectModTime(subFull),
+			})
+		}
+	}
+	return out
+}
+
 func wingPidPath() string {
 	cfg, _ := config.Load()
 	if cfg != nil {
@@ -1136,6 +1210,7 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 		log.Printf("wing: load tools: %v (continuing without tools)", toolErr)
 	} else if len(wingTools) > 0 {
 		log.Printf("wing: loaded %d tool(s) from %s", len(wingTools), toolsDir)
+		checkToolPolicies(wingTools)
 	}
 	var wingToolsMu sync.Mutex
 
@@ -1225,26 +1300,26 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 		rootDir = resolvedPaths[0]
 	}
 
-	// Scan for git projects in each path
+	// Scan for git projects in each path, then keep watching them so new
+	// clones show up without a restart
 	cwd, _ := os.Getwd()
-	seen := make(map[string]bool)
-	var projects []ws.WingProject
-	for _, sp := range resolvedPaths {
-		for _, p := range discoverProjects(sp, 3) {
-			if !seen[p.Path] {
-				seen[p.Path] = true
-				projects = append(projects, p)
-			}
+	projectRoots := func(paths []string) []projectRoot {
+		var roots []projectRoot
+		for _, sp := range paths {
+			roots = append(roots, projectRoot{Dir: sp, Depth: 3})
 		}
-	}
-	if cwd != "" {
-		for _, p := range discoverProjects(cwd, 2) {
-			if !seen[p.Path] {
-				seen[p.Path] = true
-				projects = append(projects, p)
-			}
+		if cwd != "" {
+			roots = append(roots, projectRoot{Dir: cwd, Depth: 2})
 		}
+		return roots
 	}
+	var client *ws.Client // declared early so the indexer and peerMgr.OnDC closures can capture it
+	projectIdx := newProjectIndexer(projectRoots(resolvedPaths), func(projects []ws.WingProject) {
+		if err := client.SetProjects(ctx, projects); err != nil {
+			log.Printf("projects: push update: %v", err)
+		}
+	})
+	projects := projectIdx.Projects()
 
 	fmt.Printf("connecting to %s\n", wsURL)
 	fmt.Printf("  agents: %v\n", agents)
@@ -1280,6 +1355,11 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 	if privKeyErr != nil {
 		return fmt.Errorf("load private key: %w", privKeyErr)
 	}
+	// The relay only notarizes audit chain heads signed by the key the wing registers
+	signKey, err := auth.DeriveSigningKey(privKey)
+	if err != nil {
+		return fmt.Errorf("derive signing key: %w", err)
+	}
 
 	// P2P: initialize PeerManager if connection mode supports it
 	var peerMgr *webrtcpkg.PeerManager
@@ -1302,8 +1382,6 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 	var dcSessions sync.Map // sessionID → *pionwebrtc.DataChannel
 	var swSessions sync.Map // sessionID → *webrtcpkg.SwappableWriter
 
-	var client *ws.Client // declared early so peerMgr.OnDC closure can capture it
-
 	// P2P: wire up DataChannel message routing when DCs open
 	if peerMgr != nil {
 		peerMgr.OnDC(func(senderPub, sessionID string, dc *pionwebrtc.DataChannel) {
@@ -1315,7 +1393,7 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 			log.Printf("[P2P] DC stored for session %s from %s", sessionID, senderPub[:8])
 
 			dc.OnMessage(func(msg pionwebrtc.DataChannelMessage) {
-				client.PushPTYInput(sessionID, msg.Data)
+				client.PushPTYInput(sessionID, unstampReply(msg.Data))
 			})
 			dc.OnClose(func() {
 				dcSessions.Delete(sessionID)
@@ -1337,6 +1415,7 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 		Platform:    runtime.GOOS,
 		Version:     version,
 		PublicKey:   base64.StdEncoding.EncodeToString(privKey.PublicKey().Bytes()),
+		SigningKey:  base64.StdEncoding.EncodeToString(signKey.Public().(ed25519.PublicKey)),
 		Agents:      agents,
 		Skills:      skills,
 		Labels:      labels,
@@ -1465,7 +1544,10 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 				authTTL = d
 			}
 		}
-		reclaimEggSessions(rctx, cfg, client, allowedKeys, passkeyCache, authTTL)
+		wingToolsMu.Lock()
+		tools := append([]*config.ToolConfig{}, wingTools...)
+		wingToolsMu.Unlock()
+		reclaimEggSessions(rctx, cfg, client, allowedKeys, passkeyCache, authTTL, tools)
 	}
 
 	// SIGHUP reload goroutine — caller owns SIGTERM/SIGINT via ctx cancellation
@@ -1487,6 +1569,7 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 					}
 					wingCfg.Locked = newCfg.Locked
 					wingCfg.Spectate = newCfg.Spectate
+					wingCfg.ForwardPorts = newCfg.ForwardPorts
 					wingCfg.AllowKeys = newCfg.AllowKeys
 					wingCfg.Admins = newCfg.Admins
 					allowedKeys = append([]config.AllowKey{}, newCfg.AllowKeys...)
@@ -1501,6 +1584,7 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 					wingCfg.Conv = newCfg.Conv
 					wingCfg.AuthTTL = newCfg.AuthTTL
 					wingCfg.IdleTimeout = newCfg.IdleTimeout
+					wingCfg.Notarize = newCfg.Notarize
 
 					// Hot-reload labels
 					wingCfg.Labels = newCfg.Labels
@@ -1509,6 +1593,7 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 					// Hot-reload paths
 					wingCfg.Paths = newCfg.Paths
 					resolvedPaths = resolvePathStrings(newCfg.Paths.Strings(), home)
+					projectIdx.SetRoots(projectRoots(resolvedPaths))
 					if len(resolvedPaths) > 0 {
 						client.RootDir = resolvedPaths[0]
 					} else {
@@ -1545,6 +1630,7 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 						wingTools = newTools
 						wingToolsMu.Unlock()
 						log.Printf("tools reloaded: %d tool(s) from %s", len(newTools), newToolsDir)
+						checkToolPolicies(newTools)
 					} else {
 						log.Printf("tools reload failed: %v", tErr)
 					}
@@ -1556,6 +1642,21 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 		}
 	}()
 
+	// Partial uploads abandoned by a dropped client (or left by a previous
+	// run) are swept on start and then periodically.
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			sweepUploads(filepath.Join(cfg.Dir, "uploads"))
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
 	// Idle session reaper — kills sessions that have been idle too long.
 	// Always runs; reads wingCfg.IdleTimeout dynamically so SIGHUP reload works.
 	go func() {
@@ -1628,6 +1729,25 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 		log.Printf("idle reaper enabled: timeout=%s", wingCfg.IdleTimeout)
 	}
 
+	// Audit notarization — hands new signed chain heads to the relay so a
+	// later truncation or rewrite of the local audit files is detectable.
+	// Reads wingCfg.Notarize dynamically so SIGHUP reload works.
+	go func() {
+		ticker := time.NewTicker(60 * time.Second)
+		defer ticker.Stop()
+		sent := make(map[string]string) // session ID → last head sent
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if wingCfg.Notarize {
+				notarizeAuditHeads(ctx, cfg, client, sent)
+			}
+		}
+	}()
+
 	// Direct mode: start a local WebSocket server for direct browser connections
 	if wingCfg.ConnectionMode == "direct" && wingCfg.DirectPort > 0 {
 		directSrv := &directpkg.Server{
@@ -1655,6 +1775,8 @@ func runWingWithContext(ctx context.Context, sighupCh <-chan os.Signal, roostFla
 		}()
 	}
 
+	go projectIdx.Run(ctx)
+
 	err = client.Run(ctx)
 	if err != nil {
 		log.Printf("wing daemon exiting: %v", err)
@@ -2464,12 +2586,48 @@ func reapDeadEggs(cfg *config.Config) {
 	}
 }
 
+// notarizeAuditHeads sends the latest signed head of each session's audit
+// chain to the relay, skipping heads already in sent.
+func notarizeAuditHeads(ctx context.Context, cfg *config.Config, client *ws.Client, sent map[string]string) {
+	eggsDir := filepath.Join(cfg.Dir, "eggs")
+	entries, err := os.ReadDir(eggsDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		head, err := egg.ReadChainHead(filepath.Join(eggsDir, e.Name()))
+		if err != nil || head == nil || head.SessionID != e.Name() {
+			continue
+		}
+		key := fmt.Sprintf("%d:%s:%t", head.Seq, head.Head, head.Sealed)
+		if sent[e.Name()] == key {
+			continue
+		}
+		if err := client.SendAuditHead(ctx, ws.AuditHead{
+			SessionID: head.SessionID,
+			Seq:       head.Seq,
+			Head:      head.Head,
+			SignedAt:  head.SignedAt,
+			Sig:       head.Sig,
+			Key:       head.Key,
+			Sealed:    head.Sealed,
+		}); err != nil {
+			return
+		}
+		sent[e.Name()] = key
+	}
+}
+
 // cleanEggDir removes the files in an egg session directory, then the directory itself.
 // If audit files or chat history exist, preserves egg.meta, egg.owner, and data (only removes runtime files).
 func cleanEggDir(dir string) {
 	os.Remove(filepath.Join(dir, "egg.sock"))
 	os.Remove(filepath.Join(dir, "egg.token"))
 	os.Remove(filepath.Join(dir, "egg.pid"))
+	os.Remove(filepath.Join(dir, sessionPortsFile))
 	// Preserve egg.log — the parent process reads it via readEggCrashInfo
 	// after this child exits. Deleting it here causes a race where the
 	// crash message is lost ("egg process crashed (no log available)").
@@ -2536,8 +2694,9 @@ func listAliveEggSessions(cfg *config.Config) []ws.SessionInfo {
 			UserID:    readEggOwner(dir),
 			Email:     readEggOwnerEmail(dir),
 		}
-		if _, ok := wingAttention.Load(sessionID); ok {
+		if kind, ok := wingAttention.Load(sessionID); ok {
 			info.NeedsAttention = true
+			info.AttentionKind = kind.(string)
 		}
 		// Check if audit recording exists
 		if _, err := os.Stat(filepath.Join(dir, "audit.pty.gz")); err == nil {
@@ -2630,7 +2789,7 @@ func readEggCrashInfo(dir string) string {
 // reclaimEggSessions discovers surviving egg sessions and re-registers their
 // input routing goroutines. The relay no longer tracks sessions — browser
 // discovers them via E2E tunnel and reattaches directly via wing_id.
-func reclaimEggSessions(ctx context.Context, cfg *config.Config, wsClient *ws.Client, allowedKeys []config.AllowKey, passkeyCache *auth.AuthCache, authTTL time.Duration) {
+func reclaimEggSessions(ctx context.Context, cfg *config.Config, wsClient *ws.Client, allowedKeys []config.AllowKey, passkeyCache *auth.AuthCache, authTTL time.Duration, tools []*config.ToolConfig) {
 	// Small delay to let registration complete
 	time.Sleep(500 * time.Millisecond)
 
@@ -2690,14 +2849,20 @@ func reclaimEggSessions(ctx context.Context, cfg *config.Config, wsClient *ws.Cl
 		go func(sid string, ec *egg.Client, dir string) {
 			defer cleanup()
 			defer ec.Close()
-			handleReclaimedPTY(ctx, cfg, ec, sid, dir, write, input, allowedKeys, passkeyCache, authTTL)
+			handleReclaimedPTY(ctx, cfg, ec, sid, dir, write, input, allowedKeys, passkeyCache, authTTL, tools)
 		}(sessionID, ec, dir)
 	}
 }
 
 // handleReclaimedPTY sets up I/O routing for a reclaimed (surviving) egg session.
-func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client, sessionID, eggDir string, write ws.PTYWriteFunc, input <-chan []byte, allowedKeys []config.AllowKey, passkeyCache *auth.AuthCache, authTTL time.Duration) {
+// tools are the wing's current tools, served again on the session's tool
+// socket if it was started with any.
+func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client, sessionID, eggDir string, write ws.PTYWriteFunc, input <-chan []byte, allowedKeys []config.AllowKey, passkeyCache *auth.AuthCache, authTTL time.Duration, tools []*config.ToolConfig) {
 	reclaimAgent, reclaimCWD := readEggMeta(eggDir)
+	// Screen-aware attention detection; dimensions catch up on the first resize
+	detector := egg.NewAttentionDetector(reclaimAgent, 0, 0)
+	defer detector.Close()
+	var replyNeedsPasskey bool // last attached user has a passkey; quick replies need a token
 	var mu sync.Mutex
 	var gcm cipher.AEAD
 	var activeStream pb.Egg_SessionClient
@@ -2710,6 +2875,29 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 	}
 	wingPubKeyB64 := base64.StdEncoding.EncodeToString(privKey.PublicKey().Bytes())
 
+	// The tool socket died with the previous wing process; serve it again
+	// under a fresh approval gate so gated calls still reach the owner.
+	controller := readEggOwnerEmail(eggDir) // attached browser user; guarded by mu
+	if controller == "" {
+		controller = readEggOwner(eggDir)
+	}
+	var toolGate *toolApprovalGate
+	if _, err := os.Stat(filepath.Join(eggDir, ".tools")); err == nil && len(tools) > 0 {
+		toolGate = newToolApprovalGate(sessionID, reclaimAgent, reclaimCWD, &mu, &gcm, write)
+		var audit func(string)
+		if _, err := os.Stat(filepath.Join(eggDir, "audit.log")); err == nil {
+			audit = toolDecisionAuditor(sessionID, func() *egg.Client { return ec })
+		}
+		_, _, closeTools, tlErr := listenSessionTools(cfg, sessionID, tools, toolGate, audit, controller)
+		if tlErr != nil {
+			log.Printf("pty session %s: reclaim tool listener failed: %v", sessionID, tlErr)
+			toolGate = nil
+		} else {
+			defer closeTools()
+			log.Printf("pty session %s: tool listener restarted (%d tools)", sessionID, len(tools))
+		}
+	}
+
 	// Register idle state tracking (reclaimed — starts disconnected)
 	reclaimIdleState := &sessionIdleState{
 		lastOutput: time.Now(),
@@ -2718,6 +2906,8 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 	}
 	sessionStates.Store(sessionID, reclaimIdleState)
 	defer sessionStates.Delete(sessionID)
+	wingIndex.Touch(sessionID)
+	defer wingIndex.Touch(sessionID)
 
 	// Attach to existing egg session
 	streamCtx, sCancel := context.WithCancel(ctx)
@@ -2735,7 +2925,6 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 
 	// Read output from egg -> encrypt -> send to relay
 	go func() {
-		var lastHadBell bool
 		for {
 			msg, err := stream.Recv()
 			if err != nil {
@@ -2749,13 +2938,11 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 				reclaimIdleState.mu.Lock()
 				reclaimIdleState.lastOutput = time.Now()
 				reclaimIdleState.mu.Unlock()
-				if hasBell(p.Output) {
-					if lastHadBell {
-						checkAndSendAttention(sessionID, reclaimAgent, reclaimCWD, write)
+				if ev, ok := detector.Feed(p.Output); ok {
+					checkAndSendAttention(sessionID, reclaimAgent, reclaimCWD, ev.Kind, write)
+					if ev.Replyable() {
+						offerAttentionReply(sessionID, ev, &mu, &gcm, write)
 					}
-					lastHadBell = true
-				} else {
-					lastHadBell = false
 				}
 				mu.Lock()
 				currentGCM := gcm
@@ -2888,6 +3075,8 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 					}
 				}
 
+				replyNeedsPasskey = attachUserHasPasskey
+
 				// 1. Invalidate key — old output goroutine stops sending
 				mu.Lock()
 				gcm = nil
@@ -2920,6 +3109,7 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 				// 4. Resize egg to browser dimensions before snapshot
 				if attach.Cols > 0 && attach.Rows > 0 {
 					ec.Resize(ctx, sessionID, attach.Rows, attach.Cols)
+					detector.Resize(int(attach.Cols), int(attach.Rows))
 					time.Sleep(150 * time.Millisecond) // let agent repaint for new dimensions before VTE snapshot
 				}
 
@@ -2947,10 +3137,20 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 				gcm = newGCM
 				activeStream = newStream
 				cancelStream = newSCancel
+				if who := attachUser(attach); who != "" {
+					controller = who
+				}
 				mu.Unlock()
 
+				// Re-offer a prompt still waiting on screen under the new key
+				if ev, ok := detector.Pending(); ok {
+					offerAttentionReply(sessionID, ev, &mu, &gcm, write)
+				}
+				if toolGate != nil {
+					toolGate.offerPending()
+				}
+
 				go func() {
-					var lastHadBell bool
 					for {
 						msg, err := newStream.Recv()
 						if err != nil {
@@ -2964,13 +3164,11 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 							reclaimIdleState.mu.Lock()
 							reclaimIdleState.lastOutput = time.Now()
 							reclaimIdleState.mu.Unlock()
-							if hasBell(p.Output) {
-								if lastHadBell {
-									checkAndSendAttention(sessionID, reclaimAgent, reclaimCWD, write)
+							if ev, ok := detector.Feed(p.Output); ok {
+								checkAndSendAttention(sessionID, reclaimAgent, reclaimCWD, ev.Kind, write)
+								if ev.Replyable() {
+									offerAttentionReply(sessionID, ev, &mu, &gcm, write)
 								}
-								lastHadBell = true
-							} else {
-								lastHadBell = false
 							}
 							mu.Lock()
 							currentGCM := gcm
@@ -3010,11 +3208,35 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 				if decErr != nil {
 					continue
 				}
+				detector.NoteInput(decoded)
 				currentStream.Send(&pb.SessionMsg{SessionId: sessionID, Payload: &pb.SessionMsg_Input{Input: decoded}})
 
 			case ws.TypePTYAttentionAck:
 				clearAttentionCooldown(sessionID)
 
+			case ws.TypePTYAttentionReply:
+				mu.Lock()
+				currentGCM := gcm
+				currentStream := activeStream
+				from := controller
+				mu.Unlock()
+				nonce, choice, replyErr := decodeAttentionReply(data, currentGCM, replyNeedsPasskey, passkeyCache, authTTL)
+				if replyErr != nil {
+					log.Printf("pty session %s: attention reply rejected: %v", sessionID, replyErr)
+					continue
+				}
+				if toolGate != nil && toolGate.answer(nonce, choice, replySender(data, from)) {
+					clearAttentionCooldown(sessionID)
+					continue
+				}
+				keys, replyErr := attentionReplyKeys(detector, nonce, choice)
+				if replyErr != nil || currentStream == nil {
+					log.Printf("pty session %s: attention reply rejected: %v", sessionID, replyErr)
+					continue
+				}
+				clearAttentionCooldown(sessionID)
+				currentStream.Send(&pb.SessionMsg{SessionId: sessionID, Payload: &pb.SessionMsg_Input{Input: keys}})
+
 			case ws.TypePTYResize:
 				var msg ws.PTYResize
 				if err := json.Unmarshal(data, &msg); err != nil {
@@ -3026,6 +3248,7 @@ func handleReclaimedPTY(ctx context.Context, cfg *config.Config, ec *egg.Client,
 				if currentStream != nil {
 					currentStream.Send(&pb.SessionMsg{SessionId: sessionID, Payload: &pb.SessionMsg_Resize{Resize: &pb.Resize{Rows: uint32(msg.Rows), Cols: uint32(msg.Cols)}}})
 				}
+				detector.Resize(msg.Cols, msg.Rows)
 
 			case ws.TypePTYKill:
 				log.Printf("pty session %s: kill received", sessionID)
@@ -3180,6 +3403,7 @@ authDone:
 	var gcm cipher.AEAD
 	var activeStream pb.Egg_SessionClient
 	var cancelStream context.CancelFunc
+	controller := sessionUser(start) // attached browser user; guarded by mu
 	var wingPubKeyB64 string
 	privKey, privKeyErr := auth.LoadPrivateKey(cfg.Dir)
 	if privKeyErr != nil {
@@ -3200,26 +3424,30 @@ authDone:
 	}
 
 	// Start tool socket listener if tools are configured
-	var toolListener *egg.ToolListener
+	var toolGate *toolApprovalGate
 	var toolSocketPath string
 	var toolNames []string
+	var auditEgg atomic.Pointer[egg.Client] // set once the egg is up
 	if len(tools) > 0 {
-		eggDir := filepath.Join(cfg.Dir, "eggs", start.SessionID)
-		toolsDir := filepath.Join(eggDir, ".tools")
-		os.MkdirAll(toolsDir, 0700)
-		toolSocketPath = filepath.Join(toolsDir, "tool.sock")
-		var tlErr error
-		toolListener, tlErr = egg.NewToolListener(toolSocketPath, tools)
+		// Tools with approval: first/always wait on the owner's browser.
+		// Decisions go into the session's chained audit log, outside the
+		// .tools dir the sandbox can see.
+		toolGate = newToolApprovalGate(start.SessionID, start.Agent, start.CWD, &mu, &gcm, write)
+		var audit func(string)
+		if eggCfg.Audit {
+			audit = toolDecisionAuditor(start.SessionID, auditEgg.Load)
+		}
+		_, sockPath, closeTools, tlErr := listenSessionTools(cfg, start.SessionID, tools, toolGate, audit, sessionUser(start))
 		if tlErr != nil {
 			log.Printf("pty session %s: tool listener failed: %v", start.SessionID, tlErr)
+			toolGate = nil
 		} else {
+			defer closeTools()
+			toolSocketPath = sockPath
 			toolNames = config.ToolNames(tools)
 			log.Printf("pty session %s: tool listener started (%d tools)", start.SessionID, len(toolNames))
 		}
 	}
-	if toolListener != nil {
-		defer toolListener.Close()
-	}
 
 	// Spawn a per-session egg
 	ec, err := spawnEgg(cfg, start.SessionID, start.Agent, eggCfg, uint32(start.Rows), uint32(start.Cols), start.CWD, debug, vte, eggCfg.Trace, EggIdentity{UserID: start.UserID, Email: start.Email, DisplayName: start.DisplayName, OrgWing: wingCfg.Org != ""}, idleTimeout, spawnEggOpts{ToolNames: toolNames, ToolSocketPath: toolSocketPath})
@@ -3237,6 +3465,7 @@ authDone:
 		return
 	}
 	defer ec.Close()
+	auditEgg.Store(ec)
 
 	log.Printf("pty session %s: spawned (user=%s agent=%s)", start.SessionID, start.UserID, start.Agent)
 
@@ -3249,6 +3478,12 @@ authDone:
 	}
 	sessionStates.Store(start.SessionID, idleState)
 	defer sessionStates.Delete(start.SessionID)
+	wingIndex.Touch(start.SessionID)
+	defer wingIndex.Touch(start.SessionID)
+
+	// Screen-aware attention detection (permission prompts, errors, prompt return)
+	detector := egg.NewAttentionDetector(start.Agent, start.Cols, start.Rows)
+	defer detector.Close()
 
 	// Persist session creator
 	if start.UserID != "" {
@@ -3260,6 +3495,13 @@ authDone:
 		os.WriteFile(ownerPath, []byte(ownerData), 0644)
 	}
 
+	// Ports the preview panel may reach through tunnel.http / tunnel.ws
+	if len(eggCfg.Ports) > 0 {
+		if err := writeSessionPorts(filepath.Join(cfg.Dir, "eggs", start.SessionID), eggCfg.Ports); err != nil {
+			log.Printf("pty session %s: record ports: %v", start.SessionID, err)
+		}
+	}
+
 	// Notify browser
 	write(ws.PTYStarted{
 		Type:      ws.TypePTYStarted,
@@ -3295,7 +3537,6 @@ authDone:
 
 	// Read output from egg -> encrypt -> send to browser
 	go func() {
-		var lastHadBell bool
 		for {
 			msg, err := stream.Recv()
 			if err != nil {
@@ -3310,13 +3551,11 @@ authDone:
 				idleState.mu.Lock()
 				idleState.lastOutput = time.Now()
 				idleState.mu.Unlock()
-				if hasBell(p.Output) {
-					if lastHadBell {
-						checkAndSendAttention(start.SessionID, start.Agent, start.CWD, write)
+				if ev, ok := detector.Feed(p.Output); ok {
+					checkAndSendAttention(start.SessionID, start.Agent, start.CWD, ev.Kind, write)
+					if ev.Replyable() {
+						offerAttentionReply(start.SessionID, ev, &mu, &gcm, write)
 					}
-					lastHadBell = true
-				} else {
-					lastHadBell = false
 				}
 
 				mu.Lock()
@@ -3461,6 +3700,7 @@ authDone:
 				// 4. Resize egg to browser dimensions before snapshot
 				if attach.Cols > 0 && attach.Rows > 0 {
 					ec.Resize(ctx, start.SessionID, attach.Rows, attach.Cols)
+					detector.Resize(int(attach.Cols), int(attach.Rows))
 					time.Sleep(150 * time.Millisecond) // let agent repaint for new dimensions before VTE snapshot
 				}
 
@@ -3488,10 +3728,20 @@ authDone:
 				gcm = newGCM
 				activeStream = newStream
 				cancelStream = newSCancel
+				if who := attachUser(attach); who != "" {
+					controller = who
+				}
 				mu.Unlock()
 
+				// Re-offer a prompt still waiting on screen under the new key
+				if ev, ok := detector.Pending(); ok {
+					offerAttentionReply(start.SessionID, ev, &mu, &gcm, write)
+				}
+				if toolGate != nil {
+					toolGate.offerPending()
+				}
+
 				go func() {
-					var lastHadBell bool
 					for {
 						msg, err := newStream.Recv()
 						if err != nil {
@@ -3505,13 +3755,11 @@ authDone:
 							idleState.mu.Lock()
 							idleState.lastOutput = time.Now()
 							idleState.mu.Unlock()
-							if hasBell(p.Output) {
-								if lastHadBell {
-									checkAndSendAttention(start.SessionID, start.Agent, start.CWD, write)
+							if ev, ok := detector.Feed(p.Output); ok {
+								checkAndSendAttention(start.SessionID, start.Agent, start.CWD, ev.Kind, write)
+								if ev.Replyable() {
+									offerAttentionReply(start.SessionID, ev, &mu, &gcm, write)
 								}
-								lastHadBell = true
-							} else {
-								lastHadBell = false
 							}
 							mu.Lock()
 							currentGCM := gcm
@@ -3552,6 +3800,7 @@ authDone:
 					log.Printf("pty session %s: decrypt error: %v", start.SessionID, decErr)
 					continue
 				}
+				detector.NoteInput(decoded)
 				currentStream.Send(&pb.SessionMsg{
 					SessionId: start.SessionID,
 					Payload:   &pb.SessionMsg_Input{Input: decoded},
@@ -3560,6 +3809,34 @@ authDone:
 			case ws.TypePTYAttentionAck:
 				clearAttentionCooldown(start.SessionID)
 
+			case ws.TypePTYAttentionReply:
+				mu.Lock()
+				currentGCM := gcm
+				currentStream := activeStream
+				mu.Unlock()
+				nonce, choice, replyErr := decodeAttentionReply(data, currentGCM, userHasPasskey, passkeyCache, authTTL)
+				if replyErr != nil {
+					log.Printf("pty session %s: attention reply rejected: %v", start.SessionID, replyErr)
+					continue
+				}
+				mu.Lock()
+				from := controller
+				mu.Unlock()
+				if toolGate != nil && toolGate.answer(nonce, choice, replySender(data, from)) {
+					clearAttentionCooldown(start.SessionID)
+					continue
+				}
+				keys, replyErr := attentionReplyKeys(detector, nonce, choice)
+				if replyErr != nil || currentStream == nil {
+					log.Printf("pty session %s: attention reply rejected: %v", start.SessionID, replyErr)
+					continue
+				}
+				clearAttentionCooldown(start.SessionID)
+				currentStream.Send(&pb.SessionMsg{
+					SessionId: start.SessionID,
+					Payload:   &pb.SessionMsg_Input{Input: keys},
+				})
+
 			case ws.TypePTYResize:
 				var msg ws.PTYResize
 				if err := json.Unmarshal(data, &msg); err != nil {
@@ -3577,6 +3854,7 @@ authDone:
 						}},
 					})
 				}
+				detector.Resize(msg.Cols, msg.Rows)
 
 			case ws.TypePTYMigrate:
 				if sw == nil {
@@ -3633,11 +3911,32 @@ type tunnelInner struct {
 	YAML      string `json:"yaml,omitempty"`
 	Offset    int    `json:"offset,omitempty"`
 	Limit     int    `json:"limit,omitempty"`
+	Query     string `json:"query,omitempty"` // for sessions.search
 	AuthToken string `json:"auth_token,omitempty"`
 	Key         string `json:"key,omitempty"` // passkey public key for allow.add
 	AllowUserID string `json:"allow_user_id,omitempty"` // target user_id for allow.remove
 	SDP         string `json:"sdp,omitempty"`            // WebRTC SDP for webrtc.offer
 
+	// File fields (for file.write / file.upload; Offset is the upload offset)
+	Data     string `json:"data,omitempty"`      // file.write: text; file.upload: base64 chunk
+	UploadID string `json:"upload_id,omitempty"` // file.upload: client-chosen hex ID
+	Done     bool   `json:"done,omitempty"`      // file.upload: last chunk
+
+	// Git fields (for git.*; Path is a directory in the repo, Limit caps git.log)
+	Files   []string `json:"files,omitempty"`   // git.diff / git.log / git.commit: limit to these (repo-relative)
+	Staged  bool     `json:"staged,omitempty"`  // git.diff: index instead of working tree
+	Message string   `json:"message,omitempty"` // git.commit / git.stash push
+	Action  string   `json:"action,omitempty"`  // git.stash: push, pop or list
+
+	// Port forwarding fields (for tunnel.http / tunnel.ws / tunnel.ws.send;
+	// Path is the request path, Data the base64 body or frame, Offset the
+	// frame's sequence number)
+	Port    int               `json:"port,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	WSID    string            `json:"ws_id,omitempty"`
+	Binary  bool              `json:"binary,omitempty"`
+
 	// Path ACL fields (for paths.set / paths.add_member / paths.remove_member)
 	Paths   []config.PathEntry `json:"paths,omitempty"`   // for paths.set (bulk replace)
 	Members []string           `json:"members,omitempty"` // for paths.set on a single path
@@ -3924,8 +4223,106 @@ func handleTunnelRequest(ctx context.Context, cfg *config.Config, wingCfg *confi
 		entries := getDirEntries(inner.Path, userPaths)
 		tunnelRespond(gcm, req.RequestID, map[string]any{"entries": entries}, write)
 
+	case "file.stat", "file.read", "file.write", "file.download", "file.upload":
+		if (inner.Type == "file.write" || inner.Type == "file.upload") && isMemberFiltered(req) {
+			log.Printf("tunnel %s: denied %s %s (user=%s)", req.RequestID, inner.Type, inner.Path, req.SenderUserID)
+			tunnelRespond(gcm, req.RequestID, map[string]string{"error": "admin required"}, write)
+			return
+		}
+		userPaths := pathsForRequest(wingCfg.Paths, req.SenderEmail, req.SenderOrgRole, home)
+		path, err := resolveFilePath(inner.Path, userPaths, isMemberFiltered(req), home)
+		if err != nil {
+			if err == errFileAccess {
+				log.Printf("tunnel %s: denied %s %s (user=%s)", req.RequestID, inner.Type, inner.Path, req.SenderUserID)
+			}
+			tunnelRespond(gcm, req.RequestID, map[string]string{"error": err.Error()}, write)
+			return
+		}
+		var result any
+		switch inner.Type {
+		case "file.stat":
+			result, err = fileStat(path)
+		case "file.read":
+			result, err = fileRead(path)
+		case "file.write":
+			var info ws.FileInfo
+			info, err = fileWrite(path, inner.Data)
+			result = map[string]any{"file": info}
+		case "file.download":
+			streamFileDownload(path, gcm, req.RequestID, write)
+			return
+		case "file.upload":
+			result, err = fileUploadChunk(filepath.Join(cfg.Dir, "uploads"), path, inner.UploadID, int64(inner.Offset), inner.Data, inner.Done)
+		}
+		if err != nil {
+			tunnelRespond(gcm, req.RequestID, map[string]string{"error": err.Error()}, write)
+			return
+		}
+		if inner.Type == "file.write" || inner.Done {
+			log.Printf("tunnel %s: wrote %s (user=%s)", req.RequestID, path, req.SenderUserID)
+		}
+		tunnelRespond(gcm, req.RequestID, result, write)
+
+	case "git.status", "git.diff", "git.log", "git.commit", "git.stash":
+		userPaths := pathsForRequest(wingCfg.Paths, req.SenderEmail, req.SenderOrgRole, home)
+		dir, err := resolveFilePath(inner.Path, userPaths, isMemberFiltered(req), home)
+		if err == nil {
+			dir, err = gitRepoRoot(dir, userPaths, isMemberFiltered(req), home)
+		}
+		if err != nil {
+			if err == errFileAccess {
+				log.Printf("tunnel %s: denied %s %s (user=%s)", req.RequestID, inner.Type, inner.Path, req.SenderUserID)
+			}
+			tunnelRespond(gcm, req.RequestID, map[string]string{"error": err.Error()}, write)
+			return
+		}
+		var result map[string]any
+		switch inner.Type {
+		case "git.status":
+			result, err = gitStatus(dir)
+		case "git.diff":
+			result, err = gitDiff(dir, inner.Files, inner.Staged)
+		case "git.log":
+			result, err = gitLog(dir, inner.Files, inner.Limit)
+		case "git.commit":
+			result, err = gitCommit(dir, inner.Message, inner.Files)
+			if err == nil {
+				log.Printf("tunnel %s: committed %s in %s (user=%s)", req.RequestID, result["hash"], dir, req.SenderUserID)
+			}
+		case "git.stash":
+			result, err = gitStash(dir, inner.Action, inner.Message)
+			if err == nil && inner.Action != "list" {
+				log.Printf("tunnel %s: git stash %s in %s (user=%s)", req.RequestID, inner.Action, dir, req.SenderUserID)
+			}
+		}
+		if err != nil {
+			tunnelRespond(gcm, req.RequestID, map[string]string{"error": err.Error()}, write)
+			return
+		}
+		tunnelRespond(gcm, req.RequestID, result, write)
+
+	case "tunnel.http", "tunnel.ws":
+		if err := checkForward(cfg, wingCfg, req, inner.SessionID, inner.Port); err != nil {
+			log.Printf("tunnel %s: denied %s (user=%s session=%s port=%d): %v", req.RequestID, inner.Type, req.SenderUserID, inner.SessionID, inner.Port, err)
+			chunk, _ := json.Marshal(map[string]any{"error": err.Error(), "done": true})
+			tunnelStreamChunk(gcm, req.RequestID, chunk, true, write)
+			return
+		}
+		if inner.Type == "tunnel.http" {
+			streamForwardHTTP(ctx, inner, gcm, req.RequestID, write)
+		} else {
+			streamForwardWS(ctx, inner, req.SenderPub, gcm, req.RequestID, write)
+		}
+
+	case "tunnel.ws.send":
+		if err := forwardWSSend(ctx, inner, req.SenderPub); err != nil {
+			tunnelRespond(gcm, req.RequestID, map[string]string{"error": err.Error()}, write)
+			return
+		}
+		tunnelRespond(gcm, req.RequestID, map[string]bool{"ok": true}, write)
+
 	case "wing.info":
-		projects := client.Projects
+		projects := client.ProjectList()
 		userPaths := pathsForRequest(wingCfg.Paths, req.SenderEmail, req.SenderOrgRole, home)
 		if len(userPaths) > 0 {
 			projects = filterProjectsExact(projects, userPaths)
@@ -4025,6 +4422,25 @@ func handleTunnelRequest(ctx context.Context, cfg *config.Config, wingCfg *confi
 		}
 		tunnelRespond(gcm, req.RequestID, map[string]any{"sessions": sessions, "total": total}, write)
 
+	case "sessions.search":
+		limit := inner.Limit
+		if limit <= 0 || limit > maxSearchHits {
+			limit = 20
+		}
+		var visible func(sessionSearchHit) bool
+		if isMemberFiltered(req) {
+			userPaths := pathsForRequest(wingCfg.Paths, req.SenderEmail, req.SenderOrgRole, home)
+			visible = func(h sessionSearchHit) bool {
+				return canSeeSession(req, h.UserID) && (len(userPaths) == 0 || isUnderPaths(h.CWD, userPaths))
+			}
+		}
+		hits, err := wingIndex.Search(cfg, inner.Query, limit, visible)
+		if err != nil {
+			tunnelRespond(gcm, req.RequestID, map[string]string{"error": err.Error()}, write)
+			return
+		}
+		tunnelRespond(gcm, req.RequestID, map[string]any{"hits": hits}, write)
+
 	case "audit.request":
 		if inner.SessionID != "" && isMemberFiltered(req) {
 			owner := readEggOwner(filepath.Join(cfg.Dir, "eggs", inner.SessionID))
@@ -4483,96 +4899,22 @@ func streamAuditData(cfg *config.Config, sessionID, kind string, gcm cipher.AEAD
 		return
 	}
 
-	// Decompress gzip and stream as asciinema v2 NDJSON
-	// Tolerate incomplete gzip from live sessions (writer still open)
-	gr, gzErr := gzip.NewReader(bytes.NewReader(data))
-	if gzErr != nil {
-		tunnelRespond(gcm, requestID, map[string]string{"error": "decompress: " + gzErr.Error()}, write)
-		return
-	}
-	raw, readErr := io.ReadAll(gr)
-	gr.Close()
-	if readErr != nil && len(raw) == 0 {
-		tunnelRespond(gcm, requestID, map[string]string{"error": "read: " + readErr.Error()}, write)
+	// Decode the audit stream and re-emit it as asciinema v2 NDJSON with
+	// base64 output (the browser player decodes the bytes itself)
+	rec, err := egg.ReadAuditRecording(dir)
+	if err != nil {
+		tunnelRespond(gcm, requestID, map[string]string{"error": err.Error()}, write)
 		return
 	}
-
-	// Read terminal dimensions from egg.meta
-	cols, rows := 120, 40
-	if meta, metaErr := os.ReadFile(filepath.Join(dir, "egg.meta")); metaErr == nil {
-		for _, line := range strings.Split(string(meta), "\n") {
-			if strings.HasPrefix(line, "cols=") {
-				if v, pErr := strconv.Atoi(strings.TrimPrefix(line, "cols=")); pErr == nil && v > 0 {
-					cols = v
-				}
-			}
-			if strings.HasPrefix(line, "rows=") {
-				if v, pErr := strconv.Atoi(strings.TrimPrefix(line, "rows=")); pErr == nil && v > 0 {
-					rows = v
-				}
-			}
-		}
-	}
-
-	// Convert varint format to asciinema v2 NDJSON
-	isV2 := len(raw) >= 4 && string(raw[:4]) == "WTA2"
-	pos := 0
-	if isV2 {
-		pos = 4
-		if v, n := readVarint(raw[pos:]); n > 0 {
-			cols = int(v)
-			pos += n
-		}
-		if v, n := readVarint(raw[pos:]); n > 0 {
-			rows = int(v)
-			pos += n
-		}
-	}
-	var cumulativeMs int64
 	var ndjson strings.Builder
-	fmt.Fprintf(&ndjson, `{"version":2,"width":%d,"height":%d}`, cols, rows)
+	fmt.Fprintf(&ndjson, `{"version":2,"width":%d,"height":%d}`, rec.Cols, rec.Rows)
 	ndjson.WriteByte('\n')
-	for pos < len(raw) {
-		deltaMs, n := readVarint(raw[pos:])
-		if n <= 0 {
-			break
-		}
-		pos += n
-
-		var frameType int64
-		if isV2 {
-			frameType, n = readVarint(raw[pos:])
-			if n <= 0 {
-				break
-			}
-			pos += n
-		}
-
-		dataLen, n := readVarint(raw[pos:])
-		if n <= 0 {
-			break
-		}
-		pos += n
-		if pos+int(dataLen) > len(raw) {
-			break
-		}
-		chunk := raw[pos : pos+int(dataLen)]
-		pos += int(dataLen)
-		cumulativeMs += deltaMs
-
-		if frameType == 1 {
-			rCols, cn := readVarint(chunk)
-			if cn <= 0 {
-				continue
-			}
-			rRows, rn := readVarint(chunk[cn:])
-			if rn <= 0 {
-				continue
-			}
-			fmt.Fprintf(&ndjson, "[%.3f,\"r\",\"%dx%d\"]\n", float64(cumulativeMs)/1000.0, rCols, rRows)
+	for _, f := range rec.Frames {
+		ts := f.At.Seconds()
+		if f.Type == egg.AuditFrameResize {
+			fmt.Fprintf(&ndjson, "[%.3f,\"r\",\"%dx%d\"]\n", ts, f.Cols, f.Rows)
 		} else {
-			escaped := base64.StdEncoding.EncodeToString(chunk)
-			fmt.Fprintf(&ndjson, "[%.3f,\"o\",\"%s\"]\n", float64(cumulativeMs)/1000.0, escaped)
+			fmt.Fprintf(&ndjson, "[%.3f,\"o\",\"%s\"]\n", ts, base64.StdEncoding.EncodeToString(f.Data))
 		}
 	}
 
@@ -4589,20 +4931,3 @@ func streamAuditData(cfg *config.Config, sessionID, kind string, gcm cipher.AEAD
 	}
 	tunnelStreamChunk(gcm, requestID, []byte(`{"done":true}`), true, write)
 }
-
-// readVarint reads a varint from buf, returns (value, bytes consumed).
-func readVarint(buf []byte) (int64, int) {
-	var x int64
-	var s uint
-	for i, b := range buf {
-		if i >= 10 {
-			return 0, 0
-		}
-		if b < 0x80 {
-			return x | int64(b)<<s, i + 1
-		}
-		x |= int64(b&0x7f) << s
-		s += 7
-	}
-	return 0, 0
-}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ehrlich-b/wingthing/internal/ws"
+)
+
+// errFileAccess is returned for paths outside what the sender may touch. It
+// doesn't say whether the path exists.
+var errFileAccess = errors.New("access denied")
+
+// resolveFilePath turns a requested path into an absolute, symlink-free path
+// the sender may access. userPaths are the sender's paths from
+// pathsForRequest; members with none get no file access, owners and admins
+// with none are unrestricted (as with dir.list). The last component may not
+// exist yet (file.write, file.upload).
+func resolveFilePath(path string, userPaths []string, member bool, home string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("missing path")
+	}
+	if path == "~" {
+		path = home
+	} else if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(home, path[2:])
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path must be absolute")
+	}
+	path = filepath.Clean(path)
+
+	// Resolve symlinks so a link inside a shared path can't reach outside it
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		var dir string
+		dir, err = filepath.EvalSymlinks(filepath.Dir(path))
+		resolved = filepath.Join(dir, filepath.Base(path))
+	}
+	if err != nil {
+		if len(userPaths) > 0 || member {
+			return "", errFileAccess
+		}
+		return "", err
+	}
+
+	if len(userPaths) == 0 {
+		if member {
+			return "", errFileAccess
+		}
+		return resolved, nil
+	}
+	allowed := make([]string, 0, len(userPaths))
+	for _, p := range userPaths {
+		if rp, err := filepath.EvalSymlinks(p); err == nil {
+			p = rp
+		}
+		allowed = append(allowed, p)
+	}
+	if !isUnderPaths(resolved, allowed) {
+		return "", errFileAccess
+	}
+	return resolved, nil
+}
+
+// looksBinary sniffs the start of a file: NUL bytes or invalid UTF-8 mean
+// binary. A rune cut off at the end of the sample doesn't count.
+func looksBinary(sample []byte) bool {
+	if len(sample) > 8192 {
+		sample = sample[:8192]
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+		sample = sample[:len(sample)-1]
+	}
+	return !utf8.Valid(sample)
+}
+
+func fileInfo(path string, fi os.FileInfo) ws.FileInfo {
+	info := ws.FileInfo{
+		Name:    fi.Name(),
+		Path:    path,
+		Size:    fi.Size(),
+		Mode:    uint32(fi.Mode().Perm()),
+		ModTime: fi.ModTime().Unix(),
+		IsDir:   fi.IsDir(),
+	}
+	if fi.Mode().IsRegular() {
+		if f, err := os.Open(path); err == nil {
+			sample := make([]byte, 8192)
+			n, _ := io.ReadFull(f, sample)
+			f.Close()
+			info.Binary = looksBinary(sample[:n])
+		}
+	}
+	return info
+}
+
+// fileStat handles file.stat.
+func fileStat(path string) (ws.FileInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ws.FileInfo{}, err
+	}
+	return fileInfo(path, fi), nil
+}
+
+// fileRead handles file.read: the whole of a text file up to
+// ws.FileReadLimit. Binary and larger files are described, not returned;
+// use file.download for those.
+func fileRead(path string) (map[string]any, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	info := fileInfo(path, fi)
+	resp := map[string]any{"file": info}
+	if info.Binary {
+		return resp, nil
+	}
+	if info.Size > ws.FileReadLimit {
+		resp["too_large"] = true
+		return resp, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	resp["content"] = string(data)
+	return resp, nil
+}
+
+// fileWrite handles file.write: replaces a text file atomically, keeping its
+// permissions (0644 for new files).
+func fileWrite(path, content string) (ws.FileInfo, error) {
+	if len(content) > ws.FileReadLimit {
+		return ws.FileInfo{}, fmt.Errorf("content exceeds %s", humanBytes(ws.FileReadLimit))
+	}
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		if !fi.Mode().IsRegular() {
+			return ws.FileInfo{}, fmt.Errorf("not a regular file")
+		}
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".wt-*")
+	if err != nil {
+		return ws.FileInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return ws.FileInfo{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return ws.FileInfo{}, err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return ws.FileInfo{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return ws.FileInfo{}, err
+	}
+	return fileStat(path)
+}
+
+// streamFileDownload handles file.download: the file as base64 chunks of
+// ws.FileDownloadChunk bytes, then {"done":true,"file":...}.
+func streamFileDownload(path string, gcm cipher.AEAD, requestID string, write ws.PTYWriteFunc) {
+	f, err := os.Open(path)
+	if err != nil {
+		tunnelRespond(gcm, requestID, map[string]string{"error": err.Error()}, write)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		tunnelRespond(gcm, requestID, map[string]string{"error": "not a regular file"}, write)
+		return
+	}
+	if fi.Size() > ws.FileTransferLimit {
+		tunnelRespond(gcm, requestID, map[string]string{"error": fmt.Sprintf("file exceeds %s", humanBytes(ws.FileTransferLimit))}, write)
+		return
+	}
+	buf := make([]byte, ws.FileDownloadChunk)
+	var sent int64
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			chunk, _ := json.Marshal(map[string]any{"data": base64.StdEncoding.EncodeToString(buf[:n]), "offset": sent})
+			tunnelStreamChunk(gcm, requestID, chunk, false, write)
+			sent += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			chunk, _ := json.Marshal(map[string]any{"error": err.Error(), "done": true})
+			tunnelStreamChunk(gcm, requestID, chunk, true, write)
+			return
+		}
+	}
+	info := fileInfo(path, fi)
+	info.Size = sent
+	chunk, _ := json.Marshal(map[string]any{"done": true, "file": info})
+	tunnelStreamChunk(gcm, requestID, chunk, true, write)
+}
+
+// uploadStaleAfter is how long a partial upload may sit without a new chunk
+// before sweepUploads removes it.
+const uploadStaleAfter = 15 * time.Minute
+
+// fileUploadChunk handles one file.upload request. Chunks go to a hidden
+// temp file next to the target, keyed by the client's upload ID, and must
+// arrive in order; the last one (done) moves it into place. Any error drops
+// the partial upload. While an upload is in flight, a marker in uploadsDir
+// records where its temp file lives so sweepUploads can find it if the
+// client never finishes.
+func fileUploadChunk(uploadsDir, path, uploadID string, offset int64, data string, done bool) (map[string]any, error) {
+	if len(uploadID) < 16 || len(uploadID) > 64 {
+		return nil, fmt.Errorf("bad upload_id")
+	}
+	if _, err := hex.DecodeString(uploadID); err != nil {
+		return nil, fmt.Errorf("bad upload_id")
+	}
+	tmpPath := filepath.Join(filepath.Dir(path), ".wt-upload-"+uploadID)
+	markerPath := filepath.Join(uploadsDir, uploadID)
+
+	fail := func(err error) (map[string]any, error) {
+		os.Remove(tmpPath)
+		os.Remove(markerPath)
+		return nil, err
+	}
+	chunk, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fail(fmt.Errorf("bad data: %w", err))
+	}
+	if offset == 0 {
+		if err := os.MkdirAll(uploadsDir, 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(markerPath, []byte(tmpPath), 0600); err != nil {
+			return nil, err
+		}
+	}
+	flags := os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(tmpPath, flags, 0600)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown upload (start at offset 0)")
+		}
+		return fail(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fail(err)
+	}
+	if fi.Size() != offset {
+		f.Close()
+		return fail(fmt.Errorf("offset %d, expected %d", offset, fi.Size()))
+	}
+	if offset+int64(len(chunk)) > ws.FileTransferLimit {
+		f.Close()
+		return fail(fmt.Errorf("upload exceeds %s", humanBytes(ws.FileTransferLimit)))
+	}
+	if _, err := f.Write(chunk); err != nil {
+		f.Close()
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+	received := offset + int64(len(chunk))
+	if !done {
+		return map[string]any{"received": received}, nil
+	}
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		if !fi.Mode().IsRegular() {
+			return fail(fmt.Errorf("not a regular file"))
+		}
+		mode = fi.Mode().Perm()
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fail(err)
+	}
+	os.Remove(markerPath)
+	info, err := fileStat(path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"received": received, "file": info}, nil
+}
+
+// sweepUploads removes partial uploads that have had no chunk for
+// uploadStaleAfter, along with markers whose temp file is already gone.
+func sweepUploads(uploadsDir string) {
+	entries, err := os.ReadDir(uploadsDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		markerPath := filepath.Join(uploadsDir, e.Name())
+		tmpPath, err := os.ReadFile(markerPath)
+		if err != nil || !strings.HasPrefix(filepath.Base(string(tmpPath)), ".wt-upload-") {
+			os.Remove(markerPath)
+			continue
+		}
+		fi, err := os.Stat(string(tmpPath))
+		if err == nil && time.Since(fi.ModTime()) < uploadStaleAfter {
+			continue
+		}
+		if err == nil {
+			log.Printf("file.upload: removing abandoned %s", tmpPath)
+			os.Remove(string(tmpPath))
+		}
+		os.Remove(markerPath)
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/ws"
+)
+
+// Port forwarding lets the preview panel load a dev server the agent runs on
+// the wing (tunnel.http, tunnel.ws). Only ports the session's egg.yaml
+// declares are reachable, and only on loopback: the wing never dials another
+// host, whatever the request says. egg.yaml is in the project, so anyone who
+// can write there can declare a port; the port must also be one the
+// session's own processes listen on, or one the owner lists in wing.yaml
+// forward_ports.
+
+const (
+	// sessionPortsFile records a session's declared ports next to egg.owner,
+	// so forwarding keeps working for sessions reclaimed after a restart.
+	sessionPortsFile = "egg.ports"
+	// forwardTimeout bounds one tunnel.http exchange, body included.
+	forwardTimeout = 5 * time.Minute
+	// wsForwardIdle closes a tunnel.ws the browser stopped pinging.
+	wsForwardIdle = 90 * time.Second
+	maxWSForwards = 64
+)
+
+// writeSessionPorts records the ports a session may forward, one per line.
+func writeSessionPorts(dir string, ports []int) error {
+	var b strings.Builder
+	for _, p := range ports {
+		if p > 0 && p <= 65535 {
+			fmt.Fprintf(&b, "%d\n", p)
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, sessionPortsFile), []byte(b.String()), 0644)
+}
+
+// readSessionPorts returns a session's declared ports; none if the session
+// declared none or is gone (cleanEggDir removes the file).
+func readSessionPorts(dir string) []int {
+	data, err := os.ReadFile(filepath.Join(dir, sessionPortsFile))
+	if err != nil {
+		return nil
+	}
+	var ports []int
+	for _, line := range strings.Fields(string(data)) {
+		if p, err := strconv.Atoi(line); err == nil {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// checkForward returns why the sender may not forward to port in sessionID,
+// or nil. Members may only forward into their own sessions.
+func checkForward(cfg *config.Config, wingCfg *config.WingConfig, req ws.TunnelRequest, sessionID string, port int) error {
+	if sessionID == "" || sessionID != filepath.Base(sessionID) || strings.HasPrefix(sessionID, ".") {
+		return fmt.Errorf("missing session_id")
+	}
+	dir := filepath.Join(cfg.Dir, "eggs", sessionID)
+	if !canSeeSession(req, readEggOwner(dir)) {
+		return errFileAccess
+	}
+	if !slices.Contains(readSessionPorts(dir), port) {
+		return fmt.Errorf("port %d is not in the session's egg.yaml ports", port)
+	}
+	if !slices.Contains(wingCfg.ForwardPorts, port) && !eggListens(dir, port) {
+		return fmt.Errorf("nothing in the session is listening on port %d", port)
+	}
+	return nil
+}
+
+// eggListens reports whether the egg in dir, or a process it started, is
+// listening on port.
+func eggListens(dir string, port int) bool {
+	data, err := os.ReadFile(filepath.Join(dir, "egg.pid"))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return processListens(pid, port)
+}
+
+// dialLoopback connects to port on 127.0.0.1, then ::1 (dev servers that
+// bind "localhost" often get only one of them).
+func dialLoopback(ctx context.Context, port string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort("127.0.0.1", port))
+	if err == nil {
+		return conn, nil
+	}
+	if conn6, err6 := d.DialContext(ctx, "tcp", net.JoinHostPort("::1", port)); err6 == nil {
+		return conn6, nil
+	}
+	return nil, err
+}
+
+// forwardTransport only ever dials loopback: the host in the URL is ignored,
+// only its port is used.
+var forwardTransport = &http.Transport{
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		return dialLoopback(ctx, port)
+	},
+	DisableCompression:    true,
+	ResponseHeaderTimeout: 30 * time.Second,
+	MaxIdleConnsPerHost:   4,
+	IdleConnTimeout:       30 * time.Second,
+}
+
+var forwardClient = &http.Client{
+	Transport: forwardTransport,
+	// Redirects go back to the browser, which follows them through the tunnel
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// hopHeaders are per-connection headers that don't cross a proxy.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// forwardURL builds the loopback URL for a request path, which must be
+// absolute ("/..." with an optional query).
+func forwardURL(scheme string, port int, path string) (string, error) {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return "", fmt.Errorf("path must start with /")
+	}
+	host := "localhost:" + strconv.Itoa(port)
+	u, err := url.Parse(scheme + "://" + host + path)
+	if err != nil || u.Host != host || u.User != nil {
+		return "", fmt.Errorf("bad path")
+	}
+	return u.String(), nil
+}
+
+// forwardRequestHeader copies browser headers onto a loopback request. The
+// dev server sees itself as the origin; the response must not be compressed
+// because the browser's service worker hands it over as-is.
+func forwardRequestHeader(in map[string]string, port int) http.Header {
+	h := make(http.Header)
+	for k, v := range in {
+		h.Set(k, v)
+	}
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+	h.Del("Host")
+	h.Del("Accept-Encoding")
+	h.Del("Referer")
+	h.Del("Content-Length")
+	if h.Get("Origin") != "" {
+		h.Set("Origin", "http://localhost:"+strconv.Itoa(port))
+	}
+	return h
+}
+
+// forwardResponseHeader flattens a dev server's response headers for the
+// browser. Redirects to the server's own origin become paths so they stay
+// in the tunnel.
+func forwardResponseHeader(in http.Header, port int) map[string]string {
+	out := make(map[string]string)
+	for k, vs := range in {
+		out[k] = strings.Join(vs, ", ")
+	}
+	for _, k := range hopHeaders {
+		delete(out, k)
+	}
+	delete(out, "Content-Length")
+	delete(out, "Set-Cookie") // a service worker can't set cookies anyway
+	if loc := in.Get("Location"); loc != "" {
+		p := strconv.Itoa(port)
+		for _, origin := range []string{"http://localhost:" + p, "http://127.0.0.1:" + p, "http://[::1]:" + p} {
+			if rest, ok := strings.CutPrefix(loc, origin); ok && (rest == "" || strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, "?")) {
+				if !strings.HasPrefix(rest, "/") {
+					rest = "/" + rest
+				}
+				out["Location"] = rest
+				break
+			}
+		}
+	}
+	return out
+}
+
+// streamForwardHTTP handles tunnel.http: one HTTP exchange with a loopback
+// dev server. The response streams back as {"status","headers"}, then
+// {"data"} chunks of base64 body, then {"done":true}; failures end with
+// {"error","done":true}.
+func streamForwardHTTP(ctx context.Context, inner tunnelInner, gcm cipher.AEAD, requestID string, write ws.PTYWriteFunc) {
+	fail := func(msg string) {
+		chunk, _ := json.Marshal(map[string]any{"error": msg, "done": true})
+		tunnelStreamChunk(gcm, requestID, chunk, true, write)
+	}
+	target, err := forwardURL("http", inner.Port, inner.Path)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	body, err := base64.StdEncoding.DecodeString(inner.Data)
+	if err != nil {
+		fail("bad body")
+		return
+	}
+	if len(body) > ws.ForwardBodyLimit {
+		fail(fmt.Sprintf("request body exceeds %s", humanBytes(ws.ForwardBodyLimit)))
+		return
+	}
+	method := inner.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, forwardTimeout)
+	defer cancel()
+	var reqBody io.Reader
+	if len(body) > 0 {
+		reqBody = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	httpReq.Header = forwardRequestHeader(inner.Headers, inner.Port)
+	resp, err := forwardClient.Do(httpReq)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			fail(fmt.Sprintf("nothing is listening on port %d", inner.Port))
+			return
+		}
+		fail(err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	head, _ := json.Marshal(map[string]any{"status": resp.StatusCode, "headers": forwardResponseHeader(resp.Header, inner.Port)})
+	tunnelStreamChunk(gcm, requestID, head, false, write)
+
+	buf := make([]byte, ws.ForwardResponseChunk)
+	var sent int64
+	for {
+		n, err := io.ReadFull(resp.Body, buf)
+		if n > 0 {
+			sent += int64(n)
+			if sent > ws.ForwardResponseLimit {
+				fail(fmt.Sprintf("response exceeds %s", humanBytes(ws.ForwardResponseLimit)))
+				return
+			}
+			chunk, _ := json.Marshal(map[string]string{"data": base64.StdEncoding.EncodeToString(buf[:n])})
+			tunnelStreamChunk(gcm, requestID, chunk, false, write)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+	}
+	done, _ := json.Marshal(map[string]bool{"done": true})
+	tunnelStreamChunk(gcm, requestID, done, true, write)
+}
+
+// wsForward is an open tunnel.ws. Browser frames arrive as separate tunnel
+// requests, which the wing handles concurrently, so each carries a sequence
+// number (offset) and is written in order.
+type wsForward struct {
+	conn    *websocket.Conn
+	mu      sync.Mutex
+	cond    *sync.Cond
+	next    int
+	touched atomic.Int64 // unix nanos of the browser's last send or ping
+}
+
+// wsForwards holds open forwards by sender public key + "/" + ws_id, so only
+// the browser that opened one can write to it.
+var (
+	wsForwards     sync.Map
+	wsForwardCount atomic.Int32
+)
+
+// streamForwardWS handles tunnel.ws: opens a WebSocket to a loopback dev
+// server (HMR, live reload) and streams its frames back as {"data","binary"}
+// chunks after an initial {"open":true,"protocol"}. Ends with
+// {"done":true,"code","reason"} when either side closes.
+func streamForwardWS(ctx context.Context, inner tunnelInner, senderPub string, gcm cipher.AEAD, requestID string, write ws.PTYWriteFunc) {
+	fail := func(msg string) {
+		chunk, _ := json.Marshal(map[string]any{"error": msg, "done": true})
+		tunnelStreamChunk(gcm, requestID, chunk, true, write)
+	}
+	if inner.WSID == "" || len(inner.WSID) > 64 {
+		fail("missing ws_id")
+		return
+	}
+	target, err := forwardURL("ws", inner.Port, inner.Path)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if wsForwardCount.Add(1) > maxWSForwards {
+		wsForwardCount.Add(-1)
+		fail("too many forwarded websockets")
+		return
+	}
+	defer wsForwardCount.Add(-1)
+
+	header := forwardRequestHeader(nil, inner.Port)
+	header.Set("Origin", "http://localhost:"+strconv.Itoa(inner.Port))
+	var protocols []string
+	for _, p := range strings.Split(inner.Headers["Sec-WebSocket-Protocol"], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			protocols = append(protocols, p)
+		}
+	}
+	dialCtx, dialCancel := context.WithTimeout(ctx, 30*time.Second)
+	conn, _, err := websocket.Dial(dialCtx, target, &websocket.DialOptions{
+		HTTPClient:   &http.Client{Transport: forwardTransport},
+		HTTPHeader:   header,
+		Subprotocols: protocols,
+	})
+	dialCancel()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	conn.SetReadLimit(ws.ForwardFrameLimit)
+
+	fwd := &wsForward{conn: conn}
+	fwd.cond = sync.NewCond(&fwd.mu)
+	fwd.touched.Store(time.Now().UnixNano())
+	key := senderPub + "/" + inner.WSID
+	if _, loaded := wsForwards.LoadOrStore(key, fwd); loaded {
+		conn.Close(websocket.StatusPolicyViolation, "duplicate ws_id")
+		fail("duplicate ws_id")
+		return
+	}
+	defer wsForwards.Delete(key)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Close forwards whose browser went away without saying so
+		t := time.NewTicker(wsForwardIdle / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if time.Since(time.Unix(0, fwd.touched.Load())) > wsForwardIdle {
+					conn.Close(websocket.StatusGoingAway, "browser went away")
+					return
+				}
+			}
+		}
+	}()
+
+	open, _ := json.Marshal(map[string]any{"open": true, "protocol": conn.Subprotocol()})
+	tunnelStreamChunk(gcm, requestID, open, false, write)
+	for {
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			code := websocket.CloseStatus(err)
+			if code == -1 {
+				code = websocket.StatusAbnormalClosure
+			}
+			reason := ""
+			var ce websocket.CloseError
+			if errors.As(err, &ce) {
+				reason = ce.Reason
+			}
+			conn.CloseNow()
+			fwd.mu.Lock()
+			fwd.next = -1 // wake any writer waiting on its turn
+			fwd.cond.Broadcast()
+			fwd.mu.Unlock()
+			done, _ := json.Marshal(map[string]any{"done": true, "code": int(code), "reason": reason})
+			tunnelStreamChunk(gcm, requestID, done, true, write)
+			return
+		}
+		chunk, _ := json.Marshal(map[string]any{"data": base64.StdEncoding.EncodeToString(data), "binary": typ == websocket.MessageBinary})
+		tunnelStreamChunk(gcm, requestID, chunk, false, write)
+	}
+}
+
+// forwardWSSend handles tunnel.ws.send: one browser frame (Data, in order
+// by Offset), a keepalive (Kind "ping"), or a close (Done).
+func forwardWSSend(ctx context.Context, inner tunnelInner, senderPub string) error {
+	v, ok := wsForwards.Load(senderPub + "/" + inner.WSID)
+	if !ok {
+		return fmt.Errorf("unknown ws_id")
+	}
+	fwd := v.(*wsForward)
+	fwd.touched.Store(time.Now().UnixNano())
+	if inner.Done {
+		return fwd.conn.Close(websocket.StatusNormalClosure, "")
+	}
+	if inner.Kind == "ping" {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(inner.Data)
+	if err != nil {
+		return fmt.Errorf("bad data")
+	}
+	if len(data) > ws.ForwardBodyLimit {
+		return fmt.Errorf("frame exceeds %s", humanBytes(ws.ForwardBodyLimit))
+	}
+
+	// Wait for this frame's turn; a lost frame fails the ones after it
+	fwd.mu.Lock()
+	defer fwd.mu.Unlock()
+	deadline := time.AfterFunc(10*time.Second, func() {
+		fwd.mu.Lock()
+		fwd.cond.Broadcast()
+		fwd.mu.Unlock()
+	})
+	defer deadline.Stop()
+	start := time.Now()
+	for fwd.next != inner.Offset {
+		if fwd.next < 0 {
+			return fmt.Errorf("websocket closed")
+		}
+		if time.Since(start) >= 10*time.Second {
+			return fmt.Errorf("frame %d out of order (expected %d)", inner.Offset, fwd.next)
+		}
+		fwd.cond.Wait()
+	}
+	typ := websocket.MessageText
+	if inner.Binary {
+		typ = websocket.MessageBinary
+	}
+	writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = fwd.conn.Write(writeCtx, typ, data)
+	fwd.next++
+	fwd.cond.Broadcast()
+	if err != nil {
+		log.Printf("tunnel.ws %s: write: %v", inner.WSID, err)
+	}
+	return err
+}
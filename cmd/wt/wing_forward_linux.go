@@ -0,0 +1,91 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// processListens reports whether pid or one of its descendants holds a TCP
+// socket listening on port in this network namespace.
+func processListens(pid, port int) bool {
+	inodes := listeningInodes(port)
+	if len(inodes) == 0 {
+		return false
+	}
+	for _, p := range processTree(pid) {
+		fdDir := filepath.Join("/proc", strconv.Itoa(p), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			if inode, ok := strings.CutPrefix(link, "socket:["); ok && inodes[strings.TrimSuffix(inode, "]")] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listeningInodes returns the inodes of sockets listening on port, from
+// /proc/net/tcp and /proc/net/tcp6.
+func listeningInodes(port int) map[string]bool {
+	suffix := fmt.Sprintf(":%04X", port)
+	inodes := make(map[string]bool)
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		// sl local_address rem_address st tx:rx tr:when retrnsmt uid timeout inode
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			f := strings.Fields(line)
+			if len(f) < 10 || f[3] != "0A" || !strings.HasSuffix(f[1], suffix) {
+				continue
+			}
+			inodes[f[9]] = true
+		}
+	}
+	return inodes
+}
+
+// processTree returns pid followed by all of its descendants.
+func processTree(pid int) []int {
+	children := make(map[int][]int)
+	entries, _ := os.ReadDir("/proc")
+	for _, e := range entries {
+		p, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// pid (comm) state ppid ...; comm may itself contain ") "
+		stat := string(data)
+		if i := strings.LastIndexByte(stat, ')'); i >= 0 {
+			stat = stat[i+1:]
+		}
+		f := strings.Fields(stat)
+		if len(f) < 2 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(f[1])
+		children[ppid] = append(children[ppid], p)
+	}
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
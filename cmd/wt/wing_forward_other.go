@@ -0,0 +1,54 @@
+//go:build !linux
+
+package main
+
+import (
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// processListens reports whether pid or one of its descendants holds a TCP
+// socket listening on port. Without lsof nothing counts as listening, and
+// only wing.yaml forward_ports can be previewed.
+func processListens(pid, port int) bool {
+	out, err := exec.Command("lsof", "-nP", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-Fp").Output()
+	if err != nil {
+		return false
+	}
+	tree := processTree(pid)
+	for _, line := range strings.Fields(string(out)) {
+		if p, ok := strings.CutPrefix(line, "p"); ok {
+			if n, err := strconv.Atoi(p); err == nil && slices.Contains(tree, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// processTree returns pid followed by all of its descendants.
+func processTree(pid int) []int {
+	out, err := exec.Command("ps", "-axo", "pid=,ppid=").Output()
+	if err != nil {
+		return []int{pid}
+	}
+	children := make(map[int][]int)
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			continue
+		}
+		p, err1 := strconv.Atoi(f[0])
+		ppid, err2 := strconv.Atoi(f[1])
+		if err1 == nil && err2 == nil {
+			children[ppid] = append(children[ppid], p)
+		}
+	}
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
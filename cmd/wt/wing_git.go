@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/ws"
+)
+
+const gitTimeout = 30 * time.Second
+
+// gitSafetyArgs neutralize repo settings that make git run programs. The repo
+// is writable by sandboxed agents and these commands run outside the sandbox,
+// so a planted hook or fsmonitor would be a way out.
+var gitSafetyArgs = []string{
+	"-c", "core.hooksPath=/dev/null",
+	"-c", "core.fsmonitor=false",
+	"-c", "core.pager=cat",
+	"-c", "core.editor=false",
+	"-c", "commit.gpgSign=false",
+	"-c", "tag.gpgSign=false",
+}
+
+// gitUnsafeKey reports a repo config key that can run a program git would
+// otherwise call for us (filters, diff drivers, signing programs, includes
+// that could pull in any of these), or "" if there is none. Every scope the
+// repo controls counts, .git/config.worktree and included files as much as
+// .git/config; only the user's own system and global config are trusted.
+func gitUnsafeKey(dir string) (string, error) {
+	out, err := runGit(dir, "config", "--list", "--show-scope", "--name-only")
+	if err != nil {
+		// Exit 1: no config keys at all
+		if gitExitCode(err) == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		scope, key, _ := strings.Cut(line, "\t")
+		switch scope {
+		case "system", "global", "command":
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		switch {
+		case key == "":
+		case strings.HasPrefix(key, "filter."),
+			strings.HasPrefix(key, "diff.") && (strings.HasSuffix(key, ".command") || strings.HasSuffix(key, ".textconv")),
+			strings.HasPrefix(key, "merge.") && strings.HasSuffix(key, ".driver"),
+			strings.HasPrefix(key, "gpg.") && strings.HasSuffix(key, "program"),
+			strings.HasPrefix(key, "include.") || strings.HasPrefix(key, "includeif."),
+			key == "core.sshcommand", key == "core.askpass", key == "credential.helper":
+			return key, nil
+		}
+	}
+	return "", nil
+}
+
+// runGit runs git in dir with the safety overrides and returns stdout. A
+// failing command's error carries git's stderr.
+func runGit(dir string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	full := append([]string{"-C", dir}, gitSafetyArgs...)
+	cmd := exec.CommandContext(ctx, "git", append(full, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_OPTIONAL_LOCKS=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("git %s timed out", args[0])
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, &gitError{msg: msg, err: err}
+		}
+		return out, err
+	}
+	return out, nil
+}
+
+// gitError keeps the exit status for callers while reading like git's message.
+type gitError struct {
+	msg string
+	err error
+}
+
+func (e *gitError) Error() string { return e.msg }
+func (e *gitError) Unwrap() error { return e.err }
+
+// gitExitCode returns the exit status of a git command that ran and failed,
+// or -1.
+func gitExitCode(err error) int {
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
+
+// gitRepoRoot returns the top level of the repository containing dir. The
+// root must itself be accessible: sharing a subdirectory doesn't grant
+// commits to the whole repo.
+func gitRepoRoot(dir string, userPaths []string, member bool, home string) (string, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository")
+	}
+	root, err := resolveFilePath(strings.TrimSpace(string(out)), userPaths, member, home)
+	if err != nil {
+		return "", err
+	}
+	if key, err := gitUnsafeKey(root); err != nil {
+		return "", err
+	} else if key != "" {
+		return "", fmt.Errorf("repository config sets %s; refusing to run git on it from the wing", key)
+	}
+	return root, nil
+}
+
+// gitFileStatus is one entry of git.status.
+type gitFileStatus struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"orig_path,omitempty"` // renames and copies
+	Index    string `json:"index"`               // staged status: M A D R C or " "
+	Worktree string `json:"worktree"`            // unstaged status; "?" untracked
+}
+
+// gitStatus handles git.status.
+func gitStatus(root string) (map[string]any, error) {
+	out, err := runGit(root, "status", "--porcelain=v1", "--branch", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]any{"root": root}
+	files := []gitFileStatus{}
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if strings.HasPrefix(f, "## ") {
+			parseGitBranch(f[3:], resp)
+			continue
+		}
+		if len(f) < 4 {
+			continue
+		}
+		st := gitFileStatus{Index: f[0:1], Worktree: f[1:2], Path: f[3:]}
+		if (st.Index == "R" || st.Index == "C") && i+1 < len(fields) {
+			i++
+			st.OrigPath = fields[i]
+		}
+		files = append(files, st)
+	}
+	resp["files"] = files
+	return resp, nil
+}
+
+// parseGitBranch reads a porcelain branch header such as
+// "main...origin/main [ahead 1, behind 2]" into resp.
+func parseGitBranch(h string, resp map[string]any) {
+	if rest, ok := strings.CutPrefix(h, "No commits yet on "); ok {
+		resp["branch"] = rest
+		return
+	}
+	if track, ok := strings.CutSuffix(h, "]"); ok {
+		if i := strings.LastIndex(track, " ["); i >= 0 {
+			for _, part := range strings.Split(track[i+2:], ", ") {
+				kind, n, _ := strings.Cut(part, " ")
+				if v, err := strconv.Atoi(n); err == nil && (kind == "ahead" || kind == "behind") {
+					resp[kind] = v
+				}
+			}
+			h = track[:i]
+		}
+	}
+	branch, upstream, _ := strings.Cut(h, "...")
+	resp["branch"] = branch
+	if upstream != "" {
+		resp["upstream"] = upstream
+	}
+}
+
+// gitPathspec turns request file paths into pathspec args, rejecting ones
+// that could be read as options.
+func gitPathspec(files []string) ([]string, error) {
+	args := []string{"--"}
+	for _, f := range files {
+		if f == "" || strings.HasPrefix(f, "-") {
+			return nil, fmt.Errorf("bad file %q", f)
+		}
+		args = append(args, ":(literal)"+f)
+	}
+	return args, nil
+}
+
+// gitDiff handles git.diff: a unified diff of the working tree (or the
+// index, when staged) against HEAD, for the whole repo or the given files,
+// plus per-file line counts. Untracked files are diffed as new files.
+func gitDiff(root string, files []string, staged bool) (map[string]any, error) {
+	spec, err := gitPathspec(files)
+	if err != nil {
+		return nil, err
+	}
+	base := []string{"diff", "--no-ext-diff", "--no-textconv", "--no-color"}
+	if staged {
+		base = append(base, "--cached")
+	}
+	numstat, err := runGit(root, slices.Concat(base, []string{"--numstat", "-z"}, spec)...)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := runGit(root, slices.Concat(base, spec)...)
+	if err != nil {
+		return nil, err
+	}
+
+	type fileStat struct {
+		Path    string `json:"path"`
+		Added   int    `json:"added"`
+		Deleted int    `json:"deleted"`
+		Binary  bool   `json:"binary,omitempty"`
+	}
+	stats := []fileStat{}
+	fields := strings.Split(string(numstat), "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		path := parts[2]
+		if path == "" && i+2 < len(fields) {
+			// Rename: "added\tdeleted\t\x00old\x00new"
+			path = fields[i+2]
+			i += 2
+		}
+		added, err1 := strconv.Atoi(parts[0])
+		deleted, err2 := strconv.Atoi(parts[1])
+		stats = append(stats, fileStat{Path: path, Added: added, Deleted: deleted, Binary: err1 != nil || err2 != nil})
+	}
+
+	if !staged {
+		// Untracked files aren't in git diff; show them as added
+		out, err := runGit(root, append([]string{"ls-files", "--others", "--exclude-standard", "-z"}, spec...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range strings.Split(string(out), "\x00") {
+			if f == "" || len(diff) > ws.FileReadLimit {
+				continue
+			}
+			// --no-index exits 1 when the files differ, which they always do
+			d, err := runGit(root, "diff", "--no-ext-diff", "--no-textconv", "--no-color", "--no-index", "--", "/dev/null", f)
+			if err != nil && gitExitCode(err) != 1 {
+				return nil, err
+			}
+			diff = append(diff, d...)
+			lines := bytes.Count(d, []byte("\n+"))
+			if lines > 0 {
+				lines-- // the "+++ b/file" header
+			}
+			stats = append(stats, fileStat{Path: f, Added: lines, Binary: bytes.Contains(d, []byte("Binary files "))})
+		}
+	}
+
+	resp := map[string]any{"root": root, "files": stats}
+	if len(diff) > ws.FileReadLimit {
+		diff = diff[:ws.FileReadLimit]
+		resp["truncated"] = true
+	}
+	resp["diff"] = string(diff)
+	return resp, nil
+}
+
+// gitLogEntry is one commit of git.log.
+type gitLogEntry struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Time    int64  `json:"time"`
+	Subject string `json:"subject"`
+}
+
+// gitLog handles git.log: the newest limit commits, optionally only those
+// touching the given files.
+func gitLog(root string, files []string, limit int) (map[string]any, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	spec, err := gitPathspec(files)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"log", "-n", strconv.Itoa(limit), "--no-color", "--format=%H%x00%an%x00%ae%x00%at%x00%s%x1e"}, spec...)
+	out, err := runGit(root, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not have any commits") {
+			return map[string]any{"root": root, "commits": []gitLogEntry{}}, nil
+		}
+		return nil, err
+	}
+	commits := []gitLogEntry{}
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		f := strings.Split(strings.TrimSpace(rec), "\x00")
+		if len(f) != 5 {
+			continue
+		}
+		t, _ := strconv.ParseInt(f[3], 10, 64)
+		commits = append(commits, gitLogEntry{Hash: f[0], Author: f[1], Email: f[2], Time: t, Subject: f[4]})
+	}
+	return map[string]any{"root": root, "commits": commits}, nil
+}
+
+// gitCommit handles git.commit: stages the given files (all changes,
+// including untracked files, when none are given) and commits with the
+// wing's git identity. Hooks don't run.
+func gitCommit(root, message string, files []string) (map[string]any, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, fmt.Errorf("missing commit message")
+	}
+	spec, err := gitPathspec(files)
+	if err != nil {
+		return nil, err
+	}
+	add := []string{"add", "-A"}
+	if len(files) > 0 {
+		add = append(add, spec...)
+	}
+	if _, err := runGit(root, add...); err != nil {
+		return nil, err
+	}
+	commit := []string{"commit", "--no-verify", "--cleanup=strip", "-m", message}
+	if len(files) > 0 {
+		commit = append(commit, spec...)
+	}
+	if _, err := runGit(root, commit...); err != nil {
+		return nil, err
+	}
+	out, err := runGit(root, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"root": root, "hash": strings.TrimSpace(string(out))}, nil
+}
+
+// gitStash handles git.stash: push (including untracked files), pop, or
+// list.
+func gitStash(root, action, message string) (map[string]any, error) {
+	switch action {
+	case "", "push":
+		args := []string{"stash", "push", "--include-untracked"}
+		if message != "" {
+			args = append(args, "-m", message)
+		}
+		out, err := runGit(root, args...)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"root": root, "output": strings.TrimSpace(string(out))}, nil
+	case "pop":
+		out, err := runGit(root, "stash", "pop")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"root": root, "output": strings.TrimSpace(string(out))}, nil
+	case "list":
+		out, err := runGit(root, "stash", "list", "--format=%gd%x00%at%x00%gs")
+		if err != nil {
+			return nil, err
+		}
+		type stashEntry struct {
+			Ref     string `json:"ref"`
+			Time    int64  `json:"time"`
+			Message string `json:"message"`
+		}
+		stashes := []stashEntry{}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			f := strings.Split(line, "\x00")
+			if len(f) != 3 {
+				continue
+			}
+			t, _ := strconv.ParseInt(f[1], 10, 64)
+			stashes = append(stashes, stashEntry{Ref: f[0], Time: t, Message: f[2]})
+		}
+		return map[string]any{"root": root, "stashes": stashes}, nil
+	}
+	return nil, fmt.Errorf("unknown stash action %q (want push, pop or list)", action)
+}
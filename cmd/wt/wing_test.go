@@ -1,13 +1,31 @@
 package main
 
 import (
+	"context"
+	"crypto/cipher"
+	"crypto/ecdh"
+	crand "crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/coder/websocket"
 
 	"github.com/ehrlich-b/wingthing/internal/auth"
 	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/egg"
 	"github.com/ehrlich-b/wingthing/internal/ws"
 )
 
@@ -164,6 +182,21 @@ func TestScanDir_GitRepoWithEggYamlSubProjects(t *testing.T) {
 	}
 }
 
+func TestScanDir_RootGitRepoWithEggYamlSubProjects(t *testing.T) {
+	// Configured path is the repo itself; its role dirs still appear.
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".git"), 0755)
+	mkProject(t, root, "dev", false, true)
+	mkProject(t, root, "src", false, false)
+
+	var projects []ws.WingProject
+	scanDir(root, 0, 3, &projects)
+
+	if len(projects) != 2 || projects[0].Path != root || !hasName(projects, "dev") {
+		t.Fatalf("expected root + dev, got %v", projectNames(projects))
+	}
+}
+
 func TestScanDir_HiddenDirsSkipped(t *testing.T) {
 	root := t.TempDir()
 	mkProject(t, root, ".hidden", true, false)
@@ -274,6 +307,172 @@ func TestIsUnderPaths(t *testing.T) {
 	}
 }
 
+func TestResolveFilePath(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	shared := filepath.Join(root, "shared")
+	secret := filepath.Join(root, "secret")
+	os.MkdirAll(shared, 0755)
+	os.MkdirAll(secret, 0755)
+	os.WriteFile(filepath.Join(shared, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(secret, "key"), []byte("k"), 0600)
+	os.Symlink(secret, filepath.Join(shared, "escape"))
+	paths := []string{shared}
+
+	tests := []struct {
+		path   string
+		paths  []string
+		member bool
+		want   string // "" = error
+	}{
+		{filepath.Join(shared, "a.txt"), paths, true, filepath.Join(shared, "a.txt")},
+		{filepath.Join(shared, "new.txt"), paths, true, filepath.Join(shared, "new.txt")}, // not yet created
+		{"~/a.txt", paths, true, filepath.Join(shared, "a.txt")},
+		{filepath.Join(secret, "key"), paths, true, ""},
+		{filepath.Join(shared, "..", "secret", "key"), paths, true, ""},
+		{filepath.Join(shared, "escape", "key"), paths, true, ""}, // symlink out of the shared path
+		{filepath.Join(shared, "nodir", "x"), paths, true, ""},
+		{"a.txt", paths, true, ""},                                               // relative
+		{filepath.Join(secret, "key"), nil, true, ""},                            // member with no paths
+		{filepath.Join(secret, "key"), nil, false, filepath.Join(secret, "key")}, // owner, unrestricted
+	}
+	for _, tt := range tests {
+		got, err := resolveFilePath(tt.path, tt.paths, tt.member, shared)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("resolveFilePath(%q) = %q, want error", tt.path, got)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("resolveFilePath(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte("hello\nworld\n"), false},
+		{[]byte("h\u00e9llo"), false},
+		{[]byte("h\u00e9llo")[:2], false}, // rune cut at the end of the sample
+		{[]byte("a\x00b"), true},
+		{[]byte{0xff, 0xfe, 'a', 'b', 'c', 'd', 'e'}, true},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := looksBinary(tt.data); got != tt.want {
+			t.Errorf("looksBinary(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFileReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("old"), 0600)
+
+	info, err := fileWrite(path, "new contents\n")
+	if err != nil {
+		t.Fatalf("fileWrite: %v", err)
+	}
+	if info.Size != 13 || info.Mode != 0600 || info.Binary {
+		t.Errorf("info = %+v (mode must be kept)", info)
+	}
+	resp, err := fileRead(path)
+	if err != nil || resp["content"] != "new contents\n" {
+		t.Fatalf("fileRead = %v, %v", resp, err)
+	}
+
+	bin := filepath.Join(dir, "blob")
+	os.WriteFile(bin, []byte{0, 1, 2, 3}, 0644)
+	resp, err = fileRead(bin)
+	if err != nil || resp["content"] != nil || !resp["file"].(ws.FileInfo).Binary {
+		t.Errorf("binary read = %v, %v", resp, err)
+	}
+	if _, err := fileRead(dir); err == nil {
+		t.Error("expected error reading a directory")
+	}
+	if _, err := fileWrite(path, string(make([]byte, ws.FileReadLimit+1))); err == nil {
+		t.Error("expected size limit error")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestFileUploadChunk(t *testing.T) {
+	dir := t.TempDir()
+	uploads := filepath.Join(t.TempDir(), "uploads")
+	path := filepath.Join(dir, "up.bin")
+	id := "0123456789abcdef0123456789abcdef"
+	b64 := base64.StdEncoding.EncodeToString
+
+	if _, err := fileUploadChunk(uploads, path, id, 5, b64([]byte("x")), false); err == nil {
+		t.Error("expected error for an upload not started at offset 0")
+	}
+	resp, err := fileUploadChunk(uploads, path, id, 0, b64([]byte("hello ")), false)
+	if err != nil || resp["received"] != int64(6) {
+		t.Fatalf("chunk 1 = %v, %v", resp, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("target written before the last chunk")
+	}
+	resp, err = fileUploadChunk(uploads, path, id, 6, b64([]byte("world")), true)
+	if err != nil || resp["received"] != int64(11) {
+		t.Fatalf("chunk 2 = %v, %v", resp, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "hello world" {
+		t.Errorf("uploaded = %q", data)
+	}
+
+	// Out-of-order chunk drops the partial upload
+	fileUploadChunk(uploads, path, id, 0, b64([]byte("abc")), false)
+	if _, err := fileUploadChunk(uploads, path, id, 1, b64([]byte("x")), false); err == nil {
+		t.Error("expected offset mismatch")
+	}
+	if _, err := fileUploadChunk(uploads, path, "../../etc", 0, b64([]byte("x")), true); err == nil {
+		t.Error("expected bad upload_id")
+	}
+	// Undecodable data mid-upload drops it too
+	fileUploadChunk(uploads, path, id, 0, b64([]byte("abc")), false)
+	if _, err := fileUploadChunk(uploads, path, id, 3, "!!", false); err == nil {
+		t.Error("expected bad data")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("leftover files: %v", entries)
+	}
+	if markers, _ := os.ReadDir(uploads); len(markers) != 0 {
+		t.Errorf("leftover markers: %v", markers)
+	}
+}
+
+func TestSweepUploads(t *testing.T) {
+	dir := t.TempDir()
+	uploads := filepath.Join(t.TempDir(), "uploads")
+	b64 := base64.StdEncoding.EncodeToString
+	stale := "0123456789abcdef0123456789abcdef"
+	fresh := "fedcba9876543210fedcba9876543210"
+	fileUploadChunk(uploads, filepath.Join(dir, "a.bin"), stale, 0, b64([]byte("abc")), false)
+	fileUploadChunk(uploads, filepath.Join(dir, "b.bin"), fresh, 0, b64([]byte("abc")), false)
+	old := time.Now().Add(-2 * uploadStaleAfter)
+	os.Chtimes(filepath.Join(dir, ".wt-upload-"+stale), old, old)
+	os.WriteFile(filepath.Join(uploads, "gone"), []byte(filepath.Join(dir, ".wt-upload-gone")), 0600)
+
+	sweepUploads(uploads)
+	if _, err := os.Stat(filepath.Join(dir, ".wt-upload-"+stale)); !os.IsNotExist(err) {
+		t.Error("stale upload not removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".wt-upload-"+fresh)); err != nil {
+		t.Error("active upload removed")
+	}
+	markers, _ := os.ReadDir(uploads)
+	if len(markers) != 1 || markers[0].Name() != fresh {
+		t.Errorf("markers = %v", markers)
+	}
+}
+
 func TestDiscoverProjects_GroupsParentsWithMultipleRepos(t *testing.T) {
 	root := t.TempDir()
 	container := filepath.Join(root, "repos")
@@ -494,3 +693,584 @@ func TestResolveRelayHTTPURL(t *testing.T) {
 		})
 	}
 }
+
+func TestAnswerAttentionReply(t *testing.T) {
+	wingKey, _ := ecdh.X25519().GenerateKey(crand.Reader)
+	browserKey, _ := ecdh.X25519().GenerateKey(crand.Reader)
+	gcm, err := auth.DeriveSharedKey(wingKey, base64.StdEncoding.EncodeToString(browserKey.PublicKey().Bytes()), "wt-pty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detector := egg.NewAttentionDetector("codex", 80, 24)
+	defer detector.Close()
+	ev, ok := detector.Feed([]byte("Allow command?\r\n"))
+	if !ok || !ev.Replyable() {
+		t.Fatalf("prompt not detected: %+v", ev)
+	}
+
+	reply := func(nonce, choice, token string) []byte {
+		plain, _ := json.Marshal(map[string]string{"nonce": nonce, "choice": choice})
+		enc, _ := auth.Encrypt(gcm, plain)
+		data, _ := json.Marshal(ws.PTYAttentionReply{Type: ws.TypePTYAttentionReply, SessionID: "s1", Data: enc, AuthToken: token})
+		return data
+	}
+	cache := auth.NewAuthCache()
+	cache.Put("good-token", []byte("key"))
+	answerAttentionReply := func(data []byte, gcm cipher.AEAD, detector *egg.AttentionDetector, requirePasskey bool, cache *auth.AuthCache, ttl time.Duration) ([]byte, error) {
+		nonce, choice, err := decodeAttentionReply(data, gcm, requirePasskey, cache, ttl)
+		if err != nil {
+			return nil, err
+		}
+		return attentionReplyKeys(detector, nonce, choice)
+	}
+
+	keys, err := answerAttentionReply(reply(ev.Nonce, "approve", ""), gcm, detector, false, cache, time.Hour)
+	if err != nil || string(keys) != "y" {
+		t.Fatalf("approve: keys=%q err=%v", keys, err)
+	}
+	if _, err := answerAttentionReply(reply("stale", "approve", ""), gcm, detector, false, cache, time.Hour); err == nil {
+		t.Error("stale nonce accepted")
+	}
+	if _, err := answerAttentionReply(reply(ev.Nonce, "approve", ""), gcm, detector, true, cache, time.Hour); err == nil {
+		t.Error("passkey user without token accepted")
+	}
+	keys, err = answerAttentionReply(reply(ev.Nonce, "deny", "good-token"), gcm, detector, true, cache, time.Hour)
+	if err != nil || string(keys) != "n" {
+		t.Fatalf("deny with token: keys=%q err=%v", keys, err)
+	}
+	if _, err := answerAttentionReply(reply(ev.Nonce, "approve", ""), nil, detector, false, cache, time.Hour); err == nil {
+		t.Error("reply accepted without E2E key")
+	}
+}
+
+func TestToolApprovalGate(t *testing.T) {
+	wingKey, _ := ecdh.X25519().GenerateKey(crand.Reader)
+	browserKey, _ := ecdh.X25519().GenerateKey(crand.Reader)
+	gcm, err := auth.DeriveSharedKey(wingKey, base64.StdEncoding.EncodeToString(browserKey.PublicKey().Bytes()), "wt-pty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	offers := make(chan map[string]any, 4)
+	var wmu sync.Mutex
+	var notified []string
+	write := func(v any) error {
+		switch m := v.(type) {
+		case ws.PTYAttention:
+			plain, err := auth.Decrypt(gcm, m.Data)
+			if err != nil {
+				t.Errorf("decrypt offer: %v", err)
+				return nil
+			}
+			var p map[string]any
+			json.Unmarshal(plain, &p)
+			offers <- p
+		case ws.SessionAttention:
+			wmu.Lock()
+			notified = append(notified, m.Kind)
+			wmu.Unlock()
+		}
+		return nil
+	}
+	gate := newToolApprovalGate("s1", "claude", "/proj", &mu, &gcm, write)
+	defer clearAttentionCooldown("s1")
+
+	decisions := make(chan egg.ToolDecision, 2)
+	go func() {
+		decisions <- gate.approve(context.Background(), egg.ToolApproval{ID: "a1", Tool: "deploy", Args: []string{"prod", "it's"}})
+	}()
+	offer := <-offers
+	if offer["kind"] != "tool" || offer["nonce"] != "a1" || offer["detail"] != `deploy prod 'it'\''s'` {
+		t.Fatalf("offer = %v", offer)
+	}
+	// A second call waits its turn
+	go func() {
+		decisions <- gate.approve(context.Background(), egg.ToolApproval{ID: "a2", Tool: "deploy"})
+	}()
+	for {
+		gate.pmu.Lock()
+		n := len(gate.pending)
+		gate.pmu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if gate.answer("screen-prompt", "approve", "me") {
+		t.Error("answered a nonce no call is waiting on")
+	}
+	if !gate.answer("a1", "deny", "owner@example.com") {
+		t.Fatal("answer a1 not routed")
+	}
+	if d := <-decisions; d.Approved || d.By != "owner@example.com" {
+		t.Errorf("a1 decision = %+v", d)
+	}
+	if next := <-offers; next["nonce"] != "a2" {
+		t.Errorf("next offer = %v", next)
+	}
+	gate.answer("a2", "approve", "owner@example.com")
+	if d := <-decisions; !d.Approved {
+		t.Errorf("a2 decision = %+v", d)
+	}
+	wmu.Lock()
+	defer wmu.Unlock()
+	if len(notified) != 2 || notified[0] != "tool" {
+		t.Errorf("notifications = %v", notified)
+	}
+}
+
+func TestReplySender(t *testing.T) {
+	stamped, _ := json.Marshal(ws.PTYAttentionReply{Type: ws.TypePTYAttentionReply, SessionID: "s1", SenderUserID: "u-2", SenderEmail: "admin@example.com"})
+	if got := replySender(stamped, "owner@example.com"); got != "admin@example.com" {
+		t.Errorf("stamped reply sender = %q", got)
+	}
+	// Over a DataChannel the browser could set the stamp; it falls back to
+	// the attached controller instead
+	if got := replySender(unstampReply(stamped), "owner@example.com"); got != "owner@example.com" {
+		t.Errorf("DataChannel reply sender = %q", got)
+	}
+	input, _ := json.Marshal(ws.PTYInput{Type: ws.TypePTYInput, SessionID: "s1", Data: "x"})
+	if got := unstampReply(input); string(got) != string(input) {
+		t.Errorf("unstampReply changed input: %s", got)
+	}
+}
+
+func TestToolApprovalGateTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var gcm cipher.AEAD // browser not attached: nothing to offer, still notifies
+	gate := newToolApprovalGate("s2", "claude", "/proj", &mu, &gcm, func(any) error { return nil })
+	defer clearAttentionCooldown("s2")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	d := gate.approve(ctx, egg.ToolApproval{ID: "t1", Tool: "deploy"})
+	if d.Approved || d.Reason == "" {
+		t.Errorf("decision = %+v", d)
+	}
+	if len(gate.pending) != 0 {
+		t.Errorf("pending = %d after timeout", len(gate.pending))
+	}
+}
+
+func TestGitTunnel(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	repo := filepath.Join(root, "repo")
+	os.MkdirAll(filepath.Join(repo, "sub"), 0755)
+	if _, err := runGit(repo, "init", "-q", "-b", "main"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+
+	got, err := gitRepoRoot(filepath.Join(repo, "sub"), []string{repo}, true, root)
+	if err != nil || got != repo {
+		t.Fatalf("gitRepoRoot = %q, %v", got, err)
+	}
+	if _, err := gitRepoRoot(filepath.Join(repo, "sub"), []string{filepath.Join(repo, "sub")}, true, root); err == nil {
+		t.Error("sharing a subdirectory must not grant the whole repo")
+	}
+	if log, err := gitLog(repo, nil, 0); err != nil || len(log["commits"].([]gitLogEntry)) != 0 {
+		t.Errorf("log of empty repo = %v, %v", log, err)
+	}
+
+	// A planted hook must not run
+	os.WriteFile(filepath.Join(repo, ".git", "hooks", "pre-commit"), []byte("#!/bin/sh\ntouch "+filepath.Join(root, "pwned")+"\n"), 0755)
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("one\n"), 0644)
+	res, err := gitCommit(repo, "first", nil)
+	if err != nil || len(res["hash"].(string)) != 40 {
+		t.Fatalf("gitCommit = %v, %v", res, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "pwned")); err == nil {
+		t.Error("pre-commit hook ran")
+	}
+
+	os.WriteFile(filepath.Join(repo, "a.txt"), []byte("one\ntwo\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "sub", "new.txt"), []byte("new\n"), 0644)
+	status, err := gitStatus(repo)
+	if err != nil || status["branch"] != "main" {
+		t.Fatalf("gitStatus = %v, %v", status, err)
+	}
+	files := status["files"].([]gitFileStatus)
+	if len(files) != 2 || files[0].Path != "a.txt" || files[0].Worktree != "M" || files[1].Path != "sub/new.txt" || files[1].Worktree != "?" {
+		t.Errorf("status files = %+v", files)
+	}
+
+	diff, err := gitDiff(repo, nil, false)
+	if err != nil {
+		t.Fatalf("gitDiff: %v", err)
+	}
+	text := diff["diff"].(string)
+	if !strings.Contains(text, "+two") || !strings.Contains(text, "+new") {
+		t.Errorf("diff = %q", text)
+	}
+	if b, _ := json.Marshal(diff["files"]); !strings.Contains(string(b), `{"path":"a.txt","added":1,"deleted":0}`) || !strings.Contains(string(b), `{"path":"sub/new.txt","added":1,"deleted":0}`) {
+		t.Errorf("diff files = %s", b)
+	}
+	if diff, _ := gitDiff(repo, []string{"sub/new.txt"}, false); strings.Contains(diff["diff"].(string), "+two") {
+		t.Error("per-file diff included other files")
+	}
+	if _, err := gitDiff(repo, []string{"--output=/tmp/x"}, false); err == nil {
+		t.Error("expected option-like file to be rejected")
+	}
+
+	if _, err := gitCommit(repo, "second", []string{"a.txt"}); err != nil {
+		t.Fatalf("gitCommit files: %v", err)
+	}
+	log, err := gitLog(repo, nil, 10)
+	commits := log["commits"].([]gitLogEntry)
+	if err != nil || len(commits) != 2 || commits[0].Subject != "second" || commits[0].Email != "test@example.com" {
+		t.Errorf("log = %+v, %v", commits, err)
+	}
+	if status, _ := gitStatus(repo); len(status["files"].([]gitFileStatus)) != 1 {
+		t.Errorf("only a.txt should have been committed: %+v", status["files"])
+	}
+
+	if _, err := gitStash(repo, "push", "wip"); err != nil {
+		t.Fatalf("stash push: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "sub", "new.txt")); !os.IsNotExist(err) {
+		t.Error("stash should include untracked files")
+	}
+	list, err := gitStash(repo, "list", "")
+	if err != nil || fmt.Sprint(list["stashes"]) == "[]" {
+		t.Errorf("stash list = %v, %v", list, err)
+	}
+	if _, err := gitStash(repo, "pop", ""); err != nil {
+		t.Fatalf("stash pop: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "sub", "new.txt")); err != nil {
+		t.Error("stash pop didn't restore the file")
+	}
+
+	// Repo config that runs programs is refused
+	runGit(repo, "config", "filter.evil.clean", "touch "+filepath.Join(root, "pwned"))
+	if _, err := gitRepoRoot(repo, nil, false, root); err == nil || !strings.Contains(err.Error(), "filter.evil.clean") {
+		t.Errorf("expected refusal, got %v", err)
+	}
+}
+
+func TestGitUnsafeKeyWorktreeConfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	repo := filepath.Join(root, "repo")
+	os.MkdirAll(repo, 0755)
+	if _, err := runGit(repo, "init", "-q", "-b", "main"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	if _, err := gitRepoRoot(repo, nil, false, root); err != nil {
+		t.Fatalf("clean repo refused: %v", err)
+	}
+
+	// A filter in .git/config.worktree is as dangerous as one in .git/config
+	runGit(repo, "config", "extensions.worktreeConfig", "true")
+	if _, err := runGit(repo, "config", "--worktree", "filter.x.clean", "touch "+filepath.Join(root, "pwned")+"; cat"); err != nil {
+		t.Fatalf("set worktree config: %v", err)
+	}
+	if _, err := gitRepoRoot(repo, nil, false, root); err == nil || !strings.Contains(err.Error(), "filter.x.clean") {
+		t.Errorf("expected refusal, got %v", err)
+	}
+}
+
+func TestProjectIndexer_PicksUpNewProjects(t *testing.T) {
+	root := t.TempDir()
+	mkProject(t, root, "existing", true, false)
+
+	updates := make(chan []ws.WingProject, 10)
+	ix := newProjectIndexer([]projectRoot{{Dir: root, Depth: 3}}, func(p []ws.WingProject) { updates <- p })
+	if ps := ix.Projects(); len(ps) != 1 || ps[0].Name != "existing" {
+		t.Fatalf("initial scan: %v", projectNames(ps))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ix.Run(ctx)
+
+	wait := func(want int) []ws.WingProject {
+		t.Helper()
+		for {
+			select {
+			case ps := <-updates:
+				if len(ps) == want {
+					return ps
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no update with %d projects", want)
+			}
+		}
+	}
+
+	// A clone two levels down, after its parent dir is created
+	os.MkdirAll(filepath.Join(root, "work", "new", ".git"), 0755)
+	if ps := wait(2); !hasName(ps, "new") {
+		t.Errorf("expected new project, got %v", projectNames(ps))
+	}
+	// A role dir inside an existing repo
+	mkProject(t, filepath.Join(root, "existing"), "qa", false, true)
+	if ps := wait(3); !hasName(ps, "qa") {
+		t.Errorf("expected qa role dir, got %v", projectNames(ps))
+	}
+	os.RemoveAll(filepath.Join(root, "work"))
+	if ps := wait(2); hasName(ps, "new") {
+		t.Errorf("removed project still listed: %v", projectNames(ps))
+	}
+}
+
+func TestProjectIndexer_SetRoots(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	mkProject(t, a, "one", true, false)
+	mkProject(t, b, "two", true, false)
+
+	var got []ws.WingProject
+	ix := newProjectIndexer([]projectRoot{{Dir: a, Depth: 3}}, func(p []ws.WingProject) { got = p })
+	ix.SetRoots([]projectRoot{{Dir: a, Depth: 3}})
+	if got != nil {
+		t.Fatalf("unchanged roots should not notify, got %v", projectNames(got))
+	}
+	ix.SetRoots([]projectRoot{{Dir: b, Depth: 3}})
+	if len(got) != 1 || got[0].Name != "two" {
+		t.Fatalf("expected [two], got %v", projectNames(got))
+	}
+}
+
+func TestSameProjects(t *testing.T) {
+	a := []ws.WingProject{{Name: "x", Path: "/x", ModTime: 1}, {Name: "y", Path: "/y"}}
+	b := []ws.WingProject{{Name: "y", Path: "/y"}, {Name: "x", Path: "/x", ModTime: 2}}
+	if !sameProjects(a, b) {
+		t.Error("order and mtime should not matter")
+	}
+	if sameProjects(a, b[:1]) {
+		t.Error("different lengths compared equal")
+	}
+}
+
+// forwardStream collects the decrypted chunks a tunnel stream writes.
+func forwardStream(t *testing.T) (cipher.AEAD, ws.PTYWriteFunc, chan map[string]any) {
+	t.Helper()
+	wingKey, _ := ecdh.X25519().GenerateKey(crand.Reader)
+	browserKey, _ := ecdh.X25519().GenerateKey(crand.Reader)
+	gcm, err := auth.DeriveSharedKey(wingKey, base64.StdEncoding.EncodeToString(browserKey.PublicKey().Bytes()), "wt-tunnel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := make(chan map[string]any, 64)
+	write := func(v any) error {
+		m, ok := v.(ws.TunnelStream)
+		if !ok {
+			return nil
+		}
+		plain, err := auth.Decrypt(gcm, m.Payload)
+		if err != nil {
+			t.Errorf("decrypt chunk: %v", err)
+			return nil
+		}
+		var c map[string]any
+		json.Unmarshal(plain, &c)
+		chunks <- c
+		return nil
+	}
+	return gcm, write, chunks
+}
+
+func TestForwardURL(t *testing.T) {
+	if u, err := forwardURL("http", 5173, "/src/main.ts?t=1"); err != nil || u != "http://localhost:5173/src/main.ts?t=1" {
+		t.Errorf("got %q, %v", u, err)
+	}
+	for _, p := range []string{"", "src", "//evil.example/x", "@evil.example/"} {
+		if _, err := forwardURL("http", 5173, p); err == nil {
+			t.Errorf("path %q accepted", p)
+		}
+	}
+}
+
+func TestForwardResponseHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "text/html")
+	h.Set("Content-Length", "10")
+	h.Set("Connection", "keep-alive")
+	h.Set("Location", "http://localhost:3000/login?next=/")
+	out := forwardResponseHeader(h, 3000)
+	if out["Content-Type"] != "text/html" || out["Location"] != "/login?next=/" {
+		t.Errorf("got %v", out)
+	}
+	if _, ok := out["Content-Length"]; ok {
+		t.Error("Content-Length kept")
+	}
+	if _, ok := out["Connection"]; ok {
+		t.Error("hop-by-hop header kept")
+	}
+	h.Set("Location", "https://example.com/")
+	if out := forwardResponseHeader(h, 3000); out["Location"] != "https://example.com/" {
+		t.Errorf("foreign redirect rewritten: %v", out["Location"])
+	}
+}
+
+func TestCheckForward(t *testing.T) {
+	cfg := &config.Config{Dir: t.TempDir()}
+	wingCfg := &config.WingConfig{}
+	dir := filepath.Join(cfg.Dir, "eggs", "s1")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "egg.owner"), []byte("u1\na@example.com"), 0644)
+
+	// This test process stands in for the egg, listening on one declared port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	os.WriteFile(filepath.Join(dir, "egg.pid"), []byte(strconv.Itoa(os.Getpid())), 0644)
+	writeSessionPorts(dir, []int{port, 3000, 70000})
+
+	owner := ws.TunnelRequest{SenderUserID: "u1", SenderOrgRole: "member"}
+	other := ws.TunnelRequest{SenderUserID: "u2", SenderOrgRole: "member"}
+	if err := checkForward(cfg, wingCfg, owner, "s1", port); err != nil {
+		t.Errorf("owner denied: %v", err)
+	}
+	if err := checkForward(cfg, wingCfg, other, "s1", port); err == nil {
+		t.Error("other member allowed")
+	}
+	if err := checkForward(cfg, wingCfg, owner, "s1", 22); err == nil {
+		t.Error("undeclared port allowed")
+	}
+	if err := checkForward(cfg, wingCfg, owner, "../s1", port); err == nil {
+		t.Error("path in session_id allowed")
+	}
+
+	// Declared in egg.yaml but nothing in the session listens: only the
+	// owner's wing.yaml can open it
+	if err := checkForward(cfg, wingCfg, owner, "s1", 3000); err == nil {
+		t.Error("declared port nobody in the session listens on allowed")
+	}
+	wingCfg.ForwardPorts = []int{3000}
+	if err := checkForward(cfg, wingCfg, owner, "s1", 3000); err != nil {
+		t.Errorf("owner-approved port denied: %v", err)
+	}
+	if got := readSessionPorts(dir); len(got) != 2 || got[0] != port || got[1] != 3000 {
+		t.Errorf("ports = %v, want [%d 3000]", got, port)
+	}
+}
+
+func TestStreamForwardHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "localhost:") {
+			t.Errorf("host = %q", r.Host)
+		}
+		if r.Header.Get("Accept-Encoding") != "" {
+			t.Errorf("accept-encoding forwarded: %q", r.Header.Get("Accept-Encoding"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.RequestURI(), body)
+	}))
+	defer srv.Close()
+	port, _ := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+
+	gcm, write, chunks := forwardStream(t)
+	streamForwardHTTP(context.Background(), tunnelInner{
+		Port:    port,
+		Method:  "POST",
+		Path:    "/api/x?y=1",
+		Headers: map[string]string{"Accept-Encoding": "gzip", "Content-Type": "text/plain"},
+		Data:    base64.StdEncoding.EncodeToString([]byte("hi")),
+	}, gcm, "r1", write)
+	close(chunks)
+
+	var body []byte
+	var status float64
+	var done bool
+	for c := range chunks {
+		if e, ok := c["error"]; ok {
+			t.Fatalf("error chunk: %v", e)
+		}
+		if s, ok := c["status"].(float64); ok {
+			status = s
+		}
+		if d, ok := c["data"].(string); ok {
+			b, _ := base64.StdEncoding.DecodeString(d)
+			body = append(body, b...)
+		}
+		done = done || c["done"] == true
+	}
+	if status != 200 || string(body) != "POST /api/x?y=1 hi" || !done {
+		t.Errorf("status=%v body=%q done=%v", status, body, done)
+	}
+
+	// Nothing listening
+	srv.Close()
+	gcm, write, chunks = forwardStream(t)
+	streamForwardHTTP(context.Background(), tunnelInner{Port: port, Path: "/"}, gcm, "r2", write)
+	if c := <-chunks; c["error"] == nil || c["done"] != true {
+		t.Errorf("expected error chunk, got %v", c)
+	}
+}
+
+func TestStreamForwardWS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.CloseNow()
+		for {
+			typ, data, err := c.Read(r.Context())
+			if err != nil {
+				return
+			}
+			c.Write(r.Context(), typ, data)
+		}
+	}))
+	defer srv.Close()
+	port, _ := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+
+	gcm, write, chunks := forwardStream(t)
+	go streamForwardWS(context.Background(), tunnelInner{Port: port, Path: "/hmr", WSID: "w1"}, "pub", gcm, "r1", write)
+	if c := <-chunks; c["open"] != true {
+		t.Fatalf("expected open, got %v", c)
+	}
+
+	// Frames sent out of order are written in order
+	send := func(seq int, msg string) chan error {
+		errc := make(chan error, 1)
+		go func() {
+			errc <- forwardWSSend(context.Background(), tunnelInner{WSID: "w1", Offset: seq, Data: base64.StdEncoding.EncodeToString([]byte(msg))}, "pub")
+		}()
+		return errc
+	}
+	second := send(1, "two")
+	time.Sleep(50 * time.Millisecond)
+	if err := <-send(0, "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"one", "two"} {
+		c := <-chunks
+		got, _ := base64.StdEncoding.DecodeString(fmt.Sprint(c["data"]))
+		if string(got) != want {
+			t.Errorf("frame = %q, want %q", got, want)
+		}
+	}
+
+	if err := forwardWSSend(context.Background(), tunnelInner{WSID: "w1"}, "other-browser"); err == nil {
+		t.Error("another sender wrote to the forward")
+	}
+	if err := forwardWSSend(context.Background(), tunnelInner{WSID: "w1", Done: true}, "pub"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-chunks:
+		if c["done"] != true {
+			t.Errorf("expected done, got %v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("forward not closed")
+	}
+}
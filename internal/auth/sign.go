@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// DeriveSigningKey derives an Ed25519 signing key from the wing's X25519
+// identity key. X25519 keys cannot sign, so signatures (audit chain heads)
+// use this deterministic companion key; no extra key file is needed and the
+// same identity always yields the same signer.
+func DeriveSigningKey(priv *ecdh.PrivateKey) (ed25519.PrivateKey, error) {
+	kdf := hkdf.New(sha256.New, priv.Bytes(), nil, []byte("wt-sign"))
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(kdf, seed); err != nil {
+		return nil, fmt.Errorf("hkdf: %w", err)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
@@ -118,6 +118,15 @@ func (c *Config) SkillsDir() string {
 	return filepath.Join(c.Dir, "skills")
 }
 
+// RelayDSN is the relay database to open: WT_DATABASE_URL when set (e.g. a
+// postgres:// URL), otherwise the local SQLite file.
+func (c *Config) RelayDSN() string {
+	if dsn := os.Getenv("WT_DATABASE_URL"); dsn != "" {
+		return dsn
+	}
+	return c.RelayDBPath()
+}
+
 func (c *Config) RelayDBPath() string {
 	newPath := filepath.Join(c.Dir, "roost.db")
 	oldPath := filepath.Join(c.Dir, "social.db")
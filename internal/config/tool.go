@@ -31,6 +31,46 @@ type ToolConfig struct {
 	Env           map[string]string `yaml:"env,omitempty"`
 	Timeout       string            `yaml:"timeout,omitempty"`
 	MaxConcurrent int               `yaml:"max_concurrent,omitempty"`
+	Params        []ToolParam       `yaml:"params,omitempty"`   // positional args $1..$n; empty = unchecked
+	Approval      string            `yaml:"approval,omitempty"` // never (default), first, always
+
+	MaxCallsPerMinute  int `yaml:"max_calls_per_minute,omitempty"`  // 0 = unlimited
+	MaxCallsPerSession int `yaml:"max_calls_per_session,omitempty"` // 0 = unlimited
+	MaxOutputBytes     int `yaml:"max_output_bytes,omitempty"`      // stdout+stderr passed back; 0 = DefaultToolOutputLimit
+
+	// Sandbox is an optional egg.yaml-style policy (fs, network, env,
+	// resources, base) the tool runs under. Kept raw because the schema
+	// lives in internal/egg; unset runs the tool with full wing privilege.
+	Sandbox yaml.Node `yaml:"sandbox,omitempty"`
+	Path    string    `yaml:"-"` // file the tool was loaded from
+}
+
+// Sandboxed reports whether the tool declares its own sandbox policy.
+func (t *ToolConfig) Sandboxed() bool {
+	return t.Sandbox.Kind != 0
+}
+
+// DefaultToolOutputLimit caps a tool's output when max_output_bytes is unset.
+const DefaultToolOutputLimit = 4 << 20
+
+// OutputLimit returns how many bytes of output are passed back to the agent.
+func (t *ToolConfig) OutputLimit() int64 {
+	if t.MaxOutputBytes > 0 {
+		return int64(t.MaxOutputBytes)
+	}
+	return DefaultToolOutputLimit
+}
+
+// Tool approval modes.
+const (
+	ApprovalNever  = "never"  // run without asking
+	ApprovalFirst  = "first"  // ask once per session, then run freely
+	ApprovalAlways = "always" // ask before every call
+)
+
+// NeedsApproval reports whether calls to the tool are gated on the session owner.
+func (t *ToolConfig) NeedsApproval() bool {
+	return t.Approval == ApprovalFirst || t.Approval == ApprovalAlways
 }
 
 // TimeoutDuration parses the Timeout field as a time.Duration.
@@ -91,6 +131,21 @@ func LoadToolsDir(dir string) ([]*ToolConfig, error) {
 		if tc.Run == "" {
 			return nil, fmt.Errorf("tool config %s: missing run", path)
 		}
+		if err := tc.validateParams(); err != nil {
+			return nil, fmt.Errorf("tool config %s: %w", path, err)
+		}
+		if tc.MaxCallsPerMinute < 0 || tc.MaxCallsPerSession < 0 || tc.MaxConcurrent < 0 || tc.MaxOutputBytes < 0 {
+			return nil, fmt.Errorf("tool config %s: limits must not be negative", path)
+		}
+		switch tc.Approval {
+		case "", ApprovalNever, ApprovalFirst, ApprovalAlways:
+		default:
+			return nil, fmt.Errorf("tool config %s: unknown approval %q (want never, first or always)", path, tc.Approval)
+		}
+		if tc.Sandboxed() && tc.Sandbox.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("tool config %s: sandbox must be a mapping (fs, network, env, ...)", path)
+		}
+		tc.Path = path
 		tools = append(tools, &tc)
 	}
 	return tools, nil
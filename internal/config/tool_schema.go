@@ -0,0 +1,339 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Tool parameter types.
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamNumber = "number"
+	ParamBool   = "bool"
+)
+
+// ToolParam declares one positional argument of a tool. Params map to $1..$n
+// in order; the last one may be variadic and take all remaining args.
+type ToolParam struct {
+	Name        string   `yaml:"name" json:"name"`
+	Type        string   `yaml:"type,omitempty" json:"type,omitempty"` // string (default), int, number, bool
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Optional    bool     `yaml:"optional,omitempty" json:"optional,omitempty"` // may be omitted (trailing params only)
+	Variadic    bool     `yaml:"variadic,omitempty" json:"variadic,omitempty"` // last param only: zero or more values
+	Enum        []string `yaml:"enum,omitempty" json:"enum,omitempty"`
+	Pattern     string   `yaml:"pattern,omitempty" json:"pattern,omitempty"` // regexp the whole value must match
+	MaxLength   int      `yaml:"max_length,omitempty" json:"max_length,omitempty"`
+	Min         *float64 `yaml:"min,omitempty" json:"min,omitempty"` // int/number only
+	Max         *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+
+	re *regexp.Regexp // compiled Pattern, set by validateParams
+}
+
+// validateParams checks a tool's parameter declarations and compiles patterns.
+func (t *ToolConfig) validateParams() error {
+	seen := make(map[string]bool)
+	for i := range t.Params {
+		p := &t.Params[i]
+		if err := validateToolName(p.Name); err != nil {
+			return fmt.Errorf("param %d: %w", i+1, err)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate param %q", p.Name)
+		}
+		seen[p.Name] = true
+		switch p.Type {
+		case "", ParamString, ParamInt, ParamNumber, ParamBool:
+		default:
+			return fmt.Errorf("param %s: unknown type %q (want string, int, number or bool)", p.Name, p.Type)
+		}
+		if p.Variadic && i != len(t.Params)-1 {
+			return fmt.Errorf("param %s: only the last param can be variadic", p.Name)
+		}
+		if !p.Optional && !p.Variadic && i > 0 && t.Params[i-1].Optional {
+			return fmt.Errorf("param %s: required param after optional %s", p.Name, t.Params[i-1].Name)
+		}
+		if len(p.Enum) > 0 && p.Type != "" && p.Type != ParamString {
+			return fmt.Errorf("param %s: enum needs type string", p.Name)
+		}
+		if (p.Min != nil || p.Max != nil) && p.Type != ParamInt && p.Type != ParamNumber {
+			return fmt.Errorf("param %s: min/max need type int or number", p.Name)
+		}
+		if p.Pattern != "" {
+			re, err := compileParamPattern(p.Pattern)
+			if err != nil {
+				return fmt.Errorf("param %s: bad pattern: %w", p.Name, err)
+			}
+			p.re = re
+		}
+	}
+	return nil
+}
+
+func compileParamPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// ValidateArgs checks positional args against the tool's declared params.
+// Tools without params accept any args.
+func (t *ToolConfig) ValidateArgs(args []string) error {
+	if len(t.Params) == 0 {
+		return nil
+	}
+	last := t.Params[len(t.Params)-1]
+	if len(args) > len(t.Params) && !last.Variadic {
+		return fmt.Errorf("too many arguments (want at most %d, got %d)\nusage: %s", len(t.Params), len(args), t.Usage())
+	}
+	for i := range t.Params {
+		p := &t.Params[i]
+		if i >= len(args) {
+			if !p.Optional && !p.Variadic {
+				return fmt.Errorf("missing argument <%s>\nusage: %s", p.Name, t.Usage())
+			}
+			break
+		}
+		values := args[i : i+1]
+		if p.Variadic {
+			values = args[i:]
+		}
+		for _, v := range values {
+			if err := p.check(v); err != nil {
+				return fmt.Errorf("argument <%s>: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *ToolParam) check(v string) error {
+	if strings.IndexByte(v, 0) >= 0 {
+		return fmt.Errorf("contains a NUL byte")
+	}
+	if p.MaxLength > 0 && len(v) > p.MaxLength {
+		return fmt.Errorf("longer than %d bytes", p.MaxLength)
+	}
+	switch p.Type {
+	case ParamInt, ParamNumber:
+		var n float64
+		if p.Type == ParamInt {
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not an integer", v)
+			}
+			n = float64(i)
+		} else {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", v)
+			}
+			n = f
+		}
+		if p.Min != nil && n < *p.Min {
+			return fmt.Errorf("%s is below the minimum %v", v, *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return fmt.Errorf("%s is above the maximum %v", v, *p.Max)
+		}
+	case ParamBool:
+		if v != "true" && v != "false" {
+			return fmt.Errorf("%q is not true or false", v)
+		}
+	}
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, v) {
+		return fmt.Errorf("%q is not one of %s", v, strings.Join(p.Enum, ", "))
+	}
+	if p.Pattern != "" {
+		re := p.re
+		if re == nil {
+			var err error
+			if re, err = compileParamPattern(p.Pattern); err != nil {
+				return fmt.Errorf("bad pattern: %w", err)
+			}
+		}
+		if !re.MatchString(v) {
+			return fmt.Errorf("%q does not match %s", v, p.Pattern)
+		}
+	}
+	return nil
+}
+
+// Usage returns a one-line synopsis like "deploy <env> [tag] [flags...]".
+func (t *ToolConfig) Usage() string {
+	return ToolUsage(t.Name, t.Params)
+}
+
+// ToolUsage formats a synopsis for a tool name and its params.
+func ToolUsage(name string, params []ToolParam) string {
+	parts := []string{name}
+	for _, p := range params {
+		switch {
+		case p.Variadic:
+			parts = append(parts, "["+p.Name+"...]")
+		case p.Optional:
+			parts = append(parts, "["+p.Name+"]")
+		default:
+			parts = append(parts, "<"+p.Name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) object describing the
+// tool's arguments by name. Tools without params take a free-form "args"
+// array. Callers using named arguments pass them in param order as $1..$n.
+func (t *ToolConfig) JSONSchema() map[string]any {
+	return ToolJSONSchema(t.Params)
+}
+
+// ToolJSONSchema builds the input schema for a list of params.
+func ToolJSONSchema(params []ToolParam) map[string]any {
+	if len(params) == 0 {
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"args": map[string]any{
+					"type":        "array",
+					"items":       map[string]any{"type": "string"},
+					"description": "Positional arguments",
+				},
+			},
+		}
+	}
+	props := make(map[string]any, len(params))
+	required := []string{}
+	for _, p := range params {
+		s := paramSchema(p)
+		if p.Variadic {
+			s = map[string]any{"type": "array", "items": s}
+			if p.Description != "" {
+				s["description"] = p.Description
+			}
+		}
+		props[p.Name] = s
+		if !p.Optional && !p.Variadic {
+			required = append(required, p.Name)
+		}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func paramSchema(p ToolParam) map[string]any {
+	s := map[string]any{}
+	switch p.Type {
+	case ParamInt:
+		s["type"] = "integer"
+	case ParamNumber:
+		s["type"] = "number"
+	case ParamBool:
+		s["type"] = "boolean"
+	default:
+		s["type"] = "string"
+		if p.MaxLength > 0 {
+			s["maxLength"] = p.MaxLength
+		}
+		if p.Pattern != "" {
+			s["pattern"] = "^(?:" + p.Pattern + ")$"
+		}
+	}
+	if p.Description != "" && !p.Variadic {
+		s["description"] = p.Description
+	}
+	if len(p.Enum) > 0 {
+		s["enum"] = p.Enum
+	}
+	if p.Min != nil {
+		s["minimum"] = *p.Min
+	}
+	if p.Max != nil {
+		s["maximum"] = *p.Max
+	}
+	return s
+}
+
+// ToolArgs converts named arguments (as described by ToolJSONSchema) into
+// positional args in param order. Tools without params take an "args" array.
+// Values are only converted here; ValidateArgs still checks them.
+func ToolArgs(params []ToolParam, named map[string]any) ([]string, error) {
+	if len(params) == 0 {
+		raw, ok := named["args"]
+		if !ok || raw == nil {
+			return nil, nil
+		}
+		return argStrings("args", raw)
+	}
+	known := make(map[string]bool, len(params))
+	for _, p := range params {
+		known[p.Name] = true
+	}
+	for k := range named {
+		if !known[k] {
+			return nil, fmt.Errorf("unknown argument %q", k)
+		}
+	}
+	var args []string
+	missing := ""
+	for _, p := range params {
+		v, ok := named[p.Name]
+		if !ok || v == nil {
+			if missing == "" {
+				missing = p.Name
+			}
+			continue
+		}
+		if missing != "" {
+			return nil, fmt.Errorf("argument %q given without %q before it", p.Name, missing)
+		}
+		if p.Variadic {
+			vs, err := argStrings(p.Name, v)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, vs...)
+			continue
+		}
+		s, err := argString(p.Name, v)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, s)
+	}
+	return args, nil
+}
+
+func argStrings(name string, v any) ([]string, error) {
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("argument %q: want an array", name)
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		s, err := argString(name, item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func argString(name string, v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case fmt.Stringer: // json.Number
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("argument %q: want a string, number or boolean", name)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -171,3 +172,195 @@ func TestToolNames(t *testing.T) {
 		t.Errorf("ToolNames = %v", names)
 	}
 }
+
+func TestLoadToolsDir_Params(t *testing.T) {
+	dir := t.TempDir()
+	yaml := `name: deploy
+run: ./deploy.sh "$1" "$2"
+params:
+  - name: env
+    enum: [staging, prod]
+  - name: replicas
+    type: int
+    min: 1
+    max: 10
+  - name: tag
+    pattern: "v[0-9.]+"
+    optional: true
+`
+	os.WriteFile(filepath.Join(dir, "deploy.yaml"), []byte(yaml), 0600)
+	tools, err := LoadToolsDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tc := tools[0]
+	if len(tc.Params) != 3 || tc.Params[1].Type != ParamInt || tc.Params[2].re == nil {
+		t.Fatalf("params = %+v", tc.Params)
+	}
+	if got := tc.Usage(); got != "deploy <env> <replicas> [tag]" {
+		t.Errorf("usage = %q", got)
+	}
+}
+
+func TestLoadToolsDir_BadParams(t *testing.T) {
+	cases := map[string]string{
+		"unknown type":          "  - name: a\n    type: date\n",
+		"bad pattern":           "  - name: a\n    pattern: \"(\"\n",
+		"variadic not last":     "  - name: a\n    variadic: true\n  - name: b\n",
+		"required after option": "  - name: a\n    optional: true\n  - name: b\n",
+		"duplicate":             "  - name: a\n  - name: a\n",
+		"min on string":         "  - name: a\n    min: 1\n",
+		"enum on int":           "  - name: a\n    type: int\n    enum: [\"1\"]\n",
+	}
+	for name, params := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "t.yaml"), []byte("name: t\nrun: echo\nparams:\n"+params), 0600)
+			if _, err := LoadToolsDir(dir); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadToolsDir_Approval(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("name: a\nrun: echo\napproval: always\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("name: b\nrun: echo\n"), 0600)
+	tools, err := LoadToolsDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range tools {
+		if want := tc.Name == "a"; tc.NeedsApproval() != want {
+			t.Errorf("%s: NeedsApproval = %v, want %v", tc.Name, tc.NeedsApproval(), want)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "c.yaml"), []byte("name: c\nrun: echo\napproval: sometimes\n"), 0600)
+	if _, err := LoadToolsDir(dir); err == nil || !strings.Contains(err.Error(), "approval") {
+		t.Fatalf("expected approval error, got %v", err)
+	}
+}
+
+func TestLoadToolsDir_Sandbox(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("name: a\nrun: kubectl get pods\nsandbox:\n  fs: [\"ro:~/.kube\"]\n  network: [\"*.example.com\"]\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("name: b\nrun: echo\n"), 0600)
+	tools, err := LoadToolsDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range tools {
+		if want := tc.Name == "a"; tc.Sandboxed() != want {
+			t.Errorf("%s: Sandboxed = %v, want %v", tc.Name, tc.Sandboxed(), want)
+		}
+		if tc.Path != filepath.Join(dir, tc.Name+".yaml") {
+			t.Errorf("%s: Path = %q", tc.Name, tc.Path)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "c.yaml"), []byte("name: c\nrun: echo\nsandbox: strict\n"), 0600)
+	if _, err := LoadToolsDir(dir); err == nil || !strings.Contains(err.Error(), "sandbox") {
+		t.Fatalf("expected sandbox error, got %v", err)
+	}
+}
+
+func TestToolConfig_ValidateArgs(t *testing.T) {
+	one, ten := 1.0, 10.0
+	tc := &ToolConfig{Name: "deploy", Params: []ToolParam{
+		{Name: "env", Enum: []string{"staging", "prod"}},
+		{Name: "replicas", Type: ParamInt, Min: &one, Max: &ten},
+		{Name: "files", Variadic: true, Pattern: `[a-z]+\.txt`, MaxLength: 12},
+	}}
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"prod", "3"}, true},
+		{[]string{"prod", "3", "a.txt", "b.txt"}, true},
+		{[]string{"prod"}, false},                         // missing replicas
+		{[]string{"dev", "3"}, false},                     // not in enum
+		{[]string{"prod", "three"}, false},                // not an int
+		{[]string{"prod", "11"}, false},                   // above max
+		{[]string{"prod", "3", "a.txt; rm -rf /"}, false}, // pattern
+		{[]string{"prod", "3", "abcdefghij.txt"}, false},  // max length
+		{[]string{"prod", "3", "a\x00.txt"}, false},       // NUL
+	}
+	for _, tt := range tests {
+		err := tc.ValidateArgs(tt.args)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateArgs(%q) = %v, want ok=%v", tt.args, err, tt.ok)
+		}
+	}
+
+	// No params: anything goes
+	if err := (&ToolConfig{Name: "raw"}).ValidateArgs([]string{"x", "y"}); err != nil {
+		t.Errorf("unchecked tool rejected args: %v", err)
+	}
+	// Fixed arity rejects extras
+	fixed := &ToolConfig{Name: "f", Params: []ToolParam{{Name: "a", Type: ParamBool}}}
+	if err := fixed.ValidateArgs([]string{"true", "extra"}); err == nil {
+		t.Error("extra arg accepted")
+	}
+	if err := fixed.ValidateArgs([]string{"yes"}); err == nil {
+		t.Error("non-bool accepted")
+	}
+}
+
+func TestToolConfig_JSONSchema(t *testing.T) {
+	tc := &ToolConfig{Name: "deploy", Params: []ToolParam{
+		{Name: "env", Enum: []string{"staging", "prod"}, Description: "Target"},
+		{Name: "replicas", Type: ParamInt},
+		{Name: "files", Variadic: true},
+	}}
+	s := tc.JSONSchema()
+	if s["additionalProperties"] != false {
+		t.Error("schema allows additional properties")
+	}
+	req := s["required"].([]string)
+	if len(req) != 2 || req[0] != "env" || req[1] != "replicas" {
+		t.Errorf("required = %v", req)
+	}
+	props := s["properties"].(map[string]any)
+	if props["replicas"].(map[string]any)["type"] != "integer" {
+		t.Errorf("replicas = %v", props["replicas"])
+	}
+	if props["files"].(map[string]any)["type"] != "array" {
+		t.Errorf("files = %v", props["files"])
+	}
+	if env := props["env"].(map[string]any); env["description"] != "Target" || len(env["enum"].([]string)) != 2 {
+		t.Errorf("env = %v", env)
+	}
+}
+
+func TestToolArgs(t *testing.T) {
+	params := []ToolParam{
+		{Name: "env"},
+		{Name: "replicas", Type: ParamInt},
+		{Name: "dry_run", Type: ParamBool, Optional: true},
+		{Name: "files", Variadic: true},
+	}
+	args, err := ToolArgs(params, map[string]any{"env": "prod", "replicas": 3.0, "dry_run": true, "files": []any{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "prod 3 true a b" {
+		t.Errorf("args = %q", args)
+	}
+	if args, _ := ToolArgs(params, map[string]any{"env": "prod", "replicas": 2.0}); len(args) != 2 {
+		t.Errorf("trailing optional: args = %q", args)
+	}
+	if _, err := ToolArgs(params, map[string]any{"env": "prod", "dry_run": false}); err == nil {
+		t.Error("gap before dry_run accepted")
+	}
+	if _, err := ToolArgs(params, map[string]any{"env": "prod", "replicas": 1.0, "bogus": "x"}); err == nil {
+		t.Error("unknown argument accepted")
+	}
+	if _, err := ToolArgs(params, map[string]any{"env": map[string]any{}}); err == nil {
+		t.Error("object value accepted")
+	}
+	if args, _ := ToolArgs(nil, map[string]any{"args": []any{"x", "y"}}); strings.Join(args, ",") != "x,y" {
+		t.Errorf("no-params args = %q", args)
+	}
+}
@@ -20,9 +20,11 @@ type WingConfig struct {
 	EggConfig string     `yaml:"egg_config,omitempty"`
 	Conv      string     `yaml:"conv,omitempty"`
 	Audit     bool       `yaml:"audit,omitempty"`
+	Notarize  bool       `yaml:"notarize,omitempty"` // send signed audit chain heads to the relay
 	Debug     bool       `yaml:"debug,omitempty"`
 	Locked    bool       `yaml:"locked,omitempty"`     // explicit lock mode toggle
 	Spectate  bool       `yaml:"spectate,omitempty"`   // allow spectator (read-only) session viewing
+	ForwardPorts []int   `yaml:"forward_ports,omitempty"` // egg.yaml ports previews may reach before a session process listens on them
 	AuthTTL   string     `yaml:"auth_ttl,omitempty"`   // passkey auth token duration (default "1h")
 	AllowKeys []AllowKey `yaml:"allow_keys,omitempty"`
 	Admins      []string   `yaml:"admins,omitempty"`       // emails with admin role (see all sessions, all paths)
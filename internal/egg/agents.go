@@ -12,9 +12,13 @@ type AgentProfile struct {
 	WriteDirs     []string // relative to $HOME, need write access
 	WriteRegex    []string // dirs needing UseRegex (e.g. ".claude" covers .claude.json)
 	SettingsFile  string   // agent config file relative to HOME (e.g. ".claude/settings.json")
+	MCPFile       string   // where the agent reads MCP servers, relative to HOME (default SettingsFile; .toml = Codex format)
 	SessionDir    string   // agent session storage relative to $HOME (e.g. ".claude/projects")
 	ResumeFlag    string   // CLI flag for resuming (e.g. "--resume")
 	SessionIDFlag string   // CLI flag for controlling session ID (e.g. "--session-id")
+
+	Attention  []AttentionRule // screen patterns meaning the agent needs the user
+	IgnoreBell bool            // BEL is noise (shell tab completion), not a notification
 }
 
 // macOSKeychainEnv are env vars required for Apple Keychain access.
@@ -33,33 +37,54 @@ var agentProfiles = map[string]AgentProfile{
 		WriteDirs:     []string{".cache/claude"},
 		WriteRegex:    []string{".claude"},
 		SettingsFile:  ".claude/settings.json",
+		MCPFile:       ".claude.json",
 		SessionDir:    ".claude/projects",
 		ResumeFlag:    "--resume",
 		SessionIDFlag: "--session-id",
+		Attention: []AttentionRule{
+			{Kind: AttentionPermission, Pattern: `Do you want to (proceed|make this edit|create|allow)`, Approve: "\r", Deny: "\x1b"},
+			{Kind: AttentionError, Pattern: `API Error: \d+`},
+		},
 	},
 	"codex": {
-		Domains:       []string{"api.openai.com", "*.openai.com", "chatgpt.com", "*.chatgpt.com"},
-		EnvVars:       []string{"OPENAI_API_KEY"},
-		WriteDirs:     []string{".codex"},
-		SettingsFile:  ".codex/settings.json",
-		SessionDir:    ".codex/sessions",
-		ResumeFlag:    "resume",
+		Domains:      []string{"api.openai.com", "*.openai.com", "chatgpt.com", "*.chatgpt.com"},
+		EnvVars:      []string{"OPENAI_API_KEY"},
+		WriteDirs:    []string{".codex"},
+		SettingsFile: ".codex/settings.json",
+		MCPFile:      ".codex/config.toml",
+		SessionDir:   ".codex/sessions",
+		ResumeFlag:   "resume",
+		Attention: []AttentionRule{
+			{Kind: AttentionPermission, Pattern: `Allow command\?|Would you like to (run the following command|make the following edits)\?`, Approve: "y", Deny: "n"},
+			{Kind: AttentionError, Pattern: `■ .*(error|Error)`},
+		},
 	},
 	"cursor": {
 		Domains:      []string{"api.anthropic.com", "api.openai.com", "*.cursor.sh"},
 		EnvVars:      []string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY"},
 		WriteDirs:    []string{".cursor", ".config", "Library/Caches/cursor-compile-cache"},
 		SettingsFile: ".cursor/cli-config.json",
+		MCPFile:      ".cursor/mcp.json",
 		ResumeFlag:   "--resume",
+		Attention: []AttentionRule{
+			{Kind: AttentionPermission, Pattern: `Run (this )?command\?`, Approve: "y", Deny: "n"},
+		},
 	},
 	"ollama": {
 		Domains:   []string{"localhost"},
 		WriteDirs: []string{".ollama"},
+		Attention: []AttentionRule{
+			{Kind: AttentionDone, Pattern: `^>>>( |$)`, Cursor: true, AfterInput: true},
+		},
 	},
 	"gemini": {
 		Domains:   []string{"*.googleapis.com", "generativelanguage.googleapis.com"},
 		EnvVars:   []string{"GEMINI_API_KEY", "GOOGLE_API_KEY"},
 		WriteDirs: []string{".gemini"},
+		MCPFile:   ".gemini/settings.json",
+		Attention: []AttentionRule{
+			{Kind: AttentionPermission, Pattern: `Allow execution|Apply this change\?`, Approve: "\r", Deny: "\x1b"},
+		},
 	},
 	"opencode": {
 		Domains:    []string{"*.anthropic.com", "*.openai.com", "*.googleapis.com"},
@@ -67,6 +92,9 @@ var agentProfiles = map[string]AgentProfile{
 		WriteDirs:  []string{".opencode"},
 		SessionDir: ".opencode/sessions",
 	},
+	"bash": {Attention: shellAttention, IgnoreBell: true},
+	"zsh":  {Attention: shellAttention, IgnoreBell: true},
+	"sh":   {Attention: shellAttention, IgnoreBell: true},
 }
 
 // Profile returns the agent profile for the given agent name.
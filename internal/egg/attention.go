@@ -0,0 +1,247 @@
+package egg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Attention kinds reported by AttentionDetector. They travel in
+// session.attention so notifications can say what the user is needed for.
+const (
+	AttentionPermission = "permission" // agent wants approval to run a tool or command
+	AttentionQuestion   = "question"   // agent is waiting on an answer (also the bell fallback)
+	AttentionDone       = "done"       // agent or command finished, back at the prompt
+	AttentionError      = "error"      // agent stopped on an error
+	AttentionTool       = "tool"       // a privileged tool call waits on the owner's approval (not screen-detected)
+)
+
+// AttentionRule maps a screen pattern to an attention kind.
+type AttentionRule struct {
+	Kind       string // one of the Attention* kinds
+	Pattern    string // regexp matched against each visible screen row (plain text)
+	Cursor     bool   // only match the row the cursor is on (prompts)
+	AfterInput bool   // only fire after the user submitted input (Enter) since the last event
+	Approve    string // keystrokes that answer the prompt "yes" ("" = no remote reply)
+	Deny       string // keystrokes that answer the prompt "no"
+}
+
+// AttentionEvent is what the detector reports when a rule starts matching.
+type AttentionEvent struct {
+	Kind    string `json:"kind"`
+	Detail  string `json:"detail,omitempty"` // screen text above the prompt (e.g. the command awaiting approval)
+	Nonce   string `json:"nonce,omitempty"`  // identifies this prompt; replies must echo it
+	Approve string `json:"-"`                // reply keystrokes never leave the wing
+	Deny    string `json:"-"`
+}
+
+// Replyable reports whether the event can be answered remotely.
+func (e AttentionEvent) Replyable() bool {
+	return e.Approve != "" && e.Deny != ""
+}
+
+// Keys returns the keystrokes for a reply choice ("approve" or "deny").
+func (e AttentionEvent) Keys(choice string) string {
+	switch choice {
+	case "approve":
+		return e.Approve
+	case "deny":
+		return e.Deny
+	}
+	return ""
+}
+
+const (
+	maxAttentionDetailLines = 8
+	maxAttentionDetail      = 1024
+)
+
+// shellAttention detects a shell prompt coming back after a command completes.
+var shellAttention = []AttentionRule{
+	{Kind: AttentionDone, Pattern: `[$#%>❯] ?$`, Cursor: true, AfterInput: true},
+}
+
+type compiledRule struct {
+	AttentionRule
+	re *regexp.Regexp
+}
+
+// AttentionDetector feeds PTY output through a screen-only VTerm and matches
+// the agent's AttentionRules against what is actually on screen. It is
+// edge-triggered: a kind fires once when it appears and again only after the
+// screen stopped matching. Agents without a rule match fall back to the
+// repeated-BEL heuristic unless their profile sets IgnoreBell.
+type AttentionDetector struct {
+	mu         sync.Mutex
+	vt         *VTerm
+	rules      []compiledRule
+	ignoreBell bool
+	lastKind   string          // kind currently matched on screen ("" = none)
+	pending    *AttentionEvent // replyable prompt currently on screen
+	lastBell   bool            // previous chunk contained BEL
+	armed      bool            // user submitted input since the last event
+}
+
+// NewAttentionDetector builds a detector for the given agent's profile.
+// Invalid patterns are logged and skipped.
+func NewAttentionDetector(agent string, cols, rows int) *AttentionDetector {
+	if cols <= 0 || rows <= 0 {
+		cols, rows = 80, 24
+	}
+	p := Profile(agent)
+	d := &AttentionDetector{
+		vt:         newVTerm(cols, rows, 0),
+		ignoreBell: p.IgnoreBell,
+	}
+	for _, r := range p.Attention {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			log.Printf("attention: agent %s: bad pattern %q: %v", agent, r.Pattern, err)
+			continue
+		}
+		d.rules = append(d.rules, compiledRule{AttentionRule: r, re: re})
+	}
+	go d.vt.discardReplies()
+	return d
+}
+
+// Feed writes PTY output to the screen model and reports the attention event
+// that just appeared. ok is false if nothing new needs the user.
+func (d *AttentionDetector) Feed(p []byte) (ev AttentionEvent, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.vt.Write(p)
+	bell := !d.ignoreBell && bytes.IndexByte(p, 0x07) >= 0
+	prevBell := d.lastBell
+	d.lastBell = bell
+
+	if r, lines, row := d.match(); r != nil {
+		if r.Kind == d.lastKind {
+			return AttentionEvent{}, false
+		}
+		d.lastKind = r.Kind
+		ev = AttentionEvent{Kind: r.Kind, Approve: r.Approve, Deny: r.Deny}
+		if !r.Cursor {
+			ev.Detail = attentionDetail(lines, row)
+		}
+		d.pending = nil
+		if ev.Replyable() {
+			ev.Nonce = attentionNonce()
+			d.pending = &ev
+		}
+		if r.AfterInput && !d.armed {
+			return AttentionEvent{}, false
+		}
+		d.armed = false
+		return ev, true
+	}
+	d.lastKind = ""
+	d.pending = nil
+
+	// Repeated BEL = real notification (a lone BEL is usually an OSC terminator).
+	if bell && prevBell {
+		return AttentionEvent{Kind: AttentionQuestion}, true
+	}
+	return AttentionEvent{}, false
+}
+
+// Pending returns the replyable prompt currently on screen, if any.
+func (d *AttentionDetector) Pending() (AttentionEvent, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending == nil {
+		return AttentionEvent{}, false
+	}
+	return *d.pending, true
+}
+
+// NoteInput records user input. Submitting a line (Enter) arms AfterInput rules.
+func (d *AttentionDetector) NoteInput(p []byte) {
+	if bytes.ContainsAny(p, "\r\n") {
+		d.mu.Lock()
+		d.armed = true
+		d.mu.Unlock()
+	}
+}
+
+// Resize keeps the screen model in step with the PTY dimensions.
+func (d *AttentionDetector) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	d.vt.Resize(cols, rows)
+}
+
+// Close releases the screen model.
+func (d *AttentionDetector) Close() error {
+	return d.vt.Close()
+}
+
+// match returns the first rule matching the current screen, or nil, along
+// with the screen rows and the matched row index.
+// Must be called with mu held.
+func (d *AttentionDetector) match() (*compiledRule, []string, int) {
+	if len(d.rules) == 0 {
+		return nil, nil, 0
+	}
+	lines, cursor := d.vt.ScreenLines()
+	for i := range d.rules {
+		r := &d.rules[i]
+		if r.Cursor {
+			if cursor >= 0 && cursor < len(lines) && r.re.MatchString(lines[cursor]) {
+				return r, lines, cursor
+			}
+			continue
+		}
+		for row, line := range lines {
+			if r.re.MatchString(line) {
+				return r, lines, row
+			}
+		}
+	}
+	return nil, nil, 0
+}
+
+// attentionDetail collects the prompt's context: the matched row plus the
+// rows above it up to the top of its dialog box (or a run of blank rows),
+// with box-drawing borders stripped.
+func attentionDetail(lines []string, row int) string {
+	var out []string
+	blanks := 0
+	for i := row; i >= 0 && len(out) < maxAttentionDetailLines; i-- {
+		raw := strings.TrimSpace(lines[i])
+		if i < row && (strings.HasPrefix(raw, "╭") || strings.HasPrefix(raw, "┌")) {
+			break
+		}
+		line := strings.TrimSpace(strings.Trim(raw, "│┃║╭╮╰╯┌┐└┘─━ "))
+		if line == "" {
+			blanks++
+			if blanks >= 2 && len(out) > 0 {
+				break
+			}
+			continue
+		}
+		blanks = 0
+		out = append(out, line)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	detail := strings.Join(out, "\n")
+	if len(detail) > maxAttentionDetail {
+		detail = detail[:maxAttentionDetail]
+	}
+	return detail
+}
+
+// attentionNonce returns a random 8-byte hex prompt ID.
+func attentionNonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,161 @@
+package egg
+
+import "testing"
+
+func TestAttentionClaudePermission(t *testing.T) {
+	d := NewAttentionDetector("claude", 80, 24)
+	defer d.Close()
+
+	if ev, ok := d.Feed([]byte("Thinking...\r\n")); ok {
+		t.Fatalf("plain output fired %q", ev.Kind)
+	}
+	ev, ok := d.Feed([]byte("Bash command\r\n  rm -rf build\r\nDo you want to proceed?\r\n❯ 1. Yes\r\n"))
+	if !ok || ev.Kind != AttentionPermission {
+		t.Fatalf("kind = %q, want %q", ev.Kind, AttentionPermission)
+	}
+	// Still on screen — edge-triggered, no refire
+	if ev, ok := d.Feed([]byte("\x1b[K")); ok {
+		t.Fatalf("refired %q while prompt still showing", ev.Kind)
+	}
+	// Dialog cleared, then shown again
+	d.Feed([]byte("\x1b[2J\x1b[HRunning...\r\n"))
+	if ev, _ := d.Feed([]byte("Do you want to make this edit to main.go?\r\n")); ev.Kind != AttentionPermission {
+		t.Fatalf("second prompt kind = %q, want %q", ev.Kind, AttentionPermission)
+	}
+}
+
+func TestAttentionClaudeError(t *testing.T) {
+	d := NewAttentionDetector("claude", 80, 24)
+	defer d.Close()
+
+	if ev, _ := d.Feed([]byte("API Error: 529 overloaded\r\n")); ev.Kind != AttentionError {
+		t.Fatalf("kind = %q, want %q", ev.Kind, AttentionError)
+	}
+}
+
+func TestAttentionCodexApproval(t *testing.T) {
+	d := NewAttentionDetector("codex", 80, 24)
+	defer d.Close()
+
+	if ev, _ := d.Feed([]byte("Would you like to run the following command?\r\n$ make test\r\n")); ev.Kind != AttentionPermission {
+		t.Fatalf("kind = %q, want %q", ev.Kind, AttentionPermission)
+	}
+}
+
+func TestAttentionPromptDetail(t *testing.T) {
+	d := NewAttentionDetector("claude", 60, 20)
+	defer d.Close()
+
+	screen := "earlier output\r\n\r\n\r\n" +
+		"╭──────────────────────────────╮\r\n" +
+		"│ Bash command                 │\r\n" +
+		"│                              │\r\n" +
+		"│   rm -rf build               │\r\n" +
+		"│   Remove build directory     │\r\n" +
+		"│                              │\r\n" +
+		"│ Do you want to proceed?      │\r\n" +
+		"│ ❯ 1. Yes                     │\r\n"
+	ev, ok := d.Feed([]byte(screen))
+	if !ok {
+		t.Fatal("prompt not detected")
+	}
+	want := "Bash command\nrm -rf build\nRemove build directory\nDo you want to proceed?"
+	if ev.Detail != want {
+		t.Errorf("detail = %q, want %q", ev.Detail, want)
+	}
+	if !ev.Replyable() || ev.Nonce == "" {
+		t.Fatalf("permission prompt not replyable: %+v", ev)
+	}
+	if ev.Keys("approve") != "\r" || ev.Keys("deny") != "\x1b" || ev.Keys("maybe") != "" {
+		t.Errorf("keys = %q/%q/%q", ev.Keys("approve"), ev.Keys("deny"), ev.Keys("maybe"))
+	}
+}
+
+func TestAttentionPendingClearsWithScreen(t *testing.T) {
+	d := NewAttentionDetector("codex", 80, 24)
+	defer d.Close()
+
+	if _, ok := d.Pending(); ok {
+		t.Fatal("pending before any prompt")
+	}
+	fired, _ := d.Feed([]byte("Allow command?\r\n"))
+	pending, ok := d.Pending()
+	if !ok || pending.Nonce != fired.Nonce {
+		t.Fatalf("pending = %+v, want nonce %q", pending, fired.Nonce)
+	}
+	d.Feed([]byte("\x1b[2J\x1b[Hrunning\r\n"))
+	if _, ok := d.Pending(); ok {
+		t.Fatal("pending survived prompt leaving the screen")
+	}
+	// A new prompt gets a new nonce
+	again, _ := d.Feed([]byte("Allow command?\r\n"))
+	if again.Nonce == "" || again.Nonce == fired.Nonce {
+		t.Errorf("nonce reused: %q", again.Nonce)
+	}
+}
+
+func TestAttentionErrorNotReplyable(t *testing.T) {
+	d := NewAttentionDetector("claude", 80, 24)
+	defer d.Close()
+
+	ev, _ := d.Feed([]byte("API Error: 500\r\n"))
+	if ev.Replyable() {
+		t.Error("error event should not be replyable")
+	}
+	if _, ok := d.Pending(); ok {
+		t.Error("error event should not be pending")
+	}
+}
+
+func TestAttentionShellDoneAfterCommand(t *testing.T) {
+	d := NewAttentionDetector("bash", 80, 24)
+	defer d.Close()
+
+	// Initial prompt: nothing has been asked of the shell yet
+	if ev, ok := d.Feed([]byte("user@host:~$ ")); ok {
+		t.Fatalf("initial prompt fired %q", ev.Kind)
+	}
+	// Typing without Enter does not arm
+	d.Feed([]byte("l"))
+	if ev, ok := d.Feed([]byte("\b \b")); ok {
+		t.Fatalf("erased input fired %q", ev.Kind)
+	}
+	// Run a command; prompt returns after output
+	d.NoteInput([]byte("ls\r"))
+	d.Feed([]byte("ls\r\n"))
+	if ev, _ := d.Feed([]byte("a.txt  b.txt\r\nuser@host:~$ ")); ev.Kind != AttentionDone {
+		t.Fatalf("kind = %q, want %q", ev.Kind, AttentionDone)
+	}
+}
+
+func TestAttentionShellIgnoresBell(t *testing.T) {
+	d := NewAttentionDetector("bash", 80, 24)
+	defer d.Close()
+
+	d.Feed([]byte("\x07"))
+	if ev, ok := d.Feed([]byte("\x07")); ok {
+		t.Fatalf("shell bell fired %q", ev.Kind)
+	}
+}
+
+func TestAttentionBellFallback(t *testing.T) {
+	d := NewAttentionDetector("opencode", 80, 24)
+	defer d.Close()
+
+	if ev, ok := d.Feed([]byte("\x1b]0;title\x07")); ok {
+		t.Fatalf("single BEL fired %q", ev.Kind)
+	}
+	if ev, _ := d.Feed([]byte("\x07")); ev.Kind != AttentionQuestion {
+		t.Fatalf("repeated BEL kind = %q, want %q", ev.Kind, AttentionQuestion)
+	}
+}
+
+func TestAttentionProfilePatternsCompile(t *testing.T) {
+	for name, p := range agentProfiles {
+		d := NewAttentionDetector(name, 80, 24)
+		if len(d.rules) != len(p.Attention) {
+			t.Errorf("%s: %d of %d attention patterns compiled", name, len(d.rules), len(p.Attention))
+		}
+		d.Close()
+	}
+}
@@ -3,6 +3,7 @@ package egg
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,6 +17,7 @@ type inputAuditor struct {
 	mu         sync.Mutex
 	escState   int // 0=normal, 1=got ESC, 2=in CSI sequence
 	flushTimer *time.Timer
+	chain      *auditChain // nil = no hash chain
 }
 
 func newInputAuditor(path string) (*inputAuditor, error) {
@@ -65,7 +67,11 @@ func (a *inputAuditor) emitLine() {
 	line := string(a.buf)
 	a.buf = a.buf[:0]
 	ts := time.Now().UTC().Format(time.RFC3339)
-	fmt.Fprintf(a.file, "%s\t%s\n", ts, line)
+	rec := fmt.Sprintf("%s\t%s\n", ts, line)
+	// Only chain what reached the file (writes fail once the auditor is closed)
+	if _, err := a.file.WriteString(rec); err == nil && a.chain != nil {
+		a.chain.Add(ChainStreamLog, []byte(rec))
+	}
 	if a.flushTimer != nil {
 		a.flushTimer.Stop()
 		a.flushTimer = nil
@@ -102,6 +108,25 @@ func (a *inputAuditor) resetFlushTimer() {
 	})
 }
 
+// Record appends an event reported by the wing, such as a tool approval, as
+// "<ts> <record>". Typed lines have a tab after the timestamp and events a
+// space, so nothing typed into the session can pass for an event.
+func (a *inputAuditor) Record(record string) error {
+	if strings.ContainsAny(record, "\r\n") {
+		return fmt.Errorf("audit record spans lines")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rec := fmt.Sprintf("%s %s\n", time.Now().UTC().Format(time.RFC3339), record)
+	if _, err := a.file.WriteString(rec); err != nil {
+		return err
+	}
+	if a.chain != nil {
+		a.chain.Add(ChainStreamLog, []byte(rec))
+	}
+	return nil
+}
+
 // Close flushes any remaining buffer and closes the file.
 func (a *inputAuditor) Close() {
 	a.mu.Lock()
@@ -0,0 +1,463 @@
+package egg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit chain streams: the uncompressed audit.pty.gz stream and audit.log.
+const (
+	ChainStreamPTY = "pty"
+	ChainStreamLog = "log"
+)
+
+const (
+	chainMagic          = "wtchain1"
+	chainFile           = "audit.chain"
+	chainCheckpointTick = 5 * time.Second
+	chainSignEvery      = 12 // checkpoints between signatures (~1 min)
+)
+
+// auditChain makes a session's audit files tamper-evident. Bytes written to
+// each stream are hashed into batches; every checkpoint appends one entry per
+// stream with the batch digest and the running chain head
+//
+//	head_n = SHA256(head_n-1 || stream || 0x00 || uint64be(end) || SHA256(batch))
+//
+// and every chainSignEvery checkpoints the head is signed with the wing's
+// signing key. Close appends a final signed seal. audit.chain is text, one
+// record per line:
+//
+//	wtchain1 <session> <pubkey|->
+//	c <seq> <stream> <end> <batch-sha256> <head>
+//	s <seq> <head> <unix> <sig>          (signature)
+//	f <seq> <head> <unix> <sig>          (final seal)
+type auditChain struct {
+	mu        sync.Mutex
+	f         *os.File
+	sessionID string
+	key       ed25519.PrivateKey // nil = unsigned chain
+	head      [32]byte
+	seq       int
+	ends      map[string]int64     // bytes of each stream covered by entries
+	pending   map[string]hash.Hash // digest of bytes since the last entry
+	pendLen   map[string]int64
+	flushers  map[string]func() // make pending bytes durable before an entry covers them
+	sinceSign int
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// ChainHead is a signed chain head, suitable for sending to a notary.
+type ChainHead struct {
+	SessionID string `json:"session_id"`
+	Seq       int    `json:"seq"`
+	Head      string `json:"head"`
+	SignedAt  int64  `json:"signed_at"`
+	Sig       string `json:"sig"`
+	Key       string `json:"key"`
+	Sealed    bool   `json:"sealed,omitempty"`
+}
+
+// newAuditChain creates audit.chain in dir and starts periodic checkpoints.
+func newAuditChain(dir, sessionID string, key ed25519.PrivateKey) (*auditChain, error) {
+	f, err := os.OpenFile(filepath.Join(dir, chainFile), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	pub := "-"
+	if key != nil {
+		pub = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+	fmt.Fprintf(f, "%s\t%s\t%s\n", chainMagic, sessionID, pub)
+	c := &auditChain{
+		f:         f,
+		sessionID: sessionID,
+		key:       key,
+		head:      chainGenesis(sessionID),
+		ends:      make(map[string]int64),
+		pending:   make(map[string]hash.Hash),
+		pendLen:   make(map[string]int64),
+		flushers:  make(map[string]func()),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+func chainGenesis(sessionID string) [32]byte {
+	return sha256.Sum256([]byte(chainMagic + sessionID))
+}
+
+func chainNext(prev [32]byte, stream string, end int64, batch []byte) [32]byte {
+	h := sha256.New()
+	h.Write(prev[:])
+	h.Write([]byte(stream))
+	h.Write([]byte{0})
+	binary.Write(h, binary.BigEndian, uint64(end))
+	h.Write(batch)
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
+
+func chainSigMessage(sessionID, kind string, seq int, head string, at int64) []byte {
+	return []byte(fmt.Sprintf("wt-audit-v1\n%s\n%s\n%d\n%s\n%d", sessionID, kind, seq, head, at))
+}
+
+// SetFlusher registers a function that makes a stream's written bytes
+// durable (e.g. flushing a gzip writer) before an entry covers them.
+func (c *auditChain) SetFlusher(stream string, fn func()) {
+	c.mu.Lock()
+	c.flushers[stream] = fn
+	c.mu.Unlock()
+}
+
+// Add records bytes appended to a stream.
+func (c *auditChain) Add(stream string, p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.pending[stream]
+	if h == nil {
+		h = sha256.New()
+		c.pending[stream] = h
+	}
+	h.Write(p)
+	c.pendLen[stream] += int64(len(p))
+}
+
+func (c *auditChain) run() {
+	defer close(c.done)
+	t := time.NewTicker(chainCheckpointTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.checkpoint(false)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+type chainBatch struct {
+	stream string
+	end    int64
+	digest []byte
+}
+
+// checkpoint appends entries for streams with pending bytes and signs when
+// due (always when sealing). Pending digests are cut before flushing, so every
+// byte an entry covers was handed to its writer before the flush.
+func (c *auditChain) checkpoint(seal bool) {
+	c.mu.Lock()
+	var batches []chainBatch
+	for stream, h := range c.pending {
+		if c.pendLen[stream] == 0 {
+			continue
+		}
+		c.ends[stream] += c.pendLen[stream]
+		batches = append(batches, chainBatch{stream: stream, end: c.ends[stream], digest: h.Sum(nil)})
+		delete(c.pending, stream)
+		delete(c.pendLen, stream)
+	}
+	flushers := make([]func(), 0, len(batches))
+	for _, b := range batches {
+		if fn := c.flushers[b.stream]; fn != nil {
+			flushers = append(flushers, fn)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, fn := range flushers {
+		fn()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sort.Slice(batches, func(i, j int) bool { return batches[i].stream < batches[j].stream })
+	for _, b := range batches {
+		c.seq++
+		c.head = chainNext(c.head, b.stream, b.end, b.digest)
+		fmt.Fprintf(c.f, "c\t%d\t%s\t%d\t%x\t%x\n", c.seq, b.stream, b.end, b.digest, c.head)
+	}
+	if len(batches) > 0 {
+		c.sinceSign++
+	}
+	if seal || (c.sinceSign >= chainSignEvery) {
+		c.sign(seal)
+	}
+	c.f.Sync()
+}
+
+// sign appends a signature over the current head. Must be called with mu held.
+func (c *auditChain) sign(seal bool) {
+	c.sinceSign = 0
+	if c.key == nil {
+		return
+	}
+	kind := "s"
+	if seal {
+		kind = "f"
+	}
+	head := hex.EncodeToString(c.head[:])
+	at := time.Now().Unix()
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(c.key, chainSigMessage(c.sessionID, kind, c.seq, head, at)))
+	fmt.Fprintf(c.f, "%s\t%d\t%s\t%d\t%s\n", kind, c.seq, head, at, sig)
+}
+
+// Close writes the final checkpoint and seal. Streams must be closed (and
+// their data flushed) before calling.
+func (c *auditChain) Close() {
+	close(c.stop)
+	<-c.done
+	c.checkpoint(true)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.f.Close(); err != nil {
+		log.Printf("egg: audit chain close: %v", err)
+	}
+}
+
+// ReadChainHead returns the last signed head in dir's audit chain, or nil
+// if the chain has no signatures yet. The signature is not checked here;
+// whoever relies on the head verifies it.
+func ReadChainHead(dir string) (*ChainHead, error) {
+	data, err := os.ReadFile(filepath.Join(dir, chainFile))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	hdr := strings.Split(lines[0], "\t")
+	if len(hdr) != 3 || hdr[0] != chainMagic {
+		return nil, fmt.Errorf("not an audit chain")
+	}
+	for i := len(lines) - 1; i > 0; i-- {
+		f := strings.Split(lines[i], "\t")
+		if len(f) != 5 || (f[0] != "s" && f[0] != "f") {
+			continue
+		}
+		seq, _ := strconv.Atoi(f[1])
+		at, _ := strconv.ParseInt(f[3], 10, 64)
+		return &ChainHead{
+			SessionID: hdr[1],
+			Seq:       seq,
+			Head:      f[2],
+			SignedAt:  at,
+			Sig:       f[4],
+			Key:       hdr[2],
+			Sealed:    f[0] == "f",
+		}, nil
+	}
+	return nil, nil
+}
+
+// Verify checks the head's signature.
+func (h *ChainHead) Verify() bool {
+	pub, err := base64.StdEncoding.DecodeString(h.Key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(h.Sig)
+	if err != nil {
+		return false
+	}
+	kind := "s"
+	if h.Sealed {
+		kind = "f"
+	}
+	return ed25519.Verify(pub, chainSigMessage(h.SessionID, kind, h.Seq, h.Head, h.SignedAt), sig)
+}
+
+// ChainReport is the result of verifying a session's audit chain.
+type ChainReport struct {
+	SessionID  string
+	Key        string           // signer public key from the chain header ("" = unsigned)
+	Entries    int              // chain entries verified
+	Signatures int              // valid signatures
+	SignedSeq  int              // last entry covered by a signature
+	Unsigned   int              // entries after the last signature (signed chains)
+	Sealed     bool             // final seal present and valid
+	Covered    map[string]int64 // bytes of each stream covered by the chain
+	Unsealed   map[string]int64 // bytes not covered (signed chains: not covered by a signature)
+	Problems   []string         // tampering or truncation found
+}
+
+// OK reports whether no problems were found.
+func (r *ChainReport) OK() bool { return len(r.Problems) == 0 }
+
+func (r *ChainReport) problem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyAuditChain checks dir's audit files against audit.chain. If trusted
+// is non-nil, the chain must be signed by that key. notarized, if non-nil, is
+// a head the notary saw; the local chain must contain it. In a signed chain
+// only entries up to the last signature count as covered: anyone can append
+// hash entries, so those after it are reported in Unsigned and their bytes in
+// Unsealed.
+func VerifyAuditChain(dir string, trusted ed25519.PublicKey, notarized *ChainHead) (*ChainReport, error) {
+	chainData, err := os.ReadFile(filepath.Join(dir, chainFile))
+	if err != nil {
+		return nil, err
+	}
+	streams := map[string][]byte{}
+	if data, err := os.ReadFile(filepath.Join(dir, "audit.pty.gz")); err == nil {
+		if gr, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+			raw, _ := io.ReadAll(gr) // tolerate a truncated tail; coverage is checked below
+			gr.Close()
+			streams[ChainStreamPTY] = raw
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "audit.log")); err == nil {
+		streams[ChainStreamLog] = data
+	}
+
+	rep := &ChainReport{Covered: map[string]int64{}, Unsealed: map[string]int64{}}
+	sc := bufio.NewScanner(bytes.NewReader(chainData))
+	sc.Buffer(make([]byte, 4096), 1<<20)
+	if !sc.Scan() {
+		return nil, fmt.Errorf("empty chain")
+	}
+	hdr := strings.Split(sc.Text(), "\t")
+	if len(hdr) != 3 || hdr[0] != chainMagic {
+		return nil, fmt.Errorf("not an audit chain")
+	}
+	rep.SessionID = hdr[1]
+	if base := filepath.Base(dir); rep.SessionID != base {
+		rep.problem("chain belongs to session %s, not %s", rep.SessionID, base)
+	}
+	var pub ed25519.PublicKey
+	if hdr[2] != "-" {
+		rep.Key = hdr[2]
+		if b, err := base64.StdEncoding.DecodeString(hdr[2]); err == nil && len(b) == ed25519.PublicKeySize {
+			pub = b
+		} else {
+			rep.problem("bad signer key in chain header")
+		}
+	}
+	if trusted != nil && !trusted.Equal(pub) {
+		rep.problem("chain is not signed by the trusted key")
+	}
+
+	head := chainGenesis(rep.SessionID)
+	heads := map[int]string{0: hex.EncodeToString(head[:])}
+	ends := map[string]int64{} // bytes of each stream hashed into the chain so far
+	seq := 0
+	line := 1
+	for sc.Scan() {
+		line++
+		f := strings.Split(sc.Text(), "\t")
+		switch {
+		case len(f) == 6 && f[0] == "c":
+			n, _ := strconv.Atoi(f[1])
+			end, _ := strconv.ParseInt(f[3], 10, 64)
+			stream := f[2]
+			if n != seq+1 {
+				rep.problem("line %d: entry %d out of sequence (want %d)", line, n, seq+1)
+				return rep, nil
+			}
+			data, ok := streams[stream]
+			start := ends[stream]
+			switch {
+			case !ok:
+				rep.problem("entry %d: %s stream missing", n, stream)
+				return rep, nil
+			case end < start:
+				rep.problem("entry %d: %s offset goes backwards", n, stream)
+				return rep, nil
+			case end > int64(len(data)):
+				rep.problem("entry %d: %s truncated (chain covers %d bytes, file has %d)", n, stream, end, len(data))
+				return rep, nil
+			}
+			digest := sha256.Sum256(data[start:end])
+			if hex.EncodeToString(digest[:]) != f[4] {
+				rep.problem("entry %d: %s bytes %d-%d modified", n, stream, start, end)
+				return rep, nil
+			}
+			batch, _ := hex.DecodeString(f[4])
+			head = chainNext(head, stream, end, batch)
+			if hex.EncodeToString(head[:]) != f[5] {
+				rep.problem("entry %d: chain head mismatch", n)
+				return rep, nil
+			}
+			seq = n
+			heads[seq] = f[5]
+			ends[stream] = end
+			rep.Entries++
+		case len(f) == 5 && (f[0] == "s" || f[0] == "f"):
+			n, _ := strconv.Atoi(f[1])
+			at, _ := strconv.ParseInt(f[3], 10, 64)
+			if n != seq || f[2] != hex.EncodeToString(head[:]) {
+				rep.problem("line %d: signature does not cover the current head", line)
+				return rep, nil
+			}
+			sig, _ := base64.StdEncoding.DecodeString(f[4])
+			if pub == nil || !ed25519.Verify(pub, chainSigMessage(rep.SessionID, f[0], n, f[2], at), sig) {
+				rep.problem("line %d: invalid signature", line)
+				return rep, nil
+			}
+			rep.Signatures++
+			rep.SignedSeq = n
+			for stream, end := range ends {
+				rep.Covered[stream] = end
+			}
+			if f[0] == "f" {
+				rep.Sealed = true
+			}
+		default:
+			rep.problem("line %d: malformed record", line)
+			return rep, nil
+		}
+		if rep.Sealed && sc.Scan() {
+			rep.problem("records after final seal")
+			return rep, nil
+		}
+	}
+	if pub == nil {
+		for stream, end := range ends {
+			rep.Covered[stream] = end
+		}
+	} else {
+		rep.Unsigned = seq - rep.SignedSeq
+	}
+	for stream, data := range streams {
+		if extra := int64(len(data)) - rep.Covered[stream]; extra > 0 {
+			rep.Unsealed[stream] = extra
+		}
+	}
+	if rep.Sealed {
+		for stream, n := range rep.Unsealed {
+			rep.problem("%d bytes appended to %s after the seal", n, stream)
+		}
+	}
+	if notarized != nil {
+		switch h, ok := heads[notarized.Seq]; {
+		case !ok:
+			rep.problem("notary saw entry %d but the chain ends at %d (truncated)", notarized.Seq, seq)
+		case h != notarized.Head:
+			rep.problem("notarized head for entry %d does not match the chain", notarized.Seq)
+		case notarized.Sealed && !rep.Sealed:
+			rep.problem("notary saw a sealed chain but the seal is missing")
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,257 @@
+package egg
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeChainedSession writes audit.log and audit.pty.gz through an audit
+// chain the way the egg does, with a checkpoint between batches, and seals it.
+func writeChainedSession(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "sess-1")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newAuditChain(dir, "sess-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logF, _ := os.Create(filepath.Join(dir, "audit.log"))
+	ptyF, _ := os.Create(filepath.Join(dir, "audit.pty.gz"))
+	gz := gzip.NewWriter(ptyF)
+	c.SetFlusher(ChainStreamPTY, func() { gz.Flush() })
+
+	write := func(logLine, out string) {
+		logF.WriteString(logLine)
+		c.Add(ChainStreamLog, []byte(logLine))
+		gz.Write([]byte(out))
+		c.Add(ChainStreamPTY, []byte(out))
+	}
+	write("2026-01-01T00:00:00Z\tls\n", "a.txt b.txt\r\n")
+	c.checkpoint(false)
+	write("2026-01-01T00:00:05Z\tmake test\n", "ok  ./...\r\n")
+	c.checkpoint(false)
+	gz.Write([]byte("$ "))
+	c.Add(ChainStreamPTY, []byte("$ "))
+
+	gz.Close()
+	ptyF.Close()
+	logF.Close()
+	c.Close()
+	return dir
+}
+
+func testSigningKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	key := testSigningKey(t)
+	dir := writeChainedSession(t, key)
+
+	rep, err := VerifyAuditChain(dir, key.Public().(ed25519.PublicKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() {
+		t.Fatalf("problems: %v", rep.Problems)
+	}
+	if !rep.Sealed || rep.Signatures != 1 || rep.Entries != 5 {
+		t.Errorf("sealed=%v signatures=%d entries=%d", rep.Sealed, rep.Signatures, rep.Entries)
+	}
+	if rep.Covered[ChainStreamPTY] != int64(len("a.txt b.txt\r\nok  ./...\r\n$ ")) || len(rep.Unsealed) != 0 {
+		t.Errorf("covered=%v unsealed=%v", rep.Covered, rep.Unsealed)
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	key := testSigningKey(t)
+	pub := key.Public().(ed25519.PublicKey)
+	logPath := func(dir string) string { return filepath.Join(dir, "audit.log") }
+
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, dir string)
+		want   string
+	}{
+		{"modified", func(t *testing.T, dir string) {
+			data, _ := os.ReadFile(logPath(dir))
+			os.WriteFile(logPath(dir), []byte(strings.Replace(string(data), "make test", "make tast", 1)), 0644)
+		}, "modified"},
+		{"truncated", func(t *testing.T, dir string) {
+			data, _ := os.ReadFile(logPath(dir))
+			os.WriteFile(logPath(dir), data[:10], 0644)
+		}, "truncated"},
+		{"appended after seal", func(t *testing.T, dir string) {
+			f, _ := os.OpenFile(logPath(dir), os.O_APPEND|os.O_WRONLY, 0644)
+			f.WriteString("2026-01-01T00:01:00Z\trm -rf /\n")
+			f.Close()
+		}, "after the seal"},
+		{"chain entries removed", func(t *testing.T, dir string) {
+			path := filepath.Join(dir, chainFile)
+			data, _ := os.ReadFile(path)
+			lines := strings.Split(string(data), "\n")
+			os.WriteFile(path, []byte(strings.Join(append(lines[:1], lines[2:]...), "\n")), 0644)
+		}, "out of sequence"},
+		{"signature forged", func(t *testing.T, dir string) {
+			path := filepath.Join(dir, chainFile)
+			data, _ := os.ReadFile(path)
+			lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+			last := strings.Split(lines[len(lines)-1], "\t")
+			last[3] = "1"
+			lines[len(lines)-1] = strings.Join(last, "\t")
+			os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+		}, "invalid signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeChainedSession(t, key)
+			tt.tamper(t, dir)
+			rep, err := VerifyAuditChain(dir, pub, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.OK() {
+				t.Fatal("tampering not detected")
+			}
+			if !strings.Contains(strings.Join(rep.Problems, "; "), tt.want) {
+				t.Errorf("problems = %v, want %q", rep.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditChainUntrustedSigner(t *testing.T) {
+	dir := writeChainedSession(t, testSigningKey(t))
+	other := testSigningKey(t).Public().(ed25519.PublicKey)
+	rep, err := VerifyAuditChain(dir, other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.OK() {
+		t.Fatal("chain re-signed with another key passed verification")
+	}
+}
+
+func TestAuditChainNotarizedHead(t *testing.T) {
+	key := testSigningKey(t)
+	dir := writeChainedSession(t, key)
+
+	head, err := ReadChainHead(dir)
+	if err != nil || head == nil {
+		t.Fatalf("ReadChainHead: %v, %v", head, err)
+	}
+	if !head.Sealed || !head.Verify() {
+		t.Fatalf("head sealed=%v verify=%v", head.Sealed, head.Verify())
+	}
+	rep, _ := VerifyAuditChain(dir, nil, head)
+	if !rep.OK() {
+		t.Fatalf("notarized head rejected: %v", rep.Problems)
+	}
+
+	// A rewritten chain has different heads than the one the notary saw
+	forged := *head
+	forged.Head = strings.Repeat("0", 64)
+	rep, _ = VerifyAuditChain(dir, nil, &forged)
+	if rep.OK() {
+		t.Fatal("mismatched notarized head accepted")
+	}
+	if forged.Verify() {
+		t.Error("altered head still verifies")
+	}
+	beyond := *head
+	beyond.Seq = head.Seq + 3
+	rep, _ = VerifyAuditChain(dir, nil, &beyond)
+	if rep.OK() {
+		t.Fatal("chain shorter than notarized head accepted")
+	}
+}
+
+func TestAuditChainUnsignedTail(t *testing.T) {
+	key := testSigningKey(t)
+	dir := filepath.Join(t.TempDir(), "sess-1")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newAuditChain(dir, "sess-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logF, _ := os.Create(filepath.Join(dir, "audit.log"))
+	write := func(line string) {
+		logF.WriteString(line)
+		c.Add(ChainStreamLog, []byte(line))
+		c.checkpoint(false)
+	}
+	write("2026-01-01T00:00:00Z\tls\n")
+	c.mu.Lock()
+	c.sign(false)
+	c.mu.Unlock()
+	// Entries after the last signature, e.g. appended by whoever edited the log
+	write("2026-01-01T00:00:05Z\trm -rf /\n")
+	close(c.stop)
+	<-c.done
+	c.f.Close()
+	logF.Close()
+
+	rep, err := VerifyAuditChain(dir, key.Public().(ed25519.PublicKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.SignedSeq != 1 || rep.Unsigned != 1 {
+		t.Errorf("signed through %d, %d unsigned; want 1, 1", rep.SignedSeq, rep.Unsigned)
+	}
+	signed := int64(len("2026-01-01T00:00:00Z\tls\n"))
+	if rep.Covered[ChainStreamLog] != signed || rep.Unsealed[ChainStreamLog] != int64(len("2026-01-01T00:00:05Z\trm -rf /\n")) {
+		t.Errorf("covered=%v unsealed=%v", rep.Covered, rep.Unsealed)
+	}
+}
+
+func TestAuditorRecordIsChained(t *testing.T) {
+	key := testSigningKey(t)
+	dir := filepath.Join(t.TempDir(), "sess-1")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newAuditChain(dir, "sess-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newInputAuditor(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.chain = c
+	a.Process([]byte("deploy\r"))
+	if err := a.Record(`tool {"tool":"deploy","approved":true}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Record("tool x\n2026-01-01T00:00:00Z\tforged"); err == nil {
+		t.Error("multi-line record accepted")
+	}
+	a.Close()
+	c.Close()
+
+	data, _ := os.ReadFile(filepath.Join(dir, "audit.log"))
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "\tdeploy") || !strings.HasSuffix(lines[1], ` tool {"tool":"deploy","approved":true}`) {
+		t.Fatalf("audit.log:\n%s", data)
+	}
+	rep, err := VerifyAuditChain(dir, key.Public().(ed25519.PublicKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || rep.Covered[ChainStreamLog] != int64(len(data)) {
+		t.Errorf("problems=%v covered=%v", rep.Problems, rep.Covered)
+	}
+}
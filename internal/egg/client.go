@@ -83,6 +83,12 @@ func (c *Client) Status(ctx context.Context) (*pb.StatusResponse, error) {
 	return c.client.Status(c.authCtx(ctx), &pb.StatusRequest{})
 }
 
+// Audit appends a one-line event to the session's chained audit log.
+func (c *Client) Audit(ctx context.Context, sessionID, record string) error {
+	_, err := c.client.Audit(c.authCtx(ctx), &pb.AuditRequest{SessionId: sessionID, Record: record})
+	return err
+}
+
 // Close closes the gRPC connection.
 func (c *Client) Close() error {
 	return c.conn.Close()
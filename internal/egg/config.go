@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -110,6 +111,7 @@ type EggConfig struct {
 	Audit                      bool              `yaml:"audit"`
 	Trace                      bool              `yaml:"trace"`
 	AgentSettings              map[string]string `yaml:"agent_settings,omitempty"` // agent name -> settings file path
+	Ports                      []int             `yaml:"ports,omitempty"`          // loopback ports the browser may reach through the tunnel
 }
 
 // EggResources configures resource limits for sandboxed processes.
@@ -223,7 +225,17 @@ func resolveEggConfig(path string, visited map[string]bool, depth int) (*EggConf
 	if err != nil {
 		return nil, err
 	}
+	return resolveBase(child, filepath.Dir(abs), visited, depth)
+}
+
+// ResolveInlineEggConfig resolves the base chain of a config that did not
+// come from its own file (e.g. a tool's sandbox section). Relative bases are
+// resolved against dir.
+func ResolveInlineEggConfig(child *EggConfig, dir string) (*EggConfig, error) {
+	return resolveBase(child, dir, make(map[string]bool), 0)
+}
 
+func resolveBase(child *EggConfig, dir string, visited map[string]bool, depth int) (*EggConfig, error) {
 	var parent *EggConfig
 	switch child.Base.Name {
 	case "none":
@@ -234,7 +246,7 @@ func resolveEggConfig(path string, visited map[string]bool, depth int) (*EggConf
 	case "":
 		parent = DefaultEggConfig()
 	default:
-		parentPath := resolveBasePath(child.Base.Name, filepath.Dir(abs))
+		parentPath := resolveBasePath(child.Base.Name, dir)
 		var err error
 		parent, err = resolveEggConfig(parentPath, visited, depth+1)
 		if err != nil {
@@ -243,7 +255,7 @@ func resolveEggConfig(path string, visited map[string]bool, depth int) (*EggConf
 	}
 
 	if child.Base.HasMasks() {
-		if err := applySectionMasks(parent, child.Base, filepath.Dir(abs), visited, depth); err != nil {
+		if err := applySectionMasks(parent, child.Base, dir, visited, depth); err != nil {
 			return nil, err
 		}
 	}
@@ -317,6 +329,7 @@ func applySectionMasks(parent *EggConfig, masks BaseField, configDir string,
 // - resources: child wins per-field (non-zero overrides parent)
 // - shell: child wins if non-empty
 // - dangerously_skip_permissions: OR
+// - ports: union
 func MergeEggConfig(parent, child *EggConfig) *EggConfig {
 	merged := &EggConfig{}
 
@@ -358,6 +371,13 @@ func MergeEggConfig(parent, child *EggConfig) *EggConfig {
 		}
 	}
 
+	// Ports: union
+	if len(parent.Ports) > 0 || len(child.Ports) > 0 {
+		merged.Ports = slices.Concat(parent.Ports, child.Ports)
+		slices.Sort(merged.Ports)
+		merged.Ports = slices.Compact(merged.Ports)
+	}
+
 	return merged
 }
 
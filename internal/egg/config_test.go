@@ -3,6 +3,7 @@ package egg
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -237,6 +238,18 @@ func TestMergeEggConfig_NetworkUnion(t *testing.T) {
 	}
 }
 
+func TestMergeEggConfig_PortsUnion(t *testing.T) {
+	parent := &EggConfig{Ports: []int{5173, 3000}}
+	child := &EggConfig{Ports: []int{3000, 8080}}
+	merged := MergeEggConfig(parent, child)
+	if !slices.Equal(merged.Ports, []int{3000, 5173, 8080}) {
+		t.Errorf("ports = %v, want [3000 5173 8080]", merged.Ports)
+	}
+	if merged := MergeEggConfig(&EggConfig{}, &EggConfig{}); merged.Ports != nil {
+		t.Errorf("ports = %v, want nil", merged.Ports)
+	}
+}
+
 func TestMergeEggConfig_EnvUnion(t *testing.T) {
 	parent := &EggConfig{Env: EnvField{"ANTHROPIC_API_KEY"}}
 	child := &EggConfig{Env: EnvField{"OPENAI_API_KEY"}}
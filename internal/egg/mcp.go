@@ -0,0 +1,196 @@
+package egg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ehrlich-b/wingthing/internal/config"
+)
+
+// MCPServerName is the key the tool server is registered under in agent
+// MCP settings.
+const MCPServerName = "wingthing"
+
+// mcpProtocolVersions are the MCP revisions this server speaks, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpCallResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// ServeMCP speaks the Model Context Protocol (stdio transport: one JSON-RPC
+// message per line) on r/w, exposing the tools behind the tool socket at
+// sockPath. Every call goes through the socket, so the wing still validates
+// arguments and enforces limits; this is only a translation layer. Returns
+// when r is exhausted.
+func ServeMCP(r io.Reader, w io.Writer, sockPath, version string) error {
+	enc := json.NewEncoder(w)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var req mcpRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			enc.Encode(mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{Code: -32700, Message: "parse error"}})
+			continue
+		}
+		if len(req.ID) == 0 {
+			continue // notification (e.g. notifications/initialized)
+		}
+		result, rpcErr := handleMCP(req, sockPath, version)
+		resp := mcpResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}
+		if rpcErr == nil && result == nil {
+			resp.Result = struct{}{}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func handleMCP(req mcpRequest, sockPath, version string) (any, *mcpError) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &p)
+		pv := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, p.ProtocolVersion) {
+			pv = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": pv,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": MCPServerName, "version": version},
+			"instructions":    "Privileged tools run by the wing host outside the sandbox.",
+		}, nil
+	case "ping":
+		return nil, nil
+	case "tools/list":
+		entries, err := mcpListTools(sockPath)
+		if err != nil {
+			return nil, &mcpError{Code: -32603, Message: err.Error()}
+		}
+		tools := make([]mcpTool, 0, len(entries))
+		for _, e := range entries {
+			// Tell the agent a call may block for minutes
+			desc := e.Description
+			switch e.Approval {
+			case config.ApprovalFirst:
+				desc = strings.TrimSpace(desc + " (the first call waits for the session owner's approval)")
+			case config.ApprovalAlways:
+				desc = strings.TrimSpace(desc + " (each call waits for the session owner's approval)")
+			}
+			tools = append(tools, mcpTool{Name: e.Name, Description: desc, InputSchema: config.ToolJSONSchema(e.Params)})
+		}
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(req.Params))
+		dec.UseNumber() // keep large integers exact
+		if err := dec.Decode(&p); err != nil || p.Name == "" {
+			return nil, &mcpError{Code: -32602, Message: "tools/call needs a tool name"}
+		}
+		return mcpCallTool(sockPath, p.Name, p.Arguments), nil
+	}
+	return nil, &mcpError{Code: -32601, Message: "method not found: " + req.Method}
+}
+
+func mcpListTools(sockPath string) ([]ToolListEntry, error) {
+	if sockPath == "" {
+		return nil, nil
+	}
+	entries, err := ListTools(sockPath)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(entries, func(a, b ToolListEntry) int { return strings.Compare(a.Name, b.Name) })
+	return entries, nil
+}
+
+// mcpCallTool runs a tool and folds its result into MCP content. Tool
+// failures are results with isError set, not protocol errors, so the agent
+// sees the message.
+func mcpCallTool(sockPath, name string, named map[string]any) mcpCallResult {
+	fail := func(format string, args ...any) mcpCallResult {
+		return mcpCallResult{Content: []mcpContent{{Type: "text", Text: fmt.Sprintf(format, args...)}}, IsError: true}
+	}
+	entries, err := mcpListTools(sockPath)
+	if err != nil {
+		return fail("%v", err)
+	}
+	i := slices.IndexFunc(entries, func(e ToolListEntry) bool { return e.Name == name })
+	if i < 0 {
+		return fail("unknown tool: %s", name)
+	}
+	args, err := config.ToolArgs(entries[i].Params, named)
+	if err != nil {
+		return fail("tool %s: %v", name, err)
+	}
+	resp, err := CallTool(sockPath, name, args)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if resp.Error != "" {
+		return fail("%s", resp.Error)
+	}
+	var text strings.Builder
+	text.WriteString(resp.Stdout)
+	if resp.Stderr != "" {
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteByte('\n')
+		}
+		text.WriteString(resp.Stderr)
+	}
+	if resp.ExitCode != 0 {
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteByte('\n')
+		}
+		fmt.Fprintf(&text, "exit code %d", resp.ExitCode)
+	}
+	return mcpCallResult{Content: []mcpContent{{Type: "text", Text: text.String()}}, IsError: resp.ExitCode != 0}
+}
@@ -0,0 +1,111 @@
+package egg
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ehrlich-b/wingthing/internal/config"
+)
+
+// mcpExchange runs ServeMCP over the given request lines and returns the
+// responses keyed by id.
+func mcpExchange(t *testing.T, sockPath string, lines ...string) map[string]map[string]any {
+	t.Helper()
+	var out bytes.Buffer
+	if err := ServeMCP(strings.NewReader(strings.Join(lines, "\n")+"\n"), &out, sockPath, "test"); err != nil {
+		t.Fatalf("ServeMCP: %v", err)
+	}
+	resps := make(map[string]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp map[string]any
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("bad response %q: %v", line, err)
+		}
+		id, _ := json.Marshal(resp["id"])
+		resps[string(id)] = resp
+	}
+	return resps
+}
+
+func TestServeMCP(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{{
+		Name:        "deploy",
+		Description: "Deploy a service",
+		Run:         `echo "deploying $1 x$2"`,
+		Params: []config.ToolParam{
+			{Name: "env", Enum: []string{"staging", "prod"}},
+			{Name: "replicas", Type: config.ParamInt},
+		},
+	}, {
+		Name: "fail",
+		Run:  `echo oops >&2; exit 3`,
+	}}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	resps := mcpExchange(t, sockPath,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"deploy","arguments":{"env":"prod","replicas":3}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"deploy","arguments":{"env":"dev","replicas":3}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"fail","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":"p","method":"ping"}`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+	)
+	if len(resps) != 7 {
+		t.Fatalf("got %d responses, want 7 (notification must not be answered)", len(resps))
+	}
+
+	initRes := resps["1"]["result"].(map[string]any)
+	if initRes["protocolVersion"] != "2025-03-26" {
+		t.Errorf("protocolVersion = %v", initRes["protocolVersion"])
+	}
+
+	list := resps["2"]["result"].(map[string]any)["tools"].([]any)
+	if len(list) != 2 {
+		t.Fatalf("tools = %v", list)
+	}
+	deploy := list[0].(map[string]any)
+	schema := deploy["inputSchema"].(map[string]any)
+	if deploy["name"] != "deploy" || deploy["description"] != "Deploy a service" || len(schema["required"].([]any)) != 2 {
+		t.Errorf("deploy = %v", deploy)
+	}
+
+	text := func(id string) (string, bool) {
+		res := resps[id]["result"].(map[string]any)
+		content := res["content"].([]any)[0].(map[string]any)
+		isErr, _ := res["isError"].(bool)
+		return content["text"].(string), isErr
+	}
+	if got, isErr := text("3"); isErr || got != "deploying prod x3\n" {
+		t.Errorf("call = %q, isError=%v", got, isErr)
+	}
+	if got, isErr := text("4"); !isErr || !strings.Contains(got, "not one of") {
+		t.Errorf("invalid call = %q, isError=%v", got, isErr)
+	}
+	if got, isErr := text("5"); !isErr || got != "oops\nexit code 3" {
+		t.Errorf("failing call = %q, isError=%v", got, isErr)
+	}
+
+	if _, ok := resps[`"p"`]["result"]; !ok {
+		t.Errorf("ping = %v", resps[`"p"`])
+	}
+	if e, ok := resps["6"]["error"].(map[string]any); !ok || e["code"] != -32601.0 {
+		t.Errorf("unknown method = %v", resps["6"])
+	}
+}
+
+func TestServeMCPWithoutSocket(t *testing.T) {
+	resps := mcpExchange(t, "", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	tools := resps["1"]["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 0 {
+		t.Errorf("tools = %v", tools)
+	}
+}
@@ -547,6 +547,94 @@ func (x *Resize) GetCols() uint32 {
 	return 0
 }
 
+type AuditRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Record        string                 `protobuf:"bytes,2,opt,name=record,proto3" json:"record,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditRequest) Reset() {
+	*x = AuditRequest{}
+	mi := &file_egg_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditRequest) ProtoMessage() {}
+
+func (x *AuditRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_egg_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditRequest.ProtoReflect.Descriptor instead.
+func (*AuditRequest) Descriptor() ([]byte, []int) {
+	return file_egg_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AuditRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *AuditRequest) GetRecord() string {
+	if x != nil {
+		return x.Record
+	}
+	return ""
+}
+
+type AuditResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditResponse) Reset() {
+	*x = AuditResponse{}
+	mi := &file_egg_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditResponse) ProtoMessage() {}
+
+func (x *AuditResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_egg_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditResponse.ProtoReflect.Descriptor instead.
+func (*AuditResponse) Descriptor() ([]byte, []int) {
+	return file_egg_proto_rawDescGZIP(), []int{9}
+}
+
 var File_egg_proto protoreflect.FileDescriptor
 
 const file_egg_proto_rawDesc = "" +
@@ -587,12 +675,18 @@ const file_egg_proto_rawDesc = "" +
 	"\apayload\"0\n" +
 	"\x06Resize\x12\x12\n" +
 	"\x04rows\x18\x01 \x01(\rR\x04rows\x12\x12\n" +
-	"\x04cols\x18\x02 \x01(\rR\x04cols2\xc9\x01\n" +
+	"\x04cols\x18\x02 \x01(\rR\x04cols\"E\n" +
+	"\fAuditRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06record\x18\x02 \x01(\tR\x06record\"\x0f\n" +
+	"\rAuditResponse2\xf9\x01\n" +
 	"\x03Egg\x12+\n" +
 	"\x04Kill\x12\x10.egg.KillRequest\x1a\x11.egg.KillResponse\x121\n" +
 	"\x06Resize\x12\x12.egg.ResizeRequest\x1a\x13.egg.ResizeResponse\x12/\n" +
 	"\aSession\x12\x0f.egg.SessionMsg\x1a\x0f.egg.SessionMsg(\x010\x01\x121\n" +
-	"\x06Status\x12\x12.egg.StatusRequest\x1a\x13.egg.StatusResponseB0Z.github.com/ehrlich-b/wingthing/internal/egg/pbb\x06proto3"
+	"\x06Status\x12\x12.egg.StatusRequest\x1a\x13.egg.StatusResponse\x12.\n" +
+	"\x05Audit\x12\x11.egg.AuditRequest\x1a\x12.egg.AuditResponseB0Z.github.com/ehrlich-b/wingthing/internal/egg/pbb\x06proto3"
 
 var (
 	file_egg_proto_rawDescOnce sync.Once
@@ -606,7 +700,7 @@ func file_egg_proto_rawDescGZIP() []byte {
 	return file_egg_proto_rawDescData
 }
 
-var file_egg_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_egg_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_egg_proto_goTypes = []any{
 	(*StatusRequest)(nil),  // 0: egg.StatusRequest
 	(*StatusResponse)(nil), // 1: egg.StatusResponse
@@ -616,6 +710,8 @@ var file_egg_proto_goTypes = []any{
 	(*ResizeResponse)(nil), // 5: egg.ResizeResponse
 	(*SessionMsg)(nil),     // 6: egg.SessionMsg
 	(*Resize)(nil),         // 7: egg.Resize
+	(*AuditRequest)(nil),   // 8: egg.AuditRequest
+	(*AuditResponse)(nil),  // 9: egg.AuditResponse
 }
 var file_egg_proto_depIdxs = []int32{
 	7, // 0: egg.SessionMsg.resize:type_name -> egg.Resize
@@ -623,12 +719,14 @@ var file_egg_proto_depIdxs = []int32{
 	4, // 2: egg.Egg.Resize:input_type -> egg.ResizeRequest
 	6, // 3: egg.Egg.Session:input_type -> egg.SessionMsg
 	0, // 4: egg.Egg.Status:input_type -> egg.StatusRequest
-	3, // 5: egg.Egg.Kill:output_type -> egg.KillResponse
-	5, // 6: egg.Egg.Resize:output_type -> egg.ResizeResponse
-	6, // 7: egg.Egg.Session:output_type -> egg.SessionMsg
-	1, // 8: egg.Egg.Status:output_type -> egg.StatusResponse
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
+	8, // 5: egg.Egg.Audit:input_type -> egg.AuditRequest
+	3, // 6: egg.Egg.Kill:output_type -> egg.KillResponse
+	5, // 7: egg.Egg.Resize:output_type -> egg.ResizeResponse
+	6, // 8: egg.Egg.Session:output_type -> egg.SessionMsg
+	1, // 9: egg.Egg.Status:output_type -> egg.StatusResponse
+	9, // 10: egg.Egg.Audit:output_type -> egg.AuditResponse
+	6, // [6:11] is the sub-list for method output_type
+	1, // [1:6] is the sub-list for method input_type
 	1, // [1:1] is the sub-list for extension type_name
 	1, // [1:1] is the sub-list for extension extendee
 	0, // [0:1] is the sub-list for field type_name
@@ -653,7 +751,7 @@ func file_egg_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_egg_proto_rawDesc), len(file_egg_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   8,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -23,6 +23,7 @@ const (
 	Egg_Resize_FullMethodName  = "/egg.Egg/Resize"
 	Egg_Session_FullMethodName = "/egg.Egg/Session"
 	Egg_Status_FullMethodName  = "/egg.Egg/Status"
+	Egg_Audit_FullMethodName   = "/egg.Egg/Audit"
 )
 
 // EggClient is the client API for Egg service.
@@ -33,6 +34,7 @@ type EggClient interface {
 	Resize(ctx context.Context, in *ResizeRequest, opts ...grpc.CallOption) (*ResizeResponse, error)
 	Session(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SessionMsg, SessionMsg], error)
 	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	Audit(ctx context.Context, in *AuditRequest, opts ...grpc.CallOption) (*AuditResponse, error)
 }
 
 type eggClient struct {
@@ -86,6 +88,16 @@ func (c *eggClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *eggClient) Audit(ctx context.Context, in *AuditRequest, opts ...grpc.CallOption) (*AuditResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuditResponse)
+	err := c.cc.Invoke(ctx, Egg_Audit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // EggServer is the server API for Egg service.
 // All implementations must embed UnimplementedEggServer
 // for forward compatibility.
@@ -94,6 +106,7 @@ type EggServer interface {
 	Resize(context.Context, *ResizeRequest) (*ResizeResponse, error)
 	Session(grpc.BidiStreamingServer[SessionMsg, SessionMsg]) error
 	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	Audit(context.Context, *AuditRequest) (*AuditResponse, error)
 	mustEmbedUnimplementedEggServer()
 }
 
@@ -116,6 +129,9 @@ func (UnimplementedEggServer) Session(grpc.BidiStreamingServer[SessionMsg, Sessi
 func (UnimplementedEggServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Status not implemented")
 }
+func (UnimplementedEggServer) Audit(context.Context, *AuditRequest) (*AuditResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Audit not implemented")
+}
 func (UnimplementedEggServer) mustEmbedUnimplementedEggServer() {}
 func (UnimplementedEggServer) testEmbeddedByValue()             {}
 
@@ -198,6 +214,24 @@ func _Egg_Status_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Egg_Audit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EggServer).Audit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Egg_Audit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EggServer).Audit(ctx, req.(*AuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Egg_ServiceDesc is the grpc.ServiceDesc for Egg service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -217,6 +251,10 @@ var Egg_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Status",
 			Handler:    _Egg_Status_Handler,
 		},
+		{
+			MethodName: "Audit",
+			Handler:    _Egg_Audit_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
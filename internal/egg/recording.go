@@ -0,0 +1,383 @@
+package egg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Audit frame types in the V2 audit.pty.gz stream.
+const (
+	AuditFrameOutput = 0 // raw PTY output
+	AuditFrameResize = 1 // varint cols, varint rows
+)
+
+// AuditFrame is one decoded frame of a PTY audit recording.
+type AuditFrame struct {
+	At   time.Duration // offset from session start
+	Type int           // AuditFrameOutput or AuditFrameResize
+	Data []byte        // output bytes (AuditFrameOutput)
+	Cols int           // new dimensions (AuditFrameResize)
+	Rows int
+}
+
+// AuditRecording is a decoded audit.pty.gz stream.
+type AuditRecording struct {
+	Cols, Rows int // initial dimensions
+	Frames     []AuditFrame
+}
+
+// Duration returns the offset of the last frame.
+func (r *AuditRecording) Duration() time.Duration {
+	if len(r.Frames) == 0 {
+		return 0
+	}
+	return r.Frames[len(r.Frames)-1].At
+}
+
+// DecodeAuditRecording decodes an uncompressed audit stream. V2 streams start
+// with "WTA2" + varint cols/rows and carry a frame type per frame; legacy V1
+// streams are output-only and use cols/rows as their dimensions. A truncated
+// tail (live session, writer still open) is dropped rather than reported.
+func DecodeAuditRecording(raw []byte, cols, rows int) *AuditRecording {
+	rec := &AuditRecording{Cols: cols, Rows: rows}
+	isV2 := len(raw) >= 4 && string(raw[:4]) == "WTA2"
+	pos := 0
+	if isV2 {
+		pos = 4
+		if v, n := binary.Uvarint(raw[pos:]); n > 0 {
+			rec.Cols = int(v)
+			pos += n
+		}
+		if v, n := binary.Uvarint(raw[pos:]); n > 0 {
+			rec.Rows = int(v)
+			pos += n
+		}
+	}
+	var cumulativeMs uint64
+	for pos < len(raw) {
+		deltaMs, n := binary.Uvarint(raw[pos:])
+		if n <= 0 {
+			break
+		}
+		pos += n
+
+		var frameType uint64
+		if isV2 {
+			frameType, n = binary.Uvarint(raw[pos:])
+			if n <= 0 {
+				break
+			}
+			pos += n
+		}
+
+		dataLen, n := binary.Uvarint(raw[pos:])
+		if n <= 0 {
+			break
+		}
+		pos += n
+		if dataLen > uint64(len(raw)-pos) {
+			break
+		}
+		chunk := raw[pos : pos+int(dataLen)]
+		pos += int(dataLen)
+		cumulativeMs += deltaMs
+
+		f := AuditFrame{At: time.Duration(cumulativeMs) * time.Millisecond, Type: int(frameType)}
+		switch frameType {
+		case AuditFrameResize:
+			c, cn := binary.Uvarint(chunk)
+			if cn <= 0 {
+				continue
+			}
+			r, rn := binary.Uvarint(chunk[cn:])
+			if rn <= 0 {
+				continue
+			}
+			f.Cols, f.Rows = int(c), int(r)
+		case AuditFrameOutput:
+			f.Data = chunk
+		default:
+			continue
+		}
+		rec.Frames = append(rec.Frames, f)
+	}
+	return rec
+}
+
+// ReadAuditRecording loads <dir>/audit.pty.gz. Legacy recordings take their
+// dimensions from egg.meta (default 120x40). Incomplete gzip from a live
+// session is tolerated.
+func ReadAuditRecording(dir string) (*AuditRecording, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "audit.pty.gz"))
+	if err != nil {
+		return nil, err
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	raw, readErr := io.ReadAll(gr)
+	gr.Close()
+	if readErr != nil && len(raw) == 0 {
+		return nil, fmt.Errorf("read: %w", readErr)
+	}
+	cols, rows := metaDimensions(dir)
+	return DecodeAuditRecording(raw, cols, rows), nil
+}
+
+// metaDimensions reads cols/rows from egg.meta, defaulting to 120x40.
+func metaDimensions(dir string) (cols, rows int) {
+	cols, rows = 120, 40
+	meta, err := os.ReadFile(filepath.Join(dir, "egg.meta"))
+	if err != nil {
+		return cols, rows
+	}
+	for _, line := range strings.Split(string(meta), "\n") {
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			continue
+		}
+		switch k {
+		case "cols":
+			cols = n
+		case "rows":
+			rows = n
+		}
+	}
+	return cols, rows
+}
+
+// WriteAsciicast writes the recording as an asciinema v2 cast file. Output
+// frames are split on UTF-8 boundaries so every event is a valid string.
+func (r *AuditRecording) WriteAsciicast(w io.Writer, title string) error {
+	bw := bufio.NewWriter(w)
+	header := map[string]any{"version": 2, "width": r.Cols, "height": r.Rows}
+	if title != "" {
+		header["title"] = title
+	}
+	hb, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	bw.Write(hb)
+	bw.WriteByte('\n')
+
+	var carry []byte // incomplete UTF-8 sequence from the previous frame
+	for _, f := range r.Frames {
+		ts := f.At.Seconds()
+		if f.Type == AuditFrameResize {
+			fmt.Fprintf(bw, "[%.6f, \"r\", \"%dx%d\"]\n", ts, f.Cols, f.Rows)
+			continue
+		}
+		data := append(carry, f.Data...)
+		cut := utf8Boundary(data)
+		carry = append([]byte(nil), data[cut:]...)
+		if cut == 0 {
+			continue
+		}
+		eb, err := json.Marshal(strings.ToValidUTF8(string(data[:cut]), "�"))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "[%.6f, \"o\", %s]\n", ts, eb)
+	}
+	return bw.Flush()
+}
+
+// utf8Boundary returns the length of the longest prefix of p that does not
+// end inside a multi-byte UTF-8 sequence.
+func utf8Boundary(p []byte) int {
+	for i := 1; i <= utf8.UTFMax && i <= len(p); i++ {
+		b := p[len(p)-i]
+		if b < 0x80 {
+			return len(p) // ASCII tail — complete
+		}
+		if utf8.RuneStart(b) {
+			if utf8.FullRune(p[len(p)-i:]) {
+				return len(p)
+			}
+			return len(p) - i
+		}
+	}
+	return len(p)
+}
+
+// replayScreen feeds the recording through a plain-text terminal emulator.
+// onFrame is called after each frame with the emulator (may be nil).
+func (r *AuditRecording) replayScreen(onFrame func(f AuditFrame, v *VTerm)) *VTerm {
+	v := newPlainVTerm(r.Cols, r.Rows, maxScrollbackLines)
+	go v.discardReplies()
+	for _, f := range r.Frames {
+		if f.Type == AuditFrameResize {
+			v.Resize(f.Cols, f.Rows)
+		} else {
+			v.Write(f.Data)
+		}
+		if onFrame != nil {
+			onFrame(f, v)
+		}
+	}
+	return v
+}
+
+// WriteTranscript renders the recording through a terminal emulator and
+// writes what a reader would have seen: scrolled-off lines followed by the
+// final screen, as plain text without escape sequences.
+func (r *AuditRecording) WriteTranscript(w io.Writer) error {
+	v := r.replayScreen(nil)
+	defer v.Close()
+	v.mu.Lock()
+	lines := v.scrollbackLines()
+	v.mu.Unlock()
+	screen, _ := v.ScreenLines()
+	lines = append(lines, screen...)
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		bw.WriteString(line)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// htmlKeyframeInterval is the minimum spacing between captured screens in
+// the HTML player; bursts of output inside the interval collapse into one.
+const htmlKeyframeInterval = 100 * time.Millisecond
+
+type htmlKeyframe struct {
+	T     float64  `json:"t"`
+	Lines []string `json:"l"`
+}
+
+// WriteHTML writes a self-contained HTML page that replays the recording.
+// Screens are rendered by the wing's terminal emulator at export time, so
+// the page needs no terminal library — just a scrubber over text frames.
+// The page opens on the screen at offset at (0 = the end); a #t=<seconds>
+// URL fragment overrides it.
+func (r *AuditRecording) WriteHTML(w io.Writer, title string, at time.Duration) error {
+	var frames []htmlKeyframe
+	var last []string
+	var lastAt time.Duration = -htmlKeyframeInterval
+	capture := func(at time.Duration, v *VTerm) {
+		lines, _ := v.ScreenLines()
+		if equalLines(lines, last) {
+			return
+		}
+		if at-lastAt < htmlKeyframeInterval && len(frames) > 0 {
+			frames[len(frames)-1].Lines = lines
+		} else {
+			frames = append(frames, htmlKeyframe{T: at.Seconds(), Lines: lines})
+			lastAt = at
+		}
+		last = lines
+	}
+	v := r.replayScreen(func(f AuditFrame, v *VTerm) { capture(f.At, v) })
+	v.Close()
+
+	if frames == nil {
+		frames = []htmlKeyframe{}
+	}
+	return htmlPlayer.Execute(w, map[string]any{
+		"Title":    title,
+		"Duration": r.Duration().Round(time.Second).String(),
+		"Frames":   frames,
+		"At":       at.Seconds(),
+	})
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// htmlPlayer is the export template. html/template encodes values used inside
+// the script as JS literals, so recorded output cannot escape the page.
+var htmlPlayer = template.Must(template.New("player").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body{margin:0;background:#111;color:#ddd;font-family:system-ui,sans-serif}
+header{padding:10px 16px;font-size:14px;color:#999}
+#screen{margin:0 16px;padding:12px;background:#000;font:13px/1.3 ui-monospace,Menlo,Consolas,monospace;white-space:pre;overflow-x:auto;min-height:60vh}
+#controls{display:flex;gap:10px;align-items:center;padding:10px 16px}
+#scrub{flex:1}
+button{background:#333;color:#ddd;border:1px solid #555;border-radius:4px;padding:4px 12px;cursor:pointer}
+</style>
+</head>
+<body>
+<header id="title"></header>
+<pre id="screen"></pre>
+<div id="controls">
+<button id="play">play</button>
+<select id="speed"><option value="1">1x</option><option value="2">2x</option><option value="4">4x</option><option value="16">16x</option></select>
+<input id="scrub" type="range" min="0" value="0" step="1">
+<span id="clock">0:00</span>
+</div>
+<script>
+var FRAMES = {{.Frames}};
+document.getElementById('title').textContent = {{.Title}} + ' · ' + {{.Duration}};
+var screen = document.getElementById('screen'), scrub = document.getElementById('scrub');
+var clock = document.getElementById('clock'), playBtn = document.getElementById('play');
+var speed = document.getElementById('speed');
+var idx = 0, timer = null;
+scrub.max = Math.max(FRAMES.length - 1, 0);
+function fmt(t) { var s = Math.floor(t); return Math.floor(s / 60) + ':' + ('0' + (s % 60)).slice(-2); }
+function show(i) {
+  if (!FRAMES.length) return;
+  idx = i;
+  screen.textContent = FRAMES[i].l.join('\n');
+  scrub.value = i;
+  clock.textContent = fmt(FRAMES[i].t);
+}
+function stop() { clearTimeout(timer); timer = null; playBtn.textContent = 'play'; }
+function step() {
+  if (idx >= FRAMES.length - 1) { stop(); return; }
+  var wait = (FRAMES[idx + 1].t - FRAMES[idx].t) * 1000 / Number(speed.value);
+  timer = setTimeout(function() { show(idx + 1); step(); }, Math.min(wait, 2000));
+}
+playBtn.onclick = function() {
+  if (timer) { stop(); return; }
+  if (idx >= FRAMES.length - 1) show(0);
+  playBtn.textContent = 'pause';
+  step();
+};
+scrub.oninput = function() { stop(); show(Number(scrub.value)); };
+function frameAt(t) {
+  var i = 0;
+  while (i < FRAMES.length - 1 && FRAMES[i + 1].t <= t) i++;
+  return i;
+}
+var hashT = /^#t=([\d.]+)$/.exec(location.hash);
+var startAt = hashT ? Number(hashT[1]) : {{.At}};
+show(startAt > 0 ? frameAt(startAt) : Math.max(FRAMES.length - 1, 0));
+</script>
+</body>
+</html>
+`))
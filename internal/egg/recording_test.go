@@ -0,0 +1,150 @@
+package egg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildAudit encodes frames the way the egg's audit writer does.
+func buildAudit(cols, rows int, frames []AuditFrame) []byte {
+	var buf bytes.Buffer
+	put := func(v uint64) { buf.Write(binary.AppendUvarint(nil, v)) }
+	buf.WriteString("WTA2")
+	put(uint64(cols))
+	put(uint64(rows))
+	var last time.Duration
+	for _, f := range frames {
+		put(uint64((f.At - last).Milliseconds()))
+		last = f.At
+		put(uint64(f.Type))
+		data := f.Data
+		if f.Type == AuditFrameResize {
+			data = binary.AppendUvarint(binary.AppendUvarint(nil, uint64(f.Cols)), uint64(f.Rows))
+		}
+		put(uint64(len(data)))
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeAuditRecording(t *testing.T) {
+	raw := buildAudit(100, 30, []AuditFrame{
+		{At: 0, Type: AuditFrameOutput, Data: []byte("hello\r\n")},
+		{At: 1500 * time.Millisecond, Type: AuditFrameResize, Cols: 120, Rows: 40},
+		{At: 2 * time.Second, Type: AuditFrameOutput, Data: []byte("world")},
+	})
+	// Truncated tail from a live session is dropped
+	raw = append(raw, 0x05, 0x00, 0x10, 'x')
+
+	rec := DecodeAuditRecording(raw, 80, 24)
+	if rec.Cols != 100 || rec.Rows != 30 {
+		t.Fatalf("dims = %dx%d, want 100x30", rec.Cols, rec.Rows)
+	}
+	if len(rec.Frames) != 3 {
+		t.Fatalf("frames = %d, want 3", len(rec.Frames))
+	}
+	if f := rec.Frames[1]; f.Type != AuditFrameResize || f.Cols != 120 || f.Rows != 40 || f.At != 1500*time.Millisecond {
+		t.Errorf("resize frame = %+v", f)
+	}
+	if string(rec.Frames[2].Data) != "world" || rec.Duration() != 2*time.Second {
+		t.Errorf("last frame = %+v", rec.Frames[2])
+	}
+}
+
+func TestDecodeAuditRecordingV1(t *testing.T) {
+	// V1: no header, no frame type
+	raw := []byte{0x00, 0x02, 'h', 'i', 0x0a, 0x01, '!'}
+	rec := DecodeAuditRecording(raw, 90, 20)
+	if rec.Cols != 90 || rec.Rows != 20 || len(rec.Frames) != 2 {
+		t.Fatalf("rec = %+v", rec)
+	}
+	if rec.Frames[1].At != 10*time.Millisecond || string(rec.Frames[1].Data) != "!" {
+		t.Errorf("frame = %+v", rec.Frames[1])
+	}
+}
+
+func TestWriteAsciicast(t *testing.T) {
+	euro := []byte("€") // 3 bytes, split across frames
+	rec := DecodeAuditRecording(buildAudit(80, 24, []AuditFrame{
+		{At: 0, Type: AuditFrameOutput, Data: append([]byte("a"), euro[:2]...)},
+		{At: 250 * time.Millisecond, Type: AuditFrameOutput, Data: euro[2:]},
+		{At: time.Second, Type: AuditFrameResize, Cols: 100, Rows: 30},
+	}), 0, 0)
+
+	var out bytes.Buffer
+	if err := rec.WriteAsciicast(&out, "claude"); err != nil {
+		t.Fatal(err)
+	}
+	sc := bufio.NewScanner(&out)
+	sc.Scan()
+	var header struct {
+		Version, Width, Height int
+		Title                  string
+	}
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Title != "claude" {
+		t.Errorf("header = %+v", header)
+	}
+	var events [][]any
+	for sc.Scan() {
+		var ev []any
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("event %q: %v", sc.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %v", events)
+	}
+	if events[0][2] != "a" || events[1][2] != "€" || events[1][0] != 0.25 {
+		t.Errorf("output events = %v", events[:2])
+	}
+	if events[2][1] != "r" || events[2][2] != "100x30" {
+		t.Errorf("resize event = %v", events[2])
+	}
+}
+
+func TestWriteTranscript(t *testing.T) {
+	rec := DecodeAuditRecording(buildAudit(20, 3, []AuditFrame{
+		{Type: AuditFrameOutput, Data: []byte("\x1b[1;31mline one\x1b[0m\r\nline two\r\n")},
+		{Type: AuditFrameOutput, Data: []byte("line three\r\nline four")},
+	}), 0, 0)
+
+	var out bytes.Buffer
+	if err := rec.WriteTranscript(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := "line one\nline two\nline three\nline four\n"
+	if out.String() != want {
+		t.Errorf("transcript = %q, want %q", out.String(), want)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	rec := DecodeAuditRecording(buildAudit(40, 5, []AuditFrame{
+		{Type: AuditFrameOutput, Data: []byte("</script><b>x</b>\r\n")},
+		{At: time.Second, Type: AuditFrameOutput, Data: []byte("done")},
+	}), 0, 0)
+
+	var out bytes.Buffer
+	if err := rec.WriteHTML(&out, "<agent>", 0); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	if strings.Count(page, "</script>") != 1 {
+		t.Error("recorded output closed the script element")
+	}
+	if strings.Contains(page, "<agent>") {
+		t.Error("title not escaped")
+	}
+	if !strings.Contains(page, "done") {
+		t.Error("final frame missing")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
@@ -77,6 +78,7 @@ type Session struct {
 	debug          bool
 	audit          bool
 	auditor        *inputAuditor // nil when audit disabled
+	auditChain     *auditChain   // hash chain over audit.pty.gz + audit.log; nil when audit disabled
 	auditWriter    *gzip.Writer  // nil when audit disabled or after PTY exit
 	auditFile      *os.File     // underlying file for audit flush
 	auditStart     time.Time     // start time for audit timestamps
@@ -111,6 +113,7 @@ type RunConfig struct {
 	ResumeSessionID            string // agent session ID to resume (from chat.meta)
 	ToolNames                  []string // names of privileged tools (for shim generation)
 	ToolSocketPath             string   // path to tool.sock (set by wing, empty = no tools)
+	AuditKey                   ed25519.PrivateKey // signs the audit chain (nil = unsigned)
 }
 
 // replayBuffer is an append-only (bounded) log of PTY output.
@@ -561,7 +564,7 @@ func (s *Server) RunSession(ctx context.Context, rc RunConfig) error {
 			wtBin = resolved
 		}
 		for _, name := range rc.ToolNames {
-			toolShim := fmt.Sprintf("#!/bin/sh\nexec \"%s\" tool-call %s \"$@\"\n", wtBin, name)
+			toolShim := fmt.Sprintf("#!/bin/sh\nexec \"%s\" tool-call --stream %s \"$@\"\n", wtBin, name)
 			os.WriteFile(filepath.Join(toolsDir, name), []byte(toolShim), 0755)
 		}
 		if path, ok := envMap["PATH"]; ok {
@@ -743,11 +746,18 @@ func (s *Server) RunSession(ctx context.Context, rc RunConfig) error {
 
 	// Set up input auditor if audit is enabled
 	if rc.Audit {
+		chain, chainErr := newAuditChain(s.dir, sessionID, rc.AuditKey)
+		if chainErr != nil {
+			log.Printf("egg: audit chain failed: %v", chainErr)
+		} else {
+			sess.auditChain = chain
+		}
 		auditPath := filepath.Join(s.dir, "audit.log")
 		auditor, auditErr := newInputAuditor(auditPath)
 		if auditErr != nil {
 			log.Printf("egg: audit log failed: %v", auditErr)
 		} else {
+			auditor.chain = sess.auditChain
 			sess.auditor = auditor
 			log.Printf("egg: audit enabled → %s", auditPath)
 		}
@@ -823,7 +833,7 @@ func (s *Server) RunSession(ctx context.Context, rc RunConfig) error {
 
 	// Write session metadata so the wing can read it on reclaim
 	metaPath := filepath.Join(s.dir, "egg.meta")
-	metaContent := fmt.Sprintf("agent=%s\ncwd=%s\nnetwork=%s\ncols=%d\nrows=%d\n", rc.Agent, rc.CWD, networkSummary, rc.Cols, rc.Rows)
+	metaContent := fmt.Sprintf("agent=%s\ncwd=%s\nnetwork=%s\ncols=%d\nrows=%d\nstarted=%d\n", rc.Agent, rc.CWD, networkSummary, rc.Cols, rc.Rows, sess.StartedAt.UnixMilli())
 	if err := os.WriteFile(metaPath, []byte(metaContent), 0644); err != nil {
 		log.Printf("egg: warning: write meta: %v", err)
 	}
@@ -981,6 +991,11 @@ func (s *Server) readPTY(sess *Session) {
 		}
 	}
 
+	// The chain is sealed last, after both audit streams are closed
+	if sess.auditChain != nil {
+		defer sess.auditChain.Close()
+	}
+
 	// PTY stream audit: gzipped V2 varint delta format for replay
 	if sess.audit {
 		path := filepath.Join(s.dir, "audit.pty.gz")
@@ -989,9 +1004,22 @@ func (s *Server) readPTY(sess *Session) {
 			log.Printf("egg: audit pty recording failed: %v", err)
 		} else {
 			gw := gzip.NewWriter(f)
-			gw.Write([]byte("WTA2")) // V2 header
-			writeVarint(gw, uint64(sess.Cols))
-			writeVarint(gw, uint64(sess.Rows))
+			var hdr bytes.Buffer
+			hdr.WriteString("WTA2") // V2 header
+			writeVarint(&hdr, uint64(sess.Cols))
+			writeVarint(&hdr, uint64(sess.Rows))
+			gw.Write(hdr.Bytes())
+			if sess.auditChain != nil {
+				sess.auditChain.Add(ChainStreamPTY, hdr.Bytes())
+				sess.auditChain.SetFlusher(ChainStreamPTY, func() {
+					sess.auditMu.Lock()
+					defer sess.auditMu.Unlock()
+					if sess.auditWriter != nil {
+						sess.auditWriter.Flush()
+						sess.auditFile.Sync()
+					}
+				})
+			}
 			sess.auditMu.Lock()
 			sess.auditWriter = gw
 			sess.auditFile = f
@@ -1053,10 +1081,16 @@ func (sess *Session) writeAuditFrame(frameType uint64, data []byte) {
 	ms := uint64(time.Since(sess.auditStart).Milliseconds())
 	delta := ms - sess.auditLastMS
 	sess.auditLastMS = ms
-	writeVarint(sess.auditWriter, delta)
-	writeVarint(sess.auditWriter, frameType)
-	writeVarint(sess.auditWriter, uint64(len(data)))
+	var hdr [30]byte
+	n := binary.PutUvarint(hdr[:], delta)
+	n += binary.PutUvarint(hdr[n:], frameType)
+	n += binary.PutUvarint(hdr[n:], uint64(len(data)))
+	sess.auditWriter.Write(hdr[:n])
 	sess.auditWriter.Write(data)
+	if sess.auditChain != nil {
+		sess.auditChain.Add(ChainStreamPTY, hdr[:n])
+		sess.auditChain.Add(ChainStreamPTY, data)
+	}
 	sess.auditFrames++
 	if sess.auditFrames%100 == 0 {
 		sess.auditWriter.Flush()
@@ -1138,6 +1172,24 @@ func (s *Server) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusR
 	}, nil
 }
 
+// Audit appends an event from the wing to the session's audit log, inside
+// the hash chain.
+func (s *Server) Audit(ctx context.Context, req *pb.AuditRequest) (*pb.AuditResponse, error) {
+	s.mu.RLock()
+	sess := s.session
+	s.mu.RUnlock()
+	if sess == nil {
+		return nil, status.Error(codes.NotFound, "no session")
+	}
+	if sess.auditor == nil {
+		return nil, status.Error(codes.FailedPrecondition, "audit not enabled")
+	}
+	if err := sess.auditor.Record(req.Record); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.AuditResponse{}, nil
+}
+
 // Session implements the bidirectional PTY I/O stream.
 func (s *Server) Session(stream pb.Egg_SessionServer) error {
 	msg, err := stream.Recv()
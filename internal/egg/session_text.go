@@ -0,0 +1,284 @@
+package egg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/store"
+)
+
+const (
+	maxChunkText   = 2048             // bytes of text per output chunk
+	maxChunkSpan   = 30 * time.Second // output chunks never span longer than this
+	recentLineSize = 4096             // redraw dedup window (distinct lines)
+)
+
+// chatTextKeys are the JSON keys in agent transcripts that hold text worth
+// searching: messages, tool commands and their targets.
+var chatTextKeys = map[string]bool{
+	"text": true, "content": true, "command": true, "description": true,
+	"prompt": true, "query": true, "pattern": true, "file_path": true,
+	"output": true, "message": true,
+}
+
+// SessionText extracts searchable text from an egg session directory: PTY
+// output (when audited), typed input lines, and the captured chat transcript,
+// as documents for the session search index. Missing files are skipped.
+func SessionText(dir string) []store.SearchDoc {
+	start := SessionStart(dir)
+	var chunks []store.SearchDoc
+	if rec, err := ReadAuditRecording(dir); err == nil {
+		chunks = append(chunks, rec.Text()...)
+	}
+	if f, err := os.Open(filepath.Join(dir, "audit.log")); err == nil {
+		chunks = append(chunks, inputText(f, start)...)
+		f.Close()
+	}
+	if f, err := os.Open(filepath.Join(dir, "chat.jsonl.gz")); err == nil {
+		if gr, err := gzip.NewReader(f); err == nil {
+			chunks = append(chunks, chatText(gr, start)...)
+			gr.Close()
+		}
+		f.Close()
+	}
+	return chunks
+}
+
+// SessionStart returns when the session started, from egg.meta's started=
+// line. Sessions from before it was recorded return the zero time.
+func SessionStart(dir string) time.Time {
+	data, err := os.ReadFile(filepath.Join(dir, "egg.meta"))
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "started="); ok {
+			if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return time.UnixMilli(ms)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// offsetMS converts an absolute time to a session offset in milliseconds, -1
+// if unknown.
+func offsetMS(start, t time.Time) int64 {
+	if start.IsZero() || t.IsZero() {
+		return -1
+	}
+	if d := t.Sub(start); d > 0 {
+		return d.Milliseconds()
+	}
+	return 0
+}
+
+// Text strips escape sequences from the recording's output and groups the
+// remaining lines into chunks stamped with the time their first line was
+// printed. Lines a TUI redraws over and over are kept once.
+func (r *AuditRecording) Text() []store.SearchDoc {
+	var (
+		chunks []store.SearchDoc
+		cur    strings.Builder
+		curAt  time.Duration
+		recent = make(map[string]bool)
+		st     textStripper
+	)
+	flush := func() {
+		if cur.Len() > 0 {
+			chunks = append(chunks, store.SearchDoc{Source: store.SearchSourceOutput, AtMS: curAt.Milliseconds(), Body: cur.String()})
+			cur.Reset()
+		}
+	}
+	for _, f := range r.Frames {
+		if f.Type != AuditFrameOutput {
+			continue
+		}
+		for _, sl := range st.Feed(f.Data, f.At) {
+			line := strings.Join(strings.Fields(sl.text), " ")
+			if len(line) < 3 || recent[line] {
+				continue
+			}
+			if len(recent) >= recentLineSize {
+				clear(recent)
+			}
+			recent[line] = true
+			if cur.Len() > 0 && (cur.Len()+len(line) > maxChunkText || sl.at-curAt > maxChunkSpan) {
+				flush()
+			}
+			if cur.Len() == 0 {
+				curAt = sl.at
+			} else {
+				cur.WriteByte('\n')
+			}
+			cur.WriteString(line)
+		}
+	}
+	if line := strings.Join(strings.Fields(st.line.String()), " "); len(line) >= 3 && !recent[line] {
+		if cur.Len() > 0 && st.lineAt-curAt > maxChunkSpan {
+			flush()
+		}
+		if cur.Len() == 0 {
+			curAt = st.lineAt
+		} else {
+			cur.WriteByte('\n')
+		}
+		cur.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// textStripper removes terminal escape sequences from a byte stream, carrying
+// parser state across chunks. Cursor positioning breaks lines and cursor
+// forward becomes a space so words drawn apart do not run together.
+type textStripper struct {
+	state  int // 0=text, 1=ESC, 2=CSI, 3=OSC/DCS string, 4=string got ESC
+	line   bytes.Buffer
+	lineAt time.Duration // when the current line's first byte arrived
+}
+
+type strippedLine struct {
+	at   time.Duration
+	text string
+}
+
+// Feed consumes output written at offset at and returns the lines it
+// completed, stamped with when each started.
+func (s *textStripper) Feed(p []byte, at time.Duration) []strippedLine {
+	var lines []strippedLine
+	emit := func() {
+		if s.line.Len() > 0 {
+			lines = append(lines, strippedLine{at: s.lineAt, text: strings.ToValidUTF8(s.line.String(), "")})
+			s.line.Reset()
+		}
+	}
+	put := func(b byte) {
+		if s.line.Len() == 0 {
+			s.lineAt = at
+		}
+		s.line.WriteByte(b)
+	}
+	for _, b := range p {
+		switch s.state {
+		case 1:
+			switch b {
+			case '[':
+				s.state = 2
+			case ']', 'P', '_', '^':
+				s.state = 3
+			default:
+				s.state = 0
+			}
+		case 2:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = 0
+				switch b {
+				case 'C':
+					put(' ')
+				case 'H', 'f', 'd', 'J', 'E', 'F':
+					emit()
+				}
+			}
+		case 3:
+			if b == 0x07 {
+				s.state = 0
+			} else if b == 0x1b {
+				s.state = 4
+			}
+		case 4:
+			if b == '\\' {
+				s.state = 0
+			} else {
+				s.state = 3
+			}
+		default:
+			switch {
+			case b == 0x1b:
+				s.state = 1
+			case b == '\n' || b == '\r':
+				emit()
+			case b == '\t':
+				put(' ')
+			case b >= 0x20 && b != 0x7f:
+				put(b)
+			}
+		}
+	}
+	return lines
+}
+
+// inputText reads audit.log ("RFC3339<TAB>line") into one chunk per line.
+func inputText(r io.Reader, start time.Time) []store.SearchDoc {
+	var chunks []store.SearchDoc
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		ts, line, ok := strings.Cut(sc.Text(), "\t")
+		if !ok || strings.TrimSpace(line) == "" {
+			continue
+		}
+		t, _ := time.Parse(time.RFC3339, ts)
+		chunks = append(chunks, store.SearchDoc{Source: store.SearchSourceInput, AtMS: offsetMS(start, t), Body: line})
+	}
+	return chunks
+}
+
+// chatText reads an agent JSONL transcript into one chunk per entry, keeping
+// the string values under chatTextKeys. Entries with a "timestamp" field are
+// placed on the session timeline.
+func chatText(r io.Reader, start time.Time) []store.SearchDoc {
+	var chunks []store.SearchDoc
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var entry map[string]any
+		if json.Unmarshal(sc.Bytes(), &entry) != nil {
+			continue
+		}
+		var parts []string
+		collectChatText(entry, &parts)
+		if len(parts) == 0 {
+			continue
+		}
+		var t time.Time
+		if ts, ok := entry["timestamp"].(string); ok {
+			t, _ = time.Parse(time.RFC3339Nano, ts)
+		}
+		chunks = append(chunks, store.SearchDoc{Source: store.SearchSourceChat, AtMS: offsetMS(start, t), Body: strings.Join(parts, "\n")})
+	}
+	return chunks
+}
+
+func collectChatText(v any, parts *[]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := v[k]
+			if s, ok := child.(string); ok {
+				if chatTextKeys[k] && strings.TrimSpace(s) != "" {
+					*parts = append(*parts, s)
+				}
+				continue
+			}
+			collectChatText(child, parts)
+		}
+	case []any:
+		for _, child := range v {
+			collectChatText(child, parts)
+		}
+	}
+}
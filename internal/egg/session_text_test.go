@@ -0,0 +1,60 @@
+package egg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/store"
+)
+
+func TestRecordingText(t *testing.T) {
+	rec := DecodeAuditRecording(buildAudit(80, 24, []AuditFrame{
+		{Type: AuditFrameOutput, Data: []byte("\x1b]0;claude\x07\x1b[1mRunning\x1b[0m migrations\r\n")},
+		// Redraw of the same line is indexed once; split escape across frames
+		{At: time.Second, Type: AuditFrameOutput, Data: []byte("\x1b[2J\x1b[HRunning migrations\r\n\x1b[3")},
+		{At: 2 * time.Second, Type: AuditFrameOutput, Data: []byte("8;5;1mapplied\x1b[2C3 files")},
+		{At: time.Minute, Type: AuditFrameOutput, Data: []byte("\r\nall done\r\n")},
+	}), 0, 0)
+
+	chunks := rec.Text()
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	if chunks[0].Body != "Running migrations\napplied 3 files" || chunks[0].AtMS != 0 {
+		t.Errorf("first chunk = %+v", chunks[0])
+	}
+	if chunks[1].Body != "all done" || chunks[1].AtMS != time.Minute.Milliseconds() {
+		t.Errorf("second chunk = %+v", chunks[1])
+	}
+}
+
+func TestSessionText(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	os.WriteFile(filepath.Join(dir, "egg.meta"), []byte("agent=claude\ncwd=/tmp\nstarted="+
+		strconv.FormatInt(start.UnixMilli(), 10)+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "audit.log"), []byte("2026-03-01T12:00:30Z\tmake migrate\n2026-03-01T12:00:31Z\t\n"), 0644)
+
+	var chat bytes.Buffer
+	gw := gzip.NewWriter(&chat)
+	gw.Write([]byte(`{"type":"assistant","timestamp":"2026-03-01T12:01:00.000Z","uuid":"abc","message":{"role":"assistant","content":[{"type":"tool_use","input":{"command":"psql -f schema.sql","description":"Apply schema"}}]}}` + "\n"))
+	gw.Write([]byte("not json\n"))
+	gw.Close()
+	os.WriteFile(filepath.Join(dir, "chat.jsonl.gz"), chat.Bytes(), 0644)
+
+	chunks := SessionText(dir)
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	if c := chunks[0]; c.Source != store.SearchSourceInput || c.Body != "make migrate" || c.AtMS != 30000 {
+		t.Errorf("input chunk = %+v", c)
+	}
+	if c := chunks[1]; c.Source != store.SearchSourceChat || c.Body != "psql -f schema.sql\nApply schema" || c.AtMS != 60000 {
+		t.Errorf("chat chunk = %+v", c)
+	}
+}
@@ -0,0 +1,108 @@
+package egg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ehrlich-b/wingthing/internal/config"
+	"github.com/ehrlich-b/wingthing/internal/sandbox"
+)
+
+// ToolPolicy resolves a tool's sandbox section into an EggConfig. It reads
+// like egg.yaml: no base merges onto the built-in defaults, "base: none"
+// starts empty, and relative bases resolve against the tool's file. Returns
+// nil for tools without a sandbox section.
+func ToolPolicy(tc *config.ToolConfig) (*EggConfig, error) {
+	if !tc.Sandboxed() {
+		return nil, nil
+	}
+	var child EggConfig
+	if err := tc.Sandbox.Decode(&child); err != nil {
+		return nil, fmt.Errorf("parse sandbox: %w", err)
+	}
+	dir := ""
+	if tc.Path != "" {
+		dir = filepath.Dir(tc.Path)
+	}
+	return ResolveInlineEggConfig(&child, dir)
+}
+
+// toolEnv is the environment a sandboxed tool sees: only what its policy
+// allows from the wing's environment, plus the tool's own env.
+func toolEnv(tc *config.ToolConfig, policy *EggConfig) []string {
+	return append(policy.BuildEnv(""), toolEnvSlice(tc.Env)...)
+}
+
+// sandboxedTool is a tool command running under its own policy.
+type sandboxedTool struct {
+	cmd   *exec.Cmd
+	sb    sandbox.Sandbox
+	proxy *sandbox.DomainProxy
+}
+
+// newSandboxedTool builds the sh command for a tool inside sandbox.New with
+// the tool's policy. Fails closed: a policy that can't be parsed or enforced
+// is an error, never a fallback to running unsandboxed.
+func newSandboxedTool(ctx context.Context, tc *config.ToolConfig, cmdArgs []string) (*sandboxedTool, error) {
+	policy, err := ToolPolicy(tc)
+	if err != nil {
+		return nil, err
+	}
+	sbCfg := policy.ToSandboxConfig("")
+	sbCfg.SessionID = "tool-" + tc.Name + "-" + newApprovalID()
+	env := toolEnv(tc, policy)
+
+	st := &sandboxedTool{}
+	if sbCfg.NetworkNeed == sandbox.NetworkHTTPS {
+		st.proxy, err = sandbox.StartProxy(sbCfg.Domains)
+		if err != nil {
+			log.Printf("tool %s: warning: domain proxy failed, falling back to port-level filtering: %v", tc.Name, err)
+		} else {
+			sbCfg.ProxyPort = st.proxy.Port()
+			proxyURL := fmt.Sprintf("http://localhost:%d", st.proxy.Port())
+			env = append(env, "HTTPS_PROXY="+proxyURL, "HTTP_PROXY="+proxyURL)
+		}
+	}
+
+	st.sb, err = sandbox.New(sbCfg)
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+	st.cmd, err = st.sb.Exec(ctx, "sh", cmdArgs)
+	if err != nil {
+		st.Close()
+		return nil, fmt.Errorf("exec: %w", err)
+	}
+	st.cmd.Env = env
+	// Same working directory as an unsandboxed tool; what it may touch
+	// there is up to the policy
+	st.cmd.Dir, _ = os.Getwd()
+	if st.cmd.SysProcAttr == nil {
+		st.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	st.cmd.SysProcAttr.Setpgid = true
+	return st, nil
+}
+
+// PostStart applies the policy's post-start limits to the started tool.
+func (st *sandboxedTool) PostStart() {
+	if err := st.sb.PostStart(st.cmd.Process.Pid); err != nil {
+		log.Printf("tool: sandbox post-start warning: %v", err)
+	}
+}
+
+// Close tears down the sandbox and proxy once the tool has exited.
+func (st *sandboxedTool) Close() {
+	if st.sb != nil {
+		st.sb.Destroy()
+	}
+	if st.proxy != nil {
+		st.proxy.Close()
+	}
+}
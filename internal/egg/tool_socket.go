@@ -1,7 +1,10 @@
 package egg
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,20 +25,24 @@ type ToolRequest struct {
 	Action string   `json:"action,omitempty"` // "list" for tool discovery
 	Tool   string   `json:"tool,omitempty"`
 	Args   []string `json:"args,omitempty"`
+	Stream bool     `json:"stream,omitempty"` // reply with ToolStreamFrames; stdin follows the request line
 }
 
 // ToolResponse is returned to the client.
 type ToolResponse struct {
-	ExitCode int    `json:"exit_code,omitempty"`
-	Stdout   string `json:"stdout,omitempty"`
-	Stderr   string `json:"stderr,omitempty"`
-	Error    string `json:"error,omitempty"`
+	ExitCode  int    `json:"exit_code,omitempty"`
+	Stdout    string `json:"stdout,omitempty"`
+	Stderr    string `json:"stderr,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"` // output passed the tool's max_output_bytes
 }
 
 // ToolListEntry describes one tool for the list action.
 type ToolListEntry struct {
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Params      []config.ToolParam `json:"params,omitempty"`
+	Approval    string             `json:"approval,omitempty"` // first/always: calls wait for the session owner
 }
 
 // ToolListResponse is returned for the "list" action.
@@ -43,6 +50,41 @@ type ToolListResponse struct {
 	Tools []ToolListEntry `json:"tools"`
 }
 
+// ToolApprovalTimeout is how long a gated call waits for the owner's answer.
+const ToolApprovalTimeout = 5 * time.Minute
+
+// ToolApproval is a gated tool call waiting on the session owner.
+type ToolApproval struct {
+	ID          string // random; the browser echoes it back with the answer
+	Tool        string
+	Description string
+	Args        []string // exactly what the tool will get as $1..$n
+}
+
+// ToolDecision is the answer to a ToolApproval.
+type ToolDecision struct {
+	Approved bool
+	By       string // who answered (email or user ID); empty if no one did
+	Reason   string // why the call was denied without an answer (timeout, session ended)
+}
+
+// ToolApprover asks the session owner about a call and blocks until they
+// answer or ctx ends. It must not approve on ctx expiry.
+type ToolApprover func(ctx context.Context, req ToolApproval) ToolDecision
+
+// ToolCallRecord describes one call for the wing's tool ledger. Calls that
+// never ran (bad args, denied, rate limited) have Error set.
+type ToolCallRecord struct {
+	Tool        string
+	Args        []string
+	Started     time.Time
+	Duration    time.Duration // execution time; 0 if the call never ran
+	ExitCode    int
+	Error       string
+	OutputBytes int64
+	OutputHash  string // hex SHA-256 of all output in arrival order, truncated to 128 bits
+}
+
 // ToolListener accepts connections on a Unix socket and dispatches tool execution.
 type ToolListener struct {
 	mu       sync.RWMutex
@@ -50,6 +92,16 @@ type ToolListener struct {
 	listener net.Listener
 	wg       sync.WaitGroup
 	sema     map[string]chan struct{} // per-tool concurrency semaphores
+
+	ctx      context.Context // cancelled by Close; ends pending approvals
+	cancel   context.CancelFunc
+	approver ToolApprover
+	audit    func(record string) // records each decision in the session's audit log
+	approved map[string]bool     // "first" tools already approved this session
+
+	recorder     func(ToolCallRecord)
+	recent       map[string][]time.Time // per-tool call times in the last minute
+	sessionCalls map[string]int         // per-tool calls admitted this session
 }
 
 // NewToolListener creates and starts a tool socket listener.
@@ -61,10 +113,17 @@ func NewToolListener(sockPath string, tools []*config.ToolConfig) (*ToolListener
 		return nil, fmt.Errorf("listen tool socket: %w", err)
 	}
 	os.Chmod(sockPath, 0700)
+	ctx, cancel := context.WithCancel(context.Background())
 	tl := &ToolListener{
 		tools:    make(map[string]*config.ToolConfig, len(tools)),
 		listener: ln,
 		sema:     make(map[string]chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		approved: make(map[string]bool),
+
+		recent:       make(map[string][]time.Time),
+		sessionCalls: make(map[string]int),
 	}
 	for _, t := range tools {
 		tl.tools[t.Name] = t
@@ -78,12 +137,33 @@ func NewToolListener(sockPath string, tools []*config.ToolConfig) (*ToolListener
 }
 
 // Close stops the listener and waits for in-flight requests to finish.
+// Calls still waiting on approval are denied.
 func (tl *ToolListener) Close() error {
+	tl.cancel()
 	err := tl.listener.Close()
 	tl.wg.Wait()
 	return err
 }
 
+// SetApprover installs the function that asks the session owner about tools
+// with approval "first" or "always", and the function each decision is
+// recorded with (see ToolDecisionRecord). Without an approver those tools
+// are refused.
+func (tl *ToolListener) SetApprover(fn ToolApprover, audit func(record string)) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.approver = fn
+	tl.audit = audit
+}
+
+// SetRecorder installs a function called after every call to a known tool,
+// whether it ran or was refused.
+func (tl *ToolListener) SetRecorder(fn func(ToolCallRecord)) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.recorder = fn
+}
+
 // Reload replaces the tool configs atomically.
 func (tl *ToolListener) Reload(tools []*config.ToolConfig) {
 	tl.mu.Lock()
@@ -92,6 +172,10 @@ func (tl *ToolListener) Reload(tools []*config.ToolConfig) {
 	newSema := make(map[string]chan struct{})
 	for _, t := range tools {
 		newMap[t.Name] = t
+		// A changed command needs approving again
+		if old, ok := tl.tools[t.Name]; !ok || old.Run != t.Run {
+			delete(tl.approved, t.Name)
+		}
 		if t.MaxConcurrent > 0 {
 			// Reuse existing semaphore if same capacity
 			if old, ok := tl.sema[t.Name]; ok && cap(old) == t.MaxConcurrent {
@@ -126,8 +210,11 @@ func (tl *ToolListener) acceptLoop() {
 func (tl *ToolListener) handleConn(conn net.Conn) {
 	defer conn.Close()
 	conn.SetDeadline(time.Now().Add(30 * time.Second))
-	data, err := io.ReadAll(conn)
-	if err != nil {
+	// The request is one JSON line. Plain requests end at EOF instead of a
+	// newline; streaming requests are followed by the tool's stdin.
+	br := bufio.NewReader(conn)
+	data, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
 		writeJSON(conn, ToolResponse{Error: "read failed: " + err.Error()})
 		return
 	}
@@ -140,8 +227,12 @@ func (tl *ToolListener) handleConn(conn net.Conn) {
 		tl.handleList(conn)
 		return
 	}
+	reply := func(resp ToolResponse) { writeJSON(conn, resp) }
+	if req.Stream {
+		reply = (&frameWriter{conn: conn}).final
+	}
 	if req.Tool == "" {
-		writeJSON(conn, ToolResponse{Error: "missing tool name"})
+		reply(ToolResponse{Error: "missing tool name"})
 		return
 	}
 	tl.mu.RLock()
@@ -152,9 +243,54 @@ func (tl *ToolListener) handleConn(conn net.Conn) {
 	}
 	tl.mu.RUnlock()
 	if !ok {
-		writeJSON(conn, ToolResponse{Error: "unknown tool: " + req.Tool})
+		reply(ToolResponse{Error: "unknown tool: " + req.Tool})
 		return
 	}
+	started := time.Now()
+	var resp ToolResponse
+	var took time.Duration
+	var out *toolOutput
+	if req.Stream {
+		fw := &frameWriter{conn: conn}
+		out = newToolOutput(tc.OutputLimit(), fw.output)
+		resp, took = tl.call(conn, tc, sema, req.Args, br, out)
+		fw.final(resp)
+	} else {
+		var stdout, stderr strings.Builder
+		out = newToolOutput(tc.OutputLimit(), func(stream int, p []byte) {
+			if stream == streamStdout {
+				stdout.Write(p)
+			} else {
+				stderr.Write(p)
+			}
+		})
+		resp, took = tl.call(conn, tc, sema, req.Args, nil, out)
+		if resp.Error == "" {
+			resp.Stdout, resp.Stderr = stdout.String(), stderr.String()
+		}
+		writeJSON(conn, resp)
+	}
+	tl.record(tc, req.Args, started, took, resp, out)
+}
+
+// call runs one request for a known tool through validation, rate limits,
+// approval and the concurrency limit, passing output through out. Returns the
+// response without output and how long the tool itself ran.
+func (tl *ToolListener) call(conn net.Conn, tc *config.ToolConfig, sema chan struct{}, args []string, stdin io.Reader, out *toolOutput) (ToolResponse, time.Duration) {
+	// Reject malformed args before anything reaches the shell
+	if err := tc.ValidateArgs(args); err != nil {
+		return ToolResponse{Error: fmt.Sprintf("tool %s: %v", tc.Name, err)}, 0
+	}
+	if err := tl.admit(tc); err != nil {
+		return ToolResponse{Error: fmt.Sprintf("tool %s: %v", tc.Name, err)}, 0
+	}
+	// Hold the call until the owner answers
+	if tc.NeedsApproval() {
+		conn.SetDeadline(time.Now().Add(ToolApprovalTimeout + 30*time.Second))
+		if err := tl.approve(tc, args); err != nil {
+			return ToolResponse{Error: fmt.Sprintf("tool %s: %v", tc.Name, err)}, 0
+		}
+	}
 	// Extend deadline based on tool timeout
 	toolTimeout := tc.TimeoutDuration()
 	if toolTimeout <= 0 {
@@ -171,26 +307,142 @@ func (tl *ToolListener) handleConn(conn net.Conn) {
 		case sema <- struct{}{}:
 			defer func() { <-sema }()
 		default:
-			writeJSON(conn, ToolResponse{Error: fmt.Sprintf("tool %s: max concurrent limit reached", req.Tool)})
-			return
+			return ToolResponse{Error: fmt.Sprintf("tool %s: max concurrent limit reached", tc.Name)}, 0
+		}
+	}
+	start := time.Now()
+	exitCode := tl.executeTool(tc, args, stdin, out)
+	return ToolResponse{ExitCode: exitCode, Truncated: out.Truncated()}, time.Since(start)
+}
+
+// admit enforces max_calls_per_minute and max_calls_per_session. Admitted
+// calls count even if they are later denied or fail.
+func (tl *ToolListener) admit(tc *config.ToolConfig) error {
+	if tc.MaxCallsPerMinute <= 0 && tc.MaxCallsPerSession <= 0 {
+		return nil
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tc.MaxCallsPerSession > 0 && tl.sessionCalls[tc.Name] >= tc.MaxCallsPerSession {
+		return fmt.Errorf("rate limit: at most %d calls per session", tc.MaxCallsPerSession)
+	}
+	now := time.Now()
+	if tc.MaxCallsPerMinute > 0 {
+		recent := tl.recent[tc.Name]
+		i := 0
+		for i < len(recent) && now.Sub(recent[i]) >= time.Minute {
+			i++
+		}
+		recent = recent[i:]
+		if len(recent) >= tc.MaxCallsPerMinute {
+			tl.recent[tc.Name] = recent
+			retry := time.Minute - now.Sub(recent[0])
+			return fmt.Errorf("rate limit: at most %d calls per minute (retry in %s)", tc.MaxCallsPerMinute, retry.Round(time.Second))
 		}
+		tl.recent[tc.Name] = append(recent, now)
 	}
-	resp := tl.executeTool(tc, req.Args)
-	writeJSON(conn, resp)
+	tl.sessionCalls[tc.Name]++
+	return nil
+}
+
+func (tl *ToolListener) record(tc *config.ToolConfig, args []string, started time.Time, took time.Duration, resp ToolResponse, out *toolOutput) {
+	tl.mu.RLock()
+	recorder := tl.recorder
+	tl.mu.RUnlock()
+	if recorder == nil {
+		return
+	}
+	rec := ToolCallRecord{
+		Tool:     tc.Name,
+		Args:     args,
+		Started:  started,
+		Duration: took,
+		ExitCode: resp.ExitCode,
+		Error:    resp.Error,
+	}
+	if resp.Error == "" {
+		rec.OutputBytes, rec.OutputHash = out.Sum()
+	}
+	recorder(rec)
 }
 
 func (tl *ToolListener) handleList(conn net.Conn) {
 	tl.mu.RLock()
 	var entries []ToolListEntry
 	for _, t := range tl.tools {
-		entries = append(entries, ToolListEntry{Name: t.Name, Description: t.Description})
+		entry := ToolListEntry{Name: t.Name, Description: t.Description, Params: t.Params}
+		if t.NeedsApproval() {
+			entry.Approval = t.Approval
+		}
+		entries = append(entries, entry)
 	}
 	tl.mu.RUnlock()
 	data, _ := json.Marshal(ToolListResponse{Tools: entries})
 	conn.Write(data)
 }
 
-func (tl *ToolListener) executeTool(tc *config.ToolConfig, args []string) ToolResponse {
+// approve asks the owner about a gated call and records the decision.
+// "first" tools are asked once per session.
+func (tl *ToolListener) approve(tc *config.ToolConfig, args []string) error {
+	tl.mu.RLock()
+	approver, audit, once := tl.approver, tl.audit, tl.approved[tc.Name]
+	tl.mu.RUnlock()
+	if tc.Approval == config.ApprovalFirst && once {
+		return nil
+	}
+	req := ToolApproval{ID: newApprovalID(), Tool: tc.Name, Description: tc.Description, Args: args}
+	var dec ToolDecision
+	if approver == nil {
+		dec.Reason = "no one can approve it in this session"
+	} else {
+		ctx, cancel := context.WithTimeout(tl.ctx, ToolApprovalTimeout)
+		dec = approver(ctx, req)
+		cancel()
+	}
+	if audit != nil {
+		audit(ToolDecisionRecord(tc, req, dec))
+	}
+	if !dec.Approved {
+		switch {
+		case dec.Reason != "":
+			return fmt.Errorf("not approved: %s", dec.Reason)
+		case dec.By != "":
+			return fmt.Errorf("denied by %s", dec.By)
+		}
+		return fmt.Errorf("denied")
+	}
+	if tc.Approval == config.ApprovalFirst {
+		tl.mu.Lock()
+		tl.approved[tc.Name] = true
+		tl.mu.Unlock()
+	}
+	return nil
+}
+
+// ToolDecisionRecord renders a decision as a one-line audit record:
+// "tool" and a JSON object.
+func ToolDecisionRecord(tc *config.ToolConfig, req ToolApproval, dec ToolDecision) string {
+	line, _ := json.Marshal(struct {
+		ID       string   `json:"id"`
+		Tool     string   `json:"tool"`
+		Args     []string `json:"args"`
+		Approval string   `json:"approval"`
+		Approved bool     `json:"approved"`
+		By       string   `json:"by,omitempty"`
+		Reason   string   `json:"reason,omitempty"`
+	}{req.ID, tc.Name, req.Args, tc.Approval, dec.Approved, dec.By, dec.Reason})
+	return "tool " + string(line)
+}
+
+func newApprovalID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// executeTool runs the tool with stdin (nil for none), writing its output
+// to out, and returns the exit code.
+func (tl *ToolListener) executeTool(tc *config.ToolConfig, args []string, stdin io.Reader, out *toolOutput) int {
 	timeout := tc.TimeoutDuration()
 	if timeout <= 0 {
 		timeout = 60 * time.Second
@@ -200,28 +452,96 @@ func (tl *ToolListener) executeTool(tc *config.ToolConfig, args []string) ToolRe
 	// sh -c 'script' tool arg1 arg2 ...
 	// "tool" is $0, args become $1, $2, etc.
 	cmdArgs := append([]string{"-c", tc.Run, "tool"}, args...)
-	cmd := exec.CommandContext(ctx, "sh", cmdArgs...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var cmd *exec.Cmd
+	var st *sandboxedTool
+	if tc.Sandboxed() {
+		var err error
+		st, err = newSandboxedTool(ctx, tc, cmdArgs)
+		if err != nil {
+			out.Fail("sandbox: " + err.Error())
+			return 1
+		}
+		defer st.Close()
+		cmd = st.cmd
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", cmdArgs...)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		// Build environment: inherit minimal host env + tool-specific env
+		cmd.Env = append(os.Environ(), toolEnvSlice(tc.Env)...)
+	}
 	cmd.Cancel = func() error {
 		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 	}
-	// Build environment: inherit minimal host env + tool-specific env
-	cmd.Env = append(os.Environ(), toolEnvSlice(tc.Env)...)
-	var stdout, stderr strings.Builder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	exitCode := 0
+	cmd.Stdout = out.Writer(streamStdout)
+	cmd.Stderr = out.Writer(streamStderr)
+	if stdin != nil {
+		// Copy stdin ourselves: exec would wait for the client to close its
+		// side even after the tool has exited.
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			out.Fail(err.Error())
+			return 1
+		}
+		go func() {
+			io.Copy(pipe, stdin)
+			pipe.Close()
+		}()
+	}
+	err := cmd.Start()
+	if err == nil {
+		if st != nil {
+			st.PostStart()
+		}
+		err = cmd.Wait()
+	}
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return ToolResponse{ExitCode: 124, Stderr: "tool execution timed out"}
+			out.Fail("tool execution timed out")
+			return 124
 		} else if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			return ToolResponse{ExitCode: 1, Stderr: err.Error()}
+			return exitErr.ExitCode()
 		}
+		out.Fail(err.Error())
+		return 1
+	}
+	return 0
+}
+
+// ListTools asks the tool socket at sockPath for its tools.
+func ListTools(sockPath string) ([]ToolListEntry, error) {
+	var resp ToolListResponse
+	if err := toolRoundTrip(sockPath, ToolRequest{Action: "list"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tools, nil
+}
+
+// CallTool runs a tool through the tool socket at sockPath.
+func CallTool(sockPath, tool string, args []string) (ToolResponse, error) {
+	var resp ToolResponse
+	err := toolRoundTrip(sockPath, ToolRequest{Tool: tool, Args: args}, &resp)
+	return resp, err
+}
+
+func toolRoundTrip(sockPath string, req ToolRequest, resp any) error {
+	conn, err := net.Dial("unix", sockPath)
+	if err != nil {
+		return fmt.Errorf("connect to tool socket: %w", err)
+	}
+	defer conn.Close()
+	data, _ := json.Marshal(req)
+	if _, err := conn.Write(data); err != nil {
+		return fmt.Errorf("write tool request: %w", err)
+	}
+	conn.(*net.UnixConn).CloseWrite()
+	raw, err := io.ReadAll(conn)
+	if err != nil {
+		return fmt.Errorf("read tool response: %w", err)
+	}
+	if err := json.Unmarshal(raw, resp); err != nil {
+		return fmt.Errorf("parse tool response: %w", err)
 	}
-	return ToolResponse{ExitCode: exitCode, Stdout: stdout.String(), Stderr: stderr.String()}
+	return nil
 }
 
 func toolEnvSlice(env map[string]string) []string {
@@ -1,11 +1,13 @@
 package egg
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -300,3 +302,334 @@ func toolCall(t *testing.T, sockPath string, req ToolRequest) ToolResponse {
 	json.Unmarshal(resp, &tr)
 	return tr
 }
+
+func TestToolListener_ValidatesArgs(t *testing.T) {
+	sockPath := shortSockPath(t)
+	marker := filepath.Join(t.TempDir(), "ran")
+	tools := []*config.ToolConfig{{
+		Name:   "deploy",
+		Run:    `touch ` + marker + `; echo "$1"`,
+		Params: []config.ToolParam{{Name: "env", Enum: []string{"staging", "prod"}}},
+	}}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	resp := toolCall(t, sockPath, ToolRequest{Tool: "deploy", Args: []string{"prod; rm -rf ~"}})
+	if resp.Error == "" {
+		t.Fatalf("invalid arg accepted: %+v", resp)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("tool ran despite invalid args")
+	}
+	resp = toolCall(t, sockPath, ToolRequest{Tool: "deploy", Args: []string{"prod"}})
+	if resp.Error != "" || resp.Stdout != "prod\n" {
+		t.Errorf("valid call: %+v", resp)
+	}
+}
+
+func TestToolListener_ListIncludesParams(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{{
+		Name:   "deploy",
+		Run:    "echo",
+		Params: []config.ToolParam{{Name: "env", Enum: []string{"prod"}}},
+	}}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	conn, err := net.Dial("unix", sockPath)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	data, _ := json.Marshal(ToolRequest{Action: "list"})
+	conn.Write(data)
+	conn.(*net.UnixConn).CloseWrite()
+	raw, _ := io.ReadAll(conn)
+	var listResp ToolListResponse
+	if err := json.Unmarshal(raw, &listResp); err != nil {
+		t.Fatalf("unmarshal list response: %v", err)
+	}
+	if len(listResp.Tools) != 1 || len(listResp.Tools[0].Params) != 1 || listResp.Tools[0].Params[0].Enum[0] != "prod" {
+		t.Errorf("tools = %+v", listResp.Tools)
+	}
+}
+
+func TestToolListener_Approval(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{
+		{Name: "always", Run: `echo "ran $1"`, Approval: config.ApprovalAlways},
+		{Name: "first", Run: `echo ran`, Approval: config.ApprovalFirst},
+	}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	// The approver runs on the listener's goroutine; the socket round trip
+	// orders it with the test, but the race detector can't see that.
+	var mu sync.Mutex
+	var asked []ToolApproval
+	var records []string
+	answer := true
+	setAnswer := func(v bool) { mu.Lock(); answer = v; mu.Unlock() }
+	numAsked := func() int { mu.Lock(); defer mu.Unlock(); return len(asked) }
+	tl.SetApprover(func(ctx context.Context, req ToolApproval) ToolDecision {
+		mu.Lock()
+		defer mu.Unlock()
+		asked = append(asked, req)
+		return ToolDecision{Approved: answer, By: "owner@example.com"}
+	}, func(record string) {
+		mu.Lock()
+		defer mu.Unlock()
+		records = append(records, record)
+	})
+
+	resp := toolCall(t, sockPath, ToolRequest{Tool: "always", Args: []string{"prod"}})
+	if resp.Error != "" || resp.Stdout != "ran prod\n" {
+		t.Fatalf("approved call: %+v", resp)
+	}
+	setAnswer(false)
+	resp = toolCall(t, sockPath, ToolRequest{Tool: "always", Args: []string{"prod"}})
+	if resp.Error != "tool always: denied by owner@example.com" || resp.Stdout != "" {
+		t.Fatalf("denied call: %+v", resp)
+	}
+	if numAsked() != 2 || asked[0].Tool != "always" || asked[0].Args[0] != "prod" || asked[0].ID == asked[1].ID {
+		t.Fatalf("asked = %+v", asked)
+	}
+
+	// "first" asks once, then runs freely
+	setAnswer(true)
+	toolCall(t, sockPath, ToolRequest{Tool: "first"})
+	resp = toolCall(t, sockPath, ToolRequest{Tool: "first"})
+	if resp.Error != "" || numAsked() != 3 {
+		t.Fatalf("second first call: %+v, asked %d times", resp, numAsked())
+	}
+	// ...until its command changes
+	tl.Reload([]*config.ToolConfig{tools[0], {Name: "first", Run: `echo changed`, Approval: config.ApprovalFirst}})
+	toolCall(t, sockPath, ToolRequest{Tool: "first"})
+	if numAsked() != 4 {
+		t.Fatalf("changed tool not re-approved, asked %d times", numAsked())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(records) != 4 {
+		t.Fatalf("audit records = %q", records)
+	}
+	detail, ok := strings.CutPrefix(records[1], "tool ")
+	if !ok {
+		t.Fatalf("audit record = %q", records[1])
+	}
+	var rec struct {
+		Tool     string   `json:"tool"`
+		Args     []string `json:"args"`
+		Approved bool     `json:"approved"`
+		By       string   `json:"by"`
+	}
+	json.Unmarshal([]byte(detail), &rec)
+	if rec.Tool != "always" || rec.Args[0] != "prod" || rec.Approved || rec.By != "owner@example.com" {
+		t.Errorf("audit record = %s", records[1])
+	}
+}
+
+func TestToolListener_ApprovalWithoutApprover(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tl, err := NewToolListener(sockPath, []*config.ToolConfig{{Name: "gated", Run: "echo ran", Approval: config.ApprovalAlways}})
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	resp := toolCall(t, sockPath, ToolRequest{Tool: "gated"})
+	if resp.Stdout != "" || !strings.Contains(resp.Error, "not approved") {
+		t.Fatalf("gated call without approver: %+v", resp)
+	}
+}
+
+func TestToolListener_CloseDeniesPendingApproval(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tl, err := NewToolListener(sockPath, []*config.ToolConfig{{Name: "gated", Run: "echo ran", Approval: config.ApprovalAlways}})
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	waiting := make(chan struct{})
+	tl.SetApprover(func(ctx context.Context, req ToolApproval) ToolDecision {
+		close(waiting)
+		<-ctx.Done()
+		return ToolDecision{Reason: "session ended"}
+	}, nil)
+
+	done := make(chan ToolResponse, 1)
+	go func() { done <- toolCall(t, sockPath, ToolRequest{Tool: "gated"}) }()
+	<-waiting
+	tl.Close()
+	select {
+	case resp := <-done:
+		if resp.Stdout != "" || !strings.Contains(resp.Error, "session ended") {
+			t.Errorf("resp = %+v", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending approval survived Close")
+	}
+}
+
+func TestToolListener_RateLimits(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{
+		{Name: "minute", Run: "echo ok", MaxCallsPerMinute: 2},
+		{Name: "session", Run: "echo ok", MaxCallsPerSession: 1},
+	}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	for i := 0; i < 2; i++ {
+		if resp := toolCall(t, sockPath, ToolRequest{Tool: "minute"}); resp.Error != "" {
+			t.Fatalf("call %d: %+v", i, resp)
+		}
+	}
+	if resp := toolCall(t, sockPath, ToolRequest{Tool: "minute"}); !strings.Contains(resp.Error, "2 calls per minute") {
+		t.Fatalf("third call in a minute: %+v", resp)
+	}
+	// The window slides: age the recorded calls past a minute
+	tl.mu.Lock()
+	for i := range tl.recent["minute"] {
+		tl.recent["minute"][i] = tl.recent["minute"][i].Add(-time.Minute)
+	}
+	tl.mu.Unlock()
+	if resp := toolCall(t, sockPath, ToolRequest{Tool: "minute"}); resp.Error != "" {
+		t.Fatalf("call after window: %+v", resp)
+	}
+
+	toolCall(t, sockPath, ToolRequest{Tool: "session"})
+	if resp := toolCall(t, sockPath, ToolRequest{Tool: "session"}); !strings.Contains(resp.Error, "1 calls per session") {
+		t.Fatalf("second call in session: %+v", resp)
+	}
+}
+
+func TestToolListener_Recorder(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{{
+		Name:   "greet",
+		Run:    `echo "hi $1"; echo warn >&2; exit 3`,
+		Params: []config.ToolParam{{Name: "who", Enum: []string{"bob"}}},
+	}}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+	var mu sync.Mutex
+	var recs []ToolCallRecord
+	tl.SetRecorder(func(r ToolCallRecord) {
+		mu.Lock()
+		recs = append(recs, r)
+		mu.Unlock()
+	})
+
+	toolCall(t, sockPath, ToolRequest{Tool: "greet", Args: []string{"bob"}})
+	toolCall(t, sockPath, ToolRequest{Tool: "greet", Args: []string{"eve"}})
+	toolCall(t, sockPath, ToolRequest{Tool: "nope"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(recs) != 2 {
+		t.Fatalf("records = %+v", recs)
+	}
+	ran, rejected := recs[0], recs[1]
+	if ran.ExitCode != 3 || ran.Error != "" || ran.Args[0] != "bob" || ran.OutputBytes != int64(len("hi bob\nwarn\n")) || len(ran.OutputHash) != 32 || ran.Duration <= 0 {
+		t.Errorf("ran = %+v", ran)
+	}
+	if rejected.Error == "" || rejected.Duration != 0 || rejected.OutputHash != "" {
+		t.Errorf("rejected = %+v", rejected)
+	}
+}
+
+// sandboxTool loads a tool with the given sandbox section the way
+// LoadToolsDir would.
+func sandboxTool(t *testing.T, section string) *config.ToolConfig {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kube.yaml")
+	os.WriteFile(path, []byte("name: kube\nrun: kubectl get pods\nsandbox:\n"+section), 0600)
+	tools, err := config.LoadToolsDir(dir)
+	if err != nil {
+		t.Fatalf("LoadToolsDir: %v", err)
+	}
+	return tools[0]
+}
+
+func TestToolPolicy(t *testing.T) {
+	if p, err := ToolPolicy(&config.ToolConfig{Name: "plain", Run: "true"}); p != nil || err != nil {
+		t.Fatalf("unsandboxed tool: policy = %v, err = %v", p, err)
+	}
+
+	// No base: defaults plus the tool's grants, so ~/.kube is readable
+	// but other credentials stay denied
+	tc := sandboxTool(t, "  fs: [\"ro:~/.kube\"]\n  network: [\"*.example.com\"]\n  env: [KUBECONFIG]\n")
+	p, err := ToolPolicy(tc)
+	if err != nil {
+		t.Fatalf("ToolPolicy: %v", err)
+	}
+	fs := strings.Join(p.FS, " ")
+	if !strings.Contains(fs, "ro:~/.kube") || strings.Contains(fs, "deny:~/.kube") || !strings.Contains(fs, "deny:~/.ssh") {
+		t.Errorf("fs = %v", p.FS)
+	}
+	if len(p.Network) != 1 || p.Network[0] != "*.example.com" {
+		t.Errorf("network = %v", p.Network)
+	}
+
+	// base: none keeps exactly what the tool declares
+	p, err = ToolPolicy(sandboxTool(t, "  base: none\n  fs: [\"ro:/usr\"]\n"))
+	if err != nil {
+		t.Fatalf("ToolPolicy: %v", err)
+	}
+	if len(p.FS) != 1 || p.FS[0] != "ro:/usr" || len(p.Env) != 0 {
+		t.Errorf("base none: fs = %v, env = %v", p.FS, p.Env)
+	}
+
+	if _, err := ToolPolicy(sandboxTool(t, "  base: ./missing.yaml\n")); err == nil {
+		t.Error("expected error for missing base")
+	}
+}
+
+func TestToolEnv(t *testing.T) {
+	t.Setenv("WT_TEST_ALLOWED", "yes")
+	t.Setenv("WT_TEST_SECRET", "no")
+	tc := sandboxTool(t, "  base: none\n  env: [WT_TEST_ALLOWED]\n")
+	tc.Env = map[string]string{"TOOL_VAR": "1"}
+	p, err := ToolPolicy(tc)
+	if err != nil {
+		t.Fatalf("ToolPolicy: %v", err)
+	}
+	env := strings.Join(toolEnv(tc, p), "\n")
+	if !strings.Contains(env, "WT_TEST_ALLOWED=yes") || !strings.Contains(env, "TOOL_VAR=1") || strings.Contains(env, "WT_TEST_SECRET") {
+		t.Errorf("env = %q", env)
+	}
+}
+
+func TestToolListener_SandboxFailsClosed(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tc := sandboxTool(t, "  base: ./missing.yaml\n")
+	tc.Run = "echo ran"
+	tl, err := NewToolListener(sockPath, []*config.ToolConfig{tc})
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	resp := toolCall(t, sockPath, ToolRequest{Tool: "kube"})
+	if resp.ExitCode == 0 || strings.Contains(resp.Stdout, "ran") || !strings.Contains(resp.Error+resp.Stderr, "sandbox") {
+		t.Errorf("resp = %+v, want refusal without running", resp)
+	}
+}
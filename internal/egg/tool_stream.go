@@ -0,0 +1,171 @@
+package egg
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"sync"
+)
+
+// Output streams of a running tool.
+const (
+	streamStdout = 1
+	streamStderr = 2
+)
+
+// ToolStreamFrame is one line of a streaming tool reply. Output frames carry
+// stdout or stderr bytes as they arrive; the last frame has Done set and
+// the result.
+type ToolStreamFrame struct {
+	Stdout    []byte `json:"stdout,omitempty"`
+	Stderr    []byte `json:"stderr,omitempty"`
+	Done      bool   `json:"done,omitempty"`
+	ExitCode  int    `json:"exit_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// toolOutput passes a tool's stdout and stderr on until their combined size
+// reaches limit, then drops the rest (the tool keeps running) after a
+// truncation marker on stderr. Everything written is counted and hashed.
+type toolOutput struct {
+	mu        sync.Mutex
+	emit      func(stream int, p []byte)
+	limit     int64
+	total     int64
+	truncated bool
+	hash      hash.Hash
+}
+
+func newToolOutput(limit int64, emit func(stream int, p []byte)) *toolOutput {
+	return &toolOutput{emit: emit, limit: limit, hash: sha256.New()}
+}
+
+// Writer returns the writer for one stream.
+func (o *toolOutput) Writer(stream int) io.Writer {
+	return toolOutputWriter{o, stream}
+}
+
+type toolOutputWriter struct {
+	o      *toolOutput
+	stream int
+}
+
+func (w toolOutputWriter) Write(p []byte) (int, error) {
+	o := w.o
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.hash.Write(p)
+	room := o.limit - o.total
+	o.total += int64(len(p))
+	if room <= 0 {
+		return len(p), nil
+	}
+	if int64(len(p)) <= room {
+		o.emit(w.stream, p)
+		return len(p), nil
+	}
+	o.emit(w.stream, p[:room])
+	o.truncated = true
+	o.emit(streamStderr, []byte(fmt.Sprintf("\n[wt: output truncated at %d bytes]\n", o.limit)))
+	return len(p), nil
+}
+
+// Fail reports a wing-side failure (timeout, exec error) on stderr. It is
+// not counted against the limit or hashed: it is not tool output.
+func (o *toolOutput) Fail(msg string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.emit(streamStderr, []byte(msg))
+}
+
+// Truncated reports whether output was dropped.
+func (o *toolOutput) Truncated() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.truncated
+}
+
+// Sum returns the number of bytes the tool wrote and the hex SHA-256 of
+// them in arrival order, truncated to 128 bits.
+func (o *toolOutput) Sum() (int64, string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.total, hex.EncodeToString(o.hash.Sum(nil)[:16])
+}
+
+// frameWriter writes ToolStreamFrames to a connection.
+type frameWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (f *frameWriter) write(frame ToolStreamFrame) {
+	data, _ := json.Marshal(frame)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conn.Write(append(data, '\n'))
+}
+
+func (f *frameWriter) output(stream int, p []byte) {
+	// p is reused by the caller once we return; Marshal copies it
+	if stream == streamStdout {
+		f.write(ToolStreamFrame{Stdout: p})
+	} else {
+		f.write(ToolStreamFrame{Stderr: p})
+	}
+}
+
+func (f *frameWriter) final(resp ToolResponse) {
+	f.write(ToolStreamFrame{Done: true, ExitCode: resp.ExitCode, Error: resp.Error, Truncated: resp.Truncated})
+}
+
+// StreamTool runs a tool through the tool socket at sockPath, copying stdin
+// (nil for none) to it and its output to stdout and stderr as it arrives.
+// Returns the final frame.
+func StreamTool(sockPath, tool string, args []string, stdin io.Reader, stdout, stderr io.Writer) (ToolStreamFrame, error) {
+	conn, err := net.Dial("unix", sockPath)
+	if err != nil {
+		return ToolStreamFrame{}, fmt.Errorf("connect to tool socket: %w", err)
+	}
+	defer conn.Close()
+	uc := conn.(*net.UnixConn)
+	data, _ := json.Marshal(ToolRequest{Tool: tool, Args: args, Stream: true})
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return ToolStreamFrame{}, fmt.Errorf("write tool request: %w", err)
+	}
+	if stdin == nil {
+		uc.CloseWrite()
+	} else {
+		go func() {
+			io.Copy(conn, stdin)
+			uc.CloseWrite()
+		}()
+	}
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var frame ToolStreamFrame
+		if err := json.Unmarshal(sc.Bytes(), &frame); err != nil {
+			return ToolStreamFrame{}, fmt.Errorf("parse tool response: %w", err)
+		}
+		if frame.Done {
+			return frame, nil
+		}
+		if len(frame.Stdout) > 0 {
+			stdout.Write(frame.Stdout)
+		}
+		if len(frame.Stderr) > 0 {
+			stderr.Write(frame.Stderr)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return ToolStreamFrame{}, fmt.Errorf("read tool response: %w", err)
+	}
+	return ToolStreamFrame{}, fmt.Errorf("read tool response: connection closed before the tool finished")
+}
@@ -0,0 +1,106 @@
+package egg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/config"
+)
+
+// firstWrite records when the first byte arrived.
+type firstWrite struct {
+	bytes.Buffer
+	at time.Time
+}
+
+func (w *firstWrite) Write(p []byte) (int, error) {
+	if w.at.IsZero() {
+		w.at = time.Now()
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestStreamTool(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{{Name: "build", Run: `echo "start $1"; cat; sleep 1; echo done >&2; exit 4`}}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	var stdout firstWrite
+	var stderr bytes.Buffer
+	begin := time.Now()
+	final, err := StreamTool(sockPath, "build", []string{"x"}, strings.NewReader("from stdin\n"), &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("StreamTool: %v", err)
+	}
+	if final.ExitCode != 4 || final.Error != "" || final.Truncated {
+		t.Errorf("final = %+v", final)
+	}
+	if stdout.String() != "start x\nfrom stdin\n" || stderr.String() != "done\n" {
+		t.Errorf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+	// Output arrived while the tool was still running
+	if stdout.at.Sub(begin) > 900*time.Millisecond {
+		t.Errorf("first output after %v, want it before the tool finished", stdout.at.Sub(begin))
+	}
+}
+
+func TestStreamToolErrors(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{{Name: "slow", Run: "sleep 60", Timeout: "200ms"}}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+
+	final, err := StreamTool(sockPath, "nope", nil, nil, io.Discard, io.Discard)
+	if err != nil || !strings.Contains(final.Error, "unknown tool") {
+		t.Errorf("unknown tool: %+v, %v", final, err)
+	}
+	var stderr bytes.Buffer
+	final, err = StreamTool(sockPath, "slow", nil, nil, io.Discard, &stderr)
+	if err != nil || final.ExitCode != 124 || !strings.Contains(stderr.String(), "timed out") {
+		t.Errorf("timeout: %+v, %v, stderr %q", final, err, stderr.String())
+	}
+}
+
+func TestToolOutputLimit(t *testing.T) {
+	sockPath := shortSockPath(t)
+	tools := []*config.ToolConfig{{Name: "noisy", Run: `head -c 100 /dev/zero | tr '\0' a`, MaxOutputBytes: 10}}
+	tl, err := NewToolListener(sockPath, tools)
+	if err != nil {
+		t.Fatalf("NewToolListener: %v", err)
+	}
+	defer tl.Close()
+	var mu sync.Mutex
+	var recs []ToolCallRecord
+	tl.SetRecorder(func(r ToolCallRecord) { mu.Lock(); recs = append(recs, r); mu.Unlock() })
+
+	var stdout, stderr bytes.Buffer
+	final, err := StreamTool(sockPath, "noisy", nil, nil, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("StreamTool: %v", err)
+	}
+	if !final.Truncated || stdout.String() != strings.Repeat("a", 10) || !strings.Contains(stderr.String(), "output truncated at 10 bytes") {
+		t.Errorf("stream: final=%+v stdout=%q stderr=%q", final, stdout.String(), stderr.String())
+	}
+
+	resp := toolCall(t, sockPath, ToolRequest{Tool: "noisy"})
+	if !resp.Truncated || resp.Stdout != strings.Repeat("a", 10) {
+		t.Errorf("buffered: %+v", resp)
+	}
+	// The ledger still sees everything the tool wrote
+	mu.Lock()
+	defer mu.Unlock()
+	if len(recs) != 2 || recs[0].OutputBytes != 100 || recs[0].OutputHash != recs[1].OutputHash {
+		t.Errorf("records = %+v", recs)
+	}
+}
@@ -2,6 +2,7 @@ package egg
 
 import (
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 
@@ -18,6 +19,7 @@ type VTerm struct {
 	scrollback []string // ring buffer of rendered lines scrolled off the top
 	sbHead     int      // next write position in ring
 	sbLen      int      // current count (≤ len(scrollback))
+	plain      bool     // store scrollback as plain text instead of ANSI
 
 	mu           sync.Mutex
 	altScreen    bool
@@ -27,20 +29,31 @@ type VTerm struct {
 
 // NewVTerm creates a VTerm with the given dimensions.
 func NewVTerm(cols, rows int) *VTerm {
+	return newVTerm(cols, rows, maxScrollbackLines)
+}
+
+// newVTerm creates a VTerm with a custom scrollback capacity. A capacity of 0
+// disables scrollback capture (screen-only consumers like attention detection).
+func newVTerm(cols, rows, scrollback int) *VTerm {
 	v := &VTerm{
 		emu:        vt.NewEmulator(cols, rows),
-		scrollback: make([]string, maxScrollbackLines),
+		scrollback: make([]string, scrollback),
 		cols:       cols,
 		rows:       rows,
 	}
 	v.emu.SetCallbacks(vt.Callbacks{
 		ScrollOut: func(lines []uv.Line) {
 			// mu already held by caller (Write)
-			if v.altScreen {
+			if v.altScreen || len(v.scrollback) == 0 {
 				return
 			}
 			for _, line := range lines {
-				rendered := line.Render()
+				var rendered string
+				if v.plain {
+					rendered = plainLine(line)
+				} else {
+					rendered = line.Render()
+				}
 				// Evict old entry if ring is full (release string for GC)
 				if v.sbLen == len(v.scrollback) {
 					v.scrollback[v.sbHead] = ""
@@ -72,6 +85,14 @@ func NewVTerm(cols, rows int) *VTerm {
 	return v
 }
 
+// newPlainVTerm creates a VTerm whose scrollback is captured as plain text
+// (no styles), for transcript export.
+func newPlainVTerm(cols, rows, scrollback int) *VTerm {
+	v := newVTerm(cols, rows, scrollback)
+	v.plain = true
+	return v
+}
+
 // Write feeds PTY output to the emulator.
 func (v *VTerm) Write(p []byte) (int, error) {
 	v.mu.Lock()
@@ -129,6 +150,30 @@ func (v *VTerm) Snapshot() []byte {
 	return []byte(buf.String())
 }
 
+// ScreenLines returns the visible grid as plain text (no styles), one entry per
+// row, along with the cursor row. Trailing spaces are trimmed.
+func (v *VTerm) ScreenLines() ([]string, int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	lines := make([]string, v.rows)
+	for y := range v.rows {
+		var b strings.Builder
+		for x := 0; x < v.cols; x++ {
+			c := v.emu.CellAt(x, y)
+			if c == nil || c.Content == "" {
+				b.WriteByte(' ')
+				continue
+			}
+			b.WriteString(c.Content)
+			if c.Width > 1 {
+				x += c.Width - 1
+			}
+		}
+		lines[y] = strings.TrimRight(b.String(), " ")
+	}
+	return lines, v.emu.CursorPosition().Y
+}
+
 // ScrollbackLen returns the number of scrollback lines currently stored.
 func (v *VTerm) ScrollbackLen() int {
 	v.mu.Lock()
@@ -143,6 +188,13 @@ func (v *VTerm) Close() error {
 	return v.emu.Close()
 }
 
+// discardReplies drains terminal query replies (DA, DSR, CPR) the emulator
+// writes to its input pipe; without a reader those writes block Write.
+// Returns when the VTerm is closed.
+func (v *VTerm) discardReplies() {
+	io.Copy(io.Discard, v.emu)
+}
+
 // scrollbackLines returns all scrollback lines oldest-first.
 // Must be called with mu held.
 func (v *VTerm) scrollbackLines() []string {
@@ -157,6 +209,22 @@ func (v *VTerm) scrollbackLines() []string {
 	return lines
 }
 
+// plainLine renders a scrolled-off line as text without styles.
+func plainLine(line uv.Line) string {
+	var b strings.Builder
+	for _, c := range line {
+		if c.Content == "" {
+			if c.Width == 0 {
+				continue // continuation of a wide cell
+			}
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteString(c.Content)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
 // vtermMsg is sent to the VTerm goroutine for async processing.
 type vtermMsg struct {
 	data   []byte
@@ -35,18 +35,49 @@ func New(topic, token, events string) *Client {
 	return &Client{url: url, token: token, events: evMap}
 }
 
-// SendAttention sends a "needs input" notification synchronously.
+// SendAttention sends a "needs input" notification synchronously. Kind is the
+// wing-detected reason ("permission", "question", "done", "error", "tool"); empty
+// means unknown and reads like "question".
 // Caller is responsible for running in a goroutine if fire-and-forget is desired.
-func (c *Client) SendAttention(sessionID, agent, cwd, clickURL string) {
+func (c *Client) SendAttention(sessionID, agent, cwd, kind, clickURL string) {
 	if !c.events["attention"] {
 		return
 	}
 	if agent == "" {
 		agent = "Agent"
 	}
-	title := fmt.Sprintf("%s needs input", agent)
+	var title, priority, tags string
+	switch kind {
+	case "permission":
+		title = fmt.Sprintf("%s needs permission", agent)
+		priority = "high"
+		tags = "lock"
+	case "tool":
+		title = fmt.Sprintf("%s wants to run a tool", agent)
+		priority = "high"
+		tags = "hammer_and_wrench"
+	case "done":
+		title = fmt.Sprintf("%s is done", agent)
+		priority = "default"
+		tags = "white_check_mark"
+	case "error":
+		title = fmt.Sprintf("%s hit an error", agent)
+		priority = "high"
+		tags = "warning"
+	default:
+		title = fmt.Sprintf("%s needs input", agent)
+		priority = "high"
+		tags = "bell"
+	}
 	body := fmt.Sprintf("session in %s", cwd)
-	c.post(title, body, "high", "bell", clickURL)
+	// Permission prompts and tool calls get approve/deny buttons. They only deep-link into the
+	// app, where the decrypted prompt is shown and the answer confirmed — the
+	// relay never learns what is being approved.
+	var actions string
+	if (kind == "permission" || kind == "tool") && clickURL != "" {
+		actions = fmt.Sprintf("view, Approve, %s/approve, clear=true; view, Deny, %s/deny, clear=true", clickURL, clickURL)
+	}
+	c.post(title, body, priority, tags, clickURL, actions)
 }
 
 // SendExit sends a session exit notification synchronously.
@@ -69,15 +100,15 @@ func (c *Client) SendExit(sessionID, agent, cwd string, exitCode int, clickURL s
 		tags = "x"
 	}
 	body := fmt.Sprintf("session in %s", cwd)
-	c.post(title, body, priority, tags, clickURL)
+	c.post(title, body, priority, tags, clickURL, "")
 }
 
 // SendTest sends a test notification synchronously and returns any error.
 func (c *Client) SendTest() error {
-	return c.post("wingthing test", "Push notifications are working!", "default", "test_tube", "")
+	return c.post("wingthing test", "Push notifications are working!", "default", "test_tube", "", "")
 }
 
-func (c *Client) post(title, body, priority, tags, clickURL string) error {
+func (c *Client) post(title, body, priority, tags, clickURL, actions string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBufferString(body))
@@ -91,6 +122,9 @@ func (c *Client) post(title, body, priority, tags, clickURL string) error {
 	if clickURL != "" {
 		req.Header.Set("Click", clickURL)
 	}
+	if actions != "" {
+		req.Header.Set("Actions", actions)
+	}
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
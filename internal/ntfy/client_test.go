@@ -55,7 +55,7 @@ func TestSendAttentionFiltered(t *testing.T) {
 	}))
 	defer srv.Close()
 	c := New(srv.URL, "", "exit") // attention NOT enabled
-	c.SendAttention("s1", "claude", "/home", "")
+	c.SendAttention("s1", "claude", "/home", "", "")
 }
 
 func TestSendExitFiltered(t *testing.T) {
@@ -86,7 +86,7 @@ func TestSendAttentionPost(t *testing.T) {
 	defer srv.Close()
 
 	c := New(srv.URL, "mytoken", "attention")
-	c.SendAttention("s1", "claude", "/proj", "https://app.wingthing.ai/#s/s1")
+	c.SendAttention("s1", "claude", "/proj", "", "https://app.wingthing.ai/#s/s1")
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -110,6 +110,61 @@ func TestSendAttentionPost(t *testing.T) {
 	}
 }
 
+func TestSendAttentionKinds(t *testing.T) {
+	tests := []struct {
+		kind, title, tags string
+	}{
+		{"permission", "claude needs permission", "lock"},
+		{"question", "claude needs input", "bell"},
+		{"done", "claude is done", "white_check_mark"},
+		{"error", "claude hit an error", "warning"},
+		{"tool", "claude wants to run a tool", "hammer_and_wrench"},
+	}
+	for _, tt := range tests {
+		var gotTitle, gotTags string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotTitle = r.Header.Get("Title")
+			gotTags = r.Header.Get("Tags")
+			w.WriteHeader(200)
+		}))
+		c := New(srv.URL, "", "attention")
+		c.SendAttention("s1", "claude", "/proj", tt.kind, "")
+		srv.Close()
+		if gotTitle != tt.title {
+			t.Errorf("%s: title = %q, want %q", tt.kind, gotTitle, tt.title)
+		}
+		if gotTags != tt.tags {
+			t.Errorf("%s: tags = %q, want %q", tt.kind, gotTags, tt.tags)
+		}
+	}
+}
+
+func TestSendAttentionPermissionActions(t *testing.T) {
+	var gotActions string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotActions = r.Header.Get("Actions")
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "", "attention")
+	c.SendAttention("s1", "claude", "/proj", "permission", "https://app.wingthing.ai/#s/s1")
+	want := "view, Approve, https://app.wingthing.ai/#s/s1/approve, clear=true; view, Deny, https://app.wingthing.ai/#s/s1/deny, clear=true"
+	if gotActions != want {
+		t.Fatalf("actions = %q, want %q", gotActions, want)
+	}
+
+	c.SendAttention("s1", "claude", "/proj", "tool", "https://app.wingthing.ai/#s/s1")
+	if gotActions != want {
+		t.Fatalf("tool actions = %q, want %q", gotActions, want)
+	}
+
+	c.SendAttention("s1", "claude", "/proj", "question", "https://app.wingthing.ai/#s/s1")
+	if gotActions != "" {
+		t.Fatalf("question actions = %q, want none", gotActions)
+	}
+}
+
 func TestSendExitSuccess(t *testing.T) {
 	var gotTitle, gotTags, gotPriority string
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1,6 +1,11 @@
 package relay
 
-import "fmt"
+import (
+	"fmt"
+	"log"
+
+	"github.com/coder/websocket"
+)
 
 // wingRegistrySummary returns a compact debug string of all connected wings.
 func (s *Server) wingRegistrySummary() string {
@@ -48,6 +53,43 @@ func (s *Server) canAccessWing(userID string, wing *ConnectedWing, userOrgIDs ..
 	return false
 }
 
+// revokeWingAccess closes every browser connection of the user's that has
+// reached a wing they can no longer access, e.g. after being removed from the
+// wing's org: terminals they control, sessions they spectate, tunnels. The
+// sessions keep running on the wing; reconnecting goes through canAccessWing
+// again.
+func (s *Server) revokeWingAccess(userID string, userOrgIDs []string) {
+	type reached struct {
+		conn  *websocket.Conn
+		wings []*ConnectedWing
+	}
+	var conns []reached
+	s.browserMu.Lock()
+	for conn, bc := range s.browserConns {
+		if bc.userID != userID || len(bc.wings) == 0 {
+			continue
+		}
+		r := reached{conn: conn}
+		for _, wing := range bc.wings {
+			r.wings = append(r.wings, wing)
+		}
+		conns = append(conns, r)
+	}
+	s.browserMu.Unlock()
+
+	for _, r := range conns {
+		for _, wing := range r.wings {
+			if s.canAccessWing(userID, wing, userOrgIDs) {
+				continue
+			}
+			log.Printf("access to wing %s revoked for user %s, closing browser connection", wing.WingID, userID)
+			s.PTY.ClearBrowser(r.conn)
+			go r.conn.Close(websocket.StatusPolicyViolation, "wing access revoked")
+			break
+		}
+	}
+}
+
 // listAccessibleWings returns all wings the user can access.
 func (s *Server) listAccessibleWings(userID string) []*ConnectedWing {
 	all := s.Wings.All()
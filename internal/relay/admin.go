@@ -0,0 +1,369 @@
+package relay
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Relay administration: users, orgs, wings, bandwidth and the audit log.
+// Admins are users with is_admin set — the local user in local mode, the
+// roost's service user (so the CLI on the roost box works), and anyone listed
+// in WT_ADMIN_EMAILS. Personal access tokens need the admin scope too.
+
+// adminAuth authenticates an /api/v1/admin request. Writes the error
+// response and returns nil unless the caller is a relay admin.
+func (s *Server) adminAuth(w http.ResponseWriter, r *http.Request) *User {
+	if s.Store == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return nil
+	}
+	c := s.apiAuth(w, r, "admin")
+	if c == nil {
+		return nil
+	}
+	if !c.User.IsAdmin {
+		writeError(w, http.StatusForbidden, "relay admins only")
+		return nil
+	}
+	return c.User
+}
+
+// promoteConfiguredAdmin grants the admin role to a user listed in
+// WT_ADMIN_EMAILS.
+func (s *Server) promoteConfiguredAdmin(u *User) {
+	if u.IsAdmin || u.Email == nil {
+		return
+	}
+	for _, e := range s.Config.AdminEmails {
+		if strings.EqualFold(strings.TrimSpace(e), *u.Email) {
+			s.Store.SetUserAdmin(u.ID, true)
+			u.IsAdmin = true
+			log.Printf("admin: %s (%s) granted admin from WT_ADMIN_EMAILS", u.ID, *u.Email)
+			return
+		}
+	}
+}
+
+// pagination reads ?limit= and ?offset=, defaulting to 100 and capping at 1000.
+func pagination(r *http.Request) (limit, offset int) {
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// onlineWingCounts returns connected wings by owner, cluster-wide on the
+// login node.
+func (s *Server) onlineWingCounts() map[string]int {
+	counts := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, w := range s.Wings.All() {
+		if !seen[w.WingID] {
+			seen[w.WingID] = true
+			counts[w.UserID]++
+		}
+	}
+	if s.WingMap != nil {
+		for wingID, loc := range s.WingMap.All() {
+			if !seen[wingID] {
+				seen[wingID] = true
+				counts[loc.UserID]++
+			}
+		}
+	}
+	return counts
+}
+
+func (s *Server) adminUserEntry(u *User, wings int) map[string]any {
+	tier := "free"
+	if s.Store.IsUserPro(u.ID) {
+		tier = "pro"
+	}
+	return map[string]any{
+		"id":           u.ID,
+		"display_name": u.DisplayName,
+		"email":        u.Email,
+		"provider":     u.Provider,
+		"tier":         tier,
+		"is_admin":     u.IsAdmin,
+		"suspended":    u.SuspendedAt != nil,
+		"suspended_at": u.SuspendedAt,
+		"created_at":   u.CreatedAt,
+		"wings_online": wings,
+	}
+}
+
+// handleAdminUsers lists users. GET /api/v1/admin/users?q=&limit=&offset=
+func (s *Server) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if s.adminAuth(w, r) == nil {
+		return
+	}
+	limit, offset := pagination(r)
+	users, err := s.Store.ListUsers(r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wings := s.onlineWingCounts()
+	out := make([]map[string]any, 0, len(users))
+	for _, u := range users {
+		out = append(out, s.adminUserEntry(u, wings[u.ID]))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAdminUpdateUser suspends or reinstates a user, changes their tier or
+// grants/revokes admin. PATCH /api/v1/admin/users/{userID}
+func (s *Server) handleAdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	admin := s.adminAuth(w, r)
+	if admin == nil {
+		return
+	}
+	var req struct {
+		Suspended *bool   `json:"suspended"`
+		Tier      *string `json:"tier"`
+		Admin     *bool   `json:"admin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	user, err := s.Store.GetUserByID(r.PathValue("userID"))
+	if err != nil || user == nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if user.ID == admin.ID && ((req.Suspended != nil && *req.Suspended) || (req.Admin != nil && !*req.Admin)) {
+		writeError(w, http.StatusBadRequest, "admins can't suspend or demote themselves")
+		return
+	}
+	if req.Tier != nil && *req.Tier != "free" && *req.Tier != "pro" {
+		writeError(w, http.StatusBadRequest, "tier must be free or pro")
+		return
+	}
+
+	by := "by=" + admin.ID
+	if req.Suspended != nil {
+		if err := s.Store.SetUserSuspended(user.ID, *req.Suspended); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if *req.Suspended {
+			kicked := s.kickWings("", user.ID)
+			s.Store.AppendAudit(user.ID, "admin_suspend", strPtr(by))
+			log.Printf("admin: %s suspended %s (%d wings disconnected)", admin.ID, user.ID, kicked)
+		} else {
+			s.Store.AppendAudit(user.ID, "admin_unsuspend", strPtr(by))
+			log.Printf("admin: %s reinstated %s", admin.ID, user.ID)
+		}
+	}
+	if req.Tier != nil {
+		var err error
+		if *req.Tier == "pro" {
+			err = s.grantPersonalPro(user.ID, "admin")
+		} else if _, err = s.cancelPersonalPro(user.ID); err == errNoPersonalSubscription {
+			err = nil // nothing personal to cancel; an org seat may still grant pro
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Store.AppendAudit(user.ID, "admin_tier", strPtr(by+" tier="+*req.Tier))
+	}
+	if req.Admin != nil {
+		if err := s.Store.SetUserAdmin(user.ID, *req.Admin); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Store.AppendAudit(user.ID, "admin_role", strPtr(by+" admin="+strconv.FormatBool(*req.Admin)))
+	}
+
+	user, _ = s.Store.GetUserByID(user.ID)
+	writeJSON(w, http.StatusOK, s.adminUserEntry(user, s.onlineWingCounts()[user.ID]))
+}
+
+// handleAdminOrgs lists every org. GET /api/v1/admin/orgs
+func (s *Server) handleAdminOrgs(w http.ResponseWriter, r *http.Request) {
+	if s.adminAuth(w, r) == nil {
+		return
+	}
+	orgs, err := s.Store.ListAllOrgs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]map[string]any, 0, len(orgs))
+	for _, o := range orgs {
+		entry := s.orgEntry(o, "")
+		delete(entry, "is_owner")
+		entry["owner_user_id"] = o.OwnerUserID
+		entry["created_at"] = o.CreatedAt
+		if owner, _ := s.Store.GetUserByID(o.OwnerUserID); owner != nil {
+			entry["owner_email"] = owner.Email
+		}
+		out = append(out, entry)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAdminWings lists every connected wing. GET /api/v1/admin/wings
+func (s *Server) handleAdminWings(w http.ResponseWriter, r *http.Request) {
+	if s.adminAuth(w, r) == nil {
+		return
+	}
+	out := []map[string]any{}
+	seen := make(map[string]bool)
+	for _, wing := range s.Wings.All() {
+		if seen[wing.WingID] {
+			continue
+		}
+		seen[wing.WingID] = true
+		out = append(out, map[string]any{
+			"wing_id":    wing.WingID,
+			"user_id":    wing.UserID,
+			"org_id":     wing.OrgID,
+			"machine_id": s.Config.FlyMachineID,
+			"locked":     wing.Locked,
+			"last_seen":  wing.LastSeen,
+		})
+	}
+	if s.WingMap != nil {
+		for wingID, loc := range s.WingMap.All() {
+			if seen[wingID] {
+				continue
+			}
+			seen[wingID] = true
+			out = append(out, map[string]any{
+				"wing_id":    wingID,
+				"user_id":    loc.UserID,
+				"org_id":     loc.OrgID,
+				"machine_id": loc.MachineID,
+				"locked":     loc.Locked,
+				"last_seen":  loc.RegisteredAt,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["wing_id"].(string) < out[j]["wing_id"].(string) })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAdminKickWing force-disconnects a wing. It reconnects on its own
+// unless its owner is suspended. DELETE /api/v1/admin/wings/{wingID}
+func (s *Server) handleAdminKickWing(w http.ResponseWriter, r *http.Request) {
+	admin := s.adminAuth(w, r)
+	if admin == nil {
+		return
+	}
+	wingID := r.PathValue("wingID")
+	var ownerID string
+	for _, wing := range s.Wings.All() {
+		if wing.WingID == wingID {
+			ownerID = wing.UserID
+		}
+	}
+	if ownerID == "" && s.WingMap != nil {
+		if loc, ok := s.WingMap.Locate(wingID); ok {
+			ownerID = loc.UserID
+		}
+	}
+	if ownerID == "" {
+		writeError(w, http.StatusNotFound, "wing not connected")
+		return
+	}
+	s.kickWings(wingID, "")
+	s.Store.AppendAudit(ownerID, "admin_kick", strPtr("by="+admin.ID+" wing="+wingID))
+	log.Printf("admin: %s disconnected wing %s", admin.ID, wingID)
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
+
+// kickWings closes the connections of one wing, or of every wing a user
+// owns, here and on every edge. Returns how many were connected here.
+func (s *Server) kickWings(wingID, userID string) int {
+	n := 0
+	for _, wing := range s.Wings.All() {
+		if (wingID != "" && wing.WingID == wingID) || (userID != "" && wing.UserID == userID) {
+			wing.Conn.Close(websocket.StatusPolicyViolation, "disconnected by relay admin")
+			n++
+		}
+	}
+	if !s.IsEdge() {
+		payload, _ := json.Marshal(map[string]string{"type": "wing.kick", "wing_id": wingID, "user_id": userID})
+		s.broadcastToEdges(payload)
+	}
+	return n
+}
+
+// handleAdminUsage lists bandwidth by user for a month, heaviest first.
+// GET /api/v1/admin/usage?month=2006-01
+func (s *Server) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	if s.adminAuth(w, r) == nil {
+		return
+	}
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		month = currentMonth()
+	}
+	if _, err := time.Parse("2006-01", month); err != nil {
+		writeError(w, http.StatusBadRequest, "month must look like 2006-01")
+		return
+	}
+	totals, err := s.Store.ListBandwidthUsage(month)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// This month's live counters run ahead of the last DB sync
+	if month == currentMonth() && s.Bandwidth != nil {
+		for userID, n := range s.Bandwidth.UserTotals() {
+			if n > totals[userID] {
+				totals[userID] = n
+			}
+		}
+	}
+	out := make([]map[string]any, 0, len(totals))
+	for userID, n := range totals {
+		entry := map[string]any{"user_id": userID, "month": month, "usage_bytes": n}
+		if u, _ := s.Store.GetUserByID(userID); u != nil {
+			entry["email"] = u.Email
+			entry["display_name"] = u.DisplayName
+		}
+		if s.Store.IsUserPro(userID) {
+			entry["tier"] = "pro"
+			entry["cap_bytes"] = nil
+		} else {
+			entry["tier"] = "free"
+			entry["cap_bytes"] = freeMonthlyCap
+		}
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i]["usage_bytes"].(int64) > out[j]["usage_bytes"].(int64)
+	})
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAdminAudit lists the whole relay's audit log. Accepts the filters of
+// serveAudit plus ?user_id= and ?org_id=.
+// GET /api/v1/admin/audit
+func (s *Server) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if s.adminAuth(w, r) == nil {
+		return
+	}
+	q := r.URL.Query()
+	s.serveAudit(w, r, AuditFilter{UserID: q.Get("user_id"), OrgID: q.Get("org_id")})
+}
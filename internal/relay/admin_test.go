@@ -0,0 +1,239 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// testWingConn returns a websocket conn for a fake ConnectedWing and a
+// channel that receives the close status the relay sends it.
+func testWingConn(t *testing.T) (*websocket.Conn, <-chan websocket.StatusCode) {
+	t.Helper()
+	closed := make(chan websocket.StatusCode, 1)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		_, _, err = c.Read(context.Background())
+		closed <- websocket.CloseStatus(err)
+	}))
+	t.Cleanup(peer.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(peer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	return conn, closed
+}
+
+func waitClosed(t *testing.T, closed <-chan websocket.StatusCode) {
+	t.Helper()
+	select {
+	case status := <-closed:
+		if status != websocket.StatusPolicyViolation {
+			t.Fatalf("close status = %v, want policy violation", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wing was not disconnected")
+	}
+}
+
+func TestAdminAPIRequiresAdmin(t *testing.T) {
+	srv, ts, client, userID := testServerWithSession(t)
+
+	resp, err := client.Get(ts.URL + "/api/v1/admin/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("non-admin: %d, want 403", resp.StatusCode)
+	}
+	resp, _ = client.Post(ts.URL+"/api/v1/tokens", "application/json", strings.NewReader(`{"name":"x","scopes":["admin"]}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("non-admin minting admin scope: %d, want 403", resp.StatusCode)
+	}
+
+	srv.Store.SetUserAdmin(userID, true)
+	resp, err = client.Get(ts.URL + "/api/v1/admin/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []map[string]any
+	json.NewDecoder(resp.Body).Decode(&users)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(users) != 1 || users[0]["is_admin"] != true {
+		t.Fatalf("admin list: %d %v", resp.StatusCode, users)
+	}
+
+	// Tokens need the admin scope as well as an admin owner
+	_, readOnly := apiCreateToken(t, ts, client, `{"name":"ro","scopes":["wings:read"]}`)
+	if code, _ := apiDo(t, ts, readOnly, "GET", "/api/v1/admin/users", ""); code != http.StatusForbidden {
+		t.Errorf("token without admin scope: %d, want 403", code)
+	}
+	_, adminTok := apiCreateToken(t, ts, client, `{"name":"ops","scopes":["admin"]}`)
+	if code, data := apiDo(t, ts, adminTok, "GET", "/api/v1/admin/users", ""); code != http.StatusOK {
+		t.Errorf("admin token: %d %s", code, data)
+	}
+
+	// Demoted admins lose their admin tokens' power with the role
+	srv.Store.SetUserAdmin(userID, false)
+	if code, _ := apiDo(t, ts, adminTok, "GET", "/api/v1/admin/users", ""); code != http.StatusForbidden {
+		t.Errorf("demoted admin token: %d, want 403", code)
+	}
+}
+
+func TestAdminSuspendUser(t *testing.T) {
+	srv, ts, client, adminID := testServerWithSession(t)
+	srv.Store.SetUserAdmin(adminID, true)
+	_, adminTok := apiCreateToken(t, ts, client, `{"name":"ops","scopes":["admin"]}`)
+
+	token, userID := createTestToken(t, srv.Store, "victim")
+	srv.Store.CreateSession("session-victim", userID, time.Now().Add(time.Hour))
+	conn, closed := testWingConn(t)
+	srv.Wings.Add(&ConnectedWing{ID: "conn-v", UserID: userID, WingID: "wing-v", Conn: conn})
+
+	if code, _ := apiDo(t, ts, adminTok, "PATCH", "/api/v1/admin/users/"+adminID, `{"suspended":true}`); code != http.StatusBadRequest {
+		t.Errorf("self-suspend: %d, want 400", code)
+	}
+	code, data := apiDo(t, ts, adminTok, "PATCH", "/api/v1/admin/users/"+userID, `{"suspended":true}`)
+	if code != http.StatusOK || !strings.Contains(string(data), `"suspended":true`) {
+		t.Fatalf("suspend: %d %s", code, data)
+	}
+	waitClosed(t, closed)
+	if code, _ := apiDo(t, ts, token, "GET", "/api/v1/me", ""); code != http.StatusUnauthorized {
+		t.Errorf("suspended device token: %d, want 401", code)
+	}
+	if u, _ := srv.Store.GetSession("session-victim"); u != nil {
+		t.Error("suspended user's session still valid")
+	}
+
+	code, data = apiDo(t, ts, adminTok, "GET", "/api/v1/admin/audit?event=admin_suspend", "")
+	var entries []map[string]any
+	json.Unmarshal(data, &entries)
+	if code != http.StatusOK || len(entries) != 1 || entries[0]["user_id"] != userID {
+		t.Fatalf("audit: %d %s", code, data)
+	}
+
+	if code, _ := apiDo(t, ts, adminTok, "PATCH", "/api/v1/admin/users/"+userID, `{"suspended":false}`); code != http.StatusOK {
+		t.Fatalf("unsuspend: %d", code)
+	}
+	if code, _ := apiDo(t, ts, token, "GET", "/api/v1/me", ""); code != http.StatusOK {
+		t.Errorf("reinstated device token: %d", code)
+	}
+}
+
+func TestAdminTierAndKick(t *testing.T) {
+	srv, ts, client, adminID := testServerWithSession(t)
+	srv.Store.SetUserAdmin(adminID, true)
+	_, adminTok := apiCreateToken(t, ts, client, `{"name":"ops","scopes":["admin"]}`)
+	_, userID := createTestToken(t, srv.Store, "member")
+
+	if code, _ := apiDo(t, ts, adminTok, "PATCH", "/api/v1/admin/users/"+userID, `{"tier":"gold"}`); code != http.StatusBadRequest {
+		t.Errorf("bad tier: %d, want 400", code)
+	}
+	if code, data := apiDo(t, ts, adminTok, "PATCH", "/api/v1/admin/users/"+userID, `{"tier":"pro"}`); code != http.StatusOK {
+		t.Fatalf("tier pro: %d %s", code, data)
+	}
+	if !srv.Store.IsUserPro(userID) {
+		t.Error("user not pro after tier change")
+	}
+	if code, _ := apiDo(t, ts, adminTok, "PATCH", "/api/v1/admin/users/"+userID, `{"tier":"free"}`); code != http.StatusOK {
+		t.Fatalf("tier free: %d", code)
+	}
+	if srv.Store.IsUserPro(userID) {
+		t.Error("user still pro after downgrade")
+	}
+
+	conn, closed := testWingConn(t)
+	srv.Wings.Add(&ConnectedWing{ID: "conn-m", UserID: userID, WingID: "wing-m", Conn: conn})
+	code, data := apiDo(t, ts, adminTok, "GET", "/api/v1/admin/wings", "")
+	if ids := apiWingIDs(t, data); code != http.StatusOK || len(ids) != 1 || ids[0] != "wing-m" {
+		t.Fatalf("wings: %d %s", code, data)
+	}
+	if code, _ := apiDo(t, ts, adminTok, "DELETE", "/api/v1/admin/wings/nope", ""); code != http.StatusNotFound {
+		t.Errorf("kick unknown wing: %d, want 404", code)
+	}
+	if code, _ := apiDo(t, ts, adminTok, "DELETE", "/api/v1/admin/wings/wing-m", ""); code != http.StatusAccepted {
+		t.Fatalf("kick: %d", code)
+	}
+	waitClosed(t, closed)
+}
+
+func TestEdgeRefusesSuspendedWingJWT(t *testing.T) {
+	var suspended atomic.Bool
+	var lookups atomic.Int32
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/internal/user-status/u1" {
+			http.NotFound(w, r)
+			return
+		}
+		lookups.Add(1)
+		writeJSON(w, http.StatusOK, map[string]bool{"suspended": suspended.Load()})
+	}))
+	defer login.Close()
+
+	key, _, err := GenerateECKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(nil, ServerConfig{NodeRole: "edge", FlyMachineID: "edge-1", LoginNodeAddr: login.URL})
+	srv.SetJWTKey(key)
+	srv.sessionCache = NewSessionCache()
+	token, _, err := IssueWingJWT(key, "u1", "", "wing-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireToken := func() int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/auth/check", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		srv.requireToken(rec, req)
+		return rec.Code
+	}
+
+	if code := requireToken(); code != http.StatusOK {
+		t.Fatalf("active user: %d", code)
+	}
+	// The answer is cached for a while...
+	suspended.Store(true)
+	if code := requireToken(); code != http.StatusOK || lookups.Load() != 1 {
+		t.Fatalf("cached: %d after %d lookups", code, lookups.Load())
+	}
+	// ...until the login node's suspension kick reaches the edge
+	rec := httptest.NewRecorder()
+	srv.handleInternalWingEvent(rec, httptest.NewRequest("POST", "/internal/wing-event", strings.NewReader(`{"type":"wing.kick","user_id":"u1"}`)))
+	if code := requireToken(); code != http.StatusForbidden || lookups.Load() != 2 {
+		t.Errorf("suspended user's JWT after kick: %d after %d lookups, want 403", code, lookups.Load())
+	}
+	// ...or the cache entry ages out
+	srv.sessionCache.SetSuspended("u1", false)
+	srv.sessionCache.suspended["u1"].fetchedAt = time.Now().Add(-suspendedCacheTTL)
+	if code := requireToken(); code != http.StatusForbidden {
+		t.Errorf("suspended user's JWT: %d, want 403", code)
+	}
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/ws/pty?wing_id=wing-1&token=" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("suspended user's JWT on /ws/pty: %d, want 403", resp.StatusCode)
+	}
+}
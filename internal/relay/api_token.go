@@ -0,0 +1,281 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiTokenPrefix marks personal access tokens, so auth can tell them apart
+// from device tokens and JWTs without a lookup.
+const apiTokenPrefix = "wtp_"
+
+// apiScopes are the scopes a personal access token can carry.
+var apiScopes = map[string]string{
+	"wings:read":     "list wings and their status",
+	"sessions:read":  "list terminal sessions",
+	"sessions:write": "open, attach to and kill terminal sessions",
+	"orgs:read":      "list orgs and their members",
+	"usage:read":     "read tier and bandwidth usage",
+	"audit:read":     "read your audit log, and your orgs' as an owner or admin",
+	"admin":          "administer the relay (relay admins only)",
+}
+
+// defaultAPITokenDays is the lifetime of a token created without an expiry.
+const defaultAPITokenDays = 90
+
+// allows reports whether the token carries scope. A nil token (browser
+// session or CLI device token) has every scope.
+func (t *APIToken) allows(scope string) bool {
+	return t == nil || scope == "" || slices.Contains(t.Scopes, scope)
+}
+
+// allowsWing reports whether the token may reach a wing, given the wing's org.
+func (t *APIToken) allowsWing(wingID, orgID string) bool {
+	if t == nil {
+		return true
+	}
+	if t.OrgID != nil && orgID != *t.OrgID {
+		return false
+	}
+	return len(t.WingIDs) == 0 || slices.Contains(t.WingIDs, wingID)
+}
+
+// allowsOrg reports whether the token may see an org.
+func (t *APIToken) allowsOrg(orgID string) bool {
+	return t == nil || t.OrgID == nil || *t.OrgID == orgID
+}
+
+// apiCaller is who an /api/v1 request acts for. Token is nil unless the
+// request came with a personal access token.
+type apiCaller struct {
+	User  *User
+	Token *APIToken
+}
+
+// apiAuth authenticates an /api/v1 request by session cookie, personal
+// access token or CLI device token. A personal access token must carry scope.
+// Writes the error response and returns nil on failure.
+func (s *Server) apiAuth(w http.ResponseWriter, r *http.Request, scope string) *apiCaller {
+	if u := s.sessionUser(r); u != nil {
+		return &apiCaller{User: u}
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, http.StatusUnauthorized, "not logged in")
+		return nil
+	}
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		user, t := s.resolveAPIToken(token)
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "invalid or expired token")
+			return nil
+		}
+		if !t.allows(scope) {
+			writeError(w, http.StatusForbidden, "token lacks scope "+scope)
+			return nil
+		}
+		return &apiCaller{User: user, Token: t}
+	}
+	userID := s.requireToken(w, r)
+	if userID == "" {
+		return nil
+	}
+	user, err := s.Store.GetUserByID(userID)
+	if err != nil || user == nil {
+		writeError(w, http.StatusUnauthorized, "user not found")
+		return nil
+	}
+	return &apiCaller{User: user}
+}
+
+// resolveAPIToken looks up a personal access token, locally on the login
+// node or through the login node on edges. Returns nils if it is unknown,
+// revoked or expired.
+func (s *Server) resolveAPIToken(token string) (*User, *APIToken) {
+	hash := hashToken(token)
+	if s.Store == nil {
+		if s.IsEdge() && s.sessionCache != nil {
+			return s.sessionCache.ValidateAPIToken(hash, s.login)
+		}
+		return nil, nil
+	}
+	t, err := s.Store.GetAPITokenByHash(hash)
+	if err != nil || t == nil {
+		return nil, nil
+	}
+	user, err := s.Store.GetUserByID(t.UserID)
+	if err != nil || user == nil || user.SuspendedAt != nil || s.ssoLocked(user) {
+		return nil, nil
+	}
+	return user, t
+}
+
+func apiTokenEntry(t *APIToken) map[string]any {
+	scopes, wings := t.Scopes, t.WingIDs
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if wings == nil {
+		wings = []string{}
+	}
+	return map[string]any{
+		"id":           t.ID,
+		"name":         t.Name,
+		"scopes":       scopes,
+		"wing_ids":     wings,
+		"org_id":       t.OrgID,
+		"expires_at":   t.ExpiresAt,
+		"last_used_at": t.LastUsedAt,
+		"created_at":   t.CreatedAt,
+		"expired":      t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt),
+	}
+}
+
+// tokenAdmin authenticates token and webhook management. Personal access
+// tokens cannot manage either, so a leaked token can't mint itself a
+// successor or subscribe to activity.
+func (s *Server) tokenAdmin(w http.ResponseWriter, r *http.Request) *User {
+	c := s.apiAuth(w, r, "")
+	if c == nil {
+		return nil
+	}
+	if c.Token != nil {
+		writeError(w, http.StatusForbidden, "API tokens can't manage tokens or webhooks")
+		return nil
+	}
+	return c.User
+}
+
+// handleListAPITokens lists the caller's tokens. GET /api/v1/tokens
+func (s *Server) handleListAPITokens(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	tokens, err := s.Store.ListAPITokens(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]map[string]any, len(tokens))
+	for i, t := range tokens {
+		out[i] = apiTokenEntry(t)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleCreateAPIToken issues a personal access token. The secret is in the
+// response only. POST /api/v1/tokens
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		WingIDs       []string `json:"wing_ids"`
+		Org           string   `json:"org"` // ID or slug
+		ExpiresInDays *int     `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		writeError(w, http.StatusBadRequest, "name required (max 100 chars)")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one scope required")
+		return
+	}
+	for _, sc := range req.Scopes {
+		if _, ok := apiScopes[sc]; !ok {
+			writeError(w, http.StatusBadRequest, "unknown scope "+sc)
+			return
+		}
+	}
+	if slices.Contains(req.Scopes, "admin") && !user.IsAdmin {
+		writeError(w, http.StatusForbidden, "only relay admins can grant the admin scope")
+		return
+	}
+	slices.Sort(req.Scopes)
+	req.Scopes = slices.Compact(req.Scopes)
+	for _, id := range req.WingIDs {
+		if id == "" || strings.Contains(id, ",") {
+			writeError(w, http.StatusBadRequest, "invalid wing id")
+			return
+		}
+	}
+
+	t := &APIToken{
+		ID:      uuid.New().String(),
+		UserID:  user.ID,
+		Name:    req.Name,
+		Scopes:  req.Scopes,
+		WingIDs: req.WingIDs,
+	}
+	if req.Org != "" {
+		org, err := s.Store.ResolveOrg(req.Org, user.ID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if org == nil {
+			writeError(w, http.StatusNotFound, "org not found")
+			return
+		}
+		role := s.Store.GetOrgMemberRole(org.ID, user.ID)
+		if role != "owner" && role != "admin" {
+			writeError(w, http.StatusForbidden, "only owners and admins can create org tokens")
+			return
+		}
+		t.OrgID = &org.ID
+	}
+	days := defaultAPITokenDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	if days < 0 || days > 366 {
+		writeError(w, http.StatusBadRequest, "expires_in_days must be 0 (never) to 366")
+		return
+	}
+	if days > 0 {
+		exp := time.Now().UTC().Add(time.Duration(days) * 24 * time.Hour).Truncate(time.Second)
+		t.ExpiresAt = &exp
+	}
+
+	secret := apiTokenPrefix + generateToken()
+	if err := s.Store.CreateAPIToken(t, hashToken(secret)); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	t.CreatedAt = time.Now().UTC()
+	s.Store.AppendAudit(user.ID, "api_token_created", strPtr("id="+t.ID+" scopes="+strings.Join(t.Scopes, ",")))
+
+	out := apiTokenEntry(t)
+	out["token"] = secret
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// handleDeleteAPIToken revokes one of the caller's tokens. DELETE /api/v1/tokens/{id}
+func (s *Server) handleDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	id := r.PathValue("id")
+	if err := s.Store.DeleteAPIToken(id, user.ID); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.Store.AppendAudit(user.ID, "api_token_revoked", strPtr("id="+id))
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
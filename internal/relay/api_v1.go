@@ -0,0 +1,222 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/coder/websocket"
+
+	"github.com/ehrlich-b/wingthing/internal/ws"
+)
+
+// Versioned REST API for scripts and integrations. Browser sessions and CLI
+// device tokens see everything the user can; personal access tokens need the
+// scope each endpoint names and only see the wings and org they are limited to.
+
+// handleAPIMe returns the caller. GET /api/v1/me
+func (s *Server) handleAPIMe(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "")
+	if c == nil {
+		return
+	}
+	out := map[string]any{
+		"id":           c.User.ID,
+		"display_name": c.User.DisplayName,
+		"email":        c.User.Email,
+	}
+	if c.Token != nil {
+		out["token"] = apiTokenEntry(c.Token)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// apiWings lists the wings the caller can reach.
+func (s *Server) apiWings(c *apiCaller) []map[string]any {
+	out := []map[string]any{}
+	for _, e := range s.wingEntries(c.User.ID) {
+		wingID, _ := e["wing_id"].(string)
+		orgID, _ := e["org_id"].(string)
+		if c.Token.allowsWing(wingID, orgID) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// handleAPIWings lists wings. GET /api/v1/wings
+func (s *Server) handleAPIWings(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "wings:read")
+	if c == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.apiWings(c))
+}
+
+// handleAPIWing returns one wing. GET /api/v1/wings/{wingID}
+func (s *Server) handleAPIWing(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "wings:read")
+	if c == nil {
+		return
+	}
+	wingID := r.PathValue("wingID")
+	for _, e := range s.apiWings(c) {
+		if e["wing_id"] == wingID {
+			writeJSON(w, http.StatusOK, e)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "wing not found")
+}
+
+// handleAPISessions lists the caller's terminal sessions routed through this
+// relay. GET /api/v1/sessions?wing_id=
+func (s *Server) handleAPISessions(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "sessions:read")
+	if c == nil {
+		return
+	}
+	filter := r.URL.Query().Get("wing_id")
+	out := []map[string]any{}
+	for sid, route := range s.PTY.ForUser(c.User.ID) {
+		route.mu.Lock()
+		entry := map[string]any{
+			"id":       sid,
+			"wing_id":  route.WingID,
+			"agent":    route.Agent,
+			"cwd":      route.CWD,
+			"attached": route.BrowserConn != nil,
+			"viewers":  len(route.Viewers),
+		}
+		wingID := route.WingID
+		route.mu.Unlock()
+		if filter != "" && wingID != filter {
+			continue
+		}
+		var orgID string
+		if wing := s.findAnyWingByWingID(wingID); wing != nil {
+			orgID = wing.OrgID
+		}
+		if !c.Token.allowsWing(wingID, orgID) {
+			continue
+		}
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["id"].(string) < out[j]["id"].(string) })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAPIKillSession ends one of the caller's sessions. DELETE /api/v1/sessions/{sessionID}
+func (s *Server) handleAPIKillSession(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "sessions:write")
+	if c == nil {
+		return
+	}
+	sessionID := r.PathValue("sessionID")
+	route := s.PTY.Get(sessionID)
+	if route == nil {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	route.mu.Lock()
+	owner, wingID := route.UserID, route.WingID
+	route.mu.Unlock()
+	wing := s.findAnyWingByWingID(wingID)
+	if owner != c.User.ID || (wing != nil && !c.Token.allowsWing(wing.WingID, wing.OrgID)) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	if wing == nil || !s.canAccessWing(c.User.ID, wing, c.User.OrgIDs) {
+		writeError(w, http.StatusConflict, "wing offline")
+		return
+	}
+	msg, _ := json.Marshal(ws.PTYKill{Type: ws.TypePTYKill, SessionID: sessionID})
+	if err := wing.Conn.Write(r.Context(), websocket.MessageText, msg); err != nil {
+		writeError(w, http.StatusBadGateway, "wing unreachable")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"ok": true})
+}
+
+// handleAPIOrgs lists the caller's orgs. GET /api/v1/orgs
+func (s *Server) handleAPIOrgs(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "orgs:read")
+	if c == nil {
+		return
+	}
+	orgs, err := s.Store.ListOrgsForUser(c.User.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := []map[string]any{}
+	for _, o := range orgs {
+		if c.Token.allowsOrg(o.ID) {
+			out = append(out, s.orgEntry(o, c.User.ID))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// apiOrg resolves {orgID} for a caller that may see it.
+func (s *Server) apiOrg(w http.ResponseWriter, r *http.Request, c *apiCaller) *Org {
+	org, err := s.Store.GetOrgByID(r.PathValue("orgID"))
+	if err != nil || org == nil || !c.Token.allowsOrg(org.ID) || !s.Store.IsOrgMember(org.ID, c.User.ID) {
+		writeError(w, http.StatusNotFound, "org not found")
+		return nil
+	}
+	return org
+}
+
+// handleAPIOrg returns one org. GET /api/v1/orgs/{orgID}
+func (s *Server) handleAPIOrg(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "orgs:read")
+	if c == nil {
+		return
+	}
+	org := s.apiOrg(w, r, c)
+	if org == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.orgEntry(org, c.User.ID))
+}
+
+// handleAPIOrgMembers lists an org's members. GET /api/v1/orgs/{orgID}/members
+func (s *Server) handleAPIOrgMembers(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "orgs:read")
+	if c == nil {
+		return
+	}
+	org := s.apiOrg(w, r, c)
+	if org == nil {
+		return
+	}
+	members, err := s.Store.ListOrgMembers(org.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]map[string]any, 0, len(members))
+	for _, m := range members {
+		entry := map[string]any{
+			"user_id":   m.UserID,
+			"role":      m.Role,
+			"joined_at": m.CreatedAt,
+		}
+		if u, _ := s.Store.GetUserByID(m.UserID); u != nil {
+			entry["display_name"] = u.DisplayName
+			entry["email"] = u.Email
+		}
+		out = append(out, entry)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAPIUsage returns tier and bandwidth usage. GET /api/v1/usage
+func (s *Server) handleAPIUsage(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "usage:read")
+	if c == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.usageEntry(c.User.ID))
+}
@@ -0,0 +1,183 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func apiDo(t *testing.T, ts *httptest.Server, token, method, path, body string) (int, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+// apiCreateToken creates a personal access token through the session client.
+func apiCreateToken(t *testing.T, ts *httptest.Server, client *http.Client, body string) (id, secret string) {
+	t.Helper()
+	resp, err := client.Post(ts.URL+"/api/v1/tokens", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		data, _ := io.ReadAll(resp.Body)
+		t.Fatalf("create token: %d %s", resp.StatusCode, data)
+	}
+	var out struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if !strings.HasPrefix(out.Token, apiTokenPrefix) {
+		t.Fatalf("token = %q", out.Token)
+	}
+	return out.ID, out.Token
+}
+
+func apiWingIDs(t *testing.T, data []byte) []string {
+	t.Helper()
+	var wings []map[string]any
+	if err := json.Unmarshal(data, &wings); err != nil {
+		t.Fatalf("decode wings: %v (%s)", err, data)
+	}
+	var ids []string
+	for _, w := range wings {
+		ids = append(ids, w["wing_id"].(string))
+	}
+	return ids
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	srv, ts, client, userID := testServerWithSession(t)
+	srv.Wings.Add(&ConnectedWing{ID: "conn-a", UserID: userID, WingID: "wing-a"})
+
+	id, token := apiCreateToken(t, ts, client, `{"name":"ci","scopes":["wings:read"]}`)
+
+	code, data := apiDo(t, ts, token, "GET", "/api/v1/wings", "")
+	if code != http.StatusOK {
+		t.Fatalf("wings: %d %s", code, data)
+	}
+	if ids := apiWingIDs(t, data); len(ids) != 1 || ids[0] != "wing-a" {
+		t.Errorf("wings = %v", ids)
+	}
+	if code, _ := apiDo(t, ts, token, "GET", "/api/v1/usage", ""); code != http.StatusForbidden {
+		t.Errorf("usage without scope: %d, want 403", code)
+	}
+	if code, _ := apiDo(t, ts, token, "GET", "/api/v1/me", ""); code != http.StatusOK {
+		t.Errorf("me: %d", code)
+	}
+
+	// A token can't mint or list tokens
+	if code, _ := apiDo(t, ts, token, "POST", "/api/v1/tokens", `{"name":"x","scopes":["usage:read"]}`); code != http.StatusForbidden {
+		t.Errorf("token create via token: %d, want 403", code)
+	}
+	if code, _ := apiDo(t, ts, token, "GET", "/api/v1/tokens", ""); code != http.StatusForbidden {
+		t.Errorf("token list via token: %d, want 403", code)
+	}
+
+	// Unknown scope is rejected
+	resp, _ := client.Post(ts.URL+"/api/v1/tokens", "application/json", strings.NewReader(`{"name":"x","scopes":["root"]}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown scope: %d, want 400", resp.StatusCode)
+	}
+
+	// Revoke; the token stops working
+	req, _ := http.NewRequest("DELETE", ts.URL+"/api/v1/tokens/"+id, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke: %d", resp.StatusCode)
+	}
+	if code, _ := apiDo(t, ts, token, "GET", "/api/v1/wings", ""); code != http.StatusUnauthorized {
+		t.Errorf("revoked token: %d, want 401", code)
+	}
+}
+
+func TestAPITokenWingAndOrgLimits(t *testing.T) {
+	srv, ts, client, userID := testServerWithSession(t)
+	srv.Store.CreateOrg("org-1", "Acme", "acme", userID)
+	srv.Store.CreateOrg("org-2", "Other", "other", userID)
+	srv.Wings.Add(&ConnectedWing{ID: "conn-a", UserID: userID, WingID: "wing-a"})
+	srv.Wings.Add(&ConnectedWing{ID: "conn-b", UserID: userID, WingID: "wing-b", OrgID: "org-1"})
+
+	_, orgToken := apiCreateToken(t, ts, client, `{"name":"org","scopes":["wings:read","orgs:read"],"org":"acme"}`)
+	_, data := apiDo(t, ts, orgToken, "GET", "/api/v1/wings", "")
+	if ids := apiWingIDs(t, data); len(ids) != 1 || ids[0] != "wing-b" {
+		t.Errorf("org token wings = %v, want [wing-b]", ids)
+	}
+	if code, _ := apiDo(t, ts, orgToken, "GET", "/api/v1/wings/wing-a", ""); code != http.StatusNotFound {
+		t.Errorf("org token personal wing: %d, want 404", code)
+	}
+	_, data = apiDo(t, ts, orgToken, "GET", "/api/v1/orgs", "")
+	var orgs []map[string]any
+	json.Unmarshal(data, &orgs)
+	if len(orgs) != 1 || orgs[0]["id"] != "org-1" {
+		t.Errorf("org token orgs = %v", orgs)
+	}
+	if code, _ := apiDo(t, ts, orgToken, "GET", "/api/v1/orgs/org-2/members", ""); code != http.StatusNotFound {
+		t.Errorf("org token other org: %d, want 404", code)
+	}
+	if code, _ := apiDo(t, ts, orgToken, "GET", "/api/v1/orgs/org-1/members", ""); code != http.StatusOK {
+		t.Errorf("org token own org members: %d", code)
+	}
+
+	_, wingToken := apiCreateToken(t, ts, client, `{"name":"one","scopes":["wings:read"],"wing_ids":["wing-a"]}`)
+	_, data = apiDo(t, ts, wingToken, "GET", "/api/v1/wings", "")
+	if ids := apiWingIDs(t, data); len(ids) != 1 || ids[0] != "wing-a" {
+		t.Errorf("wing token wings = %v, want [wing-a]", ids)
+	}
+
+	// Only owners and admins can create org tokens
+	srv.Store.CreateUser("other-owner")
+	srv.Store.CreateOrg("org-3", "Third", "third", "other-owner")
+	srv.Store.DB().Exec("UPDATE orgs SET max_seats = 10 WHERE id = 'org-3'")
+	srv.Store.AddOrgMember("org-3", userID, "member")
+	resp, _ := client.Post(ts.URL+"/api/v1/tokens", "application/json", strings.NewReader(`{"name":"x","scopes":["wings:read"],"org":"org-3"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("member org token: %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestAPITokenExpiryAndDeviceToken(t *testing.T) {
+	srv, ts, _, userID := testServerWithSession(t)
+
+	past := time.Now().Add(-time.Hour)
+	srv.Store.CreateAPIToken(&APIToken{ID: "tok-old", UserID: userID, Name: "old", Scopes: []string{"usage:read"}, ExpiresAt: &past}, hashToken("wtp_expired"))
+	if code, _ := apiDo(t, ts, "wtp_expired", "GET", "/api/v1/usage", ""); code != http.StatusUnauthorized {
+		t.Errorf("expired token: %d, want 401", code)
+	}
+
+	// CLI device tokens have full access (wt tunnel discovery uses /api/v1/wings)
+	srv.Store.CreateDeviceToken("device-tok", userID, "dev-1", nil)
+	srv.Wings.Add(&ConnectedWing{ID: "conn-a", UserID: userID, WingID: "wing-a"})
+	code, data := apiDo(t, ts, "device-tok", "GET", "/api/v1/wings", "")
+	if code != http.StatusOK {
+		t.Fatalf("device token wings: %d %s", code, data)
+	}
+	if ids := apiWingIDs(t, data); len(ids) != 1 {
+		t.Errorf("device token wings = %v", ids)
+	}
+	if code, _ := apiDo(t, ts, "", "GET", "/api/v1/wings", ""); code != http.StatusUnauthorized {
+		t.Errorf("no auth: %d, want 401", code)
+	}
+}
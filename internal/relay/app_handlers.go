@@ -3,6 +3,8 @@ package relay
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -13,6 +15,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/ehrlich-b/wingthing/internal/ntfy"
+	"github.com/ehrlich-b/wingthing/internal/ws"
 )
 
 // tokenUser authenticates a request via Bearer token (CLI device auth).
@@ -30,7 +33,7 @@ func (s *Server) tokenUser(r *http.Request) *User {
 		return nil
 	}
 	user, err := s.Store.GetUserByID(userID)
-	if err != nil {
+	if err != nil || s.ssoLocked(user) {
 		return nil
 	}
 	return user
@@ -91,6 +94,7 @@ func (s *Server) handleAppMe(w http.ResponseWriter, r *http.Request) {
 		"email":            user.Email,
 		"personal_pro":     hasPersonalSub,
 		"roost_mode":       s.RoostMode,
+		"preview_host":     s.Config.PreviewHost,
 		"has_passkeys":     len(creds) > 0,
 	})
 }
@@ -103,7 +107,13 @@ func (s *Server) handleAppWings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wings := s.listAccessibleWings(user.ID)
+	writeJSON(w, http.StatusOK, s.wingEntries(user.ID))
+}
+
+// wingEntries lists the wings userID can access, local and on peer nodes,
+// with owner display names resolved.
+func (s *Server) wingEntries(userID string) []map[string]any {
+	wings := s.listAccessibleWings(userID)
 	latestVer := s.getLatestVersion()
 
 	// Collect unique owner IDs and resolve display names
@@ -130,8 +140,8 @@ func (s *Server) handleAppWings(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 			// Check access: owner OR org member
-			if loc.UserID != user.ID {
-				if loc.OrgID == "" || s.Store == nil || !s.Store.IsOrgMember(loc.OrgID, user.ID) {
+			if loc.UserID != userID {
+				if loc.OrgID == "" || s.Store == nil || !s.Store.IsOrgMember(loc.OrgID, userID) {
 					continue
 				}
 			}
@@ -155,7 +165,7 @@ func (s *Server) handleAppWings(w http.ResponseWriter, r *http.Request) {
 	ownerNames := make(map[string]string)
 	if s.Store != nil {
 		for uid := range ownerIDs {
-			if uid == user.ID {
+			if uid == userID {
 				continue
 			}
 			if u, err := s.Store.GetUserByID(uid); err == nil && u != nil {
@@ -174,7 +184,7 @@ func (s *Server) handleAppWings(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	writeJSON(w, http.StatusOK, out)
+	return out
 }
 
 // getLatestVersion returns the latest release version from cache, fetching from GitHub if stale.
@@ -255,7 +265,7 @@ func (s *Server) handleAppWS(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.CloseNow()
 
-	s.trackBrowser(conn)
+	s.trackBrowser(conn, user.ID)
 	defer s.untrackBrowser(conn)
 
 	// Resolve org memberships at subscribe time for pub/sub delivery
@@ -298,14 +308,19 @@ func (s *Server) handleAppUsage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeJSON(w, http.StatusOK, s.usageEntry(user.ID))
+}
+
+// usageEntry reports the user's tier and this month's relay bandwidth.
+func (s *Server) usageEntry(userID string) map[string]any {
 	tier := "free"
-	if s.Store.IsUserPro(user.ID) {
+	if s.Store.IsUserPro(userID) {
 		tier = "pro"
 	}
 
 	var usageBytes int64
 	if s.Bandwidth != nil {
-		usageBytes = s.Bandwidth.MonthlyUsage(user.ID)
+		usageBytes = s.Bandwidth.MonthlyUsage(userID)
 	}
 
 	out := map[string]any{
@@ -319,7 +334,7 @@ func (s *Server) handleAppUsage(w http.ResponseWriter, r *http.Request) {
 		out["cap_bytes"] = nil
 		out["exceeded"] = false
 	}
-	writeJSON(w, http.StatusOK, out)
+	return out
 }
 
 // handleAppUpgrade creates a personal subscription + entitlement.
@@ -329,28 +344,10 @@ func (s *Server) handleAppUpgrade(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "not logged in")
 		return
 	}
-
-	existing, _ := s.Store.GetActivePersonalSubscription(user.ID)
-	if existing != nil {
-		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "tier": "pro"})
+	if err := s.grantPersonalPro(user.ID, "pro_monthly"); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-
-	subID := uuid.New().String()
-	sub := &Subscription{ID: subID, UserID: &user.ID, Plan: "pro_monthly", Status: "active", Seats: 1}
-	if err := s.Store.CreateSubscription(sub); err != nil {
-		writeError(w, http.StatusInternalServerError, "create subscription: "+err.Error())
-		return
-	}
-	if err := s.Store.CreateEntitlement(&Entitlement{ID: uuid.New().String(), UserID: user.ID, SubscriptionID: subID}); err != nil {
-		writeError(w, http.StatusInternalServerError, "create entitlement: "+err.Error())
-		return
-	}
-
-	s.Store.UpdateUserTier(user.ID, "pro")
-	if s.Bandwidth != nil {
-		s.Bandwidth.InvalidateUser(user.ID)
-	}
 	log.Printf("user %s (%s) upgraded to pro (no billing)", user.ID, user.DisplayName)
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "tier": "pro"})
 }
@@ -362,29 +359,63 @@ func (s *Server) handleAppDowngrade(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "not logged in")
 		return
 	}
-
-	sub, _ := s.Store.GetActivePersonalSubscription(user.ID)
-	if sub == nil {
-		writeError(w, http.StatusBadRequest, "no active personal subscription")
+	tier, err := s.cancelPersonalPro(user.ID)
+	if errors.Is(err, errNoPersonalSubscription) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	log.Printf("user %s (%s) downgraded (personal sub canceled)", user.ID, user.DisplayName)
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "tier": tier})
+}
+
+var errNoPersonalSubscription = errors.New("no active personal subscription")
+
+// grantPersonalPro gives a user pro through a personal subscription on plan,
+// unless they already have one.
+func (s *Server) grantPersonalPro(userID, plan string) error {
+	if existing, _ := s.Store.GetActivePersonalSubscription(userID); existing != nil {
+		return nil
+	}
+	subID := uuid.New().String()
+	sub := &Subscription{ID: subID, UserID: &userID, Plan: plan, Status: "active", Seats: 1}
+	if err := s.Store.CreateSubscription(sub); err != nil {
+		return fmt.Errorf("create subscription: %w", err)
+	}
+	if err := s.Store.CreateEntitlement(&Entitlement{ID: uuid.New().String(), UserID: userID, SubscriptionID: subID}); err != nil {
+		return fmt.Errorf("create entitlement: %w", err)
+	}
+	s.Store.UpdateUserTier(userID, "pro")
+	if s.Bandwidth != nil {
+		s.Bandwidth.InvalidateUser(userID)
+	}
+	return nil
+}
 
+// cancelPersonalPro cancels a user's personal subscription and returns the
+// tier left over; an org seat can keep them on pro.
+func (s *Server) cancelPersonalPro(userID string) (string, error) {
+	sub, _ := s.Store.GetActivePersonalSubscription(userID)
+	if sub == nil {
+		return "", errNoPersonalSubscription
+	}
 	if err := s.Store.UpdateSubscriptionStatus(sub.ID, "canceled"); err != nil {
-		writeError(w, http.StatusInternalServerError, "cancel subscription: "+err.Error())
-		return
+		return "", fmt.Errorf("cancel subscription: %w", err)
 	}
-	s.Store.DeleteEntitlementByUserAndSub(user.ID, sub.ID)
+	s.Store.DeleteEntitlementByUserAndSub(userID, sub.ID)
 
 	tier := "free"
-	if s.Store.IsUserPro(user.ID) {
+	if s.Store.IsUserPro(userID) {
 		tier = "pro"
 	}
-	s.Store.UpdateUserTier(user.ID, tier)
+	s.Store.UpdateUserTier(userID, tier)
 	if s.Bandwidth != nil {
-		s.Bandwidth.InvalidateUser(user.ID)
+		s.Bandwidth.InvalidateUser(userID)
 	}
-	log.Printf("user %s (%s) downgraded (personal sub canceled)", user.ID, user.DisplayName)
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "tier": tier})
+	return tier, nil
 }
 
 // wingLabelScope resolves the owner and scope for a wing label operation.
@@ -575,3 +606,40 @@ func (s *Server) handleNtfyGenerate(w http.ResponseWriter, r *http.Request) {
 	topic := ntfy.GenerateTopic()
 	writeJSON(w, http.StatusOK, map[string]any{"topic": topic})
 }
+
+// handleAuditHead returns the audit chain head the relay witnessed for one of
+// the user's wing sessions, so `wt audit verify --notary` can compare it with
+// the local chain.
+func (s *Server) handleAuditHead(w http.ResponseWriter, r *http.Request) {
+	user := s.sessionUser(r)
+	if user == nil {
+		user = s.tokenUser(r)
+	}
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	if s.Store == nil {
+		writeError(w, http.StatusInternalServerError, "no store")
+		return
+	}
+	head, err := s.Store.GetAuditHead(r.PathValue("wingID"), r.PathValue("sessionID"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if head == nil || head.UserID != user.ID {
+		writeError(w, http.StatusNotFound, "no notarized head")
+		return
+	}
+	writeJSON(w, http.StatusOK, ws.AuditHead{
+		Type:      ws.TypeAuditHead,
+		SessionID: head.SessionID,
+		Seq:       head.Seq,
+		Head:      head.Head,
+		SignedAt:  head.SignedAt,
+		Sig:       head.Sig,
+		Key:       head.SignerKey,
+		Sealed:    head.Sealed,
+	})
+}
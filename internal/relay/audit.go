@@ -0,0 +1,194 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit log: security events (logins, tokens, passkeys, org membership, wing
+// registrations) recorded with AppendAudit/AppendOrgAudit. Users read their
+// own events, org owners and admins their org's, relay admins everything.
+
+// auditExportBatch is how many rows an export reads per query.
+const auditExportBatch = 1000
+
+// keyFingerprint is the SHA-256 fingerprint of a base64 public key, in the
+// ssh-keygen style. Keys that aren't base64 are hashed as given.
+func keyFingerprint(key string) string {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		raw = []byte(key)
+	}
+	sum := sha256.Sum256(raw)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// auditEntryJSON is the API form of an audit_log row.
+func auditEntryJSON(e *AuditEntry) map[string]any {
+	return map[string]any{
+		"id":        e.ID,
+		"timestamp": e.Timestamp.UTC(),
+		"user_id":   e.UserID,
+		"org_id":    e.OrgID,
+		"event":     e.Event,
+		"detail":    e.Detail,
+	}
+}
+
+// parseAuditTime accepts RFC 3339 or a bare date.
+func parseAuditTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// serveAudit answers an audit query scoped by base. Query params:
+//
+//	event=a,b         only these events
+//	since=, until=    RFC 3339 or YYYY-MM-DD; until is exclusive
+//	before=<id>       page back from the last id seen
+//	limit=            page size (default 100, max 1000)
+//	format=jsonl|csv  export every matching entry instead of one page
+func (s *Server) serveAudit(w http.ResponseWriter, r *http.Request, base AuditFilter) {
+	q := r.URL.Query()
+	f := base
+	if ev := q.Get("event"); ev != "" {
+		for _, e := range strings.Split(ev, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				f.Events = append(f.Events, e)
+			}
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := parseAuditTime(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, p.name+" must be RFC 3339 or YYYY-MM-DD")
+				return
+			}
+			*p.dst = t
+		}
+	}
+	f.Before, _ = strconv.ParseInt(q.Get("before"), 10, 64)
+	f.Limit, _ = pagination(r)
+
+	format := q.Get("format")
+	switch format {
+	case "", "json":
+		entries, err := s.Store.ListAudit(f)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		out := make([]map[string]any, 0, len(entries))
+		for _, e := range entries {
+			out = append(out, auditEntryJSON(e))
+		}
+		writeJSON(w, http.StatusOK, out)
+		return
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+	default:
+		writeError(w, http.StatusBadRequest, "format must be json, jsonl or csv")
+		return
+	}
+
+	// Export: walk the whole range newest first, one batch at a time
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="wingthing-audit.%s"`, format))
+	enc := json.NewEncoder(w)
+	cw := csv.NewWriter(w)
+	if format == "csv" {
+		cw.Write([]string{"id", "timestamp", "user_id", "org_id", "event", "detail"})
+	}
+	f.Limit = auditExportBatch
+	for {
+		entries, err := s.Store.ListAudit(f)
+		if err != nil {
+			// Headers are gone; a truncated export is all we can signal
+			return
+		}
+		for _, e := range entries {
+			if format == "jsonl" {
+				enc.Encode(auditEntryJSON(e))
+				continue
+			}
+			cw.Write([]string{
+				strconv.FormatInt(e.ID, 10),
+				e.Timestamp.UTC().Format(time.RFC3339),
+				derefStr(e.UserID),
+				derefStr(e.OrgID),
+				e.Event,
+				derefStr(e.Detail),
+			})
+		}
+		cw.Flush()
+		if len(entries) < auditExportBatch {
+			return
+		}
+		f.Before = entries[len(entries)-1].ID
+	}
+}
+
+func derefStr(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// handleAPIAudit lists the caller's own audit events. GET /api/v1/audit
+func (s *Server) handleAPIAudit(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "audit:read")
+	if c == nil {
+		return
+	}
+	f := AuditFilter{UserID: c.User.ID}
+	if c.Token != nil && c.Token.OrgID != nil {
+		f.OrgID = *c.Token.OrgID // org-limited tokens see only that org's events
+	}
+	s.serveAudit(w, r, f)
+}
+
+// handleAPIOrgAudit lists an org's audit events, for its owner and admins.
+// ?user_id= narrows to one member. GET /api/v1/orgs/{orgID}/audit
+func (s *Server) handleAPIOrgAudit(w http.ResponseWriter, r *http.Request) {
+	c := s.apiAuth(w, r, "audit:read")
+	if c == nil {
+		return
+	}
+	org := s.apiOrg(w, r, c)
+	if org == nil {
+		return
+	}
+	if role := s.Store.GetOrgMemberRole(org.ID, c.User.ID); role != "owner" && role != "admin" {
+		writeError(w, http.StatusForbidden, "org owners and admins only")
+		return
+	}
+	s.serveAudit(w, r, AuditFilter{OrgID: org.ID, UserID: r.URL.Query().Get("user_id")})
+}
+
+// auditWingRegistered records a wing connecting, with its key fingerprint so
+// a swapped wing key stands out.
+func (s *Server) auditWingRegistered(userID, orgID, wingID, publicKey, machineID string) {
+	detail := "wing=" + wingID
+	if publicKey != "" {
+		detail += " key=" + keyFingerprint(publicKey)
+	}
+	if machineID != "" {
+		detail += " node=" + machineID
+	}
+	s.Store.AppendOrgAudit(userID, orgID, "wing_registered", &detail)
+}
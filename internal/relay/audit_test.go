@@ -0,0 +1,198 @@
+package relay
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func auditGet(t *testing.T, client *http.Client, url string) (int, []map[string]any) {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var entries []map[string]any
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			t.Fatalf("decode %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode, entries
+}
+
+func auditEvents(entries []map[string]any) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e["event"].(string))
+	}
+	return out
+}
+
+func sessionClient(t *testing.T, srv *Server, ts *httptest.Server, userID, email string) *http.Client {
+	t.Helper()
+	srv.Store.CreateUser(userID)
+	srv.Store.UpdateUserEmail(userID, email)
+	srv.Store.CreateSession("session-"+userID, userID, time.Now().Add(time.Hour))
+	jar := &testCookieJar{cookies: map[string][]*http.Cookie{}}
+	jar.cookies[ts.URL] = []*http.Cookie{{Name: "wt_session", Value: "session-" + userID}}
+	return &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+func TestAuditOrgMembershipEvents(t *testing.T) {
+	srv, ts, owner, ownerID := testServerWithSession(t)
+	srv.Store.CreateOrg("org-a", "Acme", "acme", ownerID)
+	srv.Store.DB().Exec("UPDATE orgs SET max_seats = 10 WHERE id = 'org-a'")
+	srv.Store.CreateOrgInvite("inv-1", "org-a", "alice@test.com", "tok-a", ownerID, "member")
+	alice := sessionClient(t, srv, ts, "alice", "alice@test.com")
+
+	resp, err := alice.Post(ts.URL+"/invite/tok-a", "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("accept invite: %d", resp.StatusCode)
+	}
+
+	// Plain members can't read the org's log
+	if code, _ := auditGet(t, alice, ts.URL+"/api/v1/orgs/org-a/audit"); code != http.StatusForbidden {
+		t.Errorf("member reading org audit: %d, want 403", code)
+	}
+
+	req, _ := http.NewRequest("DELETE", ts.URL+"/api/orgs/org-a/members/alice", nil)
+	resp, err = owner.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("remove member: %d", resp.StatusCode)
+	}
+
+	want := "org_member_removed,org_member_added,invite_accepted"
+	code, entries := auditGet(t, owner, ts.URL+"/api/v1/orgs/org-a/audit")
+	if got := strings.Join(auditEvents(entries), ","); code != http.StatusOK || got != want {
+		t.Errorf("org audit: %d %s, want %s", code, got, want)
+	}
+	if !strings.Contains(entries[0]["detail"].(string), "by="+ownerID) {
+		t.Errorf("removal detail = %v", entries[0]["detail"])
+	}
+	_, entries = auditGet(t, owner, ts.URL+"/api/v1/orgs/org-a/audit?user_id=alice&event=invite_accepted")
+	if len(entries) != 1 {
+		t.Errorf("filtered org audit: %v", auditEvents(entries))
+	}
+
+	// Alice sees her own events; the owner's own log doesn't include them
+	_, entries = auditGet(t, alice, ts.URL+"/api/v1/audit")
+	if got := strings.Join(auditEvents(entries), ","); got != want {
+		t.Errorf("alice's audit: %s, want %s", got, want)
+	}
+	_, entries = auditGet(t, owner, ts.URL+"/api/v1/audit")
+	if len(entries) != 0 {
+		t.Errorf("owner's own audit: %v", auditEvents(entries))
+	}
+}
+
+func TestAuditPagingAndScope(t *testing.T) {
+	srv, ts, client, userID := testServerWithSession(t)
+	for _, ev := range []string{"login", "token_issued", "passkey_registered", "login"} {
+		srv.Store.AppendAudit(userID, ev, strPtr("ip=192.0.2.1"))
+	}
+	srv.Store.AppendAudit("someone-else", "login", nil)
+
+	_, page := auditGet(t, client, ts.URL+"/api/v1/audit?limit=3")
+	if len(page) != 3 {
+		t.Fatalf("page 1: %v", auditEvents(page))
+	}
+	last := int64(page[2]["id"].(float64))
+	_, page = auditGet(t, client, ts.URL+"/api/v1/audit?limit=3&before="+strconv.FormatInt(last, 10))
+	if got := auditEvents(page); len(got) != 1 || got[0] != "login" {
+		t.Errorf("page 2: %v", got)
+	}
+	_, page = auditGet(t, client, ts.URL+"/api/v1/audit?event=login,passkey_registered")
+	if len(page) != 3 {
+		t.Errorf("event filter: %v", auditEvents(page))
+	}
+	_, page = auditGet(t, client, ts.URL+"/api/v1/audit?until=2000-01-01")
+	if len(page) != 0 {
+		t.Errorf("until filter: %v", auditEvents(page))
+	}
+	if code, _ := auditGet(t, client, ts.URL+"/api/v1/audit?since=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("bad since: %d, want 400", code)
+	}
+
+	_, noScope := apiCreateToken(t, ts, client, `{"name":"ro","scopes":["wings:read"]}`)
+	if code, _ := apiDo(t, ts, noScope, "GET", "/api/v1/audit", ""); code != http.StatusForbidden {
+		t.Errorf("token without audit:read: %d, want 403", code)
+	}
+	_, scoped := apiCreateToken(t, ts, client, `{"name":"siem","scopes":["audit:read"]}`)
+	if code, data := apiDo(t, ts, scoped, "GET", "/api/v1/audit", ""); code != http.StatusOK {
+		t.Errorf("audit:read token: %d %s", code, data)
+	}
+}
+
+func TestAuditExport(t *testing.T) {
+	srv, ts, client, userID := testServerWithSession(t)
+	for i := 0; i < auditExportBatch+5; i++ {
+		srv.Store.AppendAudit(userID, "login", strPtr(`provider=github ip=192.0.2.1, "quoted"`))
+	}
+
+	resp, err := client.Get(ts.URL + "/api/v1/audit?format=jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("jsonl content type = %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != auditExportBatch+5 {
+		t.Fatalf("jsonl lines = %d, want %d", len(lines), auditExportBatch+5)
+	}
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first["event"] != "login" {
+		t.Errorf("jsonl line: %s (%v)", lines[0], err)
+	}
+
+	resp, err = client.Get(ts.URL + "/api/v1/audit?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != auditExportBatch+6 || strings.Join(rows[0], ",") != "id,timestamp,user_id,org_id,event,detail" {
+		t.Fatalf("csv: %d rows, header %v", len(rows), rows[0])
+	}
+	if rows[1][2] != userID || rows[1][5] != `provider=github ip=192.0.2.1, "quoted"` {
+		t.Errorf("csv row = %v", rows[1])
+	}
+
+	if code, _ := auditGet(t, client, ts.URL+"/api/v1/audit?format=xml"); code != http.StatusBadRequest {
+		t.Errorf("bad format: %d, want 400", code)
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	// ssh-keygen -lf style: SHA256 of the decoded key, unpadded base64
+	if got := keyFingerprint("AAAA"); got != "SHA256:cJ6AyISHokEeHuTfufIqhhSS0gxHZRUMDHlKvXD4FHw" {
+		t.Errorf("fingerprint = %s", got)
+	}
+	if keyFingerprint("AAAA") == keyFingerprint("AAAB") {
+		t.Error("different keys share a fingerprint")
+	}
+}
@@ -35,13 +35,13 @@ func (s *Server) sessionUser(r *http.Request) *User {
 	}
 	// Edge node: validate session via login node
 	if s.IsEdge() && s.sessionCache != nil {
-		return s.sessionCache.Validate(c.Value, s.Config.LoginNodeAddr)
+		return s.sessionCache.Validate(c.Value, s.login)
 	}
 	if s.Store == nil {
 		return nil
 	}
 	user, err := s.Store.GetSession(c.Value)
-	if err != nil {
+	if err != nil || s.ssoLocked(user) {
 		return nil
 	}
 	return user
@@ -90,12 +90,25 @@ func (s *Server) handleDevLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) createSessionAndRedirect(w http.ResponseWriter, r *http.Request, user *User) {
+	// An org that requires SSO locks its members out of every other login
+	if msg := s.ssoLoginBlocked(user); msg != "" {
+		s.Store.AppendAudit(user.ID, "login_denied", strPtr(fmt.Sprintf("provider=%s reason=sso_required ip=%s", user.Provider, clientIP(r))))
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+	if user.SuspendedAt != nil {
+		s.Store.AppendAudit(user.ID, "login_denied", strPtr(fmt.Sprintf("provider=%s reason=suspended ip=%s", user.Provider, clientIP(r))))
+		http.Error(w, "this account has been suspended by the relay admin", http.StatusForbidden)
+		return
+	}
+	s.promoteConfiguredAdmin(user)
 	token := generateToken()
 	if err := s.Store.CreateSession(token, user.ID, time.Now().Add(sessionDuration)); err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	s.setSessionCookie(w, token)
+	s.Store.AppendAudit(user.ID, "login", strPtr(fmt.Sprintf("provider=%s ip=%s", user.Provider, clientIP(r))))
 
 	// Roost mode: auto-grant pro to all OAuth users (self-hosted = unlimited)
 	if s.RoostMode && !s.Store.IsUserPro(user.ID) {
@@ -256,7 +269,7 @@ func (s *Server) handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch email from GitHub API
 	if ghEmail := s.fetchGitHubEmail(tokenData.AccessToken); ghEmail != "" {
-		s.Store.UpdateUserEmail(user.ID, ghEmail)
+		s.setVerifiedEmail(user.ID, ghEmail)
 		user.Email = &ghEmail
 	}
 
@@ -353,10 +366,11 @@ func (s *Server) handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 	defer userResp.Body.Close()
 
 	var gUser struct {
-		ID      string `json:"id"`
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
 	}
 	if err := json.NewDecoder(userResp.Body).Decode(&gUser); err != nil {
 		http.Error(w, "invalid user response", http.StatusInternalServerError)
@@ -390,13 +404,27 @@ func (s *Server) handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 
 	// Store email
 	if gUser.Email != "" {
-		s.Store.UpdateUserEmail(user.ID, gUser.Email)
+		if gUser.VerifiedEmail {
+			s.setVerifiedEmail(user.ID, gUser.Email)
+		} else {
+			s.Store.UpdateUserEmail(user.ID, gUser.Email)
+		}
 		user.Email = &gUser.Email
 	}
 
 	s.createSessionAndRedirect(w, r, user)
 }
 
+// setVerifiedEmail records an email the sign-in provider verified for the
+// user. An unclaimed SCIM placeholder holding it is adopted first
+// (AdoptSCIMUser), since the user has just shown the email is theirs.
+func (s *Server) setVerifiedEmail(userID, email string) error {
+	if err := s.Store.AdoptSCIMUser(userID, email); err != nil {
+		return err
+	}
+	return s.Store.UpdateUserEmail(userID, email)
+}
+
 // Magic Link
 
 func (s *Server) handleMagicLink(w http.ResponseWriter, r *http.Request) {
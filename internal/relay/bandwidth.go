@@ -40,6 +40,7 @@ type BandwidthMeter struct {
 	burst    int
 	db       *sql.DB
 	tierFn   TierLookup
+	syncGate func() bool // StartSync writes only while this returns true
 }
 
 // NewBandwidthMeter creates a meter with the given sustained rate (bytes/sec) and burst (bytes).
@@ -54,6 +55,12 @@ func NewBandwidthMeter(bytesPerSec int, burst int, db *sql.DB) *BandwidthMeter {
 	}
 }
 
+// SetSyncGate makes StartSync skip DB writes while fn returns false. Login
+// replicas use it so only the leader persists totals.
+func (b *BandwidthMeter) SetSyncGate(fn func() bool) {
+	b.syncGate = fn
+}
+
 // SetTierLookup sets the function used to look up user tiers for rate differentiation.
 func (b *BandwidthMeter) SetTierLookup(fn TierLookup) {
 	b.tierFn = fn
@@ -98,6 +105,46 @@ func (b *BandwidthMeter) ExceededUsers() []string {
 	return result
 }
 
+// TierTotals returns this month's metered bytes summed by tier. Only
+// cluster-wide on the login node; edges drain their counters on every sync.
+func (b *BandwidthMeter) TierTotals() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make(map[string]int64)
+	if b.month != currentMonth() {
+		return result
+	}
+	for userID, c := range b.counters {
+		tier := b.tiers[userID]
+		if tier == "" && b.tierFn != nil {
+			tier = b.tierFn(userID)
+			b.tiers[userID] = tier
+		}
+		if tier == "" {
+			tier = "free"
+		}
+		result[tier] += c.Load()
+	}
+	return result
+}
+
+// UserTotals returns this month's metered bytes by user. Like TierTotals,
+// only cluster-wide on the login node.
+func (b *BandwidthMeter) UserTotals() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make(map[string]int64)
+	if b.month != currentMonth() {
+		return result
+	}
+	for userID, c := range b.counters {
+		if v := c.Load(); v > 0 {
+			result[userID] = v
+		}
+	}
+	return result
+}
+
 // Wait blocks until the user's rate limiter allows n bytes, or ctx is done.
 // Rejects immediately if the user has exceeded their monthly bandwidth cap.
 func (b *BandwidthMeter) Wait(ctx context.Context, userID string, n int) error {
@@ -248,6 +295,17 @@ func (b *BandwidthMeter) SeedFromDB() {
 	}
 }
 
+// Reseed replaces the in-memory totals with the DB's, keeping usage counted
+// since the last drain. Called when a login replica becomes leader, since the
+// previous leader has been persisting totals in the meantime.
+func (b *BandwidthMeter) Reseed() {
+	pending := b.DrainCounters()
+	b.SeedFromDB()
+	for userID, n := range pending {
+		b.AddUsage(userID, n)
+	}
+}
+
 // StartSync syncs per-user bandwidth to the DB every interval. Only writes users with changes.
 func (b *BandwidthMeter) StartSync(ctx context.Context, interval time.Duration) {
 	go func() {
@@ -259,6 +317,9 @@ func (b *BandwidthMeter) StartSync(ctx context.Context, interval time.Duration)
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
+				if b.syncGate != nil && !b.syncGate() {
+					continue
+				}
 				b.mu.Lock()
 				snap := make(map[string]int64, len(b.counters))
 				for k, v := range b.counters {
@@ -285,8 +346,8 @@ func (b *BandwidthMeter) StartSync(ctx context.Context, interval time.Duration)
 func (b *BandwidthMeter) syncToDB(userID, month string, total int64) {
 	_, err := b.db.Exec(
 		`INSERT INTO bandwidth_log (user_id, month, bytes_total, updated_at)
-		 VALUES (?, ?, ?, datetime('now'))
-		 ON CONFLICT(user_id, month) DO UPDATE SET bytes_total = ?, updated_at = datetime('now')`,
+		 VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(user_id, month) DO UPDATE SET bytes_total = ?, updated_at = CURRENT_TIMESTAMP`,
 		userID, month, total, total,
 	)
 	if err != nil {
@@ -318,6 +379,7 @@ type RateLimiter struct {
 	limiters map[string]*ipLimiter
 	rate     rate.Limit
 	burst    int
+	rejected atomic.Int64 // requests refused since start (metrics)
 }
 
 type ipLimiter struct {
@@ -362,7 +424,16 @@ func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
 
 // Allow returns true if the request is within rate limits for the given IP.
 func (rl *RateLimiter) Allow(ip string) bool {
-	return rl.getLimiter(ip).Allow()
+	if rl.getLimiter(ip).Allow() {
+		return true
+	}
+	rl.rejected.Add(1)
+	return false
+}
+
+// Rejected returns how many requests have been refused since start.
+func (rl *RateLimiter) Rejected() int64 {
+	return rl.rejected.Load()
 }
 
 // Middleware wraps an http.Handler with rate limiting.
@@ -14,11 +14,11 @@ import (
 type EntitlementCache struct {
 	mu        sync.RWMutex
 	tiers     map[string]string // userID → tier
-	loginAddr string
+	loginAddr func() string     // current login replica
 	client    *http.Client
 }
 
-func NewEntitlementCache(loginAddr string) *EntitlementCache {
+func NewEntitlementCache(loginAddr func() string) *EntitlementCache {
 	return &EntitlementCache{
 		tiers:     make(map[string]string),
 		loginAddr: loginAddr,
@@ -57,7 +57,7 @@ func (c *EntitlementCache) StartSync(ctx context.Context, interval time.Duration
 }
 
 func (c *EntitlementCache) fetch(ctx context.Context) {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.loginAddr+"/internal/entitlements", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.loginAddr()+"/internal/entitlements", nil)
 	if err != nil {
 		return
 	}
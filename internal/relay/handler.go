@@ -137,7 +137,11 @@ func (s *Server) handleAuthToken(w http.ResponseWriter, r *http.Request) {
 	// Also store in device_tokens for backward compat with social API auth
 	s.Store.CreateDeviceToken(token, *dc.UserID, dc.DeviceID, nil)
 
-	s.Store.AppendAudit(*dc.UserID, "jwt_issued", strPtr(fmt.Sprintf("device=%s", dc.DeviceID)))
+	detail := fmt.Sprintf("device=%s ip=%s", dc.DeviceID, clientIP(r))
+	if publicKey != "" {
+		detail += " key=" + keyFingerprint(publicKey)
+	}
+	s.Store.AppendAudit(*dc.UserID, "token_issued", strPtr(detail))
 
 	tokenResp := map[string]any{
 		"token":      token,
@@ -256,7 +260,7 @@ func (s *Server) handleAuthRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID, deviceID, err := s.Store.ValidateToken(req.Token)
-	if err != nil {
+	if err != nil || s.ssoLockedID(userID) {
 		writeError(w, http.StatusUnauthorized, "invalid token")
 		return
 	}
@@ -273,7 +277,7 @@ func (s *Server) handleAuthRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.Store.AppendAudit(userID, "token_refreshed", strPtr(fmt.Sprintf("device=%s", deviceID)))
+	s.Store.AppendAudit(userID, "token_refreshed", strPtr(fmt.Sprintf("device=%s ip=%s", deviceID, clientIP(r))))
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"token":      newToken,
@@ -328,13 +332,21 @@ func (s *Server) requireToken(w http.ResponseWriter, r *http.Request) string {
 	// Try JWT first
 	if s.JWTPubKey() != nil {
 		if claims, err := ValidateWingJWT(s.JWTPubKey(), token); err == nil {
+			if s.userSuspended(r.Context(), claims.Subject) {
+				writeError(w, http.StatusForbidden, "account suspended")
+				return ""
+			}
 			return claims.Subject
 		}
 	}
 
-	// Fall back to DB token
+	// Fall back to DB token (login nodes only)
+	if s.Store == nil {
+		writeError(w, http.StatusUnauthorized, "invalid or expired token")
+		return ""
+	}
 	userID, _, err := s.Store.ValidateToken(token)
-	if err != nil {
+	if err != nil || s.ssoLockedID(userID) {
 		writeError(w, http.StatusUnauthorized, "invalid or expired token")
 		return ""
 	}
@@ -1,19 +1,27 @@
 package relay
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"io"
-	"net"
+	"log"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/ws"
 )
 
 // registerInternalRoutes adds internal API endpoints used for node-to-node communication.
-// These should only be accessible on Fly's private network (6PN).
+// They answer only calls carrying a valid node identity (see node_auth.go).
 func (s *Server) registerInternalRoutes() {
+	s.mux.HandleFunc("POST /internal/node/enroll", s.handleNodeEnroll)
 	s.mux.HandleFunc("GET /internal/status", s.withInternalAuth(s.handleInternalStatus))
+	s.mux.HandleFunc("GET /metrics", s.withMetricsAuth(s.handleMetrics))
 	s.mux.HandleFunc("GET /internal/entitlements", s.withInternalAuth(s.handleInternalEntitlements))
 	s.mux.HandleFunc("GET /internal/sessions/{token}", s.withInternalAuth(s.handleInternalSession))
+	s.mux.HandleFunc("GET /internal/api-tokens/{hash}", s.withInternalAuth(s.handleInternalAPIToken))
 	s.mux.HandleFunc("POST /internal/wing-register", s.withInternalAuth(s.handleWingRegister))
 	s.mux.HandleFunc("POST /internal/wing-deregister", s.withInternalAuth(s.handleWingDeregister))
 	s.mux.HandleFunc("GET /internal/wing-locate/{wingID}", s.withInternalAuth(s.handleWingLocate))
@@ -21,62 +29,74 @@ func (s *Server) registerInternalRoutes() {
 	s.mux.HandleFunc("GET /internal/org-check/{slug}/{userID}", s.withInternalAuth(s.handleInternalOrgCheck))
 	s.mux.HandleFunc("POST /internal/wing-event", s.withInternalAuth(s.handleInternalWingEvent))
 	s.mux.HandleFunc("GET /internal/user-orgs/{userID}", s.withInternalAuth(s.handleInternalUserOrgs))
+	s.mux.HandleFunc("GET /internal/user-status/{userID}", s.withInternalAuth(s.handleInternalUserStatus))
 	s.mux.HandleFunc("GET /internal/wings-debug", s.withInternalAuth(s.handleWingsDebug))
 	s.mux.HandleFunc("POST /internal/user-orgs-bulk", s.withInternalAuth(s.handleInternalUserOrgsBulk))
 }
 
-// withInternalAuth wraps a handler to only allow requests from Fly's internal network.
-// Checks for the Fly-Forwarded-Port header (only set on 6PN) or a shared secret.
+// withInternalAuth wraps a handler to only allow calls from other cluster
+// nodes: a client certificate from the cluster CA over the internal listener,
+// plus a node token naming the same node. The caller's identity is put in the
+// request context. A single node has no internal callers, so there the
+// routes don't exist.
 func (s *Server) withInternalAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// On Fly, internal 6PN requests have Fly-Client-IP in private range
-		// For local dev, check shared secret header
-		if s.Config.NodeRole != "" {
-			flyPort := r.Header.Get("Fly-Forwarded-Port")
-			secret := r.Header.Get("X-Internal-Secret")
-			if flyPort == "" && (s.Config.JWTKey == "" || secret != s.Config.JWTKey) {
-				// Also allow from private IPs (10.x, fdaa:, 172.16-31, 192.168)
-				ip := clientIP(r)
-				if !isPrivateIP(ip) {
-					http.Error(w, "forbidden", http.StatusForbidden)
-					return
-				}
-			}
+		if s.Config.NodeRole == "" {
+			http.NotFound(w, r)
+			return
+		}
+		id, ok := s.verifyNode(r)
+		if !ok {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
 		}
+		r = r.WithContext(context.WithValue(r.Context(), nodeIdentityKey{}, id))
 		next(w, r)
 	}
 }
 
-// privateCIDRs are the RFC 1918 / RFC 4193 private address ranges
-// plus loopback and Fly.io's 6PN (fdaa::/16).
-var privateCIDRs []*net.IPNet
-
-func init() {
-	for _, cidr := range []string{
-		"10.0.0.0/8",
-		"172.16.0.0/12",
-		"192.168.0.0/16",
-		"127.0.0.0/8",
-		"::1/128",
-		"fc00::/7",  // IPv6 ULA
-		"fdaa::/16", // Fly.io 6PN
-	} {
-		_, network, _ := net.ParseCIDR(cidr)
-		privateCIDRs = append(privateCIDRs, network)
+// withMetricsAuth lets cluster nodes, or a scraper presenting
+// WT_METRICS_TOKEN as a bearer token, read /metrics. Without a token
+// configured there is nothing for a scraper to present, so /metrics is
+// not found by anyone but cluster nodes.
+func (s *Server) withMetricsAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.Config.MetricsToken
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+			next(w, r)
+			return
+		}
+		if s.Config.NodeRole != "" {
+			if _, ok := s.verifyNode(r); ok {
+				next(w, r)
+				return
+			}
+		}
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
 	}
 }
 
-func isPrivateIP(ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false
+func (s *Server) verifyNode(r *http.Request) (NodeIdentity, bool) {
+	if s.node == nil {
+		return NodeIdentity{}, false
 	}
-	for _, network := range privateCIDRs {
-		if network.Contains(ip) {
-			return true
-		}
+	id, err := s.node.Verify(r)
+	if err != nil {
+		log.Printf("internal api: rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+		return NodeIdentity{}, false
 	}
-	return false
+	return id, true
+}
+
+// callerMachineID returns the machine ID of the node making an internal call.
+func callerMachineID(r *http.Request) string {
+	id, _ := nodeIdentityFrom(r.Context())
+	return id.MachineID
 }
 
 // handleInternalStatus returns node info and connected wing IDs.
@@ -86,12 +106,25 @@ func (s *Server) handleInternalStatus(w http.ResponseWriter, r *http.Request) {
 	for i, w := range wings {
 		wingIDs[i] = w.WingID
 	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"machine_id": s.Config.FlyMachineID,
-		"region":     s.Config.FlyRegion,
-		"role":       s.Config.NodeRole,
-		"wings":      wingIDs,
-	})
+	s.browserMu.Lock()
+	browsers := len(s.browserConns)
+	s.browserMu.Unlock()
+	routes, _ := s.PTY.Counts()
+	status := map[string]any{
+		"machine_id":          s.Config.FlyMachineID,
+		"region":              s.Config.FlyRegion,
+		"role":                s.Config.NodeRole,
+		"wings":               wingIDs,
+		"browser_connections": browsers,
+		"pty_routes":          routes,
+		"leader":              s.IsLogin() && s.IsLeader(),
+	}
+	if s.login != nil {
+		if last := s.metrics.lastLoginSync.Load(); last > 0 {
+			status["login_sync_age_seconds"] = int(time.Since(time.Unix(0, last)).Seconds())
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
 }
 
 // handleWingsDebug returns full diagnostic info about connected wings and WingMap state.
@@ -202,11 +235,16 @@ func (s *Server) handleInternalSession(w http.ResponseWriter, r *http.Request) {
 
 	token := r.PathValue("token")
 	user, err := s.Store.GetSession(token)
-	if err != nil || user == nil {
+	if err != nil || user == nil || s.ssoLocked(user) {
 		writeError(w, http.StatusUnauthorized, "invalid session")
 		return
 	}
 
+	writeJSON(w, http.StatusOK, s.sessionValidation(user))
+}
+
+// sessionValidation is what edges cache about an authenticated user.
+func (s *Server) sessionValidation(user *User) SessionValidation {
 	tier := "free"
 	if s.Store.IsUserPro(user.ID) {
 		tier = "pro"
@@ -221,14 +259,64 @@ func (s *Server) handleInternalSession(w http.ResponseWriter, r *http.Request) {
 		orgIDs = []string{}
 	}
 
-	writeJSON(w, http.StatusOK, SessionValidation{
+	return SessionValidation{
 		UserID:      user.ID,
 		DisplayName: user.DisplayName,
 		Tier:        tier,
 		OrgIDs:      orgIDs,
+	}
+}
+
+// APITokenValidation is the response from the API token validation endpoint.
+type APITokenValidation struct {
+	SessionValidation
+	TokenID    string   `json:"token_id"`
+	TokenOrgID *string  `json:"token_org_id,omitempty"`
+	Scopes     []string `json:"scopes"`
+	WingIDs    []string `json:"wing_ids,omitempty"`
+}
+
+// handleInternalAPIToken validates a personal access token by hash so edges
+// can accept it on /ws/pty (login node only).
+func (s *Server) handleInternalAPIToken(w http.ResponseWriter, r *http.Request) {
+	if s.Store == nil {
+		writeError(w, http.StatusServiceUnavailable, "no store")
+		return
+	}
+	t, err := s.Store.GetAPITokenByHash(r.PathValue("hash"))
+	if err != nil || t == nil {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	user, err := s.Store.GetUserByID(t.UserID)
+	if err != nil || user == nil || user.SuspendedAt != nil || s.ssoLocked(user) {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	writeJSON(w, http.StatusOK, APITokenValidation{
+		SessionValidation: s.sessionValidation(user),
+		TokenID:           t.ID,
+		TokenOrgID:        t.OrgID,
+		Scopes:            t.Scopes,
+		WingIDs:           t.WingIDs,
 	})
 }
 
+// handleInternalUserStatus tells edges whether a user may connect wings
+// (login node only).
+func (s *Server) handleInternalUserStatus(w http.ResponseWriter, r *http.Request) {
+	if s.Store == nil {
+		writeError(w, http.StatusServiceUnavailable, "no store")
+		return
+	}
+	user, err := s.Store.GetUserByID(r.PathValue("userID"))
+	if err != nil || user == nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"suspended": user.SuspendedAt != nil || s.ssoLocked(user)})
+}
+
 // handleWingRegister adds a wing to the global wingMap (login only).
 func (s *Server) handleWingRegister(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -244,6 +332,10 @@ func (s *Server) handleWingRegister(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if caller := callerMachineID(r); caller != "" && req.MachineID != caller {
+		writeError(w, http.StatusForbidden, "nodes may only register their own wings")
+		return
+	}
 	if s.WingMap != nil {
 		s.WingMap.Register(req.WingID, WingLocation{
 			MachineID:    req.MachineID,
@@ -310,6 +402,10 @@ func (s *Server) handleWingSync(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if caller := callerMachineID(r); caller != "" && req.MachineID != caller {
+		writeError(w, http.StatusForbidden, "nodes may only sync their own wings")
+		return
+	}
 
 	// Absorb edge bandwidth usage
 	if s.Bandwidth != nil && len(req.Bandwidth) > 0 {
@@ -376,20 +472,52 @@ func (s *Server) handleInternalWingEvent(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	var req struct {
-		Type         string `json:"type"`
-		WingID       string `json:"wing_id"`
-		UserID       string `json:"user_id"`
-		OrgID        string `json:"org_id"`
-		PublicKey    string `json:"public_key"`
-		Locked       bool   `json:"locked"`
-		AllowedCount int    `json:"allowed_count"`
-		SessionID    string `json:"session_id"`
+		Type         string         `json:"type"`
+		WingID       string         `json:"wing_id"`
+		UserID       string         `json:"user_id"`
+		OrgID        string         `json:"org_id"`
+		PublicKey    string         `json:"public_key"`
+		Locked       bool           `json:"locked"`
+		AllowedCount int            `json:"allowed_count"`
+		SessionID    string         `json:"session_id"`
+		Kind         string         `json:"kind"`
+		AuditHead    *ws.AuditHead  `json:"audit_head"`
+		Event        string         `json:"event"`
+		Data         map[string]any `json:"data"`
 	}
 	if err := json.Unmarshal(body, &req); err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	// audit.head: notarization witness, stored on the login node only
+	if req.Type == "audit.head" {
+		if req.AuditHead != nil {
+			s.saveAuditHead(req.WingID, req.UserID, *req.AuditHead)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"ok": "true"})
+		return
+	}
+
+	// webhook: an edge's event for the login node's delivery queue
+	if req.Type == "webhook" {
+		s.emitWebhook(req.Event, req.UserID, req.OrgID, req.Data)
+		writeJSON(w, http.StatusOK, map[string]string{"ok": "true"})
+		return
+	}
+
+	// wing.kick: a relay admin disconnected a wing, or all of a user's wings.
+	// A user-wide kick usually means a suspension, so the edge stops trusting
+	// its cached status for the user rather than waiting out the cache.
+	if req.Type == "wing.kick" {
+		if req.UserID != "" && s.sessionCache != nil {
+			s.sessionCache.ForgetSuspended(req.UserID)
+		}
+		s.kickWings(req.WingID, req.UserID)
+		writeJSON(w, http.StatusOK, map[string]string{"ok": "true"})
+		return
+	}
+
 	// org.changed: update subscriber org memberships + session cache
 	if req.Type == "org.changed" {
 		if s.IsEdge() && s.Config.LoginNodeAddr != "" {
@@ -404,10 +532,10 @@ func (s *Server) handleInternalWingEvent(w http.ResponseWriter, r *http.Request)
 	// Wing lifecycle event: deliver to local subscribers
 	var ev WingEvent
 	switch req.Type {
-	case "wing.offline":
+	case "wing.offline", ws.TypeWingProjects:
 		ev = WingEvent{Type: req.Type, WingID: req.WingID}
 	case "session.attention":
-		ev = WingEvent{Type: req.Type, WingID: req.WingID, SessionID: req.SessionID}
+		ev = WingEvent{Type: req.Type, WingID: req.WingID, SessionID: req.SessionID, Kind: req.Kind}
 	default:
 		locked := req.Locked
 		allowedCount := req.AllowedCount
@@ -421,6 +549,33 @@ func (s *Server) handleInternalWingEvent(w http.ResponseWriter, r *http.Request)
 	}
 	s.Wings.notifyWing(req.UserID, req.OrgID, ev)
 
+	// Rebroadcast from a login replica: the origin already queued webhooks
+	// and fanned the event out.
+	if r.Header.Get(broadcastHeader) != "" {
+		writeJSON(w, http.StatusOK, map[string]string{"ok": "true"})
+		return
+	}
+
+	// Login: queue webhooks for events that happened on an edge. The edge
+	// sends each event to one replica, so this is also where an edge wing's
+	// connection is audited; wing-register repeats for config changes, peer
+	// replication and queue flushes.
+	if s.Store != nil {
+		switch req.Type {
+		case "wing.online", "wing.offline":
+			s.emitWingWebhook(req.Type, req.WingID, req.UserID, req.OrgID)
+			if id, _ := nodeIdentityFrom(r.Context()); req.Type == "wing.online" && id.Role != "login" {
+				s.auditWingRegistered(req.UserID, req.OrgID, req.WingID, req.PublicKey, id.MachineID)
+			}
+		case "session.attention":
+			s.emitWebhook(req.Type, req.UserID, req.OrgID, map[string]any{
+				"wing_id":    req.WingID,
+				"session_id": req.SessionID,
+				"kind":       req.Kind,
+			})
+		}
+	}
+
 	// Login: re-broadcast to all edges
 	if s.IsLogin() && s.WingMap != nil {
 		go s.broadcastToEdges(body)
@@ -472,19 +627,16 @@ func (s *Server) handleInternalUserOrgsBulk(w http.ResponseWriter, r *http.Reque
 // refreshRemoteUserOrgs fetches a user's org IDs from the login node and
 // updates local subscriber org memberships.
 func (s *Server) refreshRemoteUserOrgs(userID string) {
-	client := &http.Client{Timeout: 3 * time.Second}
-	resp, err := client.Get(s.Config.LoginNodeAddr + "/internal/user-orgs/" + userID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	body, err := s.login.Get(ctx, "/internal/user-orgs/"+userID)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return
-	}
 	var result struct {
 		OrgIDs []string `json:"org_ids"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return
 	}
 	if s.Wings.UpdateUserOrgs(userID, result.OrgIDs) {
@@ -494,4 +646,5 @@ func (s *Server) refreshRemoteUserOrgs(userID string) {
 	if s.sessionCache != nil {
 		s.sessionCache.UpdateUserOrgs(userID, result.OrgIDs)
 	}
+	s.revokeWingAccess(userID, result.OrgIDs)
 }
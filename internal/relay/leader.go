@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// leaderLease is the store lease login replicas compete for. The holder runs
+// the cluster's singleton work: webhook delivery and persisting bandwidth
+// totals, which makes it the authority on monthly caps.
+const leaderLease = "login-leader"
+
+// IsLeader reports whether this node runs the cluster's singleton work. A
+// single node, or a login node not taking part in an election, always does;
+// edges never do.
+func (s *Server) IsLeader() bool {
+	if s.IsEdge() {
+		return false
+	}
+	if s.IsLogin() && s.electing.Load() {
+		return s.leader.Load()
+	}
+	return true
+}
+
+// StartLeaderElection competes for the leader lease every interval. The
+// lease outlives three missed renewals, so a dead leader is replaced within
+// about 3×interval. Replicas share the store, so it refuses anything but
+// PostgreSQL (WT_DATABASE_URL): a lease in a per-machine SQLite file would
+// make every replica leader.
+func (s *Server) StartLeaderElection(ctx context.Context, interval time.Duration) error {
+	if s.Store == nil || s.Store.Dialect() != "postgres" {
+		return fmt.Errorf("leader election needs a shared PostgreSQL store (WT_DATABASE_URL)")
+	}
+	holder := s.Config.FlyMachineID
+	if holder == "" {
+		holder = uuid.NewString()
+	}
+	ttl := 3 * interval
+	s.electing.Store(true)
+
+	elect := func() {
+		ok, err := s.Store.AcquireLease(leaderLease, holder, ttl)
+		if err != nil {
+			log.Printf("leader election: %v", err)
+			ok = false
+		}
+		was := s.leader.Swap(ok)
+		switch {
+		case ok && !was:
+			log.Printf("leader election: %s is now leader", holder)
+			if s.Bandwidth != nil {
+				s.Bandwidth.Reseed()
+			}
+			s.pokeWebhooks()
+		case !ok && was:
+			log.Printf("leader election: %s lost leadership", holder)
+			if s.Bandwidth != nil {
+				// Followers report deltas to the leader, so the totals held
+				// here must go; the new leader reseeded from the DB.
+				s.Bandwidth.DrainCounters()
+			}
+		}
+	}
+	elect()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if s.leader.Swap(false) {
+					s.Store.ReleaseLease(leaderLease, holder)
+				}
+				return
+			case <-ticker.C:
+				elect()
+			}
+		}
+	}()
+	return nil
+}
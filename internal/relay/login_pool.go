@@ -0,0 +1,388 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginPool tracks the login replicas a node talks to. Lookups go to the
+// primary — the elected leader while it answers, otherwise any healthy
+// replica — and wing state is replicated to every replica. Login replicas use
+// a pool to reach their peers. Seeds are re-resolved through DNS on every
+// refresh, so one name covering all login machines is enough.
+type LoginPool struct {
+	seeds  []string
+	self   string // this node's machine ID; never its own peer
+	client *http.Client
+
+	mu       sync.RWMutex
+	replicas []*loginReplica
+
+	outboxMu  sync.Mutex
+	outbox    []outboxItem
+	outboxSeq int64
+	flushMu   sync.Mutex
+}
+
+type loginReplica struct {
+	addr      string
+	machineID string
+	leader    bool
+	down      bool
+}
+
+// outboxItem is a request held back while no login replica answers.
+type outboxItem struct {
+	seq    int64
+	path   string
+	body   []byte
+	fanout bool // send to every replica, not just the primary
+}
+
+// loginOutboxMax bounds the requests queued during a login outage. The
+// oldest are dropped first; the next full sync restores wing state anyway.
+const loginOutboxMax = 1000
+
+// errLoginUnavailable means no login replica could be reached. Anything else
+// is a replica rejecting the request.
+var errLoginUnavailable = errors.New("login unavailable")
+
+// ParseLoginAddrs splits a comma-separated WT_LOGIN_ADDR value.
+func ParseLoginAddrs(s string) []string {
+	var addrs []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimRight(strings.TrimSpace(a), "/"); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// NewLoginPool creates a pool over the given seed addresses. selfMachineID
+// keeps a login replica from counting itself as a peer.
+func NewLoginPool(addrs []string, selfMachineID string) *LoginPool {
+	p := &LoginPool{
+		seeds:  addrs,
+		self:   selfMachineID,
+		client: &http.Client{Timeout: 3 * time.Second},
+	}
+	for _, a := range addrs {
+		p.replicas = append(p.replicas, &loginReplica{addr: a})
+	}
+	return p
+}
+
+// Primary returns the replica to send the next request to. With every
+// replica down it still returns one, so requests keep probing for recovery.
+func (p *LoginPool) Primary() string {
+	addrs := p.Addrs()
+	if len(addrs) == 0 {
+		return ""
+	}
+	return addrs[0]
+}
+
+// Leader returns the healthy replica that last reported holding the leader
+// lease, or "" if none did.
+func (p *LoginPool) Leader() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, r := range p.replicas {
+		if r.leader && !r.down {
+			return r.addr
+		}
+	}
+	return ""
+}
+
+// Addrs returns every known replica: the leader first, then other healthy
+// replicas, then the ones marked down.
+func (p *LoginPool) Addrs() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var leader, healthy, down []string
+	for _, r := range p.replicas {
+		switch {
+		case r.down:
+			down = append(down, r.addr)
+		case r.leader:
+			leader = append(leader, r.addr)
+		default:
+			healthy = append(healthy, r.addr)
+		}
+	}
+	return append(append(leader, healthy...), down...)
+}
+
+// Up returns how many replicas are not marked down.
+func (p *LoginPool) Up() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n := 0
+	for _, r := range p.replicas {
+		if !r.down {
+			n++
+		}
+	}
+	return n
+}
+
+// MarkDown records that a request to addr failed. Primary skips it until a
+// refresh or a successful request brings it back.
+func (p *LoginPool) MarkDown(addr string) {
+	p.setDown(addr, true)
+}
+
+func (p *LoginPool) setDown(addr string, down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.replicas {
+		if r.addr == addr {
+			if down && !r.down {
+				log.Printf("login pool: %s unreachable", addr)
+			}
+			r.down = down
+			if down {
+				r.leader = false
+			}
+		}
+	}
+}
+
+// Start refreshes the replica list immediately and then every interval.
+func (p *LoginPool) Start(ctx context.Context, interval time.Duration) {
+	p.Refresh(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.Refresh(ctx)
+			}
+		}
+	}()
+}
+
+// Refresh resolves the seeds and probes each replica's /internal/status to
+// learn its health and which one is leader.
+func (p *LoginPool) Refresh(ctx context.Context) {
+	addrs := p.resolve(ctx)
+	next := make([]*loginReplica, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &loginReplica{addr: addr, down: true}
+			body, err := p.do(ctx, "GET", addr, "/internal/status", nil)
+			if err == nil {
+				var status struct {
+					MachineID string `json:"machine_id"`
+					Leader    bool   `json:"leader"`
+				}
+				if json.Unmarshal(body, &status) == nil {
+					r.machineID, r.leader, r.down = status.MachineID, status.Leader, false
+				}
+			}
+			next[i] = r
+		}()
+	}
+	wg.Wait()
+
+	replicas := next[:0]
+	for _, r := range next {
+		if p.self != "" && r.machineID == p.self {
+			continue
+		}
+		replicas = append(replicas, r)
+	}
+	p.mu.Lock()
+	p.replicas = replicas
+	p.mu.Unlock()
+}
+
+// resolve expands each seed to one address per IP its host resolves to.
+// Seeds that are already IPs, or that don't resolve, are kept as given.
+func (p *LoginPool) resolve(ctx context.Context) []string {
+	seen := make(map[string]bool)
+	var addrs []string
+	add := func(a string) {
+		if !seen[a] {
+			seen[a] = true
+			addrs = append(addrs, a)
+		}
+	}
+	for _, seed := range p.seeds {
+		u, err := url.Parse(seed)
+		if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+			add(seed)
+			continue
+		}
+		lookupCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		ips, err := net.DefaultResolver.LookupHost(lookupCtx, u.Hostname())
+		cancel()
+		if err != nil || len(ips) == 0 {
+			add(seed)
+			continue
+		}
+		for _, ip := range ips {
+			host := ip
+			if port := u.Port(); port != "" {
+				host = net.JoinHostPort(ip, port)
+			} else if strings.Contains(ip, ":") {
+				host = "[" + ip + "]"
+			}
+			ru := *u
+			ru.Host = host
+			add(ru.String())
+		}
+	}
+	return addrs
+}
+
+// do sends one request to addr. Transport errors and 5xx responses mark the
+// replica down and return errLoginUnavailable.
+func (p *LoginPool) do(ctx context.Context, method, addr, path string, body []byte) ([]byte, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, addr+path, rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.MarkDown(addr)
+		return nil, fmt.Errorf("%w: %v", errLoginUnavailable, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		p.MarkDown(addr)
+		return nil, fmt.Errorf("%w: %v", errLoginUnavailable, err)
+	}
+	if resp.StatusCode >= 500 {
+		p.MarkDown(addr)
+		return nil, fmt.Errorf("%w: %s status %d", errLoginUnavailable, addr, resp.StatusCode)
+	}
+	p.setDown(addr, false)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s%s: status %d", addr, path, resp.StatusCode)
+	}
+	return data, nil
+}
+
+// Get fetches path from the primary, failing over to the other replicas.
+func (p *LoginPool) Get(ctx context.Context, path string) ([]byte, error) {
+	return p.failover(ctx, "GET", path, nil)
+}
+
+// Post sends body to path on the primary, failing over to the other replicas.
+func (p *LoginPool) Post(ctx context.Context, path string, body []byte) error {
+	_, err := p.failover(ctx, "POST", path, body)
+	return err
+}
+
+func (p *LoginPool) failover(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	err := errLoginUnavailable
+	for _, addr := range p.Addrs() {
+		var data []byte
+		data, err = p.do(ctx, method, addr, path, body)
+		if !errors.Is(err, errLoginUnavailable) {
+			return data, err
+		}
+	}
+	return nil, err
+}
+
+// PostAll sends body to path on every replica and returns how many accepted it.
+func (p *LoginPool) PostAll(ctx context.Context, path string, body []byte) int {
+	addrs := p.Addrs()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ok := 0
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.do(ctx, "POST", addr, path, body); err == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return ok
+}
+
+// Queue holds a request until a login replica answers again.
+func (p *LoginPool) Queue(path string, body []byte, fanout bool) {
+	p.outboxMu.Lock()
+	defer p.outboxMu.Unlock()
+	if len(p.outbox) >= loginOutboxMax {
+		p.outbox = p.outbox[1:]
+	}
+	p.outboxSeq++
+	p.outbox = append(p.outbox, outboxItem{seq: p.outboxSeq, path: path, body: body, fanout: fanout})
+}
+
+// Queued returns the number of requests waiting for a login replica.
+func (p *LoginPool) Queued() int {
+	p.outboxMu.Lock()
+	defer p.outboxMu.Unlock()
+	return len(p.outbox)
+}
+
+// Flush sends queued requests in order, stopping at the first one no replica
+// answers. Requests a replica rejects are dropped.
+func (p *LoginPool) Flush(ctx context.Context) {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+	p.outboxMu.Lock()
+	pending := append([]outboxItem(nil), p.outbox...)
+	p.outboxMu.Unlock()
+
+	var sent int
+	var last int64
+	for _, item := range pending {
+		if item.fanout {
+			if p.PostAll(ctx, item.path, item.body) == 0 {
+				break
+			}
+		} else if err := p.Post(ctx, item.path, item.body); errors.Is(err, errLoginUnavailable) {
+			break
+		}
+		sent++
+		last = item.seq
+	}
+	if sent == 0 {
+		return
+	}
+	log.Printf("login pool: flushed %d queued requests", sent)
+	p.outboxMu.Lock()
+	i := 0
+	for i < len(p.outbox) && p.outbox[i].seq <= last {
+		i++
+	}
+	p.outbox = p.outbox[i:]
+	p.outboxMu.Unlock()
+}
@@ -0,0 +1,264 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLogin answers /internal/status as a login replica and counts the
+// other requests it gets.
+func fakeLogin(t *testing.T, machineID string, leader bool) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var hits atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal/status" {
+			writeJSON(w, http.StatusOK, map[string]any{"machine_id": machineID, "leader": leader})
+			return
+		}
+		hits.Add(1)
+		writeJSON(w, http.StatusOK, map[string]any{"machine_id": "m-edge", "found": true})
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &hits
+}
+
+func TestLoginPoolFailover(t *testing.T) {
+	follower, followerHits := fakeLogin(t, "login-b", false)
+	leader, leaderHits := fakeLogin(t, "login-a", true)
+	self, _ := fakeLogin(t, "login-c", false)
+
+	pool := NewLoginPool([]string{follower.URL, leader.URL, self.URL}, "login-c")
+	pool.Refresh(context.Background())
+	if got := pool.Addrs(); len(got) != 2 {
+		t.Fatalf("addrs = %v, want self skipped", got)
+	}
+	if pool.Primary() != leader.URL || pool.Leader() != leader.URL {
+		t.Fatalf("primary = %s, want leader %s", pool.Primary(), leader.URL)
+	}
+
+	ctx := context.Background()
+	if _, err := pool.Get(ctx, "/internal/wing-locate/w1"); err != nil || leaderHits.Load() != 1 {
+		t.Fatalf("get: %v, leader hits %d", err, leaderHits.Load())
+	}
+
+	// Leader dies: the request fails over and the pool stops preferring it
+	leader.Close()
+	if _, err := pool.Get(ctx, "/internal/wing-locate/w1"); err != nil || followerHits.Load() != 1 {
+		t.Fatalf("failover get: %v, follower hits %d", err, followerHits.Load())
+	}
+	if pool.Primary() != follower.URL || pool.Leader() != "" || pool.Up() != 1 {
+		t.Errorf("primary = %s leader = %q up = %d", pool.Primary(), pool.Leader(), pool.Up())
+	}
+	if n := pool.PostAll(ctx, "/internal/wing-register", []byte(`{}`)); n != 1 {
+		t.Errorf("PostAll reached %d replicas, want 1", n)
+	}
+}
+
+func TestLoginPoolOutbox(t *testing.T) {
+	var up atomic.Bool
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		got = append(got, r.URL.Path)
+		writeJSON(w, http.StatusOK, map[string]string{"ok": "true"})
+	}))
+	defer ts.Close()
+
+	srv := NewServer(nil, ServerConfig{NodeRole: "edge", FlyMachineID: "edge-1", LoginNodeAddr: ts.URL})
+	wing := &ConnectedWing{WingID: "w1", UserID: "u1"}
+	srv.registerWingWithLogin(wing)
+	srv.forwardPayloadToLogin([]byte(`{"type":"wing.online","wing_id":"w1"}`))
+	if n := srv.login.Queued(); n != 2 {
+		t.Fatalf("queued = %d, want 2", n)
+	}
+
+	// Still down: nothing leaves the outbox
+	srv.login.Flush(context.Background())
+	if n := srv.login.Queued(); n != 2 {
+		t.Fatalf("queued after failed flush = %d", n)
+	}
+
+	up.Store(true)
+	srv.edgeSync(context.Background())
+	if n := srv.login.Queued(); n != 0 {
+		t.Fatalf("queued after sync = %d", n)
+	}
+	want := []string{"/internal/wing-sync", "/internal/wing-register", "/internal/wing-event"}
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	s := testStore(t)
+	if ok, err := s.AcquireLease("leader", "a", time.Minute); err != nil || !ok {
+		t.Fatalf("a acquire: %v %v", ok, err)
+	}
+	if ok, _ := s.AcquireLease("leader", "b", time.Minute); ok {
+		t.Fatal("b took a live lease")
+	}
+	if ok, _ := s.AcquireLease("leader", "a", time.Minute); !ok {
+		t.Fatal("a could not renew")
+	}
+
+	// Expired leases go to whoever asks next
+	s.DB().Exec("UPDATE leases SET expires_at = '2000-01-01 00:00:00'")
+	if holder, _ := s.LeaseHolder("leader"); holder != "" {
+		t.Errorf("expired lease still held by %q", holder)
+	}
+	if ok, _ := s.AcquireLease("leader", "b", time.Minute); !ok {
+		t.Fatal("b could not take an expired lease")
+	}
+	s.ReleaseLease("leader", "a") // no longer a's to release
+	if holder, _ := s.LeaseHolder("leader"); holder != "b" {
+		t.Errorf("holder = %q, want b", holder)
+	}
+
+	// Expiry follows the database clock at sub-second resolution
+	if ok, _ := s.AcquireLease("short", "a", 300*time.Millisecond); !ok {
+		t.Fatal("a could not take a short lease")
+	}
+	if ok, _ := s.AcquireLease("short", "b", time.Minute); ok {
+		t.Fatal("b took a live short lease")
+	}
+	time.Sleep(500 * time.Millisecond)
+	if ok, _ := s.AcquireLease("short", "b", time.Minute); !ok {
+		t.Error("short lease outlived its ttl")
+	}
+}
+
+func TestLeaderElectionNeedsPostgres(t *testing.T) {
+	srv := NewServer(testStore(t), ServerConfig{NodeRole: "login", FlyMachineID: "login-a"})
+	err := srv.StartLeaderElection(context.Background(), time.Second)
+	if srv.Store.Dialect() == "postgres" {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), "PostgreSQL") {
+		t.Errorf("election on SQLite: %v", err)
+	}
+}
+
+func TestLeaderElectionHandover(t *testing.T) {
+	dsn := os.Getenv("WT_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("WT_TEST_POSTGRES_DSN not set")
+	}
+	dsn = pgTestDSN(t, dsn)
+	open := func(machine string) *Server {
+		store, err := OpenRelay(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		srv := NewServer(store, ServerConfig{NodeRole: "login", FlyMachineID: machine})
+		srv.Bandwidth = NewBandwidthMeter(SustainedRate, 1<<20, store.DB())
+		return srv
+	}
+	a, b := open("login-a"), open("login-b")
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	if err := a.StartLeaderElection(ctxA, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	if err := b.StartLeaderElection(ctxB, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("leaders: a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	// The leader's totals are in the DB when b takes over
+	a.Store.DB().Exec("INSERT INTO bandwidth_log (user_id, month, bytes_total) VALUES ('u1', ?, 500)", currentMonth())
+	b.Bandwidth.AddUsage("u1", 20) // reported by an edge before the handover
+
+	stopA()
+	deadline := time.Now().Add(3 * time.Second)
+	for !b.IsLeader() && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !b.IsLeader() || a.IsLeader() {
+		t.Fatalf("after handover: a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+	if got := b.Bandwidth.MonthlyUsage("u1"); got != 520 {
+		t.Errorf("b usage = %d, want DB total plus pending 520", got)
+	}
+}
+
+func TestEdgeServesStaleDuringLoginOutage(t *testing.T) {
+	var down atomic.Bool
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		switch r.URL.Path {
+		case "/internal/sessions/tok":
+			writeJSON(w, http.StatusOK, SessionValidation{UserID: "u1"})
+		case "/internal/api-tokens/hash":
+			writeJSON(w, http.StatusOK, APITokenValidation{SessionValidation: SessionValidation{UserID: "u1"}, TokenID: "t1"})
+		case "/internal/wing-locate/w1":
+			writeJSON(w, http.StatusOK, map[string]any{"machine_id": "edge-2", "found": true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer login.Close()
+
+	srv := NewServer(nil, ServerConfig{NodeRole: "edge", FlyMachineID: "edge-1", LoginNodeAddr: login.URL})
+	srv.sessionCache = NewSessionCache()
+	if u := srv.sessionCache.Validate("tok", srv.login); u == nil {
+		t.Fatal("session not validated")
+	}
+	if m, ok := srv.locateWing("w1"); !ok || m != "edge-2" {
+		t.Fatalf("locate = %q %v", m, ok)
+	}
+
+	if u, _ := srv.sessionCache.ValidateAPIToken("hash", srv.login); u == nil {
+		t.Fatal("api token not validated")
+	}
+
+	// Login goes away after the cache TTL: known sessions and wings keep working
+	down.Store(true)
+	srv.sessionCache.entries["tok"].fetchedAt = time.Now().Add(-sessionCacheTTL - time.Minute)
+	if u := srv.sessionCache.Validate("tok", srv.login); u == nil || u.ID != "u1" {
+		t.Errorf("stale session = %+v", u)
+	}
+	// ...for a few minutes, not indefinitely; tokens never go stale
+	srv.sessionCache.entries["tok"].fetchedAt = time.Now().Add(-sessionStaleTTL)
+	if u := srv.sessionCache.Validate("tok", srv.login); u != nil {
+		t.Errorf("session served past the stale window: %+v", u)
+	}
+	srv.sessionCache.apiTokens["hash"].fetchedAt = time.Now().Add(-2 * apiTokenCacheTTL)
+	if u, _ := srv.sessionCache.ValidateAPIToken("hash", srv.login); u != nil {
+		t.Errorf("stale api token = %+v", u)
+	}
+	if u := srv.sessionCache.Validate("other", srv.login); u != nil {
+		t.Errorf("unknown session validated during outage: %+v", u)
+	}
+	if m, ok := srv.locateWing("w1"); !ok || m != "edge-2" {
+		t.Errorf("stale locate = %q %v", m, ok)
+	}
+	if _, ok := srv.locateWing("w2"); ok {
+		t.Error("unknown wing located during outage")
+	}
+}
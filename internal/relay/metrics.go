@@ -0,0 +1,200 @@
+package relay
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// relayMetrics holds the counters /metrics reports that can't be read off
+// live state. The zero value is ready to use.
+type relayMetrics struct {
+	tunnelRequests    atomic.Int64 // tunnel requests forwarded to wings
+	tunnelDuration    latencyHistogram
+	lastLoginSync     atomic.Int64 // unix nanos of the last wing-sync any login replica took
+	loginSyncFailures atomic.Int64 // wing-syncs no login replica took
+}
+
+// tunnelBuckets are the upper bounds, in seconds, of the tunnel latency
+// histogram: the time a wing takes to start answering a tunnel request.
+// Long-lived streams (forwarded WebSockets) are not timed.
+var tunnelBuckets = [...]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// latencyHistogram is a Prometheus histogram over tunnelBuckets.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	counts [len(tunnelBuckets)]uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (h *latencyHistogram) observe(seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += seconds
+	for i, le := range tunnelBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// metricsWriter renders the Prometheus text exposition format.
+type metricsWriter struct {
+	b strings.Builder
+}
+
+func (m *metricsWriter) family(name, typ, help string) {
+	m.b.WriteString("# HELP " + name + " " + help + "\n")
+	m.b.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one line; labels are name/value pairs.
+func (m *metricsWriter) sample(name string, v float64, labels ...string) {
+	m.b.WriteString(name)
+	if len(labels) > 0 {
+		m.b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.b.WriteByte(',')
+			}
+			m.b.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		m.b.WriteByte('}')
+	}
+	m.b.WriteByte(' ')
+	m.b.WriteString(formatMetric(v))
+	m.b.WriteByte('\n')
+}
+
+func (m *metricsWriter) gauge(name, help string, v float64) {
+	m.family(name, "gauge", help)
+	m.sample(name, v)
+}
+
+func (m *metricsWriter) counter(name, help string, v int64) {
+	m.family(name, "counter", help)
+	m.sample(name, float64(v))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatMetric(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// handleMetrics exports relay health in the Prometheus text format. Every
+// node reports its own view; cluster-wide figures (wing map, bandwidth
+// totals) come from the login node. GET /metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var m metricsWriter
+	now := time.Now()
+
+	role := s.Config.NodeRole
+	if role == "" {
+		role = "single"
+	}
+	m.family("wingthing_node_info", "gauge", "Node identity; always 1.")
+	m.sample("wingthing_node_info", 1, "role", role, "machine_id", s.Config.FlyMachineID, "region", s.Config.FlyRegion)
+
+	m.gauge("wingthing_wings_connected", "Wings connected to this node.", float64(len(s.Wings.All())))
+	s.browserMu.Lock()
+	browsers := len(s.browserConns)
+	s.browserMu.Unlock()
+	m.gauge("wingthing_browser_connections", "Browser WebSockets open on this node.", float64(browsers))
+	routes, viewers := s.PTY.Counts()
+	m.gauge("wingthing_pty_routes", "Terminal sessions routed through this node.", float64(routes))
+	m.gauge("wingthing_pty_viewers", "Spectators attached to routed terminal sessions.", float64(viewers))
+
+	// Tunnel requests
+	s.tunnelMu.Lock()
+	inflight := 0
+	for _, route := range s.tunnelRequests {
+		if !route.sent.IsZero() {
+			inflight++
+		}
+	}
+	s.tunnelMu.Unlock()
+	m.counter("wingthing_tunnel_requests_total", "Tunnel requests forwarded to wings.", s.metrics.tunnelRequests.Load())
+	m.gauge("wingthing_tunnel_requests_inflight", "Tunnel requests waiting on a wing.", float64(inflight))
+	h := &s.metrics.tunnelDuration
+	h.mu.Lock()
+	m.family("wingthing_tunnel_request_duration_seconds", "histogram", "Time from forwarding a tunnel request to the wing's first response.")
+	var cum uint64
+	for i, le := range tunnelBuckets {
+		cum += h.counts[i]
+		m.sample("wingthing_tunnel_request_duration_seconds_bucket", float64(cum), "le", formatMetric(le))
+	}
+	m.sample("wingthing_tunnel_request_duration_seconds_bucket", float64(h.count), "le", "+Inf")
+	m.sample("wingthing_tunnel_request_duration_seconds_sum", h.sum)
+	m.sample("wingthing_tunnel_request_duration_seconds_count", float64(h.count))
+	h.mu.Unlock()
+
+	if s.RateLimit != nil {
+		m.counter("wingthing_rate_limit_rejections_total", "Requests refused by the per-IP rate limiter.", s.RateLimit.Rejected())
+	}
+
+	// Edges drain their bandwidth counters to login, so only login has totals
+	if s.Bandwidth != nil && !s.IsEdge() {
+		totals := s.Bandwidth.TierTotals()
+		m.family("wingthing_bandwidth_month_bytes", "gauge", "Relayed bytes this month, by tier.")
+		for _, tier := range sortedKeys(totals) {
+			m.sample("wingthing_bandwidth_month_bytes", float64(totals[tier]), "tier", tier)
+		}
+		m.gauge("wingthing_bandwidth_exceeded_users", "Free-tier users over the monthly bandwidth cap.", float64(len(s.Bandwidth.ExceededUsers())))
+	}
+
+	if s.sessionCache != nil {
+		m.family("wingthing_session_cache_requests_total", "counter", "Session validations on this edge, by cache result.")
+		m.sample("wingthing_session_cache_requests_total", float64(s.sessionCache.hits.Load()), "result", "hit")
+		m.sample("wingthing_session_cache_requests_total", float64(s.sessionCache.misses.Load()), "result", "miss")
+	}
+
+	// Edge↔login sync lag, from both ends
+	if s.WingMap != nil {
+		m.gauge("wingthing_cluster_wings", "Wings in the cluster-wide wing map.", float64(len(s.WingMap.All())))
+		seen := s.WingMap.EdgeLastSeen()
+		m.family("wingthing_edge_sync_age_seconds", "gauge", "Seconds since each edge last synced its wings.")
+		for _, id := range sortedKeys(seen) {
+			m.sample("wingthing_edge_sync_age_seconds", now.Sub(seen[id]).Seconds(), "machine_id", id)
+		}
+	}
+	if s.login != nil {
+		if last := s.metrics.lastLoginSync.Load(); last > 0 {
+			m.gauge("wingthing_login_sync_age_seconds", "Seconds since this node last synced with a login replica.", now.Sub(time.Unix(0, last)).Seconds())
+		}
+		m.counter("wingthing_login_sync_failures_total", "Wing syncs that no login replica took.", s.metrics.loginSyncFailures.Load())
+		m.gauge("wingthing_login_replicas_up", "Login replicas answering this node.", float64(s.login.Up()))
+		m.gauge("wingthing_login_outbox", "Requests queued while no login replica answered.", float64(s.login.Queued()))
+	}
+	if s.IsLogin() {
+		leader := 0.0
+		if s.IsLeader() {
+			leader = 1
+		}
+		m.gauge("wingthing_login_leader", "1 if this login replica holds the leader lease.", leader)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	io.WriteString(w, m.b.String())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,160 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getMetrics(t *testing.T, ts *httptest.Server, header map[string]string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", ts.URL+"/metrics", nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestMetrics(t *testing.T) {
+	store := testStore(t)
+	srv := NewServer(store, ServerConfig{NodeRole: "login", FlyMachineID: "m-login", MetricsToken: "scrape"})
+	srv.WingMap = NewWingMap()
+	srv.RateLimit = NewRateLimiter(0.001, 1)
+	srv.Bandwidth = NewBandwidthMeter(1<<20, 1<<20, nil)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	srv.Wings.Add(&ConnectedWing{ID: "conn-a", UserID: "u1", WingID: "wing-a"})
+	srv.WingMap.Register("wing-a", WingLocation{MachineID: "m-edge", UserID: "u1"})
+	srv.RateLimit.Allow("203.0.113.9")
+	srv.RateLimit.Allow("203.0.113.9")
+	srv.Bandwidth.AddUsage("u1", 4096)
+
+	// A tunnel request answered after ~0.2s lands in the 0.25 bucket
+	srv.tunnelMu.Lock()
+	srv.tunnelRequests["req-1"] = &tunnelRoute{sent: time.Now().Add(-200 * time.Millisecond)}
+	srv.tunnelMu.Unlock()
+	srv.metrics.tunnelRequests.Add(1)
+	srv.forwardTunnelToBrowser("req-1", nil, false)
+	srv.forwardTunnelToBrowser("req-1", nil, true)
+
+	scraper := map[string]string{"Authorization": "Bearer scrape"}
+	code, body := getMetrics(t, ts, scraper)
+	if code != http.StatusOK {
+		t.Fatalf("metrics: %d %s", code, body)
+	}
+	for _, want := range []string{
+		`wingthing_node_info{role="login",machine_id="m-login",region=""} 1`,
+		"wingthing_wings_connected 1",
+		"wingthing_cluster_wings 1",
+		`wingthing_edge_sync_age_seconds{machine_id="m-edge"} `,
+		"wingthing_rate_limit_rejections_total 1",
+		`wingthing_bandwidth_month_bytes{tier="free"} 4096`,
+		"wingthing_tunnel_requests_total 1",
+		"wingthing_tunnel_requests_inflight 0",
+		`wingthing_tunnel_request_duration_seconds_bucket{le="0.1"} 0`,
+		`wingthing_tunnel_request_duration_seconds_bucket{le="0.25"} 1`,
+		`wingthing_tunnel_request_duration_seconds_bucket{le="+Inf"} 1`,
+		"# TYPE wingthing_tunnel_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+
+	// Cluster nodes refuse callers without the metrics token or a node
+	// identity, private addresses included
+	if code, _ := getMetrics(t, ts, map[string]string{"Fly-Client-IP": "203.0.113.9"}); code != http.StatusForbidden {
+		t.Errorf("public caller: %d, want 403", code)
+	}
+	if code, _ := getMetrics(t, ts, nil); code != http.StatusForbidden {
+		t.Errorf("loopback caller without token: %d, want 403", code)
+	}
+	if code, _ := getMetrics(t, ts, map[string]string{"Authorization": "Bearer wrong"}); code != http.StatusForbidden {
+		t.Errorf("wrong token: %d, want 403", code)
+	}
+}
+
+func TestTunnelRequestsForgotten(t *testing.T) {
+	srv := NewServer(nil, ServerConfig{})
+	unanswered := &tunnelRoute{wingConn: "conn-a", sent: time.Now()}
+	answered := &tunnelRoute{wingConn: "conn-a"}
+	stream := &tunnelRoute{wingConn: "conn-b"}
+	srv.tunnelRequests["req-1"] = unanswered
+	srv.tunnelRequests["req-2"] = answered
+	srv.tunnelRequests["req-3"] = stream
+
+	// Timing out only drops requests the wing never started answering
+	srv.expireTunnelRequest("req-1", unanswered)
+	srv.expireTunnelRequest("req-2", answered)
+	if _, ok := srv.tunnelRequests["req-1"]; ok {
+		t.Error("unanswered request survived its timeout")
+	}
+	if _, ok := srv.tunnelRequests["req-2"]; !ok {
+		t.Error("answered stream dropped by the timeout")
+	}
+
+	// A wing disconnecting drops everything sent to it
+	srv.dropTunnelRequests("conn-a")
+	if _, ok := srv.tunnelRequests["req-2"]; ok {
+		t.Error("request to a disconnected wing survived")
+	}
+	if _, ok := srv.tunnelRequests["req-3"]; !ok {
+		t.Error("request to another wing dropped")
+	}
+}
+
+func TestMetricsSingleNode(t *testing.T) {
+	srv, ts := testServer(t)
+	if code, _ := getMetrics(t, ts, nil); code != http.StatusNotFound {
+		t.Errorf("no token configured: %d, want 404", code)
+	}
+
+	srv.Config.MetricsToken = "scrape"
+	if code, _ := getMetrics(t, ts, nil); code != http.StatusForbidden {
+		t.Errorf("without token: %d, want 403", code)
+	}
+	if code, _ := getMetrics(t, ts, map[string]string{"Authorization": "Bearer scrape"}); code != http.StatusOK {
+		t.Errorf("with token: %d, want 200", code)
+	}
+}
+
+func TestMetricsEdgeSessionCache(t *testing.T) {
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, SessionValidation{UserID: "u1"})
+	}))
+	defer login.Close()
+
+	srv := NewServer(nil, ServerConfig{NodeRole: "edge", LoginNodeAddr: login.URL, MetricsToken: "scrape"})
+	srv.sessionCache = NewSessionCache()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	srv.sessionCache.Validate("tok", srv.login)
+	srv.sessionCache.Validate("tok", srv.login)
+	srv.metrics.lastLoginSync.Store(time.Now().UnixNano())
+
+	_, body := getMetrics(t, ts, map[string]string{"Authorization": "Bearer scrape"})
+	for _, want := range []string{
+		`wingthing_session_cache_requests_total{result="hit"} 1`,
+		`wingthing_session_cache_requests_total{result="miss"} 1`,
+		"wingthing_login_sync_age_seconds ",
+		"wingthing_login_sync_failures_total 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "wingthing_bandwidth_month_bytes") {
+		t.Error("edge should not report bandwidth totals")
+	}
+}
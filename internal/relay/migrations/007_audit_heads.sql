@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_heads (
+    wing_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    head TEXT NOT NULL,
+    signed_at INTEGER NOT NULL,
+    sig TEXT NOT NULL,
+    signer_key TEXT NOT NULL,
+    sealed INTEGER DEFAULT 0,
+    received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (wing_id, session_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE scim_users ADD COLUMN pending INTEGER NOT NULL DEFAULT 0;
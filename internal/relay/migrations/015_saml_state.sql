@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS saml_requests (
+    id TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS saml_tickets (
+    ticket_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    identity TEXT NOT NULL,
+    expires_at DATETIME NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Drop UNIQUE constraint on orgs.slug (allow duplicate org names across users).
+ALTER TABLE orgs DROP CONSTRAINT IF EXISTS orgs_slug_key;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_heads (
+    wing_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    seq BIGINT NOT NULL,
+    head TEXT NOT NULL,
+    signed_at BIGINT NOT NULL,
+    sig TEXT NOT NULL,
+    signer_key TEXT NOT NULL,
+    sealed INTEGER DEFAULT 0,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (wing_id, session_id)
+);
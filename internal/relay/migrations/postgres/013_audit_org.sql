@@ -0,0 +1,3 @@
+ALTER TABLE audit_log ADD COLUMN org_id TEXT;
+CREATE INDEX idx_audit_log_user ON audit_log(user_id, id);
+CREATE INDEX idx_audit_log_org ON audit_log(org_id, id);
@@ -0,0 +1,664 @@
+package relay
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Node identity for node-to-node calls. The login node keeps an internal CA
+// in relay_config. Every cluster node holds a short-lived certificate from it,
+// used for mutual TLS on the internal listener, and a short-lived node token
+// signed by the CA key, sent as X-Node-Token. Internal endpoints accept a call
+// only when both are valid and name the same node. Edges enroll with the login
+// node, proving cluster membership with a JWT signed by WT_JWT_KEY.
+
+const (
+	nodeCertTTL     = time.Hour
+	nodeTokenTTL    = 15 * time.Minute
+	nodeRenewEvery  = 10 * time.Minute // well inside the token's life
+	nodeTokenHeader = "X-Node-Token"
+	nodeCAConfigKey = "node_ca"
+	nodeURIScheme   = "wingthing-node"
+
+	nodeTokenAudience    = "wingthing-internal"
+	nodeEnrollAudience   = "wingthing-enroll"
+	nodeEnrolledAudience = "wingthing-enrolled"
+)
+
+// NodeIdentity names a cluster node.
+type NodeIdentity struct {
+	MachineID string
+	Role      string // "login" or "edge"
+}
+
+func (id NodeIdentity) String() string { return id.Role + "/" + id.MachineID }
+
+func (id NodeIdentity) uri() *url.URL {
+	return &url.URL{Scheme: nodeURIScheme, Host: id.Role, Path: "/" + id.MachineID}
+}
+
+func identityFromCert(cert *x509.Certificate) (NodeIdentity, bool) {
+	for _, u := range cert.URIs {
+		if u.Scheme == nodeURIScheme {
+			return NodeIdentity{Role: u.Host, MachineID: strings.TrimPrefix(u.Path, "/")}, true
+		}
+	}
+	return NodeIdentity{}, false
+}
+
+type nodeIdentityKey struct{}
+
+// nodeIdentityFrom returns the calling node's identity, set by withInternalAuth.
+func nodeIdentityFrom(ctx context.Context) (NodeIdentity, bool) {
+	id, ok := ctx.Value(nodeIdentityKey{}).(NodeIdentity)
+	return id, ok
+}
+
+// --- CA ---
+
+// NodeCA is the cluster's internal certificate authority.
+type NodeCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// NewNodeCA creates a CA with a fresh P-256 key, valid for ten years.
+func NewNodeCA() (*NodeCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ca key: %w", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "wingthing internal CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create ca cert: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeCA{cert: cert, key: key}, nil
+}
+
+// LoadOrCreateNodeCA returns the cluster CA from the store, creating it on
+// first use. Login replicas starting together all end up with the first one
+// stored.
+func LoadOrCreateNodeCA(store *RelayStore) (*NodeCA, error) {
+	stored, err := store.GetRelayConfig(nodeCAConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	if stored == "" {
+		ca, err := NewNodeCA()
+		if err != nil {
+			return nil, err
+		}
+		pemData, err := ca.marshal()
+		if err != nil {
+			return nil, err
+		}
+		if stored, err = store.InitRelayConfig(nodeCAConfigKey, pemData); err != nil {
+			return nil, err
+		}
+	}
+	return parseNodeCA(stored)
+}
+
+func (ca *NodeCA) marshal() (string, error) {
+	keyDER, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		return "", fmt.Errorf("marshal ca key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})), nil
+}
+
+func parseNodeCA(data string) (*NodeCA, error) {
+	ca := &NodeCA{}
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			ca.cert, err = x509.ParseCertificate(block.Bytes)
+		case "EC PRIVATE KEY":
+			ca.key, err = x509.ParseECPrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse node ca: %w", err)
+		}
+	}
+	if ca.cert == nil || ca.key == nil {
+		return nil, fmt.Errorf("parse node ca: missing certificate or key")
+	}
+	return ca, nil
+}
+
+// nodeGrant is what a node receives from the CA: a certificate for its key,
+// the CA certificate, and a node token.
+type nodeGrant struct {
+	Cert           []byte    `json:"cert"` // DER
+	CA             []byte    `json:"ca"`   // DER
+	Token          string    `json:"token"`
+	TokenExpiresAt time.Time `json:"token_expires_at"`
+}
+
+// signCSR issues a certificate for the CSR's key naming id, plus a token.
+func (ca *NodeCA) signCSR(id NodeIdentity, csrDER []byte) (*nodeGrant, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("parse csr: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("csr signature: %w", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: id.MachineID, OrganizationalUnit: []string{id.Role}},
+		URIs:         []*url.URL{id.uri()},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(nodeCertTTL),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("sign node cert: %w", err)
+	}
+	token, exp, err := ca.issueToken(id)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeGrant{Cert: der, CA: ca.cert.Raw, Token: token, TokenExpiresAt: exp}, nil
+}
+
+// NodeClaims are the JWT claims of a node token.
+type NodeClaims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role"`
+}
+
+func (ca *NodeCA) issueToken(id NodeIdentity) (string, time.Time, error) {
+	exp := time.Now().Add(nodeTokenTTL)
+	claims := NodeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   id.MachineID,
+			Audience:  jwt.ClaimStrings{nodeTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		Role: id.Role,
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(ca.key)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign node token: %w", err)
+	}
+	return signed, exp, nil
+}
+
+// validateNodeToken checks a node token against the CA certificate.
+func validateNodeToken(caCert *x509.Certificate, token string) (NodeIdentity, error) {
+	pub, ok := caCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return NodeIdentity{}, fmt.Errorf("node ca key is not ECDSA")
+	}
+	var claims NodeClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) { return pub, nil },
+		jwt.WithValidMethods([]string{"ES256"}),
+		jwt.WithAudience(nodeTokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return NodeIdentity{}, fmt.Errorf("node token: %w", err)
+	}
+	return NodeIdentity{MachineID: claims.Subject, Role: claims.Role}, nil
+}
+
+func randomSerial() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 126))
+	return n
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// --- Node credentials ---
+
+// NodeAuth holds this node's certificate and token and renews them before
+// they expire, with a new key each time.
+type NodeAuth struct {
+	id    NodeIdentity
+	issue func(ctx context.Context, csr []byte) (*nodeGrant, error)
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	ca       *x509.Certificate
+	caPool   *x509.CertPool
+	token    string
+	tokenExp time.Time
+
+	transportOnce sync.Once
+	transport     http.RoundTripper
+}
+
+// NewLocalNodeAuth issues credentials straight from the CA (login nodes).
+func NewLocalNodeAuth(ca *NodeCA, id NodeIdentity) *NodeAuth {
+	return &NodeAuth{id: id, issue: func(_ context.Context, csr []byte) (*nodeGrant, error) {
+		return ca.signCSR(id, csr)
+	}}
+}
+
+// NewEnrollingNodeAuth gets credentials by enrolling with the login replicas
+// (edges). jwtKey is the cluster's WT_JWT_KEY, which proves membership.
+func NewEnrollingNodeAuth(jwtKey *ecdsa.PrivateKey, id NodeIdentity, pool *LoginPool) *NodeAuth {
+	return &NodeAuth{id: id, issue: func(ctx context.Context, csr []byte) (*nodeGrant, error) {
+		return enroll(ctx, jwtKey, id, pool, csr)
+	}}
+}
+
+// Identity returns the node these credentials name.
+func (a *NodeAuth) Identity() NodeIdentity { return a.id }
+
+// Renew gets a fresh key, certificate and token.
+func (a *NodeAuth) Renew(ctx context.Context) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate node key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: a.id.MachineID},
+	}, key)
+	if err != nil {
+		return fmt.Errorf("create csr: %w", err)
+	}
+	g, err := a.issue(ctx, csr)
+	if err != nil {
+		return err
+	}
+
+	caCert, err := x509.ParseCertificate(g.CA)
+	if err != nil {
+		return fmt.Errorf("parse ca cert: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(g.Cert)
+	if err != nil {
+		return fmt.Errorf("parse node cert: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		return fmt.Errorf("node cert: %w", err)
+	}
+	if got, ok := identityFromCert(leaf); !ok || got != a.id {
+		return fmt.Errorf("node cert names %v, want %v", got, a.id)
+	}
+	if pub, ok := leaf.PublicKey.(*ecdsa.PublicKey); !ok || !pub.Equal(&key.PublicKey) {
+		return fmt.Errorf("node cert is for another key")
+	}
+	if got, err := validateNodeToken(caCert, g.Token); err != nil || got != a.id {
+		return fmt.Errorf("node token names %v: %v", got, err)
+	}
+
+	a.mu.Lock()
+	a.cert = &tls.Certificate{Certificate: [][]byte{g.Cert}, PrivateKey: key, Leaf: leaf}
+	a.ca = caCert
+	a.caPool = pool
+	a.token = g.Token
+	a.tokenExp = g.TokenExpiresAt
+	a.mu.Unlock()
+	return nil
+}
+
+// Start gets the first credentials, retrying until that works or ctx ends,
+// then keeps renewing them in the background.
+func (a *NodeAuth) Start(ctx context.Context) error {
+	for {
+		err := a.Renew(ctx)
+		if err == nil {
+			break
+		}
+		log.Printf("node auth: %v (retrying)", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	log.Printf("node auth: credentials issued for %s", a.id)
+
+	go func() {
+		next := nodeRenewEvery
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(next):
+			}
+			if err := a.Renew(ctx); err != nil {
+				log.Printf("node auth: renew: %v", err)
+				next = 30 * time.Second
+				continue
+			}
+			next = nodeRenewEvery
+		}
+	}()
+	return nil
+}
+
+// Token returns the current node token.
+func (a *NodeAuth) Token() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.token
+}
+
+// verifyPeer checks that certs chain to the cluster CA for the given use and
+// returns the node they name.
+func (a *NodeAuth) verifyPeer(certs []*x509.Certificate, usage x509.ExtKeyUsage) (NodeIdentity, error) {
+	if len(certs) == 0 {
+		return NodeIdentity{}, errors.New("no node certificate")
+	}
+	a.mu.RLock()
+	pool := a.caPool
+	a.mu.RUnlock()
+	if pool == nil {
+		return NodeIdentity{}, errors.New("node credentials not issued yet")
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{usage}}); err != nil {
+		return NodeIdentity{}, fmt.Errorf("node certificate: %w", err)
+	}
+	id, ok := identityFromCert(certs[0])
+	if !ok {
+		return NodeIdentity{}, errors.New("certificate names no node")
+	}
+	return id, nil
+}
+
+// Verify returns the node that sent r. The request must arrive over TLS with
+// a client certificate from the cluster CA and carry a node token naming the
+// same node.
+func (a *NodeAuth) Verify(r *http.Request) (NodeIdentity, error) {
+	if r.TLS == nil {
+		return NodeIdentity{}, errors.New("not a TLS connection")
+	}
+	certID, err := a.verifyPeer(r.TLS.PeerCertificates, x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return NodeIdentity{}, err
+	}
+	a.mu.RLock()
+	ca := a.ca
+	a.mu.RUnlock()
+	tokenID, err := validateNodeToken(ca, r.Header.Get(nodeTokenHeader))
+	if err != nil {
+		return NodeIdentity{}, err
+	}
+	if tokenID != certID {
+		return NodeIdentity{}, fmt.Errorf("token names %v but certificate names %v", tokenID, certID)
+	}
+	return certID, nil
+}
+
+// ServerTLSConfig is the TLS config for the internal listener. Client
+// certificates are verified when given; enrollment comes without one, and
+// withInternalAuth rejects everything else that lacks one.
+func (a *NodeAuth) ServerTLSConfig() *tls.Config {
+	current := func() (*tls.Config, error) {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		if a.cert == nil {
+			return nil, errors.New("node credentials not issued yet")
+		}
+		return &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*a.cert},
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+			ClientCAs:    a.caPool,
+		}, nil
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return current()
+		},
+	}
+}
+
+// Transport returns the HTTP transport for calls to other nodes. It presents
+// this node's certificate, accepts only servers with a certificate from the
+// cluster CA, and adds the node token to every request.
+func (a *NodeAuth) Transport() http.RoundTripper {
+	a.transportOnce.Do(a.initTransport)
+	return a.transport
+}
+
+// ProxyTransport is Transport without the node token, for relaying user
+// requests to the login node.
+func (a *NodeAuth) ProxyTransport() http.RoundTripper {
+	a.transportOnce.Do(a.initTransport)
+	return a.transport.(*nodeTransport).base
+}
+
+func (a *NodeAuth) initTransport() {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Node certificates name machines, not hosts; VerifyConnection
+		// checks the chain instead.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			a.mu.RLock()
+			defer a.mu.RUnlock()
+			if a.cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return a.cert, nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, err := a.verifyPeer(cs.PeerCertificates, x509.ExtKeyUsageServerAuth)
+			return err
+		},
+	}
+	a.transport = &nodeTransport{auth: a, base: t}
+}
+
+type nodeTransport struct {
+	auth *NodeAuth
+	base http.RoundTripper
+}
+
+func (t *nodeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(nodeTokenHeader, t.auth.Token())
+	return t.base.RoundTrip(req)
+}
+
+// --- Enrollment ---
+
+// enrollClaims prove cluster membership: signed with WT_JWT_KEY and bound to
+// the CSR being enrolled.
+type enrollClaims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role"`
+	CSR  string `json:"csr"` // digest of the CSR
+}
+
+// enrolledClaims sign the enrollment response, binding the CA it hands out.
+// The enrolling node has no CA to check the server against yet, so this
+// signature is what authenticates the answer.
+type enrolledClaims struct {
+	jwt.RegisteredClaims
+	CA string `json:"ca"` // digest of the CA certificate
+}
+
+func enroll(ctx context.Context, jwtKey *ecdsa.PrivateKey, id NodeIdentity, pool *LoginPool, csr []byte) (*nodeGrant, error) {
+	proof, err := jwt.NewWithClaims(jwt.SigningMethodES256, enrollClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   id.MachineID,
+			Audience:  jwt.ClaimStrings{nodeEnrollAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(2 * time.Minute)),
+		},
+		Role: id.Role,
+		CSR:  digest(csr),
+	}).SignedString(jwtKey)
+	if err != nil {
+		return nil, fmt.Errorf("sign enrollment: %w", err)
+	}
+	body, _ := json.Marshal(map[string]any{"csr": csr})
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true} // answer is signed
+	client := &http.Client{Timeout: 5 * time.Second, Transport: t}
+	defer t.CloseIdleConnections()
+
+	err = errLoginUnavailable
+	for _, addr := range pool.Addrs() {
+		var g *nodeGrant
+		if g, err = enrollWith(ctx, client, addr, proof, body, &jwtKey.PublicKey, id); err == nil {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("enroll: %w", err)
+}
+
+func enrollWith(ctx context.Context, client *http.Client, addr, proof string, body []byte, pub *ecdsa.PublicKey, id NodeIdentity) (*nodeGrant, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", addr+"/internal/node/enroll", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+proof)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d: %s", addr, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var out struct {
+		nodeGrant
+		Sig string `json:"sig"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	var claims enrolledClaims
+	_, err = jwt.ParseWithClaims(out.Sig, &claims, func(*jwt.Token) (any, error) { return pub, nil },
+		jwt.WithValidMethods([]string{"ES256"}),
+		jwt.WithAudience(nodeEnrolledAudience),
+		jwt.WithSubject(id.MachineID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: enrollment signature: %w", addr, err)
+	}
+	if claims.CA != digest(out.CA) {
+		return nil, fmt.Errorf("%s: enrollment signature does not cover the CA", addr)
+	}
+	return &out.nodeGrant, nil
+}
+
+// handleNodeEnroll issues node credentials to a node proving cluster
+// membership (login nodes only).
+func (s *Server) handleNodeEnroll(w http.ResponseWriter, r *http.Request) {
+	if s.nodeCA == nil || s.jwtKey == nil {
+		writeError(w, http.StatusServiceUnavailable, "node enrollment not available on this node")
+		return
+	}
+	var claims enrollClaims
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &claims,
+		func(*jwt.Token) (any, error) { return &s.jwtKey.PublicKey, nil },
+		jwt.WithValidMethods([]string{"ES256"}),
+		jwt.WithAudience(nodeEnrollAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid enrollment proof")
+		return
+	}
+	if claims.Subject == "" || (claims.Role != "edge" && claims.Role != "login") {
+		writeError(w, http.StatusBadRequest, "enrollment needs a machine ID and a node role")
+		return
+	}
+	var req struct {
+		CSR []byte `json:"csr"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if digest(req.CSR) != claims.CSR {
+		writeError(w, http.StatusUnauthorized, "enrollment proof does not match the CSR")
+		return
+	}
+
+	id := NodeIdentity{MachineID: claims.Subject, Role: claims.Role}
+	grant, err := s.nodeCA.signCSR(id, req.CSR)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sig, err := jwt.NewWithClaims(jwt.SigningMethodES256, enrolledClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   id.MachineID,
+			Audience:  jwt.ClaimStrings{nodeEnrolledAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(2 * time.Minute)),
+		},
+		CA: digest(grant.CA),
+	}).SignedString(s.jwtKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("node auth: enrolled %s", id)
+	writeJSON(w, http.StatusOK, struct {
+		*nodeGrant
+		Sig string `json:"sig"`
+	}{grant, sig})
+}
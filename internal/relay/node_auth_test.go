@@ -0,0 +1,192 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateNodeCA(t *testing.T) {
+	s := testStore(t)
+	a, err := LoadOrCreateNodeCA(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadOrCreateNodeCA(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.cert.Equal(b.cert) || !a.key.Equal(b.key) {
+		t.Error("second load created a new CA")
+	}
+}
+
+// startLoginTLS runs a login node whose internal listener is a TLS test server.
+func startLoginTLS(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	key, _, err := GenerateECKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := testStore(t)
+	srv := NewServer(store, ServerConfig{NodeRole: "login", FlyMachineID: "login-1"})
+	srv.SetJWTKey(key)
+	srv.WingMap = NewWingMap()
+	ca, err := LoadOrCreateNodeCA(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetNodeCA(ca)
+	auth := NewLocalNodeAuth(ca, NodeIdentity{MachineID: "login-1", Role: "login"})
+	if err := auth.Renew(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetNodeAuth(auth)
+	ts := httptest.NewUnstartedServer(srv)
+	ts.TLS = auth.ServerTLSConfig()
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func TestNodeEnrollAndInternalAuth(t *testing.T) {
+	login, ts := startLoginTLS(t)
+	pool := NewLoginPool([]string{ts.URL}, "edge-1")
+	edge := NewEnrollingNodeAuth(login.JWTKey(), NodeIdentity{MachineID: "edge-1", Role: "edge"}, pool)
+	if err := edge.Renew(context.Background()); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+
+	call := func(client *http.Client, token, path string, body []byte) int {
+		t.Helper()
+		method := "GET"
+		if body != nil {
+			method = "POST"
+		}
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set(nodeTokenHeader, token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	nodeClient := &http.Client{Transport: edge.Transport(), Timeout: 5 * time.Second}
+	if code := call(nodeClient, "", "/internal/status", nil); code != http.StatusOK {
+		t.Fatalf("enrolled edge: %d", code)
+	}
+
+	// Renewal swaps in a new key and certificate; calls keep working
+	first := edge.cert.Leaf
+	if err := edge.Renew(context.Background()); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if edge.cert.Leaf.Equal(first) {
+		t.Error("renew kept the old certificate")
+	}
+	nodeClient.Transport.(*nodeTransport).base.(*http.Transport).CloseIdleConnections()
+	if code := call(nodeClient, "", "/internal/status", nil); code != http.StatusOK {
+		t.Errorf("after renew: %d", code)
+	}
+
+	// No client certificate, even with a valid token
+	plain := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	if code := call(plain, edge.Token(), "/internal/status", nil); code != http.StatusForbidden {
+		t.Errorf("no certificate: %d, want 403", code)
+	}
+
+	// Certificate without a token, or with another node's token
+	bare := &http.Client{Transport: edge.ProxyTransport()}
+	if code := call(bare, "", "/internal/status", nil); code != http.StatusForbidden {
+		t.Errorf("no token: %d, want 403", code)
+	}
+	other, _, _ := login.nodeCA.issueToken(NodeIdentity{MachineID: "edge-2", Role: "edge"})
+	if code := call(bare, other, "/internal/status", nil); code != http.StatusForbidden {
+		t.Errorf("mismatched token: %d, want 403", code)
+	}
+
+	// Certificate from another CA fails the handshake
+	rogueCA, _ := NewNodeCA()
+	rogue := NewLocalNodeAuth(rogueCA, NodeIdentity{MachineID: "edge-1", Role: "edge"})
+	rogue.Renew(context.Background())
+	if code := call(&http.Client{Transport: rogue.Transport()}, "", "/internal/status", nil); code != 0 {
+		t.Errorf("rogue CA: %d, want handshake failure", code)
+	}
+
+	// Nodes may only speak for themselves
+	if code := call(nodeClient, "", "/internal/wing-register", []byte(`{"wing_id":"w1","machine_id":"edge-2"}`)); code != http.StatusForbidden {
+		t.Errorf("register for another node: %d, want 403", code)
+	}
+	if code := call(nodeClient, "", "/internal/wing-register", []byte(`{"wing_id":"w1","machine_id":"edge-1"}`)); code != http.StatusOK {
+		t.Errorf("register own wing: %d", code)
+	}
+}
+
+func TestNodeEnrollRequiresClusterKey(t *testing.T) {
+	_, ts := startLoginTLS(t)
+	wrongKey, _, _ := GenerateECKey()
+	pool := NewLoginPool([]string{ts.URL}, "edge-1")
+	edge := NewEnrollingNodeAuth(wrongKey, NodeIdentity{MachineID: "edge-1", Role: "edge"}, pool)
+	if err := edge.Renew(context.Background()); err == nil {
+		t.Fatal("enrolled with a key outside the cluster")
+	}
+}
+
+func TestSingleNodeHasNoInternalRoutes(t *testing.T) {
+	_, ts := testServer(t)
+	for _, path := range []string{
+		"/internal/status",
+		"/internal/wings-debug",
+		"/internal/user-orgs/u1",
+		"/internal/user-status/u1",
+		"/internal/sessions/tok",
+		"/internal/api-tokens/hash",
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: %d, want 404", path, resp.StatusCode)
+		}
+	}
+	for _, path := range []string{"/internal/wing-register", "/internal/wing-event", "/internal/user-orgs-bulk"} {
+		resp, err := http.Post(ts.URL+path, "application/json", bytes.NewReader([]byte(`{}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("POST %s: %d, want 404", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestLoginProxyDropsNodeToken(t *testing.T) {
+	var got string
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(nodeTokenHeader)
+	}))
+	defer login.Close()
+	proxy := httptest.NewServer(NewLoginProxy(NewLoginPool([]string{login.URL}, "edge-1")))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/internal/status", nil)
+	req.Header.Set(nodeTokenHeader, "stolen")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != "" {
+		t.Errorf("login node saw node token %q from a client", got)
+	}
+}
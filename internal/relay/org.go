@@ -136,30 +136,35 @@ func (s *Server) handleListOrgs(w http.ResponseWriter, r *http.Request) {
 	}
 	out := make([]map[string]any, len(orgs))
 	for i, o := range orgs {
-		entry := map[string]any{
-			"id":        o.ID,
-			"name":      o.Name,
-			"slug":      o.Slug,
-			"max_seats": o.MaxSeats,
-			"is_owner":  o.OwnerUserID == user.ID,
-		}
-		sub, _ := s.Store.GetActiveOrgSubscription(o.ID)
-		if sub != nil {
-			used, _ := s.Store.CountEntitlementsBySub(sub.ID)
-			entry["has_subscription"] = true
-			entry["plan"] = sub.Plan
-			entry["seats_total"] = sub.Seats
-			entry["seats_used"] = used
-		} else {
-			entry["has_subscription"] = false
-		}
-		memberCount, _ := s.Store.CountOrgMembers(o.ID)
-		entry["member_count"] = memberCount
-		out[i] = entry
+		out[i] = s.orgEntry(o, user.ID)
 	}
 	writeJSON(w, http.StatusOK, out)
 }
 
+// orgEntry is an org's API representation: seats, subscription and member count.
+func (s *Server) orgEntry(o *Org, userID string) map[string]any {
+	entry := map[string]any{
+		"id":        o.ID,
+		"name":      o.Name,
+		"slug":      o.Slug,
+		"max_seats": o.MaxSeats,
+		"is_owner":  o.OwnerUserID == userID,
+	}
+	sub, _ := s.Store.GetActiveOrgSubscription(o.ID)
+	if sub != nil {
+		used, _ := s.Store.CountEntitlementsBySub(sub.ID)
+		entry["has_subscription"] = true
+		entry["plan"] = sub.Plan
+		entry["seats_total"] = sub.Seats
+		entry["seats_used"] = used
+	} else {
+		entry["has_subscription"] = false
+	}
+	memberCount, _ := s.Store.CountOrgMembers(o.ID)
+	entry["member_count"] = memberCount
+	return entry
+}
+
 // handleGetOrg returns org details. GET /api/orgs/{slug}
 func (s *Server) handleGetOrg(w http.ResponseWriter, r *http.Request) {
 	user := s.sessionUser(r)
@@ -177,26 +182,7 @@ func (s *Server) handleGetOrg(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusForbidden, "not a member")
 		return
 	}
-	resp := map[string]any{
-		"id":        org.ID,
-		"name":      org.Name,
-		"slug":      org.Slug,
-		"max_seats": org.MaxSeats,
-		"is_owner":  org.OwnerUserID == user.ID,
-	}
-	sub, _ := s.Store.GetActiveOrgSubscription(org.ID)
-	if sub != nil {
-		used, _ := s.Store.CountEntitlementsBySub(sub.ID)
-		resp["has_subscription"] = true
-		resp["plan"] = sub.Plan
-		resp["seats_total"] = sub.Seats
-		resp["seats_used"] = used
-	} else {
-		resp["has_subscription"] = false
-	}
-	memberCount, _ := s.Store.CountOrgMembers(org.ID)
-	resp["member_count"] = memberCount
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusOK, s.orgEntry(org, user.ID))
 }
 
 // handleListOrgMembers lists members and pending invites. GET /api/orgs/{slug}/members
@@ -321,6 +307,7 @@ func (s *Server) handleOrgInvite(w http.ResponseWriter, r *http.Request) {
 		if err := s.Store.CreateOrgInvite(id, org.ID, email, token, user.ID, inviteRole); err != nil {
 			continue // skip dupes
 		}
+		s.Store.AppendOrgAudit(user.ID, org.ID, "invite_created", strPtr(fmt.Sprintf("org=%s email=%s role=%s", org.Slug, email, inviteRole)))
 		link := s.Config.BaseURL + "/invite/" + token
 		// Send invite email if SMTP configured
 		if s.Config.SMTPHost != "" {
@@ -512,6 +499,7 @@ func (s *Server) handleRemoveOrgMember(w http.ResponseWriter, r *http.Request) {
 	}
 	s.revokeOrgEntitlement(org.ID, targetUserID)
 	s.refreshUserOrgSubs(targetUserID)
+	s.Store.AppendOrgAudit(targetUserID, org.ID, "org_member_removed", strPtr(fmt.Sprintf("org=%s by=%s", org.Slug, user.ID)))
 
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
@@ -633,14 +621,21 @@ func (s *Server) handleConsumeInvite(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "email mismatch", http.StatusForbidden)
 		return
 	}
+	if org, _ := s.Store.GetOrgByID(inv.OrgID); org != nil {
+		if name := s.ssoRequiredFor(org, user); name != "" {
+			http.Error(w, org.Name+" requires signing in with "+name, http.StatusForbidden)
+			return
+		}
+	}
 	email, orgID, invRole, err := s.Store.ConsumeOrgInvite(token)
 	if err != nil {
 		http.Error(w, "invite already used or expired", http.StatusBadRequest)
 		return
 	}
-	_ = email // validated above
+	s.Store.AppendOrgAudit(user.ID, orgID, "invite_accepted", strPtr(fmt.Sprintf("invite=%s email=%s role=%s", inv.ID, email, invRole)))
 
 	s.Store.AddOrgMember(orgID, user.ID, invRole)
+	s.Store.AppendOrgAudit(user.ID, orgID, "org_member_added", strPtr(fmt.Sprintf("role=%s via=invite", invRole)))
 	s.grantOrgEntitlement(orgID, user.ID)
 	s.refreshUserOrgSubs(user.ID)
 	http.SetCookie(w, &http.Cookie{Name: "invite_token", Path: "/", MaxAge: -1})
@@ -667,6 +662,7 @@ func (s *Server) refreshUserOrgSubs(userID string) {
 	if s.Wings.UpdateUserOrgs(userID, orgIDs) {
 		s.Wings.notify(userID, WingEvent{Type: "org.changed"})
 	}
+	s.revokeWingAccess(userID, orgIDs)
 	// Broadcast org.changed to edges so they update their subscribers
 	if s.IsLogin() && s.WingMap != nil {
 		payload, _ := json.Marshal(map[string]any{
@@ -96,6 +96,7 @@ type loginPageData struct {
 	HasGitHub bool
 	HasGoogle bool
 	HasSMTP   bool
+	SSO       []*SSOProviderConfig
 }
 
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
@@ -205,6 +206,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		HasGitHub: s.Config.GitHubClientID != "",
 		HasGoogle: s.Config.GoogleClientID != "",
 		HasSMTP:   s.Config.SMTPHost != "",
+		SSO:       s.ssoButtons(),
 	}
 	s.template(loginTmpl, "base.html", "login.html").ExecuteTemplate(w, "base", data)
 }
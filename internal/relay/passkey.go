@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
@@ -179,6 +180,7 @@ func (s *Server) handlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Requ
 			http.Error(w, "store credential: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		s.Store.AppendAudit(user.ID, "passkey_registered", strPtr(fmt.Sprintf("id=%s key=%s ip=%s", id, keyFingerprint(base64.StdEncoding.EncodeToString(rawPubKey)), clientIP(r))))
 	}
 
 	pubKeyB64 := base64.StdEncoding.EncodeToString(rawPubKey)
@@ -289,6 +291,7 @@ func (s *Server) handlePasskeyDelete(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		s.Store.AppendAudit(user.ID, "passkey_deleted", strPtr(fmt.Sprintf("id=%s ip=%s", id, clientIP(r))))
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,283 @@
+package relay
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgreSQL runs the same ?-placeholder queries as SQLite; pgConn rebinds
+// them to $n for pgx, and schema differences live in migrations/postgres.
+
+// dialect describes the database behind a RelayStore. What can't be shared
+// between the two databases lives here.
+type dialect struct {
+	name       string // "sqlite" or "postgres"
+	migrations string // directory in migrationsFS
+	timestamp  string // column type for times
+	now        string // the database's current UTC time, sub-second
+	nowPlus    string // now plus ? seconds (a float)
+}
+
+var (
+	sqliteDialect = dialect{
+		name:       "sqlite",
+		migrations: "migrations",
+		timestamp:  "DATETIME",
+		now:        "strftime('%Y-%m-%d %H:%M:%f', 'now')",
+		nowPlus:    "strftime('%Y-%m-%d %H:%M:%f', 'now', '+' || ? || ' seconds')",
+	}
+	postgresDialect = dialect{
+		name:       "postgres",
+		migrations: "migrations/postgres",
+		timestamp:  "TIMESTAMP",
+		now:        "(now() AT TIME ZONE 'UTC')",
+		nowPlus:    "((now() AT TIME ZONE 'UTC') + CAST(? AS DOUBLE PRECISION) * INTERVAL '1 second')",
+	}
+)
+
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// openPostgres opens dsn through pgx, wrapped so the store's SQLite-style
+// queries run unchanged.
+func openPostgres(dsn string) (*sql.DB, error) {
+	return sql.OpenDB(&pgConnector{driver: stdlib.GetDefaultDriver(), dsn: dsn}), nil
+}
+
+// pgConnector opens connections with the wrapped driver and pins each
+// session to UTC, matching the UTC times SQLite's CURRENT_TIMESTAMP gives.
+type pgConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c *pgConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	pc := &pgConn{Conn: conn}
+	if err := pc.exec(ctx, "SET TIME ZONE 'UTC'"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("set time zone: %w", err)
+	}
+	return pc, nil
+}
+
+func (c *pgConnector) Driver() driver.Driver { return c.driver }
+
+// pgConn rewrites ? placeholders to $n on the way to PostgreSQL and stores
+// bools as integers, the way the SQLite schema keeps flags.
+type pgConn struct {
+	driver.Conn
+}
+
+func (c *pgConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebindPostgres(query))
+}
+
+func (c *pgConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query = rebindPostgres(query)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *pgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, rebindPostgres(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// exec runs a statement without arguments, preparing it if the driver
+// can't execute directly.
+func (c *pgConn) exec(ctx context.Context, query string) error {
+	_, err := c.ExecContext(ctx, query, nil)
+	if err != driver.ErrSkip {
+		return err
+	}
+	stmt, err := c.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+func (c *pgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, rebindPostgres(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *pgConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *pgConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *pgConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *pgConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *pgConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if b, ok := nv.Value.(bool); ok {
+		nv.Value = int64(0)
+		if b {
+			nv.Value = int64(1)
+		}
+	}
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// rebindPostgres turns ? placeholders into $1, $2, ... Question marks inside
+// quoted strings and identifiers are left alone.
+func rebindPostgres(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// relayTables lists every relay table in an order that satisfies foreign
+// keys, for CopyRelayData. New tables must be added here.
+var relayTables = []string{
+	"users", "device_tokens", "device_codes", "sessions", "magic_links",
+	"audit_log", "skills", "relay_config", "relay_tasks", "bandwidth_log",
+	"orgs", "org_members", "org_invites", "subscriptions", "entitlements",
+	"labels", "passkey_credentials", "audit_heads",
+	"scim_tokens", "scim_users", "scim_groups", "scim_group_members",
+	"api_tokens", "webhooks", "webhook_deliveries", "leases",
+	"saml_requests", "saml_tickets",
+}
+
+// serialTables have an auto-increment id whose sequence must move past the
+// copied rows on PostgreSQL.
+var serialTables = []string{"audit_log", "bandwidth_log"}
+
+// CopyRelayData copies every relay table from src into dst in one
+// transaction. dst must be migrated and empty. Returns rows copied per table.
+func CopyRelayData(src, dst *RelayStore) (map[string]int, error) {
+	var users int
+	if err := dst.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		return nil, fmt.Errorf("check destination: %w", err)
+	}
+	if users > 0 {
+		return nil, fmt.Errorf("destination already has %d users; copy only into an empty database", users)
+	}
+
+	tx, err := dst.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	counts := make(map[string]int, len(relayTables))
+	for _, table := range relayTables {
+		n, err := copyTable(src.db, tx, table)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("copy %s: %w", table, err)
+		}
+		counts[table] = n
+	}
+	if dst.dialect.name == "postgres" {
+		for _, table := range serialTables {
+			q := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)", table, table)
+			if _, err := tx.Exec(q); err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("reset %s sequence: %w", table, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return counts, nil
+}
+
+func copyTable(src *sql.DB, dst *sql.Tx, table string) (int, error) {
+	rows, err := src.Query("SELECT * FROM " + table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+	stmt, err := dst.Prepare("INSERT INTO " + table + " (" + strings.Join(cols, ", ") + ") VALUES (" + marks + ")")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if _, err := stmt.Exec(vals...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,209 @@
+package relay
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRebindPostgres(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1": "SELECT 1",
+		"SELECT * FROM users WHERE id = ? AND x = ?": "SELECT * FROM users WHERE id = $1 AND x = $2",
+		"UPDATE t SET a = '?' WHERE b = ?":           "UPDATE t SET a = '?' WHERE b = $1",
+		`SELECT "odd?col" FROM t WHERE c IN (?, ?)`:  `SELECT "odd?col" FROM t WHERE c IN ($1, $2)`,
+	}
+	for in, want := range cases {
+		if got := rebindPostgres(in); got != want {
+			t.Errorf("rebind(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPostgresMigrationsMirrorSQLite(t *testing.T) {
+	names := func(dir string) []string {
+		entries, err := migrationsFS.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, e := range entries {
+			if !e.IsDir() {
+				out = append(out, e.Name())
+			}
+		}
+		return out
+	}
+	if sq, pg := names(sqliteDialect.migrations), names(postgresDialect.migrations); !slices.Equal(sq, pg) {
+		t.Errorf("migrations differ:\n sqlite   %v\n postgres %v", sq, pg)
+	}
+}
+
+func TestRelayTablesCoverSchema(t *testing.T) {
+	s := testStore(t)
+	query := "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT IN ('sqlite_sequence', 'schema_migrations')"
+	if s.Dialect() == "postgres" {
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'"
+	}
+	rows, err := s.DB().Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		if !slices.Contains(relayTables, name) {
+			t.Errorf("table %s is missing from relayTables", name)
+		}
+	}
+}
+
+// TestRelayStoreMethodsTested keeps every RelayStore method called from a
+// test in this package. The suite runs on PostgreSQL when
+// WT_TEST_POSTGRES_DSN is set, so that is what proves each query sits in
+// the SQL the two databases share.
+func TestRelayStoreMethodsTested(t *testing.T) {
+	files, err := filepath.Glob("*_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	called := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+					called[sel.Sel.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	typ := reflect.TypeOf(&RelayStore{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		if name := typ.Method(i).Name; !called[name] {
+			t.Errorf("RelayStore.%s is not called by any test", name)
+		}
+	}
+}
+
+func TestCopyRelayData(t *testing.T) {
+	dst, err := OpenRelay(filepath.Join(t.TempDir(), "dst.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	testCopyRelayData(t, dst)
+}
+
+func TestCopyRelayDataToPostgres(t *testing.T) {
+	dsn := os.Getenv("WT_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("WT_TEST_POSTGRES_DSN not set")
+	}
+	testCopyRelayData(t, pgTestStore(t, dsn))
+}
+
+// testCopyRelayData copies a populated SQLite store into the empty dst.
+func testCopyRelayData(t *testing.T, dst *RelayStore) {
+	t.Helper()
+	src, err := OpenRelay(filepath.Join(t.TempDir(), "src.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	src.CreateUser("u1")
+	src.CreateSession("sess-1", "u1", time.Now().Add(time.Hour))
+	src.CreateOrg("org-1", "Acme", "acme", "u1")
+	src.SetLabel("wing-a", "user", "u1", "laptop")
+	src.AppendAudit("u1", "login", nil)
+	src.CreatePasskeyCredential("pk-1", "u1", []byte{1, 2, 3}, []byte{4, 5}, "key")
+
+	counts, err := CopyRelayData(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["users"] != 1 || counts["orgs"] != 1 || counts["org_members"] != 1 || counts["audit_log"] != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+	if u, _ := dst.GetSession("sess-1"); u == nil || u.ID != "u1" {
+		t.Errorf("session not copied: %+v", u)
+	}
+	if role := dst.GetOrgMemberRole("org-1", "u1"); role != "owner" {
+		t.Errorf("role = %q", role)
+	}
+	creds, _ := dst.ListPasskeyCredentials("u1")
+	if len(creds) != 1 || string(creds[0].PublicKey) != string([]byte{4, 5}) {
+		t.Errorf("passkeys = %+v", creds)
+	}
+
+	// Never copies over existing data
+	if _, err := CopyRelayData(src, dst); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("second copy: %v", err)
+	}
+}
+
+// pgTestStore opens a store in a fresh schema of the database at dsn and
+// drops the schema when the test ends.
+func pgTestStore(t *testing.T, dsn string) *RelayStore {
+	t.Helper()
+	s, err := OpenRelay(pgTestDSN(t, dsn))
+	if err != nil {
+		t.Fatalf("open postgres store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// pgTestDSN creates a fresh schema in the database at dsn and returns a DSN
+// whose connections use it. Stores opened on it must be closed before the
+// test ends, when the schema is dropped.
+func pgTestDSN(t *testing.T, dsn string) string {
+	t.Helper()
+	admin, err := openPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "wt_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestOpenRelayPostgresConnectError(t *testing.T) {
+	// pgx is always linked: a bad address is a connection error, not a
+	// missing driver
+	_, err := OpenRelay("postgres://wt@127.0.0.1:1/wingthing?connect_timeout=2")
+	if err == nil || !strings.Contains(err.Error(), "connect postgres") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -7,17 +7,32 @@ import (
 	"net/url"
 )
 
-// NewLoginProxy creates a reverse proxy to the login node for edge nodes.
+// NewLoginProxy creates a reverse proxy to the login replicas for edge nodes.
 // Edge nodes proxy API, auth, and page requests to the login node while
-// serving WebSocket connections directly.
-func NewLoginProxy(loginAddr string) *httputil.ReverseProxy {
-	target, err := url.Parse(loginAddr)
-	if err != nil {
-		log.Fatalf("invalid login node address: %s", loginAddr)
+// serving WebSocket connections directly. Each request goes to the pool's
+// current primary; a replica that fails is marked down so the next request
+// tries another.
+func NewLoginProxy(pool *LoginPool) *httputil.ReverseProxy {
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			target, err := url.Parse(pool.Primary())
+			if err != nil {
+				log.Printf("invalid login node address: %v", err)
+				return
+			}
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			// The proxy connects with this node's certificate; a browser's
+			// node token must not ride along and pass for this node's.
+			req.Header.Del(nodeTokenHeader)
+			if _, ok := req.Header["User-Agent"]; !ok {
+				req.Header.Set("User-Agent", "")
+			}
+		},
 	}
-	proxy := httputil.NewSingleHostReverseProxy(target)
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		log.Printf("proxy to login node failed: %v", err)
+		pool.MarkDown(r.URL.Scheme + "://" + r.URL.Host)
 		http.Error(w, "login node unavailable", http.StatusBadGateway)
 	}
 	return proxy
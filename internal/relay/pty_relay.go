@@ -59,6 +59,31 @@ func (r *PTYRoutes) Remove(sessionID string) {
 	delete(r.routes, sessionID)
 }
 
+// ForUser returns the routes whose controller is userID, by session ID.
+func (r *PTYRoutes) ForUser(userID string) map[string]*PTYRoute {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make(map[string]*PTYRoute)
+	for sid, route := range r.routes {
+		if route.UserID == userID {
+			result[sid] = route
+		}
+	}
+	return result
+}
+
+// Counts returns the number of routes and of spectators across them.
+func (r *PTYRoutes) Counts() (routes, viewers int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, route := range r.routes {
+		route.mu.Lock()
+		viewers += len(route.Viewers)
+		route.mu.Unlock()
+	}
+	return len(r.routes), viewers
+}
+
 // AddViewer adds a spectator connection to a session route.
 func (r *PTYRoutes) AddViewer(sessionID, viewerID string, conn *websocket.Conn) {
 	r.mu.RLock()
@@ -158,6 +183,7 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 	var userEmail string
 	var userDisplayName string
 	var userOrgIDs []string
+	var apiToken *APIToken // set when authenticated by personal access token
 	if u := s.sessionUser(r); u != nil {
 		userID = u.ID
 		userOrgIDs = u.OrgIDs
@@ -178,15 +204,33 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		if s.JWTPubKey() != nil {
+		if strings.HasPrefix(token, apiTokenPrefix) {
+			u, t := s.resolveAPIToken(token)
+			if u == nil || !t.allows("sessions:write") {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			userID = u.ID
+			userOrgIDs = u.OrgIDs
+			userDisplayName = u.DisplayName
+			if u.Email != nil {
+				userEmail = *u.Email
+			}
+			apiToken = t
+		}
+		if userID == "" && s.JWTPubKey() != nil {
 			if claims, err := ValidateWingJWT(s.JWTPubKey(), token); err == nil {
+				if s.userSuspended(r.Context(), claims.Subject) {
+					http.Error(w, "account suspended", http.StatusForbidden)
+					return
+				}
 				userID = claims.Subject
 			}
 		}
 		if userID == "" && s.Store != nil {
 			var err error
 			userID, _, err = s.Store.ValidateToken(token)
-			if err != nil {
+			if err != nil || s.ssoLockedID(userID) {
 				http.Error(w, "invalid token", http.StatusUnauthorized)
 				return
 			}
@@ -249,7 +293,7 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.CloseNow()
 
-	s.trackBrowser(conn)
+	s.trackBrowser(conn, userID)
 	defer s.untrackBrowser(conn)
 
 	ctx := r.Context()
@@ -260,6 +304,12 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 	// Wing ID from URL query param — used for all routing in this connection
 	queryWingID := r.URL.Query().Get("wing_id")
 
+	// canUse gates wing access: the user's own access, narrowed by the
+	// personal access token's org and wing restrictions if there is one.
+	canUse := func(wing *ConnectedWing) bool {
+		return s.canAccessWing(userID, wing, userOrgIDs) && apiToken.allowsWing(wing.WingID, wing.OrgID)
+	}
+
 	// lookupWing resolves the wing for each message (handles wing reconnect)
 	lookupWing := func() *ConnectedWing {
 		if queryWingID == "" {
@@ -269,6 +319,9 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 		if w == nil {
 			w = s.findAnyWingByWingID(queryWingID)
 		}
+		if w != nil && !apiToken.allowsWing(w.WingID, w.OrgID) {
+			return nil
+		}
 		return w
 	}
 
@@ -302,11 +355,14 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 				if wing == nil {
 					wing = s.findAnyWingByWingID(wingID)
 				}
-				if wing != nil && !s.canAccessWing(userID, wing, userOrgIDs) {
+				if wing != nil && !canUse(wing) {
 					wing = nil
 				}
 			} else {
 				wing = s.findAccessibleWing(userID)
+				if wing != nil && !canUse(wing) {
+					wing = nil
+				}
 			}
 			if wing == nil {
 				log.Printf("[pty-start] NO WING FOUND: requested=%s query=%s user=%s userOrgs=%v machine=%s role=%s local_wings=%s",
@@ -335,11 +391,19 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 				}
 
 			s.PTY.Set(sessionID, &PTYRoute{BrowserConn: conn, UserID: userID, WingID: wing.WingID, Agent: start.Agent, CWD: start.CWD})
+			s.noteBrowserWing(conn, wing)
 
 			fwd, _ := json.Marshal(start)
 			wing.Conn.Write(ctx, websocket.MessageText, fwd)
 
 			log.Printf("pty session %s started (user=%s wing=%s agent=%s)", sessionID, userID, wing.WingID, start.Agent)
+			s.emitWebhook("session.started", userID, wing.OrgID, map[string]any{
+				"session_id": sessionID,
+				"wing_id":    wing.WingID,
+				"user_id":    userID,
+				"agent":      start.Agent,
+				"cwd":        start.CWD,
+			})
 
 		case ws.TypePTYAttach:
 			var attach ws.PTYAttach
@@ -357,13 +421,15 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 			if wing == nil {
 				wing = s.findAnyWingByWingID(wingID)
 			}
-			if wing == nil || !s.canAccessWing(userID, wing, userOrgIDs) {
+			if wing == nil || !canUse(wing) {
 				errMsg, _ := json.Marshal(ws.ErrorMsg{Type: ws.TypeError, Message: "wing not found"})
 				conn.Write(ctx, websocket.MessageText, errMsg)
 				continue
 			}
 
 			attach.UserID = userID
+			attach.Email = userEmail
+			s.noteBrowserWing(conn, wing)
 
 			if attach.Spectate {
 				// Spectator mode: add as read-only viewer, don't overwrite controller.
@@ -371,7 +437,6 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 				// is canAccessWing (owner, org member, or roost mode).
 				viewerID := uuid.New().String()[:8]
 				attach.ViewerID = viewerID
-				attach.Email = userEmail
 				s.PTY.AddViewer(attach.SessionID, viewerID, conn)
 				log.Printf("pty session %s spectator added (viewer=%s user=%s)", attach.SessionID, viewerID, userID)
 			} else {
@@ -391,6 +456,24 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 			fwd, _ := json.Marshal(attach)
 			wing.Conn.Write(ctx, websocket.MessageText, fwd)
 
+		case ws.TypePTYAttentionReply:
+			// Stamp who answered: a tool approval records it as the approver
+			if s.PTY.IsSpectator(conn) {
+				continue
+			}
+			var reply ws.PTYAttentionReply
+			if err := json.Unmarshal(data, &reply); err != nil {
+				continue
+			}
+			wing := lookupWing()
+			if wing == nil {
+				continue
+			}
+			reply.SenderUserID = userID
+			reply.SenderEmail = userEmail
+			fwd, _ := json.Marshal(reply)
+			wing.Conn.Write(ctx, websocket.MessageText, fwd)
+
 		case ws.TypePTYInput, ws.TypePTYResize, ws.TypePTYAttentionAck, ws.TypePasskeyResponse, ws.TypePTYMigrate:
 			// Drop input from spectators
 			if s.PTY.IsSpectator(conn) {
@@ -443,12 +526,18 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 			if err := json.Unmarshal(data, &req); err != nil {
 				continue
 			}
+			if apiToken != nil {
+				errMsg, _ := json.Marshal(ws.ErrorMsg{Type: ws.TypeError, Message: "API tokens can't open tunnel requests"})
+				conn.Write(ctx, websocket.MessageText, errMsg)
+				continue
+			}
 			wing := s.findAnyWingByWingID(req.WingID)
 			if wing == nil || !s.canAccessWing(userID, wing, userOrgIDs) {
 				errMsg, _ := json.Marshal(ws.ErrorMsg{Type: ws.TypeError, Message: "wing not found"})
 				conn.Write(ctx, websocket.MessageText, errMsg)
 				continue
 			}
+			s.noteBrowserWing(conn, wing)
 			// Inject user identity into tunnel request envelope
 			req.SenderUserID = userID
 			req.SenderEmail = userEmail
@@ -464,9 +553,16 @@ func (s *Server) handlePTYWS(w http.ResponseWriter, r *http.Request) {
 					}
 				}
 			}
+			route := &tunnelRoute{browser: conn, wingConn: wing.ID}
+			if !req.LongLived {
+				route.sent = time.Now()
+				requestID := req.RequestID
+				time.AfterFunc(tunnelRequestTimeout, func() { s.expireTunnelRequest(requestID, route) })
+			}
 			s.tunnelMu.Lock()
-			s.tunnelRequests[req.RequestID] = conn
+			s.tunnelRequests[req.RequestID] = route
 			s.tunnelMu.Unlock()
+			s.metrics.tunnelRequests.Add(1)
 			fwdTunnel, _ := json.Marshal(req)
 			wing.Conn.Write(ctx, websocket.MessageText, fwdTunnel)
 		}
@@ -513,6 +609,7 @@ func (s *Server) forwardPTYToBrowser(sessionID string, data []byte) {
 		route.mu.Lock()
 		bc := route.BrowserConn
 		userID := route.UserID
+		wingID := route.WingID
 		agent := route.Agent
 		cwd := route.CWD
 		viewers := make(map[string]*websocket.Conn, len(route.Viewers))
@@ -536,6 +633,19 @@ func (s *Server) forwardPTYToBrowser(sessionID string, data []byte) {
 			c.SendExit(sessionID, agent, cwd, exited.ExitCode, clickURL)
 		})
 
+		var orgID string
+		if wing := s.findAnyWingByWingID(wingID); wing != nil {
+			orgID = wing.OrgID
+		}
+		s.emitWebhook("session.exited", userID, orgID, map[string]any{
+			"session_id": sessionID,
+			"wing_id":    wingID,
+			"user_id":    userID,
+			"agent":      agent,
+			"cwd":        cwd,
+			"exit_code":  exited.ExitCode,
+		})
+
 		s.PTY.Remove(sessionID)
 		return
 	}
@@ -599,6 +709,7 @@ func (s *Server) forwardPTYToBrowser(sessionID string, data []byte) {
 			route.BrowserConn = nil
 			route.mu.Unlock()
 			bc.Close(websocket.StatusNormalClosure, "bandwidth exceeded")
+			s.emitBandwidthExceeded(userID)
 			return
 		}
 	}
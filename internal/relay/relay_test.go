@@ -1,16 +1,27 @@
 package relay
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/ehrlich-b/wingthing/internal/ws"
 )
 
+// testStore opens an in-memory SQLite store, or a throwaway schema in the
+// PostgreSQL database at WT_TEST_POSTGRES_DSN so the suite covers both.
 func testStore(t *testing.T) *RelayStore {
 	t.Helper()
+	if dsn := os.Getenv("WT_TEST_POSTGRES_DSN"); dsn != "" {
+		return pgTestStore(t, dsn)
+	}
 	s, err := OpenRelay(":memory:")
 	if err != nil {
 		t.Fatalf("open relay store: %v", err)
@@ -126,6 +137,121 @@ func TestRelayStoreDeviceCodeFlow(t *testing.T) {
 	}
 }
 
+func TestRelayStoreAuditHeadOnlyAdvances(t *testing.T) {
+	s := testStore(t)
+
+	h := AuditHead{WingID: "w1", SessionID: "s1", UserID: "u1", Seq: 4, Head: "aa", SignedAt: 100, Sig: "sig", SignerKey: "k1"}
+	if err := s.SaveAuditHead(h); err != nil {
+		t.Fatalf("save audit head: %v", err)
+	}
+
+	// Rewind, key swap and owner swap are ignored
+	for _, bad := range []AuditHead{
+		{WingID: "w1", SessionID: "s1", UserID: "u1", Seq: 2, Head: "bb", SignerKey: "k1"},
+		{WingID: "w1", SessionID: "s1", UserID: "u1", Seq: 9, Head: "cc", SignerKey: "k2"},
+		{WingID: "w1", SessionID: "s1", UserID: "u2", Seq: 9, Head: "dd", SignerKey: "k1"},
+	} {
+		if err := s.SaveAuditHead(bad); err != nil {
+			t.Fatalf("save audit head: %v", err)
+		}
+	}
+	got, err := s.GetAuditHead("w1", "s1")
+	if err != nil || got == nil {
+		t.Fatalf("get audit head: %v, %v", got, err)
+	}
+	if got.Seq != 4 || got.Head != "aa" {
+		t.Errorf("head = %d/%s, want 4/aa", got.Seq, got.Head)
+	}
+
+	// Seal at the same seq, then nothing moves it
+	h.Sealed, h.Sig = true, "sig2"
+	s.SaveAuditHead(h)
+	s.SaveAuditHead(AuditHead{WingID: "w1", SessionID: "s1", UserID: "u1", Seq: 20, Head: "ee", SignerKey: "k1"})
+	got, _ = s.GetAuditHead("w1", "s1")
+	if !got.Sealed || got.Seq != 4 || got.Sig != "sig2" {
+		t.Errorf("after seal: %+v", got)
+	}
+
+	if none, err := s.GetAuditHead("w1", "nope"); err != nil || none != nil {
+		t.Errorf("missing head = %v, %v", none, err)
+	}
+}
+
+// signedAuditHead signs a head the way the egg's audit chain does.
+func signedAuditHead(key ed25519.PrivateKey, seq int, head string) ws.AuditHead {
+	msg := fmt.Sprintf("wt-audit-v1\n%s\n%s\n%d\n%s\n%d", "s1", "s", seq, head, 100)
+	return ws.AuditHead{
+		SessionID: "s1",
+		Seq:       seq,
+		Head:      head,
+		SignedAt:  100,
+		Sig:       base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(msg))),
+		Key:       base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}
+}
+
+func TestSaveAuditHeadChecksSigner(t *testing.T) {
+	srv, _ := testServer(t)
+	_, key, _ := ed25519.GenerateKey(nil)
+	_, other, _ := ed25519.GenerateKey(nil)
+
+	srv.saveAuditHead("w1", "u1", signedAuditHead(key, 4, "aa"))
+
+	// A forged signature and a head from another key are refused
+	forged := signedAuditHead(key, 6, "bb")
+	forged.Head = "cc"
+	srv.saveAuditHead("w1", "u1", forged)
+	srv.saveAuditHead("w1", "u1", signedAuditHead(other, 9, "dd"))
+
+	got, err := srv.Store.GetAuditHead("w1", "s1")
+	if err != nil || got == nil {
+		t.Fatalf("get audit head: %v, %v", got, err)
+	}
+	if got.Seq != 4 || got.Head != "aa" {
+		t.Errorf("head = %d/%s, want 4/aa", got.Seq, got.Head)
+	}
+
+	srv.saveAuditHead("w1", "u1", signedAuditHead(key, 7, "ee"))
+	if got, _ = srv.Store.GetAuditHead("w1", "s1"); got.Seq != 7 {
+		t.Errorf("head from the notarized key not saved: seq %d", got.Seq)
+	}
+}
+
+func TestAuditHeadEndpointOwnerOnly(t *testing.T) {
+	srv, ts := testServer(t)
+	token, userID := createTestToken(t, srv.Store, "dev1")
+	other, _ := createTestToken(t, srv.Store, "dev2")
+	srv.Store.SaveAuditHead(AuditHead{WingID: "w1", SessionID: "s1", UserID: userID, Seq: 3, Head: "ab", Sig: "sig", SignerKey: "k1"})
+
+	get := func(tok string) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+"/api/app/wings/w1/sessions/s1/audit-head", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get(token)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("owner status = %d", resp.StatusCode)
+	}
+	var head struct {
+		Seq  int    `json:"seq"`
+		Head string `json:"head"`
+		Key  string `json:"key"`
+	}
+	json.NewDecoder(resp.Body).Decode(&head)
+	if head.Seq != 3 || head.Head != "ab" || head.Key != "k1" {
+		t.Errorf("head = %+v", head)
+	}
+	if resp := get(other); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other user status = %d, want 404", resp.StatusCode)
+	}
+}
+
 func TestHealthEndpoint(t *testing.T) {
 	_, ts := testServer(t)
 
@@ -433,3 +559,36 @@ func TestWSHostRouting(t *testing.T) {
 		})
 	}
 }
+
+func TestPreviewHostRouting(t *testing.T) {
+	store := testStore(t)
+	srv := NewServer(store, ServerConfig{PreviewHost: "preview.test.local"})
+
+	tests := []struct {
+		name string
+		host string
+		path string
+		want int
+	}{
+		{"preview host / blocked", "preview.test.local", "/", 404},
+		{"preview host /app blocked", "preview.test.local", "/app/", 404},
+		{"preview host /api/app/me blocked", "preview.test.local", "/api/app/me", 404},
+		{"preview host /health blocked", "preview.test.local", "/health", 404},
+		{"preview host unknown bridge file", "preview.test.local", "/__wt/other.js", 404},
+		{"preview subdomain / blocked", "s1-abc.preview.test.local", "/", 404},
+		{"preview subdomain /api/app/me blocked", "s1-abc.preview.test.local", "/api/app/me", 404},
+		{"preview subdomain bad label", "a.b.preview.test.local", "/health", 404},
+		{"main host /health allowed", "app.test.local", "/health", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("%s %s: status = %d, want %d", tt.host, tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
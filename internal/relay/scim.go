@@ -0,0 +1,1129 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SCIM 2.0 (RFC 7643/7644) provisioning. An org owner or admin issues a
+// bearer token; the org's IdP then pushes users and groups to /scim/v2.
+// A provisioned, active user is an org member. Their role is the highest of
+// the IdP's roles attribute and any SCIM group the org's SSO policy maps to
+// a role. Deactivating or deleting a user removes them from the org, frees
+// their seat and closes their terminals on the org's wings.
+
+const (
+	scimUserSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSPConfSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	// scimUserProvider marks accounts created by provisioning that nobody
+	// has signed in to yet. The first SSO or magic-link sign-in with the
+	// same email claims the account (RelayStore.ClaimSCIMUser), and an
+	// existing account that verifies the email adopts it (setVerifiedEmail).
+	// Either way the orgs that provisioned it still wait on their invites.
+	scimUserProvider = "scim"
+
+	scimMaxPage = 200
+)
+
+// hashToken is how SCIM and personal access tokens are stored: only the
+// sha256 of the secret, so a database leak does not leak credentials.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeSCIM(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeSCIMError(w http.ResponseWriter, code int, scimType, detail string) {
+	body := map[string]any{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(code),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	writeSCIM(w, code, body)
+}
+
+// --- Token management (session auth) ---
+
+// handleCreateSCIMToken issues a new SCIM token for an org, replacing the
+// previous one. The token is shown once. POST /api/orgs/{orgID}/scim/token
+func (s *Server) handleCreateSCIMToken(w http.ResponseWriter, r *http.Request) {
+	user, org := s.scimTokenAdmin(w, r)
+	if org == nil {
+		return
+	}
+	token := "wtscim_" + generateToken()
+	if err := s.Store.SetSCIMToken(org.ID, hashToken(token), user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.Store.AppendOrgAudit(user.ID, org.ID, "scim_token_created", strPtr("org="+org.Slug))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token": token,
+		"url":   s.Config.BaseURL + "/scim/v2",
+	})
+}
+
+// handleDeleteSCIMToken revokes an org's SCIM token. DELETE /api/orgs/{orgID}/scim/token
+func (s *Server) handleDeleteSCIMToken(w http.ResponseWriter, r *http.Request) {
+	user, org := s.scimTokenAdmin(w, r)
+	if org == nil {
+		return
+	}
+	if err := s.Store.DeleteSCIMToken(org.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.Store.AppendOrgAudit(user.ID, org.ID, "scim_token_revoked", strPtr("org="+org.Slug))
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Server) scimTokenAdmin(w http.ResponseWriter, r *http.Request) (*User, *Org) {
+	user := s.sessionUser(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "not logged in")
+		return nil, nil
+	}
+	org, err := s.Store.GetOrgByID(r.PathValue("orgID"))
+	if err != nil || org == nil {
+		writeError(w, http.StatusNotFound, "org not found")
+		return nil, nil
+	}
+	role := s.Store.GetOrgMemberRole(org.ID, user.ID)
+	if role != "owner" && role != "admin" {
+		writeError(w, http.StatusForbidden, "only owners and admins can manage provisioning")
+		return nil, nil
+	}
+	return user, org
+}
+
+// scimOrg authenticates a SCIM request by its bearer token.
+func (s *Server) scimOrg(w http.ResponseWriter, r *http.Request) *Org {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeSCIMError(w, http.StatusUnauthorized, "", "missing bearer token")
+		return nil
+	}
+	org, err := s.Store.GetOrgBySCIMToken(hashToken(strings.TrimSpace(token)))
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return nil
+	}
+	if org == nil {
+		writeSCIMError(w, http.StatusUnauthorized, "", "invalid token")
+		return nil
+	}
+	return org
+}
+
+func (s *Server) handleSCIMServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	if s.scimOrg(w, r) == nil {
+		return
+	}
+	unsupported := map[string]bool{"supported": false}
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimSPConfSchema},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxPage},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Org provisioning token from POST /api/orgs/{orgID}/scim/token",
+		}},
+	})
+}
+
+// --- Role sync ---
+
+// scimRole is the org role a provisioned user should hold.
+func (s *Server) scimRole(org *Org, su *SCIMUser) string {
+	role := "member"
+	if su.Role == "admin" {
+		role = "admin"
+	}
+	if pol, ok := s.ssoPolicy(org); ok {
+		groups, _ := s.Store.ListSCIMGroupsForUser(org.ID, su.UserID)
+		if r := ssoRole(pol, groups); ssoRoleRank[r] > ssoRoleRank[role] {
+			role = r
+		}
+	}
+	return role
+}
+
+// scimSync brings a user's org membership in line with their SCIM record:
+// active users are members with scimRole, everyone else is removed along
+// with their entitlement, pending invites and wing access. Pending users
+// are only invited; SCIM takes over their membership once they accept.
+func (s *Server) scimSync(org *Org, userID string) error {
+	if org.OwnerUserID == userID {
+		return nil
+	}
+	su, err := s.Store.GetSCIMUser(org.ID, userID)
+	if err != nil {
+		return err
+	}
+	want := ""
+	if su != nil && su.Active {
+		want = s.scimRole(org, su)
+	}
+	have := s.Store.GetOrgMemberRole(org.ID, userID)
+	if su != nil && su.Pending {
+		if have == "" {
+			if want == "" {
+				s.revokeSCIMInvite(org, userID)
+			}
+			return nil
+		}
+		su.Pending = false
+		if err := s.Store.UpsertSCIMUser(su); err != nil {
+			return err
+		}
+	}
+	detail := fmt.Sprintf("org=%s role=%s", org.Slug, want)
+	switch {
+	case want == have:
+		return nil
+	case want == "":
+		if err := s.Store.RemoveOrgMember(org.ID, userID); err != nil {
+			return err
+		}
+		s.revokeOrgEntitlement(org.ID, userID)
+		if u, _ := s.Store.GetUserByID(userID); u != nil && u.Email != nil {
+			s.Store.RevokeOrgInvitesForEmail(org.ID, *u.Email)
+		}
+		s.Store.AppendOrgAudit(userID, org.ID, "scim_deprovision", strPtr("org="+org.Slug))
+	case have == "":
+		if err := s.Store.AddOrgMember(org.ID, userID, want); err != nil {
+			return err
+		}
+		s.grantOrgEntitlement(org.ID, userID)
+		s.Store.AppendOrgAudit(userID, org.ID, "scim_provision", strPtr(detail))
+	default:
+		if err := s.Store.SetOrgMemberRole(org.ID, userID, want); err != nil {
+			return err
+		}
+		s.Store.AppendOrgAudit(userID, org.ID, "scim_role", strPtr(detail))
+	}
+	s.refreshUserOrgSubs(userID)
+	return nil
+}
+
+// --- Users ---
+
+type scimMulti struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimUserInput struct {
+	UserName    string `json:"userName"`
+	ExternalID  string `json:"externalId"`
+	DisplayName string `json:"displayName"`
+	Name        struct {
+		Formatted  string `json:"formatted"`
+		GivenName  string `json:"givenName"`
+		FamilyName string `json:"familyName"`
+	} `json:"name"`
+	Emails []scimMulti `json:"emails"`
+	Roles  []scimMulti `json:"roles"`
+	Active *bool       `json:"active"`
+}
+
+func (in *scimUserInput) email() string {
+	pick := ""
+	for _, e := range in.Emails {
+		if e.Primary || pick == "" {
+			pick = e.Value
+		}
+		if e.Primary {
+			break
+		}
+	}
+	if pick == "" && strings.Contains(in.UserName, "@") {
+		pick = in.UserName
+	}
+	return strings.ToLower(strings.TrimSpace(pick))
+}
+
+func (in *scimUserInput) displayName() string {
+	switch {
+	case in.DisplayName != "":
+		return in.DisplayName
+	case in.Name.Formatted != "":
+		return in.Name.Formatted
+	case in.Name.GivenName != "" || in.Name.FamilyName != "":
+		return strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName)
+	}
+	return in.UserName
+}
+
+func (in *scimUserInput) role() string {
+	for _, r := range in.Roles {
+		if strings.EqualFold(r.Value, "admin") {
+			return "admin"
+		}
+	}
+	return "member"
+}
+
+func (s *Server) scimUserResource(org *Org, su *SCIMUser) map[string]any {
+	res := map[string]any{
+		"schemas":  []string{scimUserSchema},
+		"id":       su.UserID,
+		"userName": su.UserName,
+		"active":   su.Active,
+		"roles":    []scimMulti{{Value: su.Role, Primary: true}},
+		"meta": map[string]any{
+			"resourceType": "User",
+			"created":      su.CreatedAt.UTC().Format(time.RFC3339),
+			"lastModified": su.UpdatedAt.UTC().Format(time.RFC3339),
+			"location":     s.Config.BaseURL + "/scim/v2/Users/" + su.UserID,
+		},
+	}
+	if su.ExternalID != "" {
+		res["externalId"] = su.ExternalID
+	}
+	if u, _ := s.Store.GetUserByID(su.UserID); u != nil {
+		res["displayName"] = u.DisplayName
+		if u.Email != nil {
+			res["emails"] = []scimMulti{{Value: *u.Email, Type: "work", Primary: true}}
+		}
+	}
+	groups := []map[string]string{}
+	all, _ := s.Store.ListSCIMGroups(org.ID)
+	for _, g := range all {
+		for _, m := range g.Members {
+			if m == su.UserID {
+				groups = append(groups, map[string]string{"value": g.ID, "display": g.DisplayName})
+			}
+		}
+	}
+	res["groups"] = groups
+	return res
+}
+
+func (s *Server) handleSCIMListUsers(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	attr, value, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	users, err := s.Store.ListSCIMUsers(org.ID)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	var resources []any
+	for _, su := range users {
+		match := true
+		switch attr {
+		case "":
+		case "username":
+			match = strings.EqualFold(su.UserName, value)
+		case "externalid":
+			match = su.ExternalID == value
+		case "id":
+			match = su.UserID == value
+		case "emails", "emails.value":
+			u, _ := s.Store.GetUserByID(su.UserID)
+			match = u != nil && u.Email != nil && strings.EqualFold(*u.Email, value)
+		default:
+			writeSCIMError(w, http.StatusBadRequest, "invalidFilter", "unsupported filter attribute "+attr)
+			return
+		}
+		if match {
+			resources = append(resources, s.scimUserResource(org, su))
+		}
+	}
+	writeSCIMList(w, r, resources)
+}
+
+func (s *Server) handleSCIMGetUser(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	su := s.scimUser(w, org, r.PathValue("id"))
+	if su == nil {
+		return
+	}
+	writeSCIM(w, http.StatusOK, s.scimUserResource(org, su))
+}
+
+func (s *Server) scimUser(w http.ResponseWriter, org *Org, userID string) *SCIMUser {
+	su, err := s.Store.GetSCIMUser(org.ID, userID)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return nil
+	}
+	if su == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "user not found")
+		return nil
+	}
+	return su
+}
+
+// handleSCIMCreateUser provisions a user. A placeholder account is created
+// for the user's first sign-in to claim. Unless the account is already a
+// member, it is invited and joins only once whoever signs in with the email
+// accepts.
+func (s *Server) handleSCIMCreateUser(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	var in scimUserInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "invalid JSON")
+		return
+	}
+	if in.UserName == "" {
+		writeSCIMError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	email := in.email()
+	if email == "" {
+		writeSCIMError(w, http.StatusBadRequest, "invalidValue", "an email is required (emails or an email userName)")
+		return
+	}
+	if s.scimUserNameTaken(org, in.UserName, "") {
+		writeSCIMError(w, http.StatusConflict, "uniqueness", "userName already provisioned")
+		return
+	}
+
+	user, err := s.Store.GetUserByEmail(email)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if user == nil {
+		user = &User{
+			ID:          uuid.New().String(),
+			Provider:    scimUserProvider,
+			ProviderID:  org.ID + ":" + in.UserName,
+			DisplayName: in.displayName(),
+		}
+		if err := s.Store.UpsertUser(user); err != nil {
+			writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+		if err := s.Store.UpdateUserEmail(user.ID, email); err != nil {
+			writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	} else if su, _ := s.Store.GetSCIMUser(org.ID, user.ID); su != nil {
+		writeSCIMError(w, http.StatusConflict, "uniqueness", "a user with this email is already provisioned")
+		return
+	}
+
+	su := &SCIMUser{
+		OrgID:      org.ID,
+		UserID:     user.ID,
+		UserName:   in.UserName,
+		ExternalID: in.ExternalID,
+		Role:       in.role(),
+		Active:     in.Active == nil || *in.Active,
+		// Only existing members are linked outright. Everyone else, including
+		// a fresh placeholder, gets an invite to accept, so an org can't pull
+		// in a stranger by provisioning their email.
+		Pending: s.Store.GetOrgMemberRole(org.ID, user.ID) == "",
+	}
+	if err := s.Store.UpsertSCIMUser(su); err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if su.Pending && su.Active {
+		s.inviteSCIMUser(org, su, email)
+	}
+	if err := s.scimSync(org, user.ID); err != nil {
+		// Most likely out of seats. Keep nothing half-provisioned.
+		s.Store.DeleteSCIMUser(org.ID, user.ID)
+		writeSCIMError(w, http.StatusForbidden, "", err.Error())
+		return
+	}
+	log.Printf("scim %s: provisioned %s (%s)", org.Slug, in.UserName, user.ID)
+	su, _ = s.Store.GetSCIMUser(org.ID, user.ID)
+	writeSCIM(w, http.StatusCreated, s.scimUserResource(org, su))
+}
+
+// inviteSCIMUser invites an account the IdP provisioned, with the role SCIM
+// would give it.
+func (s *Server) inviteSCIMUser(org *Org, su *SCIMUser, email string) {
+	role := s.scimRole(org, su)
+	email = strings.ToLower(email)
+	token := generateToken()
+	if err := s.Store.CreateOrgInvite(uuid.New().String(), org.ID, email, token, org.OwnerUserID, role); err != nil {
+		log.Printf("scim %s: invite %s: %v", org.Slug, email, err)
+		return
+	}
+	s.Store.AppendOrgAudit(su.UserID, org.ID, "invite_created", strPtr(fmt.Sprintf("org=%s email=%s role=%s via=scim", org.Slug, email, role)))
+	if s.Config.SMTPHost != "" {
+		s.sendInviteEmail(email, org.Name, s.Config.BaseURL+"/invite/"+token)
+	}
+}
+
+// revokeSCIMInvite drops a pending user's unaccepted invites.
+func (s *Server) revokeSCIMInvite(org *Org, userID string) {
+	if u, _ := s.Store.GetUserByID(userID); u != nil && u.Email != nil {
+		s.Store.RevokeOrgInvitesForEmail(org.ID, *u.Email)
+	}
+}
+
+func (s *Server) scimUserNameTaken(org *Org, userName, exceptUserID string) bool {
+	users, _ := s.Store.ListSCIMUsers(org.ID)
+	for _, su := range users {
+		if su.UserID != exceptUserID && strings.EqualFold(su.UserName, userName) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSCIMReplaceUser handles PUT: the body is the user's full new state.
+func (s *Server) handleSCIMReplaceUser(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	su := s.scimUser(w, org, r.PathValue("id"))
+	if su == nil {
+		return
+	}
+	var in scimUserInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "invalid JSON")
+		return
+	}
+	if in.UserName == "" {
+		in.UserName = su.UserName
+	}
+	s.scimUpdateUser(w, org, su, &in)
+}
+
+// handleSCIMPatchUser applies a PatchOp. Okta deactivates with
+// {"op":"replace","value":{"active":false}}, Entra ID with
+// {"op":"Replace","path":"active","value":"False"}; both are accepted.
+func (s *Server) handleSCIMPatchUser(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	su := s.scimUser(w, org, r.PathValue("id"))
+	if su == nil {
+		return
+	}
+	ops, ok := decodeSCIMPatch(w, r)
+	if !ok {
+		return
+	}
+	// Start from the current state, then apply the operations
+	in := scimUserInput{UserName: su.UserName, ExternalID: su.ExternalID}
+	active := su.Active
+	in.Active = &active
+	if su.Role == "admin" {
+		in.Roles = []scimMulti{{Value: "admin"}}
+	}
+	if u, _ := s.Store.GetUserByID(su.UserID); u != nil {
+		in.DisplayName = u.DisplayName
+		if u.Email != nil {
+			in.Emails = []scimMulti{{Value: *u.Email, Primary: true}}
+		}
+	}
+	for _, op := range ops {
+		if err := in.apply(op); err != nil {
+			writeSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	s.scimUpdateUser(w, org, su, &in)
+}
+
+func (s *Server) scimUpdateUser(w http.ResponseWriter, org *Org, su *SCIMUser, in *scimUserInput) {
+	active := in.Active == nil || *in.Active
+	if !active && su.UserID == org.OwnerUserID {
+		writeSCIMError(w, http.StatusBadRequest, "mutability", "the org owner cannot be deprovisioned")
+		return
+	}
+	if s.scimUserNameTaken(org, in.UserName, su.UserID) {
+		writeSCIMError(w, http.StatusConflict, "uniqueness", "userName already provisioned")
+		return
+	}
+	wasActive := su.Active
+	su.UserName = in.UserName
+	su.ExternalID = in.ExternalID
+	su.Role = in.role()
+	su.Active = active
+	if err := s.Store.UpsertSCIMUser(su); err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	// Only placeholder accounts take their profile from the IdP; a claimed
+	// account belongs to whoever signs in with it.
+	if u, _ := s.Store.GetUserByID(su.UserID); u != nil && u.Provider == scimUserProvider {
+		u.DisplayName = in.displayName()
+		s.Store.UpsertUser(u)
+		if email := in.email(); email != "" && (u.Email == nil || *u.Email != email) {
+			if err := s.Store.UpdateUserEmail(u.ID, email); err != nil {
+				log.Printf("scim %s: email %s already in use, not set on %s", org.Slug, email, u.ID)
+			}
+		}
+	}
+	if su.Pending && active && !wasActive {
+		if u, _ := s.Store.GetUserByID(su.UserID); u != nil && u.Email != nil {
+			s.inviteSCIMUser(org, su, *u.Email)
+		}
+	}
+	if err := s.scimSync(org, su.UserID); err != nil {
+		if !wasActive && active {
+			su.Active = false
+			s.Store.UpsertSCIMUser(su)
+		}
+		writeSCIMError(w, http.StatusForbidden, "", err.Error())
+		return
+	}
+	su, _ = s.Store.GetSCIMUser(org.ID, su.UserID)
+	writeSCIM(w, http.StatusOK, s.scimUserResource(org, su))
+}
+
+// handleSCIMDeleteUser deprovisions a user and forgets their SCIM record.
+func (s *Server) handleSCIMDeleteUser(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	su := s.scimUser(w, org, r.PathValue("id"))
+	if su == nil {
+		return
+	}
+	if su.UserID == org.OwnerUserID {
+		writeSCIMError(w, http.StatusBadRequest, "mutability", "the org owner cannot be deprovisioned")
+		return
+	}
+	if err := s.Store.DeleteSCIMUser(org.ID, su.UserID); err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if su.Pending {
+		s.revokeSCIMInvite(org, su.UserID)
+	}
+	if err := s.scimSync(org, su.UserID); err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	log.Printf("scim %s: deleted %s (%s)", org.Slug, su.UserName, su.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Groups ---
+
+type scimGroupInput struct {
+	DisplayName string      `json:"displayName"`
+	ExternalID  string      `json:"externalId"`
+	Members     []scimMulti `json:"members"`
+}
+
+func (s *Server) scimGroupResource(g *SCIMGroup) map[string]any {
+	members := []map[string]string{}
+	for _, uid := range g.Members {
+		m := map[string]string{"value": uid, "$ref": s.Config.BaseURL + "/scim/v2/Users/" + uid}
+		if u, _ := s.Store.GetUserByID(uid); u != nil {
+			m["display"] = u.DisplayName
+		}
+		members = append(members, m)
+	}
+	res := map[string]any{
+		"schemas":     []string{scimGroupSchema},
+		"id":          g.ID,
+		"displayName": g.DisplayName,
+		"members":     members,
+		"meta": map[string]any{
+			"resourceType": "Group",
+			"created":      g.CreatedAt.UTC().Format(time.RFC3339),
+			"lastModified": g.UpdatedAt.UTC().Format(time.RFC3339),
+			"location":     s.Config.BaseURL + "/scim/v2/Groups/" + g.ID,
+		},
+	}
+	if g.ExternalID != "" {
+		res["externalId"] = g.ExternalID
+	}
+	return res
+}
+
+func (s *Server) handleSCIMListGroups(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	attr, value, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	groups, err := s.Store.ListSCIMGroups(org.ID)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	var resources []any
+	for _, g := range groups {
+		match := true
+		switch attr {
+		case "":
+		case "displayname":
+			match = strings.EqualFold(g.DisplayName, value)
+		case "externalid":
+			match = g.ExternalID == value
+		case "id":
+			match = g.ID == value
+		default:
+			writeSCIMError(w, http.StatusBadRequest, "invalidFilter", "unsupported filter attribute "+attr)
+			return
+		}
+		if match {
+			resources = append(resources, s.scimGroupResource(g))
+		}
+	}
+	writeSCIMList(w, r, resources)
+}
+
+func (s *Server) handleSCIMGetGroup(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	g := s.scimGroup(w, org, r.PathValue("id"))
+	if g == nil {
+		return
+	}
+	writeSCIM(w, http.StatusOK, s.scimGroupResource(g))
+}
+
+func (s *Server) scimGroup(w http.ResponseWriter, org *Org, id string) *SCIMGroup {
+	g, err := s.Store.GetSCIMGroup(org.ID, id)
+	if err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return nil
+	}
+	if g == nil {
+		writeSCIMError(w, http.StatusNotFound, "", "group not found")
+		return nil
+	}
+	return g
+}
+
+func (s *Server) handleSCIMCreateGroup(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	var in scimGroupInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "invalid JSON")
+		return
+	}
+	g := &SCIMGroup{ID: uuid.New().String(), OrgID: org.ID}
+	s.scimSaveGroup(w, org, g, nil, &in, http.StatusCreated)
+}
+
+func (s *Server) handleSCIMReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	g := s.scimGroup(w, org, r.PathValue("id"))
+	if g == nil {
+		return
+	}
+	var in scimGroupInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "invalid JSON")
+		return
+	}
+	if in.DisplayName == "" {
+		in.DisplayName = g.DisplayName
+	}
+	s.scimSaveGroup(w, org, g, g.Members, &in, http.StatusOK)
+}
+
+func (s *Server) handleSCIMPatchGroup(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	g := s.scimGroup(w, org, r.PathValue("id"))
+	if g == nil {
+		return
+	}
+	ops, ok := decodeSCIMPatch(w, r)
+	if !ok {
+		return
+	}
+	in := scimGroupInput{DisplayName: g.DisplayName, ExternalID: g.ExternalID}
+	for _, uid := range g.Members {
+		in.Members = append(in.Members, scimMulti{Value: uid})
+	}
+	for _, op := range ops {
+		if err := in.apply(op); err != nil {
+			writeSCIMError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	s.scimSaveGroup(w, org, g, g.Members, &in, http.StatusOK)
+}
+
+// scimSaveGroup stores a group's new state and re-syncs the roles of every
+// user who joined or left it.
+func (s *Server) scimSaveGroup(w http.ResponseWriter, org *Org, g *SCIMGroup, before []string, in *scimGroupInput, code int) {
+	if in.DisplayName == "" {
+		writeSCIMError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	groups, _ := s.Store.ListSCIMGroups(org.ID)
+	for _, other := range groups {
+		if other.ID != g.ID && strings.EqualFold(other.DisplayName, in.DisplayName) {
+			writeSCIMError(w, http.StatusConflict, "uniqueness", "displayName already exists")
+			return
+		}
+	}
+	var members []string
+	seen := map[string]bool{}
+	for _, m := range in.Members {
+		if seen[m.Value] {
+			continue
+		}
+		if su, _ := s.Store.GetSCIMUser(org.ID, m.Value); su == nil {
+			writeSCIMError(w, http.StatusBadRequest, "invalidValue", "unknown member "+m.Value)
+			return
+		}
+		seen[m.Value] = true
+		members = append(members, m.Value)
+	}
+	g.DisplayName, g.ExternalID, g.Members = in.DisplayName, in.ExternalID, members
+	if err := s.Store.SaveSCIMGroup(g); err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	s.scimSyncUsers(org, append(before, members...))
+	saved, _ := s.Store.GetSCIMGroup(org.ID, g.ID)
+	writeSCIM(w, code, s.scimGroupResource(saved))
+}
+
+func (s *Server) handleSCIMDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	org := s.scimOrg(w, r)
+	if org == nil {
+		return
+	}
+	g := s.scimGroup(w, org, r.PathValue("id"))
+	if g == nil {
+		return
+	}
+	if err := s.Store.DeleteSCIMGroup(org.ID, g.ID); err != nil {
+		writeSCIMError(w, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	s.scimSyncUsers(org, g.Members)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) scimSyncUsers(org *Org, userIDs []string) {
+	done := map[string]bool{}
+	for _, uid := range userIDs {
+		if done[uid] {
+			continue
+		}
+		done[uid] = true
+		if err := s.scimSync(org, uid); err != nil {
+			log.Printf("scim %s: sync %s: %v", org.Slug, uid, err)
+		}
+	}
+}
+
+// --- PatchOp ---
+
+type scimPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func decodeSCIMPatch(w http.ResponseWriter, r *http.Request) ([]scimPatchOp, bool) {
+	var req struct {
+		Schemas    []string      `json:"schemas"`
+		Operations []scimPatchOp `json:"Operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "invalid JSON")
+		return nil, false
+	}
+	if len(req.Operations) == 0 {
+		writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "no operations")
+		return nil, false
+	}
+	for i := range req.Operations {
+		req.Operations[i].Op = strings.ToLower(req.Operations[i].Op)
+		switch req.Operations[i].Op {
+		case "add", "replace", "remove":
+		default:
+			writeSCIMError(w, http.StatusBadRequest, "invalidSyntax", "unknown op "+req.Operations[i].Op)
+			return nil, false
+		}
+	}
+	return req.Operations, true
+}
+
+// splitPathless turns a path-less add/replace into one op per attribute.
+func (op scimPatchOp) splitPathless() ([]scimPatchOp, error) {
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &attrs); err != nil {
+		return nil, errors.New("value must be an object when path is empty")
+	}
+	var ops []scimPatchOp
+	for k, v := range attrs {
+		ops = append(ops, scimPatchOp{Op: op.Op, Path: k, Value: v})
+	}
+	return ops, nil
+}
+
+func (in *scimUserInput) apply(op scimPatchOp) error {
+	if op.Path == "" {
+		ops, err := op.splitPathless()
+		if err != nil {
+			return err
+		}
+		for _, o := range ops {
+			if err := in.apply(o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	path := strings.ToLower(op.Path)
+	if op.Op == "remove" {
+		switch {
+		case strings.HasPrefix(path, "roles"):
+			in.Roles = nil
+		case path == "externalid":
+			in.ExternalID = ""
+		case path == "displayname":
+			in.DisplayName = ""
+		}
+		return nil
+	}
+	switch {
+	case path == "active":
+		b, err := scimBool(op.Value)
+		if err != nil {
+			return err
+		}
+		in.Active = &b
+	case path == "username":
+		return json.Unmarshal(op.Value, &in.UserName)
+	case path == "externalid":
+		return json.Unmarshal(op.Value, &in.ExternalID)
+	case path == "displayname":
+		return json.Unmarshal(op.Value, &in.DisplayName)
+	case path == "name":
+		return json.Unmarshal(op.Value, &in.Name)
+	case path == "name.formatted":
+		return json.Unmarshal(op.Value, &in.Name.Formatted)
+	case path == "name.givenname":
+		return json.Unmarshal(op.Value, &in.Name.GivenName)
+	case path == "name.familyname":
+		return json.Unmarshal(op.Value, &in.Name.FamilyName)
+	case strings.HasPrefix(path, "emails"):
+		vals, err := scimMultiValues(op.Value)
+		if err != nil {
+			return err
+		}
+		in.Emails = vals
+	case strings.HasPrefix(path, "roles"):
+		vals, err := scimMultiValues(op.Value)
+		if err != nil {
+			return err
+		}
+		in.Roles = vals
+	}
+	// Anything else (enterprise extension, phone numbers, ...) is not stored
+	return nil
+}
+
+var scimMemberPath = regexp.MustCompile(`(?i)^members\[value eq "([^"]+)"\]$`)
+
+func (in *scimGroupInput) apply(op scimPatchOp) error {
+	if op.Path == "" {
+		ops, err := op.splitPathless()
+		if err != nil {
+			return err
+		}
+		for _, o := range ops {
+			if err := in.apply(o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if m := scimMemberPath.FindStringSubmatch(op.Path); m != nil {
+		if op.Op != "remove" {
+			return errors.New("only remove is supported on a member filter")
+		}
+		in.removeMembers(map[string]bool{m[1]: true})
+		return nil
+	}
+	switch strings.ToLower(op.Path) {
+	case "displayname":
+		if op.Op == "remove" {
+			return errors.New("displayName is required")
+		}
+		return json.Unmarshal(op.Value, &in.DisplayName)
+	case "externalid":
+		if op.Op == "remove" {
+			in.ExternalID = ""
+			return nil
+		}
+		return json.Unmarshal(op.Value, &in.ExternalID)
+	case "members":
+		var vals []scimMulti
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &vals); err != nil {
+				return errors.New("members must be an array")
+			}
+		}
+		switch op.Op {
+		case "add":
+			in.Members = append(in.Members, vals...)
+		case "replace":
+			in.Members = vals
+		case "remove":
+			if len(vals) == 0 {
+				in.Members = nil
+				return nil
+			}
+			drop := map[string]bool{}
+			for _, v := range vals {
+				drop[v.Value] = true
+			}
+			in.removeMembers(drop)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported path %q", op.Path)
+}
+
+func (in *scimGroupInput) removeMembers(drop map[string]bool) {
+	kept := in.Members[:0]
+	for _, m := range in.Members {
+		if !drop[m.Value] {
+			kept = append(kept, m)
+		}
+	}
+	in.Members = kept
+}
+
+// scimBool accepts a JSON boolean or the string form some IdPs send.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		if b, err := strconv.ParseBool(strings.ToLower(str)); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("invalid boolean %s", raw)
+}
+
+// scimMultiValues accepts an array of {value,...}, a single one, or a bare
+// string (for paths like emails[type eq "work"].value).
+func scimMultiValues(raw json.RawMessage) ([]scimMulti, error) {
+	var vals []scimMulti
+	if err := json.Unmarshal(raw, &vals); err == nil {
+		return vals, nil
+	}
+	var one scimMulti
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return []scimMulti{one}, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return []scimMulti{{Value: str, Primary: true}}, nil
+	}
+	return nil, fmt.Errorf("invalid value %s", raw)
+}
+
+// --- Filtering and paging ---
+
+var scimFilterRe = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseSCIMFilter supports the single `attr eq "value"` form IdPs use to
+// look resources up. The attribute is returned lowercased.
+func parseSCIMFilter(filter string) (attr, value string, err error) {
+	if filter == "" {
+		return "", "", nil
+	}
+	m := scimFilterRe.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", fmt.Errorf("unsupported filter %q: only attr eq \"value\" is supported", filter)
+	}
+	value, err = strconv.Unquote(`"` + m[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter value: %w", err)
+	}
+	return strings.ToLower(m[1]), value, nil
+}
+
+func writeSCIMList(w http.ResponseWriter, r *http.Request, resources []any) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	if start < 1 {
+		start = 1
+	}
+	count := scimMaxPage
+	if c, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && c >= 0 && c < scimMaxPage {
+		count = c
+	}
+	total := len(resources)
+	page := []any{}
+	if start <= total {
+		end := min(start-1+count, total)
+		page = resources[start-1 : end]
+	}
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   start,
+		"itemsPerPage": len(page),
+		"Resources":    page,
+	})
+}
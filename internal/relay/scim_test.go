@@ -0,0 +1,474 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// scimTestServer returns a server with org "acme" (owned by the session
+// user, 10 seats, active subscription) and a SCIM token for it.
+func scimTestServer(t *testing.T) (*Server, *httptest.Server, string) {
+	t.Helper()
+	srv, ts, client, ownerID := testServerWithSession(t)
+	store := srv.Store
+	store.CreateOrg("acme-id", "Acme", "acme", ownerID)
+	store.SetOrgMaxSeats("acme-id", 10)
+	orgID := "acme-id"
+	store.CreateSubscription(&Subscription{ID: "sub-acme", OrgID: &orgID, Plan: "team_monthly", Status: "active", Seats: 10})
+
+	resp, err := client.Post(ts.URL+"/api/orgs/acme-id/scim/token", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create scim token: %d", resp.StatusCode)
+	}
+	var tok struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&tok)
+	if !strings.HasPrefix(tok.Token, "wtscim_") {
+		t.Fatalf("token = %q", tok.Token)
+	}
+	return srv, ts, tok.Token
+}
+
+func scimDo(t *testing.T, ts *httptest.Server, token, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/scim+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var out map[string]any
+	json.Unmarshal(data, &out)
+	return resp.StatusCode, out
+}
+
+func scimCreateUser(t *testing.T, ts *httptest.Server, token, userName string) string {
+	t.Helper()
+	code, body := scimDo(t, ts, token, "POST", "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "`+userName+`",
+		"externalId": "ext-`+userName+`",
+		"name": {"givenName": "Ada", "familyName": "Lovelace"},
+		"emails": [{"value": "`+userName+`", "type": "work", "primary": true}],
+		"active": true
+	}`)
+	if code != http.StatusCreated {
+		t.Fatalf("create user: %d %v", code, body)
+	}
+	return body["id"].(string)
+}
+
+// scimAccept signs in as the account holding email (by magic link, if it is
+// an unclaimed placeholder) and accepts the org's invite.
+func scimAccept(t *testing.T, srv *Server, ts *httptest.Server, email string) {
+	t.Helper()
+	u, err := srv.Store.GetUserByEmail(email)
+	if err == nil && (u == nil || u.Provider == scimUserProvider) {
+		u, err = srv.Store.GetOrCreateUserByEmail(email)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := sessionClient(t, srv, ts, u.ID, email)
+	invites, _ := srv.Store.ListPendingInvites("acme-id")
+	for _, inv := range invites {
+		if inv.Email != email {
+			continue
+		}
+		resp, err := client.Post(ts.URL+"/invite/"+inv.Token, "application/x-www-form-urlencoded", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("accept invite: %d", resp.StatusCode)
+		}
+		return
+	}
+	t.Fatalf("no invite for %s", email)
+}
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	store := srv.Store
+
+	userID := scimCreateUser(t, ts, token, "ada@acme.test")
+	if store.IsOrgMember("acme-id", userID) {
+		t.Fatal("provisioned user joined before accepting")
+	}
+	scimAccept(t, srv, ts, "ada@acme.test")
+	if role := store.GetOrgMemberRole("acme-id", userID); role != "member" {
+		t.Fatalf("role after create = %q, want member", role)
+	}
+	if n, _ := store.CountEntitlementsBySub("sub-acme"); n != 1 {
+		t.Fatalf("entitlements after create = %d, want 1", n)
+	}
+	u, _ := store.GetUserByID(userID)
+	if u.DisplayName != "Ada Lovelace" || u.Email == nil || *u.Email != "ada@acme.test" {
+		t.Fatalf("user = %+v", u)
+	}
+
+	// Same userName again conflicts
+	if code, _ := scimDo(t, ts, token, "POST", "/scim/v2/Users", `{"userName":"ada@acme.test"}`); code != http.StatusConflict {
+		t.Fatalf("duplicate create: %d, want 409", code)
+	}
+
+	// IdPs look users up by filter before creating them
+	code, list := scimDo(t, ts, token, "GET", `/scim/v2/Users?filter=userName+eq+"ADA@acme.test"`, "")
+	if code != http.StatusOK || list["totalResults"].(float64) != 1 {
+		t.Fatalf("filter: %d %v", code, list)
+	}
+	code, list = scimDo(t, ts, token, "GET", `/scim/v2/Users?filter=userName+eq+"nobody"`, "")
+	if code != http.StatusOK || list["totalResults"].(float64) != 0 {
+		t.Fatalf("filter miss: %d %v", code, list)
+	}
+
+	// Roles attribute promotes to admin
+	code, _ = scimDo(t, ts, token, "PATCH", "/scim/v2/Users/"+userID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "add", "path": "roles", "value": [{"value": "admin"}]}]
+	}`)
+	if code != http.StatusOK || store.GetOrgMemberRole("acme-id", userID) != "admin" {
+		t.Fatalf("promote: %d role=%q", code, store.GetOrgMemberRole("acme-id", userID))
+	}
+
+	// Entra ID style deactivation
+	code, res := scimDo(t, ts, token, "PATCH", "/scim/v2/Users/"+userID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "path": "active", "value": "False"}]
+	}`)
+	if code != http.StatusOK || res["active"] != false {
+		t.Fatalf("deactivate: %d %v", code, res)
+	}
+	if store.IsOrgMember("acme-id", userID) {
+		t.Fatal("deactivated user is still a member")
+	}
+	if n, _ := store.CountEntitlementsBySub("sub-acme"); n != 0 {
+		t.Fatalf("entitlements after deactivate = %d, want 0", n)
+	}
+
+	// Okta style reactivation
+	code, _ = scimDo(t, ts, token, "PATCH", "/scim/v2/Users/"+userID, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "value": {"active": true}}]
+	}`)
+	if code != http.StatusOK || store.GetOrgMemberRole("acme-id", userID) != "admin" {
+		t.Fatalf("reactivate: %d role=%q", code, store.GetOrgMemberRole("acme-id", userID))
+	}
+
+	code, _ = scimDo(t, ts, token, "DELETE", "/scim/v2/Users/"+userID, "")
+	if code != http.StatusNoContent {
+		t.Fatalf("delete: %d", code)
+	}
+	if store.IsOrgMember("acme-id", userID) {
+		t.Fatal("deleted user is still a member")
+	}
+	if code, _ := scimDo(t, ts, token, "GET", "/scim/v2/Users/"+userID, ""); code != http.StatusNotFound {
+		t.Fatalf("get deleted: %d, want 404", code)
+	}
+}
+
+func TestSCIMOwnerCannotBeDeprovisioned(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	ownerID := "user-org-test"
+	srv.Store.UpdateUserEmail(ownerID, "owner@acme.test")
+
+	if id := scimCreateUser(t, ts, token, "owner@acme.test"); id != ownerID {
+		t.Fatalf("owner's email provisioned as %s, want existing account %s", id, ownerID)
+	}
+	code, _ := scimDo(t, ts, token, "PATCH", "/scim/v2/Users/"+ownerID, `{
+		"Operations": [{"op": "replace", "path": "active", "value": false}]
+	}`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("deactivate owner: %d, want 400", code)
+	}
+	if code, _ := scimDo(t, ts, token, "DELETE", "/scim/v2/Users/"+ownerID, ""); code != http.StatusBadRequest {
+		t.Fatalf("delete owner: %d, want 400", code)
+	}
+	if srv.Store.GetOrgMemberRole("acme-id", ownerID) != "owner" {
+		t.Fatal("owner lost their role")
+	}
+}
+
+func TestSCIMAuth(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	userID := scimCreateUser(t, ts, token, "ada@acme.test")
+	scimAccept(t, srv, ts, "ada@acme.test")
+
+	if code, _ := scimDo(t, ts, "", "GET", "/scim/v2/Users", ""); code != http.StatusUnauthorized {
+		t.Fatalf("no token: %d", code)
+	}
+	if code, _ := scimDo(t, ts, "wtscim_bogus", "GET", "/scim/v2/Users", ""); code != http.StatusUnauthorized {
+		t.Fatalf("bad token: %d", code)
+	}
+
+	// Another org's token can't see or touch acme's users
+	srv.Store.CreateUser("other-owner")
+	srv.Store.CreateOrg("other-id", "Other", "other", "other-owner")
+	srv.Store.SetSCIMToken("other-id", hashToken("wtscim_other"), "other-owner")
+	if code, _ := scimDo(t, ts, "wtscim_other", "GET", "/scim/v2/Users/"+userID, ""); code != http.StatusNotFound {
+		t.Fatalf("cross-org get: %d, want 404", code)
+	}
+	if code, _ := scimDo(t, ts, "wtscim_other", "DELETE", "/scim/v2/Users/"+userID, ""); code != http.StatusNotFound {
+		t.Fatalf("cross-org delete: %d, want 404", code)
+	}
+	if !srv.Store.IsOrgMember("acme-id", userID) {
+		t.Fatal("cross-org delete removed the member")
+	}
+
+	// Rotating the token invalidates the old one
+	client := &http.Client{Jar: &testCookieJar{cookies: map[string][]*http.Cookie{
+		ts.URL: {{Name: "wt_session", Value: "session-org-test"}},
+	}}}
+	resp, err := client.Post(ts.URL+"/api/orgs/acme-id/scim/token", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if code, _ := scimDo(t, ts, token, "GET", "/scim/v2/Users", ""); code != http.StatusUnauthorized {
+		t.Fatalf("rotated token: %d, want 401", code)
+	}
+}
+
+func TestSCIMGroupsMapRoles(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	srv.Config.SSO = &SSOConfig{
+		Providers: []SSOProviderConfig{{ID: "okta", Type: "oidc"}},
+		Orgs:      map[string]SSOOrgPolicy{"acme": {Provider: "okta", Groups: map[string]string{"eng-admins": "admin"}}},
+	}
+	ada := scimCreateUser(t, ts, token, "ada@acme.test")
+	bob := scimCreateUser(t, ts, token, "bob@acme.test")
+	scimAccept(t, srv, ts, "ada@acme.test")
+	scimAccept(t, srv, ts, "bob@acme.test")
+
+	code, g := scimDo(t, ts, token, "POST", "/scim/v2/Groups", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+		"displayName": "eng-admins",
+		"members": [{"value": "`+ada+`"}]
+	}`)
+	if code != http.StatusCreated {
+		t.Fatalf("create group: %d %v", code, g)
+	}
+	groupID := g["id"].(string)
+	if role := srv.Store.GetOrgMemberRole("acme-id", ada); role != "admin" {
+		t.Fatalf("ada role = %q, want admin", role)
+	}
+
+	// Members must be provisioned users of this org
+	code, _ = scimDo(t, ts, token, "PATCH", "/scim/v2/Groups/"+groupID, `{
+		"Operations": [{"op": "add", "path": "members", "value": [{"value": "stranger"}]}]
+	}`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("add unknown member: %d, want 400", code)
+	}
+
+	code, _ = scimDo(t, ts, token, "PATCH", "/scim/v2/Groups/"+groupID, `{
+		"Operations": [
+			{"op": "add", "path": "members", "value": [{"value": "`+bob+`"}]},
+			{"op": "remove", "path": "members[value eq \"`+ada+`\"]"}
+		]
+	}`)
+	if code != http.StatusOK {
+		t.Fatalf("patch group: %d", code)
+	}
+	if role := srv.Store.GetOrgMemberRole("acme-id", ada); role != "member" {
+		t.Fatalf("ada role after leaving group = %q, want member", role)
+	}
+	if role := srv.Store.GetOrgMemberRole("acme-id", bob); role != "admin" {
+		t.Fatalf("bob role after joining group = %q, want admin", role)
+	}
+
+	code, list := scimDo(t, ts, token, "GET", `/scim/v2/Groups?filter=displayName+eq+"eng-admins"`, "")
+	if code != http.StatusOK || list["totalResults"].(float64) != 1 {
+		t.Fatalf("group filter: %d %v", code, list)
+	}
+
+	if code, _ := scimDo(t, ts, token, "DELETE", "/scim/v2/Groups/"+groupID, ""); code != http.StatusNoContent {
+		t.Fatalf("delete group: %d", code)
+	}
+	if role := srv.Store.GetOrgMemberRole("acme-id", bob); role != "member" {
+		t.Fatalf("bob role after group delete = %q, want member", role)
+	}
+}
+
+func TestSCIMProvisionedUserClaimedOnSignIn(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	userID := scimCreateUser(t, ts, token, "ada@acme.test")
+
+	u, err := srv.Store.GetOrCreateUserByEmail("ada@acme.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != userID {
+		t.Fatalf("magic link sign-in got user %s, want provisioned %s", u.ID, userID)
+	}
+	if u.Provider != "email" {
+		t.Fatalf("provider = %q, want email", u.Provider)
+	}
+	// Claimed once; nothing left to claim
+	if again, _ := srv.Store.ClaimSCIMUser("ada@acme.test", "sso:okta", "sub-1"); again != nil {
+		t.Fatal("claimed account was claimed again")
+	}
+	// Signing in is not accepting: the org still waits on the invite
+	if srv.Store.IsOrgMember("acme-id", userID) {
+		t.Fatal("claimed account joined the org without accepting")
+	}
+	scimAccept(t, srv, ts, "ada@acme.test")
+	if !srv.Store.IsOrgMember("acme-id", userID) {
+		t.Fatal("not a member after accepting")
+	}
+}
+
+func TestSCIMPlaceholderAdoptedByExistingAccount(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	placeholder := scimCreateUser(t, ts, token, "ada@acme.test")
+
+	// Ada signs in with GitHub, which reports the provisioned email
+	srv.Store.CreateUser("ada-gh")
+	if err := srv.setVerifiedEmail("ada-gh", "ada@acme.test"); err != nil {
+		t.Fatalf("email held by placeholder: %v", err)
+	}
+	if u, _ := srv.Store.GetUserByID(placeholder); u != nil {
+		t.Fatal("placeholder survived adoption")
+	}
+	su, _ := srv.Store.GetSCIMUser("acme-id", "ada-gh")
+	if su == nil || !su.Pending {
+		t.Fatalf("adopted scim user = %+v, want pending", su)
+	}
+	if srv.Store.IsOrgMember("acme-id", "ada-gh") {
+		t.Fatal("adopting account joined the org without accepting")
+	}
+	scimAccept(t, srv, ts, "ada@acme.test")
+	if !srv.Store.IsOrgMember("acme-id", "ada-gh") {
+		t.Fatal("not a member after accepting")
+	}
+}
+
+func TestSCIMDeprovisionClosesTerminals(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	userID := scimCreateUser(t, ts, token, "ada@acme.test")
+	scimAccept(t, srv, ts, "ada@acme.test")
+	wing := &ConnectedWing{ID: "conn-1", UserID: "user-org-test", WingID: "wing-1", OrgID: "acme-id"}
+	srv.Wings.Add(wing)
+
+	// Browsers with a terminal open on the org's wing and spectating another
+	closed := make(chan websocket.StatusCode, 2)
+	browser := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		_, _, err = c.Read(context.Background())
+		closed <- websocket.CloseStatus(err)
+	}))
+	defer browser.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func() *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(browser.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.CloseNow() })
+		srv.trackBrowser(conn, userID)
+		srv.noteBrowserWing(conn, wing)
+		return conn
+	}
+	controller, spectator := dial(), dial()
+	srv.PTY.Set("sess-1", &PTYRoute{BrowserConn: controller, UserID: userID, WingID: "wing-1"})
+	srv.PTY.Set("sess-2", &PTYRoute{UserID: "user-org-test", WingID: "wing-1"})
+	srv.PTY.AddViewer("sess-2", "viewer-1", spectator)
+
+	if code, _ := scimDo(t, ts, token, "DELETE", "/scim/v2/Users/"+userID, ""); code != http.StatusNoContent {
+		t.Fatalf("delete: %d", code)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case status := <-closed:
+			if status != websocket.StatusPolicyViolation {
+				t.Fatalf("close status = %v, want policy violation", status)
+			}
+		case <-ctx.Done():
+			t.Fatalf("%d of 2 browser connections closed", i)
+		}
+	}
+	if srv.PTY.Get("sess-1").BrowserConn != nil {
+		t.Fatal("route still has a controller")
+	}
+	if srv.PTY.IsSpectator(spectator) {
+		t.Fatal("route still has the spectator")
+	}
+}
+
+func TestSCIMExistingAccountIsInvited(t *testing.T) {
+	srv, ts, token := scimTestServer(t)
+	bob := sessionClient(t, srv, ts, "bob-gh", "bob@acme.test")
+
+	if id := scimCreateUser(t, ts, token, "bob@acme.test"); id != "bob-gh" {
+		t.Fatalf("provisioned as %s, want existing account bob-gh", id)
+	}
+	if srv.Store.IsOrgMember("acme-id", "bob-gh") {
+		t.Fatal("existing account joined the org without accepting")
+	}
+	invites, _ := srv.Store.ListPendingInvites("acme-id")
+	if len(invites) != 1 || invites[0].Email != "bob@acme.test" {
+		t.Fatalf("invites = %+v", invites)
+	}
+
+	// Deactivating upstream withdraws the invite; reactivating sends a new one
+	patch := func(active bool) {
+		t.Helper()
+		body := `{"Operations": [{"op": "replace", "path": "active", "value": false}]}`
+		if active {
+			body = strings.Replace(body, "false", "true", 1)
+		}
+		if code, out := scimDo(t, ts, token, "PATCH", "/scim/v2/Users/bob-gh", body); code != http.StatusOK {
+			t.Fatalf("patch active=%v: %d %v", active, code, out)
+		}
+	}
+	patch(false)
+	if invites, _ := srv.Store.ListPendingInvites("acme-id"); len(invites) != 0 {
+		t.Fatalf("invite survived deactivation: %+v", invites)
+	}
+	patch(true)
+	invites, _ = srv.Store.ListPendingInvites("acme-id")
+	if len(invites) != 1 {
+		t.Fatalf("no invite after reactivation: %+v", invites)
+	}
+
+	// Once accepted, SCIM manages the membership
+	resp, err := bob.Post(ts.URL+"/invite/"+invites[0].Token, "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !srv.Store.IsOrgMember("acme-id", "bob-gh") {
+		t.Fatalf("accept invite: %d, not a member", resp.StatusCode)
+	}
+	patch(false)
+	if srv.Store.IsOrgMember("acme-id", "bob-gh") {
+		t.Error("still a member after deactivation")
+	}
+	if su, _ := srv.Store.GetSCIMUser("acme-id", "bob-gh"); su == nil || su.Pending {
+		t.Errorf("scim user after acceptance = %+v", su)
+	}
+}
@@ -9,9 +9,13 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httputil"
+	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
@@ -24,6 +28,7 @@ type ServerConfig struct {
 	BaseURL            string
 	AppHost            string // e.g. "app.wingthing.ai" — serve SPA at root
 	WSHost             string // e.g. "ws.wingthing.ai" — WebSocket only
+	PreviewHost        string // e.g. "wingthing-preview.dev" — port-forward previews, isolated from the app's origin
 	JWTKey             string // PEM or base64-DER EC P-256 private key; overrides DB-stored key
 	GitHubClientID     string
 	GitHubClientSecret string
@@ -35,11 +40,15 @@ type ServerConfig struct {
 	SMTPPass           string
 	SMTPFrom           string
 	NodeRole           string // "login", "edge", or "" (single node)
-	LoginNodeAddr      string // internal address of login node (for edge nodes)
+	LoginNodeAddr      string // internal address(es) of the login replicas, comma-separated (edges; login peers)
 	FlyMachineID       string // from FLY_MACHINE_ID env var
 	FlyRegion          string // from FLY_REGION env var
 	FlyAppName         string // from FLY_APP_NAME env var
+	InternalAddr       string // mTLS listener for node-to-node calls, e.g. ":8443" (cluster nodes)
+	MetricsToken       string // bearer token that may scrape /metrics on cluster nodes
 	HeroVideo          string // path to hero video file on disk (not embedded)
+	SSO                *SSOConfig // OIDC / SAML identity providers and org policies (WT_SSO_CONFIG)
+	AdminEmails        []string   // users granted the relay admin role on login (WT_ADMIN_EMAILS)
 }
 
 type Server struct {
@@ -56,27 +65,45 @@ type Server struct {
 	RateLimit      *RateLimiter
 	jwtKey         *ecdsa.PrivateKey
 	mux            *http.ServeMux
+	idps           map[string]identityProvider // SSO providers by ID
 
 	// Latest release version cache (fetched from GitHub)
 	latestVersion   string
 	latestVersionAt time.Time
 	latestVersionMu sync.RWMutex
 
-	// All browser WebSocket connections (for shutdown broadcast)
+	// All browser WebSocket connections (for shutdown broadcast and revocation)
 	browserMu    sync.Mutex
-	browserConns map[*websocket.Conn]struct{}
+	browserConns map[*websocket.Conn]*browserConn
 
 	// Tunnel request tracking (requestID → browser WebSocket)
 	tunnelMu       sync.Mutex
-	tunnelRequests map[string]*websocket.Conn
+	tunnelRequests map[string]*tunnelRoute
+
+	metrics relayMetrics
 
 	// Cluster routing (multi-node)
-	WingMap *WingMap
+	WingMap  *WingMap
+	login    *LoginPool  // login replicas (edges; login replicas with peers)
+	electing atomic.Bool // login replica taking part in leader election
+	leader   atomic.Bool // holds the leader lease
+
+	// Node identity for internal calls (cluster nodes; see node_auth.go)
+	node   *NodeAuth
+	nodeCA *NodeCA // login nodes: issues node certificates
+
+	// Edge: last known wing locations, served while login is unreachable
+	locateMu sync.Mutex
+	located  map[string]locatedWing
 
 	// Edge node: reverse proxy to login node + session/entitlement caches
 	loginProxy       http.Handler
 	sessionCache     *SessionCache
 	EntitlementCache *EntitlementCache
+
+	// Outbound webhooks (login/single node)
+	webhookPoke   chan struct{} // wakes the delivery worker
+	webhookClient *http.Client  // tests: overrides the delivery client
 }
 
 func NewServer(store *RelayStore, cfg ServerConfig) *Server {
@@ -86,8 +113,14 @@ func NewServer(store *RelayStore, cfg ServerConfig) *Server {
 		Wings:          NewWingRegistry(),
 		PTY:            NewPTYRoutes(),
 		mux:            http.NewServeMux(),
-		browserConns:   make(map[*websocket.Conn]struct{}),
-		tunnelRequests: make(map[string]*websocket.Conn),
+		browserConns:   make(map[*websocket.Conn]*browserConn),
+		tunnelRequests: make(map[string]*tunnelRoute),
+		idps:           newIdentityProviders(cfg.SSO),
+		webhookPoke:    make(chan struct{}, 1),
+		located:        make(map[string]locatedWing),
+	}
+	if cfg.LoginNodeAddr != "" {
+		s.login = NewLoginPool(ParseLoginAddrs(cfg.LoginNodeAddr), cfg.FlyMachineID)
 	}
 
 	// API routes
@@ -112,6 +145,7 @@ func NewServer(store *RelayStore, cfg ServerConfig) *Server {
 	// Wing detail page API
 	s.mux.HandleFunc("PUT /api/app/wings/{wingID}/label", s.handleWingLabel)
 	s.mux.HandleFunc("DELETE /api/app/wings/{wingID}/label", s.handleDeleteWingLabel)
+	s.mux.HandleFunc("GET /api/app/wings/{wingID}/sessions/{sessionID}/audit-head", s.handleAuditHead)
 
 	// CLI API (Bearer token auth)
 	s.mux.HandleFunc("GET /api/app/resolve-email", s.handleResolveEmail)
@@ -155,6 +189,10 @@ func NewServer(store *RelayStore, cfg ServerConfig) *Server {
 	s.mux.HandleFunc("GET /auth/magic/verify", s.handleMagicVerify)
 	s.mux.HandleFunc("POST /auth/logout", s.handleLogout)
 	s.mux.HandleFunc("GET /auth/dev", s.handleDevLogin)
+	s.mux.HandleFunc("GET /auth/sso/{provider}", s.handleSSOLogin)
+	s.mux.HandleFunc("GET /auth/sso/{provider}/callback", s.handleSSOCallback)
+	s.mux.HandleFunc("POST /auth/sso/{provider}/acs", s.handleSAMLACS)
+	s.mux.HandleFunc("GET /auth/sso/{provider}/metadata", s.handleSAMLMetadata)
 
 	// Org management API (cookie auth)
 	s.mux.HandleFunc("POST /api/orgs", s.handleCreateOrg)
@@ -169,6 +207,51 @@ func NewServer(store *RelayStore, cfg ServerConfig) *Server {
 	s.mux.HandleFunc("POST /api/orgs/{orgID}/invites/{token}/revoke", s.handleRevokeInvite)
 	s.mux.HandleFunc("GET /invite/{token}", s.handleAcceptInvite)
 	s.mux.HandleFunc("POST /invite/{token}", s.handleConsumeInvite)
+	s.mux.HandleFunc("POST /api/orgs/{orgID}/scim/token", s.handleCreateSCIMToken)
+	s.mux.HandleFunc("DELETE /api/orgs/{orgID}/scim/token", s.handleDeleteSCIMToken)
+
+	// SCIM 2.0 provisioning (org bearer token)
+	s.mux.HandleFunc("GET /scim/v2/ServiceProviderConfig", s.handleSCIMServiceProviderConfig)
+	s.mux.HandleFunc("GET /scim/v2/Users", s.handleSCIMListUsers)
+	s.mux.HandleFunc("POST /scim/v2/Users", s.handleSCIMCreateUser)
+	s.mux.HandleFunc("GET /scim/v2/Users/{id}", s.handleSCIMGetUser)
+	s.mux.HandleFunc("PUT /scim/v2/Users/{id}", s.handleSCIMReplaceUser)
+	s.mux.HandleFunc("PATCH /scim/v2/Users/{id}", s.handleSCIMPatchUser)
+	s.mux.HandleFunc("DELETE /scim/v2/Users/{id}", s.handleSCIMDeleteUser)
+	s.mux.HandleFunc("GET /scim/v2/Groups", s.handleSCIMListGroups)
+	s.mux.HandleFunc("POST /scim/v2/Groups", s.handleSCIMCreateGroup)
+	s.mux.HandleFunc("GET /scim/v2/Groups/{id}", s.handleSCIMGetGroup)
+	s.mux.HandleFunc("PUT /scim/v2/Groups/{id}", s.handleSCIMReplaceGroup)
+	s.mux.HandleFunc("PATCH /scim/v2/Groups/{id}", s.handleSCIMPatchGroup)
+	s.mux.HandleFunc("DELETE /scim/v2/Groups/{id}", s.handleSCIMDeleteGroup)
+
+	// REST API v1 (session, device token or personal access token)
+	s.mux.HandleFunc("GET /api/v1/me", s.handleAPIMe)
+	s.mux.HandleFunc("GET /api/v1/tokens", s.handleListAPITokens)
+	s.mux.HandleFunc("POST /api/v1/tokens", s.handleCreateAPIToken)
+	s.mux.HandleFunc("DELETE /api/v1/tokens/{id}", s.handleDeleteAPIToken)
+	s.mux.HandleFunc("GET /api/v1/wings", s.handleAPIWings)
+	s.mux.HandleFunc("GET /api/v1/wings/{wingID}", s.handleAPIWing)
+	s.mux.HandleFunc("GET /api/v1/sessions", s.handleAPISessions)
+	s.mux.HandleFunc("DELETE /api/v1/sessions/{sessionID}", s.handleAPIKillSession)
+	s.mux.HandleFunc("GET /api/v1/orgs", s.handleAPIOrgs)
+	s.mux.HandleFunc("GET /api/v1/orgs/{orgID}", s.handleAPIOrg)
+	s.mux.HandleFunc("GET /api/v1/orgs/{orgID}/members", s.handleAPIOrgMembers)
+	s.mux.HandleFunc("GET /api/v1/orgs/{orgID}/audit", s.handleAPIOrgAudit)
+	s.mux.HandleFunc("GET /api/v1/usage", s.handleAPIUsage)
+	s.mux.HandleFunc("GET /api/v1/audit", s.handleAPIAudit)
+	s.mux.HandleFunc("GET /api/v1/webhooks", s.handleListWebhooks)
+	s.mux.HandleFunc("POST /api/v1/webhooks", s.handleCreateWebhook)
+	s.mux.HandleFunc("DELETE /api/v1/webhooks/{id}", s.handleDeleteWebhook)
+	s.mux.HandleFunc("GET /api/v1/webhooks/{id}/deliveries", s.handleWebhookDeliveries)
+	s.mux.HandleFunc("POST /api/v1/webhooks/{id}/test", s.handleTestWebhook)
+	s.mux.HandleFunc("GET /api/v1/admin/users", s.handleAdminUsers)
+	s.mux.HandleFunc("PATCH /api/v1/admin/users/{userID}", s.handleAdminUpdateUser)
+	s.mux.HandleFunc("GET /api/v1/admin/orgs", s.handleAdminOrgs)
+	s.mux.HandleFunc("GET /api/v1/admin/wings", s.handleAdminWings)
+	s.mux.HandleFunc("DELETE /api/v1/admin/wings/{wingID}", s.handleAdminKickWing)
+	s.mux.HandleFunc("GET /api/v1/admin/usage", s.handleAdminUsage)
+	s.mux.HandleFunc("GET /api/v1/admin/audit", s.handleAdminAudit)
 
 	s.registerStaticRoutes()
 	s.registerInternalRoutes()
@@ -240,15 +323,79 @@ func (s *Server) MachineID() string { return s.Config.FlyMachineID }
 // SetLoginProxy sets the reverse proxy used by edge nodes to forward requests to the login node.
 func (s *Server) SetLoginProxy(p http.Handler) { s.loginProxy = p }
 
+// LoginPool returns the login replicas this node talks to, or nil.
+func (s *Server) LoginPool() *LoginPool { return s.login }
+
+// loginAddr returns the login replica to send the next request to.
+func (s *Server) loginAddr() string {
+	if s.login == nil {
+		return ""
+	}
+	return s.login.Primary()
+}
+
+// SetNodeCA makes this node the issuer of node credentials (login nodes).
+func (s *Server) SetNodeCA(ca *NodeCA) { s.nodeCA = ca }
+
+// SetNodeAuth gives the node its identity for internal calls. Every client
+// that talks to other nodes switches to mutual TLS, so call it after the
+// session cache, entitlement cache and login proxy are set.
+func (s *Server) SetNodeAuth(a *NodeAuth) {
+	s.node = a
+	if s.login != nil {
+		s.login.client.Transport = a.Transport()
+	}
+	if s.sessionCache != nil {
+		s.sessionCache.client.Transport = a.Transport()
+	}
+	if s.EntitlementCache != nil {
+		s.EntitlementCache.client.Transport = a.Transport()
+	}
+	if p, ok := s.loginProxy.(*httputil.ReverseProxy); ok {
+		// Proxied requests are user traffic: mutual TLS, but no node token,
+		// so they can never reach an internal endpoint.
+		p.Transport = a.ProxyTransport()
+	}
+}
+
+// NodeAuth returns this node's internal identity, or nil.
+func (s *Server) NodeAuth() *NodeAuth { return s.node }
+
+// internalPort is the port other nodes reach this cluster's internal
+// listener on.
+func (s *Server) internalPort() string {
+	if _, port, err := net.SplitHostPort(s.Config.InternalAddr); err == nil && port != "" {
+		return port
+	}
+	return "8443"
+}
+
 // SetSessionCache sets the session cache for edge nodes.
 func (s *Server) SetSessionCache(sc *SessionCache) { s.sessionCache = sc }
 
 // GetSessionCache returns the session cache (edge nodes only).
 func (s *Server) GetSessionCache() *SessionCache { return s.sessionCache }
 
-func (s *Server) trackBrowser(conn *websocket.Conn) {
+// browserConn is a tracked browser WebSocket: whose it is, and the wings it
+// has reached (terminals, spectating, tunnel requests), so losing access to a
+// wing can close it.
+type browserConn struct {
+	userID string
+	wings  map[string]*ConnectedWing // wing ID → wing, guarded by browserMu
+}
+
+func (s *Server) trackBrowser(conn *websocket.Conn, userID string) {
 	s.browserMu.Lock()
-	s.browserConns[conn] = struct{}{}
+	s.browserConns[conn] = &browserConn{userID: userID, wings: make(map[string]*ConnectedWing)}
+	s.browserMu.Unlock()
+}
+
+// noteBrowserWing records that a tracked browser connection reached wing.
+func (s *Server) noteBrowserWing(conn *websocket.Conn, wing *ConnectedWing) {
+	s.browserMu.Lock()
+	if bc := s.browserConns[conn]; bc != nil {
+		bc.wings[wing.WingID] = wing
+	}
 	s.browserMu.Unlock()
 }
 
@@ -305,11 +452,19 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Preview host: only the port-forward bootstrap, on every node. The
+	// previewed app itself is served by its service worker, through the
+	// dashboard's tunnel, never by the relay.
+	if s.Config.PreviewHost != "" && (host == s.Config.PreviewHost || strings.HasSuffix(host, "."+s.Config.PreviewHost)) {
+		s.servePreviewHost(w, r)
+		return
+	}
+
 	// Edge node proxying: serve WS/static/internal locally, proxy everything else to login
 	if s.IsEdge() && s.loginProxy != nil {
 		if strings.HasPrefix(path, "/ws/") || strings.HasPrefix(path, "/app/") ||
 			strings.HasPrefix(path, "/assets/") || strings.HasPrefix(path, "/internal/") ||
-			path == "/health" {
+			path == "/health" || path == "/metrics" {
 			s.mux.ServeHTTP(w, r)
 			return
 		}
@@ -379,24 +534,78 @@ func (s *Server) serveAppIndex(w http.ResponseWriter, r *http.Request) {
 	http.ServeContent(w, r, "index.html", stat.ModTime(), f.(io.ReadSeeker))
 }
 
+// previewFiles are the bootstrap files the preview host serves, from
+// web/public/preview.
+var previewFiles = map[string]string{
+	"/__wt/frame.html": "dist/preview/frame.html",
+	"/__wt/sw.js":      "dist/preview/sw.js",
+	"/__wt/ws.js":      "dist/preview/ws.js",
+}
+
+// previewLabel returns the subdomain label of host under the preview host,
+// or "" if host isn't a single-label subdomain of it. Each preview loads from
+// its own <session>-<token> subdomain, so no two previews share an origin,
+// a service worker or storage.
+func (s *Server) previewLabel(host string) string {
+	label, ok := strings.CutSuffix(host, "."+s.Config.PreviewHost)
+	if !ok || label == "" || len(label) > 63 {
+		return ""
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return ""
+		}
+	}
+	return label
+}
+
+// servePreviewHost serves the port-forward bootstrap on a preview subdomain.
+// Anything else reaching the relay means the service worker isn't running.
+func (s *Server) servePreviewHost(w http.ResponseWriter, r *http.Request) {
+	name, ok := previewFiles[r.URL.Path]
+	if !ok || r.Method != http.MethodGet || s.previewLabel(stripPort(r.Host)) == "" {
+		http.Error(w, "preview not connected — reopen it from the dashboard", http.StatusNotFound)
+		return
+	}
+	f, err := web.FS.Open(name)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.URL.Path == "/__wt/sw.js" {
+		// The worker controls the whole preview origin
+		w.Header().Set("Service-Worker-Allowed", "/")
+	}
+	stat, _ := f.Stat()
+	http.ServeContent(w, r, path.Base(name), stat.ModTime(), f.(io.ReadSeeker))
+}
+
 // broadcastToEdges POSTs a JSON payload to all known edge nodes.
 // Fire-and-forget goroutines, 3s timeout per edge.
+// broadcastHeader marks an event rebroadcast by a login replica, so other
+// login replicas receiving it deliver locally and stop there.
+const broadcastHeader = "X-Wingthing-Broadcast"
+
 func (s *Server) broadcastToEdges(payload []byte) {
-	if s.WingMap == nil || s.Config.FlyAppName == "" {
+	if s.WingMap == nil || s.Config.FlyAppName == "" || s.node == nil {
 		return
 	}
+	client := &http.Client{Timeout: 3 * time.Second, Transport: s.node.Transport()}
 	for _, mid := range s.WingMap.EdgeIDs() {
 		if mid == s.Config.FlyMachineID {
 			continue // never broadcast to self — causes infinite loop
 		}
 		go func(machineID string) {
-			url := fmt.Sprintf("http://%s.vm.%s.internal:8080/internal/wing-event", machineID, s.Config.FlyAppName)
-			client := &http.Client{Timeout: 3 * time.Second}
+			url := fmt.Sprintf("https://%s.vm.%s.internal:%s/internal/wing-event", machineID, s.Config.FlyAppName, s.internalPort())
 			req, _ := http.NewRequest("POST", url, bytes.NewReader(payload))
 			if req == nil {
 				return
 			}
 			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(broadcastHeader, "1")
 			resp, err := client.Do(req)
 			if err != nil {
 				return
@@ -4,19 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // SessionCache caches session token → user info on edge nodes.
-// Each validated session is cached for 5 minutes to avoid hitting the login node on every request.
+// Each validated session is cached for sessionCacheTTL to avoid hitting the login node on every request.
 type SessionCache struct {
-	mu      sync.RWMutex
-	entries map[string]*sessionCacheEntry
-	client  *http.Client
+	mu        sync.RWMutex
+	entries   map[string]*sessionCacheEntry
+	apiTokens map[string]*apiTokenCacheEntry  // token hash → validation
+	suspended map[string]*suspendedCacheEntry // user ID → suspension status
+	client    *http.Client
+	hits      atomic.Int64 // Validate answered from cache (metrics)
+	misses    atomic.Int64 // Validate went to the login node (metrics)
 }
 
 type sessionCacheEntry struct {
@@ -24,31 +29,70 @@ type sessionCacheEntry struct {
 	fetchedAt time.Time
 }
 
+type apiTokenCacheEntry struct {
+	user      *User
+	token     *APIToken
+	fetchedAt time.Time
+}
+
+type suspendedCacheEntry struct {
+	suspended bool
+	fetchedAt time.Time
+}
+
+// sessionCacheTTL is how long a validated session is served without asking
+// the login node again.
+const sessionCacheTTL = 5 * time.Minute
+
+// sessionStaleTTL is how long a validated session keeps working while no
+// login replica answers: a few minutes past sessionCacheTTL, enough to ride
+// out a failover without letting a revoked session linger. API tokens are
+// never served stale.
+const sessionStaleTTL = sessionCacheTTL + 3*time.Minute
+
+// apiTokenCacheTTL is short so a revoked token stops working on edges quickly.
+const apiTokenCacheTTL = time.Minute
+
+// suspendedCacheTTL bounds how long an edge keeps accepting a suspended
+// user's wing JWTs.
+const suspendedCacheTTL = time.Minute
+
 func NewSessionCache() *SessionCache {
 	return &SessionCache{
-		entries: make(map[string]*sessionCacheEntry),
-		client:  &http.Client{Timeout: 5 * time.Second},
+		entries:   make(map[string]*sessionCacheEntry),
+		apiTokens: make(map[string]*apiTokenCacheEntry),
+		suspended: make(map[string]*suspendedCacheEntry),
+		client:    &http.Client{Timeout: 5 * time.Second},
 	}
 }
 
-// Validate checks the cache or calls the login node to validate a session token.
-func (sc *SessionCache) Validate(token, loginAddr string) *User {
+// Validate checks the cache or asks a login replica to validate a session
+// token, failing over through the pool.
+func (sc *SessionCache) Validate(token string, login *LoginPool) *User {
 	sc.mu.RLock()
 	entry := sc.entries[token]
 	sc.mu.RUnlock()
 
-	if entry != nil && time.Since(entry.fetchedAt) < 5*time.Minute {
+	if entry != nil && time.Since(entry.fetchedAt) < sessionCacheTTL {
+		sc.hits.Add(1)
 		return entry.user
 	}
-
-	// Call login node
-	resp, err := sc.client.Get(loginAddr + "/internal/sessions/" + token)
-	if err != nil {
+	sc.misses.Add(1)
+	if login == nil {
 		return nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	// Ride out an outage of every replica on the last good answer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	body, err := login.Get(ctx, "/internal/sessions/"+token)
+	if errors.Is(err, errLoginUnavailable) {
+		if entry != nil && entry.user != nil && time.Since(entry.fetchedAt) < sessionStaleTTL {
+			return entry.user
+		}
+		return nil
+	}
+	if err != nil {
 		// Cache negative result briefly to avoid hammering
 		sc.mu.Lock()
 		sc.entries[token] = &sessionCacheEntry{user: nil, fetchedAt: time.Now()}
@@ -56,11 +100,6 @@ func (sc *SessionCache) Validate(token, loginAddr string) *User {
 		return nil
 	}
 
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 8192))
-	if err != nil {
-		return nil
-	}
-
 	var sv SessionValidation
 	if err := json.Unmarshal(body, &sv); err != nil {
 		return nil
@@ -79,6 +118,71 @@ func (sc *SessionCache) Validate(token, loginAddr string) *User {
 	return user
 }
 
+// ValidateAPIToken checks the cache or asks a login replica to validate a
+// personal access token by its hash. With no replica answering, tokens are
+// refused once their cache entry expires.
+func (sc *SessionCache) ValidateAPIToken(tokenHash string, login *LoginPool) (*User, *APIToken) {
+	sc.mu.RLock()
+	entry := sc.apiTokens[tokenHash]
+	sc.mu.RUnlock()
+
+	if entry != nil && time.Since(entry.fetchedAt) < apiTokenCacheTTL {
+		return entry.user, entry.token
+	}
+	if login == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	body, err := login.Get(ctx, "/internal/api-tokens/"+tokenHash)
+	if errors.Is(err, errLoginUnavailable) {
+		return nil, nil
+	}
+
+	entry = &apiTokenCacheEntry{fetchedAt: time.Now()}
+	if err == nil {
+		var v APITokenValidation
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, nil
+		}
+		entry.user = &User{ID: v.UserID, DisplayName: v.DisplayName, OrgIDs: v.OrgIDs}
+		entry.token = &APIToken{ID: v.TokenID, UserID: v.UserID, OrgID: v.TokenOrgID, Scopes: v.Scopes, WingIDs: v.WingIDs}
+	}
+
+	sc.mu.Lock()
+	sc.apiTokens[tokenHash] = entry
+	sc.mu.Unlock()
+
+	return entry.user, entry.token
+}
+
+// Suspended returns a user's cached suspension status, if it is fresh.
+func (sc *SessionCache) Suspended(userID string) (suspended, ok bool) {
+	sc.mu.RLock()
+	entry := sc.suspended[userID]
+	sc.mu.RUnlock()
+	if entry == nil || time.Since(entry.fetchedAt) >= suspendedCacheTTL {
+		return false, false
+	}
+	return entry.suspended, true
+}
+
+// SetSuspended caches a user's suspension status from the login node.
+func (sc *SessionCache) SetSuspended(userID string, suspended bool) {
+	sc.mu.Lock()
+	sc.suspended[userID] = &suspendedCacheEntry{suspended: suspended, fetchedAt: time.Now()}
+	sc.mu.Unlock()
+}
+
+// ForgetSuspended drops a user's cached suspension status, so the next check
+// asks the login node.
+func (sc *SessionCache) ForgetSuspended(userID string) {
+	sc.mu.Lock()
+	delete(sc.suspended, userID)
+	sc.mu.Unlock()
+}
+
 // UpdateUserOrgs updates the cached org IDs for all sessions belonging to userID.
 func (sc *SessionCache) UpdateUserOrgs(userID string, orgIDs []string) {
 	sc.mu.Lock()
@@ -97,7 +201,7 @@ func (sc *SessionCache) ActiveUserIDs() []string {
 	seen := make(map[string]bool)
 	var ids []string
 	for _, entry := range sc.entries {
-		if entry.user != nil && !seen[entry.user.ID] && time.Since(entry.fetchedAt) < 5*time.Minute {
+		if entry.user != nil && !seen[entry.user.ID] && time.Since(entry.fetchedAt) < sessionCacheTTL {
 			seen[entry.user.ID] = true
 			ids = append(ids, entry.user.ID)
 		}
@@ -106,7 +210,7 @@ func (sc *SessionCache) ActiveUserIDs() []string {
 }
 
 // StartOrgSync periodically bulk-refreshes org memberships for all cached sessions.
-func (sc *SessionCache) StartOrgSync(ctx context.Context, loginAddr string, interval time.Duration) {
+func (sc *SessionCache) StartOrgSync(ctx context.Context, loginAddr func() string, interval time.Duration) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -115,7 +219,7 @@ func (sc *SessionCache) StartOrgSync(ctx context.Context, loginAddr string, inte
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				sc.syncOrgs(loginAddr)
+				sc.syncOrgs(loginAddr())
 			}
 		}
 	}()
@@ -0,0 +1,503 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// SSOConfig is the roost's single sign-on setup, loaded from the file named
+// by WT_SSO_CONFIG:
+//
+//	providers:
+//	  - id: okta
+//	    name: Okta
+//	    type: oidc
+//	    issuer: https://acme.okta.com
+//	    client_id: 0oa...
+//	    client_secret_env: OKTA_CLIENT_SECRET
+//	  - id: adfs
+//	    type: saml
+//	    metadata_url: https://adfs.acme.com/FederationMetadata/2007-06/FederationMetadata.xml
+//	orgs:
+//	  acme:
+//	    provider: okta
+//	    required: true
+//	    groups:
+//	      wt-admins: admin
+//	      engineering: member
+type SSOConfig struct {
+	Providers []SSOProviderConfig     `yaml:"providers"`
+	Orgs      map[string]SSOOrgPolicy `yaml:"orgs"` // org ID or slug → policy
+}
+
+// SSOProviderConfig is one identity provider users can sign in through.
+type SSOProviderConfig struct {
+	ID   string `yaml:"id"`   // URL slug: /auth/sso/{id}
+	Name string `yaml:"name"` // login button label (default: id)
+	Type string `yaml:"type"` // "oidc" or "saml"
+
+	// OIDC
+	Issuer          string   `yaml:"issuer"`
+	ClientID        string   `yaml:"client_id"`
+	ClientSecret    string   `yaml:"client_secret"`
+	ClientSecretEnv string   `yaml:"client_secret_env"` // read the secret from this env var instead
+	Scopes          []string `yaml:"scopes"`            // on top of openid, email and profile
+	GroupsClaim     string   `yaml:"groups_claim"`      // default "groups"
+	TrustEmail      bool     `yaml:"trust_email"`       // accept emails when the IdP omits email_verified
+
+	// SAML
+	MetadataURL     string `yaml:"metadata_url"`
+	MetadataFile    string `yaml:"metadata_file"`
+	EntityID        string `yaml:"entity_id"`        // our entity ID (default: the metadata URL)
+	EmailAttribute  string `yaml:"email_attribute"`  // default: email, mail, or the NameID
+	NameAttribute   string `yaml:"name_attribute"`   // default: displayName or name
+	GroupsAttribute string `yaml:"groups_attribute"` // default: groups
+}
+
+// SSOOrgPolicy binds an org to a provider.
+type SSOOrgPolicy struct {
+	Provider string            `yaml:"provider"`
+	Required bool              `yaml:"required"` // members can only sign in through Provider
+	Groups   map[string]string `yaml:"groups"`   // IdP group → org role; members in none of them are removed
+}
+
+var ssoIDRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// LoadSSOConfig reads and validates an SSO config file. An empty path means
+// no SSO.
+func LoadSSOConfig(path string) (*SSOConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read sso config: %w", err)
+	}
+	var cfg SSOConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse sso config: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("sso config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *SSOConfig) validate() error {
+	if len(c.Providers) == 0 {
+		return fmt.Errorf("no providers")
+	}
+	ids := make(map[string]bool)
+	for i := range c.Providers {
+		p := &c.Providers[i]
+		if !ssoIDRegexp.MatchString(p.ID) {
+			return fmt.Errorf("provider id %q: must be lowercase alphanumeric with dashes", p.ID)
+		}
+		if ids[p.ID] {
+			return fmt.Errorf("provider id %q: duplicate", p.ID)
+		}
+		ids[p.ID] = true
+		if p.Name == "" {
+			p.Name = p.ID
+		}
+		switch p.Type {
+		case "oidc":
+			if p.Issuer == "" || p.ClientID == "" {
+				return fmt.Errorf("provider %s: oidc needs issuer and client_id", p.ID)
+			}
+			if p.ClientSecretEnv != "" {
+				p.ClientSecret = os.Getenv(p.ClientSecretEnv)
+				if p.ClientSecret == "" {
+					return fmt.Errorf("provider %s: %s is not set", p.ID, p.ClientSecretEnv)
+				}
+			}
+			if p.GroupsClaim == "" {
+				p.GroupsClaim = "groups"
+			}
+		case "saml":
+			if (p.MetadataURL == "") == (p.MetadataFile == "") {
+				return fmt.Errorf("provider %s: saml needs exactly one of metadata_url and metadata_file", p.ID)
+			}
+		default:
+			return fmt.Errorf("provider %s: type must be oidc or saml, got %q", p.ID, p.Type)
+		}
+	}
+	for org, pol := range c.Orgs {
+		if !ids[pol.Provider] {
+			return fmt.Errorf("org %s: unknown provider %q", org, pol.Provider)
+		}
+		for group, role := range pol.Groups {
+			if role != "admin" && role != "member" {
+				return fmt.Errorf("org %s: group %q maps to %q, want admin or member", org, group, role)
+			}
+		}
+	}
+	return nil
+}
+
+// ssoIdentity is who the IdP says signed in.
+type ssoIdentity struct {
+	Subject string // stable per-provider user ID (OIDC sub, SAML NameID)
+	Email   string // verified: OIDC email_verified (or trust_email), or the signed SAML assertion
+	Name    string
+	Groups  []string
+}
+
+// identityProvider is an external IdP. Begin redirects the browser there;
+// Finish handles the browser coming back to /auth/sso/{id}/callback.
+type identityProvider interface {
+	Config() *SSOProviderConfig
+	Begin(w http.ResponseWriter, r *http.Request, s *Server) error
+	Finish(w http.ResponseWriter, r *http.Request, s *Server) (*ssoIdentity, error)
+}
+
+// newIdentityProviders builds the configured providers, keyed by ID.
+func newIdentityProviders(cfg *SSOConfig) map[string]identityProvider {
+	out := make(map[string]identityProvider)
+	if cfg == nil {
+		return out
+	}
+	for i := range cfg.Providers {
+		p := &cfg.Providers[i]
+		switch p.Type {
+		case "oidc":
+			out[p.ID] = newOIDCProvider(p)
+		case "saml":
+			out[p.ID] = newSAMLProvider(p)
+		}
+	}
+	return out
+}
+
+// ssoProviderName is the users.provider value for accounts from an IdP.
+func ssoProviderName(id string) string {
+	return "sso:" + id
+}
+
+// ssoButtons lists the providers for the login page, in config order.
+func (s *Server) ssoButtons() []*SSOProviderConfig {
+	if s.Config.SSO == nil {
+		return nil
+	}
+	var out []*SSOProviderConfig
+	for i := range s.Config.SSO.Providers {
+		out = append(out, &s.Config.SSO.Providers[i])
+	}
+	return out
+}
+
+// ssoCallbackURL is where an IdP sends the browser back to.
+func (s *Server) ssoCallbackURL(id, leg string) string {
+	return s.Config.BaseURL + "/auth/sso/" + id + "/" + leg
+}
+
+func (s *Server) ssoProvider(w http.ResponseWriter, r *http.Request) identityProvider {
+	p := s.idps[r.PathValue("provider")]
+	if p == nil {
+		http.NotFound(w, r)
+	}
+	return p
+}
+
+// handleSSOLogin starts a login. GET /auth/sso/{provider}
+func (s *Server) handleSSOLogin(w http.ResponseWriter, r *http.Request) {
+	p := s.ssoProvider(w, r)
+	if p == nil {
+		return
+	}
+	if err := p.Begin(w, r, s); err != nil {
+		log.Printf("sso %s: begin: %v", p.Config().ID, err)
+		http.Error(w, "could not reach "+p.Config().Name+": "+err.Error(), http.StatusBadGateway)
+	}
+}
+
+// handleSSOCallback finishes a login. GET /auth/sso/{provider}/callback
+func (s *Server) handleSSOCallback(w http.ResponseWriter, r *http.Request) {
+	p := s.ssoProvider(w, r)
+	if p == nil {
+		return
+	}
+	cfg := p.Config()
+	id, err := p.Finish(w, r, s)
+	if err != nil {
+		log.Printf("sso %s: %v", cfg.ID, err)
+		http.Error(w, cfg.Name+" sign-in failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.Store.GetUserByProvider(ssoProviderName(cfg.ID), id.Subject)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil && id.Email != "" {
+		// Provisioned over SCIM before their first sign-in
+		if user, err = s.Store.ClaimSCIMUser(id.Email, ssoProviderName(cfg.ID), id.Subject); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if user == nil && id.Email != "" {
+		if user, err = s.linkSSOAccount(cfg.ID, id); err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if user == nil {
+		user = &User{
+			ID:         uuid.New().String(),
+			Provider:   ssoProviderName(cfg.ID),
+			ProviderID: id.Subject,
+		}
+	}
+	user.DisplayName = id.Name
+	if user.DisplayName == "" {
+		user.DisplayName = id.Email
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = id.Subject
+	}
+	if err := s.Store.UpsertUser(user); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if id.Email != "" {
+		if err := s.setVerifiedEmail(user.ID, id.Email); err != nil {
+			// Another account (e.g. GitHub) already has this email
+			log.Printf("sso %s: email %s already in use, not set on %s", cfg.ID, id.Email, user.ID)
+		} else {
+			user.Email = &id.Email
+		}
+	}
+	s.syncSSOGroups(cfg.ID, user.ID, id.Groups)
+	s.Store.AppendAudit(user.ID, "sso_login", strPtr(fmt.Sprintf("provider=%s groups=%s", cfg.ID, strings.Join(id.Groups, ","))))
+
+	s.createSessionAndRedirect(w, r, user)
+}
+
+// linkSSOAccount moves an existing account with the IdP's verified email
+// (signed up through GitHub, say) onto the IdP, instead of a second account
+// being made beside it. The account's other sessions end: from here on it
+// signs in through the IdP. Accounts already on an IdP are left alone.
+func (s *Server) linkSSOAccount(providerID string, id *ssoIdentity) (*User, error) {
+	user, err := s.Store.GetUserByEmail(id.Email)
+	if err != nil || user == nil || strings.HasPrefix(user.Provider, "sso:") {
+		return nil, err
+	}
+	from := user.Provider
+	if err := s.Store.LinkUserProvider(user.ID, ssoProviderName(providerID), id.Subject); err != nil {
+		return nil, err
+	}
+	if _, err := s.Store.RevokeUserSessions(user.ID); err != nil {
+		return nil, err
+	}
+	s.Store.AppendAudit(user.ID, "sso_linked", strPtr(fmt.Sprintf("provider=%s from=%s", providerID, from)))
+	log.Printf("sso %s: linked existing %s account %s by email", providerID, from, user.ID)
+	user.Provider = ssoProviderName(providerID)
+	user.ProviderID = id.Subject
+	return user, nil
+}
+
+// ssoPolicy returns the policy for an org, matched by ID or slug.
+func (s *Server) ssoPolicy(org *Org) (SSOOrgPolicy, bool) {
+	if s.Config.SSO == nil || org == nil {
+		return SSOOrgPolicy{}, false
+	}
+	if pol, ok := s.Config.SSO.Orgs[org.ID]; ok {
+		return pol, true
+	}
+	pol, ok := s.Config.SSO.Orgs[org.Slug]
+	return pol, ok
+}
+
+// ssoRequiredFor returns the name of the provider an org requires its
+// members to sign in through, if the user didn't.
+func (s *Server) ssoRequiredFor(org *Org, user *User) string {
+	pol, ok := s.ssoPolicy(org)
+	if !ok || !pol.Required || user.Provider == ssoProviderName(pol.Provider) {
+		return ""
+	}
+	if p := s.idps[pol.Provider]; p != nil {
+		return p.Config().Name
+	}
+	return pol.Provider
+}
+
+// ssoLoginBlocked reports why the user may not sign in this way: one of
+// their orgs requires a different provider.
+func (s *Server) ssoLoginBlocked(user *User) string {
+	if s.Config.SSO == nil || len(s.Config.SSO.Orgs) == 0 {
+		return ""
+	}
+	orgs, err := s.Store.ListOrgsForUser(user.ID)
+	if err != nil {
+		return ""
+	}
+	for _, org := range orgs {
+		if !s.Store.IsOrgMember(org.ID, user.ID) {
+			continue // invited, not joined
+		}
+		if name := s.ssoRequiredFor(org, user); name != "" {
+			return fmt.Sprintf("%s requires signing in with %s", org.Name, name)
+		}
+	}
+	return ""
+}
+
+// ssoLocked reports whether an org the user belongs to requires a provider
+// their account isn't from. Sessions, device tokens, PATs and wings are then
+// refused like a suspended user's, so nothing from before the org required
+// SSO gets around it.
+func (s *Server) ssoLocked(user *User) bool {
+	return user != nil && s.ssoLoginBlocked(user) != ""
+}
+
+// ssoLockedID is ssoLocked for a user ID.
+func (s *Server) ssoLockedID(userID string) bool {
+	if s.Config.SSO == nil || len(s.Config.SSO.Orgs) == 0 || s.Store == nil {
+		return false
+	}
+	user, err := s.Store.GetUserByID(userID)
+	return err == nil && s.ssoLocked(user)
+}
+
+// RevokeSSOBypasses signs out every member of an org that requires SSO
+// whose account is from another provider, and drops their wings. Run at
+// startup on the login node, so turning required on takes effect for
+// sessions that already exist.
+func (s *Server) RevokeSSOBypasses() error {
+	if s.Config.SSO == nil || s.Store == nil {
+		return nil
+	}
+	for ref, pol := range s.Config.SSO.Orgs {
+		if !pol.Required {
+			continue
+		}
+		org, _ := s.Store.GetOrgByID(ref)
+		if org == nil {
+			org, _ = s.Store.GetOrgBySlug(ref)
+		}
+		if org == nil {
+			continue
+		}
+		members, err := s.Store.ListOrgMembers(org.ID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			user, err := s.Store.GetUserByID(m.UserID)
+			if err != nil || user == nil || s.ssoRequiredFor(org, user) == "" {
+				continue
+			}
+			n, err := s.Store.RevokeUserSessions(user.ID)
+			if err != nil {
+				return err
+			}
+			kicked := s.kickWings("", user.ID)
+			if n > 0 || kicked > 0 {
+				s.Store.AppendOrgAudit(user.ID, org.ID, "sso_sessions_revoked", strPtr(fmt.Sprintf("org=%s provider=%s sessions=%d wings=%d", org.Slug, user.Provider, n, kicked)))
+				log.Printf("sso: %s requires %s: revoked %d sessions of %s", org.Slug, pol.Provider, n, user.ID)
+			}
+		}
+	}
+	return nil
+}
+
+var ssoRoleRank = map[string]int{"member": 1, "admin": 2, "owner": 3}
+
+// ssoRole picks the highest role the groups map to, or "".
+func ssoRole(pol SSOOrgPolicy, groups []string) string {
+	role := ""
+	for _, g := range groups {
+		if r := pol.Groups[g]; ssoRoleRank[r] > ssoRoleRank[role] {
+			role = r
+		}
+	}
+	return role
+}
+
+// syncSSOGroups applies the group → role mappings of every org bound to the
+// provider. The org's owner is never demoted or removed.
+func (s *Server) syncSSOGroups(providerID, userID string, groups []string) {
+	if s.Config.SSO == nil {
+		return
+	}
+	changed := false
+	for ref, pol := range s.Config.SSO.Orgs {
+		if pol.Provider != providerID || len(pol.Groups) == 0 {
+			continue
+		}
+		org, _ := s.Store.GetOrgByID(ref)
+		if org == nil {
+			org, _ = s.Store.GetOrgBySlug(ref)
+		}
+		if org == nil {
+			continue
+		}
+		if org.OwnerUserID == userID {
+			continue
+		}
+		want := ssoRole(pol, groups)
+		have := s.Store.GetOrgMemberRole(org.ID, userID)
+		switch {
+		case want == have:
+		case want == "":
+			s.Store.RemoveOrgMember(org.ID, userID)
+			s.revokeOrgEntitlement(org.ID, userID)
+			s.Store.AppendOrgAudit(userID, org.ID, "org_member_removed", strPtr("org="+org.Slug+" via=sso:"+providerID))
+			changed = true
+		case have == "":
+			if err := s.Store.AddOrgMember(org.ID, userID, want); err != nil {
+				log.Printf("sso %s: add %s to %s: %v", providerID, userID, org.Slug, err)
+				continue
+			}
+			s.grantOrgEntitlement(org.ID, userID)
+			s.Store.AppendOrgAudit(userID, org.ID, "org_member_added", strPtr("org="+org.Slug+" role="+want+" via=sso:"+providerID))
+			changed = true
+		default:
+			s.Store.SetOrgMemberRole(org.ID, userID, want)
+			s.Store.AppendOrgAudit(userID, org.ID, "org_member_role", strPtr("org="+org.Slug+" role="+want+" via=sso:"+providerID))
+			changed = true
+		}
+	}
+	if changed {
+		s.refreshUserOrgSubs(userID)
+	}
+}
+
+// ssoFlowCookie carries per-login state (state, nonce, PKCE verifier)
+// across the IdP round-trip.
+const ssoFlowCookie = "sso_flow"
+
+func (s *Server) setSSOFlow(w http.ResponseWriter, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoFlowCookie,
+		Value:    value,
+		Path:     "/auth/sso",
+		Domain:   s.cookieDomain(),
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.Config.BaseURL, "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) takeSSOFlow(w http.ResponseWriter, r *http.Request) string {
+	c, err := r.Cookie(ssoFlowCookie)
+	if err != nil {
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{Name: ssoFlowCookie, Path: "/auth/sso", Domain: s.cookieDomain(), MaxAge: -1})
+	return c.Value
+}
+
+// ssoHTTP fetches IdP documents (discovery, JWKS, metadata, tokens).
+var ssoHTTP = &http.Client{Timeout: 10 * time.Second}
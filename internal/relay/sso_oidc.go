@@ -0,0 +1,349 @@
+package relay
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcDiscoveryTTL is how long discovery and JWKS documents are cached.
+// An unknown key ID refetches the JWKS early (key rotation).
+const oidcDiscoveryTTL = time.Hour
+
+// oidcProvider signs users in with OpenID Connect: authorization code flow
+// with PKCE, ID token verified against the issuer's JWKS.
+type oidcProvider struct {
+	cfg *SSOProviderConfig
+
+	mu     sync.Mutex
+	disc   *oidcDiscovery
+	discAt time.Time
+	keys   map[string]any // kid → *rsa.PublicKey or *ecdsa.PublicKey
+	keysAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func newOIDCProvider(cfg *SSOProviderConfig) *oidcProvider {
+	return &oidcProvider{cfg: cfg}
+}
+
+func (p *oidcProvider) Config() *SSOProviderConfig { return p.cfg }
+
+func (p *oidcProvider) discovery() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.disc != nil && time.Since(p.discAt) < oidcDiscoveryTTL {
+		return p.disc, nil
+	}
+	var d oidcDiscovery
+	if err := getJSON(strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer is %q, configured %q", d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery: missing authorization, token or jwks endpoint")
+	}
+	p.disc, p.discAt = &d, time.Now()
+	return p.disc, nil
+}
+
+func (p *oidcProvider) Begin(w http.ResponseWriter, r *http.Request, s *Server) error {
+	d, err := p.discovery()
+	if err != nil {
+		return err
+	}
+	state, nonce, verifier := generateToken(), generateToken(), generateToken()
+	s.setSSOFlow(w, state+"."+nonce+"."+verifier)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	scopes := append([]string{"openid", "email", "profile"}, p.cfg.Scopes...)
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {s.ssoCallbackURL(p.cfg.ID, "callback")},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+sep+q.Encode(), http.StatusTemporaryRedirect)
+	return nil
+}
+
+func (p *oidcProvider) Finish(w http.ResponseWriter, r *http.Request, s *Server) (*ssoIdentity, error) {
+	flow := strings.Split(s.takeSSOFlow(w, r), ".")
+	q := r.URL.Query()
+	if len(flow) != 3 || flow[0] != q.Get("state") {
+		return nil, errors.New("invalid state")
+	}
+	if e := q.Get("error"); e != "" {
+		return nil, fmt.Errorf("%s: %s", e, q.Get("error_description"))
+	}
+	code := q.Get("code")
+	if code == "" {
+		return nil, errors.New("missing code")
+	}
+	d, err := p.discovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.ssoCallbackURL(p.cfg.ID, "callback")},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {flow[2]},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	resp, err := ssoHTTP.PostForm(d.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		ErrorDesc   string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if tok.Error != "" {
+		return nil, fmt.Errorf("token exchange: %s: %s", tok.Error, tok.ErrorDesc)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("token exchange: no id_token")
+	}
+
+	claims, err := p.verify(tok.IDToken, d)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := claims["nonce"].(string); n != flow[1] {
+		return nil, errors.New("id token nonce mismatch")
+	}
+
+	// Some IdPs only put groups (or email) in the userinfo response
+	if _, ok := claims[p.cfg.GroupsClaim]; !ok && d.UserinfoEndpoint != "" && tok.AccessToken != "" {
+		if info, err := p.userinfo(d.UserinfoEndpoint, tok.AccessToken); err == nil && info["sub"] == claims["sub"] {
+			for k, v := range info {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+	return p.identity(claims)
+}
+
+// verify checks the ID token's signature, issuer, audience and expiry.
+func (p *oidcProvider) verify(raw string, d *oidcDiscovery) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(kid, d.JWKSURI)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return claims, nil
+}
+
+// key returns the JWKS key for kid, refetching the set if kid is unknown.
+func (p *oidcProvider) key(kid, jwksURI string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	find := func() any {
+		if k, ok := p.keys[kid]; ok {
+			return k
+		}
+		if kid == "" && len(p.keys) == 1 {
+			for _, k := range p.keys {
+				return k
+			}
+		}
+		return nil
+	}
+	if k := find(); k != nil && time.Since(p.keysAt) < oidcDiscoveryTTL {
+		return k, nil
+	}
+	// Don't let a stream of bogus kids hammer the IdP
+	if p.keys != nil && time.Since(p.keysAt) < 10*time.Second {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	p.keys = make(map[string]any)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = pub
+		}
+	}
+	p.keysAt = time.Now()
+	if k := find(); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *oidcProvider) userinfo(endpoint, accessToken string) (map[string]any, error) {
+	req, _ := http.NewRequest("GET", endpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := ssoHTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo: %s", resp.Status)
+	}
+	var info map[string]any
+	return info, json.NewDecoder(resp.Body).Decode(&info)
+}
+
+func (p *oidcProvider) identity(claims jwt.MapClaims) (*ssoIdentity, error) {
+	id := &ssoIdentity{}
+	id.Subject, _ = claims["sub"].(string)
+	// Unverified emails could claim someone else's address. Many IdPs omit
+	// email_verified entirely, so only trust_email lets those through.
+	if email, _ := claims["email"].(string); email != "" {
+		verified := p.cfg.TrustEmail
+		switch v := claims["email_verified"].(type) {
+		case bool:
+			verified = v
+		case string:
+			verified = v == "true" // some IdPs send it quoted
+		}
+		if verified {
+			id.Email = email
+		}
+	}
+	id.Name, _ = claims["name"].(string)
+	if id.Name == "" {
+		id.Name, _ = claims["preferred_username"].(string)
+	}
+	switch g := claims[p.cfg.GroupsClaim].(type) {
+	case []any:
+		for _, v := range g {
+			if s, ok := v.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = strings.Fields(strings.ReplaceAll(g, ",", " "))
+	}
+	return id, nil
+}
+
+// jwk is one key from a JSON Web Key Set (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	dec := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := dec(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := dec(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func getJSON(u string, v any) error {
+	resp, err := ssoHTTP.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
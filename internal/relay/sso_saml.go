@@ -0,0 +1,486 @@
+package relay
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlProtocolNS      = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNS     = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlMetadataNS      = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlBindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlBindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer          = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlTimeFormat      = "2006-01-02T15:04:05Z"
+
+	// samlRequestTTL bounds how long a user can spend at the IdP
+	samlRequestTTL = 10 * time.Minute
+	// samlTicketTTL bounds the hop from the ACS POST to the callback GET
+	samlTicketTTL = time.Minute
+	// samlClockSkew is tolerated on assertion validity windows
+	samlClockSkew = 2 * time.Minute
+	// samlMetadataTTL is how long fetched IdP metadata is cached
+	samlMetadataTTL = 24 * time.Hour
+)
+
+// samlProvider is a SAML 2.0 service provider for one IdP: SP-initiated
+// login, AuthnRequest over HTTP-Redirect, signed Response over HTTP-POST.
+//
+// The IdP POSTs cross-site to the ACS, where SameSite=Lax cookies aren't
+// sent, so the ACS verifies the response, parks the identity under a
+// one-time ticket and redirects to the callback, which checks the ticket
+// against the browser's flow cookie and signs the user in. Pending
+// requests and tickets are kept in the store, so each step can land on a
+// different login replica.
+type samlProvider struct {
+	cfg *SSOProviderConfig
+	now func() time.Time
+
+	mu   sync.Mutex
+	md   *samlIdP
+	mdAt time.Time
+}
+
+// samlIdP is what we need from the IdP's metadata.
+type samlIdP struct {
+	EntityID string
+	SSOURL   string // HTTP-Redirect SingleSignOnService
+	Certs    []*x509.Certificate
+}
+
+func newSAMLProvider(cfg *SSOProviderConfig) *samlProvider {
+	return &samlProvider{cfg: cfg, now: time.Now}
+}
+
+func (p *samlProvider) Config() *SSOProviderConfig { return p.cfg }
+
+// entityID is our SP entity ID.
+func (p *samlProvider) entityID(s *Server) string {
+	if p.cfg.EntityID != "" {
+		return p.cfg.EntityID
+	}
+	return s.ssoCallbackURL(p.cfg.ID, "metadata")
+}
+
+func (p *samlProvider) metadata() (*samlIdP, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.md != nil && (p.cfg.MetadataFile != "" || time.Since(p.mdAt) < samlMetadataTTL) {
+		return p.md, nil
+	}
+	var data []byte
+	var err error
+	if p.cfg.MetadataFile != "" {
+		data, err = os.ReadFile(p.cfg.MetadataFile)
+	} else {
+		data, err = fetch(p.cfg.MetadataURL)
+	}
+	if err != nil {
+		if p.md != nil {
+			return p.md, nil // keep using the last good copy
+		}
+		return nil, fmt.Errorf("idp metadata: %w", err)
+	}
+	md, err := parseSAMLMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("idp metadata: %w", err)
+	}
+	p.md, p.mdAt = md, time.Now()
+	return md, nil
+}
+
+func parseSAMLMetadata(data []byte) (*samlIdP, error) {
+	var ed struct {
+		XMLName  xml.Name
+		EntityID string `xml:"entityID,attr"`
+		IDP      struct {
+			Keys []struct {
+				Use   string   `xml:"use,attr"`
+				Certs []string `xml:"KeyInfo>X509Data>X509Certificate"`
+			} `xml:"KeyDescriptor"`
+			SSO []struct {
+				Binding  string `xml:"Binding,attr"`
+				Location string `xml:"Location,attr"`
+			} `xml:"SingleSignOnService"`
+		} `xml:"IDPSSODescriptor"`
+	}
+	if err := xml.Unmarshal(data, &ed); err != nil {
+		return nil, err
+	}
+	if ed.XMLName.Space != samlMetadataNS || ed.XMLName.Local != "EntityDescriptor" {
+		return nil, errors.New("not a SAML EntityDescriptor")
+	}
+	md := &samlIdP{EntityID: ed.EntityID}
+	for _, s := range ed.IDP.SSO {
+		if s.Binding == samlBindingRedirect {
+			md.SSOURL = s.Location
+		}
+	}
+	for _, k := range ed.IDP.Keys {
+		if k.Use != "" && k.Use != "signing" {
+			continue
+		}
+		for _, c := range k.Certs {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(c), ""))
+			if err != nil {
+				continue
+			}
+			if cert, err := x509.ParseCertificate(der); err == nil {
+				md.Certs = append(md.Certs, cert)
+			}
+		}
+	}
+	switch {
+	case md.EntityID == "":
+		return nil, errors.New("no entityID")
+	case md.SSOURL == "":
+		return nil, errors.New("no HTTP-Redirect SingleSignOnService")
+	case len(md.Certs) == 0:
+		return nil, errors.New("no signing certificate")
+	}
+	return md, nil
+}
+
+func (p *samlProvider) Begin(w http.ResponseWriter, r *http.Request, s *Server) error {
+	md, err := p.metadata()
+	if err != nil {
+		return err
+	}
+	now := p.now()
+	reqID := "_" + generateToken()
+	if err := s.Store.SaveSAMLRequest(p.cfg.ID, reqID, now.Add(samlRequestTTL)); err != nil {
+		return err
+	}
+	s.setSSOFlow(w, reqID)
+
+	doc := etree.NewDocument()
+	req := doc.CreateElement("samlp:AuthnRequest")
+	req.CreateAttr("xmlns:samlp", samlProtocolNS)
+	req.CreateAttr("xmlns:saml", samlAssertionNS)
+	req.CreateAttr("ID", reqID)
+	req.CreateAttr("Version", "2.0")
+	req.CreateAttr("IssueInstant", now.UTC().Format(samlTimeFormat))
+	req.CreateAttr("Destination", md.SSOURL)
+	req.CreateAttr("AssertionConsumerServiceURL", s.ssoCallbackURL(p.cfg.ID, "acs"))
+	req.CreateAttr("ProtocolBinding", samlBindingPOST)
+	req.CreateElement("saml:Issuer").SetText(p.entityID(s))
+	policy := req.CreateElement("samlp:NameIDPolicy")
+	policy.CreateAttr("AllowCreate", "true")
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	fw.Write(raw)
+	fw.Close()
+	q := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(buf.Bytes())}}
+	sep := "?"
+	if strings.Contains(md.SSOURL, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, md.SSOURL+sep+q.Encode(), http.StatusFound)
+	return nil
+}
+
+// Finish redeems the ticket the ACS issued.
+func (p *samlProvider) Finish(w http.ResponseWriter, r *http.Request, s *Server) (*ssoIdentity, error) {
+	flow := s.takeSSOFlow(w, r)
+	ticket := r.URL.Query().Get("ticket")
+	reqID, data, err := s.Store.TakeSAMLTicket(p.cfg.ID, hashToken(ticket), p.now())
+	if err != nil {
+		return nil, err
+	}
+	if reqID == "" {
+		return nil, errors.New("login expired, try again")
+	}
+	if flow == "" || flow != reqID {
+		return nil, errors.New("login was started in another browser")
+	}
+	var id ssoIdentity
+	if err := json.Unmarshal([]byte(data), &id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// handleSAMLACS receives the IdP's response. POST /auth/sso/{provider}/acs
+func (s *Server) handleSAMLACS(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.idps[r.PathValue("provider")].(*samlProvider)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	id, reqID, err := p.consume(r.FormValue("SAMLResponse"), s)
+	if err != nil {
+		s.Store.AppendAudit("", "sso_rejected", strPtr(fmt.Sprintf("provider=%s error=%s", p.cfg.ID, err)))
+		http.Error(w, p.cfg.Name+" sign-in failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ticket := generateToken()
+	data, _ := json.Marshal(id)
+	if err := s.Store.SaveSAMLTicket(p.cfg.ID, hashToken(ticket), reqID, string(data), p.now().Add(samlTicketTTL)); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/auth/sso/"+p.cfg.ID+"/callback?ticket="+ticket, http.StatusSeeOther)
+}
+
+// handleSAMLMetadata serves our SP metadata for the IdP admin to import.
+// GET /auth/sso/{provider}/metadata
+func (s *Server) handleSAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.idps[r.PathValue("provider")].(*samlProvider)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	ed := doc.CreateElement("md:EntityDescriptor")
+	ed.CreateAttr("xmlns:md", samlMetadataNS)
+	ed.CreateAttr("entityID", p.entityID(s))
+	sp := ed.CreateElement("md:SPSSODescriptor")
+	sp.CreateAttr("AuthnRequestsSigned", "false")
+	sp.CreateAttr("WantAssertionsSigned", "true")
+	sp.CreateAttr("protocolSupportEnumeration", samlProtocolNS)
+	acs := sp.CreateElement("md:AssertionConsumerService")
+	acs.CreateAttr("Binding", samlBindingPOST)
+	acs.CreateAttr("Location", s.ssoCallbackURL(p.cfg.ID, "acs"))
+	acs.CreateAttr("index", "0")
+	doc.Indent(2)
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	doc.WriteTo(w)
+}
+
+// consume verifies a base64 SAMLResponse and returns the identity and the
+// AuthnRequest it answers. Only signed content is read: either the whole
+// Response or the Assertion must carry a valid signature from a metadata
+// certificate.
+func (p *samlProvider) consume(encoded string, s *Server) (*ssoIdentity, string, error) {
+	if encoded == "" {
+		return nil, "", errors.New("missing SAMLResponse")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", errors.New("SAMLResponse is not base64")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, "", fmt.Errorf("SAMLResponse: %w", err)
+	}
+	resp := doc.Root()
+	if resp == nil || resp.Tag != "Response" || resp.NamespaceURI() != samlProtocolNS {
+		return nil, "", errors.New("not a SAML Response")
+	}
+	md, err := p.metadata()
+	if err != nil {
+		return nil, "", err
+	}
+	now := p.now()
+	vctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: md.Certs})
+	vctx.Clock = dsig.NewFakeClockAt(now)
+
+	// Validate returns the signed element as verified; everything below
+	// reads from that copy, never from the raw document
+	if signed, err := vctx.Validate(resp); err == nil {
+		resp = signed
+	} else if !errors.Is(err, dsig.ErrMissingSignature) {
+		return nil, "", fmt.Errorf("response signature: %w", err)
+	} else {
+		resp = nil
+	}
+
+	root := doc.Root()
+	if resp != nil {
+		root = resp
+	}
+	if st := root.FindElement("./Status/StatusCode"); st == nil || st.SelectAttrValue("Value", "") != samlStatusSuccess {
+		code := ""
+		if st != nil {
+			code = st.SelectAttrValue("Value", "")
+		}
+		return nil, "", fmt.Errorf("idp returned status %q", code)
+	}
+	if root.SelectElement("EncryptedAssertion") != nil {
+		return nil, "", errors.New("encrypted assertions are not supported; turn off assertion encryption for this app")
+	}
+	acsURL := s.ssoCallbackURL(p.cfg.ID, "acs")
+	if d := root.SelectAttrValue("Destination", ""); d != "" && d != acsURL {
+		return nil, "", fmt.Errorf("response is for %s", d)
+	}
+	// An unsigned Response can be wrapped around any captured assertion, so
+	// only a signed one vouches for the request it answers; otherwise that
+	// must come from the assertion's own SubjectConfirmationData
+	reqID := ""
+	if resp != nil {
+		reqID = root.SelectAttrValue("InResponseTo", "")
+	}
+	assertions := root.SelectElements("Assertion")
+	if len(assertions) != 1 {
+		return nil, "", fmt.Errorf("want 1 assertion, got %d", len(assertions))
+	}
+	assertion := assertions[0]
+	if resp == nil {
+		signed, err := vctx.Validate(assertion)
+		if err != nil {
+			return nil, "", fmt.Errorf("assertion signature: %w", err)
+		}
+		assertion = signed
+	}
+	if assertion.NamespaceURI() != samlAssertionNS {
+		return nil, "", errors.New("assertion has the wrong namespace")
+	}
+
+	if iss := assertion.SelectElement("Issuer"); iss == nil || strings.TrimSpace(iss.Text()) != md.EntityID {
+		return nil, "", errors.New("assertion is from another issuer")
+	}
+	if err := samlCheckWindow(assertion.SelectElement("Conditions"), now); err != nil {
+		return nil, "", err
+	}
+	audienceOK := false
+	for _, a := range assertion.FindElements("./Conditions/AudienceRestriction/Audience") {
+		if strings.TrimSpace(a.Text()) == p.entityID(s) {
+			audienceOK = true
+		}
+	}
+	if !audienceOK {
+		return nil, "", fmt.Errorf("assertion is not for %s", p.entityID(s))
+	}
+
+	subject := assertion.SelectElement("Subject")
+	if subject == nil {
+		return nil, "", errors.New("assertion has no subject")
+	}
+	bearerOK := false
+	for _, sc := range subject.SelectElements("SubjectConfirmation") {
+		if sc.SelectAttrValue("Method", "") != samlBearer {
+			continue
+		}
+		data := sc.SelectElement("SubjectConfirmationData")
+		if data == nil || data.SelectAttrValue("Recipient", "") != acsURL {
+			continue
+		}
+		if irt := data.SelectAttrValue("InResponseTo", ""); irt != "" {
+			if reqID != "" && irt != reqID {
+				continue
+			}
+			reqID = irt
+		}
+		if samlCheckWindow(data, now) == nil && data.SelectAttrValue("NotOnOrAfter", "") != "" {
+			bearerOK = true
+		}
+	}
+	if !bearerOK {
+		return nil, "", errors.New("no valid bearer subject confirmation")
+	}
+
+	// One use per AuthnRequest; IdP-initiated logins have none and are refused
+	ok := false
+	if reqID != "" {
+		if ok, err = s.Store.TakeSAMLRequest(p.cfg.ID, reqID, now); err != nil {
+			return nil, "", err
+		}
+	}
+	if !ok {
+		return nil, "", errors.New("response doesn't match a pending login (expired, replayed or IdP-initiated)")
+	}
+
+	nameID := subject.SelectElement("NameID")
+	if nameID == nil || strings.TrimSpace(nameID.Text()) == "" {
+		return nil, "", errors.New("assertion has no NameID")
+	}
+	id := &ssoIdentity{Subject: strings.TrimSpace(nameID.Text())}
+	attrs := samlAttributes(assertion)
+	id.Email = firstAttr(attrs, p.cfg.EmailAttribute, "email", "mail", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress")
+	if id.Email == "" && strings.Contains(id.Subject, "@") {
+		id.Email = id.Subject
+	}
+	id.Name = firstAttr(attrs, p.cfg.NameAttribute, "displayName", "name", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name")
+	groupsAttr := p.cfg.GroupsAttribute
+	if groupsAttr == "" {
+		groupsAttr = "groups"
+	}
+	id.Groups = attrs[groupsAttr]
+	return id, reqID, nil
+}
+
+// samlCheckWindow checks NotBefore / NotOnOrAfter on el, if present.
+func samlCheckWindow(el *etree.Element, now time.Time) error {
+	if el == nil {
+		return nil
+	}
+	if v := el.SelectAttrValue("NotBefore", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || now.Add(samlClockSkew).Before(t) {
+			return errors.New("assertion is not valid yet")
+		}
+	}
+	if v := el.SelectAttrValue("NotOnOrAfter", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || !now.Add(-samlClockSkew).Before(t) {
+			return errors.New("assertion has expired")
+		}
+	}
+	return nil
+}
+
+// samlAttributes collects AttributeStatement values by attribute Name.
+func samlAttributes(assertion *etree.Element) map[string][]string {
+	out := make(map[string][]string)
+	for _, a := range assertion.FindElements("./AttributeStatement/Attribute") {
+		name := a.SelectAttrValue("Name", "")
+		for _, v := range a.SelectElements("AttributeValue") {
+			if t := strings.TrimSpace(v.Text()); t != "" {
+				out[name] = append(out[name], t)
+			}
+		}
+	}
+	return out
+}
+
+// firstAttr returns the first value of the configured attribute, or of the
+// first default present.
+func firstAttr(attrs map[string][]string, configured string, defaults ...string) string {
+	names := defaults
+	if configured != "" {
+		names = []string{configured}
+	}
+	for _, n := range names {
+		if v := attrs[n]; len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func fetch(u string) ([]byte, error) {
+	resp, err := ssoHTTP.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+}
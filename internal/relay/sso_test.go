@@ -0,0 +1,683 @@
+package relay
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/golang-jwt/jwt/v5"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// ssoTestServer starts a relay with the given SSO config whose BaseURL is
+// its own address, plus an org "acme" owned by someone else.
+func ssoTestServer(t *testing.T, cfg *SSOConfig) (*Server, *httptest.Server, *http.Client) {
+	t.Helper()
+	store := testStore(t)
+	ts := httptest.NewServer(nil)
+	t.Cleanup(ts.Close)
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	srv := NewServer(store, ServerConfig{BaseURL: ts.URL, SSO: cfg})
+	ts.Config.Handler = srv
+
+	store.CreateUser("acme-owner")
+	if err := store.CreateOrg("acme-id", "Acme", "acme", "acme-owner"); err != nil {
+		t.Fatalf("create org: %v", err)
+	}
+	store.SetOrgMaxSeats("acme-id", 100)
+
+	jar, _ := cookiejar.New(nil)
+	return srv, ts, &http.Client{Jar: jar}
+}
+
+// mockOIDC is a minimal OpenID provider: discovery, authorize (auto-approves
+// as the configured user), token with PKCE check, JWKS.
+type mockOIDC struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	sub    string
+	email  string
+	groups []string
+
+	mu    sync.Mutex
+	codes map[string]url.Values // code → authorize params
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{key: key, kid: "k1", sub: "alice-sub", email: "alice@acme.test", codes: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := generateToken()
+		m.mu.Lock()
+		m.codes[code] = q
+		m.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		q, ok := m.codes[r.FormValue("code")]
+		delete(m.codes, r.FormValue("code"))
+		m.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != q.Get("code_challenge") {
+			writeJSON(w, 400, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":            m.URL,
+			"aud":            q.Get("client_id"),
+			"sub":            m.sub,
+			"email":          m.email,
+			"email_verified": true,
+			"name":           "Alice",
+			"nonce":          q.Get("nonce"),
+			"groups":         m.groups,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = m.kid
+		signed, _ := tok.SignedString(m.key)
+		writeJSON(w, 200, map[string]string{"id_token": signed, "access_token": "at", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func oidcConfig(issuer string) *SSOConfig {
+	return &SSOConfig{
+		Providers: []SSOProviderConfig{{ID: "okta", Name: "Okta", Type: "oidc", Issuer: issuer, ClientID: "wt-client", ClientSecret: "s3cret"}},
+		Orgs: map[string]SSOOrgPolicy{
+			"acme": {Provider: "okta", Required: true, Groups: map[string]string{"wt-admins": "admin", "eng": "member"}},
+		},
+	}
+}
+
+func hasSessionCookie(client *http.Client, base string) bool {
+	u, _ := url.Parse(base)
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == sessionCookieName && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSSOOIDCLoginMapsGroups(t *testing.T) {
+	idp := newMockOIDC(t)
+	idp.groups = []string{"eng", "wt-admins"}
+	srv, ts, client := ssoTestServer(t, oidcConfig(idp.URL))
+
+	resp, err := client.Get(ts.URL + "/auth/sso/okta")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	resp.Body.Close()
+	if !hasSessionCookie(client, ts.URL) {
+		t.Fatalf("no session after login (final status %d)", resp.StatusCode)
+	}
+
+	user, _ := srv.Store.GetUserByProvider("sso:okta", "alice-sub")
+	if user == nil {
+		t.Fatal("user not created")
+	}
+	if user.Email == nil || *user.Email != "alice@acme.test" {
+		t.Errorf("email = %v, want alice@acme.test", user.Email)
+	}
+	if role := srv.Store.GetOrgMemberRole("acme-id", user.ID); role != "admin" {
+		t.Errorf("role = %q, want admin (highest mapped group)", role)
+	}
+
+	// Dropped from wt-admins at the IdP → demoted on next login
+	idp.groups = []string{"eng"}
+	client.Jar, _ = cookiejar.New(nil)
+	resp, _ = client.Get(ts.URL + "/auth/sso/okta")
+	resp.Body.Close()
+	if role := srv.Store.GetOrgMemberRole("acme-id", user.ID); role != "member" {
+		t.Errorf("role after demotion = %q, want member", role)
+	}
+
+	// In no mapped group → removed
+	idp.groups = nil
+	client.Jar, _ = cookiejar.New(nil)
+	resp, _ = client.Get(ts.URL + "/auth/sso/okta")
+	resp.Body.Close()
+	if srv.Store.IsOrgMember("acme-id", user.ID) {
+		t.Error("still a member with no mapped groups")
+	}
+	if !srv.Store.IsOrgMember("acme-id", "acme-owner") {
+		t.Error("org owner must never be removed")
+	}
+}
+
+func TestSSOOIDCRejectsUnknownKey(t *testing.T) {
+	idp := newMockOIDC(t)
+	idp.kid = "rotated-away"
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idp.key = other
+	_, ts, client := ssoTestServer(t, oidcConfig(idp.URL))
+
+	resp, err := client.Get(ts.URL + "/auth/sso/okta")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "signing key") {
+		t.Errorf("status = %d body = %q, want 400 about the signing key", resp.StatusCode, body)
+	}
+	if hasSessionCookie(client, ts.URL) {
+		t.Error("session created from a token signed by an unknown key")
+	}
+}
+
+func TestSSOOIDCRejectsForgedState(t *testing.T) {
+	idp := newMockOIDC(t)
+	_, ts, client := ssoTestServer(t, oidcConfig(idp.URL))
+
+	resp, err := client.Get(ts.URL + "/auth/sso/okta/callback?code=x&state=attacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestSSORequiredOrgBlocksOtherLogins(t *testing.T) {
+	idp := newMockOIDC(t)
+	srv, ts, client := ssoTestServer(t, oidcConfig(idp.URL))
+	srv.DevMode = true
+
+	dev, _ := srv.Store.CreateUserDev()
+	srv.Store.AddOrgMember("acme-id", dev.ID, "member")
+
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(ts.URL + "/auth/dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "Okta") {
+		t.Errorf("status = %d body = %q, want 403 naming Okta", resp.StatusCode, body)
+	}
+
+	// Not a member of acme → unaffected
+	srv.Store.RemoveOrgMember("acme-id", dev.ID)
+	resp, _ = client.Get(ts.URL + "/auth/dev")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("non-member dev login status = %d, want 303", resp.StatusCode)
+	}
+}
+
+func TestSSORequiredLocksExistingCredentials(t *testing.T) {
+	idp := newMockOIDC(t)
+	srv, ts, client := ssoTestServer(t, oidcConfig(idp.URL))
+	srv.DevMode = true
+
+	// Credentials from before the user joined an org that requires SSO
+	dev, _ := srv.Store.CreateUserDev()
+	srv.Store.CreateSession("web-sess", dev.ID, time.Now().Add(time.Hour))
+	srv.Store.CreateDeviceToken("dev-tok", dev.ID, "laptop", nil)
+	srv.Store.CreateAPIToken(&APIToken{ID: "pat-1", UserID: dev.ID, Name: "ci", Scopes: []string{"wings:read"}}, hashToken("wtp_pat"))
+	srv.Store.AddOrgMember("acme-id", dev.ID, "member")
+
+	me := func(header, value string) int {
+		req, _ := http.NewRequest("GET", ts.URL+"/api/app/me", nil)
+		if header == "Cookie" {
+			req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: value})
+		} else {
+			req.Header.Set(header, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := me("Cookie", "web-sess"); code != http.StatusUnauthorized {
+		t.Errorf("web session: status %d, want 401", code)
+	}
+	if u := srv.tokenUser(&http.Request{Header: http.Header{"Authorization": {"Bearer dev-tok"}}}); u != nil {
+		t.Error("device token accepted")
+	}
+	if u, _ := srv.resolveAPIToken("wtp_pat"); u != nil {
+		t.Error("PAT accepted")
+	}
+	if !srv.userSuspended(t.Context(), dev.ID) {
+		t.Error("wings not refused")
+	}
+
+	// Turning required on revokes the sessions outright
+	if err := srv.RevokeSSOBypasses(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Store.RemoveOrgMember("acme-id", dev.ID)
+	if u, _ := srv.Store.GetSession("web-sess"); u != nil {
+		t.Error("web session survived RevokeSSOBypasses")
+	}
+	if _, _, err := srv.Store.ValidateToken("dev-tok"); err == nil {
+		t.Error("device token survived RevokeSSOBypasses")
+	}
+	if srv.userSuspended(t.Context(), dev.ID) {
+		t.Error("non-member still refused")
+	}
+}
+
+func TestSSOLinksExistingAccountByEmail(t *testing.T) {
+	idp := newMockOIDC(t)
+	idp.groups = []string{"eng"}
+	srv, ts, client := ssoTestServer(t, oidcConfig(idp.URL))
+
+	gh := &User{ID: "gh-alice", Provider: "github", ProviderID: "123", DisplayName: "alice"}
+	srv.Store.UpsertUser(gh)
+	srv.Store.UpdateUserEmail(gh.ID, "alice@acme.test")
+	srv.Store.CreateSession("gh-sess", gh.ID, time.Now().Add(time.Hour))
+
+	resp, err := client.Get(ts.URL + "/auth/sso/okta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !hasSessionCookie(client, ts.URL) {
+		t.Fatalf("no session after login (final status %d)", resp.StatusCode)
+	}
+	user, _ := srv.Store.GetUserByProvider("sso:okta", "alice-sub")
+	if user == nil || user.ID != gh.ID {
+		t.Fatalf("sso user = %+v, want the existing account %s", user, gh.ID)
+	}
+	if !srv.Store.IsOrgMember("acme-id", gh.ID) {
+		t.Error("linked account not given its group's membership")
+	}
+	if u, _ := srv.Store.GetSession("gh-sess"); u != nil {
+		t.Error("GitHub session survived the link")
+	}
+}
+
+func TestSSOConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SSOConfig
+		want string
+	}{
+		{"bad id", SSOConfig{Providers: []SSOProviderConfig{{ID: "Okta!", Type: "oidc", Issuer: "x", ClientID: "y"}}}, "lowercase"},
+		{"oidc missing issuer", SSOConfig{Providers: []SSOProviderConfig{{ID: "okta", Type: "oidc"}}}, "issuer"},
+		{"saml both metadata", SSOConfig{Providers: []SSOProviderConfig{{ID: "adfs", Type: "saml", MetadataURL: "u", MetadataFile: "f"}}}, "exactly one"},
+		{"unknown type", SSOConfig{Providers: []SSOProviderConfig{{ID: "x", Type: "ldap"}}}, "type"},
+		{"no providers", SSOConfig{}, "no providers"},
+		{"org unknown provider", SSOConfig{
+			Providers: []SSOProviderConfig{{ID: "okta", Type: "oidc", Issuer: "x", ClientID: "y"}},
+			Orgs:      map[string]SSOOrgPolicy{"acme": {Provider: "nope"}},
+		}, "unknown provider"},
+		{"owner role", SSOConfig{
+			Providers: []SSOProviderConfig{{ID: "okta", Type: "oidc", Issuer: "x", ClientID: "y"}},
+			Orgs:      map[string]SSOOrgPolicy{"acme": {Provider: "okta", Groups: map[string]string{"g": "owner"}}},
+		}, "admin or member"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// --- SAML ---
+
+const mockSAMLIssuer = "https://idp.test/saml"
+
+func samlConfig(t *testing.T, ks dsig.X509KeyStore) *SSOConfig {
+	t.Helper()
+	_, cert, _ := ks.GetKeyPair()
+	md := fmt.Sprintf(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.test/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`, mockSAMLIssuer, base64.StdEncoding.EncodeToString(cert))
+	path := filepath.Join(t.TempDir(), "idp.xml")
+	os.WriteFile(path, []byte(md), 0o644)
+	return &SSOConfig{
+		Providers: []SSOProviderConfig{{ID: "adfs", Name: "ADFS", Type: "saml", MetadataFile: path}},
+		Orgs:      map[string]SSOOrgPolicy{"acme": {Provider: "adfs", Groups: map[string]string{"eng": "member"}}},
+	}
+}
+
+// samlBegin starts a login and returns the AuthnRequest ID.
+func samlBegin(t *testing.T, ts *httptest.Server, client *http.Client) string {
+	t.Helper()
+	noFollow := *client
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noFollow.Get(ts.URL + "/auth/sso/adfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	if loc == nil || loc.Host != "idp.test" {
+		t.Fatalf("redirect = %q, want the IdP", resp.Header.Get("Location"))
+	}
+	raw, _ := base64.StdEncoding.DecodeString(loc.Query().Get("SAMLRequest"))
+	xmlReq, err := io.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("inflate AuthnRequest: %v", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlReq); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Root().SelectAttrValue("ID", "")
+}
+
+// samlResponse builds a base64 Response to reqID with a signed assertion.
+// tamper runs after signing.
+func samlResponse(t *testing.T, ks dsig.X509KeyStore, ts *httptest.Server, reqID, email string, groups []string, tamper func(*etree.Element)) string {
+	t.Helper()
+	now := time.Now().UTC()
+	acs := ts.URL + "/auth/sso/adfs/acs"
+	doc := etree.NewDocument()
+	resp := doc.CreateElement("samlp:Response")
+	resp.CreateAttr("xmlns:samlp", samlProtocolNS)
+	resp.CreateAttr("ID", "_resp"+generateToken()[:8])
+	resp.CreateAttr("Version", "2.0")
+	resp.CreateAttr("IssueInstant", now.Format(samlTimeFormat))
+	resp.CreateAttr("Destination", acs)
+	resp.CreateAttr("InResponseTo", reqID)
+	resp.CreateElement("samlp:Status").CreateElement("samlp:StatusCode").CreateAttr("Value", samlStatusSuccess)
+
+	a := etree.NewElement("saml:Assertion")
+	a.CreateAttr("xmlns:saml", samlAssertionNS)
+	a.CreateAttr("ID", "_assert"+generateToken()[:8])
+	a.CreateAttr("Version", "2.0")
+	a.CreateAttr("IssueInstant", now.Format(samlTimeFormat))
+	a.CreateElement("saml:Issuer").SetText(mockSAMLIssuer)
+	subj := a.CreateElement("saml:Subject")
+	subj.CreateElement("saml:NameID").SetText("alice-nameid")
+	sc := subj.CreateElement("saml:SubjectConfirmation")
+	sc.CreateAttr("Method", samlBearer)
+	scd := sc.CreateElement("saml:SubjectConfirmationData")
+	scd.CreateAttr("Recipient", acs)
+	scd.CreateAttr("InResponseTo", reqID)
+	scd.CreateAttr("NotOnOrAfter", now.Add(5*time.Minute).Format(samlTimeFormat))
+	cond := a.CreateElement("saml:Conditions")
+	cond.CreateAttr("NotBefore", now.Add(-time.Minute).Format(samlTimeFormat))
+	cond.CreateAttr("NotOnOrAfter", now.Add(5*time.Minute).Format(samlTimeFormat))
+	cond.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(ts.URL + "/auth/sso/adfs/metadata")
+	attrs := a.CreateElement("saml:AttributeStatement")
+	addAttr := func(name string, vals ...string) {
+		at := attrs.CreateElement("saml:Attribute")
+		at.CreateAttr("Name", name)
+		for _, v := range vals {
+			at.CreateElement("saml:AttributeValue").SetText(v)
+		}
+	}
+	addAttr("email", email)
+	addAttr("groups", groups...)
+
+	signed, err := dsig.NewDefaultSigningContext(ks).SignEnveloped(a)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	resp.AddChild(signed)
+	if tamper != nil {
+		tamper(resp)
+	}
+	out, _ := doc.WriteToBytes()
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+// removeSignature drops el's ds:Signature. (SignEnveloped's element doesn't
+// parent its signature, so RemoveChild can't find it.)
+func removeSignature(el *etree.Element) {
+	for i, c := range el.Child {
+		if e, ok := c.(*etree.Element); ok && e.Tag == "Signature" {
+			el.RemoveChildAt(i)
+			return
+		}
+	}
+}
+
+func postACS(t *testing.T, ts *httptest.Server, client *http.Client, samlResp string) *http.Response {
+	t.Helper()
+	resp, err := client.PostForm(ts.URL+"/auth/sso/adfs/acs", url.Values{"SAMLResponse": {samlResp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestSSOSAMLLogin(t *testing.T) {
+	ks := dsig.RandomKeyStoreForTest()
+	srv, ts, client := ssoTestServer(t, samlConfig(t, ks))
+
+	reqID := samlBegin(t, ts, client)
+	samlResp := samlResponse(t, ks, ts, reqID, "alice@acme.test", []string{"eng"}, nil)
+	resp := postACS(t, ts, client, samlResp)
+	if !hasSessionCookie(client, ts.URL) {
+		t.Fatalf("no session after ACS (final status %d)", resp.StatusCode)
+	}
+	user, _ := srv.Store.GetUserByProvider("sso:adfs", "alice-nameid")
+	if user == nil {
+		t.Fatal("user not created")
+	}
+	if role := srv.Store.GetOrgMemberRole("acme-id", user.ID); role != "member" {
+		t.Errorf("role = %q, want member", role)
+	}
+
+	// The same response can't be used twice
+	client.Jar, _ = cookiejar.New(nil)
+	if resp := postACS(t, ts, client, samlResp); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("replay status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestSSOSAMLAcrossReplicas(t *testing.T) {
+	ks := dsig.RandomKeyStoreForTest()
+	srv, ts, client := ssoTestServer(t, samlConfig(t, ks))
+	other := NewServer(srv.Store, srv.Config)
+
+	// Each leg lands on a different login replica sharing the store
+	var mu sync.Mutex
+	replica := http.Handler(srv)
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		h := replica
+		mu.Unlock()
+		h.ServeHTTP(w, r)
+	})
+	use := func(h http.Handler) {
+		mu.Lock()
+		replica = h
+		mu.Unlock()
+	}
+
+	reqID := samlBegin(t, ts, client)
+	use(other)
+	noFollow := *client
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noFollow.PostForm(ts.URL+"/auth/sso/adfs/acs", url.Values{"SAMLResponse": {samlResponse(t, ks, ts, reqID, "alice@acme.test", nil, nil)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("acs on another replica: %d", resp.StatusCode)
+	}
+	use(srv)
+	resp, err = client.Get(ts.URL + resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !hasSessionCookie(client, ts.URL) {
+		t.Fatalf("no session after callback on the first replica (status %d)", resp.StatusCode)
+	}
+}
+
+func TestSSOSAMLRejectsBadResponses(t *testing.T) {
+	ks := dsig.RandomKeyStoreForTest()
+	_, ts, client := ssoTestServer(t, samlConfig(t, ks))
+
+	tests := []struct {
+		name   string
+		signer dsig.X509KeyStore
+		tamper func(*etree.Element)
+	}{
+		{"tampered attribute", ks, func(resp *etree.Element) {
+			resp.FindElement("./Assertion/AttributeStatement/Attribute/AttributeValue").SetText("mallory@evil.test")
+		}},
+		{"wrong key", dsig.RandomKeyStoreForTest(), nil},
+		{"signature stripped", ks, func(resp *etree.Element) {
+			removeSignature(resp.SelectElement("Assertion"))
+		}},
+		{"wrapped assertion", ks, func(resp *etree.Element) {
+			// XSW: move the signed assertion aside and put an unsigned one first
+			signed := resp.SelectElement("Assertion")
+			forged := signed.Copy()
+			removeSignature(forged)
+			forged.SelectElement("Subject").SelectElement("NameID").SetText("admin")
+			resp.InsertChildAt(signed.Index(), forged)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.Jar, _ = cookiejar.New(nil)
+			reqID := samlBegin(t, ts, client)
+			resp := postACS(t, ts, client, samlResponse(t, tt.signer, ts, reqID, "alice@acme.test", nil, tt.tamper))
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", resp.StatusCode)
+			}
+			if hasSessionCookie(client, ts.URL) {
+				t.Error("session created")
+			}
+		})
+	}
+
+	// Response to a request this SP never made (IdP-initiated or forged)
+	client.Jar, _ = cookiejar.New(nil)
+	resp := postACS(t, ts, client, samlResponse(t, ks, ts, "_never-sent", "alice@acme.test", nil, nil))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unsolicited status = %d, want 400", resp.StatusCode)
+	}
+
+	// A captured assertion that names no request, wrapped in an unsigned
+	// Response claiming to answer the attacker's own pending request
+	client.Jar, _ = cookiejar.New(nil)
+	reqID := samlBegin(t, ts, client)
+	resp = postACS(t, ts, client, samlResponse(t, ks, ts, "", "alice@acme.test", nil, func(r *etree.Element) {
+		r.CreateAttr("InResponseTo", reqID)
+	}))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unsigned InResponseTo status = %d, want 400", resp.StatusCode)
+	}
+	if hasSessionCookie(client, ts.URL) {
+		t.Error("session created from an unsigned InResponseTo")
+	}
+}
+
+func TestSSOSAMLMetadata(t *testing.T) {
+	ks := dsig.RandomKeyStoreForTest()
+	_, ts, _ := ssoTestServer(t, samlConfig(t, ks))
+	resp, err := http.Get(ts.URL + "/auth/sso/adfs/metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), ts.URL+"/auth/sso/adfs/acs") {
+		t.Errorf("status = %d body = %s, want SP metadata with the ACS URL", resp.StatusCode, body)
+	}
+}
+
+func TestSSOLoginPageListsProviders(t *testing.T) {
+	idp := newMockOIDC(t)
+	_, ts, _ := ssoTestServer(t, oidcConfig(idp.URL))
+	resp, err := http.Get(ts.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `href="/auth/sso/okta"`) || !strings.Contains(string(body), "continue with Okta") {
+		t.Error("login page has no Okta button")
+	}
+}
+
+func TestSSOOIDCEmailVerified(t *testing.T) {
+	for _, tc := range []struct {
+		verified any
+		trust    bool
+		want     string
+	}{
+		{true, false, "alice@acme.test"},
+		{"true", false, "alice@acme.test"},
+		{false, false, ""},
+		{nil, false, ""},
+		{nil, true, "alice@acme.test"},
+		{false, true, ""},
+	} {
+		p := &oidcProvider{cfg: &SSOProviderConfig{GroupsClaim: "groups", TrustEmail: tc.trust}}
+		claims := jwt.MapClaims{"sub": "s", "email": "alice@acme.test"}
+		if tc.verified != nil {
+			claims["email_verified"] = tc.verified
+		}
+		id, _ := p.identity(claims)
+		if id.Email != tc.want {
+			t.Errorf("email_verified=%v trust=%v: email = %q, want %q", tc.verified, tc.trust, id.Email, tc.want)
+		}
+	}
+}
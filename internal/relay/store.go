@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"embed"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -11,16 +12,20 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/postgres/*.sql
 var migrationsFS embed.FS
 
 type RelayStore struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
 }
 
 // DB returns the underlying database connection.
 func (s *RelayStore) DB() *sql.DB { return s.db }
 
+// Dialect returns "sqlite" or "postgres".
+func (s *RelayStore) Dialect() string { return s.dialect.name }
+
 type DeviceCodeRow struct {
 	Code      string
 	UserCode  string
@@ -32,7 +37,27 @@ type DeviceCodeRow struct {
 	Claimed   bool
 }
 
+// OpenRelay opens the relay database and applies pending migrations. A
+// postgres:// or postgresql:// URL opens PostgreSQL; anything else is a
+// SQLite path.
 func OpenRelay(dsn string) (*RelayStore, error) {
+	if isPostgresDSN(dsn) {
+		db, err := openPostgres(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("open db: %w", err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("connect postgres: %w", err)
+		}
+		s := &RelayStore{db: db, dialect: postgresDialect}
+		if err := s.migrate(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+		return s, nil
+	}
+
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
@@ -45,7 +70,7 @@ func OpenRelay(dsn string) (*RelayStore, error) {
 		db.Close()
 		return nil, fmt.Errorf("enable foreign keys: %w", err)
 	}
-	s := &RelayStore{db: db}
+	s := &RelayStore{db: db, dialect: sqliteDialect}
 	if err := s.migrate(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("migrate: %w", err)
@@ -136,7 +161,8 @@ func (s *RelayStore) CreateDeviceToken(token, userID, deviceID string, expiresAt
 func (s *RelayStore) ValidateToken(token string) (userID string, deviceID string, err error) {
 	now := time.Now().UTC().Format("2006-01-02 15:04:05")
 	row := s.db.QueryRow(
-		"SELECT user_id, device_id FROM device_tokens WHERE token = ? AND (expires_at IS NULL OR expires_at > ?)",
+		`SELECT user_id, device_id FROM device_tokens WHERE token = ? AND (expires_at IS NULL OR expires_at > ?)
+		 AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL)`,
 		token, now,
 	)
 	err = row.Scan(&userID, &deviceID)
@@ -173,14 +199,14 @@ func (s *RelayStore) CreateSession(token, userID string, expiresAt time.Time) er
 func (s *RelayStore) GetSession(token string) (*User, error) {
 	now := time.Now().UTC().Format("2006-01-02 15:04:05")
 	row := s.db.QueryRow(
-		`SELECT u.id, u.provider, u.provider_id, u.display_name, u.avatar_url, u.email, u.tier, u.is_pro, u.created_at
+		`SELECT u.id, u.provider, u.provider_id, u.display_name, u.avatar_url, u.email, u.tier, u.is_pro, u.created_at, u.is_admin, u.suspended_at
 		 FROM sessions s JOIN users u ON u.id = s.user_id
-		 WHERE s.token = ? AND s.expires_at > ?`,
+		 WHERE s.token = ? AND s.expires_at > ? AND u.suspended_at IS NULL`,
 		token, now,
 	)
 	var u User
-	var isPro int
-	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt)
+	var isPro, isAdmin int
+	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt, &isAdmin, &u.SuspendedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -188,6 +214,7 @@ func (s *RelayStore) GetSession(token string) (*User, error) {
 		return nil, fmt.Errorf("get session: %w", err)
 	}
 	u.IsPro = isPro != 0
+	u.IsAdmin = isAdmin != 0
 	return &u, nil
 }
 
@@ -199,6 +226,21 @@ func (s *RelayStore) DeleteSession(token string) error {
 	return nil
 }
 
+// RevokeUserSessions deletes every web session and device token the user
+// holds, signing them out everywhere. Returns how many were deleted.
+func (s *RelayStore) RevokeUserSessions(userID string) (int64, error) {
+	var n int64
+	for _, table := range []string{"sessions", "device_tokens"} {
+		res, err := s.db.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID)
+		if err != nil {
+			return n, fmt.Errorf("revoke user sessions: %w", err)
+		}
+		m, _ := res.RowsAffected()
+		n += m
+	}
+	return n, nil
+}
+
 // Magic link methods
 
 func (s *RelayStore) CreateMagicLink(id, email, token string, expiresAt time.Time) error {
@@ -253,7 +295,7 @@ func (s *RelayStore) GetRelayConfig(key string) (string, error) {
 // SetRelayConfig writes a value to the relay_config table.
 func (s *RelayStore) SetRelayConfig(key, value string) error {
 	_, err := s.db.Exec(
-		"INSERT OR REPLACE INTO relay_config (key, value) VALUES (?, ?)",
+		"INSERT INTO relay_config (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value",
 		key, value,
 	)
 	if err != nil {
@@ -262,6 +304,20 @@ func (s *RelayStore) SetRelayConfig(key, value string) error {
 	return nil
 }
 
+// InitRelayConfig writes value unless key is already set, and returns
+// whichever value is stored. Nodes racing to initialise a key agree on the
+// first one written.
+func (s *RelayStore) InitRelayConfig(key, value string) (string, error) {
+	_, err := s.db.Exec(
+		"INSERT INTO relay_config (key, value) VALUES (?, ?) ON CONFLICT(key) DO NOTHING",
+		key, value,
+	)
+	if err != nil {
+		return "", fmt.Errorf("init relay config %s: %w", key, err)
+	}
+	return s.GetRelayConfig(key)
+}
+
 // CreateUserDev creates a dev-mode social user if one doesn't exist.
 func (s *RelayStore) CreateUserDev() (*User, error) {
 	u, err := s.GetUserByProvider("dev", "dev")
@@ -380,9 +436,18 @@ func (s *RelayStore) GetDeviceCodeByUserCode(userCode string) (*DeviceCodeRow, e
 }
 
 func (s *RelayStore) AppendAudit(userID, event string, detail *string) error {
+	return s.AppendOrgAudit(userID, "", event, detail)
+}
+
+// AppendOrgAudit records an event that also shows in an org's audit log.
+func (s *RelayStore) AppendOrgAudit(userID, orgID, event string, detail *string) error {
+	var org *string
+	if orgID != "" {
+		org = &orgID
+	}
 	_, err := s.db.Exec(
-		"INSERT INTO audit_log (user_id, event, detail) VALUES (?, ?, ?)",
-		userID, event, detail,
+		"INSERT INTO audit_log (user_id, org_id, event, detail) VALUES (?, ?, ?, ?)",
+		userID, org, event, detail,
 	)
 	if err != nil {
 		return fmt.Errorf("append audit: %w", err)
@@ -400,6 +465,8 @@ type User struct {
 	Email       *string
 	Tier        string // "free", "pro", "team"
 	IsPro       bool
+	IsAdmin     bool       // relay admin: may use /api/v1/admin
+	SuspendedAt *time.Time // suspended by an admin: no logins, tokens or wings
 	CreatedAt   time.Time
 	OrgIDs      []string // transient: populated by session cache on edge nodes
 }
@@ -459,12 +526,12 @@ func (s *RelayStore) UpsertUser(u *User) error {
 
 func (s *RelayStore) GetUserByProvider(provider, providerID string) (*User, error) {
 	row := s.db.QueryRow(
-		"SELECT id, provider, provider_id, display_name, avatar_url, email, tier, is_pro, created_at FROM users WHERE provider = ? AND provider_id = ?",
+		"SELECT id, provider, provider_id, display_name, avatar_url, email, tier, is_pro, created_at, is_admin, suspended_at FROM users WHERE provider = ? AND provider_id = ?",
 		provider, providerID,
 	)
 	var u User
-	var isPro int
-	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt)
+	var isPro, isAdmin int
+	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt, &isAdmin, &u.SuspendedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -472,6 +539,7 @@ func (s *RelayStore) GetUserByProvider(provider, providerID string) (*User, erro
 		return nil, fmt.Errorf("get social user by provider: %w", err)
 	}
 	u.IsPro = isPro != 0
+	u.IsAdmin = isAdmin != 0
 	return &u, nil
 }
 
@@ -483,6 +551,9 @@ func (s *RelayStore) GetOrCreateUserByEmail(email string) (*User, error) {
 	if u != nil {
 		return u, nil
 	}
+	if u, err := s.ClaimSCIMUser(email, "email", email); err != nil || u != nil {
+		return u, err
+	}
 	u = &User{
 		ID:          generateToken(),
 		Provider:    "email",
@@ -498,12 +569,12 @@ func (s *RelayStore) GetOrCreateUserByEmail(email string) (*User, error) {
 // GetUserByID returns a user by their ID.
 func (s *RelayStore) GetUserByID(id string) (*User, error) {
 	row := s.db.QueryRow(
-		"SELECT id, provider, provider_id, display_name, avatar_url, email, tier, is_pro, created_at FROM users WHERE id = ?",
+		"SELECT id, provider, provider_id, display_name, avatar_url, email, tier, is_pro, created_at, is_admin, suspended_at FROM users WHERE id = ?",
 		id,
 	)
 	var u User
-	var isPro int
-	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt)
+	var isPro, isAdmin int
+	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt, &isAdmin, &u.SuspendedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -511,6 +582,7 @@ func (s *RelayStore) GetUserByID(id string) (*User, error) {
 		return nil, fmt.Errorf("get social user by id: %w", err)
 	}
 	u.IsPro = isPro != 0
+	u.IsAdmin = isAdmin != 0
 	return &u, nil
 }
 
@@ -529,12 +601,12 @@ func (s *RelayStore) UpdateUserTier(userID, tier string) error {
 // GetUserByEmail returns a user by email.
 func (s *RelayStore) GetUserByEmail(email string) (*User, error) {
 	row := s.db.QueryRow(
-		"SELECT id, provider, provider_id, display_name, avatar_url, email, tier, is_pro, created_at FROM users WHERE email = ?",
+		"SELECT id, provider, provider_id, display_name, avatar_url, email, tier, is_pro, created_at, is_admin, suspended_at FROM users WHERE email = ?",
 		email,
 	)
 	var u User
-	var isPro int
-	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt)
+	var isPro, isAdmin int
+	err := row.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt, &isAdmin, &u.SuspendedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -542,6 +614,7 @@ func (s *RelayStore) GetUserByEmail(email string) (*User, error) {
 		return nil, fmt.Errorf("get social user by email: %w", err)
 	}
 	u.IsPro = isPro != 0
+	u.IsAdmin = isAdmin != 0
 	return &u, nil
 }
 
@@ -580,6 +653,13 @@ func (s *RelayStore) DeleteOrg(orgID string) error {
 	}
 	tx.Exec("DELETE FROM org_invites WHERE org_id = ?", orgID)
 	tx.Exec("DELETE FROM org_members WHERE org_id = ?", orgID)
+	tx.Exec("DELETE FROM scim_group_members WHERE group_id IN (SELECT id FROM scim_groups WHERE org_id = ?)", orgID)
+	tx.Exec("DELETE FROM scim_groups WHERE org_id = ?", orgID)
+	tx.Exec("DELETE FROM scim_users WHERE org_id = ?", orgID)
+	tx.Exec("DELETE FROM scim_tokens WHERE org_id = ?", orgID)
+	tx.Exec("DELETE FROM api_tokens WHERE org_id = ?", orgID)
+	tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE org_id = ?)", orgID)
+	tx.Exec("DELETE FROM webhooks WHERE org_id = ?", orgID)
 	_, err = tx.Exec("DELETE FROM orgs WHERE id = ?", orgID)
 	if err != nil {
 		tx.Rollback()
@@ -717,7 +797,7 @@ func (s *RelayStore) AddOrgMember(orgID, userID, role string) error {
 		return fmt.Errorf("org has reached max seats (%d)", maxSeats)
 	}
 	_, err = tx.Exec(
-		"INSERT OR IGNORE INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)",
+		"INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
 		orgID, userID, role,
 	)
 	if err != nil {
@@ -727,6 +807,12 @@ func (s *RelayStore) AddOrgMember(orgID, userID, role string) error {
 	return tx.Commit()
 }
 
+// SetOrgMemberRole changes an existing member's role.
+func (s *RelayStore) SetOrgMemberRole(orgID, userID, role string) error {
+	_, err := s.db.Exec("UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?", role, orgID, userID)
+	return err
+}
+
 // RemoveOrgMember removes a user from an org.
 func (s *RelayStore) RemoveOrgMember(orgID, userID string) error {
 	_, err := s.db.Exec("DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID)
@@ -802,7 +888,7 @@ func (s *RelayStore) ConsumeOrgInvite(token string) (string, string, string, err
 		return "", "", "", fmt.Errorf("invalid or already claimed invite")
 	}
 	_, err = tx.Exec(
-		"UPDATE org_invites SET claimed_at = datetime('now') WHERE token = ?",
+		"UPDATE org_invites SET claimed_at = CURRENT_TIMESTAMP WHERE token = ?",
 		token,
 	)
 	if err != nil {
@@ -838,6 +924,12 @@ func (s *RelayStore) RevokeOrgInvite(token string) error {
 	return err
 }
 
+// RevokeOrgInvitesForEmail deletes an email's pending invites to an org.
+func (s *RelayStore) RevokeOrgInvitesForEmail(orgID, email string) error {
+	_, err := s.db.Exec("DELETE FROM org_invites WHERE org_id = ? AND email = ? AND claimed_at IS NULL", orgID, email)
+	return err
+}
+
 // ListPendingInvites returns unclaimed invites for an org.
 func (s *RelayStore) ListPendingInvites(orgID string) ([]*OrgInvite, error) {
 	rows, err := s.db.Query(
@@ -867,7 +959,7 @@ func (s *RelayStore) SetOrgMaxSeats(orgID string, seats int) error {
 
 // UpdateSubscriptionSeats updates the seat count on a subscription.
 func (s *RelayStore) UpdateSubscriptionSeats(subID string, seats int) error {
-	_, err := s.db.Exec("UPDATE subscriptions SET seats = ?, updated_at = datetime('now') WHERE id = ?", seats, subID)
+	_, err := s.db.Exec("UPDATE subscriptions SET seats = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", seats, subID)
 	return err
 }
 
@@ -948,13 +1040,13 @@ func (s *RelayStore) GetActiveOrgSubscription(orgID string) (*Subscription, erro
 }
 
 func (s *RelayStore) UpdateSubscriptionStatus(subID, status string) error {
-	_, err := s.db.Exec("UPDATE subscriptions SET status = ?, updated_at = datetime('now') WHERE id = ?", status, subID)
+	_, err := s.db.Exec("UPDATE subscriptions SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", status, subID)
 	return err
 }
 
 func (s *RelayStore) CreateEntitlement(ent *Entitlement) error {
 	_, err := s.db.Exec(
-		"INSERT OR IGNORE INTO entitlements (id, user_id, subscription_id) VALUES (?, ?, ?)",
+		"INSERT INTO entitlements (id, user_id, subscription_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
 		ent.ID, ent.UserID, ent.SubscriptionID,
 	)
 	return err
@@ -1040,15 +1132,18 @@ func (s *RelayStore) BackfillProUsers() error {
 	return nil
 }
 
+// migrate applies the dialect's migrations that haven't run yet. Both
+// dialects carry the same numbered files, so schema_migrations means the
+// same thing on either database.
 func (s *RelayStore) migrate() error {
 	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
 		version TEXT PRIMARY KEY,
-		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		applied_at ` + s.dialect.timestamp + ` DEFAULT CURRENT_TIMESTAMP
 	)`); err != nil {
 		return fmt.Errorf("create migrations table: %w", err)
 	}
 
-	entries, err := migrationsFS.ReadDir("migrations")
+	entries, err := migrationsFS.ReadDir(s.dialect.migrations)
 	if err != nil {
 		return fmt.Errorf("read migrations dir: %w", err)
 	}
@@ -1071,7 +1166,7 @@ func (s *RelayStore) migrate() error {
 			continue
 		}
 
-		content, err := migrationsFS.ReadFile("migrations/" + f)
+		content, err := migrationsFS.ReadFile(s.dialect.migrations + "/" + f)
 		if err != nil {
 			return fmt.Errorf("read migration %s: %w", f, err)
 		}
@@ -1241,3 +1336,994 @@ func (s *RelayStore) SetNtfyConfig(userID string, cfg NtfyConfig) error {
 	)
 	return err
 }
+
+// --- Audit heads ---
+
+// AuditHead is the latest signed audit chain head a wing reported for a
+// session. The relay stores it as a witness and never sees session content.
+type AuditHead struct {
+	WingID     string
+	SessionID  string
+	UserID     string
+	Seq        int
+	Head       string
+	SignedAt   int64
+	Sig        string
+	SignerKey  string
+	Sealed     bool
+	ReceivedAt time.Time
+}
+
+// SaveAuditHead records a chain head. Only heads that advance the chain are
+// kept: a lower seq, a different signer key, or anything after the seal is
+// ignored, so a wing cannot rewind what the relay witnessed.
+func (s *RelayStore) SaveAuditHead(h AuditHead) error {
+	_, err := s.db.Exec(
+		`INSERT INTO audit_heads (wing_id, session_id, user_id, seq, head, signed_at, sig, signer_key, sealed)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(wing_id, session_id) DO UPDATE SET
+		   seq = excluded.seq, head = excluded.head, signed_at = excluded.signed_at,
+		   sig = excluded.sig, sealed = excluded.sealed, received_at = CURRENT_TIMESTAMP
+		 WHERE audit_heads.sealed = 0
+		   AND audit_heads.signer_key = excluded.signer_key
+		   AND audit_heads.user_id = excluded.user_id
+		   AND (excluded.seq > audit_heads.seq OR (excluded.seq = audit_heads.seq AND excluded.sealed = 1))`,
+		h.WingID, h.SessionID, h.UserID, h.Seq, h.Head, h.SignedAt, h.Sig, h.SignerKey, h.Sealed,
+	)
+	if err != nil {
+		return fmt.Errorf("save audit head: %w", err)
+	}
+	return nil
+}
+
+// GetAuditHead returns the recorded chain head for a wing session, or nil.
+func (s *RelayStore) GetAuditHead(wingID, sessionID string) (*AuditHead, error) {
+	h := &AuditHead{WingID: wingID, SessionID: sessionID}
+	err := s.db.QueryRow(
+		`SELECT user_id, seq, head, signed_at, sig, signer_key, sealed, received_at
+		 FROM audit_heads WHERE wing_id = ? AND session_id = ?`, wingID, sessionID,
+	).Scan(&h.UserID, &h.Seq, &h.Head, &h.SignedAt, &h.Sig, &h.SignerKey, &h.Sealed, &h.ReceivedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get audit head: %w", err)
+	}
+	return h, nil
+}
+
+// --- SCIM provisioning ---
+
+// SCIMUser is an org member provisioned by the org's identity provider.
+type SCIMUser struct {
+	OrgID      string
+	UserID     string
+	UserName   string
+	ExternalID string
+	Role       string // role from the IdP's roles attribute: "member" or "admin"
+	Active     bool
+	Pending    bool // an existing account invited to the org; not a member until it accepts
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SCIMGroup is an IdP group pushed to an org. Members are user IDs.
+type SCIMGroup struct {
+	ID          string
+	OrgID       string
+	DisplayName string
+	ExternalID  string
+	Members     []string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SetSCIMToken stores the hash of an org's SCIM bearer token, replacing any previous one.
+func (s *RelayStore) SetSCIMToken(orgID, tokenHash, createdBy string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO scim_tokens (org_id, token_hash, created_by) VALUES (?, ?, ?)
+		 ON CONFLICT(org_id) DO UPDATE SET
+		   token_hash = excluded.token_hash, created_by = excluded.created_by,
+		   created_at = CURRENT_TIMESTAMP, last_used_at = NULL`,
+		orgID, tokenHash, createdBy,
+	)
+	if err != nil {
+		return fmt.Errorf("set scim token: %w", err)
+	}
+	return nil
+}
+
+// DeleteSCIMToken revokes an org's SCIM bearer token.
+func (s *RelayStore) DeleteSCIMToken(orgID string) error {
+	_, err := s.db.Exec("DELETE FROM scim_tokens WHERE org_id = ?", orgID)
+	return err
+}
+
+// GetOrgBySCIMToken returns the org a SCIM token hash belongs to, or nil.
+func (s *RelayStore) GetOrgBySCIMToken(tokenHash string) (*Org, error) {
+	var orgID string
+	err := s.db.QueryRow("SELECT org_id FROM scim_tokens WHERE token_hash = ?", tokenHash).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get org by scim token: %w", err)
+	}
+	s.db.Exec("UPDATE scim_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE org_id = ?", orgID)
+	return s.GetOrgByID(orgID)
+}
+
+// UpsertSCIMUser creates or updates a provisioned user's record for an org.
+func (s *RelayStore) UpsertSCIMUser(u *SCIMUser) error {
+	_, err := s.db.Exec(
+		`INSERT INTO scim_users (org_id, user_id, user_name, external_id, role, active, pending)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(org_id, user_id) DO UPDATE SET
+		   user_name = excluded.user_name, external_id = excluded.external_id,
+		   role = excluded.role, active = excluded.active, pending = excluded.pending,
+		   updated_at = CURRENT_TIMESTAMP`,
+		u.OrgID, u.UserID, u.UserName, u.ExternalID, u.Role, boolToInt(u.Active), boolToInt(u.Pending),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert scim user: %w", err)
+	}
+	return nil
+}
+
+// GetSCIMUser returns a provisioned user by org and user ID, or nil.
+func (s *RelayStore) GetSCIMUser(orgID, userID string) (*SCIMUser, error) {
+	u := &SCIMUser{}
+	err := s.db.QueryRow(
+		`SELECT org_id, user_id, user_name, external_id, role, active, pending, created_at, updated_at
+		 FROM scim_users WHERE org_id = ? AND user_id = ?`, orgID, userID,
+	).Scan(&u.OrgID, &u.UserID, &u.UserName, &u.ExternalID, &u.Role, &u.Active, &u.Pending, &u.CreatedAt, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get scim user: %w", err)
+	}
+	return u, nil
+}
+
+// ListSCIMUsers returns every user provisioned into an org.
+func (s *RelayStore) ListSCIMUsers(orgID string) ([]*SCIMUser, error) {
+	rows, err := s.db.Query(
+		`SELECT org_id, user_id, user_name, external_id, role, active, pending, created_at, updated_at
+		 FROM scim_users WHERE org_id = ? ORDER BY created_at, user_name`, orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list scim users: %w", err)
+	}
+	defer rows.Close()
+	var result []*SCIMUser
+	for rows.Next() {
+		var u SCIMUser
+		if err := rows.Scan(&u.OrgID, &u.UserID, &u.UserName, &u.ExternalID, &u.Role, &u.Active, &u.Pending, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &u)
+	}
+	return result, nil
+}
+
+// DeleteSCIMUser forgets a provisioned user and their group memberships in the org.
+func (s *RelayStore) DeleteSCIMUser(orgID, userID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	tx.Exec("DELETE FROM scim_group_members WHERE user_id = ? AND group_id IN (SELECT id FROM scim_groups WHERE org_id = ?)", userID, orgID)
+	if _, err := tx.Exec("DELETE FROM scim_users WHERE org_id = ? AND user_id = ?", orgID, userID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete scim user: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SaveSCIMGroup creates or replaces a group, including its member list.
+func (s *RelayStore) SaveSCIMGroup(g *SCIMGroup) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	_, err = tx.Exec(
+		`INSERT INTO scim_groups (id, org_id, display_name, external_id) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(id) DO UPDATE SET
+		   display_name = excluded.display_name, external_id = excluded.external_id, updated_at = CURRENT_TIMESTAMP`,
+		g.ID, g.OrgID, g.DisplayName, g.ExternalID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("save scim group: %w", err)
+	}
+	tx.Exec("DELETE FROM scim_group_members WHERE group_id = ?", g.ID)
+	for _, uid := range g.Members {
+		if _, err := tx.Exec("INSERT INTO scim_group_members (group_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING", g.ID, uid); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("save scim group member: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSCIMGroup returns an org's group with its members, or nil.
+func (s *RelayStore) GetSCIMGroup(orgID, id string) (*SCIMGroup, error) {
+	g := &SCIMGroup{}
+	err := s.db.QueryRow(
+		"SELECT id, org_id, display_name, external_id, created_at, updated_at FROM scim_groups WHERE org_id = ? AND id = ?",
+		orgID, id,
+	).Scan(&g.ID, &g.OrgID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get scim group: %w", err)
+	}
+	if g.Members, err = s.scimGroupMembers(g.ID); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ListSCIMGroups returns an org's groups with their members.
+func (s *RelayStore) ListSCIMGroups(orgID string) ([]*SCIMGroup, error) {
+	rows, err := s.db.Query(
+		"SELECT id, org_id, display_name, external_id, created_at, updated_at FROM scim_groups WHERE org_id = ? ORDER BY display_name",
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list scim groups: %w", err)
+	}
+	var result []*SCIMGroup
+	for rows.Next() {
+		var g SCIMGroup
+		if err := rows.Scan(&g.ID, &g.OrgID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result = append(result, &g)
+	}
+	rows.Close()
+	for _, g := range result {
+		if g.Members, err = s.scimGroupMembers(g.ID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *RelayStore) scimGroupMembers(groupID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT user_id FROM scim_group_members WHERE group_id = ? ORDER BY user_id", groupID)
+	if err != nil {
+		return nil, fmt.Errorf("list scim group members: %w", err)
+	}
+	defer rows.Close()
+	var members []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		members = append(members, uid)
+	}
+	return members, nil
+}
+
+// DeleteSCIMGroup removes a group and its memberships.
+func (s *RelayStore) DeleteSCIMGroup(orgID, id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	tx.Exec("DELETE FROM scim_group_members WHERE group_id IN (SELECT id FROM scim_groups WHERE org_id = ? AND id = ?)", orgID, id)
+	if _, err := tx.Exec("DELETE FROM scim_groups WHERE org_id = ? AND id = ?", orgID, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete scim group: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListSCIMGroupsForUser returns the display names of the user's groups in an org.
+func (s *RelayStore) ListSCIMGroupsForUser(orgID, userID string) ([]string, error) {
+	rows, err := s.db.Query(
+		`SELECT g.display_name FROM scim_groups g JOIN scim_group_members m ON m.group_id = g.id
+		 WHERE g.org_id = ? AND m.user_id = ? ORDER BY g.display_name`, orgID, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list scim groups for user: %w", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+	}
+	return names, nil
+}
+
+// ClaimSCIMUser hands a provisioned placeholder account with this email to
+// the identity that first signs in with it. Returns nil if there is none.
+// Its SCIM records stay pending: it joins each org by accepting the invite.
+func (s *RelayStore) ClaimSCIMUser(email, provider, providerID string) (*User, error) {
+	res, err := s.db.Exec(
+		"UPDATE users SET provider = ?, provider_id = ? WHERE email = ? AND provider = ?",
+		provider, providerID, email, scimUserProvider,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("claim scim user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return s.GetUserByProvider(provider, providerID)
+}
+
+// LinkUserProvider moves an account onto another sign-in provider, as when
+// an IdP takes over an account it has verified the email of.
+func (s *RelayStore) LinkUserProvider(userID, provider, providerID string) error {
+	_, err := s.db.Exec("UPDATE users SET provider = ?, provider_id = ? WHERE id = ?", provider, providerID, userID)
+	if err != nil {
+		return fmt.Errorf("link user provider: %w", err)
+	}
+	return nil
+}
+
+// AdoptSCIMUser moves the SCIM records of an unclaimed placeholder holding
+// this email onto an existing account that has shown it owns the email, and
+// deletes the placeholder. The records stay pending unless the account is
+// already a member, so it joins each org by accepting the invite, as a
+// claimed placeholder would. Placeholders never adopt each other.
+func (s *RelayStore) AdoptSCIMUser(userID, email string) error {
+	var placeholder, provider string
+	err := s.db.QueryRow("SELECT id FROM users WHERE email = ? AND provider = ? AND id != ?", email, scimUserProvider, userID).Scan(&placeholder)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("adopt scim user: %w", err)
+	}
+	if err := s.db.QueryRow("SELECT provider FROM users WHERE id = ?", userID).Scan(&provider); err != nil || provider == scimUserProvider {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	stmts := []struct {
+		query string
+		args  []any
+	}{
+		{"DELETE FROM scim_group_members WHERE user_id = ? AND group_id IN (SELECT group_id FROM scim_group_members WHERE user_id = ?)", []any{placeholder, userID}},
+		{"UPDATE scim_group_members SET user_id = ? WHERE user_id = ?", []any{userID, placeholder}},
+		{"DELETE FROM scim_users WHERE user_id = ? AND org_id IN (SELECT org_id FROM scim_users WHERE user_id = ?)", []any{placeholder, userID}},
+		{`UPDATE scim_users SET user_id = ?, pending = CASE WHEN EXISTS
+		   (SELECT 1 FROM org_members m WHERE m.org_id = scim_users.org_id AND m.user_id = ?) THEN 0 ELSE 1 END
+		  WHERE user_id = ?`, []any{userID, userID, placeholder}},
+		{"DELETE FROM org_members WHERE user_id = ?", []any{placeholder}},
+		{"DELETE FROM entitlements WHERE user_id = ?", []any{placeholder}},
+		{"DELETE FROM users WHERE id = ?", []any{placeholder}},
+	}
+	for _, st := range stmts {
+		if _, err := tx.Exec(st.query, st.args...); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("adopt scim user: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// --- API tokens ---
+
+// APIToken is a scoped personal access token. Only its hash is stored.
+type APIToken struct {
+	ID         string
+	UserID     string
+	OrgID      *string // org-scoped: only the org's wings and the org itself
+	Name       string
+	Scopes     []string // e.g. "wings:read", "sessions:write"
+	WingIDs    []string // if set, only these wings
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// CreateAPIToken stores a new token under the hash of its secret.
+func (s *RelayStore) CreateAPIToken(t *APIToken, tokenHash string) error {
+	var expires *string
+	if t.ExpiresAt != nil {
+		expires = strPtr(t.ExpiresAt.UTC().Format("2006-01-02 15:04:05"))
+	}
+	_, err := s.db.Exec(
+		"INSERT INTO api_tokens (id, user_id, org_id, name, token_hash, scopes, wing_ids, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		t.ID, t.UserID, t.OrgID, t.Name, tokenHash, strings.Join(t.Scopes, ","), strings.Join(t.WingIDs, ","), expires,
+	)
+	if err != nil {
+		return fmt.Errorf("create api token: %w", err)
+	}
+	return nil
+}
+
+const apiTokenColumns = "id, user_id, org_id, name, scopes, wing_ids, expires_at, last_used_at, created_at"
+
+func scanAPIToken(row interface{ Scan(...any) error }) (*APIToken, error) {
+	var t APIToken
+	var scopes, wings string
+	if err := row.Scan(&t.ID, &t.UserID, &t.OrgID, &t.Name, &scopes, &wings, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes, t.WingIDs = splitList(scopes), splitList(wings)
+	return &t, nil
+}
+
+// ListAPITokens returns a user's tokens, including expired ones.
+func (s *RelayStore) ListAPITokens(userID string) ([]*APIToken, error) {
+	rows, err := s.db.Query("SELECT "+apiTokenColumns+" FROM api_tokens WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer rows.Close()
+	var result []*APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// GetAPITokenByHash returns the unexpired token with this hash, or nil,
+// and records the use.
+func (s *RelayStore) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	t, err := scanAPIToken(s.db.QueryRow(
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?)",
+		tokenHash, now,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api token: %w", err)
+	}
+	s.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now, t.ID)
+	return t, nil
+}
+
+// DeleteAPIToken revokes a token, scoped to its owner.
+func (s *RelayStore) DeleteAPIToken(id, userID string) error {
+	res, err := s.db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("api token not found")
+	}
+	return nil
+}
+
+// --- Webhooks ---
+
+// Webhook is an outbound event subscription, personal (OrgID nil) or for an org.
+type Webhook struct {
+	ID        string
+	UserID    string  // owner of a personal hook, creator of an org hook
+	OrgID     *string // org hook: events for the org's wings
+	URL       string
+	Secret    string   // HMAC key for X-Wingthing-Signature
+	Events    []string // empty means all events
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is one event sent (or being retried) to a webhook.
+type WebhookDelivery struct {
+	ID            string
+	WebhookID     string
+	Event         string
+	Payload       string
+	Status        string // "pending", "delivered", "failed"
+	Attempts      int
+	ResponseCode  *int
+	Error         *string
+	NextAttemptAt *time.Time
+	CreatedAt     time.Time
+}
+
+const webhookColumns = "id, user_id, org_id, url, secret, events, created_at"
+
+func scanWebhook(row interface{ Scan(...any) error }) (*Webhook, error) {
+	var h Webhook
+	var events string
+	if err := row.Scan(&h.ID, &h.UserID, &h.OrgID, &h.URL, &h.Secret, &events, &h.CreatedAt); err != nil {
+		return nil, err
+	}
+	h.Events = splitList(events)
+	return &h, nil
+}
+
+func (s *RelayStore) queryWebhooks(query string, args ...any) ([]*Webhook, error) {
+	rows, err := s.db.Query("SELECT "+webhookColumns+" FROM webhooks "+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer rows.Close()
+	var result []*Webhook
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, h)
+	}
+	return result, nil
+}
+
+func (s *RelayStore) CreateWebhook(h *Webhook) error {
+	_, err := s.db.Exec(
+		"INSERT INTO webhooks (id, user_id, org_id, url, secret, events) VALUES (?, ?, ?, ?, ?, ?)",
+		h.ID, h.UserID, h.OrgID, h.URL, h.Secret, strings.Join(h.Events, ","),
+	)
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *RelayStore) GetWebhook(id string) (*Webhook, error) {
+	h, err := scanWebhook(s.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get webhook: %w", err)
+	}
+	return h, nil
+}
+
+// ListUserWebhooks returns a user's personal webhooks.
+func (s *RelayStore) ListUserWebhooks(userID string) ([]*Webhook, error) {
+	return s.queryWebhooks("WHERE user_id = ? AND org_id IS NULL ORDER BY created_at", userID)
+}
+
+// ListOrgWebhooks returns an org's webhooks.
+func (s *RelayStore) ListOrgWebhooks(orgID string) ([]*Webhook, error) {
+	return s.queryWebhooks("WHERE org_id = ? ORDER BY created_at", orgID)
+}
+
+// WebhooksFor returns the personal webhooks of userID and the webhooks of
+// orgID that subscribe to event.
+func (s *RelayStore) WebhooksFor(userID, orgID, event string) ([]*Webhook, error) {
+	hooks, err := s.queryWebhooks("WHERE (user_id = ? AND org_id IS NULL) OR (org_id = ? AND org_id != '')", userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	var result []*Webhook
+	for _, h := range hooks {
+		if len(h.Events) == 0 || slices.Contains(h.Events, event) {
+			result = append(result, h)
+		}
+	}
+	return result, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (s *RelayStore) DeleteWebhook(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id)
+	if _, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	return tx.Commit()
+}
+
+// CreateWebhookDelivery queues a delivery, first attempted at due.
+func (s *RelayStore) CreateWebhookDelivery(d *WebhookDelivery, due time.Time) error {
+	_, err := s.db.Exec(
+		"INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, next_attempt_at) VALUES (?, ?, ?, ?, 'pending', ?)",
+		d.ID, d.WebhookID, d.Event, d.Payload, due.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return fmt.Errorf("create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+const webhookDeliveryColumns = "id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt_at, created_at"
+
+func (s *RelayStore) queryWebhookDeliveries(query string, args ...any) ([]*WebhookDelivery, error) {
+	rows, err := s.db.Query("SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries "+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+	var result []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &d)
+	}
+	return result, nil
+}
+
+// DueWebhookDeliveries returns pending deliveries whose next attempt is due.
+func (s *RelayStore) DueWebhookDeliveries(limit int) ([]*WebhookDelivery, error) {
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	return s.queryWebhookDeliveries("WHERE status = 'pending' AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?", now, limit)
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries, newest first.
+func (s *RelayStore) ListWebhookDeliveries(webhookID string, limit int) ([]*WebhookDelivery, error) {
+	return s.queryWebhookDeliveries("WHERE webhook_id = ? ORDER BY created_at DESC, id DESC LIMIT ?", webhookID, limit)
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt. A nil next
+// leaves the delivery in its final status.
+func (s *RelayStore) RecordWebhookAttempt(id, status string, code int, errMsg string, next *time.Time) error {
+	var codeVal *int
+	if code != 0 {
+		codeVal = &code
+	}
+	var errVal, nextVal *string
+	if errMsg != "" {
+		errVal = &errMsg
+	}
+	if next != nil {
+		nextVal = strPtr(next.UTC().Format("2006-01-02 15:04:05"))
+	}
+	_, err := s.db.Exec(
+		"UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, response_code = ?, error = ?, next_attempt_at = ? WHERE id = ?",
+		status, codeVal, errVal, nextVal, id,
+	)
+	if err != nil {
+		return fmt.Errorf("record webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// PruneWebhookDeliveries drops finished deliveries older than cutoff.
+func (s *RelayStore) PruneWebhookDeliveries(cutoff time.Time) error {
+	_, err := s.db.Exec("DELETE FROM webhook_deliveries WHERE status != 'pending' AND created_at < ?", cutoff.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("prune webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// --- Leases ---
+
+// AcquireLease takes or renews the named lease for holder until now+ttl. It
+// succeeds when the lease is free, expired, or already held by holder, and
+// reports whether holder owns the lease afterwards. Expiry is computed and
+// checked against the database's clock, so replicas with skewed clocks agree
+// on when a lease runs out.
+func (s *RelayStore) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	_, err := s.db.Exec(
+		`INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, `+s.dialect.nowPlus+`)
+		 ON CONFLICT(name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		 WHERE leases.holder = excluded.holder OR leases.expires_at < `+s.dialect.now,
+		name, holder, ttl.Seconds(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("acquire lease: %w", err)
+	}
+	current, err := s.LeaseHolder(name)
+	if err != nil {
+		return false, err
+	}
+	return current == holder, nil
+}
+
+// LeaseHolder returns who holds the named lease, or "" if nobody does.
+func (s *RelayStore) LeaseHolder(name string) (string, error) {
+	var holder string
+	err := s.db.QueryRow(
+		"SELECT holder FROM leases WHERE name = ? AND expires_at >= "+s.dialect.now,
+		name,
+	).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("lease holder: %w", err)
+	}
+	return holder, nil
+}
+
+// ReleaseLease gives up the named lease if holder still has it.
+func (s *RelayStore) ReleaseLease(name, holder string) error {
+	_, err := s.db.Exec("DELETE FROM leases WHERE name = ? AND holder = ?", name, holder)
+	if err != nil {
+		return fmt.Errorf("release lease: %w", err)
+	}
+	return nil
+}
+
+// --- SAML login state ---
+//
+// AuthnRequests and ACS tickets live in the database rather than the login
+// node's memory, so any login replica can finish a login another started.
+
+// SaveSAMLRequest records an AuthnRequest a login is waiting on and drops
+// expired ones.
+func (s *RelayStore) SaveSAMLRequest(provider, id string, expires time.Time) error {
+	s.db.Exec("DELETE FROM saml_requests WHERE expires_at < ?", time.Now().UTC().Format("2006-01-02 15:04:05"))
+	_, err := s.db.Exec(
+		"INSERT INTO saml_requests (id, provider, expires_at) VALUES (?, ?, ?)",
+		id, provider, expires.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return fmt.Errorf("save saml request: %w", err)
+	}
+	return nil
+}
+
+// TakeSAMLRequest consumes a pending AuthnRequest, reporting whether it was
+// there and unexpired at now. Each request can be taken once.
+func (s *RelayStore) TakeSAMLRequest(provider, id string, now time.Time) (bool, error) {
+	res, err := s.db.Exec(
+		"DELETE FROM saml_requests WHERE id = ? AND provider = ? AND expires_at >= ?",
+		id, provider, now.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return false, fmt.Errorf("take saml request: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// SaveSAMLTicket parks a verified identity (JSON) under the hash of a
+// one-time ticket, for the callback to redeem. Drops expired tickets.
+func (s *RelayStore) SaveSAMLTicket(provider, ticketHash, requestID, identity string, expires time.Time) error {
+	s.db.Exec("DELETE FROM saml_tickets WHERE expires_at < ?", time.Now().UTC().Format("2006-01-02 15:04:05"))
+	_, err := s.db.Exec(
+		"INSERT INTO saml_tickets (ticket_hash, provider, request_id, identity, expires_at) VALUES (?, ?, ?, ?, ?)",
+		ticketHash, provider, requestID, identity, expires.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return fmt.Errorf("save saml ticket: %w", err)
+	}
+	return nil
+}
+
+// TakeSAMLTicket redeems a ticket unexpired at now, returning the request
+// it answers and the identity. Returns "" if there is none; each ticket can
+// be redeemed once.
+func (s *RelayStore) TakeSAMLTicket(provider, ticketHash string, now time.Time) (requestID, identity string, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("begin tx: %w", err)
+	}
+	err = tx.QueryRow(
+		"SELECT request_id, identity FROM saml_tickets WHERE ticket_hash = ? AND provider = ? AND expires_at >= ?",
+		ticketHash, provider, now.UTC().Format("2006-01-02 15:04:05"),
+	).Scan(&requestID, &identity)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("take saml ticket: %w", err)
+	}
+	res, err := tx.Exec("DELETE FROM saml_tickets WHERE ticket_hash = ?", ticketHash)
+	if err != nil {
+		tx.Rollback()
+		return "", "", fmt.Errorf("take saml ticket: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		tx.Rollback()
+		return "", "", nil // another replica redeemed it first
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("commit: %w", err)
+	}
+	return requestID, identity, nil
+}
+
+// --- Admin ---
+
+// ListUsers returns users whose ID, name or email contains query (all users
+// when it is empty), oldest first.
+func (s *RelayStore) ListUsers(query string, limit, offset int) ([]*User, error) {
+	like := "%" + query + "%"
+	rows, err := s.db.Query(
+		`SELECT id, provider, provider_id, display_name, avatar_url, email, tier, is_pro, created_at, is_admin, suspended_at
+		 FROM users WHERE lower(id) LIKE lower(?) OR lower(display_name) LIKE lower(?) OR lower(COALESCE(email, '')) LIKE lower(?)
+		 ORDER BY created_at, id LIMIT ? OFFSET ?`,
+		like, like, like, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+	var result []*User
+	for rows.Next() {
+		var u User
+		var isPro, isAdmin int
+		if err := rows.Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &u.AvatarURL, &u.Email, &u.Tier, &isPro, &u.CreatedAt, &isAdmin, &u.SuspendedAt); err != nil {
+			return nil, err
+		}
+		u.IsPro, u.IsAdmin = isPro != 0, isAdmin != 0
+		result = append(result, &u)
+	}
+	return result, rows.Err()
+}
+
+// SetUserAdmin grants or revokes the relay admin role.
+func (s *RelayStore) SetUserAdmin(userID string, admin bool) error {
+	_, err := s.db.Exec("UPDATE users SET is_admin = ? WHERE id = ?", boolToInt(admin), userID)
+	if err != nil {
+		return fmt.Errorf("set user admin: %w", err)
+	}
+	return nil
+}
+
+// CountAdmins returns how many users hold the admin role.
+func (s *RelayStore) CountAdmins() (int, error) {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE is_admin = 1").Scan(&n); err != nil {
+		return 0, fmt.Errorf("count admins: %w", err)
+	}
+	return n, nil
+}
+
+// PromoteAdminsByEmail grants the admin role to the users with these emails.
+func (s *RelayStore) PromoteAdminsByEmail(emails []string) error {
+	for _, e := range emails {
+		if _, err := s.db.Exec("UPDATE users SET is_admin = 1 WHERE LOWER(email) = LOWER(?)", e); err != nil {
+			return fmt.Errorf("promote admin %s: %w", e, err)
+		}
+	}
+	return nil
+}
+
+// SetUserSuspended suspends or reinstates a user. Suspended users' sessions,
+// device tokens and API tokens stop validating; nothing is deleted, so
+// reinstating restores them.
+func (s *RelayStore) SetUserSuspended(userID string, suspended bool) error {
+	var at any
+	if suspended {
+		at = time.Now().UTC().Format("2006-01-02 15:04:05")
+	}
+	_, err := s.db.Exec("UPDATE users SET suspended_at = ? WHERE id = ?", at, userID)
+	if err != nil {
+		return fmt.Errorf("set user suspended: %w", err)
+	}
+	return nil
+}
+
+// IsUserSuspended reports whether an admin has suspended the user.
+func (s *RelayStore) IsUserSuspended(userID string) bool {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ? AND suspended_at IS NOT NULL", userID).Scan(&n)
+	return err == nil && n > 0
+}
+
+// ListAllOrgs returns every org on the relay.
+func (s *RelayStore) ListAllOrgs() ([]*Org, error) {
+	rows, err := s.db.Query("SELECT id, name, slug, owner_user_id, max_seats, created_at FROM orgs ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("list all orgs: %w", err)
+	}
+	defer rows.Close()
+	var result []*Org
+	for rows.Next() {
+		var o Org
+		if err := rows.Scan(&o.ID, &o.Name, &o.Slug, &o.OwnerUserID, &o.MaxSeats, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &o)
+	}
+	return result, rows.Err()
+}
+
+// ListBandwidthUsage returns the persisted bandwidth totals for a month
+// ("2006-01"), by user.
+func (s *RelayStore) ListBandwidthUsage(month string) (map[string]int64, error) {
+	rows, err := s.db.Query("SELECT user_id, bytes_total FROM bandwidth_log WHERE month = ?", month)
+	if err != nil {
+		return nil, fmt.Errorf("list bandwidth usage: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[string]int64)
+	for rows.Next() {
+		var userID string
+		var total int64
+		if err := rows.Scan(&userID, &total); err != nil {
+			return nil, err
+		}
+		out[userID] = total
+	}
+	return out, rows.Err()
+}
+
+// AuditEntry is one audit_log row.
+type AuditEntry struct {
+	ID        int64
+	Timestamp time.Time
+	UserID    *string
+	OrgID     *string
+	Event     string
+	Detail    *string
+}
+
+// AuditFilter selects audit_log rows. Zero fields don't filter. Results come
+// newest first; pass the last ID seen as Before to page back.
+type AuditFilter struct {
+	UserID string
+	OrgID  string
+	Events []string
+	Since  time.Time
+	Until  time.Time
+	Before int64
+	Limit  int
+}
+
+// ListAudit returns audit entries matching f.
+func (s *RelayStore) ListAudit(f AuditFilter) ([]*AuditEntry, error) {
+	q := "SELECT id, timestamp, user_id, org_id, event, detail FROM audit_log WHERE 1 = 1"
+	var args []any
+	if f.UserID != "" {
+		q += " AND user_id = ?"
+		args = append(args, f.UserID)
+	}
+	if f.OrgID != "" {
+		q += " AND org_id = ?"
+		args = append(args, f.OrgID)
+	}
+	if len(f.Events) > 0 {
+		q += " AND event IN (?" + strings.Repeat(", ?", len(f.Events)-1) + ")"
+		for _, e := range f.Events {
+			args = append(args, e)
+		}
+	}
+	if !f.Since.IsZero() {
+		q += " AND timestamp >= ?"
+		args = append(args, f.Since.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !f.Until.IsZero() {
+		q += " AND timestamp < ?"
+		args = append(args, f.Until.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if f.Before > 0 {
+		q += " AND id < ?"
+		args = append(args, f.Before)
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	q += " ORDER BY id DESC LIMIT ?"
+	args = append(args, f.Limit)
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list audit: %w", err)
+	}
+	defer rows.Close()
+	var result []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.UserID, &e.OrgID, &e.Event, &e.Detail); err != nil {
+			return nil, err
+		}
+		result = append(result, &e)
+	}
+	return result, rows.Err()
+}
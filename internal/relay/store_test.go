@@ -0,0 +1,606 @@
+package relay
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// These tests call the store methods the handler tests only reach
+// indirectly, so a run with WT_TEST_POSTGRES_DSN set exercises every query
+// on PostgreSQL too (see TestRelayStoreMethodsTested).
+
+func TestRelayStoreSessionsAndMagicLinks(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("u1")
+
+	if err := s.CreateSession("sess-1", "u1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if err := s.DeleteSession("sess-1"); err != nil {
+		t.Fatalf("delete session: %v", err)
+	}
+	if u, err := s.GetSession("sess-1"); err != nil || u != nil {
+		t.Errorf("deleted session = %+v, %v", u, err)
+	}
+
+	if err := s.CreateMagicLink("ml-1", "ada@example.com", "mtok", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("create magic link: %v", err)
+	}
+	if email, err := s.ConsumeMagicLink("mtok"); err != nil || email != "ada@example.com" {
+		t.Errorf("consume = %q, %v", email, err)
+	}
+	if _, err := s.ConsumeMagicLink("mtok"); err == nil {
+		t.Error("magic link consumed twice")
+	}
+	s.CreateMagicLink("ml-2", "ada@example.com", "old", time.Now().Add(-time.Minute))
+	if _, err := s.ConsumeMagicLink("old"); err == nil {
+		t.Error("expired magic link consumed")
+	}
+}
+
+func TestRelayStoreRevokeAndLinkUser(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("u1")
+	s.CreateUser("u2")
+	s.CreateSession("sess-1", "u1", time.Now().Add(time.Hour))
+	s.CreateSession("sess-2", "u2", time.Now().Add(time.Hour))
+	s.CreateDeviceToken("dev-1", "u1", "laptop", nil)
+
+	if n, err := s.RevokeUserSessions("u1"); err != nil || n != 2 {
+		t.Errorf("revoke = %d, %v; want 2", n, err)
+	}
+	if u, _ := s.GetSession("sess-1"); u != nil {
+		t.Error("session survived")
+	}
+	if _, _, err := s.ValidateToken("dev-1"); err == nil {
+		t.Error("device token survived")
+	}
+	if u, _ := s.GetSession("sess-2"); u == nil {
+		t.Error("another user's session revoked")
+	}
+
+	if err := s.LinkUserProvider("u1", "sso:okta", "sub-1"); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := s.GetUserByProvider("sso:okta", "sub-1"); err != nil || u == nil || u.ID != "u1" {
+		t.Errorf("linked user = %+v, %v", u, err)
+	}
+}
+
+func TestRelayStoreLocalAndServiceUsers(t *testing.T) {
+	s := testStore(t)
+
+	u, tok, err := s.CreateLocalUser()
+	if err != nil || u.ID != "local" || tok == "" {
+		t.Fatalf("local user = %+v, %q, %v", u, tok, err)
+	}
+	if _, again, _ := s.CreateLocalUser(); again != tok {
+		t.Errorf("local token changed: %q -> %q", tok, again)
+	}
+	if uid, did, err := s.ValidateToken(tok); err != nil || uid != "local" || did != "local" {
+		t.Errorf("local token = %q/%q, %v", uid, did, err)
+	}
+
+	svc, svcTok, err := s.CreateServiceUser()
+	if err != nil || svc.Provider != "service" || svcTok == "" {
+		t.Fatalf("service user = %+v, %q, %v", svc, svcTok, err)
+	}
+	if _, again, _ := s.CreateServiceUser(); again != svcTok {
+		t.Errorf("service token changed: %q -> %q", svcTok, again)
+	}
+
+	if err := s.CreateDeviceCodeWithKey("dc-1", "WXYZ98", "dev1", "pubkey", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("create device code: %v", err)
+	}
+	dc, err := s.GetDeviceCodeByUserCode("WXYZ98")
+	if err != nil || dc == nil || dc.Code != "dc-1" || dc.PublicKey == nil || *dc.PublicKey != "pubkey" {
+		t.Fatalf("device code = %+v, %v", dc, err)
+	}
+	s.CreateDeviceCodeWithKey("dc-2", "OLD000", "dev2", "pubkey", time.Now().Add(-time.Minute))
+	if dc, _ := s.GetDeviceCodeByUserCode("OLD000"); dc != nil {
+		t.Errorf("expired device code = %+v", dc)
+	}
+}
+
+func TestRelayStoreRelayConfig(t *testing.T) {
+	s := testStore(t)
+
+	if v, err := s.GetRelayConfig("jwt_key"); err != nil || v != "" {
+		t.Errorf("unset = %q, %v", v, err)
+	}
+	if v, err := s.InitRelayConfig("jwt_key", "a"); err != nil || v != "a" {
+		t.Errorf("init = %q, %v", v, err)
+	}
+	// The first value wins
+	if v, _ := s.InitRelayConfig("jwt_key", "b"); v != "a" {
+		t.Errorf("second init = %q, want a", v)
+	}
+	if err := s.SetRelayConfig("jwt_key", "c"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if v, _ := s.GetRelayConfig("jwt_key"); v != "c" {
+		t.Errorf("after set = %q, want c", v)
+	}
+}
+
+func TestRelayStoreUserAdmin(t *testing.T) {
+	s := testStore(t)
+	if err := s.UpsertUser(&User{ID: "u1", Provider: "github", ProviderID: "1", DisplayName: "Ada Lovelace"}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	s.UpdateUserEmail("u1", "Ada@Example.com")
+	s.UpsertUser(&User{ID: "u2", Provider: "github", ProviderID: "2", DisplayName: "Grace"})
+	s.UpdateUserEmail("u2", "grace@example.com")
+
+	// Search ignores case the same way on every database
+	for _, q := range []string{"ada", "LOVELACE", "ada@example", "U1"} {
+		if users, err := s.ListUsers(q, 10, 0); err != nil || len(users) != 1 || users[0].ID != "u1" {
+			t.Errorf("ListUsers(%q) = %v, %v", q, users, err)
+		}
+	}
+	if users, _ := s.ListUsers("", 10, 0); len(users) != 2 {
+		t.Errorf("all users = %d, want 2", len(users))
+	}
+	if users, _ := s.ListUsers("", 1, 1); len(users) != 1 || users[0].ID != "u2" {
+		t.Errorf("second page = %v", users)
+	}
+
+	if err := s.PromoteAdminsByEmail([]string{"ada@example.com"}); err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if n, err := s.CountAdmins(); err != nil || n != 1 {
+		t.Errorf("admins = %d, %v", n, err)
+	}
+
+	if err := s.UpdateUserTier("u2", "pro"); err != nil {
+		t.Fatalf("update tier: %v", err)
+	}
+	if u, _ := s.GetUserByID("u2"); u.Tier != "pro" {
+		t.Errorf("tier = %q", u.Tier)
+	}
+
+	if err := s.SetUserSuspended("u2", true); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+	if u, _ := s.GetUserByID("u2"); !s.IsUserSuspended("u2") || u.SuspendedAt == nil {
+		t.Errorf("not suspended: %+v", u)
+	}
+	s.SetUserSuspended("u2", false)
+	if s.IsUserSuspended("u2") {
+		t.Error("still suspended after reinstating")
+	}
+
+	cfg := NtfyConfig{Topic: "wt-ada", Token: "tk", Events: "exit"}
+	if err := s.SetNtfyConfig("u1", cfg); err != nil {
+		t.Fatalf("set ntfy: %v", err)
+	}
+	if got, err := s.GetNtfyConfig("u1"); err != nil || got != cfg {
+		t.Errorf("ntfy = %+v, %v", got, err)
+	}
+}
+
+func TestRelayStoreOrgs(t *testing.T) {
+	s := testStore(t)
+	for _, id := range []string{"u1", "u2", "u3"} {
+		s.CreateUser(id)
+	}
+	s.CreateOrg("o1", "Acme", "acme", "u1")
+	s.CreateOrg("o2", "Beta", "beta", "u1")
+
+	if o, err := s.GetOrgBySlug("acme"); err != nil || o == nil || o.ID != "o1" {
+		t.Errorf("by slug = %+v, %v", o, err)
+	}
+	if o, err := s.GetOrgByID("o2"); err != nil || o == nil || o.Slug != "beta" {
+		t.Errorf("by id = %+v, %v", o, err)
+	}
+	if orgs, _ := s.ListAllOrgs(); len(orgs) != 2 {
+		t.Errorf("all orgs = %d, want 2", len(orgs))
+	}
+	if orgs, _ := s.ListOrgsForUser("u1"); len(orgs) != 2 || orgs[0].Name != "Acme" || orgs[1].Name != "Beta" {
+		t.Errorf("orgs for u1 = %v", orgs)
+	}
+
+	s.SetOrgMaxSeats("o1", 5)
+	s.AddOrgMember("o1", "u2", "member")
+	if n, err := s.CountOrgMembers("o1"); err != nil || n != 2 {
+		t.Errorf("members = %d, %v", n, err)
+	}
+	if members, _ := s.ListOrgMembers("o1"); len(members) != 2 {
+		t.Errorf("member list = %v", members)
+	}
+	if err := s.SetOrgMemberRole("o1", "u2", "admin"); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	if role := s.GetOrgMemberRole("o1", "u2"); role != "admin" {
+		t.Errorf("role = %q", role)
+	}
+
+	s.CreateOrgInvite("i1", "o1", "c@example.com", "itok1", "u1", "member")
+	email, orgID, role, err := s.ConsumeOrgInvite("itok1")
+	if err != nil || email != "c@example.com" || orgID != "o1" || role != "member" {
+		t.Errorf("consume invite = %q %q %q, %v", email, orgID, role, err)
+	}
+	if _, _, _, err := s.ConsumeOrgInvite("itok1"); err == nil {
+		t.Error("invite consumed twice")
+	}
+	s.CreateOrgInvite("i2", "o1", "d@example.com", "itok2", "u1", "member")
+	s.CreateOrgInvite("i3", "o1", "e@example.com", "itok3", "u1", "member")
+	s.CreateOrgInvite("i4", "o1", "e@example.com", "itok4", "u1", "admin")
+	if err := s.RevokeOrgInvite("itok2"); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := s.RevokeOrgInvitesForEmail("o1", "e@example.com"); err != nil {
+		t.Fatalf("revoke for email: %v", err)
+	}
+	if invites, _ := s.ListPendingInvites("o1"); len(invites) != 0 {
+		t.Errorf("pending after revoking = %v", invites)
+	}
+	if inv, _ := s.GetInviteByToken("itok1"); inv == nil || inv.ClaimedAt == nil {
+		t.Errorf("claimed invite revoked: %+v", inv)
+	}
+
+	if err := s.DeleteOrg("o1"); err != nil {
+		t.Fatalf("delete org: %v", err)
+	}
+	if o, _ := s.GetOrgByID("o1"); o != nil {
+		t.Errorf("deleted org = %+v", o)
+	}
+	if n, _ := s.CountOrgMembers("o1"); n != 0 {
+		t.Errorf("members of deleted org = %d", n)
+	}
+}
+
+func TestRelayStoreListAudit(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("u1")
+	s.CreateOrg("o1", "Acme", "acme", "u1")
+
+	s.AppendAudit("u1", "login", nil)
+	if err := s.AppendOrgAudit("u1", "o1", "org.member_added", strPtr("u2")); err != nil {
+		t.Fatalf("append org audit: %v", err)
+	}
+	s.AppendAudit("u1", "logout", nil)
+
+	all, err := s.ListAudit(AuditFilter{UserID: "u1"})
+	if err != nil || len(all) != 3 || all[0].Event != "logout" {
+		t.Fatalf("audit = %v, %v", all, err)
+	}
+	if org, _ := s.ListAudit(AuditFilter{OrgID: "o1"}); len(org) != 1 || org[0].Detail == nil || *org[0].Detail != "u2" {
+		t.Errorf("org audit = %v", org)
+	}
+	if got, _ := s.ListAudit(AuditFilter{UserID: "u1", Events: []string{"login", "logout"}}); len(got) != 2 {
+		t.Errorf("by event = %d, want 2", len(got))
+	}
+	if got, _ := s.ListAudit(AuditFilter{UserID: "u1", Before: all[0].ID, Limit: 1}); len(got) != 1 || got[0].ID != all[1].ID {
+		t.Errorf("page before %d = %v", all[0].ID, got)
+	}
+	if got, _ := s.ListAudit(AuditFilter{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour)}); len(got) != 3 {
+		t.Errorf("in window = %d, want 3", len(got))
+	}
+	if got, _ := s.ListAudit(AuditFilter{Until: time.Now().Add(-time.Hour)}); len(got) != 0 {
+		t.Errorf("before window = %d, want 0", len(got))
+	}
+}
+
+func TestRelayStoreSubscriptions(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("u1")
+	s.CreateUser("u2")
+	s.CreateOrg("o1", "Acme", "acme", "u1")
+	u1, o1 := "u1", "o1"
+
+	s.CreateSubscription(&Subscription{ID: "sub-p", UserID: &u1, Plan: "pro_monthly", Status: "active", Seats: 1})
+	if err := s.CreateEntitlement(&Entitlement{ID: "ent-1", UserID: "u1", SubscriptionID: "sub-p"}); err != nil {
+		t.Fatalf("create entitlement: %v", err)
+	}
+	if err := s.CreateEntitlement(&Entitlement{ID: "ent-1", UserID: "u1", SubscriptionID: "sub-p"}); err != nil {
+		t.Errorf("duplicate entitlement: %v", err)
+	}
+	if !s.HasPersonalSubscription("u1") {
+		t.Error("u1 has no personal subscription")
+	}
+	if sub, err := s.GetActivePersonalSubscription("u1"); err != nil || sub == nil || sub.ID != "sub-p" {
+		t.Errorf("personal subscription = %+v, %v", sub, err)
+	}
+
+	s.CreateSubscription(&Subscription{ID: "sub-o", UserID: &u1, OrgID: &o1, Plan: "team_monthly", Status: "active", Seats: 3})
+	if err := s.UpdateSubscriptionSeats("sub-o", 5); err != nil {
+		t.Fatalf("update seats: %v", err)
+	}
+	if sub, err := s.GetActiveOrgSubscription("o1"); err != nil || sub == nil || sub.Seats != 5 {
+		t.Errorf("org subscription = %+v, %v", sub, err)
+	}
+	s.CreateEntitlement(&Entitlement{ID: "ent-2", UserID: "u2", SubscriptionID: "sub-o"})
+	if err := s.DeleteEntitlementByUserAndSub("u2", "sub-o"); err != nil {
+		t.Fatalf("delete entitlement: %v", err)
+	}
+	if n, _ := s.CountEntitlementsBySub("sub-o"); n != 0 {
+		t.Errorf("entitlements after delete = %d", n)
+	}
+	s.CreateEntitlement(&Entitlement{ID: "ent-3", UserID: "u2", SubscriptionID: "sub-o"})
+	if users, err := s.DeleteEntitlementsBySub("sub-o"); err != nil || !slices.Equal(users, []string{"u2"}) {
+		t.Errorf("deleted entitlements = %v, %v", users, err)
+	}
+
+	if err := s.UpdateSubscriptionStatus("sub-p", "canceled"); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+	if s.HasPersonalSubscription("u1") {
+		t.Error("canceled subscription still counts")
+	}
+	if sub, _ := s.GetActivePersonalSubscription("u1"); sub != nil {
+		t.Errorf("canceled subscription = %+v", sub)
+	}
+
+	// Pro users without a subscription get one
+	s.UpdateUserTier("u2", "pro")
+	if err := s.BackfillProUsers(); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	if sub, _ := s.GetActivePersonalSubscription("u2"); sub == nil || sub.ID != "backfill-u2" || !s.HasPersonalSubscription("u2") {
+		t.Errorf("backfilled subscription = %+v", sub)
+	}
+}
+
+func TestRelayStoreLabelsAndPasskeys(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("u1")
+
+	s.SetLabel("w1", "user", "u1", "laptop")
+	s.SetLabel("w1", "org", "o1", "build box")
+	if got := s.ResolveLabel("w1", "u1", "o1"); got != "build box" {
+		t.Errorf("org label = %q", got)
+	}
+	if got := s.ResolveLabels([]string{"w1", "w2"}, "u1", ""); len(got) != 1 || got["w1"] != "laptop" {
+		t.Errorf("labels = %v", got)
+	}
+	if err := s.DeleteLabel("w1", "org", "o1"); err != nil {
+		t.Fatalf("delete label: %v", err)
+	}
+	if got := s.ResolveLabel("w1", "u1", "o1"); got != "laptop" {
+		t.Errorf("after delete = %q, want personal label", got)
+	}
+
+	s.CreatePasskeyCredential("pk-1", "u1", []byte{1}, []byte{2}, "key")
+	if err := s.UpdatePasskeySignCount("pk-1", 7); err != nil {
+		t.Fatalf("update sign count: %v", err)
+	}
+	if creds, _ := s.ListPasskeyCredentials("u1"); len(creds) != 1 || creds[0].SignCount != 7 {
+		t.Errorf("creds = %+v", creds)
+	}
+	if err := s.DeletePasskeyCredential("pk-1", "u2"); err == nil {
+		t.Error("deleted another user's passkey")
+	}
+	if err := s.DeletePasskeyCredential("pk-1", "u1"); err != nil {
+		t.Fatalf("delete passkey: %v", err)
+	}
+	if creds, _ := s.ListPasskeyCredentials("u1"); len(creds) != 0 {
+		t.Errorf("creds after delete = %+v", creds)
+	}
+}
+
+func TestRelayStoreSCIM(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("owner")
+	s.CreateOrg("o1", "Acme", "acme", "owner")
+
+	if err := s.SetSCIMToken("o1", "hash-1", "owner"); err != nil {
+		t.Fatalf("set token: %v", err)
+	}
+	if org, err := s.GetOrgBySCIMToken("hash-1"); err != nil || org == nil || org.ID != "o1" {
+		t.Errorf("org by token = %+v, %v", org, err)
+	}
+	if err := s.DeleteSCIMToken("o1"); err != nil {
+		t.Fatalf("delete token: %v", err)
+	}
+	if org, _ := s.GetOrgBySCIMToken("hash-1"); org != nil {
+		t.Errorf("revoked token still resolves to %+v", org)
+	}
+
+	// A placeholder provisioned into two groups
+	s.UpsertUser(&User{ID: "ph", Provider: scimUserProvider, ProviderID: "o1:ada", DisplayName: "Ada"})
+	s.UpdateUserEmail("ph", "ada@acme.test")
+	if err := s.UpsertSCIMUser(&SCIMUser{OrgID: "o1", UserID: "ph", UserName: "ada@acme.test", Role: "member", Active: true, Pending: true}); err != nil {
+		t.Fatalf("upsert scim user: %v", err)
+	}
+	if users, _ := s.ListSCIMUsers("o1"); len(users) != 1 || !users[0].Pending || !users[0].Active {
+		t.Errorf("scim users = %+v", users)
+	}
+	for _, g := range []*SCIMGroup{
+		{ID: "g1", OrgID: "o1", DisplayName: "Eng", Members: []string{"ph"}},
+		{ID: "g2", OrgID: "o1", DisplayName: "Ops", Members: []string{"ph"}},
+	} {
+		if err := s.SaveSCIMGroup(g); err != nil {
+			t.Fatalf("save group: %v", err)
+		}
+	}
+	if g, _ := s.GetSCIMGroup("o1", "g1"); g == nil || !slices.Equal(g.Members, []string{"ph"}) {
+		t.Errorf("group = %+v", g)
+	}
+	if groups, _ := s.ListSCIMGroups("o1"); len(groups) != 2 || groups[0].DisplayName != "Eng" {
+		t.Errorf("groups = %+v", groups)
+	}
+
+	// An existing account proving the email takes over the placeholder
+	s.UpsertUser(&User{ID: "ada", Provider: "github", ProviderID: "42", DisplayName: "Ada"})
+	if err := s.AdoptSCIMUser("ada", "ada@acme.test"); err != nil {
+		t.Fatalf("adopt: %v", err)
+	}
+	if u, _ := s.GetUserByID("ph"); u != nil {
+		t.Errorf("placeholder survived adoption: %+v", u)
+	}
+	if su, _ := s.GetSCIMUser("o1", "ada"); su == nil || !su.Pending {
+		t.Errorf("adopted scim user = %+v", su)
+	}
+	if names, _ := s.ListSCIMGroupsForUser("o1", "ada"); !slices.Equal(names, []string{"Eng", "Ops"}) {
+		t.Errorf("adopted groups = %v", names)
+	}
+
+	if err := s.DeleteSCIMGroup("o1", "g2"); err != nil {
+		t.Fatalf("delete group: %v", err)
+	}
+	if g, _ := s.GetSCIMGroup("o1", "g2"); g != nil {
+		t.Errorf("deleted group = %+v", g)
+	}
+	if err := s.DeleteSCIMUser("o1", "ada"); err != nil {
+		t.Fatalf("delete scim user: %v", err)
+	}
+	if su, _ := s.GetSCIMUser("o1", "ada"); su != nil {
+		t.Errorf("deleted scim user = %+v", su)
+	}
+	if names, _ := s.ListSCIMGroupsForUser("o1", "ada"); len(names) != 0 {
+		t.Errorf("groups of deleted scim user = %v", names)
+	}
+}
+
+func TestRelayStoreAPITokens(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("u1")
+
+	if err := s.CreateAPIToken(&APIToken{ID: "t1", UserID: "u1", Name: "ci", Scopes: []string{"wings:read"}, WingIDs: []string{"w1"}}, "h1"); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	expired := time.Now().Add(-time.Minute)
+	s.CreateAPIToken(&APIToken{ID: "t2", UserID: "u1", Name: "old", ExpiresAt: &expired}, "h2")
+
+	tok, err := s.GetAPITokenByHash("h1")
+	if err != nil || tok == nil || !slices.Equal(tok.Scopes, []string{"wings:read"}) || !slices.Equal(tok.WingIDs, []string{"w1"}) {
+		t.Fatalf("token = %+v, %v", tok, err)
+	}
+	if tok, _ := s.GetAPITokenByHash("h2"); tok != nil {
+		t.Errorf("expired token = %+v", tok)
+	}
+	tokens, _ := s.ListAPITokens("u1")
+	if len(tokens) != 2 {
+		t.Fatalf("tokens = %d, want 2", len(tokens))
+	}
+	for _, tk := range tokens {
+		if tk.ID == "t1" && tk.LastUsedAt == nil {
+			t.Error("use not recorded")
+		}
+	}
+
+	if err := s.DeleteAPIToken("t1", "u2"); err == nil {
+		t.Error("deleted another user's token")
+	}
+	if err := s.DeleteAPIToken("t1", "u1"); err != nil {
+		t.Fatalf("delete token: %v", err)
+	}
+	if tok, _ := s.GetAPITokenByHash("h1"); tok != nil {
+		t.Errorf("deleted token = %+v", tok)
+	}
+}
+
+func TestRelayStoreWebhooks(t *testing.T) {
+	s := testStore(t)
+	s.CreateUser("u1")
+	s.CreateOrg("o1", "Acme", "acme", "u1")
+	o1 := "o1"
+	s.CreateWebhook(&Webhook{ID: "h1", UserID: "u1", URL: "https://a.test", Secret: "s", Events: []string{"session.exit"}})
+	s.CreateWebhook(&Webhook{ID: "h2", UserID: "u1", OrgID: &o1, URL: "https://b.test", Secret: "s"})
+
+	if hooks, _ := s.ListUserWebhooks("u1"); len(hooks) != 1 || hooks[0].ID != "h1" {
+		t.Errorf("user hooks = %v", hooks)
+	}
+	if hooks, _ := s.ListOrgWebhooks("o1"); len(hooks) != 1 || hooks[0].ID != "h2" {
+		t.Errorf("org hooks = %v", hooks)
+	}
+	for _, tc := range []struct {
+		orgID, event string
+		want         int
+	}{
+		{"o1", "session.exit", 2},
+		{"o1", "wing.online", 1},
+		{"", "wing.online", 0},
+	} {
+		if hooks, err := s.WebhooksFor("u1", tc.orgID, tc.event); err != nil || len(hooks) != tc.want {
+			t.Errorf("WebhooksFor(%q, %q) = %d, %v; want %d", tc.orgID, tc.event, len(hooks), err, tc.want)
+		}
+	}
+
+	s.CreateWebhookDelivery(&WebhookDelivery{ID: "d1", WebhookID: "h1", Event: "session.exit", Payload: "{}"}, time.Now().Add(-time.Minute))
+	s.CreateWebhookDelivery(&WebhookDelivery{ID: "d2", WebhookID: "h1", Event: "session.exit", Payload: "{}"}, time.Now().Add(time.Hour))
+	if due, err := s.DueWebhookDeliveries(10); err != nil || len(due) != 1 || due[0].ID != "d1" {
+		t.Fatalf("due = %v, %v", due, err)
+	}
+	retry := time.Now().Add(time.Hour)
+	if err := s.RecordWebhookAttempt("d1", "pending", 500, "boom", &retry); err != nil {
+		t.Fatalf("record attempt: %v", err)
+	}
+	if due, _ := s.DueWebhookDeliveries(10); len(due) != 0 {
+		t.Errorf("due after retry scheduled = %v", due)
+	}
+	s.RecordWebhookAttempt("d1", "delivered", 200, "", nil)
+	deliveries, _ := s.ListWebhookDeliveries("h1", 10)
+	for _, d := range deliveries {
+		if d.ID == "d1" && (d.Status != "delivered" || d.Attempts != 2 || d.ResponseCode == nil || *d.ResponseCode != 200) {
+			t.Errorf("d1 = %+v", d)
+		}
+	}
+
+	// Pruning keeps pending deliveries
+	if err := s.PruneWebhookDeliveries(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if deliveries, _ := s.ListWebhookDeliveries("h1", 10); len(deliveries) != 1 || deliveries[0].ID != "d2" {
+		t.Errorf("after prune = %v", deliveries)
+	}
+
+	if err := s.DeleteWebhook("h1"); err != nil {
+		t.Fatalf("delete webhook: %v", err)
+	}
+	if h, _ := s.GetWebhook("h1"); h != nil {
+		t.Errorf("deleted webhook = %+v", h)
+	}
+	if deliveries, _ := s.ListWebhookDeliveries("h1", 10); len(deliveries) != 0 {
+		t.Errorf("deliveries of deleted webhook = %v", deliveries)
+	}
+}
+
+func TestRelayStoreSAMLRequestsAndTickets(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+
+	if err := s.SaveSAMLRequest("okta", "req-1", now.Add(5*time.Minute)); err != nil {
+		t.Fatalf("save request: %v", err)
+	}
+	if ok, err := s.TakeSAMLRequest("okta", "req-1", now); err != nil || !ok {
+		t.Errorf("take = %v, %v", ok, err)
+	}
+	if ok, _ := s.TakeSAMLRequest("okta", "req-1", now); ok {
+		t.Error("request taken twice")
+	}
+	s.SaveSAMLRequest("okta", "req-2", now.Add(5*time.Minute))
+	if ok, _ := s.TakeSAMLRequest("azure", "req-2", now); ok {
+		t.Error("request taken by another provider")
+	}
+	if ok, _ := s.TakeSAMLRequest("okta", "req-2", now.Add(10*time.Minute)); ok {
+		t.Error("expired request taken")
+	}
+
+	if err := s.SaveSAMLTicket("okta", "th-1", "req-1", `{"sub":"ada"}`, now.Add(time.Minute)); err != nil {
+		t.Fatalf("save ticket: %v", err)
+	}
+	reqID, identity, err := s.TakeSAMLTicket("okta", "th-1", now)
+	if err != nil || reqID != "req-1" || identity != `{"sub":"ada"}` {
+		t.Errorf("take ticket = %q %q, %v", reqID, identity, err)
+	}
+	if reqID, _, _ := s.TakeSAMLTicket("okta", "th-1", now); reqID != "" {
+		t.Error("ticket redeemed twice")
+	}
+}
+
+func TestRelayStoreBandwidthUsage(t *testing.T) {
+	s := testStore(t)
+	b := NewBandwidthMeter(1<<20, 1<<20, s.DB())
+	b.syncToDB("u1", "2026-03", 4096)
+	b.syncToDB("u1", "2026-03", 8192)
+
+	if got, err := s.ListBandwidthUsage("2026-03"); err != nil || len(got) != 1 || got["u1"] != 8192 {
+		t.Errorf("usage = %v, %v", got, err)
+	}
+	if got, _ := s.ListBandwidthUsage("2026-04"); len(got) != 0 {
+		t.Errorf("other month = %v", got)
+	}
+}
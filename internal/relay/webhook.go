@@ -0,0 +1,571 @@
+package relay
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outbound webhooks. Events are queued in the database on the login node (or
+// the single node) and delivered by one worker with retries. Payloads carry
+// only metadata the relay already sees — IDs, agent, cwd, exit codes — never
+// terminal content, which is end-to-end encrypted.
+
+// webhookEvents are the events a webhook can subscribe to.
+var webhookEvents = []string{
+	"wing.online",
+	"wing.offline",
+	"session.started",
+	"session.exited",
+	"session.attention",
+	"bandwidth.exceeded",
+}
+
+const (
+	webhookSecretPrefix = "whsec_"
+	webhookMaxPerOwner  = 10
+	webhookTimeout      = 10 * time.Second
+	webhookBatch        = 50
+	webhookRetention    = 14 * 24 * time.Hour
+)
+
+// webhookBackoff is the wait before each retry. A delivery that still fails
+// after the last one is marked failed.
+var webhookBackoff = []time.Duration{
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	1 * time.Hour,
+	6 * time.Hour,
+}
+
+// bandwidthWebhookSent dedups bandwidth.exceeded to once per user per month.
+var bandwidthWebhookSent sync.Map // userID:YYYY-MM → bool
+
+// emitWebhook queues event for userID's personal webhooks and orgID's webhooks.
+// Edges have no store and forward the event to the login node.
+func (s *Server) emitWebhook(event, userID, orgID string, data map[string]any) {
+	if s.Store == nil {
+		if s.IsEdge() && s.Config.LoginNodeAddr != "" {
+			payload, _ := json.Marshal(map[string]any{
+				"type":    "webhook",
+				"event":   event,
+				"user_id": userID,
+				"org_id":  orgID,
+				"data":    data,
+			})
+			go s.forwardPayloadToLogin(payload)
+		}
+		return
+	}
+	hooks, err := s.Store.WebhooksFor(userID, orgID, event)
+	if err != nil {
+		log.Printf("webhook: %v", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	for _, h := range hooks {
+		d, err := newWebhookDelivery(h.ID, event, data)
+		if err == nil {
+			err = s.Store.CreateWebhookDelivery(d, time.Now())
+		}
+		if err != nil {
+			log.Printf("webhook: queue %s for %s: %v", event, h.ID, err)
+		}
+	}
+	s.pokeWebhooks()
+}
+
+func newWebhookDelivery(webhookID, event string, data map[string]any) (*WebhookDelivery, error) {
+	id := uuid.New().String()
+	body, err := json.Marshal(map[string]any{
+		"id":         id,
+		"event":      event,
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+		"data":       data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookDelivery{ID: id, WebhookID: webhookID, Event: event, Payload: string(body)}, nil
+}
+
+// emitWingWebhook fires wing.online or wing.offline.
+func (s *Server) emitWingWebhook(event, wingID, userID, orgID string) {
+	s.emitWebhook(event, userID, orgID, map[string]any{
+		"wing_id": wingID,
+		"user_id": userID,
+		"org_id":  orgID,
+	})
+}
+
+// emitBandwidthExceeded fires bandwidth.exceeded once per user per month.
+func (s *Server) emitBandwidthExceeded(userID string) {
+	key := userID + ":" + time.Now().UTC().Format("2006-01")
+	if _, loaded := bandwidthWebhookSent.LoadOrStore(key, true); loaded {
+		return
+	}
+	s.emitWebhook("bandwidth.exceeded", userID, "", map[string]any{
+		"user_id":   userID,
+		"cap_bytes": freeMonthlyCap,
+	})
+}
+
+func (s *Server) pokeWebhooks() {
+	select {
+	case s.webhookPoke <- struct{}{}:
+	default:
+	}
+}
+
+// StartWebhooks runs the delivery worker until ctx is done. Login or single
+// node only: deliveries live in the database.
+func (s *Server) StartWebhooks(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.webhookPoke:
+			}
+			if !s.IsLeader() {
+				continue // another login replica delivers
+			}
+			s.deliverDueWebhooks(ctx)
+			if time.Since(lastPrune) > time.Hour {
+				s.Store.PruneWebhookDeliveries(time.Now().Add(-webhookRetention))
+				lastPrune = time.Now()
+			}
+		}
+	}()
+}
+
+// deliverDueWebhooks attempts every due delivery, a few at a time.
+func (s *Server) deliverDueWebhooks(ctx context.Context) {
+	due, err := s.Store.DueWebhookDeliveries(webhookBatch)
+	if err != nil {
+		log.Printf("webhook: %v", err)
+		return
+	}
+	sem := make(chan struct{}, 4)
+	var wg sync.WaitGroup
+	for _, d := range due {
+		h, err := s.Store.GetWebhook(d.WebhookID)
+		if err != nil || h == nil {
+			s.Store.RecordWebhookAttempt(d.ID, "failed", 0, "webhook deleted", nil)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			s.attemptWebhook(ctx, h, d)
+		}()
+	}
+	wg.Wait()
+}
+
+// attemptWebhook sends one delivery and records the outcome, scheduling a
+// retry on failure. Returns the response code (0 if none) and error text.
+func (s *Server) attemptWebhook(ctx context.Context, h *Webhook, d *WebhookDelivery) (int, string) {
+	code, errMsg := s.sendWebhook(ctx, h, d)
+	if errMsg == "" {
+		s.Store.RecordWebhookAttempt(d.ID, "delivered", code, "", nil)
+		return code, ""
+	}
+	if d.Attempts < len(webhookBackoff) {
+		next := time.Now().Add(webhookBackoff[d.Attempts])
+		s.Store.RecordWebhookAttempt(d.ID, "pending", code, errMsg, &next)
+	} else {
+		s.Store.RecordWebhookAttempt(d.ID, "failed", code, errMsg, nil)
+		log.Printf("webhook: %s to %s failed after %d attempts: %s", d.Event, h.ID, d.Attempts+1, errMsg)
+	}
+	return code, errMsg
+}
+
+// sendWebhook POSTs the payload with its signature.
+func (s *Server) sendWebhook(ctx context.Context, h *Webhook, d *WebhookDelivery) (int, string) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wingthing-webhooks")
+	req.Header.Set("X-Wingthing-Event", d.Event)
+	req.Header.Set("X-Wingthing-Delivery", d.ID)
+	req.Header.Set("X-Wingthing-Signature", "t="+ts+",v1="+signWebhook(h.Secret, ts, []byte(d.Payload)))
+	resp, err := s.webhookHTTPClient().Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// signWebhook is the v1 signature: hex HMAC-SHA256 of "<timestamp>.<body>".
+// Receivers recompute it and reject stale timestamps to stop replays.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	publicWebhookClient  = newWebhookClient(false)
+	privateWebhookClient = newWebhookClient(true)
+)
+
+// nonPublicNets are ranges net.IP's predicates miss: "this network",
+// carrier-grade NAT (which Tailscale uses for its tailnet addresses), IETF
+// protocol assignments, benchmarking, and local-use NAT64, whose embedded
+// IPv4 address can sit anywhere in the prefix.
+var nonPublicNets = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),
+	mustCIDR("100.64.0.0/10"),
+	mustCIDR("192.0.0.0/24"),
+	mustCIDR("198.18.0.0/15"),
+	mustCIDR("64:ff9b:1::/48"),
+}
+
+// nat64Net is the well-known NAT64 prefix. A gateway turns an address in it
+// into the IPv4 address in its last four bytes.
+var nat64Net = mustCIDR("64:ff9b::/96")
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// webhookDestPublic reports whether ip is safe for the hosted relay to post to.
+func webhookDestPublic(ip net.IP) bool {
+	if ip != nil && nat64Net.Contains(ip) {
+		ip = net.IP(ip[12:16]) // judged as the IPv4 address it reaches
+	}
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newWebhookClient returns a client for webhook deliveries. Unless
+// allowPrivate, it refuses to connect to loopback, private, link-local and
+// CGNAT addresses, checked at dial time so DNS can't be used to reach the relay's
+// internal network.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !webhookDestPublic(net.ParseIP(host)) {
+				return fmt.Errorf("webhook destination %s is not public", host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookHTTPClient picks the delivery client. Self-hosted roosts may post to
+// their own network; the hosted relay may not.
+func (s *Server) webhookHTTPClient() *http.Client {
+	if s.webhookClient != nil {
+		return s.webhookClient
+	}
+	if s.RoostMode || s.LocalMode {
+		return privateWebhookClient
+	}
+	return publicWebhookClient
+}
+
+// --- HTTP API ---
+
+func webhookEntry(h *Webhook) map[string]any {
+	events := h.Events
+	if events == nil {
+		events = []string{}
+	}
+	return map[string]any{
+		"id":         h.ID,
+		"url":        h.URL,
+		"events":     events,
+		"org_id":     h.OrgID,
+		"created_by": h.UserID,
+		"created_at": h.CreatedAt,
+	}
+}
+
+// webhookOrg resolves the org a webhook request is about (?org= or body) and
+// checks the caller administers it. Returns ok=false after writing an error.
+func (s *Server) webhookOrg(w http.ResponseWriter, user *User, ref string) (*Org, bool) {
+	if ref == "" {
+		return nil, true
+	}
+	org, err := s.Store.ResolveOrg(ref, user.ID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if org == nil {
+		writeError(w, http.StatusNotFound, "org not found")
+		return nil, false
+	}
+	role := s.Store.GetOrgMemberRole(org.ID, user.ID)
+	if role != "owner" && role != "admin" {
+		writeError(w, http.StatusForbidden, "only owners and admins can manage org webhooks")
+		return nil, false
+	}
+	return org, true
+}
+
+// webhookFor loads {id} if the caller may manage it: their own personal hook,
+// or a hook of an org they administer.
+func (s *Server) webhookFor(w http.ResponseWriter, r *http.Request, user *User) *Webhook {
+	h, err := s.Store.GetWebhook(r.PathValue("id"))
+	if err != nil || h == nil {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return nil
+	}
+	if h.OrgID == nil {
+		if h.UserID != user.ID {
+			writeError(w, http.StatusNotFound, "webhook not found")
+			return nil
+		}
+		return h
+	}
+	role := s.Store.GetOrgMemberRole(*h.OrgID, user.ID)
+	if role != "owner" && role != "admin" {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return nil
+	}
+	return h
+}
+
+// handleListWebhooks lists personal webhooks, or an org's with ?org=.
+// GET /api/v1/webhooks
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	org, ok := s.webhookOrg(w, user, r.URL.Query().Get("org"))
+	if !ok {
+		return
+	}
+	var hooks []*Webhook
+	var err error
+	if org != nil {
+		hooks, err = s.Store.ListOrgWebhooks(org.ID)
+	} else {
+		hooks, err = s.Store.ListUserWebhooks(user.ID)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]map[string]any, len(hooks))
+	for i, h := range hooks {
+		out[i] = webhookEntry(h)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleCreateWebhook subscribes a URL to events. The signing secret is in the
+// response only. POST /api/v1/webhooks
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Org    string   `json:"org"` // ID or slug
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(req.URL) > 2000 {
+		writeError(w, http.StatusBadRequest, "url must be an http(s) URL")
+		return
+	}
+	for _, ev := range req.Events {
+		if !slices.Contains(webhookEvents, ev) {
+			writeError(w, http.StatusBadRequest, "unknown event "+ev)
+			return
+		}
+	}
+	slices.Sort(req.Events)
+	req.Events = slices.Compact(req.Events)
+	org, ok := s.webhookOrg(w, user, req.Org)
+	if !ok {
+		return
+	}
+
+	var existing []*Webhook
+	if org != nil {
+		existing, _ = s.Store.ListOrgWebhooks(org.ID)
+	} else {
+		existing, _ = s.Store.ListUserWebhooks(user.ID)
+	}
+	if len(existing) >= webhookMaxPerOwner {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d webhooks", webhookMaxPerOwner))
+		return
+	}
+
+	h := &Webhook{
+		ID:     uuid.New().String(),
+		UserID: user.ID,
+		URL:    req.URL,
+		Secret: webhookSecretPrefix + generateToken(),
+		Events: req.Events,
+	}
+	detail := "id=" + h.ID
+	if org != nil {
+		h.OrgID = &org.ID
+		detail += " org=" + org.Slug
+	}
+	if err := s.Store.CreateWebhook(h); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.CreatedAt = time.Now().UTC()
+	s.Store.AppendAudit(user.ID, "webhook_created", strPtr(detail))
+
+	out := webhookEntry(h)
+	out["secret"] = h.Secret
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// handleDeleteWebhook removes a webhook. DELETE /api/v1/webhooks/{id}
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	h := s.webhookFor(w, r, user)
+	if h == nil {
+		return
+	}
+	if err := s.Store.DeleteWebhook(h.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.Store.AppendAudit(user.ID, "webhook_deleted", strPtr("id="+h.ID))
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// handleWebhookDeliveries returns a webhook's delivery log, newest first.
+// GET /api/v1/webhooks/{id}/deliveries
+func (s *Server) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	h := s.webhookFor(w, r, user)
+	if h == nil {
+		return
+	}
+	deliveries, err := s.Store.ListWebhookDeliveries(h.ID, 100)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]map[string]any, len(deliveries))
+	for i, d := range deliveries {
+		out[i] = map[string]any{
+			"id":              d.ID,
+			"event":           d.Event,
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"response_code":   d.ResponseCode,
+			"error":           d.Error,
+			"next_attempt_at": d.NextAttemptAt,
+			"created_at":      d.CreatedAt,
+			"payload":         json.RawMessage(d.Payload),
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleTestWebhook sends a "ping" event right away and reports the result.
+// It is logged like any delivery and retried if it fails.
+// POST /api/v1/webhooks/{id}/test
+func (s *Server) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	user := s.tokenAdmin(w, r)
+	if user == nil {
+		return
+	}
+	h := s.webhookFor(w, r, user)
+	if h == nil {
+		return
+	}
+	// Due in a minute, so the worker doesn't pick it up while we send it
+	d, err := newWebhookDelivery(h.ID, "ping", map[string]any{"webhook_id": h.ID})
+	if err == nil {
+		err = s.Store.CreateWebhookDelivery(d, time.Now().Add(time.Minute))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	code, errMsg := s.attemptWebhook(r.Context(), h, d)
+	out := map[string]any{
+		"delivery_id":   d.ID,
+		"ok":            errMsg == "",
+		"response_code": code,
+	}
+	if errMsg != "" {
+		out["error"] = errMsg
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,207 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the requests it gets and answers with status.
+type webhookReceiver struct {
+	mu     sync.Mutex
+	status int
+	reqs   []*http.Request
+	bodies [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	wr.mu.Lock()
+	wr.reqs = append(wr.reqs, r)
+	wr.bodies = append(wr.bodies, body)
+	status := wr.status
+	wr.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func createWebhook(t *testing.T, ts *httptest.Server, client *http.Client, body string) (id, secret string) {
+	t.Helper()
+	resp, err := client.Post(ts.URL+"/api/v1/webhooks", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		data, _ := io.ReadAll(resp.Body)
+		t.Fatalf("create webhook: %d %s", resp.StatusCode, data)
+	}
+	var out struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return out.ID, out.Secret
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	srv, ts, client, userID := testServerWithSession(t)
+	srv.webhookClient = http.DefaultClient
+	recv := &webhookReceiver{status: http.StatusNoContent}
+	hookSrv := httptest.NewServer(recv)
+	defer hookSrv.Close()
+
+	id, secret := createWebhook(t, ts, client, `{"url":"`+hookSrv.URL+`","events":["wing.online"]}`)
+	if !strings.HasPrefix(secret, webhookSecretPrefix) {
+		t.Fatalf("secret = %q", secret)
+	}
+
+	wing := &ConnectedWing{ID: "conn-a", UserID: userID, WingID: "wing-a"}
+	srv.Wings.Add(wing)
+	srv.dispatchWingEvent("wing.online", wing)
+	srv.emitWebhook("session.started", userID, "", map[string]any{"session_id": "s1"}) // not subscribed
+	srv.deliverDueWebhooks(context.Background())
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	if len(recv.reqs) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(recv.reqs))
+	}
+	r, body := recv.reqs[0], recv.bodies[0]
+	if r.Header.Get("X-Wingthing-Event") != "wing.online" {
+		t.Errorf("event header = %q", r.Header.Get("X-Wingthing-Event"))
+	}
+	var ts0, sig string
+	for _, part := range strings.Split(r.Header.Get("X-Wingthing-Signature"), ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts0 = v
+		case "v1":
+			sig = v
+		}
+	}
+	if sig != signWebhook(secret, ts0, body) {
+		t.Error("signature does not verify")
+	}
+	var payload struct {
+		Event string         `json:"event"`
+		Data  map[string]any `json:"data"`
+	}
+	json.Unmarshal(body, &payload)
+	if payload.Event != "wing.online" || payload.Data["wing_id"] != "wing-a" {
+		t.Errorf("payload = %s", body)
+	}
+
+	deliveries, _ := srv.Store.ListWebhookDeliveries(id, 10)
+	if len(deliveries) != 1 || deliveries[0].Status != "delivered" || deliveries[0].Attempts != 1 {
+		t.Errorf("delivery log = %+v", deliveries)
+	}
+}
+
+func TestWebhookRetryAndTestSend(t *testing.T) {
+	srv, ts, client, _ := testServerWithSession(t)
+	srv.webhookClient = http.DefaultClient
+	recv := &webhookReceiver{status: http.StatusInternalServerError}
+	hookSrv := httptest.NewServer(recv)
+	defer hookSrv.Close()
+
+	id, _ := createWebhook(t, ts, client, `{"url":"`+hookSrv.URL+`"}`)
+
+	resp, err := client.Post(ts.URL+"/api/v1/webhooks/"+id+"/test", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		OK           bool `json:"ok"`
+		ResponseCode int  `json:"response_code"`
+	}
+	json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if res.OK || res.ResponseCode != http.StatusInternalServerError {
+		t.Errorf("test send = %+v, want failed 500", res)
+	}
+
+	deliveries, _ := srv.Store.ListWebhookDeliveries(id, 10)
+	if len(deliveries) != 1 {
+		t.Fatalf("deliveries = %d", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.Status != "pending" || d.Attempts != 1 || d.NextAttemptAt == nil || !d.NextAttemptAt.After(time.Now()) {
+		t.Errorf("after first failure: %+v", d)
+	}
+
+	// Out of retries: marked failed
+	h, _ := srv.Store.GetWebhook(id)
+	d.Attempts = len(webhookBackoff)
+	srv.attemptWebhook(context.Background(), h, d)
+	deliveries, _ = srv.Store.ListWebhookDeliveries(id, 10)
+	if deliveries[0].Status != "failed" {
+		t.Errorf("status = %s, want failed", deliveries[0].Status)
+	}
+}
+
+func TestWebhookAccess(t *testing.T) {
+	srv, ts, client, userID := testServerWithSession(t)
+
+	// Unknown events and non-http URLs are rejected
+	for _, body := range []string{
+		`{"url":"https://example.com/hook","events":["wing.exploded"]}`,
+		`{"url":"ftp://example.com/hook"}`,
+	} {
+		resp, _ := client.Post(ts.URL+"/api/v1/webhooks", "application/json", strings.NewReader(body))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	// Org hooks need owner or admin
+	srv.Store.CreateUser("other-owner")
+	srv.Store.CreateOrg("org-2", "Other", "other", "other-owner")
+	srv.Store.DB().Exec("UPDATE orgs SET max_seats = 10 WHERE id = 'org-2'")
+	srv.Store.AddOrgMember("org-2", userID, "member")
+	resp, _ := client.Post(ts.URL+"/api/v1/webhooks", "application/json", strings.NewReader(`{"url":"https://example.com/hook","org":"org-2"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("member org webhook: %d, want 403", resp.StatusCode)
+	}
+
+	// Someone else's hook is invisible
+	srv.Store.CreateWebhook(&Webhook{ID: "hook-other", UserID: "other-owner", URL: "https://example.com", Secret: "x"})
+	req, _ := http.NewRequest("DELETE", ts.URL+"/api/v1/webhooks/hook-other", nil)
+	resp, _ = client.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("delete other's hook: %d, want 404", resp.StatusCode)
+	}
+
+	// The hosted relay never posts to private addresses
+	id, _ := createWebhook(t, ts, client, `{"url":"http://127.0.0.1:1/hook"}`)
+	h, _ := srv.Store.GetWebhook(id)
+	_, errMsg := srv.sendWebhook(context.Background(), h, &WebhookDelivery{ID: "d", Event: "ping", Payload: "{}"})
+	if !strings.Contains(errMsg, "not public") {
+		t.Errorf("private destination: %q", errMsg)
+	}
+}
+
+func TestWebhookDestPublic(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "192.168.0.1", "169.254.169.254", "0.0.0.0", "0.1.2.3", "100.64.0.1", "100.127.255.254", "::1", "fd00::1",
+		"192.0.0.170", "198.18.0.1", "198.19.255.254", "::ffff:10.0.0.1",
+		"64:ff9b::7f00:1", "64:ff9b::a9fe:a9fe", "64:ff9b::10.1.2.3", "64:ff9b:1::a00:1"} {
+		if webhookDestPublic(net.ParseIP(addr)) {
+			t.Errorf("%s allowed", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34", "100.128.0.1", "2606:4700::1", "64:ff9b::5db8:d822", "198.20.0.1"} {
+		if !webhookDestPublic(net.ParseIP(addr)) {
+			t.Errorf("%s blocked", addr)
+		}
+	}
+}
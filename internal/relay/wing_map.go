@@ -1,11 +1,10 @@
 package relay
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
-	"net/http"
 	"sync"
 	"time"
 )
@@ -94,6 +93,17 @@ func (m *WingMap) EdgeIDs() []string {
 	return ids
 }
 
+// EdgeLastSeen returns when each known edge last registered a wing or synced.
+func (m *WingMap) EdgeLastSeen() map[string]time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make(map[string]time.Time, len(m.edges))
+	for id, t := range m.edges {
+		result[id] = t
+	}
+	return result
+}
+
 // All returns a snapshot of all wings.
 func (m *WingMap) All() map[string]WingLocation {
 	m.mu.RLock()
@@ -115,35 +125,61 @@ func (s *Server) locateWing(wingID string) (string, bool) {
 		}
 		return "", false
 	}
-	if s.Config.LoginNodeAddr != "" {
+	if s.login != nil {
 		return s.locateWingViaLogin(wingID)
 	}
 	return "", false
 }
 
-// locateWingViaLogin asks the login node where a wing is connected.
+// locateStaleTTL is how long an edge keeps routing to a wing's last known
+// machine while no login replica answers.
+const locateStaleTTL = 10 * time.Minute
+
+type locatedWing struct {
+	machineID string
+	at        time.Time
+}
+
+// locateWingViaLogin asks the login replicas where a wing is connected,
+// falling back to the last answer if none of them respond.
 func (s *Server) locateWingViaLogin(wingID string) (string, bool) {
-	client := &http.Client{Timeout: 3 * time.Second}
-	resp, err := client.Get(s.Config.LoginNodeAddr + "/internal/wing-locate/" + wingID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	body, err := s.login.Get(ctx, "/internal/wing-locate/"+wingID)
 	if err != nil {
-		return "", false
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
+		if !errors.Is(err, errLoginUnavailable) {
+			return "", false
+		}
+		s.locateMu.Lock()
+		defer s.locateMu.Unlock()
+		if l, ok := s.located[wingID]; ok && time.Since(l.at) < locateStaleTTL {
+			return l.machineID, true
+		}
 		return "", false
 	}
 	var result struct {
 		MachineID string `json:"machine_id"`
 		Found     bool   `json:"found"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return "", false
 	}
+	s.locateMu.Lock()
+	if result.Found {
+		s.located[wingID] = locatedWing{machineID: result.MachineID, at: time.Now()}
+	} else {
+		delete(s.located, wingID)
+	}
+	s.locateMu.Unlock()
 	return result.MachineID, result.Found
 }
 
-// registerWingWithLogin tells login to add a wing to the global map.
+// registerWingWithLogin adds a wing to every login replica's map. With no
+// replica reachable the registration is queued until one comes back.
 func (s *Server) registerWingWithLogin(wing *ConnectedWing) {
+	if len(s.login.Addrs()) == 0 {
+		return // login replica without peers
+	}
 	payload, _ := json.Marshal(map[string]any{
 		"wing_id":       wing.WingID,
 		"machine_id":    s.Config.FlyMachineID,
@@ -153,45 +189,28 @@ func (s *Server) registerWingWithLogin(wing *ConnectedWing) {
 		"locked":        wing.Locked,
 		"allowed_count": wing.AllowedCount,
 	})
-	client := &http.Client{Timeout: 3 * time.Second}
-	req, _ := http.NewRequest("POST", s.Config.LoginNodeAddr+"/internal/wing-register", bytes.NewReader(payload))
-	if req == nil {
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("registerWingWithLogin %s: %v", wing.WingID, err)
-		return
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.login.PostAll(ctx, "/internal/wing-register", payload) == 0 {
+		log.Printf("registerWingWithLogin %s: no login replica reachable, queued", wing.WingID)
+		s.login.Queue("/internal/wing-register", payload, true)
 	}
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("registerWingWithLogin %s: status %d", wing.WingID, resp.StatusCode)
-	}
-	resp.Body.Close()
 }
 
-// deregisterWingWithLogin tells login to remove a wing from the global map.
+// deregisterWingWithLogin removes a wing from every login replica's map.
 func (s *Server) deregisterWingWithLogin(wingID string) {
 	payload, _ := json.Marshal(map[string]string{"wing_id": wingID})
-	client := &http.Client{Timeout: 3 * time.Second}
-	req, _ := http.NewRequest("POST", s.Config.LoginNodeAddr+"/internal/wing-deregister", bytes.NewReader(payload))
-	if req == nil {
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("deregisterWingWithLogin %s: %v", wingID, err)
-		return
-	}
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("deregisterWingWithLogin %s: status %d", wingID, resp.StatusCode)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.login.PostAll(ctx, "/internal/wing-deregister", payload) == 0 {
+		s.login.Queue("/internal/wing-deregister", payload, true)
 	}
-	resp.Body.Close()
 }
 
-// StartEdgeSync runs the edge-to-login reconcile loop.
-func (s *Server) StartEdgeSync(ctx context.Context, loginAddr string, interval time.Duration) {
+// StartEdgeSync runs the reconcile loop that replicates this node's wings to
+// every login replica. Edges run it; so do login replicas with peers, which
+// keeps each replica's WingMap complete.
+func (s *Server) StartEdgeSync(ctx context.Context, interval time.Duration) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -200,13 +219,16 @@ func (s *Server) StartEdgeSync(ctx context.Context, loginAddr string, interval t
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				s.edgeSync(ctx, loginAddr)
+				s.edgeSync(ctx)
 			}
 		}
 	}()
 }
 
-func (s *Server) edgeSync(ctx context.Context, loginAddr string) {
+// edgeSync sends the full local wing list to every login replica. Drained
+// bandwidth goes to the leader only, and only the leader's banned list is
+// applied; usage nobody accepted is requeued.
+func (s *Server) edgeSync(ctx context.Context) {
 	snapshotAt := time.Now()
 	local := s.Wings.All()
 	type syncWing struct {
@@ -230,57 +252,58 @@ func (s *Server) edgeSync(ctx context.Context, loginAddr string) {
 	}
 
 	var bw map[string]int64
-	if s.Bandwidth != nil {
+	if s.Bandwidth != nil && !s.IsLeader() {
 		bw = s.Bandwidth.DrainCounters()
 	}
-	requeue := func() {
-		if s.Bandwidth != nil {
-			for userID, n := range bw {
-				s.Bandwidth.AddUsage(userID, n)
-			}
-		}
-	}
-
-	body, err := json.Marshal(map[string]any{
-		"machine_id":  s.Config.FlyMachineID,
-		"snapshot_at": snapshotAt.Unix(),
-		"wings":       wings,
-		"bandwidth":   bw,
-	})
-	if err != nil {
-		requeue()
-		return
-	}
-
-	client := &http.Client{Timeout: 3 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, "POST", loginAddr+"/internal/wing-sync", bytes.NewReader(body))
-	if err != nil {
-		requeue()
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		requeue()
-		return
+	// Until a leader is known, usage goes to the primary, which passes it on
+	// with its own sync.
+	leader := s.login.Leader()
+	target := leader
+	if target == "" {
+		target = s.login.Primary()
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		requeue()
-		return
+	var synced, delivered bool
+	for _, addr := range s.login.Addrs() {
+		req := map[string]any{
+			"machine_id":  s.Config.FlyMachineID,
+			"snapshot_at": snapshotAt.Unix(),
+			"wings":       wings,
+		}
+		if addr == target {
+			req["bandwidth"] = bw
+		}
+		body, err := json.Marshal(req)
+		if err != nil {
+			continue
+		}
+		data, err := s.login.do(ctx, "POST", addr, "/internal/wing-sync", body)
+		if err != nil {
+			continue
+		}
+		synced = true
+		if addr != target {
+			continue
+		}
+		delivered = true
+		var syncResp struct {
+			BannedUsers []string `json:"banned_users"`
+		}
+		if addr == leader && s.Bandwidth != nil && json.Unmarshal(data, &syncResp) == nil {
+			s.Bandwidth.SetExceeded(syncResp.BannedUsers)
+		}
 	}
 
-	var syncResp struct {
-		BannedUsers []string `json:"banned_users"`
+	// Put undelivered usage back for the next sync.
+	if !delivered && s.Bandwidth != nil {
+		for userID, n := range bw {
+			s.Bandwidth.AddUsage(userID, n)
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&syncResp); err != nil {
-		requeue()
+	if !synced {
+		s.metrics.loginSyncFailures.Add(1)
 		return
 	}
-
-	if s.Bandwidth != nil {
-		s.Bandwidth.SetExceeded(syncResp.BannedUsers)
-	}
+	s.metrics.lastLoginSync.Store(time.Now().UnixNano())
+	s.login.Flush(ctx)
 }
@@ -1,9 +1,9 @@
 package relay
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,6 +14,7 @@ import (
 	"github.com/coder/websocket"
 	"github.com/google/uuid"
 
+	"github.com/ehrlich-b/wingthing/internal/egg"
 	"github.com/ehrlich-b/wingthing/internal/ntfy"
 	"github.com/ehrlich-b/wingthing/internal/ws"
 )
@@ -28,6 +29,7 @@ type ConnectedWing struct {
 	UserID       string
 	WingID       string
 	PublicKey    string
+	SigningKey   string // Ed25519 key the wing signs audit chain heads with (base64)
 	OrgID        string // org ID this wing serves
 	Locked       bool
 	AllowedCount int
@@ -37,10 +39,11 @@ type ConnectedWing struct {
 
 // WingEvent is sent to dashboard subscribers for wing/session lifecycle events.
 type WingEvent struct {
-	Type         string `json:"type"`                    // "wing.online", "wing.offline", "session.attention"
+	Type         string `json:"type"`                    // "wing.online", "wing.offline", "wing.projects", "session.attention"
 	WingID       string `json:"wing_id"`
 	PublicKey    string `json:"public_key,omitempty"`
 	SessionID    string `json:"session_id,omitempty"`
+	Kind         string `json:"kind,omitempty"` // session.attention: "permission", "question", "done", "error", "tool"
 	Locked       *bool  `json:"locked,omitempty"`
 	AllowedCount *int   `json:"allowed_count,omitempty"`
 	UserID       string `json:"user_id,omitempty"`
@@ -327,6 +330,10 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
+	if s.userSuspended(r.Context(), userID) {
+		http.Error(w, "account suspended", http.StatusForbidden)
+		return
+	}
 
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		InsecureSkipVerify: true,
@@ -369,6 +376,7 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 		UserID:       userID,
 		WingID:       reg.WingID,
 		PublicKey:    wingPublicKey,
+		SigningKey:   reg.SigningKey,
 		OrgID:        reg.OrgSlug,
 		Locked:       reg.Locked,
 		AllowedCount: reg.AllowedCount,
@@ -406,6 +414,7 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 			if role == "" && s.RoostMode {
 				// Self-hosted: all authenticated users are org members
 				s.Store.AddOrgMember(org.ID, userID, "member")
+				s.Store.AppendOrgAudit(userID, org.ID, "org_member_added", strPtr("org="+org.Slug+" role=member via=roost"))
 				role = "member"
 			}
 			if role == "" {
@@ -428,8 +437,12 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.Wings.Add(wing)
+	if s.Store != nil {
+		s.auditWingRegistered(wing.UserID, wing.OrgID, wing.WingID, wing.PublicKey, s.Config.FlyMachineID)
+	}
 	s.dispatchWingEvent("wing.online", wing)
 	defer func() {
+		s.dropTunnelRequests(wing.ID)
 		if w := s.Wings.Remove(wing.ID); w != nil {
 			s.dispatchWingEvent("wing.offline", w)
 		}
@@ -471,7 +484,25 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 				s.dispatchWingEvent("wing.config", w)
 			}
 
-		case ws.TypePTYStarted, ws.TypePTYOutput, ws.TypePTYExited, ws.TypePasskeyChallenge, ws.TypePTYPreview, ws.TypePTYBrowserOpen, ws.TypePTYMigrated, ws.TypePTYFallback:
+		case ws.TypeWingProjects:
+			// Only a nudge: dashboards re-fetch projects over the tunnel
+			ev := WingEvent{Type: ws.TypeWingProjects, WingID: wing.WingID}
+			payload, _ := json.Marshal(map[string]any{
+				"type":    ws.TypeWingProjects,
+				"wing_id": wing.WingID,
+				"user_id": wing.UserID,
+				"org_id":  wing.OrgID,
+			})
+			if s.IsEdge() && s.Config.LoginNodeAddr != "" {
+				go s.forwardPayloadToLogin(payload)
+			} else {
+				s.Wings.notifyWing(wing.UserID, wing.OrgID, ev)
+				if s.IsLogin() && s.WingMap != nil {
+					go s.broadcastToEdges(payload)
+				}
+			}
+
+		case ws.TypePTYStarted, ws.TypePTYOutput, ws.TypePTYExited, ws.TypePasskeyChallenge, ws.TypePTYPreview, ws.TypePTYBrowserOpen, ws.TypePTYMigrated, ws.TypePTYFallback, ws.TypePTYAttention:
 			// Extract session_id and forward to browser
 			var partial struct {
 				SessionID string `json:"session_id"`
@@ -496,6 +527,7 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 				Type:      "session.attention",
 				WingID:    wing.WingID,
 				SessionID: attn.SessionID,
+				Kind:      attn.Kind,
 			}
 			if s.IsEdge() && s.Config.LoginNodeAddr != "" {
 				payload, _ := json.Marshal(map[string]any{
@@ -504,6 +536,7 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 					"user_id":    wing.UserID,
 					"org_id":     wing.OrgID,
 					"session_id": attn.SessionID,
+					"kind":       attn.Kind,
 				})
 				go s.forwardPayloadToLogin(payload)
 			} else {
@@ -515,18 +548,49 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 						"user_id":    wing.UserID,
 						"org_id":     wing.OrgID,
 						"session_id": attn.SessionID,
+						"kind":       attn.Kind,
 					})
 					go s.broadcastToEdges(payload)
 				}
 			}
+			if !s.IsEdge() {
+				s.emitWebhook("session.attention", wing.UserID, wing.OrgID, map[string]any{
+					"wing_id":    wing.WingID,
+					"session_id": attn.SessionID,
+					"kind":       attn.Kind,
+				})
+			}
 			// Push notification via ntfy (nonce-deduped)
 			if attn.Nonce != "" {
 				clickURL := ntfyClickURL(attn.SessionID)
 				s.trySendNtfy(attn.Nonce, wing.UserID, func(c *ntfy.Client) {
-					c.SendAttention(attn.SessionID, attn.Agent, attn.CWD, clickURL)
+					c.SendAttention(attn.SessionID, attn.Agent, attn.CWD, attn.Kind, clickURL)
 				})
 			}
 
+		case ws.TypeAuditHead:
+			var head ws.AuditHead
+			json.Unmarshal(data, &head)
+			if head.SessionID == "" || head.Head == "" {
+				continue
+			}
+			if head.Key != wing.SigningKey || !auditHeadSigned(head) {
+				log.Printf("audit head: wing %s session %s: rejected, not signed by the wing's registered key", wing.WingID, head.SessionID)
+				continue
+			}
+			if s.IsEdge() && s.Config.LoginNodeAddr != "" {
+				payload, _ := json.Marshal(map[string]any{
+					"type":       "audit.head",
+					"wing_id":    wing.WingID,
+					"user_id":    wing.UserID,
+					"session_id": head.SessionID,
+					"audit_head": head,
+				})
+				go s.forwardPayloadToLogin(payload)
+			} else {
+				s.saveAuditHead(wing.WingID, wing.UserID, head)
+			}
+
 		}
 	}
 }
@@ -534,30 +598,66 @@ func (s *Server) handleWingWS(w http.ResponseWriter, r *http.Request) {
 // validateOrgViaLogin proxies org membership validation to the login node.
 // Returns (resolvedOrgID, ok). The resolved ID is always a UUID.
 func (s *Server) validateOrgViaLogin(ctx context.Context, orgRef, userID string) (string, bool) {
-	client := &http.Client{Timeout: 3 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, "GET",
-		s.Config.LoginNodeAddr+"/internal/org-check/"+orgRef+"/"+userID, nil)
+	body, err := s.login.Get(ctx, "/internal/org-check/"+orgRef+"/"+userID)
 	if err != nil {
 		return "", false
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", false
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", false
-	}
 	var result struct {
 		OK    bool   `json:"ok"`
 		OrgID string `json:"org_id"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(body, &result); err != nil {
 		return "", false
 	}
 	return result.OrgID, result.OK
 }
 
+// userSuspended reports whether an admin has suspended userID, or an org
+// they belong to requires SSO their account isn't from: from the store, or
+// on edges from the login node. Wing JWTs outlive both, so everything that
+// accepts one checks this.
+func (s *Server) userSuspended(ctx context.Context, userID string) bool {
+	if s.Store != nil {
+		return s.Store.IsUserSuspended(userID) || s.ssoLockedID(userID)
+	}
+	if s.login == nil {
+		return false
+	}
+	return s.userSuspendedViaLogin(ctx, userID)
+}
+
+// userSuspendedViaLogin asks the login node whether userID is suspended,
+// caching the answer for suspendedCacheTTL. Unknown users are refused. If
+// no replica answers the user is let in: an outage mustn't take every wing
+// offline, and the kick sent at suspension time already dropped the user's
+// connected wings.
+func (s *Server) userSuspendedViaLogin(ctx context.Context, userID string) bool {
+	if s.sessionCache != nil {
+		if suspended, ok := s.sessionCache.Suspended(userID); ok {
+			return suspended
+		}
+	}
+	body, err := s.login.Get(ctx, "/internal/user-status/"+userID)
+	if errors.Is(err, errLoginUnavailable) {
+		log.Printf("user status for %s: %v", userID, err)
+		return false
+	}
+	suspended := true
+	if err == nil {
+		var result struct {
+			Suspended bool `json:"suspended"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return false
+		}
+		suspended = result.Suspended
+	}
+	if s.sessionCache != nil {
+		s.sessionCache.SetSuspended(userID, suspended)
+	}
+	return suspended
+}
+
 // dispatchWingEvent routes a wing lifecycle event through the correct path.
 // Edge: register/deregister with login wingMap, forward event to login.
 // Login/single-node: update wingMap, deliver locally, broadcast to edges.
@@ -578,6 +678,15 @@ func (s *Server) dispatchWingEvent(eventType string, wing *ConnectedWing) {
 		s.PTY.NotifyWingOffline(wing.WingID)
 	}
 
+	switch eventType {
+	case "wing.online":
+		s.emitWingWebhook(eventType, wing.WingID, wing.UserID, wing.OrgID)
+	case "wing.offline":
+		if s.findAnyWingByWingID(wing.WingID) == nil {
+			s.emitWingWebhook(eventType, wing.WingID, wing.UserID, wing.OrgID)
+		}
+	}
+
 	// Login or single-node: update wingMap
 	if s.WingMap != nil {
 		switch eventType {
@@ -595,6 +704,10 @@ func (s *Server) dispatchWingEvent(eventType string, wing *ConnectedWing) {
 				s.WingMap.Deregister(wing.WingID)
 			}
 		}
+		// Login replica: peers learn about this wing now, not at the next sync
+		if s.login != nil && (eventType == "wing.online" || eventType == "wing.config") {
+			go s.registerWingWithLogin(wing)
+		}
 	}
 
 	// Resolve owner display name for dashboard
@@ -656,35 +769,124 @@ func (s *Server) forwardWingEvent(eventType string, wing *ConnectedWing) {
 	s.forwardPayloadToLogin(payload)
 }
 
-// forwardPayloadToLogin POSTs a raw JSON payload to the login node's wing-event endpoint.
-func (s *Server) forwardPayloadToLogin(payload []byte) {
-	client := &http.Client{Timeout: 3 * time.Second}
-	req, _ := http.NewRequest("POST", s.Config.LoginNodeAddr+"/internal/wing-event", bytes.NewReader(payload))
-	if req == nil {
+// auditHeadSigned reports whether head's signature is valid for head.Key.
+func auditHeadSigned(head ws.AuditHead) bool {
+	return (&egg.ChainHead{
+		SessionID: head.SessionID,
+		Seq:       head.Seq,
+		Head:      head.Head,
+		SignedAt:  head.SignedAt,
+		Sig:       head.Sig,
+		Key:       head.Key,
+		Sealed:    head.Sealed,
+	}).Verify()
+}
+
+// saveAuditHead records a wing's signed audit chain head as a notarization
+// witness. The node the wing is connected to has already checked the head
+// against the wing's registered signing key; here the signature is checked
+// again and a head signed by a different key than the one already notarized
+// for the session is refused.
+func (s *Server) saveAuditHead(wingID, userID string, head ws.AuditHead) {
+	if s.Store == nil {
+		return
+	}
+	if head.Key == "" || !auditHeadSigned(head) {
+		log.Printf("audit head: wing %s session %s: bad signature", wingID, head.SessionID)
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
+	prev, err := s.Store.GetAuditHead(wingID, head.SessionID)
 	if err != nil {
+		log.Printf("audit head: %v", err)
+		return
+	}
+	if prev != nil && prev.SignerKey != head.Key {
+		log.Printf("audit head: wing %s session %s: signer key changed from %s to %s, refused",
+			wingID, head.SessionID, keyFingerprint(prev.SignerKey), keyFingerprint(head.Key))
 		return
 	}
-	resp.Body.Close()
+	err = s.Store.SaveAuditHead(AuditHead{
+		WingID:    wingID,
+		SessionID: head.SessionID,
+		UserID:    userID,
+		Seq:       head.Seq,
+		Head:      head.Head,
+		SignedAt:  head.SignedAt,
+		Sig:       head.Sig,
+		SignerKey: head.Key,
+		Sealed:    head.Sealed,
+	})
+	if err != nil {
+		log.Printf("audit head: %v", err)
+	}
+}
+
+// forwardPayloadToLogin POSTs a raw JSON payload to the login node's
+// wing-event endpoint, queueing it if no login replica is reachable.
+func (s *Server) forwardPayloadToLogin(payload []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.login.Post(ctx, "/internal/wing-event", payload); errors.Is(err, errLoginUnavailable) {
+		s.login.Queue("/internal/wing-event", payload, false)
+	}
+}
+
+// tunnelRequestTimeout is how long a wing has to start answering a tunnel
+// request before the relay forgets it. Browsers give up sooner.
+const tunnelRequestTimeout = 2 * time.Minute
+
+// tunnelRoute is a tunnel request forwarded to a wing. It is kept until the
+// wing's final response, the wing disconnecting, or tunnelRequestTimeout
+// passing without any response.
+type tunnelRoute struct {
+	browser  *websocket.Conn
+	wingConn string    // ConnectedWing.ID the request went to
+	sent     time.Time // zero once the wing answered, and for long-lived streams
 }
 
 // forwardTunnelToBrowser routes an encrypted tunnel response from wing to the originating browser.
 func (s *Server) forwardTunnelToBrowser(requestID string, data []byte, done bool) {
+	var waited time.Duration
 	s.tunnelMu.Lock()
-	bc := s.tunnelRequests[requestID]
+	route := s.tunnelRequests[requestID]
+	if route != nil && !route.sent.IsZero() {
+		waited = time.Since(route.sent)
+		route.sent = time.Time{}
+	}
 	if done {
 		delete(s.tunnelRequests, requestID)
 	}
 	s.tunnelMu.Unlock()
-	if bc == nil {
+	if waited > 0 {
+		s.metrics.tunnelDuration.observe(waited.Seconds())
+	}
+	if route == nil || route.browser == nil {
 		return
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	bc.Write(ctx, websocket.MessageText, data)
+	route.browser.Write(ctx, websocket.MessageText, data)
+}
+
+// expireTunnelRequest forgets a tunnel request the wing never answered.
+func (s *Server) expireTunnelRequest(requestID string, route *tunnelRoute) {
+	s.tunnelMu.Lock()
+	defer s.tunnelMu.Unlock()
+	if s.tunnelRequests[requestID] == route && !route.sent.IsZero() {
+		delete(s.tunnelRequests, requestID)
+	}
+}
+
+// dropTunnelRequests forgets the tunnel requests sent to a wing connection
+// that has gone away; none of them will be answered.
+func (s *Server) dropTunnelRequests(wingConn string) {
+	s.tunnelMu.Lock()
+	defer s.tunnelMu.Unlock()
+	for id, route := range s.tunnelRequests {
+		if route.wingConn == wingConn {
+			delete(s.tunnelRequests, id)
+		}
+	}
 }
 
 // trySendNtfy deduplicates by nonce and sends an ntfy push notification.
@@ -0,0 +1,14 @@
+-- 006_session_search.sql: Full-text index over egg session recordings and chat
+CREATE VIRTUAL TABLE IF NOT EXISTS session_text USING fts5(
+    body,
+    session_id UNINDEXED,
+    source UNINDEXED,
+    at_ms UNINDEXED,
+    tokenize = 'unicode61'
+);
+
+CREATE TABLE IF NOT EXISTS session_index (
+    session_id TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    indexed_at DATETIME DEFAULT (datetime('now'))
+);
@@ -0,0 +1,18 @@
+-- 007_tool_calls.sql: Wing-level ledger of privileged tool invocations
+CREATE TABLE IF NOT EXISTS tool_calls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL,
+    user TEXT NOT NULL DEFAULT '',
+    tool TEXT NOT NULL,
+    args TEXT NOT NULL DEFAULT '[]',
+    exit_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    output_bytes INTEGER NOT NULL DEFAULT 0,
+    output_hash TEXT NOT NULL DEFAULT '',
+    started_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tool_calls_started ON tool_calls(started_at);
+CREATE INDEX IF NOT EXISTS idx_tool_calls_session ON tool_calls(session_id);
+CREATE INDEX IF NOT EXISTS idx_tool_calls_tool ON tool_calls(tool, started_at);
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Search sources: where a piece of indexed session text came from.
+const (
+	SearchSourceOutput = "output" // de-ANSI'd PTY output from audit.pty.gz
+	SearchSourceInput  = "input"  // typed lines from audit.log
+	SearchSourceChat   = "chat"   // agent chat transcript (chat.jsonl.gz)
+)
+
+// Snippet highlight markers. Callers replace them with their own styling
+// (ANSI bold in the terminal, <mark> in the browser).
+const (
+	SnippetOpen  = "\x02"
+	SnippetClose = "\x03"
+)
+
+// SearchDoc is one indexed chunk of session text.
+type SearchDoc struct {
+	Source string
+	AtMS   int64 // offset from session start, -1 if unknown
+	Body   string
+}
+
+// SearchHit is one match returned by SearchSessions.
+type SearchHit struct {
+	SessionID string `json:"session_id"`
+	Source    string `json:"source"`
+	AtMS      int64  `json:"at_ms"`
+	Snippet   string `json:"snippet"`
+}
+
+// SessionFingerprint returns the fingerprint a session was last indexed
+// with, or "" if it has not been indexed.
+func (s *Store) SessionFingerprint(sessionID string) (string, error) {
+	var fp string
+	err := s.db.QueryRow("SELECT fingerprint FROM session_index WHERE session_id = ?", sessionID).Scan(&fp)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("session fingerprint: %w", err)
+	}
+	return fp, nil
+}
+
+// IndexSession replaces a session's indexed text with docs and records the
+// fingerprint of the files they were built from.
+func (s *Store) IndexSession(sessionID, fingerprint string, docs []SearchDoc) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("index session: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM session_text WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("clear session text: %w", err)
+	}
+	stmt, err := tx.Prepare("INSERT INTO session_text (body, session_id, source, at_ms) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("prepare session text: %w", err)
+	}
+	defer stmt.Close()
+	for _, d := range docs {
+		if strings.TrimSpace(d.Body) == "" {
+			continue
+		}
+		if _, err := stmt.Exec(d.Body, sessionID, d.Source, d.AtMS); err != nil {
+			return fmt.Errorf("insert session text: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO session_index (session_id, fingerprint) VALUES (?, ?)
+		ON CONFLICT(session_id) DO UPDATE SET fingerprint = excluded.fingerprint, indexed_at = datetime('now')`,
+		sessionID, fingerprint); err != nil {
+		return fmt.Errorf("record session index: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ForgetSession drops a session from the search index.
+func (s *Store) ForgetSession(sessionID string) error {
+	if _, err := s.db.Exec("DELETE FROM session_text WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("forget session text: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM session_index WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("forget session index: %w", err)
+	}
+	return nil
+}
+
+// IndexedSessions returns the IDs of all indexed sessions.
+func (s *Store) IndexedSessions() ([]string, error) {
+	rows, err := s.db.Query("SELECT session_id FROM session_index")
+	if err != nil {
+		return nil, fmt.Errorf("indexed sessions: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan indexed session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SearchSessions runs a full-text query over indexed session text, best
+// matches first. The query is plain words (all must match); a trailing *
+// on a word matches prefixes. Snippets mark matches with SnippetOpen and
+// SnippetClose. offset skips that many of the best matches, for paging.
+func (s *Store) SearchSessions(query string, limit, offset int) ([]*SearchHit, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	rows, err := s.db.Query(`SELECT session_id, source, at_ms,
+		snippet(session_text, 0, ?, ?, '…', 16)
+		FROM session_text WHERE session_text MATCH ?
+		ORDER BY rank LIMIT ? OFFSET ?`, SnippetOpen, SnippetClose, match, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("search sessions: %w", err)
+	}
+	defer rows.Close()
+	var hits []*SearchHit
+	for rows.Next() {
+		h := &SearchHit{}
+		if err := rows.Scan(&h.SessionID, &h.Source, &h.AtMS, &h.Snippet); err != nil {
+			return nil, fmt.Errorf("scan search hit: %w", err)
+		}
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// ftsQuery turns user input into an FTS5 MATCH expression. Every word is
+// quoted so punctuation (rm -rf, foo.go, "quotes") is matched literally
+// instead of being parsed as query syntax.
+func ftsQuery(q string) string {
+	var terms []string
+	for _, w := range strings.Fields(q) {
+		prefix := strings.HasSuffix(w, "*")
+		w = strings.TrimRight(w, "*")
+		if w == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(w, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
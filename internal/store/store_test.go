@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -371,6 +372,107 @@ func TestAppendAndListLog(t *testing.T) {
 	}
 }
 
+// --- Session search ---
+
+func TestSearchSessions(t *testing.T) {
+	s := openTestStore(t)
+
+	if err := s.IndexSession("s1", "fp1", []SearchDoc{
+		{Source: SearchSourceOutput, AtMS: 1200, Body: "running database migrations for users table"},
+		{Source: SearchSourceInput, AtMS: 900, Body: "make migrate"},
+	}); err != nil {
+		t.Fatalf("index s1: %v", err)
+	}
+	if err := s.IndexSession("s2", "fp2", []SearchDoc{
+		{Source: SearchSourceChat, AtMS: -1, Body: "rm -rf build && go test ./..."},
+	}); err != nil {
+		t.Fatalf("index s2: %v", err)
+	}
+
+	hits, err := s.SearchSessions("database migrations", 10, 0)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].SessionID != "s1" || hits[0].AtMS != 1200 {
+		t.Fatalf("hits = %+v", hits)
+	}
+	if !strings.Contains(hits[0].Snippet, SnippetOpen+"database"+SnippetClose) {
+		t.Errorf("snippet not highlighted: %q", hits[0].Snippet)
+	}
+
+	// Prefix match spans sources
+	if hits, _ := s.SearchSessions("migrat*", 10, 0); len(hits) != 2 {
+		t.Errorf("prefix hits = %d, want 2", len(hits))
+	}
+	// Pages pick up where the last one stopped
+	first, _ := s.SearchSessions("migrat*", 1, 0)
+	second, _ := s.SearchSessions("migrat*", 1, 1)
+	if len(first) != 1 || len(second) != 1 || first[0].Source == second[0].Source {
+		t.Errorf("pages = %+v, %+v", first, second)
+	}
+	// Punctuation is literal, not query syntax
+	hits, err = s.SearchSessions(`rm -rf "build"`, 10, 0)
+	if err != nil || len(hits) != 1 || hits[0].SessionID != "s2" {
+		t.Fatalf("literal search = %+v, %v", hits, err)
+	}
+
+	// Reindexing replaces text
+	if err := s.IndexSession("s1", "fp1b", []SearchDoc{{Source: SearchSourceOutput, Body: "nothing here"}}); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	if hits, _ := s.SearchSessions("database", 10, 0); len(hits) != 0 {
+		t.Errorf("stale hits after reindex: %+v", hits)
+	}
+	if fp, _ := s.SessionFingerprint("s1"); fp != "fp1b" {
+		t.Errorf("fingerprint = %q", fp)
+	}
+
+	if err := s.ForgetSession("s2"); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if ids, _ := s.IndexedSessions(); len(ids) != 1 || ids[0] != "s1" {
+		t.Errorf("indexed = %v", ids)
+	}
+}
+
+// --- Tool calls ---
+
+func TestToolCalls(t *testing.T) {
+	s := openTestStore(t)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := []*ToolCall{
+		{SessionID: "s1", User: "a@example.com", Tool: "deploy", Args: []string{"prod", "x y"}, DurationMS: 1200, OutputBytes: 42, OutputHash: "abcd", StartedAt: base},
+		{SessionID: "s1", Tool: "deploy", Error: "rate limit: 1 calls per minute", StartedAt: base.Add(500 * time.Millisecond)},
+		{SessionID: "s2", Tool: "psql", ExitCode: 2, StartedAt: base.Add(time.Minute)},
+	}
+	for _, c := range calls {
+		if err := s.AppendToolCall(c); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	all, err := s.ListToolCalls(ToolCallFilter{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(all) != 3 || all[0].Tool != "psql" || all[2].Args[1] != "x y" || !all[2].StartedAt.Equal(base) {
+		t.Fatalf("all = %+v", all)
+	}
+	// Sub-second timestamps still sort newest first
+	if all[1].Error == "" {
+		t.Errorf("order = %+v", all)
+	}
+	if got, _ := s.ListToolCalls(ToolCallFilter{SessionID: "s1", Tool: "deploy"}); len(got) != 2 {
+		t.Errorf("session+tool = %d, want 2", len(got))
+	}
+	if got, _ := s.ListToolCalls(ToolCallFilter{Since: base.Add(time.Second)}); len(got) != 1 || got[0].SessionID != "s2" {
+		t.Errorf("since = %+v", got)
+	}
+	if got, _ := s.ListToolCalls(ToolCallFilter{Limit: 1}); len(got) != 1 {
+		t.Errorf("limit = %d, want 1", len(got))
+	}
+}
+
 // --- Migration idempotency ---
 
 func TestMigrationIdempotent(t *testing.T) {
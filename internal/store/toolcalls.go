@@ -0,0 +1,98 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// toolCallTimeFmt is fixed-width so started_at sorts as text.
+const toolCallTimeFmt = "2006-01-02T15:04:05.000000Z"
+
+// ToolCall is one privileged tool invocation in the wing's tool ledger.
+// Output is not stored, only its size and a hash to match against a copy.
+type ToolCall struct {
+	ID          int64     `json:"id"`
+	SessionID   string    `json:"session_id"`
+	User        string    `json:"user,omitempty"`
+	Tool        string    `json:"tool"`
+	Args        []string  `json:"args"`
+	ExitCode    int       `json:"exit_code"`
+	Error       string    `json:"error,omitempty"` // set when the call never ran (rejected, denied, rate limited)
+	DurationMS  int64     `json:"duration_ms"`
+	OutputBytes int64     `json:"output_bytes"`
+	OutputHash  string    `json:"output_hash,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// ToolCallFilter narrows ListToolCalls. Zero fields match everything.
+type ToolCallFilter struct {
+	SessionID string
+	Tool      string
+	Since     time.Time
+	Limit     int // default 100
+}
+
+// AppendToolCall records one tool invocation.
+func (s *Store) AppendToolCall(c *ToolCall) error {
+	args, _ := json.Marshal(c.Args)
+	if c.Args == nil {
+		args = []byte("[]")
+	}
+	res, err := s.db.Exec(`INSERT INTO tool_calls (session_id, user, tool, args, exit_code, error, duration_ms, output_bytes, output_hash, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.SessionID, c.User, c.Tool, string(args), c.ExitCode, c.Error, c.DurationMS, c.OutputBytes, c.OutputHash,
+		c.StartedAt.UTC().Format(toolCallTimeFmt))
+	if err != nil {
+		return fmt.Errorf("append tool call: %w", err)
+	}
+	c.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// ListToolCalls returns matching tool calls, newest first.
+func (s *Store) ListToolCalls(f ToolCallFilter) ([]*ToolCall, error) {
+	var where []string
+	var args []any
+	if f.SessionID != "" {
+		where = append(where, "session_id = ?")
+		args = append(args, f.SessionID)
+	}
+	if f.Tool != "" {
+		where = append(where, "tool = ?")
+		args = append(args, f.Tool)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "started_at >= ?")
+		args = append(args, f.Since.UTC().Format(toolCallTimeFmt))
+	}
+	q := `SELECT id, session_id, user, tool, args, exit_code, error, duration_ms, output_bytes, output_hash, started_at FROM tool_calls`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	q += " ORDER BY started_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list tool calls: %w", err)
+	}
+	defer rows.Close()
+	var calls []*ToolCall
+	for rows.Next() {
+		c := &ToolCall{}
+		var argsJSON, startedAt string
+		if err := rows.Scan(&c.ID, &c.SessionID, &c.User, &c.Tool, &argsJSON, &c.ExitCode, &c.Error, &c.DurationMS, &c.OutputBytes, &c.OutputHash, &startedAt); err != nil {
+			return nil, fmt.Errorf("scan tool call: %w", err)
+		}
+		json.Unmarshal([]byte(argsJSON), &c.Args)
+		c.StartedAt, _ = time.Parse(toolCallTimeFmt, startedAt)
+		calls = append(calls, c)
+	}
+	return calls, rows.Err()
+}
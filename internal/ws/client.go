@@ -48,7 +48,8 @@ type Client struct {
 	OrgSlug    string
 	RootDir    string
 
-	PublicKey string // X25519 identity key (base64)
+	PublicKey  string // X25519 identity key (base64)
+	SigningKey string // Ed25519 key derived from the identity key (base64); signs audit chain heads
 
 	Locked       bool
 	AllowedCount int
@@ -70,6 +71,8 @@ type Client struct {
 
 	conn *websocket.Conn
 	mu   sync.Mutex
+
+	projectsMu sync.Mutex // guards Projects once Run has started
 }
 
 // Run connects to the relay and processes tasks until ctx is cancelled.
@@ -163,6 +166,7 @@ func (c *Client) connectAndServe(ctx context.Context) (connected bool, err error
 		OrgSlug:     c.OrgSlug,
 		RootDir:      c.RootDir,
 		PublicKey:    c.PublicKey,
+		SigningKey:   c.SigningKey,
 		Locked:       c.Locked,
 		AllowedCount: c.AllowedCount,
 	}
@@ -318,11 +322,33 @@ func (c *Client) SendConfig(ctx context.Context) error {
 	})
 }
 
+// ProjectList returns the wing's current projects.
+func (c *Client) ProjectList() []WingProject {
+	c.projectsMu.Lock()
+	defer c.projectsMu.Unlock()
+	return c.Projects
+}
+
+// SetProjects replaces the wing's projects and tells the relay they changed
+// so dashboards re-fetch them.
+func (c *Client) SetProjects(ctx context.Context, projects []WingProject) error {
+	c.projectsMu.Lock()
+	c.Projects = projects
+	c.projectsMu.Unlock()
+	return c.writeJSON(ctx, WingProjects{Type: TypeWingProjects, WingID: c.WingID})
+}
+
 // SendAttention sends a session.attention message to the relay (bell detected).
 func (c *Client) SendAttention(ctx context.Context, sessionID string) error {
 	return c.writeJSON(ctx, SessionAttention{Type: TypeSessionAttention, SessionID: sessionID})
 }
 
+// SendAuditHead sends a signed audit chain head to the relay for notarization.
+func (c *Client) SendAuditHead(ctx context.Context, head AuditHead) error {
+	head.Type = TypeAuditHead
+	return c.writeJSON(ctx, head)
+}
+
 // HasPTYSession returns true if a goroutine is already handling this session.
 func (c *Client) HasPTYSession(sessionID string) bool {
 	c.ptySessionsMu.Lock()
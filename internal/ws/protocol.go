@@ -23,6 +23,9 @@ const (
 	TypePTYMigrated     = "pty.migrated"      // wing → relay → browser (P2P migration complete)
 	TypePTYFallback     = "pty.fallback"      // wing → relay → browser (P2P failed, back to relay)
 
+	TypePTYAttention      = "pty.attention"       // wing → relay → browser (encrypted prompt details)
+	TypePTYAttentionReply = "pty.attention_reply" // browser → relay → wing (answer a prompt)
+
 	// Encrypted tunnel (browser ↔ wing, relay is opaque forwarder)
 	TypeTunnelRequest  = "tunnel.req"    // browser → relay → wing
 	TypeTunnelResponse = "tunnel.res"    // wing → relay → browser
@@ -31,6 +34,9 @@ const (
 	// Wing → Relay (session attention broadcast)
 	TypeSessionAttention = "session.attention"
 
+	// Wing → Relay (signed audit chain head, notarization witness)
+	TypeAuditHead = "audit.head"
+
 	// Relay → Browser/Wing (bandwidth)
 	TypeBandwidthExceeded = "bandwidth.exceeded"
 
@@ -44,6 +50,9 @@ const (
 	// Wing → Relay (config change)
 	TypeWingConfig = "wing.config"
 
+	// Wing → Relay (project list changed; the list itself stays in the tunnel)
+	TypeWingProjects = "wing.projects"
+
 	// Relay → Wing (control)
 	TypeRegistered   = "registered"
 	TypeRelayRestart = "relay.restart" // relay → all: server shutting down, reconnect
@@ -59,6 +68,13 @@ type WingConfig struct {
 	AllowedCount int    `json:"allowed_count"`
 }
 
+// WingProjects is sent by the wing when its discovered projects change. It
+// carries no paths: browsers re-fetch the list through the E2E tunnel.
+type WingProjects struct {
+	Type   string `json:"type"`
+	WingID string `json:"wing_id"`
+}
+
 // Envelope wraps every WebSocket message with a type field for routing.
 type Envelope struct {
 	Type string `json:"type"`
@@ -86,6 +102,7 @@ type WingRegister struct {
 	OrgSlug     string        `json:"org_slug,omitempty"`
 	RootDir     string        `json:"root_dir,omitempty"`
 	PublicKey    string        `json:"public_key,omitempty"`    // wing's X25519 identity key (base64)
+	SigningKey   string        `json:"signing_key,omitempty"`   // wing's Ed25519 audit signing key (base64)
 	Locked       bool          `json:"locked"`                 // explicit locked flag from wing.yaml
 	AllowedCount int           `json:"allowed_count,omitempty"` // number of allowed keys
 }
@@ -242,6 +259,7 @@ type TunnelRequest struct {
 	SenderOrgRole   string   `json:"sender_org_role,omitempty"`   // relay-injected: "owner", "admin", "member", ""
 	SenderEmail     string   `json:"sender_email,omitempty"`      // relay-injected user email
 	SenderPasskeys  []string `json:"sender_passkeys,omitempty"`   // relay-injected: base64 raw P-256 public keys
+	LongLived       bool     `json:"long_lived,omitempty"`        // browser-set: a stream with no deadline (forwarded WebSocket)
 }
 
 // TunnelResponse is an encrypted response from wing to browser via relay.
@@ -259,15 +277,49 @@ type TunnelStream struct {
 	Done      bool   `json:"done"`
 }
 
-// SessionAttention is sent by the wing when a session needs user attention (bell detected).
+// SessionAttention is sent by the wing when a session needs user attention.
 type SessionAttention struct {
 	Type      string `json:"type"`
 	SessionID string `json:"session_id"`
 	Agent     string `json:"agent,omitempty"`
 	CWD       string `json:"cwd,omitempty"`
+	Kind      string `json:"kind,omitempty"`  // "permission", "question", "done", "error"
 	Nonce     string `json:"nonce,omitempty"` // dedup key: same nonce = same attention episode
 }
 
+// AuditHead is a signed audit chain head the wing hands to the relay as a
+// notarization witness. It carries hashes only, never session content.
+type AuditHead struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Seq       int    `json:"seq"`
+	Head      string `json:"head"`      // hex SHA-256 chain head
+	SignedAt  int64  `json:"signed_at"` // unix seconds
+	Sig       string `json:"sig"`       // base64 Ed25519 signature
+	Key       string `json:"key"`       // base64 Ed25519 public key
+	Sealed    bool   `json:"sealed,omitempty"`
+}
+
+// PTYAttention carries the E2E-encrypted details of a prompt the wing detected
+// on screen (kind, detail, nonce) so the browser can offer a quick reply.
+type PTYAttention struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Data      string `json:"data"` // base64(AES-GCM encrypted JSON)
+}
+
+// PTYAttentionReply answers a prompt announced by pty.attention. The wing maps
+// the choice to the agent's keystroke itself; the browser never sends raw keys.
+type PTYAttentionReply struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Data      string `json:"data"`                 // base64(AES-GCM encrypted JSON {"nonce","choice"})
+	AuthToken string `json:"auth_token,omitempty"` // passkey auth token (required for passkey users)
+
+	SenderUserID string `json:"sender_user_id,omitempty"` // relay-injected
+	SenderEmail  string `json:"sender_email,omitempty"`   // relay-injected
+}
+
 // SessionInfo describes one active session on a wing (used in tunnel sessions.list responses).
 type SessionInfo struct {
 	SessionID      string `json:"session_id"`
@@ -275,6 +327,7 @@ type SessionInfo struct {
 	CWD            string `json:"cwd,omitempty"`
 	EggConfig      string `json:"egg_config,omitempty"` // YAML config snapshot
 	NeedsAttention bool   `json:"needs_attention,omitempty"`
+	AttentionKind  string `json:"attention_kind,omitempty"` // why attention is needed (see SessionAttention.Kind)
 	Audit          bool   `json:"audit,omitempty"` // true if session has audit recording
 	Chat           bool   `json:"chat,omitempty"`  // true if session has chat history
 	UserID         string `json:"user_id,omitempty"`
@@ -288,6 +341,39 @@ type DirEntry struct {
 	Path  string `json:"path"`
 }
 
+// FileInfo describes a file on the wing (file.stat, file.read).
+type FileInfo struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Mode    uint32 `json:"mode"`     // permission bits
+	ModTime int64  `json:"mod_time"` // unix seconds
+	IsDir   bool   `json:"is_dir,omitempty"`
+	Binary  bool   `json:"binary,omitempty"` // sniffed from the first bytes; regular files only
+}
+
+// Limits for the file.* tunnel requests.
+const (
+	FileReadLimit     = 1 << 20   // file.read / file.write: whole text files
+	FileTransferLimit = 100 << 20 // file.download / file.upload: any file
+	FileDownloadChunk = 64 << 10
+	// FileUploadChunk keeps an encrypted file.upload request under the
+	// relay's 32KB limit on browser frames.
+	FileUploadChunk = 12 << 10
+)
+
+// Limits for port forwarding (tunnel.http, tunnel.ws). Request bodies and
+// browser-to-wing WebSocket frames have the same browser frame limit as
+// file uploads.
+const (
+	ForwardBodyLimit     = FileUploadChunk
+	ForwardResponseChunk = FileDownloadChunk
+	ForwardResponseLimit = FileTransferLimit
+	// ForwardFrameLimit caps wing-to-browser WebSocket frames so a chunk
+	// stays under the relay's 512KB limit on wing frames.
+	ForwardFrameLimit = 128 << 10
+)
+
 // PTYWriteFunc sends a message back to the relay over the wing's WebSocket.
 type PTYWriteFunc func(v any) error
 
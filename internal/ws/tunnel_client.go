@@ -2,6 +2,7 @@ package ws
 
 import (
 	"context"
+	"crypto/cipher"
 	"crypto/ecdh"
 	crand "crypto/rand"
 	"encoding/base64"
@@ -27,46 +28,68 @@ type WingInfo struct {
 	PublicKey string `json:"public_key"`
 }
 
-// DiscoverWing finds a wing's public key from the relay API.
+// DiscoverWing finds a wing's public key from the relay API. Relays that
+// predate /api/v1 answer 404 there, so it falls back to /api/app/wings.
 func (tc *TunnelClient) DiscoverWing(ctx context.Context, wingID string) (*WingInfo, error) {
-	url := strings.TrimRight(tc.RelayURL, "/") + "/api/app/wings"
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	wings, status, err := tc.listWings(ctx, "/api/v1/wings")
+	if status == http.StatusNotFound {
+		wings, status, err = tc.listWings(ctx, "/api/app/wings")
+	}
 	if err != nil {
 		return nil, err
 	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("wings API: status %d", status)
+	}
+
+	for _, w := range wings {
+		if w.WingID == wingID {
+			return &w, nil
+		}
+	}
+	return nil, fmt.Errorf("wing %s not found", wingID)
+}
+
+// listWings fetches the wing list at path. Wings are only decoded on 200.
+func (tc *TunnelClient) listWings(ctx context.Context, path string) ([]WingInfo, int, error) {
+	url := strings.TrimRight(tc.RelayURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
 	req.Header.Set("Authorization", "Bearer "+tc.DeviceToken)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("wings API: %w", err)
+		return nil, 0, fmt.Errorf("wings API: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("wings API: status %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, nil
 	}
-
 	var wings []WingInfo
 	if err := json.NewDecoder(resp.Body).Decode(&wings); err != nil {
-		return nil, fmt.Errorf("decode wings: %w", err)
+		return nil, resp.StatusCode, fmt.Errorf("decode wings: %w", err)
 	}
+	return wings, resp.StatusCode, nil
+}
 
-	for _, w := range wings {
-		if w.WingID == wingID {
-			return &w, nil
-		}
-	}
-	return nil, fmt.Errorf("wing %s not found", wingID)
+// TunnelConn is an open relay WebSocket for sending tunnel requests to one
+// wing. Requests on a conn are sent one at a time.
+type TunnelConn struct {
+	conn      *websocket.Conn
+	gcm       cipher.AEAD
+	wingID    string
+	senderPub string
 }
 
-// Stream opens a WebSocket to the relay, sends an encrypted tunnel request,
-// and collects streaming response chunks. The onChunk callback receives decrypted
-// JSON payloads. The stream ends when a chunk with done:true is received.
-func (tc *TunnelClient) Stream(ctx context.Context, wingID, wingPubKey string, inner any, onChunk func([]byte) error) error {
+// Dial opens a WebSocket to the relay for tunnel requests to wingID.
+func (tc *TunnelClient) Dial(ctx context.Context, wingID, wingPubKey string) (*TunnelConn, error) {
 	// Derive shared tunnel key
 	gcm, err := auth.DeriveSharedKey(tc.PrivKey, wingPubKey, "wt-tunnel")
 	if err != nil {
-		return fmt.Errorf("derive key: %w", err)
+		return nil, fmt.Errorf("derive key: %w", err)
 	}
 
 	// Build relay WebSocket URL
@@ -78,38 +101,73 @@ func (tc *TunnelClient) Stream(ctx context.Context, wingID, wingPubKey string, i
 		HTTPHeader: headers,
 	})
 	if err != nil {
-		return fmt.Errorf("websocket dial: %w", err)
+		return nil, fmt.Errorf("websocket dial: %w", err)
+	}
+	conn.SetReadLimit(512 * 1024) // 512KB — match relay limit
+	return &TunnelConn{
+		conn:      conn,
+		gcm:       gcm,
+		wingID:    wingID,
+		senderPub: base64.StdEncoding.EncodeToString(tc.PrivKey.PublicKey().Bytes()),
+	}, nil
+}
+
+// Close closes the relay WebSocket.
+func (c *TunnelConn) Close() error {
+	return c.conn.Close(websocket.StatusNormalClosure, "done")
+}
+
+// Stream opens a WebSocket to the relay, sends an encrypted tunnel request,
+// and collects streaming response chunks. The onChunk callback receives decrypted
+// JSON payloads. The stream ends when a chunk with done:true is received.
+func (tc *TunnelClient) Stream(ctx context.Context, wingID, wingPubKey string, inner any, onChunk func([]byte) error) error {
+	c, err := tc.Dial(ctx, wingID, wingPubKey)
+	if err != nil {
+		return err
 	}
-	defer conn.Close(websocket.StatusNormalClosure, "done")
+	defer c.Close()
+	return c.Stream(ctx, inner, onChunk)
+}
+
+// Request sends a tunnel request expecting a single response and decodes it
+// into out.
+func (c *TunnelConn) Request(ctx context.Context, inner, out any) error {
+	return c.Stream(ctx, inner, func(data []byte) error {
+		return json.Unmarshal(data, out)
+	})
+}
 
+// Stream sends an encrypted tunnel request on the conn and passes decrypted
+// response chunks to onChunk until the wing's single response or a chunk
+// marked done.
+func (c *TunnelConn) Stream(ctx context.Context, inner any, onChunk func([]byte) error) error {
 	// Encrypt inner message
 	innerJSON, err := json.Marshal(inner)
 	if err != nil {
 		return fmt.Errorf("marshal inner: %w", err)
 	}
-	payload, err := auth.Encrypt(gcm, innerJSON)
+	payload, err := auth.Encrypt(c.gcm, innerJSON)
 	if err != nil {
 		return fmt.Errorf("encrypt: %w", err)
 	}
 
 	// Send tunnel.req
-	senderPub := base64.StdEncoding.EncodeToString(tc.PrivKey.PublicKey().Bytes())
 	requestID := generateRequestID()
 	tunnelReq := TunnelRequest{
 		Type:      TypeTunnelRequest,
-		WingID:    wingID,
+		WingID:    c.wingID,
 		RequestID: requestID,
-		SenderPub: senderPub,
+		SenderPub: c.senderPub,
 		Payload:   payload,
 	}
 	reqJSON, _ := json.Marshal(tunnelReq)
-	if err := conn.Write(ctx, websocket.MessageText, reqJSON); err != nil {
+	if err := c.conn.Write(ctx, websocket.MessageText, reqJSON); err != nil {
 		return fmt.Errorf("send tunnel.req: %w", err)
 	}
 
 	// Read responses
 	for {
-		_, data, err := conn.Read(ctx)
+		_, data, err := c.conn.Read(ctx)
 		if err != nil {
 			return fmt.Errorf("read: %w", err)
 		}
@@ -127,7 +185,7 @@ func (tc *TunnelClient) Stream(ctx context.Context, wingID, wingPubKey string, i
 			continue
 		}
 
-		decrypted, err := auth.Decrypt(gcm, msg.Payload)
+		decrypted, err := auth.Decrypt(c.gcm, msg.Payload)
 		if err != nil {
 			return fmt.Errorf("decrypt response: %w", err)
 		}
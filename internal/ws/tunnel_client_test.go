@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/coder/websocket"
@@ -143,3 +144,31 @@ func TestTunnelClient_Stream(t *testing.T) {
 		}
 	}
 }
+
+func TestTunnelClient_DiscoverWingOldRelay(t *testing.T) {
+	// A relay without /api/v1 still lists wings at /api/app/wings
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/app/wings", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer dev-tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]WingInfo{{WingID: "wing-a", PublicKey: "pk-a"}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tc := &TunnelClient{RelayURL: srv.URL, DeviceToken: "dev-tok"}
+	wing, err := tc.DiscoverWing(context.Background(), "wing-a")
+	if err != nil || wing.PublicKey != "pk-a" {
+		t.Fatalf("discover = %+v, %v", wing, err)
+	}
+
+	// Other errors from /api/v1 are not retried on the old endpoint
+	mux.HandleFunc("GET /api/v1/wings", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	if _, err := tc.DiscoverWing(context.Background(), "wing-a"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("err = %v, want status 503", err)
+	}
+}
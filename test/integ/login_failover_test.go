@@ -0,0 +1,316 @@
+//go:build e2e
+
+package integ
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/ehrlich-b/wingthing/internal/relay"
+	"github.com/ehrlich-b/wingthing/internal/ws"
+)
+
+// clusterNode is one in-process relay node listening on loopback: ts is its
+// public listener, internal its mTLS listener for node-to-node calls.
+type clusterNode struct {
+	srv      *relay.Server
+	ts       *httptest.Server
+	internal *httptest.Server
+	store    *relay.RelayStore
+	cancel   context.CancelFunc
+}
+
+// listen reserves a loopback address so nodes can be configured with each
+// other's URLs before any of them starts.
+func listen(t *testing.T) (net.Listener, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, "https://" + l.Addr().String()
+}
+
+// startNode serves srv publicly and on the internal listener l, with the
+// node's credentials already issued.
+func startNode(t *testing.T, l net.Listener, srv *relay.Server, store *relay.RelayStore, auth *relay.NodeAuth) *clusterNode {
+	t.Helper()
+	if err := auth.Renew(context.Background()); err != nil {
+		t.Fatalf("node credentials for %s: %v", auth.Identity(), err)
+	}
+	srv.SetNodeAuth(auth)
+	ts := httptest.NewServer(srv)
+	internal := httptest.NewUnstartedServer(srv)
+	internal.Listener.Close()
+	internal.Listener = l
+	internal.TLS = auth.ServerTLSConfig()
+	internal.StartTLS()
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &clusterNode{srv: srv, ts: ts, internal: internal, store: store, cancel: cancel}
+	t.Cleanup(n.kill)
+	if pool := srv.LoginPool(); pool != nil {
+		pool.Start(ctx, 100*time.Millisecond)
+		srv.StartEdgeSync(ctx, 100*time.Millisecond)
+	}
+	if srv.IsLogin() && store.Dialect() == "postgres" {
+		if err := srv.StartLeaderElection(ctx, 100*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return n
+}
+
+// kill stops the node without a graceful handover: its store goes away
+// before the lease can be released, so the survivors wait out the TTL.
+func (n *clusterNode) kill() {
+	n.ts.CloseClientConnections()
+	n.ts.Close()
+	n.internal.CloseClientConnections()
+	n.internal.Close()
+	if n.store != nil {
+		n.store.Close()
+	}
+	n.cancel()
+}
+
+// startLogin runs a login node on the store at dsn, a SQLite path or a
+// PostgreSQL URL. Only PostgreSQL replicas elect a leader; on SQLite every
+// login node leads.
+func startLogin(t *testing.T, l net.Listener, dsn, machineID, peer string, key *ecdsa.PrivateKey) *clusterNode {
+	t.Helper()
+	store, err := relay.OpenRelay(dsn)
+	if err != nil {
+		t.Fatalf("open relay store: %v", err)
+	}
+	srv := relay.NewServer(store, relay.ServerConfig{NodeRole: "login", FlyMachineID: machineID, LoginNodeAddr: peer})
+	srv.SetJWTKey(key)
+	srv.WingMap = relay.NewWingMap()
+	ca, err := relay.LoadOrCreateNodeCA(store)
+	if err != nil {
+		t.Fatalf("node ca: %v", err)
+	}
+	srv.SetNodeCA(ca)
+	return startNode(t, l, srv, store, relay.NewLocalNodeAuth(ca, relay.NodeIdentity{MachineID: machineID, Role: "login"}))
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+}
+
+// postgresSchema creates a throwaway schema in the database at
+// WT_TEST_POSTGRES_DSN and returns a DSN that uses it, skipping the test
+// when no database is configured.
+func postgresSchema(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("WT_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("WT_TEST_POSTGRES_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("wt_integ_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		db.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestLoginLeaderFailoverMidSession(t *testing.T) {
+	dsn := postgresSchema(t)
+	key, _, err := relay.GenerateECKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lA, addrA := listen(t)
+	lB, addrB := listen(t)
+	lE, _ := listen(t)
+
+	loginA := startLogin(t, lA, dsn, "login-a", addrB, key)
+	waitFor(t, "login-a to lead", loginA.srv.IsLeader)
+	loginB := startLogin(t, lB, dsn, "login-b", addrA, key)
+
+	edgeSrv := relay.NewServer(nil, relay.ServerConfig{NodeRole: "edge", FlyMachineID: "edge-1", LoginNodeAddr: addrA + "," + addrB})
+	edgeSrv.SetJWTKey(key)
+	edgeSrv.SetSessionCache(relay.NewSessionCache())
+	edgeSrv.SetLoginProxy(relay.NewLoginProxy(edgeSrv.LoginPool()))
+	edgeAuth := relay.NewEnrollingNodeAuth(key, relay.NodeIdentity{MachineID: "edge-1", Role: "edge"}, edgeSrv.LoginPool())
+	edge := startNode(t, lE, edgeSrv, nil, edgeAuth)
+	waitFor(t, "edge to find the leader", func() bool { return edgeSrv.LoginPool().Leader() == addrA })
+
+	// Internal endpoints only answer node identities on the mTLS listener
+	for _, url := range []string{loginA.ts.URL + "/internal/status", edge.ts.URL + "/internal/wings-debug"} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET %s from outside the cluster: %d, want 403", url, resp.StatusCode)
+		}
+	}
+
+	// A user with a browser session on an edge, driving a wing on that edge
+	store := loginA.store
+	userID := "user-failover"
+	store.CreateUser(userID)
+	store.CreateSession("sess-before", userID, time.Now().Add(time.Hour))
+	wingToken, _, err := relay.IssueWingJWT(key, userID, "", "wing-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wingConn := connectWing(t, wsURL(edge.ts), wingToken, "wing-1", []string{"claude"})
+	defer wingConn.CloseNow()
+	browser := dialWithSession(t, edge.ts, "sess-before", "wing-1")
+	defer browser.CloseNow()
+	sess := startSession(t, browser, wingConn, "claude", "wing-1")
+
+	for _, n := range []*clusterNode{loginA, loginB} {
+		waitFor(t, "wing-1 in every replica's map", func() bool {
+			loc, ok := n.srv.WingMap.Locate("wing-1")
+			return ok && loc.MachineID == "edge-1"
+		})
+	}
+
+	// Kill the leader mid-session
+	loginA.kill()
+
+	// The session keeps flowing: the edge routes it without the login node
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wsjson.Write(ctx, browser, ws.PTYInput{Type: ws.TypePTYInput, SessionID: sess, Data: base64.StdEncoding.EncodeToString([]byte("still here"))})
+	var input ws.PTYInput
+	if err := wsjson.Read(ctx, wingConn, &input); err != nil {
+		t.Fatalf("wing read pty.input after failover: %v", err)
+	}
+	if data, _ := base64.StdEncoding.DecodeString(input.Data); string(data) != "still here" {
+		t.Errorf("input = %q", data)
+	}
+
+	// The survivor takes the lease and the edge follows it
+	waitFor(t, "login-b to lead", loginB.srv.IsLeader)
+	waitFor(t, "edge to fail over", func() bool { return edgeSrv.LoginPool().Leader() == addrB })
+
+	// Sessions issued after the failover validate through login-b, both for
+	// proxied API calls and for sockets the edge authenticates itself
+	loginB.store.CreateSession("sess-after", userID, time.Now().Add(time.Hour))
+	req, _ := http.NewRequest("GET", edge.ts.URL+"/api/app/me", nil)
+	req.AddCookie(&http.Cookie{Name: "wt_session", Value: "sess-after"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /api/app/me through edge: %d", resp.StatusCode)
+	}
+	browser2 := dialWithSession(t, edge.ts, "sess-after", "wing-1")
+	defer browser2.CloseNow()
+
+	// Wings that connect now register with the new leader
+	wing2Token, _, _ := relay.IssueWingJWT(key, userID, "", "wing-2")
+	wing2 := connectWing(t, wsURL(edge.ts), wing2Token, "wing-2", []string{"claude"})
+	defer wing2.CloseNow()
+	if loc, ok := loginB.srv.WingMap.Locate("wing-2"); !ok || loc.MachineID != "edge-1" {
+		t.Errorf("wing-2 location on login-b = %+v %v", loc, ok)
+	}
+	if loc, ok := loginB.srv.WingMap.Locate("wing-1"); !ok || loc.MachineID != "edge-1" {
+		t.Errorf("wing-1 location on login-b = %+v %v", loc, ok)
+	}
+}
+
+// dialWithSession opens a browser PTY socket authenticated by a session cookie.
+func dialWithSession(t *testing.T, ts *httptest.Server, session, wingID string) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h := http.Header{}
+	h.Set("Cookie", "wt_session="+session)
+	conn, _, err := websocket.Dial(ctx, wsURL(ts)+"/ws/pty?wing_id="+wingID, &websocket.DialOptions{HTTPHeader: h})
+	if err != nil {
+		t.Fatalf("dial browser ws with session %s: %v", session, err)
+	}
+	return conn
+}
+
+func TestEdgeWingAuditedOnce(t *testing.T) {
+	key, _, err := relay.GenerateECKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "relay.db")
+	lA, addrA := listen(t)
+	lB, addrB := listen(t)
+	lE, _ := listen(t)
+	loginA := startLogin(t, lA, dbPath, "login-a", addrB, key)
+	waitFor(t, "login-a to lead", loginA.srv.IsLeader)
+	loginB := startLogin(t, lB, dbPath, "login-b", addrA, key)
+
+	edgeSrv := relay.NewServer(nil, relay.ServerConfig{NodeRole: "edge", FlyMachineID: "edge-1", LoginNodeAddr: addrA + "," + addrB})
+	edgeSrv.SetJWTKey(key)
+	edgeSrv.SetSessionCache(relay.NewSessionCache())
+	edgeAuth := relay.NewEnrollingNodeAuth(key, relay.NodeIdentity{MachineID: "edge-1", Role: "edge"}, edgeSrv.LoginPool())
+	edge := startNode(t, lE, edgeSrv, nil, edgeAuth)
+
+	userID := "user-audit"
+	loginA.store.CreateUser(userID)
+	wingToken, _, _ := relay.IssueWingJWT(key, userID, "", "wing-a")
+	wing := connectWing(t, wsURL(edge.ts), wingToken, "wing-a", []string{"claude"})
+	defer wing.CloseNow()
+
+	// A config change re-registers the wing with every replica
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wsjson.Write(ctx, wing, ws.WingConfig{Type: ws.TypeWingConfig, WingID: "wing-a", Locked: true})
+	waitFor(t, "config to reach login-b", func() bool {
+		loc, ok := loginB.srv.WingMap.Locate("wing-a")
+		return ok && loc.Locked
+	})
+	time.Sleep(300 * time.Millisecond) // a few sync rounds
+
+	entries, err := loginA.store.ListAudit(relay.AuditFilter{UserID: userID, Events: []string{"wing_registered"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("wing_registered entries = %d, want 1", len(entries))
+	}
+	if d := entries[0].Detail; d == nil || !strings.Contains(*d, "node=edge-1") {
+		t.Errorf("detail = %v, want the edge's machine ID", d)
+	}
+}
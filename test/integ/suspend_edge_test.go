@@ -0,0 +1,90 @@
+//go:build e2e
+
+package integ
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/ehrlich-b/wingthing/internal/relay"
+)
+
+func TestSuspendedUserRefusedOnEdge(t *testing.T) {
+	key, _, err := relay.GenerateECKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lA, addrA := listen(t)
+	lE, _ := listen(t)
+	login := startLogin(t, lA, filepath.Join(t.TempDir(), "relay.db"), "login-a", "", key)
+	waitFor(t, "login-a to lead", login.srv.IsLeader)
+
+	edgeSrv := relay.NewServer(nil, relay.ServerConfig{NodeRole: "edge", FlyMachineID: "edge-1", LoginNodeAddr: addrA})
+	edgeSrv.SetJWTKey(key)
+	edgeSrv.SetSessionCache(relay.NewSessionCache())
+	edgeSrv.SetLoginProxy(relay.NewLoginProxy(edgeSrv.LoginPool()))
+	edgeAuth := relay.NewEnrollingNodeAuth(key, relay.NodeIdentity{MachineID: "edge-1", Role: "edge"}, edgeSrv.LoginPool())
+	edge := startNode(t, lE, edgeSrv, nil, edgeAuth)
+
+	userID := "user-suspended"
+	login.store.CreateUser(userID)
+	login.store.CreateSession("sess-s", userID, time.Now().Add(time.Hour))
+	req, _ := http.NewRequest("POST", login.ts.URL+"/api/v1/tokens", strings.NewReader(`{"name":"ci","scopes":["sessions:write"]}`))
+	req.AddCookie(&http.Cookie{Name: "wt_session", Value: "sess-s"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if created.Token == "" {
+		t.Fatalf("create token: %d", resp.StatusCode)
+	}
+	wingToken, _, err := relay.IssueWingJWT(key, userID, "", "wing-s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The edge lets an active user's wing through. (Not the suspended
+	// user's: the edge would cache that user as active for a minute.)
+	login.store.CreateUser("user-active")
+	activeToken, _, err := relay.IssueWingJWT(key, "user-active", "", "wing-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wing := connectWing(t, wsURL(edge.ts), activeToken, "wing-a", []string{"claude"})
+	wing.CloseNow()
+
+	login.store.SetUserSuspended(userID, true)
+
+	dial := func(path string) int {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, resp, err := websocket.Dial(ctx, wsURL(edge.ts)+path, nil)
+		if err == nil {
+			conn.CloseNow()
+			return http.StatusSwitchingProtocols
+		}
+		if resp == nil {
+			t.Fatalf("dial %s: %v", path, err)
+		}
+		return resp.StatusCode
+	}
+	if code := dial("/ws/pty?wing_id=wing-s&token=" + created.Token); code != http.StatusUnauthorized {
+		t.Errorf("suspended user's token on edge: %d, want 401", code)
+	}
+	if code := dial("/ws/wing?token=" + wingToken); code != http.StatusForbidden {
+		t.Errorf("suspended user's wing on edge: %d, want 403", code)
+	}
+}
@@ -0,0 +1,146 @@
+// Port-forward service worker. Runs on the relay's preview host (never the
+// app's origin) and answers every request the previewed app makes by handing
+// it to the bridge frame (/__wt/frame.html), which passes it to the
+// dashboard, which sends it through the E2E tunnel as tunnel.http.
+
+self.addEventListener('install', function () { self.skipWaiting(); });
+self.addEventListener('activate', function (event) { event.waitUntil(self.clients.claim()); });
+
+var NULL_BODY = { 101: true, 103: true, 204: true, 205: true, 304: true };
+var BODY_LIMIT = 12 * 1024; // ws.ForwardBodyLimit
+
+function b64ToBytes(b64) {
+    var bin = atob(b64);
+    var out = new Uint8Array(bin.length);
+    for (var i = 0; i < bin.length; i++) out[i] = bin.charCodeAt(i);
+    return out;
+}
+
+function bytesToB64(bytes) {
+    var s = '';
+    for (var i = 0; i < bytes.length; i += 0x8000) {
+        s += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000));
+    }
+    return btoa(s);
+}
+
+// The bridge frame to route through. The dashboard gives every preview its
+// own origin, so the only bridge this worker can see is its own preview's.
+function findBridge() {
+    return self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then(function (list) {
+        for (var i = 0; i < list.length; i++) {
+            if (new URL(list[i].url).pathname === '/__wt/frame.html') return list[i];
+        }
+        return null;
+    });
+}
+
+function errorResponse(status, msg) {
+    return new Response(msg + '\n', { status: status, headers: { 'Content-Type': 'text/plain; charset=utf-8' } });
+}
+
+// injectShim puts the WebSocket shim first in an HTML document, after the
+// doctype so the page doesn't drop into quirks mode.
+function injectShim(html) {
+    var tag = '<script src="/__wt/ws.js"></script>';
+    var m = html.match(/<head[^>]*>/i) || html.match(/<!doctype[^>]*>/i);
+    if (!m) return tag + html;
+    var at = m.index + m[0].length;
+    return html.slice(0, at) + tag + html.slice(at);
+}
+
+function forward(request) {
+    return Promise.all([findBridge(), request.arrayBuffer()]).then(function (res) {
+        var bridge = res[0];
+        var body = new Uint8Array(res[1]);
+        if (!bridge) return errorResponse(502, 'preview not connected — reopen it from the dashboard');
+        if (body.length > BODY_LIMIT) return errorResponse(413, 'request body too large for the tunnel');
+
+        var url = new URL(request.url);
+        var headers = {};
+        request.headers.forEach(function (v, k) { headers[k] = v; });
+        var req = {
+            method: request.method,
+            path: url.pathname + url.search,
+            headers: headers,
+            data: body.length ? bytesToB64(body) : ''
+        };
+
+        var isDoc = request.mode === 'navigate' || request.destination === 'iframe' || request.destination === 'document';
+        return new Promise(function (resolve) {
+            var ch = new MessageChannel();
+            var controller = null;
+            var htmlParts = null;
+            var status = 0;
+            var respHeaders = null;
+
+            function finishHTML() {
+                var total = 0;
+                htmlParts.forEach(function (p) { total += p.length; });
+                var all = new Uint8Array(total);
+                var off = 0;
+                htmlParts.forEach(function (p) { all.set(p, off); off += p.length; });
+                var text = injectShim(new TextDecoder().decode(all));
+                resolve(new Response(text, { status: status, headers: respHeaders }));
+            }
+
+            ch.port1.onmessage = function (e) {
+                var c = e.data;
+                if (c.error) {
+                    if (controller) controller.error(new Error(c.error));
+                    else resolve(errorResponse(502, c.error));
+                    ch.port1.close();
+                    return;
+                }
+                if (c.status) {
+                    status = c.status;
+                    respHeaders = new Headers(c.headers || {});
+                    var type = respHeaders.get('content-type') || '';
+                    if (NULL_BODY[status]) {
+                        resolve(new Response(null, { status: status, headers: respHeaders }));
+                        return;
+                    }
+                    if (isDoc && type.indexOf('text/html') === 0) {
+                        htmlParts = [];
+                        return;
+                    }
+                    resolve(new Response(new ReadableStream({
+                        start: function (ctl) { controller = ctl; }
+                    }), { status: status, headers: respHeaders }));
+                    return;
+                }
+                if (c.data) {
+                    var bytes = b64ToBytes(c.data);
+                    if (htmlParts) htmlParts.push(bytes);
+                    else if (controller) controller.enqueue(bytes);
+                }
+                if (c.done) {
+                    if (htmlParts) finishHTML();
+                    else if (controller) controller.close();
+                    ch.port1.close();
+                }
+            };
+            bridge.postMessage({ type: 'wt-http', req: req }, [ch.port2]);
+        });
+    });
+}
+
+self.addEventListener('fetch', function (event) {
+    var url = new URL(event.request.url);
+    if (url.origin !== self.location.origin || url.pathname.indexOf('/__wt/') === 0) return;
+    event.respondWith(forward(event.request));
+});
+
+// WebSockets opened by the shim: hand the port to the bridge.
+self.addEventListener('message', function (event) {
+    var msg = event.data;
+    if (!msg || msg.type !== 'wt-ws' || !event.ports[0]) return;
+    var port = event.ports[0];
+    event.waitUntil(findBridge().then(function (bridge) {
+        if (!bridge) {
+            port.postMessage({ close: true, code: 1011, reason: 'preview not connected' });
+            return;
+        }
+        bridge.postMessage({ type: 'wt-ws', path: msg.path, protocols: msg.protocols }, [port]);
+    }));
+});
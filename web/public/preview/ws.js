@@ -0,0 +1,125 @@
+// WebSocket shim for previewed apps. The service worker can't intercept
+// WebSockets, so sockets to the app's own origin (or localhost) go through
+// the worker to the bridge frame, and on through the E2E tunnel as
+// tunnel.ws. Anything else uses the browser's WebSocket.
+(function () {
+    var Native = window.WebSocket;
+    if (!Native || !navigator.serviceWorker) return;
+
+    function local(url) {
+        return url.host === location.host || url.hostname === 'localhost' ||
+            url.hostname === '127.0.0.1' || url.hostname === '[::1]';
+    }
+
+    function bytesToB64(bytes) {
+        var s = '';
+        for (var i = 0; i < bytes.length; i += 0x8000) {
+            s += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000));
+        }
+        return btoa(s);
+    }
+
+    function b64ToBytes(b64) {
+        var bin = atob(b64);
+        var out = new Uint8Array(bin.length);
+        for (var i = 0; i < bin.length; i++) out[i] = bin.charCodeAt(i);
+        return out;
+    }
+
+    function TunnelSocket(url, protocols) {
+        var self = this;
+        var target = new URL(url, location.href);
+        this.url = target.href;
+        this.readyState = 0;
+        this.protocol = '';
+        this.extensions = '';
+        this.bufferedAmount = 0;
+        this.binaryType = 'blob';
+        this.onopen = this.onmessage = this.onclose = this.onerror = null;
+        this._listeners = {};
+        if (typeof protocols === 'string') protocols = [protocols];
+
+        var ch = new MessageChannel();
+        this._port = ch.port1;
+        ch.port1.onmessage = function (e) {
+            var c = e.data;
+            if (c.open) {
+                self.readyState = 1;
+                self.protocol = c.protocol || '';
+                self._emit('open', new Event('open'));
+            } else if (c.data !== undefined) {
+                var data = c.data;
+                if (c.binary) {
+                    var bytes = b64ToBytes(data);
+                    data = self.binaryType === 'arraybuffer' ? bytes.buffer : new Blob([bytes]);
+                } else {
+                    data = new TextDecoder().decode(b64ToBytes(data));
+                }
+                self._emit('message', new MessageEvent('message', { data: data }));
+            } else if (c.close) {
+                if (self.readyState === 3) return;
+                var wasOpen = self.readyState === 1;
+                self.readyState = 3;
+                if (!wasOpen || c.code === 1006) self._emit('error', new Event('error'));
+                self._emit('close', new CloseEvent('close', { code: c.code || 1006, reason: c.reason || '', wasClean: c.code === 1000 }));
+                ch.port1.close();
+            }
+        };
+        var ready = navigator.serviceWorker.controller ? Promise.resolve() : navigator.serviceWorker.ready;
+        ready.then(function () {
+            navigator.serviceWorker.controller.postMessage({
+                type: 'wt-ws',
+                path: target.pathname + target.search,
+                protocols: protocols || []
+            }, [ch.port2]);
+        });
+    }
+
+    TunnelSocket.prototype._emit = function (type, ev) {
+        var h = this['on' + type];
+        if (h) h.call(this, ev);
+        (this._listeners[type] || []).slice().forEach(function (fn) { fn.call(this, ev); }, this);
+    };
+    TunnelSocket.prototype.addEventListener = function (type, fn) {
+        (this._listeners[type] = this._listeners[type] || []).push(fn);
+    };
+    TunnelSocket.prototype.removeEventListener = function (type, fn) {
+        var l = this._listeners[type] || [];
+        var i = l.indexOf(fn);
+        if (i >= 0) l.splice(i, 1);
+    };
+    TunnelSocket.prototype.send = function (data) {
+        if (this.readyState !== 1) throw new DOMException('WebSocket is not open', 'InvalidStateError');
+        var port = this._port;
+        if (typeof data === 'string') {
+            port.postMessage({ send: bytesToB64(new TextEncoder().encode(data)), binary: false });
+        } else if (data instanceof Blob) {
+            data.arrayBuffer().then(function (buf) {
+                port.postMessage({ send: bytesToB64(new Uint8Array(buf)), binary: true });
+            });
+        } else {
+            var bytes = ArrayBuffer.isView(data) ? new Uint8Array(data.buffer, data.byteOffset, data.byteLength) : new Uint8Array(data);
+            port.postMessage({ send: bytesToB64(bytes), binary: true });
+        }
+    };
+    TunnelSocket.prototype.close = function () {
+        if (this.readyState >= 2) return;
+        this.readyState = 2;
+        this._port.postMessage({ close: true });
+    };
+    TunnelSocket.CONNECTING = TunnelSocket.prototype.CONNECTING = 0;
+    TunnelSocket.OPEN = TunnelSocket.prototype.OPEN = 1;
+    TunnelSocket.CLOSING = TunnelSocket.prototype.CLOSING = 2;
+    TunnelSocket.CLOSED = TunnelSocket.prototype.CLOSED = 3;
+
+    window.WebSocket = function (url, protocols) {
+        var target = new URL(url, location.href);
+        if (local(target)) return new TunnelSocket(target.href, protocols);
+        return protocols === undefined ? new Native(url) : new Native(url, protocols);
+    };
+    window.WebSocket.prototype = Native.prototype;
+    window.WebSocket.CONNECTING = 0;
+    window.WebSocket.OPEN = 1;
+    window.WebSocket.CLOSING = 2;
+    window.WebSocket.CLOSED = 3;
+})();
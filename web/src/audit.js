@@ -13,7 +13,9 @@ export function closeAuditOverlay() {
     if (overlay._playTimer) { clearTimeout(overlay._playTimer); overlay._playTimer = null; }
 }
 
-export function openAuditReplay(wingId, sessionId) {
+// openAuditReplay streams a session recording into the replay overlay.
+// startAt (seconds, optional) fast-forwards to that point once loaded.
+export function openAuditReplay(wingId, sessionId, startAt) {
     var overlay = document.getElementById('audit-overlay');
     var termEl = document.getElementById('audit-terminal');
     var playBtn = document.getElementById('audit-play');
@@ -69,6 +71,7 @@ export function openAuditReplay(wingId, sessionId) {
             playBtn.textContent = 'play';
             playBtn.disabled = false;
             downloadBtn.style.display = '';
+            if (startAt > 0) seekTo(startAt);
         } else {
             playBtn.textContent = 'no data';
             playBtn.disabled = true;
@@ -85,14 +88,17 @@ export function openAuditReplay(wingId, sessionId) {
         return new TextDecoder().decode(bytes);
     }
 
-    function playFrame() {
-        if (frameIndex >= frames.length) {
-            playing = false;
-            playBtn.textContent = 'replay';
-            return;
+    // seekTo renders every frame up to t without delay and leaves playback paused there.
+    function seekTo(t) {
+        initTerm();
+        while (frameIndex < frames.length && frames[frameIndex][0] <= t) {
+            applyFrame(frames[frameIndex]);
+            frameIndex++;
         }
-        if (!auditTerm) initTerm();
-        var f = frames[frameIndex];
+        timeEl.textContent = formatAuditTime(t);
+    }
+
+    function applyFrame(f) {
         if (f[1] === 'r') {
             var parts = f[2].split('x');
             var newCols = parseInt(parts[0]);
@@ -105,6 +111,17 @@ export function openAuditReplay(wingId, sessionId) {
             try { data = decodeBase64UTF8(data); } catch (e) {}
             auditTerm.write(data);
         }
+    }
+
+    function playFrame() {
+        if (frameIndex >= frames.length) {
+            playing = false;
+            playBtn.textContent = 'replay';
+            return;
+        }
+        if (!auditTerm) initTerm();
+        var f = frames[frameIndex];
+        applyFrame(f);
         frameIndex++;
         var elapsed = f[0];
         timeEl.textContent = formatAuditTime(elapsed);
@@ -124,8 +124,11 @@ function applyWingEvent(ev) {
         });
         tunnelCloseWing(ev.wing_id);
         // DON'T clear sessions — wing might reconnect momentarily
+    } else if (ev.type === 'wing.projects') {
+        // Projects stay E2E: re-probe the wing over the tunnel below
+        if (!S.wingsData.some(function(w) { return w.wing_id === ev.wing_id; })) return;
     } else if (ev.type === 'session.attention' && ev.session_id) {
-        setNotification(ev.session_id);
+        setNotification(ev.session_id, ev.kind);
         if (isCanvasActive()) canvasSetAttention(ev.session_id);
         renderSidebar();
         return;
@@ -149,7 +152,7 @@ function applyWingEvent(ev) {
 
     // Probe in background, re-render when done
     var evWing = S.wingsData.find(function(w) { return w.wing_id === ev.wing_id; });
-    if ((ev.type === 'wing.online' || ev.type === 'wing.config') && evWing && evWing.public_key) {
+    if ((ev.type === 'wing.online' || ev.type === 'wing.config' || ev.type === 'wing.projects') && evWing && evWing.public_key) {
         probeWing(evWing).then(function() {
             saveWingCache();
             rebuildAgentLists();
@@ -193,7 +193,7 @@ export async function fetchWingSessions(wingId) {
     try {
         var result = await sendTunnelRequest(wingId, { type: 'sessions.list' }, { skipPasskey: true });
         return (result.sessions || []).map(function(s) {
-            return { id: s.session_id, wing_id: (S.wingsData.find(function(w) { return w.wing_id === wingId; }) || {}).wing_id || '', agent: s.agent, cwd: s.cwd, status: 'detached', needs_attention: s.needs_attention, audit: s.audit, user_id: s.user_id, email: s.email };
+            return { id: s.session_id, wing_id: (S.wingsData.find(function(w) { return w.wing_id === wingId; }) || {}).wing_id || '', agent: s.agent, cwd: s.cwd, status: 'detached', needs_attention: s.needs_attention, attention_kind: s.attention_kind, audit: s.audit, user_id: s.user_id, email: s.email };
         });
     } catch (e) { return null; }
 }
@@ -209,6 +209,7 @@ export function mergeWingSessions(wingId, remoteSessions) {
                 s.agent = remote.agent;
                 s.cwd = remote.cwd;
                 s.needs_attention = remote.needs_attention;
+                s.attention_kind = remote.attention_kind;
                 s.audit = remote.audit;
                 s.user_id = remote.user_id;
                 s.email = remote.email;
@@ -351,7 +352,7 @@ async function _loadHomeInner() {
 
     S.sessionsData.forEach(function(s) {
         if (s.needs_attention && s.id !== S.ptySessionId) {
-            setNotification(s.id);
+            setNotification(s.id, s.attention_kind);
         } else if (!s.needs_attention && S.sessionNotifications[s.id]) {
             clearNotification(s.id);
         }
@@ -316,9 +316,10 @@ async function init() {
     connectAppWS();
 
     // Deep links
-    var hashMatch = location.hash.match(/^#s\/(.+)$/);
+    var hashMatch = location.hash.match(/^#s\/([^/]+)(?:\/(approve|deny))?$/);
     if (hashMatch) {
         var deepSessionId = hashMatch[1];
+        S.pendingReplyChoice = hashMatch[2] || null;
         history.replaceState({ view: 'terminal', sessionId: deepSessionId }, '', '#s/' + deepSessionId);
         showTerminal();
         attachPTY(deepSessionId);
@@ -338,8 +339,9 @@ async function init() {
 
 // Hash change (user pastes #s/ URL while page is already loaded)
 window.addEventListener('hashchange', function() {
-    var hashMatch = location.hash.match(/^#s\/(.+)$/);
+    var hashMatch = location.hash.match(/^#s\/([^/]+)(?:\/(approve|deny))?$/);
     if (hashMatch) {
+        S.pendingReplyChoice = hashMatch[2] || null;
         history.replaceState({ view: 'terminal', sessionId: hashMatch[1] }, '', '#s/' + hashMatch[1]);
         showTerminal();
         attachPTY(hashMatch[1]);
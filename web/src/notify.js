@@ -24,7 +24,15 @@ function isViewingSession(sessionId) {
            document.visibilityState === 'visible';
 }
 
-export function setNotification(sessionId) {
+var attentionText = {
+    permission: 'An agent is asking for permission',
+    question: 'A session needs your input',
+    done: 'A session finished and is waiting',
+    error: 'A session hit an error',
+    tool: 'An agent wants to run a privileged tool'
+};
+
+export function setNotification(sessionId, kind) {
     if (!sessionId) return;
 
     // If actively viewing this session, just ack — we're already looking at it.
@@ -46,10 +54,10 @@ export function setNotification(sessionId) {
 
     if (document.hidden && 'Notification' in window) {
         if (Notification.permission === 'granted') {
-            fireOSNotification(sessionId);
+            fireOSNotification(sessionId, kind);
         } else if (Notification.permission === 'default') {
             Notification.requestPermission().then(function(p) {
-                if (p === 'granted') fireOSNotification(sessionId);
+                if (p === 'granted') fireOSNotification(sessionId, kind);
             });
         }
     }
@@ -68,8 +76,8 @@ export function setNotification(sessionId) {
     }
 }
 
-function fireOSNotification(sessionId) {
-    var n = new Notification('wingthing', { body: 'A session needs your attention' });
+function fireOSNotification(sessionId, kind) {
+    var n = new Notification('wingthing', { body: attentionText[kind] || 'A session needs your attention' });
     n.onclick = function() {
         window.focus();
         // Lazy import to avoid circular dependency (nav.js imports from notify.js)
@@ -1,5 +1,6 @@
 import { marked } from 'marked';
 import { S, DOM } from './state.js';
+import { sendTunnelRequest, sendTunnelStream } from './tunnel.js';
 
 var SPLIT_KEY = 'wt_preview_split';
 
@@ -21,8 +22,169 @@ function isOpen() {
     return DOM.previewPanel.style.display !== 'none';
 }
 
+// Port forwarding. A URL on the agent's loopback is served through the E2E
+// tunnel: the iframe loads the bridge frame from a fresh subdomain of the
+// relay's preview host (a separate origin, so the app can't reach this page's
+// keys, nor another preview's), and its service worker sends every request
+// back here over a MessagePort.
+var LOOPBACK = { 'localhost': true, '127.0.0.1': true, '[::1]': true, '0.0.0.0': true };
+var PING_INTERVAL = 30000;
+
+var forward = null; // { origin, port, path, sessionId, wingId }
+
+function loopbackTarget(raw) {
+    try {
+        var u = new URL(raw);
+        if ((u.protocol !== 'http:' && u.protocol !== 'https:') || !LOOPBACK[u.hostname]) return null;
+        var port = parseInt(u.port || (u.protocol === 'https:' ? '443' : '80'), 10);
+        return { port: port, path: (u.pathname || '/') + u.search + u.hash };
+    } catch (e) {
+        return null;
+    }
+}
+
+// previewOrigin returns a new origin for one preview: <session>-<token> under
+// the preview host, so every preview gets its own service worker and bridge.
+function previewOrigin(sessionId) {
+    var host = S.currentUser && S.currentUser.preview_host;
+    if (!host) return '';
+    var rnd = new Uint8Array(8);
+    crypto.getRandomValues(rnd);
+    var token = Array.from(rnd, function(b) { return b.toString(16).padStart(2, '0'); }).join('');
+    var label = String(sessionId).toLowerCase().replace(/[^a-z0-9]/g, '') + '-' + token;
+    return location.protocol + '//' + label + '.' + host + (location.port ? ':' + location.port : '');
+}
+
+function forwardHTTP(fw, req, port) {
+    sendTunnelStream(fw.wingId, {
+        type: 'tunnel.http',
+        session_id: fw.sessionId,
+        port: fw.port,
+        method: req.method,
+        path: req.path,
+        headers: req.headers,
+        data: req.data
+    }, function(chunk) {
+        port.postMessage(chunk);
+    }).then(function(msg) {
+        // A plain tunnel.res instead of a stream: the wing refused outright
+        // (locked, or the request never reached the session)
+        if (msg && msg.type === 'tunnel.res') port.postMessage({ error: 'wing is locked — unlock it from the dashboard', done: true });
+    }).catch(function(err) {
+        port.postMessage({ error: err.message, done: true });
+    });
+}
+
+function forwardWS(fw, msg, port) {
+    var wsId = crypto.randomUUID();
+    var seq = 0;
+    var closed = false;
+    var ping = null;
+
+    function finish(code, reason) {
+        if (closed) return;
+        closed = true;
+        clearInterval(ping);
+        port.postMessage({ close: true, code: code, reason: reason || '' });
+        port.close();
+    }
+
+    port.onmessage = function(e) {
+        var m = e.data;
+        if (closed) return;
+        var inner = { type: 'tunnel.ws.send', session_id: fw.sessionId, port: fw.port, ws_id: wsId };
+        if (m.close) {
+            inner.done = true;
+        } else {
+            inner.offset = seq++;
+            inner.data = m.send;
+            inner.binary = !!m.binary;
+        }
+        sendTunnelRequest(fw.wingId, inner).catch(function(err) {
+            if (!m.close) finish(1011, err.message);
+        });
+    };
+
+    var headers = {};
+    if (msg.protocols && msg.protocols.length) headers['Sec-WebSocket-Protocol'] = msg.protocols.join(', ');
+    sendTunnelStream(fw.wingId, {
+        type: 'tunnel.ws',
+        session_id: fw.sessionId,
+        port: fw.port,
+        path: msg.path,
+        headers: headers,
+        ws_id: wsId
+    }, function(chunk) {
+        if (chunk.error) return finish(1006, chunk.error);
+        if (chunk.open) {
+            port.postMessage({ open: true, protocol: chunk.protocol || '' });
+            ping = setInterval(function() {
+                sendTunnelRequest(fw.wingId, { type: 'tunnel.ws.send', session_id: fw.sessionId, port: fw.port, ws_id: wsId, kind: 'ping' }).catch(function() {});
+            }, PING_INTERVAL);
+        }
+        if (chunk.data !== undefined && !chunk.open) port.postMessage({ data: chunk.data, binary: !!chunk.binary });
+        if (chunk.done) finish(chunk.code || 1000, chunk.reason);
+    }, { timeout: 0 }).then(function() {
+        finish(1006, 'tunnel closed');
+    }).catch(function(err) {
+        finish(1006, err.message);
+    });
+}
+
+window.addEventListener('message', function(e) {
+    var fw = forward;
+    if (!fw || e.origin !== fw.origin || e.source !== DOM.previewIframe.contentWindow) return;
+    if (!e.data || e.data.type !== 'wt-preview-ready') return;
+    var ch = new MessageChannel();
+    ch.port1.onmessage = function(ev) {
+        var m = ev.data;
+        var port = ev.ports[0];
+        if (!port || forward !== fw) return;
+        if (m.type === 'http') forwardHTTP(fw, m.req, port);
+        else if (m.type === 'ws') forwardWS(fw, m, port);
+    };
+    e.source.postMessage({ type: 'wt-preview-bridge', path: fw.path }, fw.origin, [ch.port2]);
+});
+
+function showNote(text) {
+    DOM.previewIframe.removeAttribute('src');
+    DOM.previewIframe.setAttribute('sandbox', '');
+    DOM.previewIframe.srcdoc = '<!DOCTYPE html><html><body style="font:13px system-ui,sans-serif;color:#555;padding:16px;margin:0;background:#fff">'
+        + text.replace(/[<>&]/g, '') + '</body></html>';
+}
+
+function setForwardContent(opts, target) {
+    var origin = previewOrigin(S.ptySessionId);
+    DOM.previewUrlBar.style.display = '';
+    DOM.previewUrl.textContent = opts.url;
+    DOM.previewCopyBtn.textContent = 'copy';
+    if (!origin) {
+        forward = null;
+        DOM.previewOpenBtn.href = opts.url;
+        showNote('port forwarding needs WT_PREVIEW_HOST on the roost');
+        return;
+    }
+    forward = {
+        origin: origin,
+        port: target.port,
+        path: target.path,
+        sessionId: S.ptySessionId,
+        wingId: S.ptyWingId
+    };
+    DOM.previewOpenBtn.href = origin + target.path;
+    DOM.previewIframe.removeAttribute('srcdoc');
+    DOM.previewIframe.setAttribute('sandbox', 'allow-scripts allow-same-origin allow-forms allow-popups');
+    DOM.previewIframe.src = origin + '/__wt/frame.html';
+}
+
 function setContent(opts) {
+    forward = null;
     if (opts.mode === 'url') {
+        var target = loopbackTarget(opts.url);
+        if (target && S.ptySessionId) {
+            setForwardContent(opts, target);
+            return;
+        }
         DOM.previewIframe.removeAttribute('srcdoc');
         DOM.previewIframe.setAttribute('sandbox', 'allow-scripts allow-same-origin');
         DOM.previewIframe.src = opts.url;
@@ -84,6 +246,7 @@ export function closePreview() {
     DOM.terminalSection.classList.remove('has-preview');
     DOM.previewIframe.removeAttribute('src');
     DOM.previewIframe.removeAttribute('srcdoc');
+    forward = null;
     if (S.fitAddon) S.fitAddon.fit();
 }
 
@@ -1,5 +1,5 @@
 import { S, DOM } from './state.js';
-import { e2eDecrypt, deriveE2EKey } from './crypto.js';
+import { e2eDecrypt, e2eEncrypt, deriveE2EKey } from './crypto.js';
 import { identityPubKey } from './crypto.js';
 import { saveTermBuffer, clearTermBuffer } from './terminal.js';
 import { checkForNotification, setNotification, clearNotification } from './notify.js';
@@ -37,6 +37,64 @@ function showBrowserOpenToast(url, sessionId) {
     });
 }
 
+function escapeText(str) {
+    return String(str).replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+}
+
+// Quick reply for a permission prompt the wing found on screen, or for a
+// privileged tool call waiting on approval (kind "tool", detail is the exact
+// command line). The wing maps the choice to the agent's keystroke or releases
+// the call; we only send the prompt nonce + choice.
+function showAttentionReply(sessionId, prompt) {
+    var existing = document.getElementById('attention-reply');
+    if (existing) existing.remove();
+
+    var title = 'agent is asking for permission';
+    if (prompt.kind === 'tool') {
+        title = 'agent wants to run a privileged tool' +
+            (prompt.description ? ': ' + escapeText(prompt.description) : '');
+    }
+    var card = document.createElement('div');
+    card.id = 'attention-reply';
+    card.className = 'attention-reply';
+    card.innerHTML = '<div class="attention-reply-title">' + title + '</div>' +
+        '<pre class="attention-reply-detail">' + escapeText(prompt.detail || '') + '</pre>' +
+        '<div class="attention-reply-actions">' +
+        '<button data-choice="approve">approve</button>' +
+        '<button class="btn-sm btn-danger" data-choice="deny">deny</button>' +
+        '<button class="browser-open-dismiss">&times;</button>' +
+        '</div>';
+    document.body.appendChild(card);
+
+    // Deep link from a notification action (#s/<id>/approve) highlights, never auto-sends
+    if (S.pendingReplyChoice) {
+        var pre = card.querySelector('[data-choice="' + S.pendingReplyChoice + '"]');
+        if (pre) pre.classList.add('attention-reply-suggested');
+        S.pendingReplyChoice = null;
+    }
+
+    card.querySelector('.browser-open-dismiss').addEventListener('click', function() {
+        card.remove();
+    });
+    card.querySelectorAll('[data-choice]').forEach(function(btn) {
+        btn.addEventListener('click', function() {
+            var choice = btn.getAttribute('data-choice');
+            e2eEncrypt(JSON.stringify({ nonce: prompt.nonce, choice: choice })).then(function(data) {
+                if (!S.ptyWs || S.ptyWs.readyState !== WebSocket.OPEN) return;
+                var msg = { type: 'pty.attention_reply', session_id: sessionId, data: data };
+                if (S.ptyWingId && S.tunnelAuthTokens[S.ptyWingId]) msg.auth_token = S.tunnelAuthTokens[S.ptyWingId];
+                S.ptyWs.send(JSON.stringify(msg));
+                card.remove();
+            });
+        });
+    });
+}
+
+function clearAttentionReply() {
+    var existing = document.getElementById('attention-reply');
+    if (existing) existing.remove();
+}
+
 function sessionTitle(agent, wingId) {
     var wing = S.wingsData.find(function(w) { return w.wing_id === wingId; });
     var name = wing ? wingDisplayName(wing) : '';
@@ -364,6 +422,7 @@ function setupPTYHandlers(ws, reattach) {
                 if (S.ptySessionId && msg.session_id !== S.ptySessionId) break;
                 if (!S.ptySessionId && !msg.error) break;
                 closePreview();
+                clearAttentionReply();
                 DOM.headerTitle.textContent = '';
                 DOM.sessionCloseBtn.style.display = 'none';
                 if (msg.session_id) clearTermBuffer(msg.session_id);
@@ -409,6 +468,15 @@ function setupPTYHandlers(ws, reattach) {
                 showBrowserOpenToast(msg.url, msg.session_id);
                 break;
 
+            case 'pty.attention':
+                if (msg.session_id !== S.ptySessionId || S.spectating) break;
+                e2eDecrypt(msg.data).then(function(bytes) {
+                    showAttentionReply(msg.session_id, JSON.parse(new TextDecoder().decode(bytes)));
+                }).catch(function(err) {
+                    console.error('attention decrypt error:', err);
+                });
+                break;
+
             case 'pty.preview':
                 if (msg.session_id !== S.ptySessionId) break;
                 e2eDecrypt(msg.data).then(function(bytes) {
@@ -559,6 +627,7 @@ export function attachPTY(sessionId, _retries) {
 
 export function detachPTY() {
     if (S._resizeDispose) { S._resizeDispose.dispose(); S._resizeDispose = null; }
+    clearAttentionReply();
     if (S.ptySessionId) cleanupSession(S.ptySessionId);
     if (S.ptyWingId) cleanupPeer(S.ptyWingId);
     if (S.ptyWs) {
@@ -1,5 +1,5 @@
 import { S, DOM, TERM_THUMB_PREFIX } from './state.js';
-import { escapeHtml, wingDisplayName, shortenPath, projectName, formatRelativeTime, semverCompare, nestedRepoCount, agentIcon, agentWithIcon, dirParent, setupCopyable } from './helpers.js';
+import { escapeHtml, wingDisplayName, shortenPath, projectName, formatRelativeTime, formatAuditTime, semverCompare, nestedRepoCount, agentIcon, agentWithIcon, dirParent, setupCopyable } from './helpers.js';
 import { identityPubKey } from './crypto.js';
 import { sendTunnelRequest, tunnelCloseWing } from './tunnel.js';
 import { switchToSession } from './nav.js';
@@ -317,6 +317,32 @@ export function renderAccountPage() {
         '<div id="ac-ntfy-content"><span class="text-dim">loading...</span></div>' +
     '</div>';
 
+    // API tokens section
+    html += '<div class="ac-section">' +
+        '<div class="ac-section-header">' +
+            '<h3>api tokens</h3>' +
+            '<button class="ac-create-btn" id="ac-token-toggle" title="create token">+</button>' +
+        '</div>' +
+        '<div id="ac-token-form" class="ac-create-form ac-token-form" style="display:none;">' +
+            '<input type="text" class="ac-input" id="ac-token-name" placeholder="token name">' +
+            '<div class="ac-token-scopes">' +
+                ['wings:read', 'sessions:read', 'sessions:write', 'orgs:read', 'usage:read'].map(function(sc) {
+                    return '<label><input type="checkbox" class="ac-token-scope" value="' + sc + '"> ' + sc + '</label>';
+                }).join('') +
+            '</div>' +
+            '<select class="ac-input ac-input-select" id="ac-token-expires">' +
+                '<option value="30">30 days</option>' +
+                '<option value="90" selected>90 days</option>' +
+                '<option value="365">1 year</option>' +
+                '<option value="0">never</option>' +
+            '</select>' +
+            '<button class="btn-sm btn-accent" id="ac-token-create">create</button>' +
+        '</div>' +
+        '<div id="ac-token-error" class="ac-error" style="display:none;"></div>' +
+        '<div id="ac-token-secret" class="ac-token-secret" style="display:none;"></div>' +
+        '<div id="ac-token-list"><span class="text-dim">loading...</span></div>' +
+    '</div>';
+
     // Org section (hidden in roost mode)
     if (!S.currentUser.roost_mode) {
         html += '<div class="ac-section">' +
@@ -425,6 +451,47 @@ export function renderAccountPage() {
     }
     loadAccountPasskeys();
     loadNtfyConfig();
+    loadAccountTokens();
+
+    document.getElementById('ac-token-toggle').addEventListener('click', function() {
+        var form = document.getElementById('ac-token-form');
+        form.style.display = form.style.display === 'none' ? '' : 'none';
+    });
+    document.getElementById('ac-token-create').addEventListener('click', function() {
+        var btn = this;
+        var errEl = document.getElementById('ac-token-error');
+        var secretEl = document.getElementById('ac-token-secret');
+        var scopes = [];
+        document.querySelectorAll('.ac-token-scope:checked').forEach(function(cb) { scopes.push(cb.value); });
+        errEl.style.display = 'none';
+        btn.disabled = true;
+        fetch('/api/v1/tokens', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                name: document.getElementById('ac-token-name').value.trim(),
+                scopes: scopes,
+                expires_in_days: parseInt(document.getElementById('ac-token-expires').value, 10)
+            })
+        })
+            .then(function(r) { return r.json(); })
+            .then(function(data) {
+                btn.disabled = false;
+                if (data.error) throw new Error(data.error);
+                document.getElementById('ac-token-form').style.display = 'none';
+                document.getElementById('ac-token-name').value = '';
+                secretEl.innerHTML = '<span class="text-dim">copy it now, it won\'t be shown again:</span> ' +
+                    '<span class="detail-val copyable" data-copy="' + escapeHtml(data.token) + '">' + escapeHtml(data.token) + '</span>';
+                secretEl.style.display = '';
+                setupCopyable(secretEl);
+                loadAccountTokens();
+            })
+            .catch(function(e) {
+                btn.disabled = false;
+                errEl.textContent = e.message;
+                errEl.style.display = '';
+            });
+    });
 
     document.getElementById('ac-passkey-add').addEventListener('click', function() {
         var btn = this;
@@ -525,6 +592,54 @@ function loadAccountPasskeys() {
         });
 }
 
+function loadAccountTokens() {
+    var listEl = document.getElementById('ac-token-list');
+    if (!listEl) return;
+
+    fetch('/api/v1/tokens')
+        .then(function(r) { return r.json(); })
+        .then(function(tokens) {
+            if (!tokens || tokens.length === 0) {
+                listEl.innerHTML = '<span class="text-dim">no tokens</span>';
+                return;
+            }
+            listEl.innerHTML = tokens.map(function(t) {
+                var meta = t.scopes.join(', ');
+                if (t.expired) meta += ' &middot; expired';
+                else if (t.expires_at) meta += ' &middot; expires ' + new Date(t.expires_at).toLocaleDateString();
+                meta += ' &middot; ' + (t.last_used_at ? 'used ' + formatRelativeTime(new Date(t.last_used_at)) : 'never used');
+                return '<div class="ac-passkey-row">' +
+                    '<span class="ac-passkey-label">' + escapeHtml(t.name) + '</span>' +
+                    '<span class="ac-passkey-meta text-dim">' + meta + '</span>' +
+                    '<button class="btn-sm btn-danger ac-token-del" data-id="' + escapeHtml(t.id) + '">revoke</button>' +
+                '</div>';
+            }).join('');
+
+            listEl.querySelectorAll('.ac-token-del').forEach(function(btn) {
+                btn.addEventListener('click', function() {
+                    var id = this.getAttribute('data-id');
+                    if (this.classList.contains('btn-armed')) {
+                        this.textContent = '...';
+                        fetch('/api/v1/tokens/' + id, { method: 'DELETE' })
+                            .then(function() { loadAccountTokens(); })
+                            .catch(function() { loadAccountTokens(); });
+                    } else {
+                        this.classList.add('btn-armed');
+                        this.textContent = 'confirm';
+                        var el = this;
+                        setTimeout(function() {
+                            el.classList.remove('btn-armed');
+                            el.textContent = 'revoke';
+                        }, 3000);
+                    }
+                });
+            });
+        })
+        .catch(function() {
+            listEl.innerHTML = '<span class="text-dim">failed to load</span>';
+        });
+}
+
 function loadNtfyConfig() {
     var el = document.getElementById('ac-ntfy-content');
     if (!el) return;
@@ -1239,7 +1354,7 @@ export function renderWingDetailPage(wingId) {
         '</div>' : '') +
         (isOnline && !isLocked && (w.agents || []).length === 0 ? '<div class="wd-no-agents"><span class="text-dim">no agents installed — run <code>wt doctor</code> on this machine to diagnose</span></div>' : '') +
         (isLocked ? '' : activeHtml) +
-        (isLocked ? '' : '<div class="wd-section"><h3 class="section-label">session history</h3><div id="wd-past-sessions"><span class="text-dim">' + (isOnline ? 'loading...' : 'wing offline') + '</span></div></div>') +
+        (isLocked ? '' : '<div class="wd-section"><h3 class="section-label">session history</h3><input id="wd-session-search" class="wd-search-input" type="search" placeholder="search recordings and chat..." autocomplete="off"><div id="wd-search-results"></div><div id="wd-past-sessions"><span class="text-dim">' + (isOnline ? 'loading...' : 'wing offline') + '</span></div></div>') +
         '<div class="wd-info">' +
             '<div class="detail-row"><span class="detail-key">scope</span><span class="detail-val">' + scopeHtml + '</span></div>' +
             '<div class="detail-row"><span class="detail-key">platform</span><span class="detail-val">' + escapeHtml(w.platform || 'unknown') + '</span></div>' +
@@ -1375,6 +1490,7 @@ export function renderWingDetailPage(wingId) {
 
     if (isOnline && !isLocked) {
         loadWingPastSessions(wingId, 0);
+        wireSessionSearch(wingId);
     } else if (isLocked) {
         var pastEl = document.getElementById('wd-past-sessions');
         if (pastEl) pastEl.innerHTML = '<span class="text-dim">authenticate to view session history</span>';
@@ -1950,6 +2066,62 @@ function loadWingPastSessions(wingId, offset) {
         });
 }
 
+function wireSessionSearch(wingId) {
+    var input = document.getElementById('wd-session-search');
+    var results = document.getElementById('wd-search-results');
+    if (!input || !results) return;
+    input.addEventListener('keydown', function(e) {
+        if (e.key === 'Escape') { input.value = ''; results.innerHTML = ''; return; }
+        if (e.key !== 'Enter') return;
+        e.preventDefault();
+        var query = input.value.trim();
+        if (!query) { results.innerHTML = ''; return; }
+        results.innerHTML = '<span class="text-dim">searching...</span>';
+        sendTunnelRequest(wingId, { type: 'sessions.search', query: query, limit: 20 })
+            .then(function(data) {
+                if (input.value.trim() !== query) return;
+                renderSearchHits(results, wingId, data.hits || []);
+            })
+            .catch(function() {
+                results.innerHTML = '<span class="text-dim">search failed</span>';
+            });
+    });
+}
+
+// highlightSnippet escapes a search snippet and turns the wing's match
+// markers (\x02 ... \x03) into <mark> elements.
+function highlightSnippet(snippet) {
+    return escapeHtml(snippet || '').replace(/\x02/g, '<mark>').replace(/\x03/g, '</mark>');
+}
+
+function renderSearchHits(container, wingId, hits) {
+    if (hits.length === 0) {
+        container.innerHTML = '<span class="text-dim">no matches</span>';
+        return;
+    }
+    container.innerHTML = hits.map(function(h, i) {
+        var name = h.cwd ? projectName(h.cwd) : h.session_id.substring(0, 8);
+        var at = h.at_ms >= 0 ? formatAuditTime(h.at_ms / 1000) : '';
+        var jump = h.audit && h.at_ms >= 0
+            ? '<button class="btn-sm wd-search-jump" data-i="' + i + '">replay at ' + at + '</button>'
+            : '';
+        return '<div class="wd-search-hit">' +
+            '<div class="wd-past-row">' +
+                '<span class="wd-past-name">' + escapeHtml(name) + ' \u00b7 ' + escapeHtml(h.agent || '?') + '</span>' +
+                '<span class="wd-audit-badge">' + escapeHtml(h.source) + '</span>' +
+                jump +
+            '</div>' +
+            '<div class="wd-search-snippet">' + highlightSnippet(h.snippet) + '</div>' +
+        '</div>';
+    }).join('');
+    container.querySelectorAll('.wd-search-jump').forEach(function(btn) {
+        btn.addEventListener('click', function() {
+            var h = hits[parseInt(btn.dataset.i)];
+            openAuditReplay(wingId, h.session_id, h.at_ms / 1000);
+        });
+    });
+}
+
 function renderPastSessions(container, wingId, sessions, hasMore) {
     if (!sessions || sessions.length === 0) {
         container.innerHTML = '<span class="text-dim">no audited sessions</span>';
@@ -31,6 +31,7 @@ export var S = {
     appWsBackoff: 1000,
     latestVersion: '',
     ptyReconnecting: false,
+    pendingReplyChoice: null,
     ptyBandwidthExceeded: false,
     spectating: false,
     currentWingId: null,
@@ -323,7 +323,9 @@ export async function sendTunnelRequest(wingId, innerMsg, opts, _depth) {
     });
 }
 
-export async function sendTunnelStream(wingId, innerMsg, onChunk) {
+// opts.timeout: ms before giving up on the stream (default 2 min, 0 = never,
+// for long-lived streams like forwarded WebSockets).
+export async function sendTunnelStream(wingId, innerMsg, onChunk, opts) {
     var wing = S.wingsData.find(function(w) { return w.wing_id === wingId; });
     if (!wing || !wing.public_key) throw new Error('wing not found or no public key');
 
@@ -350,20 +352,22 @@ export async function sendTunnelStream(wingId, innerMsg, onChunk) {
                 } catch (e) { console.error('tunnel stream decrypt error:', e); }
             }
         };
+        var timeout = opts && opts.timeout !== undefined ? opts.timeout : 120000;
         conn.ws.send(JSON.stringify({
             type: 'tunnel.req',
             wing_id: wingId,
             request_id: requestId,
             sender_pub: identityPubKey,
-            payload: payload
+            payload: payload,
+            long_lived: timeout === 0
         }));
-        setTimeout(function() {
+        if (timeout > 0) setTimeout(function() {
             if (conn.pending[requestId]) {
                 delete conn.pending[requestId];
                 reject(new Error('tunnel stream timeout'));
                 checkIdle(wingId, conn);
             }
-        }, 120000);
+        }, timeout);
     });
 }
 